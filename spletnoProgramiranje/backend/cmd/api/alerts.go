@@ -0,0 +1,257 @@
+package main
+
+import (
+	"backend/cmd/utils"
+	"backend/internal/alerts"
+	"backend/internal/config"
+	"backend/internal/data"
+	"backend/internal/safehttp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"slices"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// maxAlertSubscriptions caps the subscriptions of a user, which bounds
+	// the work of every evaluation.
+	maxAlertSubscriptions = 20
+	// alertDeliveryLog is how many deliveries the delivery log returns.
+	alertDeliveryLog = 50
+	// webhookSecretPrefix marks webhook signing secrets.
+	webhookSecretPrefix = "whsec_"
+)
+
+// setupAlerts starts the alert evaluator and dispatcher, which stop when ctx
+// is cancelled. E-mail delivery is only wired when an SMTP relay is set.
+func setupAlerts(ctx context.Context, cfg config.Alerts, store data.Storage, logger *zap.SugaredLogger) {
+	if !cfg.Enabled {
+		logger.Warnw("alert delivery disabled")
+		return
+	}
+
+	if cfg.AllowPrivateTargets {
+		logger.Warnw("webhooks may reach private addresses")
+	}
+
+	notifiers := map[string]alerts.Notifier{
+		data.AlertWebhook: alerts.NewWebhookNotifier(cfg.WebhookTimeout, cfg.AllowPrivateTargets),
+	}
+	if cfg.SMTP.Addr != "" {
+		notifiers[data.AlertEmail] = alerts.NewEmailNotifier(cfg.SMTP.Addr, cfg.SMTP.From,
+			cfg.SMTP.Username, cfg.SMTP.Password.Value(), cfg.WebhookTimeout)
+	}
+
+	svc := alerts.NewService(store, notifiers, alerts.Options{
+		PollInterval: cfg.PollInterval,
+		MaxAttempts:  cfg.MaxAttempts,
+		RetryBackoff: cfg.RetryBackoff,
+	}, logger)
+
+	go svc.Run(ctx)
+}
+
+func generateWebhookSecret() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return webhookSecretPrefix + hex.EncodeToString(buf), nil
+}
+
+// readAlertSubscription reads and validates a subscription and returns it
+// owned by the logged-in user.
+func (app *app) readAlertSubscription(w http.ResponseWriter, r *http.Request) (*data.AlertSubscription, error) {
+	var payload data.CreateAlertSubscriptionPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		return nil, err
+	}
+
+	if payload.LineID == nil && payload.StopID == nil {
+		return nil, data.NewValidationError("line_id", "required", "line_id or stop_id is required")
+	}
+	if payload.DirectionID != nil && payload.LineID == nil {
+		return nil, data.NewValidationError("line_id", "required", "direction_id requires line_id")
+	}
+	if (payload.WindowStart == "") != (payload.WindowEnd == "") {
+		return nil, data.NewValidationError("window_end", "required", "window_start and window_end must be set together")
+	}
+	if payload.WindowStart != "" && payload.WindowStart == payload.WindowEnd {
+		return nil, data.NewValidationError("window_end", "empty_window", "must differ from window_start")
+	}
+
+	switch payload.Channel {
+	case data.AlertWebhook:
+		u, err := url.Parse(payload.Target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, data.NewValidationError("target", "invalid_url", "must be an http or https URL")
+		}
+		if err := safehttp.CheckURL(u); err != nil && !app.config.Alerts.AllowPrivateTargets {
+			return nil, data.NewValidationError("target", "forbidden_host", "must be on the public internet")
+		}
+	case data.AlertEmail:
+		if app.config.Alerts.SMTP.Addr == "" {
+			return nil, data.NewValidationError("channel", "unavailable", "e-mail alerts are not configured")
+		}
+		addr, err := mail.ParseAddress(payload.Target)
+		if err != nil || addr.Address != payload.Target {
+			return nil, data.NewValidationError("target", "invalid_email", "must be an e-mail address")
+		}
+	}
+
+	minDelay := payload.MinDelayMin
+	if minDelay == 0 {
+		minDelay = disruptionDelay
+	}
+
+	// Keep weekdays unique and in calendar order.
+	weekdays := make([]string, 0, len(payload.Weekdays))
+	for _, day := range data.Weekdays {
+		if slices.Contains(payload.Weekdays, day) {
+			weekdays = append(weekdays, day)
+		}
+	}
+
+	return &data.AlertSubscription{
+		UserID:      GetUserIDFromContext(r.Context()),
+		Name:        payload.Name,
+		LineID:      payload.LineID,
+		DirectionID: payload.DirectionID,
+		StopID:      payload.StopID,
+		MinDelayMin: minDelay,
+		WindowStart: payload.WindowStart,
+		WindowEnd:   payload.WindowEnd,
+		Weekdays:    weekdays,
+		Channel:     payload.Channel,
+		Target:      payload.Target,
+	}, nil
+}
+
+// createdAlertSubscription is the only response that carries the webhook
+// signing secret.
+type createdAlertSubscription struct {
+	data.AlertSubscription
+	Secret string `json:"secret,omitempty"`
+}
+
+// @Summary		List alert subscriptions
+// @Description	Returns the delay alert subscriptions of the logged-in user. Signing secrets are not included.
+// @Tags			alerts
+// @Produce		json
+// @Success		200	{array}	data.AlertSubscription	"Alert subscriptions"
+// @Router			/me/alerts [get]
+// @Security		ApiKeyAuth
+func (app *app) listAlertSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	subs, err := app.store.Alerts.ListSubscriptions(r.Context(), GetUserIDFromContext(r.Context()))
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, subs)
+}
+
+// @Summary		Subscribe to delay alerts
+// @Description	Subscribes to delay reports for a line, a direction of a line, a stop or a line at a stop.
+// @Description	A report alerts when it is at least min_delay_min (default 5) minutes late and, when set,
+// @Description	was filed on one of weekdays within window_start and window_end ("15:04", the window may
+// @Description	wrap past midnight). Alerts are POSTed to a webhook URL, signed with the secret returned
+// @Description	here (X-Alert-Signature: sha256=HMAC-SHA256(secret, "<X-Alert-Timestamp>.<body>")), or
+// @Description	e-mailed when the server has SMTP configured. A user can have at most 20 subscriptions.
+// @Tags			alerts
+// @Accept			json
+// @Produce		json
+// @Param			subscription	body		data.CreateAlertSubscriptionPayload	true	"The subscription"
+// @Success		201				{object}	createdAlertSubscription			"The subscription and its signing secret"
+// @Router			/me/alerts [post]
+// @Security		ApiKeyAuth
+func (app *app) createAlertSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	sub, err := app.readAlertSubscription(w, r)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	if sub.Channel == data.AlertWebhook {
+		if sub.Secret, err = generateWebhookSecret(); err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	err = app.store.WithTx(ctx, func(tx data.Storage) error {
+		// Concurrent requests would otherwise all pass the limit check.
+		if err := tx.User.Lock(ctx, sub.UserID); err != nil {
+			return err
+		}
+		existing, err := tx.Alerts.ListSubscriptions(ctx, sub.UserID)
+		if err != nil {
+			return err
+		}
+		if len(existing) >= maxAlertSubscriptions {
+			return data.NewValidationError("body", "too_many", fmt.Sprintf("at most %d alert subscriptions are allowed", maxAlertSubscriptions))
+		}
+
+		return tx.Alerts.CreateSubscription(ctx, sub)
+	})
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusCreated, createdAlertSubscription{AlertSubscription: *sub, Secret: sub.Secret})
+}
+
+// @Summary		Delete an alert subscription
+// @Description	Deletes the subscription and its delivery log.
+// @Tags			alerts
+// @Param			subscriptionId	path	int	true	"Subscription ID"
+// @Success		204
+// @Router			/me/alerts/{subscriptionId} [delete]
+// @Security		ApiKeyAuth
+func (app *app) deleteAlertSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r, "subscriptionId")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Alerts.DeleteSubscription(r.Context(), GetUserIDFromContext(r.Context()), id); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary		List alert deliveries
+// @Description	Returns the 50 newest deliveries of a subscription, newest first: what was sent, how often
+// @Description	it was tried, the last error and whether it is pending, delivered or failed.
+// @Tags			alerts
+// @Produce		json
+// @Param			subscriptionId	path	int					true	"Subscription ID"
+// @Success		200				{array}	data.AlertDelivery	"Delivery log"
+// @Router			/me/alerts/{subscriptionId}/deliveries [get]
+// @Security		ApiKeyAuth
+func (app *app) listAlertDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r, "subscriptionId")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	deliveries, err := app.store.Alerts.ListDeliveries(r.Context(), GetUserIDFromContext(r.Context()), id, alertDeliveryLog)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, deliveries)
+}
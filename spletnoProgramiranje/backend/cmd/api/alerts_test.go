@@ -0,0 +1,173 @@
+package main
+
+import (
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateAlertSubscription(t *testing.T) {
+	app := setupTestApp()
+	locked := false
+	app.store.User.(*MockUsersStorage).LockFunc = func(ctx context.Context, id int) error {
+		assert.Equal(t, 1, id)
+		locked = true
+		return nil
+	}
+	mock := app.store.Alerts.(*MockAlertsStorage)
+	mock.ListSubscriptionsFunc = func(ctx context.Context, userID int) ([]data.AlertSubscription, error) {
+		assert.True(t, locked, "the user is locked before the limit is checked")
+		return []data.AlertSubscription{}, nil
+	}
+
+	var created data.AlertSubscription
+	mock.CreateSubscriptionFunc = func(ctx context.Context, sub *data.AlertSubscription) error {
+		created = *sub
+		sub.ID = 3
+		return nil
+	}
+
+	req, w := adminRequest(t, app, data.RoleUser, "POST", "/v1/me/alerts", map[string]any{
+		"name":         "Line 6 to Tabor",
+		"line_id":      2,
+		"direction_id": 3,
+		"window_start": "07:00",
+		"window_end":   "08:00",
+		"weekdays":     []string{"fri", "mon", "tue", "wed", "thu"},
+		"channel":      data.AlertWebhook,
+		"target":       "https://example.com/hook",
+	})
+	app.mount().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Equal(t, 1, created.UserID)
+	assert.Equal(t, disruptionDelay, created.MinDelayMin, "the threshold defaults to 5 minutes")
+	assert.Equal(t, []string{"mon", "tue", "wed", "thu", "fri"}, created.Weekdays)
+	assert.True(t, strings.HasPrefix(created.Secret, webhookSecretPrefix))
+
+	var res struct {
+		Data map[string]any `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, float64(3), res.Data["id"])
+	assert.Equal(t, created.Secret, res.Data["secret"], "the secret is returned once")
+}
+
+func TestCreateAlertSubscriptionValidation(t *testing.T) {
+	valid := func() map[string]any {
+		return map[string]any{
+			"name":    "Line 6",
+			"line_id": 2,
+			"channel": data.AlertWebhook,
+			"target":  "https://example.com/hook",
+		}
+	}
+
+	tests := []struct {
+		name   string
+		field  string
+		value  any
+		code   string
+		remove string
+	}{
+		{"no line or stop", "stop_id", nil, "required", "line_id"},
+		{"direction without line", "direction_id", 3, "required", "line_id"},
+		{"half a window", "window_start", "07:00", "required", ""},
+		{"malformed window", "window_start", "7am", "invalid_time", ""},
+		{"unknown weekday", "weekdays", []string{"someday"}, "not_allowed", ""},
+		{"unknown channel", "channel", "sms", "not_allowed", ""},
+		{"webhook without url", "target", "example.com", "invalid_url", ""},
+		{"webhook to the metadata service", "target", "http://169.254.169.254/latest/meta-data/", "forbidden_host", ""},
+		{"webhook to loopback", "target", "http://localhost:8080/hook", "forbidden_host", ""},
+		{"e-mail without smtp", "channel", data.AlertEmail, "unavailable", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := setupTestApp()
+			app.store.Alerts.(*MockAlertsStorage).CreateSubscriptionFunc = func(ctx context.Context, sub *data.AlertSubscription) error {
+				t.Fatal("subscription must not be created")
+				return nil
+			}
+
+			body := valid()
+			if tt.value != nil {
+				body[tt.field] = tt.value
+			}
+			if tt.remove != "" {
+				delete(body, tt.remove)
+			}
+
+			req, w := adminRequest(t, app, data.RoleUser, "POST", "/v1/me/alerts", body)
+			app.mount().ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), `"code":"`+tt.code+`"`)
+		})
+	}
+}
+
+func TestCreateLocalWebhookInDevelopment(t *testing.T) {
+	app := setupTestApp()
+	app.config.Alerts.AllowPrivateTargets = true
+
+	mock := app.store.Alerts.(*MockAlertsStorage)
+	mock.ListSubscriptionsFunc = func(ctx context.Context, userID int) ([]data.AlertSubscription, error) {
+		return []data.AlertSubscription{}, nil
+	}
+	mock.CreateSubscriptionFunc = func(ctx context.Context, sub *data.AlertSubscription) error {
+		return nil
+	}
+
+	req, w := adminRequest(t, app, data.RoleUser, "POST", "/v1/me/alerts", map[string]any{
+		"name": "Line 6", "line_id": 2, "channel": data.AlertWebhook, "target": "http://localhost:8080/hook",
+	})
+	app.mount().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+}
+
+func TestCreateEmailAlertSubscription(t *testing.T) {
+	app := setupTestApp()
+	app.config.Alerts.SMTP.Addr = "localhost:25"
+
+	mock := app.store.Alerts.(*MockAlertsStorage)
+	mock.ListSubscriptionsFunc = func(ctx context.Context, userID int) ([]data.AlertSubscription, error) {
+		return []data.AlertSubscription{}, nil
+	}
+	mock.CreateSubscriptionFunc = func(ctx context.Context, sub *data.AlertSubscription) error {
+		assert.Empty(t, sub.Secret, "e-mails are not signed")
+		return nil
+	}
+
+	body := map[string]any{"name": "Center", "stop_id": 1, "channel": data.AlertEmail, "target": "Alice <alice@example.com>"}
+	req, w := adminRequest(t, app, data.RoleUser, "POST", "/v1/me/alerts", body)
+	app.mount().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"invalid_email"`, "only bare addresses are accepted")
+
+	body["target"] = "alice@example.com"
+	req, w = adminRequest(t, app, data.RoleUser, "POST", "/v1/me/alerts", body)
+	app.mount().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+}
+
+func TestListAlertDeliveriesOfAnotherUser(t *testing.T) {
+	app := setupTestApp()
+	app.store.Alerts.(*MockAlertsStorage).ListDeliveriesFunc = func(ctx context.Context, userID int, id int64, limit int) ([]data.AlertDelivery, error) {
+		assert.Equal(t, 1, userID)
+		assert.Equal(t, int64(9), id)
+		return nil, data.ErrNotFound
+	}
+
+	req, w := adminRequest(t, app, data.RoleUser, "GET", "/v1/me/alerts/9/deliveries", nil)
+	app.mount().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
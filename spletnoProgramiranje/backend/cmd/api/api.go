@@ -1,8 +1,15 @@
 package main
 
 import (
+	"backend/internal/config"
 	"backend/internal/data"
+	"backend/internal/metrics"
+	"backend/internal/push"
+	"backend/internal/ratelimit"
+	"backend/internal/tracing"
+	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"time"
 
@@ -17,23 +24,19 @@ import (
 )
 
 type app struct {
-	serverConfig config
-	store        data.Storage
-	logger       *zap.SugaredLogger
-}
-
-type config struct {
-	address string
-	db      dbConfig
-	env     string
-	apiURL  string
-}
-
-type dbConfig struct {
-	addr               string
-	maxOpenConnections int
-	maxIdleConnections int
-	maxIdleTime        string
+	config      *config.Config
+	store       data.Storage
+	logger      *zap.SugaredLogger
+	rateLimiter ratelimit.Store
+	// pushKeys is nil when Web Push is disabled.
+	pushKeys *push.Keys
+	// readiness lists the dependencies /readyz checks.
+	readiness []readinessCheck
+	drain     drain
+	// tiles caches rendered vector tiles.
+	tiles *tileCache
+	// stopIndex caches the stop search index.
+	stopIndex *stopIndexCache
 }
 
 var wsUpgrader = websocket.Upgrader{
@@ -47,68 +50,107 @@ var wsUpgrader = websocket.Upgrader{
 func (app *app) mount() http.Handler {
 	r := chi.NewRouter()
 
+	// Validated when the configuration was loaded.
+	trustedProxies, _ := app.config.TrustedProxyPrefixes()
+
 	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:5173"},
-		AllowedHeaders:   []string{"Accept", "Content-Type"},
+		AllowedOrigins:   app.config.CORS.AllowedOrigins,
+		AllowedHeaders:   []string{"Accept", "Content-Type", apiKeyHeader},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		ExposedHeaders:   []string{"Link"},
+		ExposedHeaders:   []string{"Link", "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 
-	r.Use(middleware.Logger)
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(realIP(trustedProxies))
+	r.Use(tracing.Middleware)
+	r.Use(app.logRequests)
+	r.Use(instrument)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Timeout(60 * time.Second))
 
+	r.Get("/livez", app.livezHandler)
+	r.Get("/readyz", app.readyzHandler)
+
 	r.Group(func(ws chi.Router) {
+		ws.Use(app.authenticateAPIKey, app.requireScope(data.ScopeReadRealtime))
 		ws.Get("/v1/estimate/simulate/{lineId}", app.serveRealtimeLine) // simulates an estimate of current bus locations through the city
 	})
 
 	// version 1.0 group of the api routes
 	// easy addition of new handlers and routes in the future without breaking the current funcionality
 	r.Route("/v1", func(r chi.Router) {
+		r.Use(app.authenticateAPIKey)
+		r.Use(app.identifyUser)
+		r.Use(app.rateLimit(policyDefault))
+
 		r.Get("/health", app.WithJWTAuth(app.healthCheckHandler))
 
-		docsURL := fmt.Sprintf("%s/swagger/doc.json", app.serverConfig.address)
+		docsURL := fmt.Sprintf("%s/swagger/doc.json", app.config.Addr)
 		r.Get("/swagger/*", httpSwagger.Handler(
 			httpSwagger.URL(docsURL),
 		))
 
 		r.Route("/stations", func(r chi.Router) {
-			r.Get("/list", app.stationsListHandler)               // fetch a list of basic station data for displaying a list
-			r.Get("/location/{stationId}", app.getStationHandler) // fetch geolocation data of a station
-			r.Get("/{stationId}", app.getStationMetadataHandler)  // fetch detailed station data, like the geolocation, depatrute times and associated bus lines
-			r.Post("/closeBy", app.getStationsCloseBy)            // fetch all of the stations in a specified radius from the given location
+			r.Use(app.requireScope(data.ScopeReadTimetable))
+
+			r.Get("/list", app.stationsListHandler)                                       // fetch a list of basic station data for displaying a list
+			r.Get("/search", app.searchStationsHandler)                                   // search stops by name, forgiving missing diacritics and typos
+			r.Get("/location/{stationId}", app.getStationHandler)                         // fetch geolocation data of a station
+			r.Get("/{stationId}", app.getStationMetadataHandler)                          // fetch detailed station data, like the geolocation, depatrute times and associated bus lines
+			r.With(app.rateLimit(policyCloseBy)).Post("/closeBy", app.getStationsCloseBy) // fetch all of the stations in a specified radius from the given location
+		})
+
+		r.Route("/parent-stations", func(r chi.Router) {
+			r.Use(app.requireScope(data.ScopeReadTimetable))
+
+			r.Get("/", app.listParentStationsHandler)          // list the stations stops are clustered into
+			r.Get("/{stationId}", app.getParentStationHandler) // fetch a station with the lines, departures, delays and alerts of all its stops
 		})
 
 		r.Route("/routes", func(r chi.Router) {
-			r.Get("/{lineId}", app.getRouteOfLineHandler)              // fetch the route of a specifc line based on the id
-			r.Get("/stations/{lineId}", app.getStationsOnRouteHandler) // fetch all stops that appear on this route
-			r.Get("/list", app.routesListHandler)                      // fetch all routes to display entire bus coverage on the map
-			r.Get("/active", app.getActiveRoutes)                      // fetch all of the currently active routes
+			r.Group(func(r chi.Router) {
+				r.Use(app.requireScope(data.ScopeReadTimetable))
+
+				r.Get("/{lineId}", app.getRouteOfLineHandler)              // fetch the route of a specifc line based on the id
+				r.Get("/stations/{lineId}", app.getStationsOnRouteHandler) // fetch all stops that appear on this route
+				r.Get("/list", app.routesListHandler)                      // fetch all routes to display entire bus coverage on the map
+
+				r.Get("/{lineId}/directions", app.getLineDirectionsHandler)               // fetch the directions a line runs in
+				r.Get("/{lineId}/directions/{dirId}/stops", app.getDirectionStopsHandler) // fetch the stops of a direction in calling order
+			})
+			r.With(app.requireScope(data.ScopeReadRealtime)).Get("/active", app.getActiveRoutes) // fetch all of the currently active routes
 		})
 
+		r.With(app.requireScope(data.ScopeReadTimetable)).Get("/service-alerts", app.listActiveServiceAlertsHandler) // fetch the service alerts in effect now
+		r.With(app.requireScope(data.ScopeReadTimetable)).Get("/tiles/{z}/{x}/{y}.mvt", app.getTileHandler)          // fetch a vector tile of stops, routes and delays
+
 		r.Route("/authentication", func(r chi.Router) {
-			r.Post("/register", app.usersResgisterUser)               // creating a new user
-			r.Post("/login", app.usersLoginUser)                      // logging in an existing user
-			r.Put("/update", app.WithJWTAuth(app.usersUpdateProfile)) // update the user profile
+			r.With(app.rateLimit(policyRegister)).Post("/register", app.usersResgisterUser)                                                                  // creating a new user
+			r.With(app.rateLimit(policyLogin), app.rateLimit(policyLoginAccount), app.rateLimit(policyLoginAccountTotal)).Post("/login", app.usersLoginUser) // logging in an existing user
+			r.Put("/update", app.WithJWTAuth(app.usersUpdateProfile))                                                                                        // update the user profile
 			r.Get("/users/{id}", app.getUserByID)
 		})
 
 		r.Route("/delays", func(r chi.Router) {
-			r.Get("/station/{stationId}", app.getDelaysForStation)     // fetch all delays for specific station
-			r.Get("/recent/line/{lineId}", app.getRecentDelaysForLine) // fetch recent delays for specific line
-			r.Get("/user/{userId}", app.getDelaysFromUser)             // fetch delays submitted by a user
-			r.Get("/recent", app.getRecentOverallDelays)               // fetch the overall most recent delays
-			r.Get("/lines/number", app.getNumDelaysForLine)            // fetch the number of delays for each line
-			r.Get("/average/{lineId}", app.getAvgDelayForLine)         // fetch the average delay time for a specific line
-			r.Get("/average", app.getAvgDelay)                         // fetch the average delay time overall
-			r.Post("/report", app.submitDelayReport)
+			r.Group(func(r chi.Router) {
+				r.Use(app.requireScope(data.ScopeReadRealtime))
+
+				r.Get("/station/{stationId}", app.getDelaysForStation)     // fetch all delays for specific station
+				r.Get("/recent/line/{lineId}", app.getRecentDelaysForLine) // fetch recent delays for specific line
+				r.Get("/user/{userId}", app.getDelaysFromUser)             // fetch delays submitted by a user
+				r.Get("/recent", app.getRecentOverallDelays)               // fetch the overall most recent delays
+				r.Get("/lines/number", app.getNumDelaysForLine)            // fetch the number of delays for each line
+				r.Get("/average/{lineId}", app.getAvgDelayForLine)         // fetch the average delay time for a specific line
+				r.Get("/average", app.getAvgDelay)                         // fetch the average delay time overall
+			})
+			r.With(app.requireScope(data.ScopeWriteDelays), app.rateLimit(policyDelayReport)).Post("/report", app.submitDelayReport)
 		})
 
 		r.Route("/occupancy", func(r chi.Router) {
+			r.Use(app.requireScope(data.ScopeReadTimetable))
+
 			r.Get("/line/{lineId}/date/{date}", app.getLineOccupancyThroughDay)          // fetch the occupancy of a line throughout a day
 			r.Get("/line/{lineId}/date/{date}/hour/{hour}", app.getLineOccupancyForHour) // fetch the occupancy of a line on a specific date for a specific hour
 			r.Get("/average/{hour}", app.getAvgLineOccupancyForHour)                     // fetch the occupancy of a line on a specific date for a specific hour
@@ -116,28 +158,139 @@ func (app *app) mount() http.Handler {
 		})
 
 		r.Route("/show", func(r chi.Router) {
-			r.Post("/shortest", app.getShortestPath) // finds the most optimal path to he desired location
+			r.Use(app.requireScope(data.ScopeReadTimetable))
+
+			r.Post("/shortest", app.getShortestPath)                                           // finds the most optimal path to he desired location
+			r.With(app.rateLimit(policyIsochrone)).Post("/isochrone", app.getIsochroneHandler) // finds where a rider can get within a time
+		})
+
+		r.Route("/me", func(r chi.Router) {
+			r.Get("/favourites", app.WithJWTAuth(app.listFavouritesHandler))                                     // list the user's favourites
+			r.Post("/favourites", app.WithJWTAuth(app.createFavouriteHandler))                                   // pin a stop, line or line at a stop
+			r.Put("/favourites/order", app.WithJWTAuth(app.reorderFavouritesHandler))                            // reorder the user's favourites
+			r.Delete("/favourites/{favouriteId}", app.WithJWTAuth(app.deleteFavouriteHandler))                   // remove a favourite
+			r.Get("/board", app.WithJWTAuth(app.getBoardHandler))                                                // departures and delays for every favourite
+			r.Get("/trips", app.WithJWTAuth(app.listTripsHandler))                                               // list the user's saved trips
+			r.Post("/trips", app.WithJWTAuth(app.createTripHandler))                                             // save a named trip
+			r.Get("/trips/today", app.WithJWTAuth(app.getTodaysTripsHandler))                                    // leave-by times and disruptions for today's trips
+			r.Put("/trips/{tripId}", app.WithJWTAuth(app.updateTripHandler))                                     // update a saved trip
+			r.Delete("/trips/{tripId}", app.WithJWTAuth(app.deleteTripHandler))                                  // delete a saved trip
+			r.Get("/alerts", app.WithJWTAuth(app.listAlertSubscriptionsHandler))                                 // list the user's alert subscriptions
+			r.Post("/alerts", app.WithJWTAuth(app.createAlertSubscriptionHandler))                               // subscribe to delay alerts
+			r.Delete("/alerts/{subscriptionId}", app.WithJWTAuth(app.deleteAlertSubscriptionHandler))            // delete an alert subscription
+			r.Get("/alerts/{subscriptionId}/deliveries", app.WithJWTAuth(app.listAlertDeliveriesHandler))        // delivery log of a subscription
+			r.Get("/push/key", app.WithJWTAuth(app.getVAPIDKeyHandler))                                          // the VAPID key browsers subscribe with
+			r.Get("/push/subscriptions", app.WithJWTAuth(app.listPushSubscriptionsHandler))                      // list the user's push subscriptions
+			r.Post("/push/subscriptions", app.WithJWTAuth(app.createPushSubscriptionHandler))                    // register a browser for push notifications
+			r.Delete("/push/subscriptions/{subscriptionId}", app.WithJWTAuth(app.deletePushSubscriptionHandler)) // unregister a browser
+		})
+
+		r.Route("/admin", func(r chi.Router) {
+			admin := func(h http.HandlerFunc) http.HandlerFunc { return app.WithJWTAuth(app.requireAdmin(h)) }
+
+			r.Post("/api-keys", admin(app.createAPIKeyHandler))                              // issue a new api key
+			r.Get("/api-keys", admin(app.listAPIKeysHandler))                                // list all api keys
+			r.Delete("/api-keys/{keyId}", admin(app.revokeAPIKeyHandler))                    // revoke an api key
+			r.Get("/api-keys/{keyId}/usage", admin(app.getAPIKeyUsageHandler))               // fetch daily usage of an api key
+			r.Get("/delays/{delayId}/audit", admin(app.getDelayAuditHandler))                // fetch who filed a delay report
+			r.Post("/service-alerts", admin(app.createServiceAlertHandler))                  // announce a stop closure, detour or other change
+			r.Get("/service-alerts", admin(app.listServiceAlertsHandler))                    // list all service alerts, including expired ones
+			r.Get("/service-alerts/{alertId}", admin(app.getServiceAlertHandler))            // fetch a service alert
+			r.Put("/service-alerts/{alertId}", admin(app.updateServiceAlertHandler))         // replace a service alert
+			r.Delete("/service-alerts/{alertId}", admin(app.deleteServiceAlertHandler))      // delete a service alert
+			r.Get("/routes/{lineId}/shapes", admin(app.listRouteShapesHandler))              // list the path versions of a line's directions
+			r.Post("/route-shapes", admin(app.createRouteShapeHandler))                      // add a path version, such as a roadworks detour
+			r.Delete("/route-shapes/{shapeId}", admin(app.deleteRouteShapeHandler))          // delete a path version
+			r.Get("/station-overrides", admin(app.listStationOverridesHandler))              // list the stops moved to a station by hand
+			r.Put("/station-overrides/{stopId}", admin(app.setStationOverrideHandler))       // move a stop to another station
+			r.Delete("/station-overrides/{stopId}", admin(app.deleteStationOverrideHandler)) // let clustering place the stop again
 		})
 	})
 
 	return r
 }
 
-func (app *app) run(mux http.Handler) error {
+// opsMux serves what operators scrape rather than what clients call. It
+// listens on its own address so metrics are never reachable through the
+// public API.
+func opsMux() http.Handler {
+	r := chi.NewRouter()
+	r.Handle("/metrics", metrics.Handler())
+	return r
+}
+
+// run serves mux until ctx is done, then shuts down gracefully: /readyz
+// starts failing, WebSocket streams receive a close frame and in-flight
+// requests are drained for at most the configured shutdown timeout. It
+// returns nil after a clean shutdown. The ops listener, when configured,
+// runs alongside and stops last so the shutdown itself can be scraped.
+func (app *app) run(ctx context.Context, mux http.Handler) error {
 
-	docs.SwaggerInfo.Host = app.serverConfig.apiURL
+	docs.SwaggerInfo.Host = app.config.ExternalURL
 
 	server := &http.Server{
-		Addr:         app.serverConfig.address,
+		Addr:         app.config.Addr,
 		Handler:      mux,
 		WriteTimeout: time.Second * 300,
 		ReadTimeout:  time.Second * 300,
 		IdleTimeout:  time.Minute,
 	}
 
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return err
+	}
+
 	app.logger.Infow("Server started",
-		"address", app.serverConfig.address,
+		"address", listener.Addr().String(),
 	)
 
-	return server.ListenAndServe()
+	serveErr := make(chan error, 2)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+
+	if app.config.MetricsAddr != "" {
+		ops := &http.Server{
+			Addr:        app.config.MetricsAddr,
+			Handler:     opsMux(),
+			ReadTimeout: 10 * time.Second,
+		}
+		opsListener, err := net.Listen("tcp", ops.Addr)
+		if err != nil {
+			server.Close()
+			return fmt.Errorf("ops listener: %w", err)
+		}
+		defer ops.Close()
+
+		app.logger.Infow("ops server started", "address", opsListener.Addr().String())
+
+		go func() {
+			serveErr <- ops.Serve(opsListener)
+		}()
+	}
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	app.logger.Infow("shutting down", "timeout", app.config.ShutdownTimeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), app.config.ShutdownTimeout)
+	defer cancel()
+
+	app.drain.begin()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("draining http requests: %w", err)
+	}
+	if err := app.drain.wait(shutdownCtx); err != nil {
+		return fmt.Errorf("draining websocket streams: %w", err)
+	}
+
+	app.logger.Infow("server stopped")
+
+	return nil
 }
@@ -1,44 +1,70 @@
 package main
 
 import (
+	"backend/internal/config"
 	"backend/internal/data"
+	"backend/internal/ratelimit"
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 )
 
+// testJWTSecret signs the tokens of the apps built by setupTestApp.
+const testJWTSecret = "test-jwt-secret-of-at-least-32-bytes"
+
 // Test setup helper
 func setupTestApp() *app {
 	logger := zap.NewNop().Sugar()
 
+	cfg := config.Defaults()
+	cfg.Env = "test"
+	cfg.Auth.JWTSecret = testJWTSecret
+	cfg.MetricsAddr = ""
+
 	return &app{
-		serverConfig: config{
-			address: ":8080",
-			db: dbConfig{
-				addr:               "test",
-				maxOpenConnections: 10,
-				maxIdleConnections: 5,
-				maxIdleTime:        "5m",
-			},
-			env:    "test",
-			apiURL: "localhost:8080",
-		},
+		config: &cfg,
 		store: data.Storage{
-			User:      &MockUsersStorage{},
-			Stations:  &MockStationsStorage{},
-			Routes:    &MockRoutesStorage{},
-			Delays:    &MockDelaysStorage{},
-			Occupancy: &MockOccupancyStorage{},
+			User: &MockUsersStorage{
+				LockFunc: func(context.Context, int) error { return nil },
+			},
+			Stations:   &MockStationsStorage{},
+			Routes:     &MockRoutesStorage{},
+			Delays:     &MockDelaysStorage{},
+			Occupancy:  &MockOccupancyStorage{},
+			APIKeys:    &MockAPIKeysStorage{},
+			Favourites: &MockFavouritesStorage{},
+			Trips:      &MockTripsStorage{},
+			Alerts:     &MockAlertsStorage{},
+			Push:       &MockPushStorage{},
+			ServiceAlerts: &MockServiceAlertsStorage{
+				ListFunc: func(context.Context, data.ServiceAlertFilter) ([]data.ServiceAlert, error) {
+					return []data.ServiceAlert{}, nil
+				},
+			},
+			RouteShapes: &MockRouteShapesStorage{},
+			StationOverrides: &MockStationOverridesStorage{
+				ListFunc: func(context.Context) ([]data.StationOverride, error) {
+					return []data.StationOverride{}, nil
+				},
+			},
 		},
-		logger: logger,
+		logger:    logger,
+		tiles:     newTileCache(tileCacheSize, tileCacheTTL),
+		stopIndex: newStopIndexCache(stopIndexTTL),
 	}
 }
 
@@ -89,6 +115,61 @@ func TestHealthCheckHandler(t *testing.T) {
 	assert.Equal(t, version, response.Data["version"])
 }
 
+func TestLivezHandler(t *testing.T) {
+	app := setupTestApp()
+	app.readiness = []readinessCheck{
+		{"database", func(context.Context) error { return assert.AnError }},
+	}
+
+	req, w := createTestRequest("GET", "/livez", nil)
+	app.mount().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code, "liveness ignores dependencies")
+}
+
+func TestReadyzHandler(t *testing.T) {
+	app := setupTestApp()
+	healthy := true
+	app.readiness = []readinessCheck{
+		{"database", func(context.Context) error { return nil }},
+		{"postgis", func(context.Context) error {
+			if healthy {
+				return nil
+			}
+			return errors.New("extension postgis is not installed")
+		}},
+	}
+
+	readyz := func() (int, readinessResponse) {
+		req, w := createTestRequest("GET", "/readyz", nil)
+		app.mount().ServeHTTP(w, req)
+
+		var response struct {
+			Data readinessResponse `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.NotContains(t, w.Body.String(), "not installed", "failure details are only logged")
+		return w.Code, response.Data
+	}
+
+	code, res := readyz()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", res.Status)
+	assert.Equal(t, map[string]string{"database": "ok", "postgis": "ok"}, res.Checks)
+
+	healthy = false
+	code, res = readyz()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "unavailable", res.Status)
+	assert.Equal(t, "fail", res.Checks["postgis"])
+
+	healthy = true
+	app.drain.begin()
+	code, res = readyz()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "shutting_down", res.Status)
+}
+
 func TestStationsListHandler(t *testing.T) {
 	app := setupTestApp()
 	mockStations := app.store.Stations.(*MockStationsStorage)
@@ -227,7 +308,7 @@ func TestGetRouteOfLineHandler(t *testing.T) {
 		Path:   [][]float64{{46.0569, 14.5058}, {46.0569, 14.5059}},
 	}
 
-	mockRoutes.ReadRouteFunc = func(ctx context.Context, id int64) (*data.Route, error) {
+	mockRoutes.ReadRouteFunc = func(ctx context.Context, id int64, q data.RouteQuery) (*data.Route, error) {
 		return expectedRoute, nil
 	}
 
@@ -334,14 +415,13 @@ func TestUsersRegisterUser(t *testing.T) {
 	mockUsers := app.store.User.(*MockUsersStorage)
 
 	userData := map[string]interface{}{
-		"email":     "test@example.com",
-		"password":  "password123",
-		"firstName": "John",
-		"lastName":  "Doe",
+		"username": "johndoe",
+		"email":    "test@example.com",
+		"password": "password123",
 	}
 
 	mockUsers.GetByEmailFunc = func(ctx context.Context, email string) (*data.User, error) {
-		return nil, fmt.Errorf("user not found")
+		return nil, data.ErrNotFound
 	}
 	mockUsers.CreateFunc = func(ctx context.Context, user *data.User) error {
 		user.ID = 1
@@ -489,13 +569,19 @@ func TestSubmitDelayReport(t *testing.T) {
 	mockUsers := app.store.User.(*MockUsersStorage)
 
 	delayReport := map[string]interface{}{
-		"lineId":      1,
-		"stationId":   1,
-		"delayTime":   5.5,
-		"description": "Traffic congestion",
+		"date":       "2024-01-15T08:00:00Z",
+		"delay_min":  5,
+		"stop_id":    1,
+		"line_id":    1,
+		"user_email": "test@example.com",
 	}
 
-	mockDelays.InsertDelayFunc = func(ctx context.Context, delay data.DelayReportInputUnMarshaled) error {
+	mockDelays.InsertDelayFunc = func(ctx context.Context, delay data.DelayReportInputUnMarshaled) (int, error) {
+		return 7, nil
+	}
+	var audit data.DelayAudit
+	mockDelays.InsertAuditFunc = func(ctx context.Context, a *data.DelayAudit) error {
+		audit = *a
 		return nil
 	}
 	mockUsers.GetByEmailFunc = func(ctx context.Context, email string) (*data.User, error) {
@@ -503,10 +589,17 @@ func TestSubmitDelayReport(t *testing.T) {
 	}
 
 	req, w := createTestRequest("POST", "/v1/delays/report", delayReport)
+	req = req.WithContext(context.WithValue(req.Context(), apiKeyContextKey, &data.APIKey{ID: 4}))
 
 	app.submitDelayReport(w, req)
 
 	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, 7, audit.DelayID)
+	assert.Equal(t, data.DelayAuditSubmitted, audit.Action)
+	require.NotNil(t, audit.UserID)
+	assert.Equal(t, 1, *audit.UserID)
+	require.NotNil(t, audit.APIKeyID)
+	assert.Equal(t, int64(4), *audit.APIKeyID)
 
 	var response struct {
 		Data map[string]interface{} `json:"data"`
@@ -520,6 +613,30 @@ func TestSubmitDelayReport(t *testing.T) {
 	assert.Equal(t, "Delay report submitted successfully", response.Data["message"])
 }
 
+func TestGetDelayAudit(t *testing.T) {
+	app := setupTestApp()
+	userID := 1
+	app.store.Delays.(*MockDelaysStorage).ListAuditFunc = func(ctx context.Context, delayID int) ([]data.DelayAudit, error) {
+		assert.Equal(t, 7, delayID)
+		return []data.DelayAudit{{ID: 1, DelayID: 7, Action: data.DelayAuditSubmitted, UserID: &userID}}, nil
+	}
+
+	req, w := adminRequest(t, app, data.RoleUser, "GET", "/v1/admin/delays/7/audit", nil)
+	app.mount().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	req, w = adminRequest(t, app, data.RoleAdmin, "GET", "/v1/admin/delays/7/audit", nil)
+	app.mount().ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var res struct {
+		Data []data.DelayAudit `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	require.Len(t, res.Data, 1)
+	assert.Equal(t, &userID, res.Data[0].UserID)
+}
+
 func TestGetLineOccupancyThroughDay(t *testing.T) {
 	app := setupTestApp()
 	mockOccupancy := app.store.Occupancy.(*MockOccupancyStorage)
@@ -586,6 +703,7 @@ func TestGetLineOccupancyForHour(t *testing.T) {
 
 func TestGetShortestPath(t *testing.T) {
 	app := setupTestApp()
+	mockStationStops(app)
 	mockStations := app.store.Stations.(*MockStationsStorage)
 
 	// Provide a mock implementation to avoid nil pointer dereference
@@ -619,6 +737,395 @@ func TestGetShortestPath(t *testing.T) {
 	assert.True(t, w.Code >= 200 && w.Code < 600)
 }
 
+func TestGetStationHandlerNotFound(t *testing.T) {
+	app := setupTestApp()
+	mockStations := app.store.Stations.(*MockStationsStorage)
+
+	mockStations.ReadStationFunc = func(ctx context.Context, id int64) (*data.Stop, error) {
+		return nil, fmt.Errorf("stop %d: %w", id, data.ErrNotFound)
+	}
+
+	req, w := createTestRequest("GET", "/v1/stations/location/42", nil)
+	req = setupChiContext(req, map[string]string{"stationId": "42"})
+
+	app.getStationHandler(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+
+	var response problem
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, codeNotFound, response.Code)
+	assert.Equal(t, http.StatusNotFound, response.Status)
+}
+
+func TestGetStationHandlerInvalidID(t *testing.T) {
+	app := setupTestApp()
+
+	req, w := createTestRequest("GET", "/v1/stations/location/abc", nil)
+	req = setupChiContext(req, map[string]string{"stationId": "abc"})
+
+	app.getStationHandler(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response problem
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, codeValidation, response.Code)
+	assert.Len(t, response.Errors, 1)
+	assert.Equal(t, "stationId", response.Errors[0].Field)
+}
+
+func TestStationsListHandlerHidesInternalErrors(t *testing.T) {
+	app := setupTestApp()
+	mockStations := app.store.Stations.(*MockStationsStorage)
+
+	mockStations.ReadListFunc = func(ctx context.Context) ([]data.Stop, error) {
+		return nil, fmt.Errorf("pq: relation \"stops\" does not exist")
+	}
+
+	req, w := createTestRequest("GET", "/v1/stations/list", nil)
+
+	app.stationsListHandler(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NotContains(t, w.Body.String(), "pq:")
+
+	var response problem
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, codeInternal, response.Code)
+}
+
+func TestUsersRegisterUserConflict(t *testing.T) {
+	app := setupTestApp()
+	mockUsers := app.store.User.(*MockUsersStorage)
+
+	mockUsers.GetByEmailFunc = func(ctx context.Context, email string) (*data.User, error) {
+		return &data.User{ID: 1, Email: email}, nil
+	}
+
+	userData := map[string]interface{}{
+		"username": "johndoe",
+		"email":    "test@example.com",
+		"password": "password123",
+	}
+
+	req, w := createTestRequest("POST", "/v1/authentication/register", userData)
+
+	app.usersResgisterUser(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+// A registration racing another one passes the lookup and fails on the
+// unique constraint; it must still surface as a conflict.
+func TestUsersRegisterUserConstraintConflict(t *testing.T) {
+	app := setupTestApp()
+	mockUsers := app.store.User.(*MockUsersStorage)
+
+	mockUsers.GetByEmailFunc = func(ctx context.Context, email string) (*data.User, error) {
+		return nil, data.ErrNotFound
+	}
+	mockUsers.CreateFunc = func(ctx context.Context, user *data.User) error {
+		return fmt.Errorf("email_uq: %w", data.ErrConflict)
+	}
+
+	userData := map[string]interface{}{
+		"username": "johndoe",
+		"email":    "test@example.com",
+		"password": "password123",
+	}
+
+	req, w := createTestRequest("POST", "/v1/authentication/register", userData)
+
+	app.usersResgisterUser(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestUsersRegisterUserValidation(t *testing.T) {
+	app := setupTestApp()
+
+	userData := map[string]interface{}{
+		"username": "jd",
+		"email":    "not-an-email",
+		"password": "short",
+	}
+
+	req, w := createTestRequest("POST", "/v1/authentication/register", userData)
+
+	app.usersResgisterUser(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response problem
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, codeValidation, response.Code)
+	assert.Len(t, response.Errors, 3)
+}
+
+func TestGetStationsCloseByUnknownField(t *testing.T) {
+	app := setupTestApp()
+
+	reqBody := map[string]interface{}{
+		"latitude":  46.0569,
+		"longitude": 14.5058,
+		"radius":    1000,
+		"limit":     5,
+	}
+
+	req, w := createTestRequest("POST", "/v1/stations/closeBy", reqBody)
+
+	app.getStationsCloseBy(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response problem
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, codeMalformedBody, response.Code)
+}
+
+func TestMetricsEndpointRecordsRoutePattern(t *testing.T) {
+	app := setupTestApp()
+	mockStations := app.store.Stations.(*MockStationsStorage)
+	mockStations.ReadStationFunc = func(ctx context.Context, id int64) (*data.Stop, error) {
+		return &data.Stop{ID: int(id)}, nil
+	}
+
+	mux := app.mount()
+
+	req, w := createTestRequest("GET", "/v1/stations/location/7", nil)
+	mux.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req, w = createTestRequest("GET", "/metrics", nil)
+	mux.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code, "metrics are not on the API listener")
+
+	req, w = createTestRequest("GET", "/metrics", nil)
+	opsMux().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `mbusi_http_requests_total{method="GET",route="/v1/stations/location/{stationId}",status="200"}`)
+	assert.Contains(t, w.Body.String(), `mbusi_http_request_duration_seconds_count{method="GET",route="/v1/stations/location/{stationId}"}`)
+}
+
+func TestRequestLoggerCarriesRequestFields(t *testing.T) {
+	app := setupTestApp()
+	core, logs := observer.New(zapcore.DebugLevel)
+	app.logger = zap.New(core).Sugar()
+
+	mockStations := app.store.Stations.(*MockStationsStorage)
+	mockStations.ReadStationFunc = func(ctx context.Context, id int64) (*data.Stop, error) {
+		return nil, fmt.Errorf("connection reset")
+	}
+
+	req, w := createTestRequest("GET", "/v1/stations/location/7", nil)
+	req.Header.Set("X-Request-Id", "req-42")
+	app.mount().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	internal := logs.FilterMessage("internal error").All()
+	if assert.Len(t, internal, 1) {
+		fields := internal[0].ContextMap()
+		assert.Equal(t, "req-42", fields["request_id"])
+		assert.Equal(t, "/v1/stations/location/{stationId}", fields["route"])
+		assert.NotEmpty(t, fields["trace_id"])
+	}
+
+	completed := logs.FilterMessage("request completed").All()
+	if assert.Len(t, completed, 1) {
+		assert.Equal(t, zapcore.ErrorLevel, completed[0].Level)
+		assert.EqualValues(t, http.StatusInternalServerError, completed[0].ContextMap()["status"])
+	}
+}
+
+func TestLoginRateLimit(t *testing.T) {
+	app := setupTestApp()
+	app.rateLimiter = ratelimit.NewMemoryStore()
+	mockUsers := app.store.User.(*MockUsersStorage)
+	mockUsers.GetByEmailFunc = func(ctx context.Context, email string) (*data.User, error) {
+		return nil, data.ErrNotFound
+	}
+
+	mux := app.mount()
+	login := map[string]interface{}{"email": "test@example.com", "password": "wrongpass1"}
+
+	for i := 0; i < 5; i++ {
+		req, w := createTestRequest("POST", "/v1/authentication/login", login)
+		mux.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, "5", w.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, fmt.Sprint(4-i), w.Header().Get("RateLimit-Remaining"))
+	}
+
+	req, w := createTestRequest("POST", "/v1/authentication/login", login)
+	mux.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "12", w.Header().Get("Retry-After"))
+	assert.Equal(t, "5;w=60", w.Header().Get("RateLimit-Policy"))
+	assert.Contains(t, w.Body.String(), `"code":"rate_limited"`)
+
+	// another client address has its own bucket
+	req, w = createTestRequest("POST", "/v1/authentication/login", login)
+	req.RemoteAddr = "192.0.2.99:1234"
+	mux.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestLoginRateLimitPerAccount(t *testing.T) {
+	app := setupTestApp()
+	app.rateLimiter = ratelimit.NewMemoryStore()
+	app.store.User.(*MockUsersStorage).GetByEmailFunc = func(ctx context.Context, email string) (*data.User, error) {
+		return nil, data.ErrNotFound
+	}
+
+	mux := app.mount()
+	login := func(email, addr string) int {
+		req, w := createTestRequest("POST", "/v1/authentication/login", map[string]interface{}{"email": email, "password": "wrongpass1"})
+		req.RemoteAddr = addr
+		mux.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// One address hammering the account is stopped without locking the
+	// owner out.
+	for i := 0; i < 20; i++ {
+		login("victim@example.com", "198.51.100.1:1234")
+	}
+	assert.Equal(t, http.StatusTooManyRequests, login("victim@example.com", "198.51.100.1:1234"))
+	assert.Equal(t, http.StatusUnauthorized, login("victim@example.com", "192.0.2.250:1234"), "the owner still gets to try")
+
+	// Guesses from many addresses fill the account's total.
+	for i := 0; i < policyLoginAccountTotal.limit.Burst-6; i++ {
+		require.Equal(t, http.StatusUnauthorized, login("Victim@example.com", fmt.Sprintf("10.0.%d.%d:1234", i/250, i%250+1)), "guess %d", i+1)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, login("victim@example.com ", "192.0.2.200:1234"), "the same account, however spelt")
+	assert.Equal(t, http.StatusUnauthorized, login("other@example.com", "192.0.2.201:1234"), "other accounts are unaffected")
+}
+
+func TestRateLimitIgnoresUntrustedForwardedFor(t *testing.T) {
+	app := setupTestApp()
+	app.rateLimiter = ratelimit.NewMemoryStore()
+	app.store.User.(*MockUsersStorage).GetByEmailFunc = func(ctx context.Context, email string) (*data.User, error) {
+		return nil, data.ErrNotFound
+	}
+
+	mux := app.mount()
+
+	for i := 0; i < 5; i++ {
+		login := map[string]interface{}{"email": fmt.Sprintf("user%d@example.com", i), "password": "wrongpass1"}
+		req, w := createTestRequest("POST", "/v1/authentication/login", login)
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("198.51.100.%d", i))
+		mux.ServeHTTP(w, req)
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	login := map[string]interface{}{"email": "user9@example.com", "password": "wrongpass1"}
+	req, w := createTestRequest("POST", "/v1/authentication/login", login)
+	req.Header.Set("X-Forwarded-For", "198.51.100.9")
+	mux.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "a rotated header buys no new bucket")
+}
+
+func TestRealIPTrustsConfiguredProxies(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	var seen string
+	h := realIP(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.RemoteAddr
+	}))
+
+	tests := []struct {
+		name, remote, forwardedFor, realIP, want string
+	}{
+		{"proxy forwards the client", "10.0.0.5:443", "203.0.113.7", "", "203.0.113.7"},
+		{"spoofed entries left of the client are skipped", "10.0.0.5:443", "1.2.3.4, 203.0.113.7, 10.0.0.9", "", "203.0.113.7"},
+		{"x-real-ip without x-forwarded-for", "10.0.0.5:443", "", "203.0.113.8", "203.0.113.8"},
+		{"untrusted peers cannot forward", "192.0.2.1:443", "203.0.113.7", "203.0.113.8", "192.0.2.1:443"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remote
+			if tt.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(t, tt.want, seen)
+		})
+	}
+}
+
+func TestDelayReportRateLimitIsPerUser(t *testing.T) {
+	app := setupTestApp()
+	app.rateLimiter = ratelimit.NewMemoryStore()
+	app.store.User.(*MockUsersStorage).GetByEmailFunc = func(ctx context.Context, email string) (*data.User, error) {
+		return &data.User{ID: 1, Email: email}, nil
+	}
+	app.store.Delays.(*MockDelaysStorage).InsertDelayFunc = func(ctx context.Context, delay data.DelayReportInputUnMarshaled) (int, error) {
+		return 1, nil
+	}
+	app.store.Delays.(*MockDelaysStorage).InsertAuditFunc = func(ctx context.Context, a *data.DelayAudit) error {
+		return nil
+	}
+
+	mux := app.mount()
+	report := func(userID int) int {
+		token, err := CreateJWT([]byte(testJWTSecret), userID, time.Hour)
+		require.NoError(t, err)
+
+		req, w := createTestRequest("POST", "/v1/delays/report", map[string]interface{}{
+			"date":       "2024-01-15T08:00:00Z",
+			"delay_min":  5,
+			"stop_id":    1,
+			"line_id":    1,
+			"user_email": "test@example.com",
+		})
+		req.Header.Set("Authorization", "Bearer "+token)
+		mux.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Both users share the test request's address.
+	for i := 0; i < 3; i++ {
+		require.Equal(t, http.StatusCreated, report(1))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, report(1))
+	assert.Equal(t, http.StatusCreated, report(2), "another user behind the same address has their own bucket")
+}
+
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Take(context.Context, string, ratelimit.Limit, time.Time) (ratelimit.Result, error) {
+	return ratelimit.Result{}, fmt.Errorf("connection refused")
+}
+
+func TestRateLimitFailsOpen(t *testing.T) {
+	app := setupTestApp()
+	app.rateLimiter = failingRateLimitStore{}
+	mockStations := app.store.Stations.(*MockStationsStorage)
+	mockStations.ReadListFunc = func(ctx context.Context) ([]data.Stop, error) {
+		return []data.Stop{}, nil
+	}
+
+	req, w := createTestRequest("GET", "/v1/stations/list", nil)
+	app.mount().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+}
+
 // Mock implementations for storage interfaces
 type MockStationsStorage struct {
 	ReadStationFunc                    func(context.Context, int64) (*data.Stop, error)
@@ -628,6 +1135,9 @@ type MockStationsStorage struct {
 	ReadThreeStationsAtDestinationFunc func(context.Context, *data.PathLocation) ([]data.Stop, error)
 	ReadStationLinesFunc               func(context.Context, []data.Stop) ([]data.Line, error)
 	ReadThreeStationsAtLocationFunc    func(context.Context, *data.PathLocation, []data.Line) ([]data.Stop, error)
+	ReadUpcomingDeparturesFunc         func(context.Context, data.DepartureQuery) ([]data.UpcomingDeparture, error)
+	ReadConnectionsFunc                func(context.Context, data.ConnectionQuery) ([]data.Connection, error)
+	ReadStopTimesFunc                  func(context.Context, time.Time) ([]data.StopTimes, error)
 }
 
 func (m *MockStationsStorage) ReadStation(ctx context.Context, id int64) (*data.Stop, error) {
@@ -654,20 +1164,35 @@ func (m *MockStationsStorage) ReadStationLines(ctx context.Context, stops []data
 	return m.ReadStationLinesFunc(ctx, stops)
 }
 
+func (m *MockStationsStorage) ReadUpcomingDepartures(ctx context.Context, q data.DepartureQuery) ([]data.UpcomingDeparture, error) {
+	return m.ReadUpcomingDeparturesFunc(ctx, q)
+}
+
+func (m *MockStationsStorage) ReadConnections(ctx context.Context, q data.ConnectionQuery) ([]data.Connection, error) {
+	return m.ReadConnectionsFunc(ctx, q)
+}
+
+func (m *MockStationsStorage) ReadStopTimes(ctx context.Context, date time.Time) ([]data.StopTimes, error) {
+	return m.ReadStopTimesFunc(ctx, date)
+}
+
 func (m *MockStationsStorage) ReadThreeStationsAtLocation(ctx context.Context, pathLoc *data.PathLocation, lines []data.Line) ([]data.Stop, error) {
 	return m.ReadThreeStationsAtLocationFunc(ctx, pathLoc, lines)
 }
 
 type MockRoutesStorage struct {
-	ReadRouteFunc         func(context.Context, int64) (*data.Route, error)
-	ReadRouteStationsFunc func(context.Context, int64) ([]data.Stop, error)
-	ReadRoutesListFunc    func(context.Context) ([]data.Route, error)
-	ReadActiveLinesFunc   func(context.Context) (int, error)
-	FetchActiveRunsFunc   func(context.Context, int) ([]data.ActiveRun, error)
+	ReadRouteFunc          func(context.Context, int64, data.RouteQuery) (*data.Route, error)
+	ReadRouteStationsFunc  func(context.Context, int64) ([]data.Stop, error)
+	ReadRoutesListFunc     func(context.Context) ([]data.Route, error)
+	ReadMapRoutesFunc      func(context.Context) ([]data.MapRoute, error)
+	ReadActiveLinesFunc    func(context.Context) (int, error)
+	FetchActiveRunsFunc    func(context.Context, int) ([]data.ActiveRun, error)
+	ReadDirectionsFunc     func(context.Context, int64) ([]data.Direction, error)
+	ReadDirectionStopsFunc func(context.Context, data.DirectionStopsQuery) ([]data.DirectionStop, error)
 }
 
-func (m *MockRoutesStorage) ReadRoute(ctx context.Context, id int64) (*data.Route, error) {
-	return m.ReadRouteFunc(ctx, id)
+func (m *MockRoutesStorage) ReadRoute(ctx context.Context, id int64, q data.RouteQuery) (*data.Route, error) {
+	return m.ReadRouteFunc(ctx, id, q)
 }
 
 func (m *MockRoutesStorage) ReadRouteStations(ctx context.Context, id int64) ([]data.Stop, error) {
@@ -678,6 +1203,10 @@ func (m *MockRoutesStorage) ReadRoutesList(ctx context.Context) ([]data.Route, e
 	return m.ReadRoutesListFunc(ctx)
 }
 
+func (m *MockRoutesStorage) ReadMapRoutes(ctx context.Context) ([]data.MapRoute, error) {
+	return m.ReadMapRoutesFunc(ctx)
+}
+
 func (m *MockRoutesStorage) ReadActiveLines(ctx context.Context) (int, error) {
 	return m.ReadActiveLinesFunc(ctx)
 }
@@ -686,11 +1215,20 @@ func (m *MockRoutesStorage) FetchActiveRuns(ctx context.Context, count int) ([]d
 	return m.FetchActiveRunsFunc(ctx, count)
 }
 
+func (m *MockRoutesStorage) ReadDirections(ctx context.Context, lineID int64) ([]data.Direction, error) {
+	return m.ReadDirectionsFunc(ctx, lineID)
+}
+
+func (m *MockRoutesStorage) ReadDirectionStops(ctx context.Context, q data.DirectionStopsQuery) ([]data.DirectionStop, error) {
+	return m.ReadDirectionStopsFunc(ctx, q)
+}
+
 type MockUsersStorage struct {
 	CreateFunc           func(context.Context, *data.User) error
 	GetByEmailFunc       func(context.Context, string) (*data.User, error)
 	GetByIdFunc          func(context.Context, int) (*data.User, error)
 	UpdateByIdFunc       func(context.Context, int, *data.UpdateUserPayload) error
+	LockFunc             func(context.Context, int) error
 	GetByIDForClientFunc func(context.Context, int) (*data.UserForClient, error)
 }
 
@@ -710,10 +1248,47 @@ func (m *MockUsersStorage) UpdateById(ctx context.Context, id int, payload *data
 	return m.UpdateByIdFunc(ctx, id, payload)
 }
 
+func (m *MockUsersStorage) Lock(ctx context.Context, id int) error {
+	return m.LockFunc(ctx, id)
+}
+
 func (m *MockUsersStorage) GetByIDForClient(ctx context.Context, id int) (*data.UserForClient, error) {
 	return m.GetByIDForClientFunc(ctx, id)
 }
 
+type MockAPIKeysStorage struct {
+	CreateFunc      func(context.Context, *data.APIKey, string) error
+	GetByHashFunc   func(context.Context, string) (*data.APIKey, error)
+	ListFunc        func(context.Context) ([]data.APIKey, error)
+	RevokeFunc      func(context.Context, int64) error
+	RecordUsageFunc func(context.Context, int64, time.Time) (int64, error)
+	GetUsageFunc    func(context.Context, int64, int) ([]data.APIKeyUsage, error)
+}
+
+func (m *MockAPIKeysStorage) Create(ctx context.Context, key *data.APIKey, hash string) error {
+	return m.CreateFunc(ctx, key, hash)
+}
+
+func (m *MockAPIKeysStorage) GetByHash(ctx context.Context, hash string) (*data.APIKey, error) {
+	return m.GetByHashFunc(ctx, hash)
+}
+
+func (m *MockAPIKeysStorage) List(ctx context.Context) ([]data.APIKey, error) {
+	return m.ListFunc(ctx)
+}
+
+func (m *MockAPIKeysStorage) Revoke(ctx context.Context, id int64) error {
+	return m.RevokeFunc(ctx, id)
+}
+
+func (m *MockAPIKeysStorage) RecordUsage(ctx context.Context, id int64, now time.Time) (int64, error) {
+	return m.RecordUsageFunc(ctx, id, now)
+}
+
+func (m *MockAPIKeysStorage) GetUsage(ctx context.Context, id int64, days int) ([]data.APIKeyUsage, error) {
+	return m.GetUsageFunc(ctx, id, days)
+}
+
 type MockDelaysStorage struct {
 	GetDelaysByStopFunc        func(context.Context, int64) ([]data.Delay, error)
 	GetRecentDelaysByLineFunc  func(context.Context, int64) ([]data.DelayEntry, error)
@@ -722,7 +1297,11 @@ type MockDelaysStorage struct {
 	GetDelayCountsByLineFunc   func(context.Context) ([]data.LineDelayCount, error)
 	GetAverageDelayForLineFunc func(context.Context, int64) (*data.LineAverageDelay, error)
 	GetOverallAverageDelayFunc func(context.Context) (float64, error)
-	InsertDelayFunc            func(context.Context, data.DelayReportInputUnMarshaled) error
+	InsertDelayFunc            func(context.Context, data.DelayReportInputUnMarshaled) (int, error)
+	InsertAuditFunc            func(context.Context, *data.DelayAudit) error
+	ListAuditFunc              func(context.Context, int) ([]data.DelayAudit, error)
+	GetRecentDelaysFunc        func(context.Context, data.DelayFilter) ([]data.DelayReport, error)
+	GetDelayHeatFunc           func(context.Context, time.Time) ([]data.StopDelayHeat, error)
 }
 
 func (m *MockDelaysStorage) GetDelaysByStop(ctx context.Context, stationID int64) ([]data.Delay, error) {
@@ -753,10 +1332,26 @@ func (m *MockDelaysStorage) GetOverallAverageDelay(ctx context.Context) (float64
 	return m.GetOverallAverageDelayFunc(ctx)
 }
 
-func (m *MockDelaysStorage) InsertDelay(ctx context.Context, delay data.DelayReportInputUnMarshaled) error {
+func (m *MockDelaysStorage) InsertDelay(ctx context.Context, delay data.DelayReportInputUnMarshaled) (int, error) {
 	return m.InsertDelayFunc(ctx, delay)
 }
 
+func (m *MockDelaysStorage) InsertAudit(ctx context.Context, a *data.DelayAudit) error {
+	return m.InsertAuditFunc(ctx, a)
+}
+
+func (m *MockDelaysStorage) ListAudit(ctx context.Context, delayID int) ([]data.DelayAudit, error) {
+	return m.ListAuditFunc(ctx, delayID)
+}
+
+func (m *MockDelaysStorage) GetRecentDelays(ctx context.Context, f data.DelayFilter) ([]data.DelayReport, error) {
+	return m.GetRecentDelaysFunc(ctx, f)
+}
+
+func (m *MockDelaysStorage) GetDelayHeat(ctx context.Context, since time.Time) ([]data.StopDelayHeat, error) {
+	return m.GetDelayHeatFunc(ctx, since)
+}
+
 type MockOccupancyStorage struct {
 	GetOccupancyForLineByDateFunc        func(context.Context, int, string) ([]data.OccupancyRecord, error)
 	GetOccupancyForLineByDateAndHourFunc func(context.Context, int, string, int) ([]data.OccupancyRecord, error)
@@ -779,3 +1374,234 @@ func (m *MockOccupancyStorage) GetAvgOccupancyAllLinesByHour(ctx context.Context
 func (m *MockOccupancyStorage) GetAvgDailyOccupancyAllLines(ctx context.Context, date string) (*data.AvgDailyOccupancy, error) {
 	return m.GetAvgDailyOccupancyAllLinesFunc(ctx, date)
 }
+
+type MockFavouritesStorage struct {
+	ListFunc    func(context.Context, int) ([]data.Favourite, error)
+	CreateFunc  func(context.Context, *data.Favourite) error
+	DeleteFunc  func(context.Context, int, int64) error
+	ReorderFunc func(context.Context, int, []int64) error
+}
+
+func (m *MockFavouritesStorage) List(ctx context.Context, userID int) ([]data.Favourite, error) {
+	return m.ListFunc(ctx, userID)
+}
+
+func (m *MockFavouritesStorage) Create(ctx context.Context, f *data.Favourite) error {
+	return m.CreateFunc(ctx, f)
+}
+
+func (m *MockFavouritesStorage) Delete(ctx context.Context, userID int, id int64) error {
+	return m.DeleteFunc(ctx, userID, id)
+}
+
+func (m *MockFavouritesStorage) Reorder(ctx context.Context, userID int, ids []int64) error {
+	return m.ReorderFunc(ctx, userID, ids)
+}
+
+type MockTripsStorage struct {
+	ListFunc   func(context.Context, int) ([]data.SavedTrip, error)
+	GetFunc    func(context.Context, int, int64) (*data.SavedTrip, error)
+	CreateFunc func(context.Context, *data.SavedTrip) error
+	UpdateFunc func(context.Context, *data.SavedTrip) error
+	DeleteFunc func(context.Context, int, int64) error
+}
+
+func (m *MockTripsStorage) List(ctx context.Context, userID int) ([]data.SavedTrip, error) {
+	return m.ListFunc(ctx, userID)
+}
+
+func (m *MockTripsStorage) Get(ctx context.Context, userID int, id int64) (*data.SavedTrip, error) {
+	return m.GetFunc(ctx, userID, id)
+}
+
+func (m *MockTripsStorage) Create(ctx context.Context, t *data.SavedTrip) error {
+	return m.CreateFunc(ctx, t)
+}
+
+func (m *MockTripsStorage) Update(ctx context.Context, t *data.SavedTrip) error {
+	return m.UpdateFunc(ctx, t)
+}
+
+func (m *MockTripsStorage) Delete(ctx context.Context, userID int, id int64) error {
+	return m.DeleteFunc(ctx, userID, id)
+}
+
+type MockAlertsStorage struct {
+	ListSubscriptionsFunc  func(context.Context, int) ([]data.AlertSubscription, error)
+	CreateSubscriptionFunc func(context.Context, *data.AlertSubscription) error
+	DeleteSubscriptionFunc func(context.Context, int, int64) error
+	AllSubscriptionsFunc   func(context.Context) ([]data.AlertSubscription, error)
+	ReadIncidentsFunc      func(context.Context, int, int) ([]data.AlertIncident, error)
+	CursorFunc             func(context.Context) (int, error)
+	SetCursorFunc          func(context.Context, int) error
+	EnqueueDeliveryFunc    func(context.Context, *data.AlertDelivery) error
+	ClaimDeliveriesFunc    func(context.Context, time.Time, time.Duration, int) ([]data.AlertDelivery, error)
+	UpdateDeliveryFunc     func(context.Context, *data.AlertDelivery) error
+	ListDeliveriesFunc     func(context.Context, int, int64, int) ([]data.AlertDelivery, error)
+}
+
+func (m *MockAlertsStorage) ListSubscriptions(ctx context.Context, userID int) ([]data.AlertSubscription, error) {
+	return m.ListSubscriptionsFunc(ctx, userID)
+}
+
+func (m *MockAlertsStorage) CreateSubscription(ctx context.Context, sub *data.AlertSubscription) error {
+	return m.CreateSubscriptionFunc(ctx, sub)
+}
+
+func (m *MockAlertsStorage) DeleteSubscription(ctx context.Context, userID int, id int64) error {
+	return m.DeleteSubscriptionFunc(ctx, userID, id)
+}
+
+func (m *MockAlertsStorage) AllSubscriptions(ctx context.Context) ([]data.AlertSubscription, error) {
+	return m.AllSubscriptionsFunc(ctx)
+}
+
+func (m *MockAlertsStorage) ReadIncidents(ctx context.Context, afterDelayID, limit int) ([]data.AlertIncident, error) {
+	return m.ReadIncidentsFunc(ctx, afterDelayID, limit)
+}
+
+func (m *MockAlertsStorage) Cursor(ctx context.Context) (int, error) {
+	return m.CursorFunc(ctx)
+}
+
+func (m *MockAlertsStorage) SetCursor(ctx context.Context, delayID int) error {
+	return m.SetCursorFunc(ctx, delayID)
+}
+
+func (m *MockAlertsStorage) EnqueueDelivery(ctx context.Context, d *data.AlertDelivery) error {
+	return m.EnqueueDeliveryFunc(ctx, d)
+}
+
+func (m *MockAlertsStorage) ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]data.AlertDelivery, error) {
+	return m.ClaimDeliveriesFunc(ctx, now, lease, limit)
+}
+
+func (m *MockAlertsStorage) UpdateDelivery(ctx context.Context, d *data.AlertDelivery) error {
+	return m.UpdateDeliveryFunc(ctx, d)
+}
+
+func (m *MockAlertsStorage) ListDeliveries(ctx context.Context, userID int, subscriptionID int64, limit int) ([]data.AlertDelivery, error) {
+	return m.ListDeliveriesFunc(ctx, userID, subscriptionID, limit)
+}
+
+type MockPushStorage struct {
+	ListFunc                  func(context.Context, int) ([]data.PushSubscription, error)
+	SaveFunc                  func(context.Context, *data.PushSubscription) error
+	DeleteFunc                func(context.Context, int, int64) error
+	DeleteEndpointFunc        func(context.Context, string) error
+	DeleteExpiredFunc         func(context.Context, time.Time) (int, error)
+	TargetsFunc               func(context.Context, int, int) ([]data.PushSubscription, error)
+	AlertTargetsFunc          func(context.Context, int64) ([]data.PushSubscription, error)
+	ClaimFunc                 func(context.Context) (int, error)
+	SetCursorFunc             func(context.Context, int) error
+	ServiceAlertCursorFunc    func(context.Context) (int64, error)
+	SetServiceAlertCursorFunc func(context.Context, int64) error
+}
+
+func (m *MockPushStorage) List(ctx context.Context, userID int) ([]data.PushSubscription, error) {
+	return m.ListFunc(ctx, userID)
+}
+
+func (m *MockPushStorage) Save(ctx context.Context, p *data.PushSubscription) error {
+	return m.SaveFunc(ctx, p)
+}
+
+func (m *MockPushStorage) Delete(ctx context.Context, userID int, id int64) error {
+	return m.DeleteFunc(ctx, userID, id)
+}
+
+func (m *MockPushStorage) DeleteEndpoint(ctx context.Context, endpoint string) error {
+	return m.DeleteEndpointFunc(ctx, endpoint)
+}
+
+func (m *MockPushStorage) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	return m.DeleteExpiredFunc(ctx, now)
+}
+
+func (m *MockPushStorage) Targets(ctx context.Context, lineID, stopID int) ([]data.PushSubscription, error) {
+	return m.TargetsFunc(ctx, lineID, stopID)
+}
+
+func (m *MockPushStorage) AlertTargets(ctx context.Context, alertID int64) ([]data.PushSubscription, error) {
+	return m.AlertTargetsFunc(ctx, alertID)
+}
+
+func (m *MockPushStorage) Claim(ctx context.Context) (int, error) {
+	return m.ClaimFunc(ctx)
+}
+
+func (m *MockPushStorage) SetCursor(ctx context.Context, delayID int) error {
+	return m.SetCursorFunc(ctx, delayID)
+}
+
+func (m *MockPushStorage) ServiceAlertCursor(ctx context.Context) (int64, error) {
+	return m.ServiceAlertCursorFunc(ctx)
+}
+
+func (m *MockPushStorage) SetServiceAlertCursor(ctx context.Context, alertID int64) error {
+	return m.SetServiceAlertCursorFunc(ctx, alertID)
+}
+
+type MockServiceAlertsStorage struct {
+	ListFunc   func(context.Context, data.ServiceAlertFilter) ([]data.ServiceAlert, error)
+	GetFunc    func(context.Context, int64) (*data.ServiceAlert, error)
+	CreateFunc func(context.Context, *data.ServiceAlert) error
+	UpdateFunc func(context.Context, *data.ServiceAlert) error
+	DeleteFunc func(context.Context, int64) error
+}
+
+func (m *MockServiceAlertsStorage) List(ctx context.Context, f data.ServiceAlertFilter) ([]data.ServiceAlert, error) {
+	return m.ListFunc(ctx, f)
+}
+
+func (m *MockServiceAlertsStorage) Get(ctx context.Context, id int64) (*data.ServiceAlert, error) {
+	return m.GetFunc(ctx, id)
+}
+
+func (m *MockServiceAlertsStorage) Create(ctx context.Context, a *data.ServiceAlert) error {
+	return m.CreateFunc(ctx, a)
+}
+
+func (m *MockServiceAlertsStorage) Update(ctx context.Context, a *data.ServiceAlert) error {
+	return m.UpdateFunc(ctx, a)
+}
+
+func (m *MockServiceAlertsStorage) Delete(ctx context.Context, id int64) error {
+	return m.DeleteFunc(ctx, id)
+}
+
+type MockRouteShapesStorage struct {
+	ListFunc   func(context.Context, int) ([]data.RouteShape, error)
+	CreateFunc func(context.Context, *data.RouteShape) error
+	DeleteFunc func(context.Context, int64) error
+}
+
+func (m *MockRouteShapesStorage) List(ctx context.Context, lineID int) ([]data.RouteShape, error) {
+	return m.ListFunc(ctx, lineID)
+}
+
+func (m *MockRouteShapesStorage) Create(ctx context.Context, sh *data.RouteShape) error {
+	return m.CreateFunc(ctx, sh)
+}
+
+func (m *MockRouteShapesStorage) Delete(ctx context.Context, id int64) error {
+	return m.DeleteFunc(ctx, id)
+}
+
+type MockStationOverridesStorage struct {
+	ListFunc   func(context.Context) ([]data.StationOverride, error)
+	SetFunc    func(context.Context, *data.StationOverride) error
+	DeleteFunc func(context.Context, int64) error
+}
+
+func (m *MockStationOverridesStorage) List(ctx context.Context) ([]data.StationOverride, error) {
+	return m.ListFunc(ctx)
+}
+
+func (m *MockStationOverridesStorage) Set(ctx context.Context, o *data.StationOverride) error {
+	return m.SetFunc(ctx, o)
+}
+
+func (m *MockStationOverridesStorage) Delete(ctx context.Context, stopID int64) error {
+	return m.DeleteFunc(ctx, stopID)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"backend/cmd/utils"
+	"backend/internal/data"
+	"backend/internal/logging"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const apiKeyContextKey contextKey = "apiKey"
+
+// apiKeyPrefix marks our keys so that they are easy to spot in leaked
+// configuration and secret scanners.
+const apiKeyPrefix = "mbk_"
+
+// generateAPIKey returns a new secret, the prefix shown to admins and the
+// hash stored in the database.
+func generateAPIKey() (secret, prefix, hash string, err error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", "", err
+	}
+
+	secret = apiKeyPrefix + hex.EncodeToString(buf)
+	return secret, secret[:len(apiKeyPrefix)+8], hashAPIKey(secret), nil
+}
+
+// hashAPIKey hashes a key for storage and lookup. Keys carry 192 bits of
+// randomness, so a fast unsalted hash is sufficient, unlike for passwords.
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func apiKeyFromContext(ctx context.Context) *data.APIKey {
+	key, _ := ctx.Value(apiKeyContextKey).(*data.APIKey)
+	return key
+}
+
+// authenticateAPIKey resolves the key in the X-API-Key header, counts the
+// request against the key's daily quota and stores the key in the context.
+// Requests without a key pass through unchanged; a key that is unknown,
+// revoked or expired is rejected rather than silently ignored. Browsers
+// cannot set headers on WebSocket upgrades, so those may pass the key in the
+// api_key query parameter instead.
+func (app *app) authenticateAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret := r.Header.Get(apiKeyHeader)
+		if secret == "" && strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			secret = r.URL.Query().Get("api_key")
+		}
+		if secret == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		now := time.Now()
+
+		key, err := app.store.APIKeys.GetByHash(ctx, hashAPIKey(secret))
+		if errors.Is(err, data.ErrNotFound) || (err == nil && !key.Active(now)) {
+			app.invalidAPIKeyResponse(w, r)
+			return
+		} else if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		used, err := app.store.APIKeys.RecordUsage(ctx, key.ID, now)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if key.DailyQuota > 0 && used > int64(key.DailyQuota) {
+			midnight := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+			w.Header().Set("Retry-After", ceilSeconds(midnight.Sub(now)))
+			app.writeProblem(w, r, http.StatusTooManyRequests, codeQuotaExceeded, "the daily request quota of this API key is used up", nil)
+			return
+		}
+
+		ctx = context.WithValue(ctx, apiKeyContextKey, key)
+		ctx = logging.With(ctx, app.logger, "api_key_id", key.ID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requireScope rejects requests made with an API key lacking scope.
+// Requests without a key are left to the route's other checks, so public
+// endpoints stay usable from the web app.
+func (app *app) requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if key := apiKeyFromContext(r.Context()); key != nil && !key.HasScope(scope) {
+				app.writeProblem(w, r, http.StatusForbidden, codeInsufficientScope, "the API key lacks the "+scope+" scope", nil)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (app *app) invalidAPIKeyResponse(w http.ResponseWriter, r *http.Request) {
+	app.writeProblem(w, r, http.StatusUnauthorized, codeInvalidAPIKey, "the API key is invalid, revoked or expired", nil)
+}
+
+// createdAPIKey is returned once, when the key is issued. The secret cannot
+// be recovered afterwards.
+type createdAPIKey struct {
+	data.APIKey
+	Key string `json:"key"`
+}
+
+// @Summary		Issue an API key
+// @Description	Creates a named API key with the given scopes, daily request quota (0 for unlimited)
+// @Description	and optional expiry. The secret is only returned in this response; store it safely.
+// @Description	Clients send it in the X-API-Key header. Requires an admin account.
+// @Tags			admin
+// @Accept			json
+// @Produce		json
+// @Param			key	body		data.CreateAPIKeyPayload	true	"Key name, scopes, quota and expiry"
+// @Success		201	{object}	createdAPIKey				"The issued key including its secret"
+// @Router			/admin/api-keys [post]
+func (app *app) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var payload data.CreateAPIKeyPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	verr := &data.ValidationError{}
+	for _, scope := range payload.Scopes {
+		if !validScope(scope) {
+			verr.Add("scopes", "not_allowed", "must only contain: "+strings.Join(data.Scopes, ", "))
+			break
+		}
+	}
+	if payload.ExpiresAt != nil && !payload.ExpiresAt.After(time.Now()) {
+		verr.Add("expires_at", "out_of_range", "must be in the future")
+	}
+	if verr.HasErrors() {
+		app.errorResponse(w, r, verr)
+		return
+	}
+
+	secret, prefix, hash, err := generateAPIKey()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	userID := GetUserIDFromContext(r.Context())
+	key := data.APIKey{
+		Name:       payload.Name,
+		Prefix:     prefix,
+		Scopes:     payload.Scopes,
+		DailyQuota: payload.DailyQuota,
+		ExpiresAt:  payload.ExpiresAt,
+		CreatedBy:  &userID,
+	}
+
+	if err := app.store.APIKeys.Create(r.Context(), &key, hash); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	app.requestLogger(r).Infow("issued api key", "key_id", key.ID, "scopes", key.Scopes)
+
+	utils.WriteJSONResponse(w, http.StatusCreated, createdAPIKey{APIKey: key, Key: secret})
+}
+
+func validScope(scope string) bool {
+	for _, s := range data.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// @Summary		List API keys
+// @Description	Lists every issued API key with its scopes, quota, expiry and last use. Secrets are never returned.
+// @Tags			admin
+// @Produce		json
+// @Success		200	{array}	data.APIKey	"Issued keys"
+// @Router			/admin/api-keys [get]
+func (app *app) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := app.store.APIKeys.List(r.Context())
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, keys)
+}
+
+// @Summary		Revoke an API key
+// @Description	Revokes the key immediately. Requests using it are rejected with 401 afterwards.
+// @Tags			admin
+// @Param			keyId	path	int	true	"API key ID"
+// @Success		204
+// @Router			/admin/api-keys/{keyId} [delete]
+func (app *app) revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r, "keyId")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.APIKeys.Revoke(r.Context(), id); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	app.requestLogger(r).Infow("revoked api key", "key_id", id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary		Get API key usage
+// @Description	Returns the number of requests made with the key per UTC day over the last 30 days.
+// @Tags			admin
+// @Produce		json
+// @Param			keyId	path	int					true	"API key ID"
+// @Success		200		{array}	data.APIKeyUsage	"Requests per day, most recent first"
+// @Router			/admin/api-keys/{keyId}/usage [get]
+func (app *app) getAPIKeyUsageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r, "keyId")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	usage, err := app.store.APIKeys.GetUsage(r.Context(), id, 30)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, usage)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAPIKey = "mbk_0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func withTestAPIKey(app *app, key *data.APIKey, used int64) *[]int64 {
+	recorded := &[]int64{}
+	mockKeys := app.store.APIKeys.(*MockAPIKeysStorage)
+	mockKeys.GetByHashFunc = func(ctx context.Context, hash string) (*data.APIKey, error) {
+		if hash != hashAPIKey(testAPIKey) {
+			return nil, data.ErrNotFound
+		}
+		return key, nil
+	}
+	mockKeys.RecordUsageFunc = func(ctx context.Context, id int64, now time.Time) (int64, error) {
+		*recorded = append(*recorded, id)
+		return used, nil
+	}
+	app.store.Stations.(*MockStationsStorage).ReadListFunc = func(ctx context.Context) ([]data.Stop, error) {
+		return []data.Stop{}, nil
+	}
+	return recorded
+}
+
+func TestAPIKeyWithScopeIsAcceptedAndCounted(t *testing.T) {
+	app := setupTestApp()
+	recorded := withTestAPIKey(app, &data.APIKey{ID: 9, Scopes: []string{data.ScopeReadTimetable}}, 1)
+
+	req, w := createTestRequest("GET", "/v1/stations/list", nil)
+	req.Header.Set(apiKeyHeader, testAPIKey)
+	app.mount().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []int64{9}, *recorded)
+}
+
+func TestAPIKeyWithoutScopeIsForbidden(t *testing.T) {
+	app := setupTestApp()
+	withTestAPIKey(app, &data.APIKey{ID: 9, Scopes: []string{data.ScopeReadRealtime}}, 1)
+
+	req, w := createTestRequest("GET", "/v1/stations/list", nil)
+	req.Header.Set(apiKeyHeader, testAPIKey)
+	app.mount().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"insufficient_scope"`)
+}
+
+func TestInvalidAPIKeysAreRejected(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name   string
+		secret string
+		key    *data.APIKey
+	}{
+		{"unknown", "mbk_unknown", &data.APIKey{ID: 1}},
+		{"revoked", testAPIKey, &data.APIKey{ID: 1, Scopes: data.Scopes, RevokedAt: &past}},
+		{"expired", testAPIKey, &data.APIKey{ID: 1, Scopes: data.Scopes, ExpiresAt: &past}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := setupTestApp()
+			recorded := withTestAPIKey(app, tt.key, 1)
+
+			req, w := createTestRequest("GET", "/v1/stations/list", nil)
+			req.Header.Set(apiKeyHeader, tt.secret)
+			app.mount().ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+			assert.Contains(t, w.Body.String(), `"code":"invalid_api_key"`)
+			assert.Empty(t, *recorded)
+		})
+	}
+}
+
+func TestAPIKeyQuotaExceeded(t *testing.T) {
+	app := setupTestApp()
+	withTestAPIKey(app, &data.APIKey{ID: 9, Scopes: data.Scopes, DailyQuota: 100}, 101)
+
+	req, w := createTestRequest("GET", "/v1/stations/list", nil)
+	req.Header.Set(apiKeyHeader, testAPIKey)
+	app.mount().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"quota_exceeded"`)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+}
+
+func adminRequest(t *testing.T, app *app, role, method, path string, body interface{}) (*http.Request, *httptest.ResponseRecorder) {
+	t.Helper()
+
+	token, err := CreateJWT([]byte(testJWTSecret), 1, time.Hour)
+	require.NoError(t, err)
+
+	app.store.User.(*MockUsersStorage).GetByIdFunc = func(ctx context.Context, id int) (*data.User, error) {
+		return &data.User{ID: id, Role: role}, nil
+	}
+
+	req, w := createTestRequest(method, path, body)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req, w
+}
+
+func TestCreateAPIKeyRequiresAdmin(t *testing.T) {
+	app := setupTestApp()
+
+	req, w := adminRequest(t, app, data.RoleUser, "POST", "/v1/admin/api-keys", map[string]interface{}{
+		"name":   "kiosk",
+		"scopes": []string{data.ScopeReadRealtime},
+	})
+	app.mount().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	app := setupTestApp()
+
+	var storedHash string
+	app.store.APIKeys.(*MockAPIKeysStorage).CreateFunc = func(ctx context.Context, key *data.APIKey, hash string) error {
+		storedHash = hash
+		key.ID = 5
+		return nil
+	}
+
+	req, w := adminRequest(t, app, data.RoleAdmin, "POST", "/v1/admin/api-keys", map[string]interface{}{
+		"name":        "Glavni trg display",
+		"scopes":      []string{data.ScopeReadRealtime, data.ScopeReadTimetable},
+		"daily_quota": 10000,
+	})
+	app.mount().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var response struct {
+		Data createdAPIKey `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	assert.True(t, strings.HasPrefix(response.Data.Key, apiKeyPrefix))
+	assert.True(t, strings.HasPrefix(response.Data.Key, response.Data.Prefix))
+	assert.Equal(t, hashAPIKey(response.Data.Key), storedHash)
+	assert.NotContains(t, storedHash, response.Data.Key)
+	assert.Equal(t, int64(5), response.Data.ID)
+}
+
+func TestCreateAPIKeyRejectsUnknownScope(t *testing.T) {
+	app := setupTestApp()
+
+	req, w := adminRequest(t, app, data.RoleAdmin, "POST", "/v1/admin/api-keys", map[string]interface{}{
+		"name":   "partner",
+		"scopes": []string{"write:everything"},
+	})
+	app.mount().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"scopes"`)
+}
@@ -1,11 +1,10 @@
 package main
 
 import (
-	"backend/cmd/utils"
-	"backend/internal/env"
+	"backend/internal/data"
+	"backend/internal/logging"
 	"context"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -19,6 +18,8 @@ type contextKey string
 
 const UserKey contextKey = "userID"
 
+const userRoleKey contextKey = "userRole"
+
 func HashPassword(password string) (string, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 
@@ -35,9 +36,7 @@ func ComparePasswords(hashedPassword string, password []byte) bool {
 	return err == nil
 }
 
-func CreateJWT(secret []byte, userID int) (string, error) {
-	expiration := time.Second * time.Duration(env.GetInt("JWT_EXP", 3600*24*7))
-
+func CreateJWT(secret []byte, userID int, expiration time.Duration) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"userID":    strconv.Itoa(userID),
 		"expiredAt": time.Now().Add(expiration).Unix(),
@@ -55,39 +54,25 @@ func CreateJWT(secret []byte, userID int) (string, error) {
 
 func (app *app) WithJWTAuth(handlerFuncion http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// get the token from the user request
-		tokenString := getTokenFromRequest(r)
-
-		// validate the jwt
-		token, err := validateToken(tokenString)
+		userID, err := app.tokenUserID(r)
 		if err != nil {
-			log.Printf("failed to validate token: %v", err)
-			utils.WriteJSONError(w, http.StatusForbidden, "permision denied")
-			return
-		}
-		// if yes, fetch the user id from the db
-
-		if !token.Valid {
-			log.Println("invalid token")
-			utils.WriteJSONError(w, http.StatusForbidden, "permision denied")
+			app.requestLogger(r).Infow("rejected token", "error", err)
+			app.permissionDeniedResponse(w, r)
 			return
 		}
 
-		claims := token.Claims.(jwt.MapClaims)
-		str := claims["userID"].(string)
-
-		userID, _ := strconv.Atoi(str)
-
 		ctx := r.Context()
 
 		temp, err := app.store.User.GetById(ctx, userID)
 		if err != nil {
-			log.Printf("failed to get user by id: %v", err)
-			utils.WriteJSONError(w, http.StatusForbidden, "permision denied")
+			app.requestLogger(r).Warnw("failed to load token user", "user_id", userID, "error", err)
+			app.permissionDeniedResponse(w, r)
 			return
 		}
 
 		ctx = context.WithValue(ctx, UserKey, temp.ID)
+		ctx = context.WithValue(ctx, userRoleKey, temp.Role)
+		ctx = logging.With(ctx, app.logger, "user_id", temp.ID)
 		r = r.WithContext(ctx)
 
 		handlerFuncion(w, r)
@@ -95,6 +80,40 @@ func (app *app) WithJWTAuth(handlerFuncion http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// requireAdmin rejects users without the admin role. It reads the role
+// stored by WithJWTAuth, so it must be wrapped by it:
+// app.WithJWTAuth(app.requireAdmin(handler)).
+func (app *app) requireAdmin(handlerFunc http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if role, _ := r.Context().Value(userRoleKey).(string); role != data.RoleAdmin {
+			app.permissionDeniedResponse(w, r)
+			return
+		}
+		handlerFunc(w, r)
+	}
+}
+
+// tokenUserID returns the user the request's bearer token was issued to.
+// It does not check that the user still exists; WithJWTAuth does.
+func (app *app) tokenUserID(r *http.Request) (int, error) {
+	token, err := validateToken([]byte(app.config.Auth.JWTSecret.Value()), getTokenFromRequest(r))
+	if err != nil {
+		return 0, err
+	}
+	if !token.Valid {
+		return 0, fmt.Errorf("invalid token")
+	}
+
+	claims, _ := token.Claims.(jwt.MapClaims)
+	str, _ := claims["userID"].(string)
+	userID, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("token without a user: %w", err)
+	}
+
+	return userID, nil
+}
+
 func getTokenFromRequest(r *http.Request) string {
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
@@ -109,13 +128,13 @@ func getTokenFromRequest(r *http.Request) string {
 	return parts[1]
 }
 
-func validateToken(tokenString string) (*jwt.Token, error) {
+func validateToken(secret []byte, tokenString string) (*jwt.Token, error) {
 	return jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexptected signing method: %v", t.Header["alg"])
 		}
 
-		return []byte(env.GetString("JWT_SECRET", "notSoSecret-anymore")), nil
+		return secret, nil
 	})
 }
 
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
@@ -38,7 +39,7 @@ func TestCreateJWT(t *testing.T) {
 	userID := 123
 	secret := []byte("test-secret")
 
-	token, err := CreateJWT(secret, userID)
+	token, err := CreateJWT(secret, userID, time.Hour)
 
 	assert.NoError(t, err)
 	assert.NotEmpty(t, token)
@@ -78,20 +79,19 @@ func TestGetTokenFromRequest(t *testing.T) {
 }
 
 func TestValidateToken(t *testing.T) {
-	// Use the same secret that validateToken uses
-	secret := []byte("notSoSecret-anymore") // This matches the default in validateToken
+	secret := []byte("test-secret")
 	userID := 123
 
 	// Create a valid token
-	token, _ := CreateJWT(secret, userID)
+	token, _ := CreateJWT(secret, userID, time.Hour)
 
 	// Test valid token
-	validatedToken, err := validateToken(token)
+	validatedToken, err := validateToken(secret, token)
 	assert.NoError(t, err)
 	assert.True(t, validatedToken.Valid)
 
 	// Test invalid token
-	validatedToken, err = validateToken("invalid-token")
+	validatedToken, err = validateToken(secret, "invalid-token")
 	assert.Error(t, err)
 	// When there's an error, validatedToken is nil, so we can't check .Valid
 	assert.Nil(t, validatedToken)
@@ -121,10 +121,10 @@ func TestWithJWTAuth(t *testing.T) {
 	app := setupTestApp()
 
 	// Test with valid token
-	secret := []byte("notSoSecret-anymore") // Use the same secret as validateToken
+	secret := []byte(testJWTSecret)
 	userID := 123
 
-	token, _ := CreateJWT(secret, userID)
+	token, _ := CreateJWT(secret, userID, time.Hour)
 
 	req := httptest.NewRequest("GET", "/test", nil)
 	req.Header.Set("Authorization", "Bearer "+token)
@@ -188,10 +188,10 @@ func TestWithJWTAuthNoToken(t *testing.T) {
 func TestWithJWTAuthUserNotFound(t *testing.T) {
 	app := setupTestApp()
 
-	secret := []byte("notSoSecret-anymore") // Use the same secret as validateToken
+	secret := []byte(testJWTSecret)
 	userID := 123
 
-	token, _ := CreateJWT(secret, userID)
+	token, _ := CreateJWT(secret, userID, time.Hour)
 
 	req := httptest.NewRequest("GET", "/test", nil)
 	req.Header.Set("Authorization", "Bearer "+token)
@@ -3,11 +3,8 @@ package main
 import (
 	"backend/cmd/utils"
 	"backend/internal/data"
-	"encoding/json"
+	"errors"
 	"net/http"
-	"strconv"
-
-	"github.com/go-chi/chi/v5"
 )
 
 // @Summary		Get all delays for a specific station
@@ -21,13 +18,11 @@ import (
 // @Param			stationId	path	int				true	"Unique identifier of the bus station"
 // @Success		200			{array}	data.APIDelay	"List of delays with detailed information"
 // @Router			/delays/station/{stationId} [get]
+// @Security		ApiKeyAuth
 func (app *app) getDelaysForStation(w http.ResponseWriter, r *http.Request) {
-	idParam := chi.URLParam(r, "stationId")
-
-	stationId, err := strconv.ParseInt(idParam, 10, 64)
-
+	stationId, err := readIDParam(r, "stationId")
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.errorResponse(w, r, err)
 		return
 	}
 
@@ -36,12 +31,12 @@ func (app *app) getDelaysForStation(w http.ResponseWriter, r *http.Request) {
 	stop, err := app.store.Delays.GetDelaysByStop(ctx, stationId)
 
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.errorResponse(w, r, err)
 		return
 	}
 
 	if err := utils.WriteJSONResponse(w, http.StatusOK, stop); err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.internalServerError(w, r, err)
 		return
 	}
 }
@@ -57,13 +52,11 @@ func (app *app) getDelaysForStation(w http.ResponseWriter, r *http.Request) {
 // @Param			lineId	path	int					true	"Unique identifier of the bus line"
 // @Success		200		{array}	data.APIDelayEntry	"Recent delays with comprehensive details"
 // @Router			/delays/recent/line/{lineId} [get]
+// @Security		ApiKeyAuth
 func (app *app) getRecentDelaysForLine(w http.ResponseWriter, r *http.Request) {
-	idParam := chi.URLParam(r, "lineId")
-
-	lineId, err := strconv.ParseInt(idParam, 10, 64)
-
+	lineId, err := readIDParam(r, "lineId")
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.errorResponse(w, r, err)
 		return
 	}
 
@@ -72,12 +65,12 @@ func (app *app) getRecentDelaysForLine(w http.ResponseWriter, r *http.Request) {
 	stop, err := app.store.Delays.GetRecentDelaysByLine(ctx, lineId)
 
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.errorResponse(w, r, err)
 		return
 	}
 
 	if err := utils.WriteJSONResponse(w, http.StatusOK, stop); err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.internalServerError(w, r, err)
 		return
 	}
 }
@@ -93,13 +86,11 @@ func (app *app) getRecentDelaysForLine(w http.ResponseWriter, r *http.Request) {
 // @Param			userId	path	int					true	"Unique identifier of the user"
 // @Success		200		{array}	data.APIUserDelay	"List of user-reported delays with details"
 // @Router			/delays/user/{userId} [get]
+// @Security		ApiKeyAuth
 func (app *app) getDelaysFromUser(w http.ResponseWriter, r *http.Request) {
-	idParam := chi.URLParam(r, "userId")
-
-	userId, err := strconv.ParseInt(idParam, 10, 64)
-
+	userId, err := readIDParam(r, "userId")
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.errorResponse(w, r, err)
 		return
 	}
 
@@ -108,12 +99,12 @@ func (app *app) getDelaysFromUser(w http.ResponseWriter, r *http.Request) {
 	stop, err := app.store.Delays.GetDelaysByUser(ctx, userId)
 
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.errorResponse(w, r, err)
 		return
 	}
 
 	if err := utils.WriteJSONResponse(w, http.StatusOK, stop); err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.internalServerError(w, r, err)
 		return
 	}
 }
@@ -128,18 +119,19 @@ func (app *app) getDelaysFromUser(w http.ResponseWriter, r *http.Request) {
 // @Produce		json
 // @Success		200	{array}	data.APIMostRecentDelay	"List of recent system-wide delays with full details"
 // @Router			/delays/recent [get]
+// @Security		ApiKeyAuth
 func (app *app) getRecentOverallDelays(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	stop, err := app.store.Delays.GetMostRecentDelays(ctx)
 
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.errorResponse(w, r, err)
 		return
 	}
 
 	if err := utils.WriteJSONResponse(w, http.StatusOK, stop); err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.internalServerError(w, r, err)
 		return
 	}
 }
@@ -154,18 +146,19 @@ func (app *app) getRecentOverallDelays(w http.ResponseWriter, r *http.Request) {
 // @Produce		json
 // @Success		200	{array}	data.APILineDelayCount	"Delay frequency statistics by line"
 // @Router			/delays/lines/number [get]
+// @Security		ApiKeyAuth
 func (app *app) getNumDelaysForLine(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	stop, err := app.store.Delays.GetDelayCountsByLine(ctx)
 
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.errorResponse(w, r, err)
 		return
 	}
 
 	if err := utils.WriteJSONResponse(w, http.StatusOK, stop); err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.internalServerError(w, r, err)
 		return
 	}
 }
@@ -181,13 +174,11 @@ func (app *app) getNumDelaysForLine(w http.ResponseWriter, r *http.Request) {
 // @Param			lineId	path		int							true	"Unique identifier of the bus line"
 // @Success		200		{object}	data.APILineAverageDelay	"Detailed delay statistics for the specified line"
 // @Router			/delays/average/{lineId} [get]
+// @Security		ApiKeyAuth
 func (app *app) getAvgDelayForLine(w http.ResponseWriter, r *http.Request) {
-	idParam := chi.URLParam(r, "lineId")
-
-	lineId, err := strconv.ParseInt(idParam, 10, 64)
-
+	lineId, err := readIDParam(r, "lineId")
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.errorResponse(w, r, err)
 		return
 	}
 	ctx := r.Context()
@@ -195,12 +186,12 @@ func (app *app) getAvgDelayForLine(w http.ResponseWriter, r *http.Request) {
 	stop, err := app.store.Delays.GetAverageDelayForLine(ctx, lineId)
 
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.errorResponse(w, r, err)
 		return
 	}
 
 	if err := utils.WriteJSONResponse(w, http.StatusOK, stop); err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.internalServerError(w, r, err)
 		return
 	}
 }
@@ -215,18 +206,19 @@ func (app *app) getAvgDelayForLine(w http.ResponseWriter, r *http.Request) {
 // @Produce		json
 // @Success		200	{object}	float64	"System-wide average delay in minutes"
 // @Router			/delays/average [get]
+// @Security		ApiKeyAuth
 func (app *app) getAvgDelay(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	stop, err := app.store.Delays.GetOverallAverageDelay(ctx)
 
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.errorResponse(w, r, err)
 		return
 	}
 
 	if err := utils.WriteJSONResponse(w, http.StatusOK, stop); err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.internalServerError(w, r, err)
 		return
 	}
 }
@@ -241,36 +233,73 @@ func (app *app) getAvgDelay(w http.ResponseWriter, r *http.Request) {
 // @Failure 400 {string} string "Invalid input"
 // @Failure 500 {string} string "Internal server error"
 // @Router /delays [post]
+// @Security		ApiKeyAuth
 func (app *app) submitDelayReport(w http.ResponseWriter, r *http.Request) {
 	var input data.DelayReportInput
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		utils.WriteJSONError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+	if err := readJSON(w, r, &input); err != nil {
+		app.errorResponse(w, r, err)
 		return
 	}
 
 	ctx := r.Context()
-	user, err := app.store.User.GetByEmail(ctx, input.UserEmail)
+
+	err := app.store.WithTx(ctx, func(tx data.Storage) error {
+		user, err := tx.User.GetByEmail(ctx, input.UserEmail)
+		if err != nil {
+			if errors.Is(err, data.ErrNotFound) {
+				err = data.NewValidationError("user_email", "unknown", "no user is registered with this email")
+			}
+			return err
+		}
+
+		id, err := tx.Delays.InsertDelay(ctx, data.DelayReportInputUnMarshaled{
+			Date:     input.Date,
+			DelayMin: input.DelayMin,
+			StopID:   input.StopID,
+			LineID:   input.LineID,
+			UserId:   user.ID,
+		})
+		if err != nil {
+			return err
+		}
+
+		audit := data.DelayAudit{DelayID: id, Action: data.DelayAuditSubmitted, UserID: &user.ID}
+		if key := apiKeyFromContext(ctx); key != nil {
+			audit.APIKeyID = &key.ID
+		}
+		return tx.Delays.InsertAudit(ctx, &audit)
+	})
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusBadRequest, "User lookup failed: "+err.Error())
+		app.errorResponse(w, r, err)
 		return
 	}
+	delayReportsTotal.Inc()
 
-	dbInput := data.DelayReportInputUnMarshaled{
-		Date:     input.Date,
-		DelayMin: input.DelayMin,
-		StopID:   input.StopID,
-		LineID:   input.LineID,
-		UserId:   user.ID,
+	if err := utils.WriteJSONResponse(w, http.StatusCreated, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
 	}
+}
 
-	// Step 4: Insert into DB
-	if err := app.store.Delays.InsertDelay(ctx, dbInput); err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, "Failed to save delay: "+err.Error())
+// @Summary		Get the audit trail of a delay report
+// @Description	Returns who filed the report and with which API key, oldest entry first.
+// @Tags			admin
+// @Produce		json
+// @Param			delayId	path	int					true	"Delay report ID"
+// @Success		200		{array}	data.DelayAudit	"Audit entries"
+// @Router			/admin/delays/{delayId}/audit [get]
+func (app *app) getDelayAuditHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r, "delayId")
+	if err != nil {
+		app.errorResponse(w, r, err)
 		return
 	}
 
-	if err := utils.WriteJSONResponse(w, http.StatusCreated, nil); err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+	audit, err := app.store.Delays.ListAudit(r.Context(), int(id))
+	if err != nil {
+		app.errorResponse(w, r, err)
 		return
 	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, audit)
 }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetDirectionStopsHandler(t *testing.T) {
+	app := setupTestApp()
+	mockRoutes := app.store.Routes.(*MockRoutesStorage)
+
+	var query data.DirectionStopsQuery
+	mockRoutes.ReadDirectionStopsFunc = func(ctx context.Context, q data.DirectionStopsQuery) ([]data.DirectionStop, error) {
+		query = q
+		// The path below runs from Station to Center.
+		return []data.DirectionStop{
+			{Sequence: 1, Stop: data.Stop{ID: 1, Latitude: 46.5577, Longitude: 15.6455}},
+			{Sequence: 2, Stop: data.Stop{ID: 2, Latitude: 46.5620, Longitude: 15.6567}, OffsetSeconds: 120},
+		}, nil
+	}
+	var routeQuery data.RouteQuery
+	mockRoutes.ReadRouteFunc = func(ctx context.Context, id int64, q data.RouteQuery) (*data.Route, error) {
+		routeQuery = q
+		return &data.Route{ID: 1, LineID: 1, Path: [][]float64{{46.5620, 15.6567}, {46.5577, 15.6455}}}, nil
+	}
+
+	req, w := createTestRequest("GET", "/v1/routes/1/directions/2/stops?at=2026-10-24T08:00:00Z", nil)
+	req = setupChiContext(req, map[string]string{"lineId": "1", "dirId": "2"})
+	app.getDirectionStopsHandler(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, int64(1), query.LineID)
+	assert.Equal(t, int64(2), query.DirectionID)
+	assert.Equal(t, 2, routeQuery.DirectionID)
+	assert.True(t, routeQuery.At.Equal(time.Date(2026, 10, 24, 8, 0, 0, 0, time.UTC)))
+
+	var response struct {
+		Data []data.DirectionStop `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Data, 2)
+	require.NotNil(t, response.Data[1].DistanceMeters)
+	assert.Zero(t, *response.Data[0].DistanceMeters)
+	assert.InDelta(t, 990, *response.Data[1].DistanceMeters, 10, "measured from the path's end")
+	assert.InDeltaSlice(t, []float64{46.5620, 15.6567}, response.Data[1].Projection, 1e-6)
+}
+
+func TestGetDirectionStopsWithoutPath(t *testing.T) {
+	app := setupTestApp()
+	mockRoutes := app.store.Routes.(*MockRoutesStorage)
+
+	mockRoutes.ReadDirectionStopsFunc = func(ctx context.Context, q data.DirectionStopsQuery) ([]data.DirectionStop, error) {
+		return []data.DirectionStop{{Sequence: 1, Stop: data.Stop{ID: 1}}}, nil
+	}
+	mockRoutes.ReadRouteFunc = func(ctx context.Context, id int64, q data.RouteQuery) (*data.Route, error) {
+		return nil, data.ErrNotFound
+	}
+
+	req, w := createTestRequest("GET", "/v1/routes/3/directions/4/stops", nil)
+	req = setupChiContext(req, map[string]string{"lineId": "3", "dirId": "4"})
+	app.getDirectionStopsHandler(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), "distance_meters")
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"backend/cmd/utils"
+	"backend/internal/data"
+	"backend/internal/tracing"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Machine-readable error codes returned in the "code" member of every
+// problem document. Clients may switch on these, so they must stay stable.
+const (
+	codeInternal           = "internal_error"
+	codeNotFound           = "not_found"
+	codeConflict           = "conflict"
+	codeValidation         = "validation_failed"
+	codeMalformedBody      = "malformed_body"
+	codeInvalidCredentials = "invalid_credentials"
+	codePermissionDenied   = "permission_denied"
+	codeRateLimited        = "rate_limited"
+	codeInvalidAPIKey      = "invalid_api_key"
+	codeInsufficientScope  = "insufficient_scope"
+	codeQuotaExceeded      = "quota_exceeded"
+)
+
+// errMalformedBody marks request bodies that could not be decoded at all, as
+// opposed to bodies that decoded but failed validation.
+var errMalformedBody = errors.New("malformed request body")
+
+// problem is an RFC 7807 error document extended with a stable error code,
+// per-field validation details and the request ID of the failed request.
+type problem struct {
+	Type      string            `json:"type"`
+	Title     string            `json:"title"`
+	Status    int               `json:"status"`
+	Detail    string            `json:"detail,omitempty"`
+	Instance  string            `json:"instance,omitempty"`
+	Code      string            `json:"code"`
+	RequestID string            `json:"request_id,omitempty"`
+	TraceID   string            `json:"trace_id,omitempty"`
+	Errors    []data.FieldError `json:"errors,omitempty"`
+}
+
+func (app *app) writeProblem(w http.ResponseWriter, r *http.Request, status int, code, detail string, fields []data.FieldError) {
+	p := problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestID: middleware.GetReqID(r.Context()),
+		TraceID:   tracing.TraceIDFromContext(r.Context()),
+		Errors:    fields,
+	}
+
+	if err := utils.WriteProblem(w, status, p); err != nil {
+		app.requestLogger(r).Errorw("failed to write error response", "error", err)
+	}
+}
+
+// errorResponse maps an error returned by the storage layer or a handler to
+// the matching status code. Unknown errors are logged and reported as a
+// generic 500 so that driver messages never reach the client.
+func (app *app) errorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var validationErr *data.ValidationError
+
+	switch {
+	case errors.Is(err, errMalformedBody):
+		app.writeProblem(w, r, http.StatusBadRequest, codeMalformedBody, err.Error(), nil)
+	case errors.As(err, &validationErr):
+		app.writeProblem(w, r, http.StatusBadRequest, codeValidation, "the request contains invalid fields", validationErr.Fields)
+	case errors.Is(err, data.ErrNotFound):
+		app.writeProblem(w, r, http.StatusNotFound, codeNotFound, "the requested resource could not be found", nil)
+	case errors.Is(err, data.ErrConflict):
+		app.writeProblem(w, r, http.StatusConflict, codeConflict, "the resource conflicts with an existing one", nil)
+	default:
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *app) internalServerError(w http.ResponseWriter, r *http.Request, err error) {
+	tracing.SpanFromContext(r.Context()).RecordError(err)
+
+	app.requestLogger(r).Errorw("internal error", "error", err)
+
+	app.writeProblem(w, r, http.StatusInternalServerError, codeInternal, "the server encountered a problem and could not process the request", nil)
+}
+
+func (app *app) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
+	app.writeProblem(w, r, http.StatusUnauthorized, codeInvalidCredentials, "invalid email and password combination", nil)
+}
+
+func (app *app) permissionDeniedResponse(w http.ResponseWriter, r *http.Request) {
+	app.writeProblem(w, r, http.StatusForbidden, codePermissionDenied, "permission denied", nil)
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"backend/cmd/utils"
+	"backend/internal/data"
+	"net/http"
+	"time"
+)
+
+const (
+	// maxFavourites caps the board so that building it stays cheap.
+	maxFavourites = 50
+	// boardDepartures is the number of upcoming departures per favourite.
+	boardDepartures = 5
+	// boardDelays is the number of delay reports per favourite.
+	boardDelays = 5
+	// boardDelayDays is how many calendar days of delay reports, today
+	// included, count as recent.
+	boardDelayDays = 3
+)
+
+// @Summary		List favourites
+// @Description	Returns the favourite stops, lines and stop+line pairs of the logged-in user in board order.
+// @Tags			favourites
+// @Produce		json
+// @Success		200	{array}	data.Favourite	"Favourites in board order"
+// @Router			/me/favourites [get]
+// @Security		ApiKeyAuth
+func (app *app) listFavouritesHandler(w http.ResponseWriter, r *http.Request) {
+	favourites, err := app.store.Favourites.List(r.Context(), GetUserIDFromContext(r.Context()))
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, favourites)
+}
+
+// @Summary		Add a favourite
+// @Description	Pins a stop (stop_id), a line (line_id) or a line at a stop (both) to the end of the user's board.
+// @Description	Adding the same favourite twice is a conflict. A user can have at most 50 favourites.
+// @Tags			favourites
+// @Accept			json
+// @Produce		json
+// @Param			favourite	body		data.CreateFavouritePayload	true	"Stop and/or line to pin"
+// @Success		201			{object}	data.Favourite				"The created favourite"
+// @Router			/me/favourites [post]
+// @Security		ApiKeyAuth
+func (app *app) createFavouriteHandler(w http.ResponseWriter, r *http.Request) {
+	var payload data.CreateFavouritePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	if payload.StopID == nil && payload.LineID == nil {
+		app.errorResponse(w, r, data.NewValidationError("stop_id", "required", "stop_id, line_id or both are required"))
+		return
+	}
+
+	ctx := r.Context()
+	favourite := data.Favourite{
+		UserID: GetUserIDFromContext(ctx),
+		StopID: payload.StopID,
+		LineID: payload.LineID,
+	}
+
+	err := app.store.WithTx(ctx, func(tx data.Storage) error {
+		// Concurrent requests would otherwise all pass the limit check.
+		if err := tx.User.Lock(ctx, favourite.UserID); err != nil {
+			return err
+		}
+		existing, err := tx.Favourites.List(ctx, favourite.UserID)
+		if err != nil {
+			return err
+		}
+		if len(existing) >= maxFavourites {
+			return data.NewValidationError("body", "too_many", "a board holds at most 50 favourites")
+		}
+
+		return tx.Favourites.Create(ctx, &favourite)
+	})
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusCreated, favourite)
+}
+
+// @Summary		Reorder favourites
+// @Description	Sets the board order. ids must list every favourite of the user exactly once.
+// @Tags			favourites
+// @Accept			json
+// @Produce		json
+// @Param			order	body	data.ReorderFavouritesPayload	true	"Favourite IDs in the new order"
+// @Success		200		{array}	data.Favourite					"Favourites in the new order"
+// @Router			/me/favourites/order [put]
+// @Security		ApiKeyAuth
+func (app *app) reorderFavouritesHandler(w http.ResponseWriter, r *http.Request) {
+	var payload data.ReorderFavouritesPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	userID := GetUserIDFromContext(ctx)
+
+	var favourites []data.Favourite
+	err := app.store.WithTx(ctx, func(tx data.Storage) error {
+		if err := tx.User.Lock(ctx, userID); err != nil {
+			return err
+		}
+		existing, err := tx.Favourites.List(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if !samePermutation(existing, payload.IDs) {
+			return data.NewValidationError("ids", "mismatch", "must list every favourite exactly once")
+		}
+
+		if err := tx.Favourites.Reorder(ctx, userID, payload.IDs); err != nil {
+			return err
+		}
+
+		favourites, err = tx.Favourites.List(ctx, userID)
+		return err
+	})
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, favourites)
+}
+
+// samePermutation reports whether ids holds the ID of every favourite
+// exactly once.
+func samePermutation(favourites []data.Favourite, ids []int64) bool {
+	if len(favourites) != len(ids) {
+		return false
+	}
+
+	pending := make(map[int64]bool, len(favourites))
+	for _, f := range favourites {
+		pending[f.ID] = true
+	}
+	for _, id := range ids {
+		if !pending[id] {
+			return false
+		}
+		delete(pending, id)
+	}
+
+	return true
+}
+
+// @Summary		Remove a favourite
+// @Tags			favourites
+// @Param			favouriteId	path	int	true	"Favourite ID"
+// @Success		204
+// @Router			/me/favourites/{favouriteId} [delete]
+// @Security		ApiKeyAuth
+func (app *app) deleteFavouriteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r, "favouriteId")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Favourites.Delete(r.Context(), GetUserIDFromContext(r.Context()), id); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// boardEntry is a favourite with what a rider wants to know about it right
+// now. Line favourites span many stops, so they only carry delay reports.
+type boardEntry struct {
+	data.Favourite
+	Departures   []data.UpcomingDeparture `json:"departures"`
+	RecentDelays []data.DelayReport       `json:"recent_delays"`
+}
+
+type board struct {
+	GeneratedAt time.Time    `json:"generated_at"`
+	Favourites  []boardEntry `json:"favourites"`
+}
+
+// @Summary		Get my board
+// @Description	Returns every favourite of the logged-in user in board order together with the next
+// @Description	departures from favourite stops (restricted to the line for stop+line favourites) and
+// @Description	the delay reports of the last three days matching each favourite.
+// @Tags			favourites
+// @Produce		json
+// @Success		200	{object}	board	"The user's board"
+// @Router			/me/board [get]
+// @Security		ApiKeyAuth
+func (app *app) getBoardHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	now := time.Now()
+
+	favourites, err := app.store.Favourites.List(ctx, GetUserIDFromContext(ctx))
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	since := now.AddDate(0, 0, -(boardDelayDays - 1))
+	res := board{GeneratedAt: now, Favourites: make([]boardEntry, 0, len(favourites))}
+
+	for _, f := range favourites {
+		entry := boardEntry{Favourite: f, Departures: []data.UpcomingDeparture{}}
+
+		var stopID, lineID int64
+		if f.StopID != nil {
+			stopID = int64(*f.StopID)
+		}
+		if f.LineID != nil {
+			lineID = int64(*f.LineID)
+		}
+
+		if stopID != 0 {
+			entry.Departures, err = app.store.Stations.ReadUpcomingDepartures(ctx, data.DepartureQuery{
+				StopID: stopID,
+				LineID: lineID,
+				From:   now,
+				Limit:  boardDepartures,
+			})
+			if err != nil {
+				app.errorResponse(w, r, err)
+				return
+			}
+		}
+
+		entry.RecentDelays, err = app.store.Delays.GetRecentDelays(ctx, data.DelayFilter{
+			StopID: stopID,
+			LineID: lineID,
+			Since:  since,
+			Limit:  boardDelays,
+		})
+		if err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+
+		res.Favourites = append(res.Favourites, entry)
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, res)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func intRef(v int) *int { return &v }
+
+func TestFavouritesRequireLogin(t *testing.T) {
+	app := setupTestApp()
+
+	req, w := createTestRequest("GET", "/v1/me/favourites", nil)
+	app.mount().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestCreateFavourite(t *testing.T) {
+	app := setupTestApp()
+	locked := false
+	app.store.User.(*MockUsersStorage).LockFunc = func(ctx context.Context, id int) error {
+		assert.Equal(t, 1, id)
+		locked = true
+		return nil
+	}
+	mock := app.store.Favourites.(*MockFavouritesStorage)
+	mock.ListFunc = func(ctx context.Context, userID int) ([]data.Favourite, error) {
+		assert.True(t, locked, "the user is locked before the limit is checked")
+		return []data.Favourite{}, nil
+	}
+
+	var created data.Favourite
+	mock.CreateFunc = func(ctx context.Context, f *data.Favourite) error {
+		created = *f
+		f.ID = 3
+		f.Kind = data.FavouriteKind(f.StopID, f.LineID)
+		return nil
+	}
+
+	req, w := adminRequest(t, app, data.RoleUser, "POST", "/v1/me/favourites", map[string]any{"stop_id": 7, "line_id": 2})
+	app.mount().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Equal(t, 1, created.UserID)
+	assert.Equal(t, intRef(7), created.StopID)
+	assert.Equal(t, intRef(2), created.LineID)
+	assert.Contains(t, w.Body.String(), `"kind":"stop_line"`)
+}
+
+func TestCreateFavouriteValidation(t *testing.T) {
+	full := make([]data.Favourite, maxFavourites)
+
+	tests := []struct {
+		name     string
+		body     map[string]any
+		existing []data.Favourite
+		code     string
+	}{
+		{"neither stop nor line", map[string]any{}, nil, `"code":"required"`},
+		{"board is full", map[string]any{"stop_id": 7}, full, `"code":"too_many"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := setupTestApp()
+			mock := app.store.Favourites.(*MockFavouritesStorage)
+			mock.ListFunc = func(ctx context.Context, userID int) ([]data.Favourite, error) {
+				return tt.existing, nil
+			}
+			mock.CreateFunc = func(ctx context.Context, f *data.Favourite) error {
+				t.Fatal("favourite must not be created")
+				return nil
+			}
+
+			req, w := adminRequest(t, app, data.RoleUser, "POST", "/v1/me/favourites", tt.body)
+			app.mount().ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), tt.code)
+		})
+	}
+}
+
+func TestCreateFavouriteConflict(t *testing.T) {
+	app := setupTestApp()
+	mock := app.store.Favourites.(*MockFavouritesStorage)
+	mock.ListFunc = func(ctx context.Context, userID int) ([]data.Favourite, error) {
+		return []data.Favourite{}, nil
+	}
+	mock.CreateFunc = func(ctx context.Context, f *data.Favourite) error {
+		return data.ErrConflict
+	}
+
+	req, w := adminRequest(t, app, data.RoleUser, "POST", "/v1/me/favourites", map[string]any{"line_id": 2})
+	app.mount().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestReorderFavourites(t *testing.T) {
+	tests := []struct {
+		name    string
+		ids     []int64
+		status  int
+		ordered bool
+	}{
+		{"every favourite once", []int64{2, 1}, http.StatusOK, true},
+		{"missing favourite", []int64{2}, http.StatusBadRequest, false},
+		{"duplicate favourite", []int64{2, 2}, http.StatusBadRequest, false},
+		{"foreign favourite", []int64{2, 9}, http.StatusBadRequest, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := setupTestApp()
+			mock := app.store.Favourites.(*MockFavouritesStorage)
+			mock.ListFunc = func(ctx context.Context, userID int) ([]data.Favourite, error) {
+				return []data.Favourite{{ID: 1}, {ID: 2}}, nil
+			}
+
+			var ordered []int64
+			mock.ReorderFunc = func(ctx context.Context, userID int, ids []int64) error {
+				ordered = ids
+				return nil
+			}
+
+			req, w := adminRequest(t, app, data.RoleUser, "PUT", "/v1/me/favourites/order", map[string]any{"ids": tt.ids})
+			app.mount().ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+			if tt.ordered {
+				assert.Equal(t, tt.ids, ordered)
+			} else {
+				assert.Nil(t, ordered)
+			}
+		})
+	}
+}
+
+func TestDeleteFavourite(t *testing.T) {
+	app := setupTestApp()
+
+	var deleted int64
+	app.store.Favourites.(*MockFavouritesStorage).DeleteFunc = func(ctx context.Context, userID int, id int64) error {
+		if userID != 1 {
+			return data.ErrNotFound
+		}
+		deleted = id
+		return nil
+	}
+
+	req, w := adminRequest(t, app, data.RoleUser, "DELETE", "/v1/me/favourites/4", nil)
+	app.mount().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, int64(4), deleted)
+}
+
+func TestGetBoard(t *testing.T) {
+	app := setupTestApp()
+	app.store.Favourites.(*MockFavouritesStorage).ListFunc = func(ctx context.Context, userID int) ([]data.Favourite, error) {
+		return []data.Favourite{
+			{ID: 1, Kind: data.FavouriteStop, StopID: intRef(7)},
+			{ID: 2, Kind: data.FavouriteLine, LineID: intRef(2)},
+			{ID: 3, Kind: data.FavouriteStopLine, StopID: intRef(7), LineID: intRef(2)},
+		}, nil
+	}
+
+	var departureQueries []data.DepartureQuery
+	app.store.Stations.(*MockStationsStorage).ReadUpcomingDeparturesFunc = func(ctx context.Context, q data.DepartureQuery) ([]data.UpcomingDeparture, error) {
+		departureQueries = append(departureQueries, q)
+		return []data.UpcomingDeparture{{StopID: int(q.StopID), LineID: 2, LineCode: "G2", Time: "12:30"}}, nil
+	}
+
+	var delayFilters []data.DelayFilter
+	app.store.Delays.(*MockDelaysStorage).GetRecentDelaysFunc = func(ctx context.Context, f data.DelayFilter) ([]data.DelayReport, error) {
+		delayFilters = append(delayFilters, f)
+		return []data.DelayReport{}, nil
+	}
+
+	req, w := adminRequest(t, app, data.RoleUser, "GET", "/v1/me/board", nil)
+	app.mount().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var res struct {
+		Data board `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	require.Len(t, res.Data.Favourites, 3)
+	assert.Len(t, res.Data.Favourites[0].Departures, 1)
+	assert.Empty(t, res.Data.Favourites[1].Departures, "line favourites have no departures")
+	assert.Len(t, res.Data.Favourites[2].Departures, 1)
+
+	require.Len(t, departureQueries, 2)
+	assert.Equal(t, int64(0), departureQueries[0].LineID)
+	assert.Equal(t, int64(2), departureQueries[1].LineID)
+	assert.Equal(t, boardDepartures, departureQueries[0].Limit)
+
+	require.Len(t, delayFilters, 3)
+	assert.Equal(t, data.DelayFilter{StopID: 7, Since: delayFilters[0].Since, Limit: boardDelays}, delayFilters[0])
+	assert.Equal(t, int64(2), delayFilters[1].LineID)
+	assert.Equal(t, int64(0), delayFilters[1].StopID)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"backend/internal/data"
+	"backend/internal/geo"
+	"encoding/json"
+	"math"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// wantsGeoJSON reports whether the client asked for GeoJSON, either with
+// Accept: application/geo+json or, where it cannot set headers such as in a
+// browser WebSocket, with ?format=geojson.
+func wantsGeoJSON(r *http.Request) bool {
+	if r.URL.Query().Get("format") == "geojson" {
+		return true
+	}
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted)); err == nil && mediaType == geo.GeoJSONContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateGeoJSON is wantsGeoJSON for responses served as either JSON or
+// GeoJSON from the same URL, which therefore vary by Accept.
+func negotiateGeoJSON(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Add("Vary", "Accept")
+	return wantsGeoJSON(r)
+}
+
+// writeGeoJSON writes a GeoJSON document. Unlike JSON responses it is not
+// wrapped in a data envelope, so map libraries can load it as is.
+func writeGeoJSON(w http.ResponseWriter, status int, doc any) error {
+	w.Header().Set("Content-Type", geo.GeoJSONContentType)
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(doc)
+}
+
+func stopFeature(s data.Stop) geo.Feature {
+	properties := map[string]any{
+		"id":     s.ID,
+		"number": s.Number,
+		"name":   s.Name,
+	}
+	if len(s.Alerts) > 0 {
+		properties["alerts"] = s.Alerts
+	}
+	return geo.NewFeature(s.ID, geo.Point(s.Latitude, s.Longitude), properties)
+}
+
+func stopFeatures(stops []data.Stop) *geo.FeatureCollection {
+	features := make([]geo.Feature, 0, len(stops))
+	for _, s := range stops {
+		features = append(features, stopFeature(s))
+	}
+	return geo.NewFeatureCollection(features)
+}
+
+// nearbyStopFeatures is stopFeatures with each stop's distance from the
+// searched point.
+func nearbyStopFeatures(stops []data.Stop, from *data.Location) *geo.FeatureCollection {
+	fc := stopFeatures(stops)
+	for i, s := range stops {
+		distance := geo.DistanceMeters(from.Latitude, from.Longitude, s.Latitude, s.Longitude)
+		fc.Features[i].Properties["distance_meters"] = math.Round(distance)
+	}
+	return fc
+}
+
+func routeFeature(r data.Route) geo.Feature {
+	properties := map[string]any{
+		"id":      r.ID,
+		"name":    r.Name,
+		"line_id": r.LineID,
+	}
+	if r.DirectionID != 0 {
+		properties["direction_id"] = r.DirectionID
+	}
+	if r.ShapeID != 0 {
+		properties["shape_id"] = r.ShapeID
+	}
+	if r.ValidUntil != nil {
+		properties["valid_until"] = r.ValidUntil
+	}
+	if len(r.Alerts) > 0 {
+		properties["alerts"] = r.Alerts
+	}
+	return geo.NewFeature(r.ID, geo.LineString(r.Path), properties)
+}
+
+func routeFeatures(routes []data.Route) *geo.FeatureCollection {
+	features := make([]geo.Feature, 0, len(routes))
+	for _, r := range routes {
+		features = append(features, routeFeature(r))
+	}
+	return geo.NewFeatureCollection(features)
+}
+
+// vehicleFeatures is a realtime snapshot as Point features, one per bus.
+func vehicleFeatures(positions []busPosition) *geo.FeatureCollection {
+	features := make([]geo.Feature, 0, len(positions))
+	for _, p := range positions {
+		features = append(features, geo.NewFeature(p.DepartureID, geo.Point(p.Lat, p.Lon), map[string]any{
+			"departure_id": p.DepartureID,
+			"direction_id": p.DirectionID,
+			"status":       p.Status,
+		}))
+	}
+	return geo.NewFeatureCollection(features)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"backend/internal/data"
+	"backend/internal/geo"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWantsGeoJSON(t *testing.T) {
+	tests := map[string]struct {
+		target, accept string
+		want           bool
+	}{
+		"json":            {"/v1/stations", "application/json", false},
+		"no accept":       {"/v1/stations", "", false},
+		"geojson":         {"/v1/stations", "application/geo+json", true},
+		"among others":    {"/v1/stations", "application/json;q=0.5, application/geo+json", true},
+		"with parameters": {"/v1/stations", "application/geo+json; charset=utf-8", true},
+		"format":          {"/v1/stations?format=geojson", "", true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, _ := createTestRequest("GET", tt.target, nil)
+			req.Header.Set("Accept", tt.accept)
+			assert.Equal(t, tt.want, wantsGeoJSON(req))
+		})
+	}
+}
+
+func TestStationsListAsGeoJSON(t *testing.T) {
+	app := setupTestApp()
+	app.store.Stations.(*MockStationsStorage).ReadListFunc = func(ctx context.Context) ([]data.Stop, error) {
+		return []data.Stop{
+			{ID: 1, Number: "003", Name: "Center", Latitude: 46.5577, Longitude: 15.6455},
+			{ID: 2, Number: "002", Name: "Station", Latitude: 46.5620, Longitude: 15.6567},
+		}, nil
+	}
+
+	req, w := createTestRequest("GET", "/v1/stations", nil)
+	req.Header.Set("Accept", geo.GeoJSONContentType)
+	app.stationsListHandler(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, geo.GeoJSONContentType, w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Values("Vary"), "Accept")
+
+	var fc struct {
+		Type     string    `json:"type"`
+		BBox     []float64 `json:"bbox"`
+		Features []struct {
+			Type     string `json:"type"`
+			ID       int    `json:"id"`
+			Geometry struct {
+				Type        string    `json:"type"`
+				Coordinates []float64 `json:"coordinates"`
+			} `json:"geometry"`
+			Properties map[string]any `json:"properties"`
+		} `json:"features"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &fc), "not wrapped in a data envelope")
+	assert.Equal(t, "FeatureCollection", fc.Type)
+	assert.Equal(t, []float64{15.6455, 46.5577, 15.6567, 46.5620}, fc.BBox)
+	require.Len(t, fc.Features, 2)
+	assert.Equal(t, "Point", fc.Features[0].Geometry.Type)
+	assert.Equal(t, []float64{15.6455, 46.5577}, fc.Features[0].Geometry.Coordinates)
+	assert.Equal(t, 1, fc.Features[0].ID)
+	assert.Equal(t, "Center", fc.Features[0].Properties["name"])
+	assert.Equal(t, "003", fc.Features[0].Properties["number"])
+}
+
+func TestStationsCloseByAsGeoJSON(t *testing.T) {
+	app := setupTestApp()
+	app.store.Stations.(*MockStationsStorage).ReadStationsCloseByFunc = func(ctx context.Context, loc *data.Location) ([]data.Stop, error) {
+		return []data.Stop{{ID: 2, Name: "Station", Latitude: 46.5620, Longitude: 15.6567}}, nil
+	}
+
+	req, w := createTestRequest("POST", "/v1/stations/nearby?format=geojson", data.Location{
+		Latitude: 46.5577, Longitude: 15.6455, Radius: 1500,
+	})
+	app.getStationsCloseBy(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var fc geo.FeatureCollection
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &fc))
+	require.Len(t, fc.Features, 1)
+	assert.InDelta(t, 990, fc.Features[0].Properties["distance_meters"], 10)
+}
+
+func TestRouteAsGeoJSON(t *testing.T) {
+	app := setupTestApp()
+	app.store.Routes.(*MockRoutesStorage).ReadRouteFunc = func(ctx context.Context, id int64, q data.RouteQuery) (*data.Route, error) {
+		return &data.Route{ID: 1, Name: "R1", LineID: 1, DirectionID: 2, ShapeID: 5,
+			Path: [][]float64{{46.5577, 15.6455}, {46.5620, 15.6567}}}, nil
+	}
+
+	req, w := createTestRequest("GET", "/v1/routes/1", nil)
+	req.Header.Set("Accept", geo.GeoJSONContentType)
+	req = setupChiContext(req, map[string]string{"lineId": "1"})
+	app.getRouteOfLineHandler(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var f struct {
+		Type     string    `json:"type"`
+		BBox     []float64 `json:"bbox"`
+		Geometry struct {
+			Type        string      `json:"type"`
+			Coordinates [][]float64 `json:"coordinates"`
+		} `json:"geometry"`
+		Properties map[string]any `json:"properties"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &f))
+	assert.Equal(t, "Feature", f.Type)
+	assert.Equal(t, "LineString", f.Geometry.Type)
+	assert.Equal(t, [][]float64{{15.6455, 46.5577}, {15.6567, 46.5620}}, f.Geometry.Coordinates)
+	assert.Equal(t, []float64{15.6455, 46.5577, 15.6567, 46.5620}, f.BBox)
+	assert.EqualValues(t, 2, f.Properties["direction_id"])
+	assert.EqualValues(t, 5, f.Properties["shape_id"])
+	assert.NotContains(t, f.Properties, "alerts")
+}
+
+func TestRoutesListStaysJSONByDefault(t *testing.T) {
+	app := setupTestApp()
+	app.store.Routes.(*MockRoutesStorage).ReadRoutesListFunc = func(ctx context.Context) ([]data.Route, error) {
+		return []data.Route{{ID: 1, LineID: 1, Path: [][]float64{{46.5577, 15.6455}, {46.5620, 15.6567}}}}, nil
+	}
+
+	req, w := createTestRequest("GET", "/v1/routes/list", nil)
+	app.routesListHandler(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Values("Vary"), "Accept")
+	assert.Contains(t, w.Body.String(), `"data":[{"id":1`)
+}
+
+func TestVehicleFeatures(t *testing.T) {
+	fc := vehicleFeatures([]busPosition{
+		{DepartureID: 7, DirectionID: 1, Lat: 46.5577, Lon: 15.6455, Status: "active"},
+	})
+
+	require.Len(t, fc.Features, 1)
+	assert.Equal(t, 7, fc.Features[0].ID)
+	assert.Equal(t, []float64{15.6455, 46.5577}, fc.Features[0].Geometry.Coordinates)
+	assert.Equal(t, "active", fc.Features[0].Properties["status"])
+	assert.Equal(t, 1, fc.Features[0].Properties["direction_id"])
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"backend/cmd/utils"
+	"context"
 	"net/http"
+	"time"
 )
 
 // @Summary		Check API health status
@@ -19,11 +21,69 @@ import (
 func (app *app) healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	data := map[string]string{
 		"status":  "ok",
-		"env":     app.serverConfig.env,
+		"env":     app.config.Env,
 		"version": version,
 	}
 
 	if err := utils.WriteJSONResponse(w, http.StatusOK, data); err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.internalServerError(w, r, err)
+	}
+}
+
+// readinessTimeout bounds all readiness checks of one /readyz request, so a
+// hanging dependency fails the probe instead of stalling it.
+const readinessTimeout = 2 * time.Second
+
+// readinessCheck is a dependency that must answer before the instance takes
+// traffic.
+type readinessCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+type readinessResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// livezHandler reports that the process is up and serving. It deliberately
+// checks no dependencies: restarting the API does not fix a database outage.
+// It needs no credentials so orchestrators can probe it.
+func (app *app) livezHandler(w http.ResponseWriter, r *http.Request) {
+	if err := utils.WriteJSONResponse(w, http.StatusOK, readinessResponse{Status: "ok"}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// readyzHandler reports whether the instance should receive traffic: every
+// readiness check passes and shutdown has not begun. Failure details are
+// logged rather than returned, as the endpoint needs no credentials.
+func (app *app) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if app.drain.isDraining() {
+		if err := utils.WriteJSONResponse(w, http.StatusServiceUnavailable, readinessResponse{Status: "shutting_down"}); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	res := readinessResponse{Status: "ok", Checks: make(map[string]string, len(app.readiness))}
+	status := http.StatusOK
+
+	for _, c := range app.readiness {
+		if err := c.check(ctx); err != nil {
+			app.requestLogger(r).Warnw("readiness check failed", "check", c.name, "error", err)
+			res.Checks[c.name] = "fail"
+			res.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+			continue
+		}
+		res.Checks[c.name] = "ok"
+	}
+
+	if err := utils.WriteJSONResponse(w, status, res); err != nil {
+		app.internalServerError(w, r, err)
 	}
 }
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"backend/cmd/utils"
+	"backend/internal/cluster"
+	"backend/internal/data"
+	"backend/internal/geo"
+	"backend/internal/isochrone"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	// isochroneWalkSpeed is a relaxed walking pace, 4.5 km/h, in metres per
+	// second.
+	isochroneWalkSpeed  = 1.25
+	isochroneWalkMeters = 800
+	// isochroneMaxBand is the longest band, in minutes.
+	isochroneMaxBand = 120
+)
+
+var isochroneDefaultBands = []int{10, 20, 30}
+
+// reachableStop is a stop in an isochrone, with the earliest arrival there
+// and how many minutes that is after setting off.
+type reachableStop struct {
+	data.Stop
+	Arrival time.Time `json:"arrival"`
+	Minutes int       `json:"minutes"`
+	// Walked is set when the stop is reached on foot from the origin.
+	Walked bool `json:"walked"`
+}
+
+type isochroneResponse struct {
+	Departure time.Time              `json:"departure"`
+	Stops     []reachableStop        `json:"stops"`
+	Bands     *geo.FeatureCollection `json:"bands"`
+}
+
+// bandFeatures outlines the area of each band, the widest first so maps
+// draw the narrower ones on top.
+func bandFeatures(q isochrone.Query, reached []isochrone.Reach, bands []int) *geo.FeatureCollection {
+	features := make([]geo.Feature, 0, len(bands))
+	for i := len(bands) - 1; i >= 0; i-- {
+		minutes := bands[i]
+		area := isochrone.Area(q, reached, minutes*60)
+		features = append(features, geo.NewFeature(minutes, geo.MultiPolygon(area), map[string]any{
+			"minutes": minutes,
+		}))
+	}
+	return geo.NewFeatureCollection(features)
+}
+
+// @Summary		Find where a rider can get within a time
+// @Description	Works out the stops reachable from a point within the longest of the time bands (10, 20 and 30
+// @Description	minutes by default), walking at most walk_meters to a stop, between stops and from the last
+// @Description	one, and riding the day's timetable. Changing between stops of a station is free. Each stop
+// @Description	comes with its earliest arrival. Bands outlines the area reachable within each band as a
+// @Description	GeoJSON MultiPolygon, widest first. Stops closed by a service alert are avoided. With Accept:
+// @Description	application/geo+json (or ?format=geojson) the response is one FeatureCollection of the bands
+// @Description	followed by the stops as Points.
+// @Tags			path
+// @Accept			json
+// @Produce		json,application/geo+json
+// @Param			isochrone	body		data.IsochronePayload	true	"Where and when to set off"
+// @Success		200			{object}	isochroneResponse		"Reachable stops and areas"
+// @Router			/show/isochrone [post]
+// @Security		ApiKeyAuth
+func (app *app) getIsochroneHandler(w http.ResponseWriter, r *http.Request) {
+	var payload data.IsochronePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	departure := time.Now()
+	if payload.Departure != nil {
+		departure = *payload.Departure
+	}
+	departure = departure.In(time.Local)
+
+	for i, b := range payload.Bands {
+		if b < 1 || b > isochroneMaxBand {
+			app.errorResponse(w, r, data.NewValidationError("bands."+strconv.Itoa(i), "out_of_range", fmt.Sprintf("must be between 1 and %d minutes", isochroneMaxBand)))
+			return
+		}
+	}
+
+	bands := payload.Bands
+	if len(bands) == 0 {
+		bands = isochroneDefaultBands
+	}
+	bands = slices.Compact(slices.Sorted(slices.Values(bands)))
+
+	walkMeters := payload.WalkMeters
+	if walkMeters == 0 {
+		walkMeters = isochroneWalkMeters
+	}
+
+	ctx := r.Context()
+
+	stops, err := app.store.Stations.ReadList(ctx)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	times, err := app.store.Stations.ReadStopTimes(ctx, departure)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	// Changing between the poles of a station is free.
+	overrides, err := app.store.StationOverrides.List(ctx)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	stations := cluster.StationOf(cluster.Stations(stops, overrides))
+
+	// Closed stops are left out, as in the journey planner.
+	alerts, err := app.activeServiceAlerts(ctx, data.ServiceAlertFilter{})
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	closed := data.ClosedStops(alerts)
+	stops = slices.DeleteFunc(stops, func(s data.Stop) bool { return slices.Contains(closed, s.ID) })
+
+	// The timetable is in wall-clock time, which is what Start and the
+	// arrivals count from midnight.
+	clock := func(sec int) time.Time {
+		return time.Date(departure.Year(), departure.Month(), departure.Day(), 0, 0, sec, 0, time.Local)
+	}
+	q := isochrone.Query{
+		Lat:       payload.Latitude,
+		Lon:       payload.Longitude,
+		Start:     departure.Hour()*3600 + departure.Minute()*60 + departure.Second(),
+		Budget:    bands[len(bands)-1] * 60,
+		WalkSpeed: isochroneWalkSpeed,
+		MaxWalk:   float64(walkMeters),
+		Stations:  stations,
+	}
+	reached := isochrone.Search(stops, times, q)
+
+	res := isochroneResponse{
+		Departure: departure,
+		Stops:     make([]reachableStop, 0, len(reached)),
+		Bands:     bandFeatures(q, reached, bands),
+	}
+	for _, reach := range reached {
+		res.Stops = append(res.Stops, reachableStop{
+			Stop:    reach.Stop,
+			Arrival: clock(reach.Arrival),
+			Minutes: int(math.Ceil(float64(reach.Arrival-q.Start) / 60)),
+			Walked:  reach.Walked,
+		})
+	}
+
+	if negotiateGeoJSON(w, r) {
+		features := res.Bands.Features
+		for _, s := range res.Stops {
+			f := stopFeature(s.Stop)
+			f.Properties["arrival"] = s.Arrival
+			f.Properties["minutes"] = s.Minutes
+			f.Properties["walked"] = s.Walked
+			features = append(features, f)
+		}
+		if err := writeGeoJSON(w, http.StatusOK, geo.NewFeatureCollection(features)); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := utils.WriteJSONResponse(w, http.StatusOK, res); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockIsochroneStore has a bus from Center at 8:00 reaching Station at 8:05
+// and Tezno at 8:20.
+func mockIsochroneStore(app *app) (date *time.Time) {
+	date = new(time.Time)
+	mock := app.store.Stations.(*MockStationsStorage)
+	mock.ReadListFunc = func(ctx context.Context) ([]data.Stop, error) {
+		return []data.Stop{
+			{ID: 1, Number: "003", Name: "Center", Latitude: 46.5577, Longitude: 15.6455},
+			{ID: 2, Number: "002", Name: "Station", Latitude: 46.5620, Longitude: 15.6567},
+			{ID: 4, Number: "004", Name: "Tezno", Latitude: 46.5330, Longitude: 15.6700},
+		}, nil
+	}
+	mock.ReadStopTimesFunc = func(ctx context.Context, d time.Time) ([]data.StopTimes, error) {
+		*date = d
+		return []data.StopTimes{
+			{StopID: 1, LineID: 1, DirectionID: 1, Seconds: []int{8 * 3600}},
+			{StopID: 2, LineID: 1, DirectionID: 1, Seconds: []int{8*3600 + 5*60}},
+			{StopID: 4, LineID: 1, DirectionID: 1, Seconds: []int{8*3600 + 20*60}},
+		}, nil
+	}
+	return date
+}
+
+func isochronePayload() map[string]any {
+	return map[string]any{
+		"latitude":  46.5580,
+		"longitude": 15.6455,
+		"departure": time.Date(2026, 10, 24, 7, 58, 0, 0, time.Local).Format(time.RFC3339),
+		"bands":     []int{15, 5},
+	}
+}
+
+func TestIsochrone(t *testing.T) {
+	app := setupTestApp()
+	date := mockIsochroneStore(app)
+
+	req, w := createTestRequest("POST", "/v1/show/isochrone", isochronePayload())
+	app.mount().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, 24, date.Day())
+
+	var res struct {
+		Data struct {
+			Stops []struct {
+				ID      int       `json:"id"`
+				Arrival time.Time `json:"arrival"`
+				Minutes int       `json:"minutes"`
+				Walked  bool      `json:"walked"`
+			} `json:"stops"`
+			Bands struct {
+				Features []struct {
+					ID       int `json:"id"`
+					Geometry struct {
+						Type string `json:"type"`
+					} `json:"geometry"`
+				} `json:"features"`
+			} `json:"bands"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+
+	require.Len(t, res.Data.Stops, 2, "Tezno is 22 minutes away")
+	assert.Equal(t, 1, res.Data.Stops[0].ID)
+	assert.True(t, res.Data.Stops[0].Walked)
+	assert.Equal(t, 2, res.Data.Stops[1].ID)
+	assert.False(t, res.Data.Stops[1].Walked)
+	assert.Equal(t, 7, res.Data.Stops[1].Minutes)
+	assert.True(t, res.Data.Stops[1].Arrival.Equal(time.Date(2026, 10, 24, 8, 5, 0, 0, time.Local)))
+
+	require.Len(t, res.Data.Bands.Features, 2)
+	assert.Equal(t, 15, res.Data.Bands.Features[0].ID, "the widest band comes first")
+	assert.Equal(t, 5, res.Data.Bands.Features[1].ID)
+	assert.Equal(t, "MultiPolygon", res.Data.Bands.Features[0].Geometry.Type)
+}
+
+func TestIsochroneAvoidsClosedStops(t *testing.T) {
+	app := setupTestApp()
+	mockIsochroneStore(app)
+	closed := 1
+	app.store.ServiceAlerts.(*MockServiceAlertsStorage).ListFunc = func(ctx context.Context, f data.ServiceAlertFilter) ([]data.ServiceAlert, error) {
+		return []data.ServiceAlert{{
+			ID: 1, Effect: data.EffectNoService,
+			Entities: []data.ServiceAlertEntity{{StopID: &closed}},
+		}}, nil
+	}
+
+	req, w := createTestRequest("POST", "/v1/show/isochrone", isochronePayload())
+	app.mount().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), "Center")
+	assert.NotContains(t, w.Body.String(), "Station", "without Center there is no bus to board")
+}
+
+func TestIsochroneAsGeoJSON(t *testing.T) {
+	app := setupTestApp()
+	mockIsochroneStore(app)
+
+	req, w := createTestRequest("POST", "/v1/show/isochrone", isochronePayload())
+	req.Header.Set("Accept", "application/geo+json")
+	app.mount().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/geo+json", w.Header().Get("Content-Type"))
+
+	var fc struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Geometry struct {
+				Type string `json:"type"`
+			} `json:"geometry"`
+			Properties map[string]any `json:"properties"`
+		} `json:"features"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &fc))
+
+	assert.Equal(t, "FeatureCollection", fc.Type)
+	require.Len(t, fc.Features, 4)
+	assert.Equal(t, "MultiPolygon", fc.Features[1].Geometry.Type)
+	assert.Equal(t, "Point", fc.Features[3].Geometry.Type)
+	assert.Equal(t, "Station", fc.Features[3].Properties["name"])
+	assert.Equal(t, float64(7), fc.Features[3].Properties["minutes"])
+}
+
+func TestIsochroneValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(map[string]any)
+		field  string
+	}{
+		{"latitude out of range", func(p map[string]any) { p["latitude"] = 91.0 }, "latitude"},
+		{"band too long", func(p map[string]any) { p["bands"] = []int{30, 180} }, "bands.1"},
+		{"too many bands", func(p map[string]any) { p["bands"] = []int{5, 10, 15, 20, 25, 30, 35} }, "bands"},
+		{"walk too far", func(p map[string]any) { p["walk_meters"] = 5000 }, "walk_meters"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := setupTestApp()
+			payload := isochronePayload()
+			tt.modify(payload)
+
+			req, w := createTestRequest("POST", "/v1/show/isochrone", payload)
+			app.mount().ServeHTTP(w, req)
+
+			require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+			assert.Contains(t, w.Body.String(), `"field":"`+tt.field+`"`)
+		})
+	}
+}
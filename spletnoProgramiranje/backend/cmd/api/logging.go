@@ -0,0 +1,69 @@
+package main
+
+import (
+	"backend/internal/logging"
+	"backend/internal/tracing"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// routeField renders the chi route pattern of a request when a log entry is
+// encoded rather than when the logger is built. The request logger is
+// created before routing, but by the time a handler or the storage layer
+// logs, chi has filled in the full pattern.
+type routeField struct{ rctx *chi.Context }
+
+func (f routeField) String() string {
+	if f.rctx == nil || f.rctx.RoutePattern() == "" {
+		return "unmatched"
+	}
+	return f.rctx.RoutePattern()
+}
+
+// logRequests puts a request-scoped logger into the context and writes one
+// access log line per request. It replaces chi's middleware.Logger, which
+// printed unstructured lines to stderr.
+func (app *app) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		logger := app.logger.Desugar().With(
+			zap.String("request_id", middleware.GetReqID(r.Context())),
+			zap.String("trace_id", tracing.TraceIDFromContext(r.Context())),
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.Stringer("route", routeField{chi.RouteContext(r.Context())}),
+		).Sugar()
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(logging.WithLogger(r.Context(), logger)))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		level := zapcore.InfoLevel
+		if status >= 500 {
+			level = zapcore.ErrorLevel
+		}
+
+		logger.Logw(level, "request completed",
+			"status", status,
+			"bytes", ww.BytesWritten(),
+			"duration", time.Since(start),
+			"remote_addr", r.RemoteAddr,
+		)
+	})
+}
+
+// requestLogger returns the logger of the request, falling back to the
+// application logger outside of logRequests.
+func (app *app) requestLogger(r *http.Request) *zap.SugaredLogger {
+	return logging.FromContext(r.Context(), app.logger)
+}
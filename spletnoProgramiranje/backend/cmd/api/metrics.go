@@ -0,0 +1,74 @@
+package main
+
+import (
+	"backend/internal/metrics"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+var (
+	httpRequestsTotal = metrics.NewCounterVec(
+		"mbusi_http_requests_total",
+		"Total number of HTTP requests by route, method and status code.",
+		"method", "route", "status",
+	)
+	httpRequestDuration = metrics.NewHistogramVec(
+		"mbusi_http_request_duration_seconds",
+		"HTTP request latency by route and method.",
+		metrics.DefaultBuckets,
+		"method", "route",
+	)
+	wsActiveConnections = metrics.NewGaugeVec(
+		"mbusi_ws_active_connections",
+		"Number of open realtime WebSocket connections per line.",
+		"line",
+	)
+	simulationTickDuration = metrics.NewHistogram(
+		"mbusi_simulation_tick_duration_seconds",
+		"Time spent computing and sending one realtime simulation tick.",
+		[]float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5},
+	)
+	delayReportsTotal = metrics.NewCounter(
+		"mbusi_delay_reports_submitted_total",
+		"Total number of delay reports stored.",
+	)
+	loginsTotal = metrics.NewCounterVec(
+		"mbusi_logins_total",
+		"Total number of login attempts by result.",
+		"result",
+	)
+	registrationsTotal = metrics.NewCounter(
+		"mbusi_registrations_total",
+		"Total number of user accounts created.",
+	)
+)
+
+// instrument records request counts and latency per route pattern. The
+// pattern is only known once chi has routed the request, so it is read
+// after the handler returns; unmatched requests share a single label to
+// keep the series count bounded.
+func instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		httpRequestsTotal.With(r.Method, route, strconv.Itoa(status)).Inc()
+		httpRequestDuration.With(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
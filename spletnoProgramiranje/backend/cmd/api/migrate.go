@@ -0,0 +1,94 @@
+package main
+
+import (
+	"backend/internal/db/migrations"
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// migrateOnStartup applies pending migrations, or, when auto-migration is
+// off, refuses to start against an outdated schema.
+func migrateOnStartup(ctx context.Context, db *sql.DB, autoMigrate bool, logger *zap.SugaredLogger) error {
+	migrator, err := migrations.New(db, logger.Named("migrations"))
+	if err != nil {
+		return err
+	}
+
+	if !autoMigrate {
+		return migrator.RequireCurrent(ctx)
+	}
+
+	n, err := migrator.Up(ctx)
+	if err != nil {
+		return err
+	}
+	logger.Infow("database schema is up to date", "applied", n)
+
+	return nil
+}
+
+// runMigrateCommand implements `api migrate <up|down|status>`:
+//
+//	migrate up          apply every pending migration
+//	migrate down [-n N] revert the last N migrations (default 1)
+//	migrate status      list migrations and when they were applied
+func runMigrateCommand(ctx context.Context, db *sql.DB, args []string, out io.Writer, logger *zap.SugaredLogger) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate <up|down|status>")
+	}
+
+	migrator, err := migrations.New(db, logger.Named("migrations"))
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		n, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "applied %d migration(s)\n", n)
+
+	case "down":
+		fs := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+		fs.SetOutput(out)
+		steps := fs.Int("n", 1, "number of migrations to revert")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *steps < 1 {
+			return fmt.Errorf("-n must be at least 1")
+		}
+
+		n, err := migrator.Down(ctx, *steps)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "reverted %d migration(s)\n", n)
+
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range status {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(out, "%04d  %-30s %s\n", s.Version, s.Name, applied)
+		}
+
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down or status", args[0])
+	}
+
+	return nil
+}
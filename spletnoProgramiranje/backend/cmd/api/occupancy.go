@@ -2,6 +2,7 @@ package main
 
 import (
 	"backend/cmd/utils"
+	"backend/internal/data"
 	"net/http"
 	"strconv"
 	"time"
@@ -25,30 +26,31 @@ const dateLayout = "2006-01-02"
 // @Param			date	path	string					true	"Target date in YYYY-MM-DD format"
 // @Success		200		{array}	data.OccupancyRecord	"Detailed hourly occupancy data for the specified day"
 // @Router			/occupancy/line/{lineId}/date/{date} [get]
+// @Security		ApiKeyAuth
 func (app *app) getLineOccupancyThroughDay(w http.ResponseWriter, r *http.Request) {
 	idParam := chi.URLParam(r, "lineId")
 	dateParam := chi.URLParam(r, "date") // format: YYYY-MM-DD
 
 	lineID, err := strconv.Atoi(idParam)
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusBadRequest, "invalid line ID")
+		app.errorResponse(w, r, data.NewValidationError("lineId", "invalid", "must be an integer"))
 		return
 	}
 
 	if _, err := time.Parse(dateLayout, dateParam); err != nil {
-		utils.WriteJSONError(w, http.StatusBadRequest, "invalid date format (expected YYYY-MM-DD)")
+		app.errorResponse(w, r, data.NewValidationError("date", "invalid_format", "expected YYYY-MM-DD"))
 		return
 	}
 
 	ctx := r.Context()
 	records, err := app.store.Occupancy.GetOccupancyForLineByDate(ctx, lineID, dateParam)
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.errorResponse(w, r, err)
 		return
 	}
 
 	if err := utils.WriteJSONResponse(w, http.StatusOK, records); err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.internalServerError(w, r, err)
 		return
 	}
 }
@@ -67,6 +69,7 @@ func (app *app) getLineOccupancyThroughDay(w http.ResponseWriter, r *http.Reques
 // @Param			hour	path	int						true	"Hour of the day (0-23)"
 // @Success		200		{array}	data.OccupancyRecord	"Detailed occupancy data for the specified hour"
 // @Router			/occupancy/line/{lineId}/date/{date}/hour/{hour} [get]
+// @Security		ApiKeyAuth
 func (app *app) getLineOccupancyForHour(w http.ResponseWriter, r *http.Request) {
 	idParam := chi.URLParam(r, "lineId")
 	dateParam := chi.URLParam(r, "date")
@@ -74,30 +77,30 @@ func (app *app) getLineOccupancyForHour(w http.ResponseWriter, r *http.Request)
 
 	lineID, err := strconv.Atoi(idParam)
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusBadRequest, "invalid line ID")
+		app.errorResponse(w, r, data.NewValidationError("lineId", "invalid", "must be an integer"))
 		return
 	}
 
 	if _, err := time.Parse(dateLayout, dateParam); err != nil {
-		utils.WriteJSONError(w, http.StatusBadRequest, "invalid date format (expected YYYY-MM-DD)")
+		app.errorResponse(w, r, data.NewValidationError("date", "invalid_format", "expected YYYY-MM-DD"))
 		return
 	}
 
 	hour, err := strconv.Atoi(hourParam)
 	if err != nil || hour < 0 || hour > 23 {
-		utils.WriteJSONError(w, http.StatusBadRequest, "invalid hour (expected 0–23)")
+		app.errorResponse(w, r, data.NewValidationError("hour", "out_of_range", "expected 0–23"))
 		return
 	}
 
 	ctx := r.Context()
 	records, err := app.store.Occupancy.GetOccupancyForLineByDateAndHour(ctx, lineID, dateParam, hour)
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.errorResponse(w, r, err)
 		return
 	}
 
 	if err := utils.WriteJSONResponse(w, http.StatusOK, records); err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.internalServerError(w, r, err)
 		return
 	}
 }
@@ -115,24 +118,25 @@ func (app *app) getLineOccupancyForHour(w http.ResponseWriter, r *http.Request)
 // @Param			hour	path		int						true	"Hour of the day (0-23)"
 // @Success		200		{object}	data.AvgOccupancyByHour	"System-wide average occupancy statistics with detailed breakdowns"
 // @Router			/occupancy/average/{hour} [get]
+// @Security		ApiKeyAuth
 func (app *app) getAvgLineOccupancyForHour(w http.ResponseWriter, r *http.Request) {
 	hourParam := chi.URLParam(r, "hour")
 
 	hour, err := strconv.Atoi(hourParam)
 	if err != nil || hour < 0 || hour > 23 {
-		utils.WriteJSONError(w, http.StatusBadRequest, "invalid hour")
+		app.errorResponse(w, r, data.NewValidationError("hour", "out_of_range", "expected 0–23"))
 		return
 	}
 
 	ctx := r.Context()
 	avg, err := app.store.Occupancy.GetAvgOccupancyAllLinesByHour(ctx, hour)
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.errorResponse(w, r, err)
 		return
 	}
 
 	if err := utils.WriteJSONResponse(w, http.StatusOK, avg); err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.internalServerError(w, r, err)
 		return
 	}
 }
@@ -150,23 +154,24 @@ func (app *app) getAvgLineOccupancyForHour(w http.ResponseWriter, r *http.Reques
 // @Param			date	path		string					true	"Target date in YYYY-MM-DD format"
 // @Success		200		{object}	data.AvgDailyOccupancy	"Comprehensive daily occupancy statistics with detailed analysis"
 // @Router			/occupancy/average/{date} [get]
+// @Security		ApiKeyAuth
 func (app *app) getAvgLineOccupancyForDate(w http.ResponseWriter, r *http.Request) {
 	dateParam := chi.URLParam(r, "date")
 
 	if _, err := time.Parse(dateLayout, dateParam); err != nil {
-		utils.WriteJSONError(w, http.StatusBadRequest, "invalid date format (expected YYYY-MM-DD)")
+		app.errorResponse(w, r, data.NewValidationError("date", "invalid_format", "expected YYYY-MM-DD"))
 		return
 	}
 
 	ctx := r.Context()
 	avg, err := app.store.Occupancy.GetAvgDailyOccupancyAllLines(ctx, dateParam)
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.errorResponse(w, r, err)
 		return
 	}
 
 	if err := utils.WriteJSONResponse(w, http.StatusOK, avg); err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.internalServerError(w, r, err)
 		return
 	}
 }
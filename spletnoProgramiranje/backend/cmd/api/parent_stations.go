@@ -0,0 +1,275 @@
+package main
+
+import (
+	"backend/cmd/utils"
+	"backend/internal/cluster"
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const (
+	// stationDepartures is the number of upcoming departures of a station,
+	// across its stops.
+	stationDepartures = 10
+	// stationDelays is the number of delay reports of a station.
+	stationDelays = 10
+	// stationDelayDays is how many calendar days of delay reports, today
+	// included, a station shows.
+	stationDelayDays = 3
+)
+
+// readParentStations clusters every stop into stations, applying the
+// admins' overrides.
+func (app *app) readParentStations(ctx context.Context) ([]data.ParentStation, error) {
+	stops, err := app.store.Stations.ReadList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	overrides, err := app.store.StationOverrides.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return cluster.Stations(stops, overrides), nil
+}
+
+// parentStationBoard is a station with what is going on at all of its
+// stops.
+type parentStationBoard struct {
+	data.ParentStation
+	// Lines are the lines calling at any of the stops, once per direction.
+	Lines []data.Line `json:"lines"`
+	// Departures are the next departures from any of the stops; each names
+	// the stop it leaves from.
+	Departures   []data.UpcomingDeparture `json:"departures"`
+	RecentDelays []data.DelayReport       `json:"recent_delays"`
+	Alerts       []data.ServiceAlert      `json:"alerts"`
+}
+
+// @Summary		List stations
+// @Description	Returns every station with its stops, by name. A station is the stops riders know by one name,
+// @Description	a pole per direction or platform: stops of the same name (ignoring case and diacritics) within
+// @Description	300 m of each other, unless an admin has moved a stop to another station. Its id is the lowest
+// @Description	id of its stops and its position the centre of them.
+// @Tags			stations
+// @Produce		json
+// @Success		200	{array}	data.ParentStation	"Stations"
+// @Router			/parent-stations [get]
+// @Security		ApiKeyAuth
+func (app *app) listParentStationsHandler(w http.ResponseWriter, r *http.Request) {
+	stations, err := app.readParentStations(r.Context())
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	if err := utils.WriteJSONResponse(w, http.StatusOK, stations); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// @Summary		Get a station
+// @Description	Returns the station with its stops and, across all of them, the lines calling there, the next 10
+// @Description	departures from at (now by default), each naming the stop it leaves from, the latest delay
+// @Description	reports of the last three days and the service alerts in effect.
+// @Tags			stations
+// @Produce		json
+// @Param			stationId	path		int					true	"Station ID"
+// @Param			at			query		string				false	"RFC 3339 time to list departures from; now by default"
+// @Success		200			{object}	parentStationBoard	"The station"
+// @Router			/parent-stations/{stationId} [get]
+// @Security		ApiKeyAuth
+func (app *app) getParentStationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r, "stationId")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	at, err := readAtQuery(r)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	if at.IsZero() {
+		at = time.Now()
+	}
+	at = at.In(time.Local)
+
+	ctx := r.Context()
+
+	stations, err := app.readParentStations(ctx)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	station, ok := cluster.Find(stations, int(id))
+	if !ok {
+		app.errorResponse(w, r, fmt.Errorf("station %d: %w", id, data.ErrNotFound))
+		return
+	}
+
+	res := parentStationBoard{
+		ParentStation: station,
+		Lines:         []data.Line{},
+		Departures:    []data.UpcomingDeparture{},
+		RecentDelays:  []data.DelayReport{},
+		Alerts:        []data.ServiceAlert{},
+	}
+
+	lines, err := app.store.Stations.ReadStationLines(ctx, station.Stops)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	seenLines := map[data.Line]bool{}
+	for _, l := range lines {
+		if !seenLines[l] {
+			seenLines[l] = true
+			res.Lines = append(res.Lines, l)
+		}
+	}
+	sort.Slice(res.Lines, func(i, j int) bool {
+		if res.Lines[i].ID != res.Lines[j].ID {
+			return res.Lines[i].ID < res.Lines[j].ID
+		}
+		return res.Lines[i].Name < res.Lines[j].Name
+	})
+
+	since := at.AddDate(0, 0, -(stationDelayDays - 1))
+	seenAlerts := map[int64]bool{}
+	for _, s := range station.Stops {
+		departures, err := app.store.Stations.ReadUpcomingDepartures(ctx, data.DepartureQuery{
+			StopID: int64(s.ID),
+			From:   at,
+			Limit:  stationDepartures,
+		})
+		if err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+		res.Departures = append(res.Departures, departures...)
+
+		delays, err := app.store.Delays.GetRecentDelays(ctx, data.DelayFilter{
+			StopID: int64(s.ID),
+			Since:  since,
+			Limit:  stationDelays,
+		})
+		if err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+		res.RecentDelays = append(res.RecentDelays, delays...)
+
+		alerts, err := app.activeServiceAlerts(ctx, data.ServiceAlertFilter{StopID: s.ID})
+		if err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+		for _, a := range alerts {
+			if !seenAlerts[a.ID] {
+				seenAlerts[a.ID] = true
+				res.Alerts = append(res.Alerts, a)
+			}
+		}
+	}
+
+	sort.SliceStable(res.Departures, func(i, j int) bool {
+		a, b := res.Departures[i], res.Departures[j]
+		if a.Time != b.Time {
+			return a.Time < b.Time
+		}
+		return a.LineID < b.LineID
+	})
+	res.Departures = res.Departures[:min(len(res.Departures), stationDepartures)]
+
+	sort.SliceStable(res.RecentDelays, func(i, j int) bool {
+		a, b := res.RecentDelays[i], res.RecentDelays[j]
+		if !a.Date.Equal(b.Date) {
+			return a.Date.After(b.Date)
+		}
+		return a.ID > b.ID
+	})
+	res.RecentDelays = res.RecentDelays[:min(len(res.RecentDelays), stationDelays)]
+
+	if err := utils.WriteJSONResponse(w, http.StatusOK, res); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// @Summary		List station overrides
+// @Description	Returns every stop an admin has moved to a station by hand, by stop. Admins only.
+// @Tags			admin
+// @Produce		json
+// @Success		200	{array}	data.StationOverride	"Station overrides"
+// @Router			/admin/station-overrides [get]
+// @Security		ApiKeyAuth
+func (app *app) listStationOverridesHandler(w http.ResponseWriter, r *http.Request) {
+	overrides, err := app.store.StationOverrides.List(r.Context())
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, overrides)
+}
+
+// @Summary		Move a stop to a station
+// @Description	Puts the stop in the station of station_stop_id, any stop of that station, whatever their names
+// @Description	and distance; the stop's own id makes it a station of its own. It replaces an earlier override
+// @Description	of the stop. Admins only.
+// @Tags			admin
+// @Accept			json
+// @Produce		json
+// @Param			stopId		path		int							true	"Stop ID"
+// @Param			override	body		data.StationOverridePayload	true	"The station to move the stop to"
+// @Success		200			{object}	data.StationOverride		"The override"
+// @Router			/admin/station-overrides/{stopId} [put]
+// @Security		ApiKeyAuth
+func (app *app) setStationOverrideHandler(w http.ResponseWriter, r *http.Request) {
+	stopID, err := readIDParam(r, "stopId")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	var payload data.StationOverridePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	override := &data.StationOverride{StopID: int(stopID), StationStopID: payload.StationStopID}
+	if err := app.store.StationOverrides.Set(r.Context(), override); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, override)
+}
+
+// @Summary		Delete a station override
+// @Description	Deletes the override of the stop, which goes back to the station of its name nearby. Admins
+// @Description	only.
+// @Tags			admin
+// @Param			stopId	path	int	true	"Stop ID"
+// @Success		204
+// @Router			/admin/station-overrides/{stopId} [delete]
+// @Security		ApiKeyAuth
+func (app *app) deleteStationOverrideHandler(w http.ResponseWriter, r *http.Request) {
+	stopID, err := readIDParam(r, "stopId")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.StationOverrides.Delete(r.Context(), stopID); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockStationStops serves Glavni trg as two poles 60 m apart and Tezno.
+func mockStationStops(app *app) {
+	app.store.Stations.(*MockStationsStorage).ReadListFunc = func(ctx context.Context) ([]data.Stop, error) {
+		return []data.Stop{
+			{ID: 1, Number: "011", Name: "Glavni trg", Latitude: 46.5580, Longitude: 15.6462},
+			{ID: 3, Number: "012", Name: "Glavni trg", Latitude: 46.5577, Longitude: 15.6455},
+			{ID: 4, Number: "041", Name: "Tezno", Latitude: 46.5330, Longitude: 15.6700},
+		}, nil
+	}
+}
+
+func TestListParentStations(t *testing.T) {
+	app := setupTestApp()
+	mockStationStops(app)
+
+	req, w := createTestRequest("GET", "/v1/parent-stations", nil)
+	app.mount().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var res struct {
+		Data []data.ParentStation `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+
+	require.Len(t, res.Data, 2)
+	assert.Equal(t, 1, res.Data[0].ID)
+	assert.Equal(t, "Glavni trg", res.Data[0].Name)
+	assert.Len(t, res.Data[0].Stops, 2)
+	assert.Equal(t, 4, res.Data[1].ID)
+}
+
+func TestListParentStationsAppliesOverrides(t *testing.T) {
+	app := setupTestApp()
+	mockStationStops(app)
+	app.store.StationOverrides.(*MockStationOverridesStorage).ListFunc = func(ctx context.Context) ([]data.StationOverride, error) {
+		return []data.StationOverride{{StopID: 3, StationStopID: 3}}, nil
+	}
+
+	req, w := createTestRequest("GET", "/v1/parent-stations", nil)
+	app.mount().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var res struct {
+		Data []data.ParentStation `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Len(t, res.Data, 3, "the second pole of Glavni trg is a station of its own")
+}
+
+func TestGetParentStation(t *testing.T) {
+	app := setupTestApp()
+	mockStationStops(app)
+
+	mock := app.store.Stations.(*MockStationsStorage)
+	mock.ReadStationLinesFunc = func(ctx context.Context, stops []data.Stop) ([]data.Line, error) {
+		require.Len(t, stops, 2)
+		return []data.Line{
+			{ID: 6, LineCode: "6", Name: "Vzpenjača"},
+			{ID: 1, LineCode: "1", Name: "Tezno"},
+			{ID: 6, LineCode: "6", Name: "Vzpenjača"},
+		}, nil
+	}
+	var from time.Time
+	mock.ReadUpcomingDeparturesFunc = func(ctx context.Context, q data.DepartureQuery) ([]data.UpcomingDeparture, error) {
+		from = q.From
+		if q.StopID == 1 {
+			return []data.UpcomingDeparture{
+				{StopID: 1, LineID: 6, Time: "08:10"},
+				{StopID: 1, LineID: 6, Time: "08:40"},
+			}, nil
+		}
+		return []data.UpcomingDeparture{{StopID: 3, LineID: 1, Time: "08:05"}}, nil
+	}
+	app.store.Delays.(*MockDelaysStorage).GetRecentDelaysFunc = func(ctx context.Context, f data.DelayFilter) ([]data.DelayReport, error) {
+		day := time.Date(2026, 10, 24, 0, 0, 0, 0, time.UTC)
+		if f.StopID == 1 {
+			return []data.DelayReport{{ID: 5, Date: day, StopID: 1, DelayMin: 4}}, nil
+		}
+		return []data.DelayReport{{ID: 7, Date: day, StopID: 3, DelayMin: 2}}, nil
+	}
+	closure := data.ServiceAlert{ID: 2, Effect: data.EffectNoService}
+	app.store.ServiceAlerts.(*MockServiceAlertsStorage).ListFunc = func(ctx context.Context, f data.ServiceAlertFilter) ([]data.ServiceAlert, error) {
+		return []data.ServiceAlert{closure}, nil
+	}
+
+	req, w := createTestRequest("GET", "/v1/parent-stations/1?at=2026-10-24T08:00:00%2B02:00", nil)
+	app.mount().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.True(t, from.Equal(time.Date(2026, 10, 24, 6, 0, 0, 0, time.UTC)))
+
+	var res struct {
+		Data struct {
+			ID    int `json:"id"`
+			Stops []struct {
+				ID int `json:"id"`
+			} `json:"stops"`
+			Lines      []data.Line              `json:"lines"`
+			Departures []data.UpcomingDeparture `json:"departures"`
+			Delays     []data.DelayReport       `json:"recent_delays"`
+			Alerts     []data.ServiceAlert      `json:"alerts"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+
+	assert.Equal(t, 1, res.Data.ID)
+	assert.Len(t, res.Data.Stops, 2)
+	assert.Equal(t, []data.Line{{ID: 1, LineCode: "1", Name: "Tezno"}, {ID: 6, LineCode: "6", Name: "Vzpenjača"}}, res.Data.Lines)
+
+	times := []string{}
+	for _, d := range res.Data.Departures {
+		times = append(times, d.Time)
+	}
+	assert.Equal(t, []string{"08:05", "08:10", "08:40"}, times, "departures of both poles, in order")
+	assert.Equal(t, 3, res.Data.Departures[0].StopID)
+
+	require.Len(t, res.Data.Delays, 2)
+	assert.Equal(t, 7, res.Data.Delays[0].ID, "newest first")
+	assert.Len(t, res.Data.Alerts, 1, "an alert at both poles is listed once")
+}
+
+func TestGetParentStationNotFound(t *testing.T) {
+	app := setupTestApp()
+	mockStationStops(app)
+
+	req, w := createTestRequest("GET", "/v1/parent-stations/3", nil)
+	app.mount().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code, "stop 3 is a pole of station 1")
+}
+
+func TestSetStationOverride(t *testing.T) {
+	app := setupTestApp()
+
+	var saved data.StationOverride
+	app.store.StationOverrides.(*MockStationOverridesStorage).SetFunc = func(ctx context.Context, o *data.StationOverride) error {
+		saved = *o
+		o.UpdatedAt = time.Now()
+		return nil
+	}
+
+	req, w := adminRequest(t, app, data.RoleAdmin, "PUT", "/v1/admin/station-overrides/8", map[string]any{
+		"station_stop_id": 3,
+	})
+	app.mount().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, data.StationOverride{StopID: 8, StationStopID: 3}, saved)
+
+	req, w = adminRequest(t, app, data.RoleAdmin, "PUT", "/v1/admin/station-overrides/8", map[string]any{})
+	app.mount().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"field":"station_stop_id"`)
+
+	req, w = adminRequest(t, app, data.RoleUser, "PUT", "/v1/admin/station-overrides/8", map[string]any{
+		"station_stop_id": 3,
+	})
+	app.mount().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestDeleteStationOverride(t *testing.T) {
+	app := setupTestApp()
+
+	app.store.StationOverrides.(*MockStationOverridesStorage).DeleteFunc = func(ctx context.Context, stopID int64) error {
+		if stopID != 8 {
+			return data.ErrNotFound
+		}
+		return nil
+	}
+
+	req, w := adminRequest(t, app, data.RoleAdmin, "DELETE", "/v1/admin/station-overrides/8", nil)
+	app.mount().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	req, w = adminRequest(t, app, data.RoleAdmin, "DELETE", "/v1/admin/station-overrides/9", nil)
+	app.mount().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestShortestPathTransfersWithinStation(t *testing.T) {
+	app := setupTestApp()
+	mockStationStops(app)
+
+	mock := app.store.Stations.(*MockStationsStorage)
+	// Line 6 calls at the other pole of Glavni trg than the one nearest to
+	// the destination, and line 1 at Tezno.
+	mock.ReadThreeStationsAtDestinationFunc = func(ctx context.Context, p *data.PathLocation) ([]data.Stop, error) {
+		return []data.Stop{{ID: 1, Name: "Glavni trg"}}, nil
+	}
+	mock.ReadStationLinesFunc = func(ctx context.Context, stops []data.Stop) ([]data.Line, error) {
+		lines := []data.Line{}
+		for _, s := range stops {
+			switch s.ID {
+			case 3:
+				lines = append(lines, data.Line{ID: 6, LineCode: "6"})
+			case 4:
+				lines = append(lines, data.Line{ID: 1, LineCode: "1"})
+			}
+		}
+		return lines, nil
+	}
+	mock.ReadThreeStationsAtLocationFunc = func(ctx context.Context, p *data.PathLocation, lines []data.Line) ([]data.Stop, error) {
+		assert.Equal(t, []data.Line{{ID: 6, LineCode: "6"}}, lines, "the destination station has line 6")
+		return []data.Stop{{ID: 4, Name: "Tezno"}, {ID: 3, Name: "Glavni trg"}}, nil
+	}
+
+	req, w := createTestRequest("POST", "/v1/show/shortest", map[string]any{
+		"destination_latitude":  46.5580,
+		"destination_longitude": 15.6462,
+		"location_latitude":     46.5330,
+		"location_longitude":    15.6700,
+	})
+	app.getShortestPath(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var res struct {
+		Data []data.Stop `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	require.Len(t, res.Data, 2)
+	assert.Equal(t, 3, res.Data[0].ID, "line 6 reaches the destination station without a walk")
+	assert.Equal(t, 4, res.Data[1].ID)
+}
@@ -2,42 +2,113 @@ package main
 
 import (
 	"backend/cmd/utils"
+	"backend/internal/cluster"
 	"backend/internal/data"
-	"encoding/json"
 	"net/http"
+	"slices"
+	"sort"
 )
 
 func (app *app) getShortestPath(w http.ResponseWriter, r *http.Request) {
-	if r.Body == nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, "No user data in request body")
+	var payload data.PathLocation
+	if err := readJSON(w, r, &payload); err != nil {
+		app.errorResponse(w, r, err)
 		return
 	}
 
-	var payload data.PathLocation
-	err := json.NewDecoder(r.Body).Decode(&payload)
+	ctx := r.Context()
 
+	// Closed stops are left out of the plan.
+	alerts, err := app.activeServiceAlerts(ctx, data.ServiceAlertFilter{})
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.errorResponse(w, r, err)
 		return
 	}
+	payload.AvoidStopIDs = data.ClosedStops(alerts)
 
-	ctx := r.Context()
+	// Changing between the poles of a station is free, so every pole of a
+	// station serves the lines of all of them.
+	stations, err := app.readParentStations(ctx)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	stationOf := cluster.StationOf(stations)
+	poles := func(stops []data.Stop) []data.Stop {
+		return stationPoles(stops, stations, stationOf, payload.AvoidStopIDs)
+	}
 
 	stopsAtDestination, err := app.store.Stations.ReadThreeStationsAtDestination(ctx, &payload)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
 
-	linesAtDestination, err := app.store.Stations.ReadStationLines(ctx, stopsAtDestination)
+	linesAtDestination, err := app.store.Stations.ReadStationLines(ctx, poles(stopsAtDestination))
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
 
 	stopsAtLocation, err := app.store.Stations.ReadThreeStationsAtLocation(ctx, &payload, linesAtDestination)
-
-	utils.WriteJSONResponse(w, http.StatusOK, stopsAtLocation)
-
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.errorResponse(w, r, err)
 		return
 	}
 
-	if err := utils.WriteJSONResponse(w, http.StatusOK, linesAtDestination); err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+	// Stops whose station has a line to the destination come first.
+	direct := make(map[int]bool, len(stopsAtLocation))
+	for _, stop := range stopsAtLocation {
+		lines, err := app.store.Stations.ReadStationLines(ctx, poles([]data.Stop{stop}))
+		if err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+		direct[stop.ID] = slices.ContainsFunc(lines, func(l data.Line) bool {
+			return slices.ContainsFunc(linesAtDestination, func(d data.Line) bool { return d.ID == l.ID })
+		})
+	}
+	sort.SliceStable(stopsAtLocation, func(i, j int) bool {
+		return direct[stopsAtLocation[i].ID] && !direct[stopsAtLocation[j].ID]
+	})
+
+	for i := range stopsAtLocation {
+		stopsAtLocation[i].Alerts, err = app.activeServiceAlerts(ctx, data.ServiceAlertFilter{StopID: stopsAtLocation[i].ID})
+		if err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+	}
+
+	if err := utils.WriteJSONResponse(w, http.StatusOK, stopsAtLocation); err != nil {
+		app.internalServerError(w, r, err)
 		return
 	}
 }
+
+// stationPoles returns the stops with the other poles of their stations,
+// each once and leaving out the avoided ones. Stops not in any station are
+// kept as they are.
+func stationPoles(stops []data.Stop, stations []data.ParentStation, stationOf map[int]int, avoid []int) []data.Stop {
+	var poles []data.Stop
+	seen := map[int]bool{}
+	add := func(s data.Stop) {
+		if !seen[s.ID] && !slices.Contains(avoid, s.ID) {
+			seen[s.ID] = true
+			poles = append(poles, s)
+		}
+	}
+
+	for _, stop := range stops {
+		add(stop)
+		if id, ok := stationOf[stop.ID]; ok {
+			if station, ok := cluster.Find(stations, id); ok {
+				for _, pole := range station.Stops {
+					add(pole)
+				}
+			}
+		}
+	}
+
+	return poles
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"backend/cmd/utils"
+	"backend/internal/config"
+	"backend/internal/data"
+	"backend/internal/push"
+	"backend/internal/safehttp"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// pushSendTimeout bounds a single request to a push service.
+const pushSendTimeout = 10 * time.Second
+
+// setupPush starts the Web Push sender, which stops when ctx is cancelled,
+// and returns the VAPID keys browsers subscribe with. It returns nil keys
+// when push is disabled.
+func setupPush(ctx context.Context, cfg config.Push, development bool, store data.Storage, logger *zap.SugaredLogger) (*push.Keys, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	var (
+		keys *push.Keys
+		err  error
+	)
+	if cfg.VAPIDPrivateKey == "" && development {
+		keys, err = push.GenerateKeys()
+		logger.Warnw("using a temporary VAPID key pair; browser subscriptions will not survive a restart")
+	} else {
+		keys, err = push.ParseKeys(cfg.VAPIDPublicKey, cfg.VAPIDPrivateKey.Value())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Browsers hand us the endpoints, so only public addresses are
+	// reached; the test endpoint set by operators is the one exception.
+	sender := &push.Sender{
+		Client:   safehttp.NewClient(pushSendTimeout),
+		Keys:     keys,
+		Subject:  cfg.Subject,
+		TTL:      cfg.TTL,
+		Endpoint: cfg.TestEndpoint,
+	}
+	if cfg.TestEndpoint != "" {
+		sender.Client = &http.Client{Timeout: pushSendTimeout}
+		logger.Warnw("sending every push notification to the test endpoint", "endpoint", cfg.TestEndpoint)
+	}
+
+	go push.NewService(store, sender, cfg.PollInterval, logger).Run(ctx)
+
+	return keys, nil
+}
+
+// runVAPIDKeysCommand prints a new VAPID key pair as environment variables.
+func runVAPIDKeysCommand(out io.Writer) error {
+	keys, err := push.GenerateKeys()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "VAPID_PUBLIC_KEY=%s\nVAPID_PRIVATE_KEY=%s\n", keys.PublicKey(), keys.PrivateKey())
+	return err
+}
+
+type vapidKey struct {
+	PublicKey string `json:"public_key"`
+}
+
+// @Summary		Get the VAPID public key
+// @Description	Returns the applicationServerKey to pass to PushManager.subscribe. 404 when push
+// @Description	notifications are disabled on this server.
+// @Tags			push
+// @Produce		json
+// @Success		200	{object}	vapidKey	"The public key, base64url encoded"
+// @Router			/me/push/key [get]
+// @Security		ApiKeyAuth
+func (app *app) getVAPIDKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if app.pushKeys == nil {
+		app.errorResponse(w, r, fmt.Errorf("push notifications: %w", data.ErrNotFound))
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, vapidKey{PublicKey: app.pushKeys.PublicKey()})
+}
+
+// @Summary		List push subscriptions
+// @Description	Returns the browsers the logged-in user receives push notifications on.
+// @Tags			push
+// @Produce		json
+// @Success		200	{array}	data.PushSubscription	"Push subscriptions"
+// @Router			/me/push/subscriptions [get]
+// @Security		ApiKeyAuth
+func (app *app) listPushSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	subs, err := app.store.Push.List(r.Context(), GetUserIDFromContext(r.Context()))
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, subs)
+}
+
+// @Summary		Register a push subscription
+// @Description	Registers the browser's PushSubscription, as returned by its toJSON method. The browser is
+// @Description	notified when a favourite line, or a favourite line at a stop, gets a delay report.
+// @Description	Registering a known endpoint again replaces its keys.
+// @Tags			push
+// @Accept			json
+// @Produce		json
+// @Param			subscription	body		data.PushSubscriptionPayload	true	"The browser's subscription"
+// @Success		201				{object}	data.PushSubscription			"The registered subscription"
+// @Router			/me/push/subscriptions [post]
+// @Security		ApiKeyAuth
+func (app *app) createPushSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	if app.pushKeys == nil {
+		app.errorResponse(w, r, fmt.Errorf("push notifications: %w", data.ErrNotFound))
+		return
+	}
+
+	var payload data.PushSubscriptionPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	u, err := url.Parse(payload.Endpoint)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		app.errorResponse(w, r, data.NewValidationError("endpoint", "invalid_url", "must be an https URL"))
+		return
+	}
+	if err := safehttp.CheckURL(u); err != nil {
+		app.errorResponse(w, r, data.NewValidationError("endpoint", "forbidden_host", "must be on the public internet"))
+		return
+	}
+	if err := push.CheckKeys(payload.Keys.P256dh, payload.Keys.Auth); err != nil {
+		app.errorResponse(w, r, data.NewValidationError("keys", "invalid_key", err.Error()))
+		return
+	}
+
+	sub := &data.PushSubscription{
+		UserID:    GetUserIDFromContext(r.Context()),
+		Endpoint:  payload.Endpoint,
+		P256dh:    payload.Keys.P256dh,
+		Auth:      payload.Keys.Auth,
+		UserAgent: push.Truncate(r.UserAgent(), 300),
+	}
+	if payload.ExpirationTime != nil {
+		expires := time.UnixMilli(*payload.ExpirationTime).UTC()
+		sub.ExpiresAt = &expires
+	}
+
+	if err := app.store.Push.Save(r.Context(), sub); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusCreated, sub)
+}
+
+// @Summary		Delete a push subscription
+// @Tags			push
+// @Param			subscriptionId	path	int	true	"Subscription ID"
+// @Success		204
+// @Router			/me/push/subscriptions/{subscriptionId} [delete]
+// @Security		ApiKeyAuth
+func (app *app) deletePushSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r, "subscriptionId")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Push.Delete(r.Context(), GetUserIDFromContext(r.Context()), id); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
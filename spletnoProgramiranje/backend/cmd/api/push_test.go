@@ -0,0 +1,117 @@
+package main
+
+import (
+	"backend/internal/data"
+	"backend/internal/push"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func browserKeys(t *testing.T) (p256dh, auth string) {
+	private, err := ecdh.P256().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	secret := make([]byte, 16)
+	_, err = rand.Read(secret)
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(private.PublicKey().Bytes()),
+		base64.RawURLEncoding.EncodeToString(secret)
+}
+
+func TestPushDisabled(t *testing.T) {
+	app := setupTestApp()
+
+	req, w := adminRequest(t, app, data.RoleUser, "GET", "/v1/me/push/key", nil)
+	app.mount().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestCreatePushSubscription(t *testing.T) {
+	app := setupTestApp()
+	keys, err := push.GenerateKeys()
+	require.NoError(t, err)
+	app.pushKeys = keys
+
+	var saved data.PushSubscription
+	app.store.Push.(*MockPushStorage).SaveFunc = func(ctx context.Context, p *data.PushSubscription) error {
+		saved = *p
+		p.ID = 5
+		return nil
+	}
+
+	p256dh, auth := browserKeys(t)
+	expires := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+	req, w := adminRequest(t, app, data.RoleUser, "POST", "/v1/me/push/subscriptions", map[string]any{
+		"endpoint":       "https://push.example.com/send/abc",
+		"expirationTime": expires.UnixMilli(),
+		"keys":           map[string]string{"p256dh": p256dh, "auth": auth},
+	})
+	app.mount().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Equal(t, 1, saved.UserID)
+	assert.Equal(t, p256dh, saved.P256dh)
+	require.NotNil(t, saved.ExpiresAt)
+	assert.True(t, expires.Equal(*saved.ExpiresAt))
+	assert.NotContains(t, w.Body.String(), auth, "the browser's keys are not echoed")
+}
+
+func TestCreatePushSubscriptionValidation(t *testing.T) {
+	p256dh, auth := browserKeys(t)
+
+	tests := []struct {
+		name     string
+		endpoint string
+		p256dh   string
+		auth     string
+	}{
+		{"plain http endpoint", "http://push.example.com/send/abc", p256dh, auth},
+		{"relative endpoint", "/send/abc", p256dh, auth},
+		{"private endpoint", "https://10.0.0.7/send/abc", p256dh, auth},
+		{"invalid public key", "https://push.example.com/send/abc", "AAAA", auth},
+		{"short auth secret", "https://push.example.com/send/abc", p256dh, "AAAA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := setupTestApp()
+			keys, err := push.GenerateKeys()
+			require.NoError(t, err)
+			app.pushKeys = keys
+
+			req, w := adminRequest(t, app, data.RoleUser, "POST", "/v1/me/push/subscriptions", map[string]any{
+				"endpoint": tt.endpoint,
+				"keys":     map[string]string{"p256dh": tt.p256dh, "auth": tt.auth},
+			})
+			app.mount().ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+		})
+	}
+}
+
+func TestDeletePushSubscription(t *testing.T) {
+	app := setupTestApp()
+	app.store.Push.(*MockPushStorage).DeleteFunc = func(ctx context.Context, userID int, id int64) error {
+		if userID != 1 || id != 5 {
+			return data.ErrNotFound
+		}
+		return nil
+	}
+
+	req, w := adminRequest(t, app, data.RoleUser, "DELETE", "/v1/me/push/subscriptions/5", nil)
+	app.mount().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	req, w = adminRequest(t, app, data.RoleUser, "DELETE", "/v1/me/push/subscriptions/6", nil)
+	app.mount().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"backend/internal/config"
+	"backend/internal/metrics"
+	"backend/internal/ratelimit"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// apiKeyHeader carries the API key of non-browser clients.
+const apiKeyHeader = "X-API-Key"
+
+// rateLimitPolicy is a token bucket applied to a set of routes. Every
+// policy has its own buckets, keyed by whatever key returns for a request.
+type rateLimitPolicy struct {
+	name  string
+	limit ratelimit.Limit
+	key   func(r *http.Request) string
+}
+
+var (
+	// policyDefault applies to every /v1 request.
+	policyDefault = rateLimitPolicy{"default", ratelimit.PerMinute(300, 100), clientRateKey}
+	// policyLogin slows down password guessing.
+	policyLogin = rateLimitPolicy{"login", ratelimit.PerMinute(5, 5), ipRateKey}
+	// policyLoginAccount slows down guessing one account's password from
+	// one address over hours.
+	policyLoginAccount = rateLimitPolicy{"login_account", ratelimit.PerHour(20, 10), loginAttemptRateKey}
+	// policyLoginAccountTotal caps guesses at one account from all
+	// addresses together. It is loose enough that no single address, held
+	// back by policyLogin, can lock the owner out; policyLogin runs first,
+	// so requests it turns away use up none of the account's attempts.
+	policyLoginAccountTotal = rateLimitPolicy{"login_account_total", ratelimit.PerHour(600, 100), loginEmailRateKey}
+	// policyRegister limits account creation per address.
+	policyRegister = rateLimitPolicy{"register", ratelimit.PerHour(10, 5), ipRateKey}
+	// policyDelayReport limits report spam per user.
+	policyDelayReport = rateLimitPolicy{"delay_report", ratelimit.PerMinute(6, 3), userRateKey}
+	// policyCloseBy protects the PostGIS radius query.
+	policyCloseBy = rateLimitPolicy{"close_by", ratelimit.PerMinute(60, 20), clientRateKey}
+	// policyIsochrone protects the timetable search behind isochrones.
+	policyIsochrone = rateLimitPolicy{"isochrone", ratelimit.PerMinute(20, 5), clientRateKey}
+)
+
+var rateLimitedTotal = metrics.NewCounterVec(
+	"mbusi_rate_limited_requests_total",
+	"Total number of requests rejected by a rate limit policy.",
+	"policy",
+)
+
+// setupRateLimiter builds the bucket store selected by cfg.Store: "memory"
+// (the default) keeps buckets in process, "redis" shares them through the
+// Redis-compatible server at cfg.RedisURL and "none" disables rate limiting.
+// Idle in-memory buckets are swept until ctx is done.
+func setupRateLimiter(ctx context.Context, cfg config.RateLimit, logger *zap.SugaredLogger) (ratelimit.Store, error) {
+	switch cfg.Store {
+	case "none":
+		logger.Warnw("rate limiting disabled")
+		return nil, nil
+	case "memory":
+		store := ratelimit.NewMemoryStore()
+		go store.RunSweeper(ctx, time.Minute)
+		return store, nil
+	case "redis":
+		client, err := ratelimit.NewRedisClient(cfg.RedisURL.Value())
+		if err != nil {
+			return nil, err
+		}
+		logger.Infow("sharing rate limits through redis", "url", cfg.RedisURL)
+		return ratelimit.NewRedisStore(client, "mbusi:ratelimit:"), nil
+	default:
+		return nil, fmt.Errorf("unknown RATE_LIMIT_STORE %q", cfg.Store)
+	}
+}
+
+// ipRateKey keys by client address. realIP has already replaced RemoteAddr
+// with the forwarded address when the request came through a trusted proxy.
+func ipRateKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// clientRateKey keys by the authenticated API key when the request carries
+// one and by address otherwise.
+func clientRateKey(r *http.Request) string {
+	if key := apiKeyFromContext(r.Context()); key != nil {
+		return "key:" + strconv.FormatInt(key.ID, 10)
+	}
+	return ipRateKey(r)
+}
+
+// userRateKey keys by the user of the request's bearer token, as found by
+// identifyUser, falling back to the client.
+func userRateKey(r *http.Request) string {
+	if id, ok := r.Context().Value(tokenUserKey).(int); ok {
+		return "user:" + strconv.Itoa(id)
+	}
+	return clientRateKey(r)
+}
+
+// maxLoginPeek bounds how much of a login body is read to find the email.
+const maxLoginPeek = 4 << 10
+
+// loginEmailRateKey keys by the account a login names, so that rotating
+// addresses buys no extra guesses at one password. The body is put back for
+// the handler. The email is hashed to keep it out of the bucket store; a
+// body without one falls back to the client.
+func loginEmailRateKey(r *http.Request) string {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxLoginPeek))
+	r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+
+	var payload struct {
+		Email string `json:"email"`
+	}
+	if err != nil || json.Unmarshal(body, &payload) != nil || strings.TrimSpace(payload.Email) == "" {
+		return clientRateKey(r)
+	}
+
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(payload.Email))))
+	return "email:" + hex.EncodeToString(sum[:16])
+}
+
+// loginAttemptRateKey keys by the account a login names and the client
+// address together, so guesses from one address do not use up the
+// account's attempts from anywhere else.
+func loginAttemptRateKey(r *http.Request) string {
+	return loginEmailRateKey(r) + "|" + ipRateKey(r)
+}
+
+// tokenUserKey holds the user of a valid bearer token, whether or not the
+// route requires one.
+const tokenUserKey contextKey = "tokenUserID"
+
+// identifyUser notes the user of a valid bearer token for per-user rate
+// limits, which run before WithJWTAuth gets to the token. It rejects
+// nothing: routes requiring a user still check the token themselves.
+func (app *app) identifyUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if getTokenFromRequest(r) != "" {
+			if id, err := app.tokenUserID(r); err == nil {
+				r = r.WithContext(context.WithValue(r.Context(), tokenUserKey, id))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimit enforces policy and advertises the bucket state in the
+// RateLimit-* headers. Nested policies keep the headers of the bucket with
+// the fewest requests left, so clients see the limit they will hit first.
+// When the store fails the request is let through:
+// an unavailable limiter must not take the API down with it.
+func (app *app) rateLimit(policy rateLimitPolicy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if app.rateLimiter == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			res, err := app.rateLimiter.Take(r.Context(), policy.name+":"+policy.key(r), policy.limit, time.Now())
+			if err != nil {
+				app.requestLogger(r).Warnw("rate limiter unavailable, allowing request", "policy", policy.name, "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			if left, err := strconv.Atoi(h.Get("RateLimit-Remaining")); err != nil || res.Remaining <= left {
+				h.Set("RateLimit-Policy", policy.limit.String())
+				h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+				h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+				h.Set("RateLimit-Reset", ceilSeconds(res.ResetAfter))
+			}
+
+			if !res.Allowed {
+				rateLimitedTotal.With(policy.name).Inc()
+				app.rateLimitExceededResponse(w, r, res.RetryAfter)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (app *app) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	seconds := ceilSeconds(retryAfter)
+	w.Header().Set("Retry-After", seconds)
+	app.writeProblem(w, r, http.StatusTooManyRequests, codeRateLimited, fmt.Sprintf("rate limit exceeded, retry in %s seconds", seconds), nil)
+}
+
+// ceilSeconds rounds d up to whole seconds, as required by Retry-After.
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
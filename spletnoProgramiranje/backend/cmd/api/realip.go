@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// realIP replaces RemoteAddr with the client address a trusted proxy
+// forwarded, so logs and per-address rate limits see the client rather than
+// the proxy. Forwarding headers from anyone else are ignored: a client could
+// otherwise pick a fresh address for every request.
+func realIP(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if peer, ok := remoteIP(r.RemoteAddr); ok && isTrustedProxy(peer, trusted) {
+				if client, ok := forwardedClient(r.Header, trusted); ok {
+					r.RemoteAddr = client.String()
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// remoteIP parses RemoteAddr, with or without a port.
+func remoteIP(addr string) (netip.Addr, bool) {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip.Unmap(), true
+}
+
+func isTrustedProxy(ip netip.Addr, trusted []netip.Prefix) bool {
+	for _, p := range trusted {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedClient finds the client in X-Forwarded-For, walking it from the
+// nearest hop back and skipping our own proxies: entries left of the first
+// untrusted one were written by the client and prove nothing. Without the
+// header, X-Real-IP is taken as is.
+func forwardedClient(h http.Header, trusted []netip.Prefix) (netip.Addr, bool) {
+	var hops []string
+	for _, v := range h.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip, ok := remoteIP(strings.TrimSpace(hops[i]))
+		if !ok {
+			return netip.Addr{}, false
+		}
+		if !isTrustedProxy(ip, trusted) || i == 0 {
+			return ip, true
+		}
+	}
+
+	return remoteIP(strings.TrimSpace(h.Get("X-Real-IP")))
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"backend/cmd/utils"
+	"backend/internal/data"
+	"backend/internal/validator"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// readJSON decodes the request body into dst through utils.ReadJSON, which
+// enforces the body size limit and rejects unknown fields, and then checks
+// the `validate` tags of dst. Decoding problems are returned as
+// errMalformedBody, validation problems as *data.ValidationError.
+func readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	if err := utils.ReadJSON(w, r, dst); err != nil {
+		if errors.Is(err, io.EOF) {
+			return data.NewValidationError("body", "required", "must not be empty")
+		}
+		return fmt.Errorf("%w: %v", errMalformedBody, err)
+	}
+
+	return validator.Struct(dst)
+}
+
+// readIDParam parses a numeric URL parameter, reporting a validation error
+// naming the parameter when it is malformed.
+func readIDParam(r *http.Request, name string) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, name), 10, 64)
+	if err != nil || id < 1 {
+		return 0, data.NewValidationError(name, "invalid", "must be a positive integer")
+	}
+
+	return id, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"backend/cmd/utils"
+	"backend/internal/data"
+	"net/http"
+)
+
+// checkPath checks a path of [latitude, longitude] pairs.
+func checkPath(field string, path [][]float64) error {
+	if len(path) < 2 {
+		return data.NewValidationError(field, "too_few", "must contain at least 2 points")
+	}
+	for _, p := range path {
+		if len(p) != 2 || p[0] < -90 || p[0] > 90 || p[1] < -180 || p[1] > 180 {
+			return data.NewValidationError(field, "invalid_point", "points must be [latitude, longitude] pairs")
+		}
+	}
+	return nil
+}
+
+// @Summary		List the route shapes of a line
+// @Description	Returns every shape of the line's directions, including past and planned ones, by direction
+// @Description	and then latest start first. Admins only.
+// @Tags			admin
+// @Produce		json
+// @Param			lineId	path	int					true	"Line ID"
+// @Success		200		{array}	data.RouteShape	"Route shapes"
+// @Router			/admin/routes/{lineId}/shapes [get]
+// @Security		ApiKeyAuth
+func (app *app) listRouteShapesHandler(w http.ResponseWriter, r *http.Request) {
+	lineID, err := readIDParam(r, "lineId")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	shapes, err := app.store.RouteShapes.List(r.Context(), int(lineID))
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, shapes)
+}
+
+// @Summary		Create a route shape
+// @Description	Adds a version of a direction's path, valid from valid_from until valid_until (open-ended when
+// @Description	unset). Between them it replaces the line's usual path in route responses and the simulation,
+// @Description	which is how a roadworks detour is modelled. When shapes overlap, the one starting latest wins.
+// @Description	Admins only.
+// @Tags			admin
+// @Accept			json
+// @Produce		json
+// @Param			shape	body		data.RouteShapePayload	true	"The route shape"
+// @Success		201		{object}	data.RouteShape			"The created route shape"
+// @Router			/admin/route-shapes [post]
+// @Security		ApiKeyAuth
+func (app *app) createRouteShapeHandler(w http.ResponseWriter, r *http.Request) {
+	var payload data.RouteShapePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	if err := checkPath("path", payload.Path); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	if payload.ValidFrom != nil && payload.ValidUntil != nil && !payload.ValidUntil.After(*payload.ValidFrom) {
+		app.errorResponse(w, r, data.NewValidationError("valid_until", "empty_window", "must be after valid_from"))
+		return
+	}
+
+	shape := &data.RouteShape{
+		DirectionID: payload.DirectionID,
+		Path:        payload.Path,
+		ValidFrom:   payload.ValidFrom,
+		ValidUntil:  payload.ValidUntil,
+		Note:        payload.Note,
+	}
+
+	if err := app.store.RouteShapes.Create(r.Context(), shape); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusCreated, shape)
+}
+
+// @Summary		Delete a route shape
+// @Description	Deletes the route shape; the direction falls back to an older shape or the line's usual path.
+// @Description	Admins only.
+// @Tags			admin
+// @Param			shapeId	path	int	true	"Route shape ID"
+// @Success		204
+// @Router			/admin/route-shapes/{shapeId} [delete]
+// @Security		ApiKeyAuth
+func (app *app) deleteRouteShapeHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r, "shapeId")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.RouteShapes.Delete(r.Context(), id); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
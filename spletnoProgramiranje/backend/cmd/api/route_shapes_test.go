@@ -0,0 +1,88 @@
+package main
+
+import (
+	"backend/internal/data"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetRouteOfLineReadsDirectionAndTime(t *testing.T) {
+	app := setupTestApp()
+
+	var query data.RouteQuery
+	app.store.Routes.(*MockRoutesStorage).ReadRouteFunc = func(ctx context.Context, id int64, q data.RouteQuery) (*data.Route, error) {
+		query = q
+		return &data.Route{ID: 1, LineID: int(id), DirectionID: q.DirectionID}, nil
+	}
+
+	req, w := createTestRequest("GET", "/v1/routes/1?direction_id=2&at=2026-10-24T08:00:00%2B02:00", nil)
+	req = setupChiContext(req, map[string]string{"lineId": "1"})
+	app.getRouteOfLineHandler(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, 2, query.DirectionID)
+	assert.True(t, query.At.Equal(time.Date(2026, 10, 24, 6, 0, 0, 0, time.UTC)))
+
+	for _, target := range []string{"/v1/routes/1?direction_id=north", "/v1/routes/1?at=tomorrow"} {
+		req, w := createTestRequest("GET", target, nil)
+		req = setupChiContext(req, map[string]string{"lineId": "1"})
+		app.getRouteOfLineHandler(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, target)
+	}
+}
+
+func TestCreateRouteShape(t *testing.T) {
+	app := setupTestApp()
+
+	var created data.RouteShape
+	app.store.RouteShapes.(*MockRouteShapesStorage).CreateFunc = func(ctx context.Context, sh *data.RouteShape) error {
+		created = *sh
+		sh.ID = 3
+		return nil
+	}
+
+	req, w := adminRequest(t, app, data.RoleAdmin, "POST", "/v1/admin/route-shapes", map[string]any{
+		"direction_id": 2,
+		"path":         [][]float64{{46.5620, 15.6567}, {46.5600, 15.6500}, {46.5577, 15.6455}},
+		"valid_from":   "2026-10-24T05:00:00+02:00",
+		"valid_until":  "2026-11-07T05:00:00+01:00",
+		"note":         "Roadworks on Glavni trg",
+	})
+	app.mount().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Equal(t, 2, created.DirectionID)
+	assert.Len(t, created.Path, 3)
+	require.NotNil(t, created.ValidUntil)
+	assert.Equal(t, "Roadworks on Glavni trg", created.Note)
+}
+
+func TestCreateRouteShapeValidation(t *testing.T) {
+	tests := map[string]struct {
+		payload map[string]any
+		field   string
+	}{
+		"single point": {map[string]any{"direction_id": 2, "path": [][]float64{{46.5, 15.6}}}, "path"},
+		"bad point":    {map[string]any{"direction_id": 2, "path": [][]float64{{46.5, 15.6}, {15.6}}}, "path"},
+		"empty window": {map[string]any{"direction_id": 2, "path": [][]float64{{46.5, 15.6}, {46.6, 15.6}},
+			"valid_from": "2026-10-24T05:00:00Z", "valid_until": "2026-10-24T05:00:00Z"}, "valid_until"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			app := setupTestApp()
+
+			req, w := adminRequest(t, app, data.RoleAdmin, "POST", "/v1/admin/route-shapes", tt.payload)
+			app.mount().ServeHTTP(w, req)
+
+			require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+			assert.Contains(t, w.Body.String(), `"field":"`+tt.field+`"`)
+		})
+	}
+}
@@ -3,8 +3,8 @@ package main
 import (
 	"backend/cmd/utils"
 	"backend/internal/data"
+	"errors"
 	"fmt"
-	"log"
 	"math"
 	"net/http"
 	"strconv"
@@ -26,36 +26,179 @@ var upgrader = websocket.Upgrader{
 // @Description	all waypoints, direction information, and geographical coordinates for the entire route.
 // @Description	The response includes detailed path segments, turn-by-turn information, and route variants if available.
 // @Description	This endpoint is essential for mapping applications and route visualization features.
+// @Description	Service alerts in effect on the line, such as detours with their diverted path, are listed under alerts.
+// @Description	The path is that of direction_id, or of the line's first direction, as valid at the given time
+// @Description	(now by default): during roadworks it is the detour shape, identified by shape_id and valid_until.
+// @Description	With Accept: application/geo+json (or ?format=geojson) it returns a GeoJSON LineString Feature.
 // @Tags			routes
 // @Accept			json
-// @Produce		json
-// @Param			lineId	path		int			true	"Unique identifier of the bus line"
+// @Produce		json,application/geo+json
+// @Param			lineId			path		int			true	"Unique identifier of the bus line"
+// @Param			direction_id	query		int			false	"Direction of the line"
+// @Param			at				query		string		false	"RFC 3339 time the path should be valid at"
 // @Success		200		{object}	data.Route	"Complete route information including path coordinates"
 // @Router			/routes/{lineId} [get]
+// @Security		ApiKeyAuth
 func (app *app) getRouteOfLineHandler(w http.ResponseWriter, r *http.Request) {
-	idParam := chi.URLParam(r, "lineId")
-	lineId, err := strconv.ParseInt(idParam, 10, 64)
+	lineId, err := readIDParam(r, "lineId")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
 
+	q, err := readRouteQuery(r)
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.errorResponse(w, r, err)
 		return
 	}
 
 	ctx := r.Context()
 
-	//log.Printf("sem tu notri")
-	route, err := app.store.Routes.ReadRoute(ctx, lineId)
+	route, err := app.store.Routes.ReadRoute(ctx, lineId, q)
 
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	route.Alerts, err = app.activeServiceAlerts(ctx, data.ServiceAlertFilter{LineID: int(lineId)})
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	if negotiateGeoJSON(w, r) {
+		if err := writeGeoJSON(w, http.StatusOK, routeFeature(*route)); err != nil {
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
 
 	if err := utils.WriteJSONResponse(w, http.StatusOK, route); err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// readRouteQuery reads the optional direction_id and at query parameters.
+func readRouteQuery(r *http.Request) (data.RouteQuery, error) {
+	var q data.RouteQuery
+
+	if v := r.URL.Query().Get("direction_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 1 {
+			return q, data.NewValidationError("direction_id", "invalid_id", "must be a positive integer")
+		}
+		q.DirectionID = id
+	}
+
+	at, err := readAtQuery(r)
+	q.At = at
+
+	return q, err
+}
+
+// readAtQuery reads the optional at query parameter, an RFC 3339 time.
+// Unset, it is the zero time.
+func readAtQuery(r *http.Request) (time.Time, error) {
+	v := r.URL.Query().Get("at")
+	if v == "" {
+		return time.Time{}, nil
+	}
+
+	at, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, data.NewValidationError("at", "invalid_time", "must be an RFC 3339 time")
+	}
+
+	return at, nil
+}
+
+// @Summary		List the directions of a bus line
+// @Description	Returns the directions the line runs in, each named after where it heads. Use a direction's id
+// @Description	with the stops endpoint to draw a line diagram.
+// @Tags			routes
+// @Produce		json
+// @Param			lineId	path	int				true	"Unique identifier of the bus line"
+// @Success		200		{array}	data.Direction	"Directions of the line"
+// @Router			/routes/{lineId}/directions [get]
+// @Security		ApiKeyAuth
+func (app *app) getLineDirectionsHandler(w http.ResponseWriter, r *http.Request) {
+	lineID, err := readIDParam(r, "lineId")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	directions, err := app.store.Routes.ReadDirections(r.Context(), lineID)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	if err := utils.WriteJSONResponse(w, http.StatusOK, directions); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// @Summary		Get the stop sequence of a direction
+// @Description	Returns the stops of the direction in the order its buses call at them on the day of at (today by
+// @Description	default), with the scheduled time from the first stop in seconds. Where the line has a path,
+// @Description	each stop also has its distance from the first stop along the direction's path as valid at that
+// @Description	time, and its projection onto the path as [latitude, longitude].
+// @Tags			routes
+// @Produce		json
+// @Param			lineId	path	int					true	"Unique identifier of the bus line"
+// @Param			dirId	path	int					true	"Direction of the line"
+// @Param			at		query	string				false	"RFC 3339 time whose day's timetable and path are used"
+// @Success		200		{array}	data.DirectionStop	"Stops in calling order"
+// @Router			/routes/{lineId}/directions/{dirId}/stops [get]
+// @Security		ApiKeyAuth
+func (app *app) getDirectionStopsHandler(w http.ResponseWriter, r *http.Request) {
+	lineID, err := readIDParam(r, "lineId")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	directionID, err := readIDParam(r, "dirId")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	at, err := readAtQuery(r)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	ctx := r.Context()
+
+	stops, err := app.store.Routes.ReadDirectionStops(ctx, data.DirectionStopsQuery{
+		LineID:      lineID,
+		DirectionID: directionID,
+		Date:        at.In(time.Local),
+	})
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	route, err := app.store.Routes.ReadRoute(ctx, lineID, data.RouteQuery{DirectionID: int(directionID), At: at})
+	switch {
+	case err == nil:
+		data.ProjectStops(route.Path, stops)
+	case !errors.Is(err, data.ErrNotFound):
+		app.errorResponse(w, r, err)
 		return
 	}
 
+	if err := utils.WriteJSONResponse(w, http.StatusOK, stops); err != nil {
+		app.internalServerError(w, r, err)
+	}
 }
 
 // @Summary		Get all stations along a specific bus route
@@ -69,27 +212,25 @@ func (app *app) getRouteOfLineHandler(w http.ResponseWriter, r *http.Request) {
 // @Param			lineId	path	int			true	"Unique identifier of the bus line"
 // @Success		200		{array}	data.Stop	"Ordered list of stations with detailed information"
 // @Router			/routes/stations/{lineId} [get]
+// @Security		ApiKeyAuth
 func (app *app) getStationsOnRouteHandler(w http.ResponseWriter, r *http.Request) {
-	idParam := chi.URLParam(r, "lineId")
-	lineId, err := strconv.ParseInt(idParam, 10, 64)
-
+	lineId, err := readIDParam(r, "lineId")
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.errorResponse(w, r, err)
 		return
 	}
 
 	ctx := r.Context()
 
-	//log.Printf("sem tu notri")
 	route, err := app.store.Routes.ReadRouteStations(ctx, lineId)
 
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.errorResponse(w, r, err)
 		return
 	}
 
 	if err := utils.WriteJSONResponse(w, http.StatusOK, route); err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.internalServerError(w, r, err)
 		return
 	}
 
@@ -100,25 +241,33 @@ func (app *app) getStationsOnRouteHandler(w http.ResponseWriter, r *http.Request
 // @Description	Each route entry contains basic information such as route number, name, terminal stations,
 // @Description	service frequency, operating hours, and current status.
 // @Description	This endpoint is useful for displaying the complete network coverage and available services.
+// @Description	With Accept: application/geo+json (or ?format=geojson) it returns a GeoJSON FeatureCollection of LineStrings.
 // @Tags			routes
 // @Accept			json
-// @Produce		json
+// @Produce		json,application/geo+json
 // @Success		200	{array}	data.Route	"List of all routes with basic information"
 // @Router			/routes/list [get]
+// @Security		ApiKeyAuth
 func (app *app) routesListHandler(w http.ResponseWriter, r *http.Request) {
 	var routes []data.Route
 	ctx := r.Context()
 
-	//log.Printf("sem tu notri")
 	routes, err := app.store.Routes.ReadRoutesList(ctx)
 
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	if negotiateGeoJSON(w, r) {
+		if err := writeGeoJSON(w, http.StatusOK, routeFeatures(routes)); err != nil {
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
 
 	if err := utils.WriteJSONResponse(w, http.StatusOK, routes); err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.internalServerError(w, r, err)
 		return
 	}
 
@@ -134,6 +283,7 @@ func (app *app) routesListHandler(w http.ResponseWriter, r *http.Request) {
 // @Produce		json
 // @Success		101	{string}	string	"Switching protocols to WebSocket"
 // @Router			/routes/realtime [get]
+// @Security		ApiKeyAuth
 func (app *app) getRealtimeLine(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -182,6 +332,7 @@ func (app *app) getRealtimeLine(w http.ResponseWriter, r *http.Request) {
 // @Produce		json
 // @Success		200	{integer}	int	"Number of active routes"
 // @Router			/routes/active [get]
+// @Security		ApiKeyAuth
 func (app *app) getActiveRoutes(w http.ResponseWriter, r *http.Request) {
 	var activeRoutes int
 	ctx := r.Context()
@@ -189,13 +340,12 @@ func (app *app) getActiveRoutes(w http.ResponseWriter, r *http.Request) {
 	activeRoutes, err := app.store.Routes.ReadActiveLines(ctx)
 
 	if err != nil {
-		//fmt.Print("tu notri lol")
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.errorResponse(w, r, err)
 		return
 	}
 
 	if err := utils.WriteJSONResponse(w, http.StatusOK, activeRoutes); err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.internalServerError(w, r, err)
 		return
 	}
 }
@@ -205,16 +355,21 @@ func (app *app) getActiveRoutes(w http.ResponseWriter, r *http.Request) {
 // @Description	The simulation includes realistic bus movements along the route, considering schedules,
 // @Description	typical speeds, and stop times. Updates are sent every 2 seconds with precise coordinates
 // @Description	and movement patterns. This endpoint is useful for testing and demonstration purposes.
+// @Description	With ?format=geojson (or Accept: application/geo+json) each update is a GeoJSON FeatureCollection of points.
 // @Tags			routes
 // @Accept			json
 // @Produce		json
 // @Param			lineId	path		int		true	"Unique identifier of the bus line to simulate"
+// @Param			format	query		string	false	"geojson for GeoJSON updates"
 // @Success		101		{string}	string	"Switching protocols to WebSocket"
 // @Router			/estimate/simulate/{lineId} [get]
+// @Security		ApiKeyAuth
 func (app *app) serveRealtimeLine(w http.ResponseWriter, r *http.Request) {
+	logger := app.requestLogger(r)
+
 	conn, err := wsUpgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println("websocket upgrade error:", err)
+		logger.Warnw("websocket upgrade failed", "error", err)
 		return
 	}
 	defer conn.Close()
@@ -222,7 +377,7 @@ func (app *app) serveRealtimeLine(w http.ResponseWriter, r *http.Request) {
 	lineIDStr := chi.URLParam(r, "lineId")
 	lineID, err := strconv.Atoi(lineIDStr)
 	if err != nil {
-		log.Println("invalid line ID:", err)
+		logger.Infow("invalid line ID", "line_id", lineIDStr)
 		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "invalid line ID"))
 		return
 	}
@@ -231,36 +386,49 @@ func (app *app) serveRealtimeLine(w http.ResponseWriter, r *http.Request) {
 
 	runs, err := app.store.Routes.FetchActiveRuns(ctx, lineID)
 	if err != nil {
-		log.Println("database error on initial fetch:", err)
+		logger.Errorw("fetching active runs failed", "line_id", lineID, "error", err)
 		return
 	}
 	if len(runs) == 0 {
-		log.Println("no active runs found for line", lineID)
+		logger.Infow("no active runs found", "line_id", lineID)
+		return
+	}
+
+	shutdown, ok := app.drain.track()
+	if !ok {
+		closeGoingAway(conn)
 		return
 	}
+	defer app.drain.release()
+
+	// Only a line with active runs gets a series, so clients cannot grow
+	// the gauge with made-up line IDs; it is dropped again once the last
+	// viewer leaves.
+	lineLabel := strconv.Itoa(lineID)
+	wsActiveConnections.Acquire(lineLabel)
+	defer wsActiveConnections.Release(lineLabel)
+
+	asGeoJSON := wantsGeoJSON(r)
 
 	ticker := time.NewTicker(500 * time.Millisecond)
 	defer ticker.Stop()
 
-	log.Printf("Starting simulation for line %d with %d runs", lineID, len(runs))
+	logger.Infow("starting simulation", "line_id", lineID, "runs", len(runs))
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case <-shutdown:
+			if err := closeGoingAway(conn); err != nil {
+				logger.Infow("websocket close failed", "line_id", lineID, "error", err)
+			}
+			return
 		case <-ticker.C:
 			now := time.Now()
 			nowSec := now.Hour()*3600 + now.Minute()*60 + now.Second()
 
-			type BusPosition struct {
-				DepartureID int     `json:"departure_id"`
-				DirectionID int     `json:"direction_id"`
-				Lat         float64 `json:"lat"`
-				Lon         float64 `json:"lon"`
-				Status      string  `json:"status"`
-			}
-
-			var payload []BusPosition
+			var payload []busPosition
 
 			for _, run := range runs {
 				lat, lon := interpPosition(run, nowSec)
@@ -270,7 +438,7 @@ func (app *app) serveRealtimeLine(w http.ResponseWriter, r *http.Request) {
 				} else if nowSec > run.EndSec {
 					status = "completed"
 				}
-				payload = append(payload, BusPosition{
+				payload = append(payload, busPosition{
 					DepartureID: run.DepartureID,
 					DirectionID: run.DirectionID,
 					Lat:         lat,
@@ -279,14 +447,29 @@ func (app *app) serveRealtimeLine(w http.ResponseWriter, r *http.Request) {
 				})
 			}
 
-			if err := conn.WriteJSON(payload); err != nil {
-				log.Println("websocket write error:", err)
+			var message any = payload
+			if asGeoJSON {
+				message = vehicleFeatures(payload)
+			}
+
+			if err := conn.WriteJSON(message); err != nil {
+				logger.Infow("websocket write failed, closing", "line_id", lineID, "error", err)
 				return
 			}
+			simulationTickDuration.Observe(time.Since(now).Seconds())
 		}
 	}
 }
 
+// busPosition is a simulated bus in a realtime snapshot.
+type busPosition struct {
+	DepartureID int     `json:"departure_id"`
+	DirectionID int     `json:"direction_id"`
+	Lat         float64 `json:"lat"`
+	Lon         float64 `json:"lon"`
+	Status      string  `json:"status"`
+}
+
 func interpPosition(run data.ActiveRun, nowSec int) (float64, float64) {
 	if nowSec <= run.StartSec {
 		return run.Path[0][0], run.Path[0][1]
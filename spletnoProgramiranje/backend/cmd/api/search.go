@@ -0,0 +1,188 @@
+package main
+
+import (
+	"backend/cmd/utils"
+	"backend/internal/data"
+	"backend/internal/search"
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// stopIndexTTL is how long a search index is used before it is built
+	// again, so timetable edits show up without a restart.
+	stopIndexTTL = 5 * time.Minute
+	// stopIndexBuildTimeout bounds building the index, which searches
+	// waiting for it share.
+	stopIndexBuildTimeout = 30 * time.Second
+
+	stopSearchLimit    = 10
+	stopSearchMaxLimit = 50
+	stopSearchMaxQuery = 100
+)
+
+// stopIndexCache keeps the stop search index, built from the store on the
+// first search after it expires.
+type stopIndexCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	index   *search.Index
+	expires time.Time
+}
+
+func newStopIndexCache(ttl time.Duration) *stopIndexCache {
+	return &stopIndexCache{ttl: ttl}
+}
+
+// get returns the index, building it with build when there is none or it
+// has expired. Searches wait for a build in progress rather than each
+// starting their own.
+func (c *stopIndexCache) get(now time.Time, build func() (*search.Index, error)) (*search.Index, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.index != nil && now.Before(c.expires) {
+		return c.index, nil
+	}
+
+	index, err := build()
+	if err != nil {
+		return nil, err
+	}
+	c.index, c.expires = index, now.Add(c.ttl)
+
+	return index, nil
+}
+
+// buildStopIndex indexes every stop, with today's departures as its
+// popularity.
+func (app *app) buildStopIndex(ctx context.Context) (*search.Index, error) {
+	stops, err := app.store.Stations.ReadList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	times, err := app.store.Stations.ReadStopTimes(ctx, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	departures := make(map[int]int, len(stops))
+	for _, st := range times {
+		departures[st.StopID] += len(st.Seconds)
+	}
+
+	return search.NewIndex(stops, departures), nil
+}
+
+// stopSearchResult is the stops of one name matching a search.
+type stopSearchResult struct {
+	Name string `json:"name"`
+	// Stops are the poles sharing the name, one per direction or
+	// platform, by number.
+	Stops []data.Stop `json:"stops"`
+	// Departures is how many departures the stops have today together.
+	Departures int `json:"departures"`
+	// DistanceMeters is to the nearest of the stops, when the search has a
+	// position.
+	DistanceMeters *float64 `json:"distance_meters,omitempty"`
+}
+
+// readStopSearch reads the query parameters of a stop search.
+func readStopSearch(r *http.Request) (search.Query, error) {
+	values := r.URL.Query()
+	q := search.Query{Text: strings.TrimSpace(values.Get("q")), Limit: stopSearchLimit}
+
+	if q.Text == "" {
+		return q, data.NewValidationError("q", "required", "must not be empty")
+	}
+	if len(q.Text) > stopSearchMaxQuery {
+		return q, data.NewValidationError("q", "too_long", "must be at most "+strconv.Itoa(stopSearchMaxQuery)+" bytes long")
+	}
+	if len(search.Words(q.Text)) == 0 {
+		return q, data.NewValidationError("q", "invalid", "must contain letters or digits")
+	}
+
+	lat, lon := values.Get("latitude"), values.Get("longitude")
+	if lat != "" || lon != "" {
+		for _, p := range []struct {
+			name, value string
+			limit       float64
+			dst         *float64
+		}{{"latitude", lat, 90, &q.Lat}, {"longitude", lon, 180, &q.Lon}} {
+			if p.value == "" {
+				return q, data.NewValidationError(p.name, "required", "latitude and longitude go together")
+			}
+			v, err := strconv.ParseFloat(p.value, 64)
+			if err != nil || math.Abs(v) > p.limit {
+				return q, data.NewValidationError(p.name, "invalid", "must be a number between -"+strconv.Itoa(int(p.limit))+" and "+strconv.Itoa(int(p.limit)))
+			}
+			*p.dst = v
+		}
+		q.Located = true
+	}
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > stopSearchMaxLimit {
+			return q, data.NewValidationError("limit", "out_of_range", "must be between 1 and "+strconv.Itoa(stopSearchMaxLimit))
+		}
+		q.Limit = limit
+	}
+
+	return q, nil
+}
+
+// @Summary		Search stops by name
+// @Description	Finds stops whose name matches q as riders type it: without diacritics ("crna" finds "Črna"),
+// @Description	with a typo or two in longer words, and matching the start of words so results come in while
+// @Description	typing. Digits also match the start of stop numbers. Stops sharing a name, one pole per
+// @Description	direction or platform, come as one result. Results are ranked by how well the name matches,
+// @Description	then by how many departures the stops have today and, with latitude and longitude, how near
+// @Description	they are.
+// @Tags			stations
+// @Produce		json
+// @Param			q			query	string				true	"What the rider typed"
+// @Param			latitude	query	number				false	"Where the rider is, to rank nearer stops higher"
+// @Param			longitude	query	number				false	"Where the rider is, to rank nearer stops higher"
+// @Param			limit		query	int					false	"Most results, 1 to 50; 10 by default"
+// @Success		200			{array}	stopSearchResult	"Matching stops grouped by name, best first"
+// @Router			/stations/search [get]
+// @Security		ApiKeyAuth
+func (app *app) searchStationsHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := readStopSearch(r)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	index, err := app.stopIndex.get(time.Now(), func() (*search.Index, error) {
+		// The index is shared, so a client hanging up must not cancel the
+		// build the other searches are waiting for.
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), stopIndexBuildTimeout)
+		defer cancel()
+		return app.buildStopIndex(ctx)
+	})
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	results := []stopSearchResult{}
+	for _, res := range index.Search(q) {
+		result := stopSearchResult{Name: res.Name, Stops: res.Stops, Departures: res.Departures}
+		if q.Located {
+			distance := math.Round(res.DistanceMeters)
+			result.DistanceMeters = &distance
+		}
+		results = append(results, result)
+	}
+
+	if err := utils.WriteJSONResponse(w, http.StatusOK, results); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
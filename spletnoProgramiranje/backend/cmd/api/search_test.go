@@ -0,0 +1,139 @@
+package main
+
+import (
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockSearchStore serves two poles of Črna pri Kamniku and one of Center,
+// and counts the reads.
+func mockSearchStore(app *app) (reads *int) {
+	reads = new(int)
+	mock := app.store.Stations.(*MockStationsStorage)
+	mock.ReadListFunc = func(ctx context.Context) ([]data.Stop, error) {
+		*reads++
+		return []data.Stop{
+			{ID: 1, Number: "003", Name: "Center", Latitude: 46.5577, Longitude: 15.6455},
+			{ID: 2, Number: "012", Name: "Črna pri Kamniku", Latitude: 46.3000, Longitude: 14.6000},
+			{ID: 3, Number: "011", Name: "Črna pri Kamniku", Latitude: 46.3001, Longitude: 14.6002},
+		}, nil
+	}
+	mock.ReadStopTimesFunc = func(ctx context.Context, date time.Time) ([]data.StopTimes, error) {
+		*reads++
+		return []data.StopTimes{
+			{StopID: 2, LineID: 1, DirectionID: 1, Seconds: []int{8 * 3600, 9 * 3600}},
+			{StopID: 3, LineID: 1, DirectionID: 2, Seconds: []int{10 * 3600}},
+		}, nil
+	}
+	return reads
+}
+
+type searchResponse struct {
+	Data []struct {
+		Name  string `json:"name"`
+		Stops []struct {
+			ID     int    `json:"id"`
+			Number string `json:"number"`
+		} `json:"stops"`
+		Departures     int      `json:"departures"`
+		DistanceMeters *float64 `json:"distance_meters"`
+	} `json:"data"`
+}
+
+func TestSearchStations(t *testing.T) {
+	app := setupTestApp()
+	reads := mockSearchStore(app)
+	mux := app.mount()
+
+	req, w := createTestRequest("GET", "/v1/stations/search?q=crna+pri", nil)
+	mux.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var res searchResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+
+	require.Len(t, res.Data, 1)
+	assert.Equal(t, "Črna pri Kamniku", res.Data[0].Name)
+	require.Len(t, res.Data[0].Stops, 2)
+	assert.Equal(t, "011", res.Data[0].Stops[0].Number)
+	assert.Equal(t, "012", res.Data[0].Stops[1].Number)
+	assert.Equal(t, 3, res.Data[0].Departures)
+	assert.Nil(t, res.Data[0].DistanceMeters)
+
+	req, w = createTestRequest("GET", "/v1/stations/search?q=cetner&latitude=46.5577&longitude=15.6455", nil)
+	mux.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	res = searchResponse{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+
+	require.Len(t, res.Data, 1, "one typo is forgiven")
+	assert.Equal(t, "Center", res.Data[0].Name)
+	require.NotNil(t, res.Data[0].DistanceMeters)
+	assert.Equal(t, float64(0), *res.Data[0].DistanceMeters)
+	assert.Equal(t, 2, *reads, "the index is built once")
+}
+
+func TestSearchStationsIndexOutlivesClient(t *testing.T) {
+	app := setupTestApp()
+	mockSearchStore(app)
+	app.store.Stations.(*MockStationsStorage).ReadStopTimesFunc = func(ctx context.Context, date time.Time) ([]data.StopTimes, error) {
+		return []data.StopTimes{}, ctx.Err()
+	}
+	mux := app.mount()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, w := createTestRequest("GET", "/v1/stations/search?q=center", nil)
+	mux.ServeHTTP(w, req.WithContext(ctx))
+
+	require.Equal(t, http.StatusOK, w.Code, "the first client hung up, but the index is built for the rest")
+
+	req, w = createTestRequest("GET", "/v1/stations/search?q=center", nil)
+	mux.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func TestSearchStationsNoMatch(t *testing.T) {
+	app := setupTestApp()
+	mockSearchStore(app)
+
+	req, w := createTestRequest("GET", "/v1/stations/search?q=tezno", nil)
+	app.mount().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"data":[]}`, w.Body.String())
+}
+
+func TestSearchStationsValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		field string
+	}{
+		{"no query", "", "q"},
+		{"only punctuation", "q=-+.", "q"},
+		{"latitude alone", "q=center&latitude=46.5", "longitude"},
+		{"latitude out of range", "q=center&latitude=95&longitude=15", "latitude"},
+		{"limit too high", "q=center&limit=51", "limit"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := setupTestApp()
+
+			req, w := createTestRequest("GET", "/v1/stations/search?"+tt.query, nil)
+			app.mount().ServeHTTP(w, req)
+
+			require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+			assert.Contains(t, w.Body.String(), `"field":"`+tt.field+`"`)
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"backend/cmd/utils"
+	"backend/internal/data"
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// activeServiceAlerts returns the service alerts in effect now that match
+// the filter.
+func (app *app) activeServiceAlerts(ctx context.Context, f data.ServiceAlertFilter) ([]data.ServiceAlert, error) {
+	f.ActiveAt = time.Now()
+	return app.store.ServiceAlerts.List(ctx, f)
+}
+
+// isLanguageCode accepts two or three lowercase letters, such as "sl" or
+// "en".
+func isLanguageCode(code string) bool {
+	if len(code) < 2 || len(code) > 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'a' || r > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+func checkTranslations(field string, t data.Translations, maxLen int) error {
+	for lang, text := range t {
+		if !isLanguageCode(lang) {
+			return data.NewValidationError(field, "invalid_language", "keys must be language codes such as sl or en")
+		}
+		if text == "" || len(text) > maxLen {
+			return data.NewValidationError(field+"."+lang, "invalid_length", "must be between 1 and "+strconv.Itoa(maxLen)+" bytes long")
+		}
+	}
+	return nil
+}
+
+// readServiceAlert reads and validates a service alert.
+func (app *app) readServiceAlert(w http.ResponseWriter, r *http.Request) (*data.ServiceAlert, error) {
+	var payload data.ServiceAlertPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		return nil, err
+	}
+
+	if payload.Header[data.DefaultLanguage] == "" {
+		return nil, data.NewValidationError("header", "required", "a header in "+data.DefaultLanguage+" is required")
+	}
+	if err := checkTranslations("header", payload.Header, 200); err != nil {
+		return nil, err
+	}
+	if err := checkTranslations("description", payload.Description, 4000); err != nil {
+		return nil, err
+	}
+	if payload.URL != "" {
+		if u, err := url.Parse(payload.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, data.NewValidationError("url", "invalid_url", "must be an http or https URL")
+		}
+	}
+	if payload.ActiveUntil != nil && !payload.ActiveUntil.After(payload.ActiveFrom) {
+		return nil, data.NewValidationError("active_until", "empty_window", "must be after active_from")
+	}
+
+	entities := make([]data.ServiceAlertEntity, 0, len(payload.Entities))
+	for i, e := range payload.Entities {
+		field := "entities." + strconv.Itoa(i)
+		if e.LineID == nil && e.DirectionID == nil && e.StopID == nil {
+			return nil, data.NewValidationError(field, "required", "line_id, direction_id or stop_id is required")
+		}
+		for _, id := range []*int{e.LineID, e.DirectionID, e.StopID} {
+			if id != nil && *id < 1 {
+				return nil, data.NewValidationError(field, "too_small", "ids must be at least 1")
+			}
+		}
+		entities = append(entities, data.ServiceAlertEntity{LineID: e.LineID, DirectionID: e.DirectionID, StopID: e.StopID})
+	}
+
+	if len(payload.Detour) > 0 {
+		if payload.Effect != data.EffectDetour {
+			return nil, data.NewValidationError("detour", "not_allowed", "only alerts with the detour effect have a detour")
+		}
+		if err := checkPath("detour", payload.Detour); err != nil {
+			return nil, err
+		}
+	}
+
+	return &data.ServiceAlert{
+		Cause:       payload.Cause,
+		Effect:      payload.Effect,
+		Header:      payload.Header,
+		Description: payload.Description,
+		URL:         payload.URL,
+		ActiveFrom:  payload.ActiveFrom,
+		ActiveUntil: payload.ActiveUntil,
+		Entities:    entities,
+		Detour:      payload.Detour,
+	}, nil
+}
+
+// readServiceAlertFilter reads the optional line_id and stop_id query
+// parameters.
+func readServiceAlertFilter(r *http.Request) (data.ServiceAlertFilter, error) {
+	var f data.ServiceAlertFilter
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{{"line_id", &f.LineID}, {"stop_id", &f.StopID}} {
+		v := r.URL.Query().Get(p.name)
+		if v == "" {
+			continue
+		}
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 1 {
+			return f, data.NewValidationError(p.name, "invalid_id", "must be a positive integer")
+		}
+		*p.dst = id
+	}
+	return f, nil
+}
+
+// @Summary		List service alerts in effect
+// @Description	Returns the service alerts in effect now, such as stop closures and detours, latest first.
+// @Description	line_id keeps the alerts about the line, its directions or its stops; stop_id keeps the
+// @Description	alerts about the stop or the lines serving it. Header and description map language codes
+// @Description	to text and always have Slovenian (sl).
+// @Tags			service-alerts
+// @Produce		json
+// @Param			line_id	query	int					false	"Line ID"
+// @Param			stop_id	query	int					false	"Stop ID"
+// @Success		200		{array}	data.ServiceAlert	"Service alerts"
+// @Router			/service-alerts [get]
+// @Security		ApiKeyAuth
+func (app *app) listActiveServiceAlertsHandler(w http.ResponseWriter, r *http.Request) {
+	f, err := readServiceAlertFilter(r)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	alerts, err := app.activeServiceAlerts(r.Context(), f)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, alerts)
+}
+
+// @Summary		List all service alerts
+// @Description	Returns every service alert, including planned and expired ones, latest first. Admins only.
+// @Tags			admin
+// @Produce		json
+// @Param			line_id	query	int					false	"Line ID"
+// @Param			stop_id	query	int					false	"Stop ID"
+// @Success		200		{array}	data.ServiceAlert	"Service alerts"
+// @Router			/admin/service-alerts [get]
+// @Security		ApiKeyAuth
+func (app *app) listServiceAlertsHandler(w http.ResponseWriter, r *http.Request) {
+	f, err := readServiceAlertFilter(r)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	alerts, err := app.store.ServiceAlerts.List(r.Context(), f)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, alerts)
+}
+
+// @Summary		Get a service alert
+// @Tags			admin
+// @Produce		json
+// @Param			alertId	path		int					true	"Service alert ID"
+// @Success		200		{object}	data.ServiceAlert	"The service alert"
+// @Router			/admin/service-alerts/{alertId} [get]
+// @Security		ApiKeyAuth
+func (app *app) getServiceAlertHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r, "alertId")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	alert, err := app.store.ServiceAlerts.Get(r.Context(), id)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, alert)
+}
+
+// @Summary		Create a service alert
+// @Description	Announces a change to service on lines, directions or stops between active_from and
+// @Description	active_until (open-ended when unset). An entity with only a stop_id affects every line at
+// @Description	the stop; with the no_service effect it closes the stop, and the journey planner avoids it.
+// @Description	Detour alerts may carry the diverted path as [latitude, longitude] pairs. Admins only.
+// @Tags			admin
+// @Accept			json
+// @Produce		json
+// @Param			alert	body		data.ServiceAlertPayload	true	"The service alert"
+// @Success		201		{object}	data.ServiceAlert			"The created service alert"
+// @Router			/admin/service-alerts [post]
+// @Security		ApiKeyAuth
+func (app *app) createServiceAlertHandler(w http.ResponseWriter, r *http.Request) {
+	alert, err := app.readServiceAlert(w, r)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	err = app.store.WithTx(ctx, func(tx data.Storage) error {
+		return tx.ServiceAlerts.Create(ctx, alert)
+	})
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusCreated, alert)
+}
+
+// @Summary		Update a service alert
+// @Description	Replaces the service alert, including its entities. Admins only.
+// @Tags			admin
+// @Accept			json
+// @Produce		json
+// @Param			alertId	path		int							true	"Service alert ID"
+// @Param			alert	body		data.ServiceAlertPayload	true	"The service alert"
+// @Success		200		{object}	data.ServiceAlert			"The updated service alert"
+// @Router			/admin/service-alerts/{alertId} [put]
+// @Security		ApiKeyAuth
+func (app *app) updateServiceAlertHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r, "alertId")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	alert, err := app.readServiceAlert(w, r)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	alert.ID = id
+
+	ctx := r.Context()
+	err = app.store.WithTx(ctx, func(tx data.Storage) error {
+		return tx.ServiceAlerts.Update(ctx, alert)
+	})
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, alert)
+}
+
+// @Summary		Delete a service alert
+// @Description	Deletes the service alert. To end an alert early but keep it on record, update its
+// @Description	active_until instead. Admins only.
+// @Tags			admin
+// @Param			alertId	path	int	true	"Service alert ID"
+// @Success		204
+// @Router			/admin/service-alerts/{alertId} [delete]
+// @Security		ApiKeyAuth
+func (app *app) deleteServiceAlertHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r, "alertId")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.ServiceAlerts.Delete(r.Context(), id); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
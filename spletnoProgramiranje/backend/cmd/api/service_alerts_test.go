@@ -0,0 +1,155 @@
+package main
+
+import (
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func validServiceAlert() map[string]any {
+	return map[string]any{
+		"cause":       data.CauseConstruction,
+		"effect":      data.EffectDetour,
+		"header":      map[string]string{"sl": "Linija 3 obvoz", "en": "Line 3 diverted"},
+		"description": map[string]string{"sl": "Glavni trg je zaprt."},
+		"active_from": "2026-10-24T05:00:00+02:00",
+		"entities":    []map[string]any{{"line_id": 3}, {"stop_id": 7}},
+		"detour":      [][]float64{{46.5577, 15.6455}, {46.5620, 15.6567}},
+	}
+}
+
+func TestCreateServiceAlert(t *testing.T) {
+	app := setupTestApp()
+
+	var created data.ServiceAlert
+	app.store.ServiceAlerts.(*MockServiceAlertsStorage).CreateFunc = func(ctx context.Context, a *data.ServiceAlert) error {
+		created = *a
+		a.ID = 4
+		return nil
+	}
+
+	req, w := adminRequest(t, app, data.RoleAdmin, "POST", "/v1/admin/service-alerts", validServiceAlert())
+	app.mount().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Equal(t, data.EffectDetour, created.Effect)
+	assert.Equal(t, "Line 3 diverted", created.Header["en"])
+	require.Len(t, created.Entities, 2)
+	assert.Equal(t, 3, *created.Entities[0].LineID)
+	assert.Equal(t, 7, *created.Entities[1].StopID)
+	assert.Len(t, created.Detour, 2)
+	assert.Nil(t, created.ActiveUntil)
+}
+
+func TestCreateServiceAlertRequiresAdmin(t *testing.T) {
+	app := setupTestApp()
+
+	req, w := adminRequest(t, app, data.RoleUser, "POST", "/v1/admin/service-alerts", validServiceAlert())
+	app.mount().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestCreateServiceAlertValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(map[string]any)
+		field  string
+	}{
+		{"unknown effect", func(p map[string]any) { p["effect"] = "closed" }, "effect"},
+		{"no slovenian header", func(p map[string]any) { p["header"] = map[string]string{"en": "Line 3 diverted"} }, "header"},
+		{"invalid language", func(p map[string]any) { p["header"] = map[string]string{"sl": "Obvoz", "English": "Detour"} }, "header"},
+		{"no entities", func(p map[string]any) { p["entities"] = []map[string]any{} }, "entities"},
+		{"empty entity", func(p map[string]any) { p["entities"] = []map[string]any{{}} }, "entities.0"},
+		{"window ends before it starts", func(p map[string]any) { p["active_until"] = "2026-10-24T04:00:00+02:00" }, "active_until"},
+		{"detour without the detour effect", func(p map[string]any) { p["effect"] = data.EffectNoService }, "detour"},
+		{"detour point out of range", func(p map[string]any) { p["detour"] = [][]float64{{46.5, 15.6}, {146.5, 15.6}} }, "detour"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := setupTestApp()
+			payload := validServiceAlert()
+			tt.modify(payload)
+
+			req, w := adminRequest(t, app, data.RoleAdmin, "POST", "/v1/admin/service-alerts", payload)
+			app.mount().ServeHTTP(w, req)
+
+			require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+			assert.Contains(t, w.Body.String(), `"field":"`+tt.field+`"`)
+		})
+	}
+}
+
+func TestStationMetadataListsServiceAlerts(t *testing.T) {
+	app := setupTestApp()
+	app.store.Stations.(*MockStationsStorage).ReadStationMetadataFunc = func(ctx context.Context, id int64) (*data.StopMetadata, error) {
+		return &data.StopMetadata{ID: id, Name: "Glavni trg"}, nil
+	}
+
+	var filter data.ServiceAlertFilter
+	app.store.ServiceAlerts.(*MockServiceAlertsStorage).ListFunc = func(ctx context.Context, f data.ServiceAlertFilter) ([]data.ServiceAlert, error) {
+		filter = f
+		return []data.ServiceAlert{{ID: 1, Effect: data.EffectNoService, Header: data.Translations{"sl": "Zaprto"}}}, nil
+	}
+
+	req, w := createTestRequest("GET", "/v1/stations/7", nil)
+	req = setupChiContext(req, map[string]string{"stationId": "7"})
+	app.getStationMetadataHandler(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 7, filter.StopID)
+	assert.WithinDuration(t, time.Now(), filter.ActiveAt, time.Minute, "only alerts in effect now")
+
+	var res struct {
+		Data data.StopMetadata `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	require.Len(t, res.Data.Alerts, 1)
+	assert.Equal(t, "Zaprto", res.Data.Alerts[0].Header["sl"])
+}
+
+func TestShortestPathAvoidsClosedStops(t *testing.T) {
+	app := setupTestApp()
+	mockStationStops(app)
+	closed := 7
+	app.store.ServiceAlerts.(*MockServiceAlertsStorage).ListFunc = func(ctx context.Context, f data.ServiceAlertFilter) ([]data.ServiceAlert, error) {
+		if f.StopID != 0 {
+			return []data.ServiceAlert{}, nil
+		}
+		return []data.ServiceAlert{{
+			ID: 1, Effect: data.EffectNoService,
+			Entities: []data.ServiceAlertEntity{{StopID: &closed}},
+		}}, nil
+	}
+
+	var avoided []int
+	mock := app.store.Stations.(*MockStationsStorage)
+	mock.ReadThreeStationsAtDestinationFunc = func(ctx context.Context, p *data.PathLocation) ([]data.Stop, error) {
+		avoided = p.AvoidStopIDs
+		return []data.Stop{{ID: 1}}, nil
+	}
+	mock.ReadStationLinesFunc = func(ctx context.Context, stops []data.Stop) ([]data.Line, error) {
+		return []data.Line{}, nil
+	}
+	mock.ReadThreeStationsAtLocationFunc = func(ctx context.Context, p *data.PathLocation, lines []data.Line) ([]data.Stop, error) {
+		return []data.Stop{{ID: 2}}, nil
+	}
+
+	req, w := createTestRequest("POST", "/v1/show/shortest", map[string]any{
+		"destination_latitude":  46.5577,
+		"destination_longitude": 15.6455,
+		"location_latitude":     46.5620,
+		"location_longitude":    15.6567,
+	})
+	app.getShortestPath(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []int{closed}, avoided)
+}
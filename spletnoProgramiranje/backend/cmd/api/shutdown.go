@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// drain coordinates graceful shutdown with long-lived streams.
+// http.Server.Shutdown does not wait for WebSocket connections because they
+// are hijacked, so every stream registers here, watches the channel returned
+// by track and says goodbye with a close frame once shutdown begins. The zero
+// value is ready to use.
+type drain struct {
+	mu       sync.Mutex
+	draining bool
+	done     chan struct{}
+	streams  sync.WaitGroup
+}
+
+// doneLocked returns the channel closed by begin. The caller holds d.mu.
+func (d *drain) doneLocked() chan struct{} {
+	if d.done == nil {
+		d.done = make(chan struct{})
+	}
+	return d.done
+}
+
+// track registers a stream, which must call release when it ends. It returns
+// false once shutdown has begun, so no new streams are accepted.
+func (d *drain) track() (<-chan struct{}, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.draining {
+		return nil, false
+	}
+	d.streams.Add(1)
+	return d.doneLocked(), true
+}
+
+func (d *drain) release() {
+	d.streams.Done()
+}
+
+// begin starts shutdown: readiness fails and streams are asked to close.
+func (d *drain) begin() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.draining {
+		d.draining = true
+		close(d.doneLocked())
+	}
+}
+
+func (d *drain) isDraining() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.draining
+}
+
+// wait blocks until every tracked stream has been released or ctx is done.
+func (d *drain) wait(ctx context.Context) error {
+	finished := make(chan struct{})
+	go func() {
+		d.streams.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// closeGoingAway tells a WebSocket client that the server is going away, so
+// it reconnects to another instance instead of treating the drop as an error.
+func closeGoingAway(conn *websocket.Conn) error {
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	return conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"backend/internal/data"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrainRejectsStreamsAfterBegin(t *testing.T) {
+	var d drain
+
+	done, ok := d.track()
+	require.True(t, ok)
+	assert.False(t, d.isDraining())
+
+	d.begin()
+	d.begin() // idempotent
+
+	select {
+	case <-done:
+	default:
+		t.Fatal("begin did not signal tracked streams")
+	}
+	assert.True(t, d.isDraining())
+
+	_, ok = d.track()
+	assert.False(t, ok, "no new streams once draining")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, d.wait(ctx), context.DeadlineExceeded, "a stream is still open")
+
+	d.release()
+	assert.NoError(t, d.wait(context.Background()))
+}
+
+func TestRealtimeStreamClosesOnShutdown(t *testing.T) {
+	app := setupTestApp()
+	app.store.Routes.(*MockRoutesStorage).FetchActiveRunsFunc = func(ctx context.Context, lineID int) ([]data.ActiveRun, error) {
+		return []data.ActiveRun{{
+			DepartureID: 1,
+			Path:        [][]float64{{46.55, 15.64}, {46.56, 15.65}},
+			StartSec:    0,
+			EndSec:      86400,
+		}}, nil
+	}
+
+	r := chi.NewRouter()
+	r.Get("/ws/{lineId}", app.serveRealtimeLine)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws/1", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// The first position proves the stream is tracked before shutdown begins.
+	var positions []map[string]any
+	require.NoError(t, conn.ReadJSON(&positions))
+
+	app.drain.begin()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err = conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), "got %v", err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, app.drain.wait(ctx))
+}
+
+func TestRunShutsDownWhenContextIsDone(t *testing.T) {
+	app := setupTestApp()
+	app.config.Addr = "127.0.0.1:0"
+	app.config.MetricsAddr = "127.0.0.1:0"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- app.run(ctx, app.mount()) }()
+
+	cancel()
+
+	select {
+	case err := <-result:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not return after the context was cancelled")
+	}
+	assert.True(t, app.drain.isDraining())
+}
+
+func TestRunFailsWhenAddressIsTaken(t *testing.T) {
+	server := httptest.NewServer(nil)
+	defer server.Close()
+
+	app := setupTestApp()
+	app.config.Addr = strings.TrimPrefix(server.URL, "http://")
+
+	assert.Error(t, app.run(context.Background(), app.mount()))
+}
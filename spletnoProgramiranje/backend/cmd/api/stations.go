@@ -3,11 +3,7 @@ package main
 import (
 	"backend/cmd/utils"
 	"backend/internal/data"
-	"encoding/json"
 	"net/http"
-	"strconv"
-
-	"github.com/go-chi/chi/v5"
 )
 
 //	@Summary		Retrieve a comprehensive list of all bus stations
@@ -15,25 +11,33 @@ import (
 //	@Description	its unique identifier, geographical coordinates (latitude and longitude), full name, description,
 //	@Description	current status, and any associated metadata such as nearby landmarks or accessibility features.
 //	@Description	This endpoint is useful for applications needing to display all available stations or create a station map.
+//	@Description	With Accept: application/geo+json (or ?format=geojson) it returns a GeoJSON FeatureCollection of points.
 //	@Tags			stations
 //	@Accept			json
-//	@Produce		json
+//	@Produce		json,application/geo+json
 //	@Success		200	{array}	data.Stop	"List of stations with their complete details"
 //	@Router			/stations [get]
+//	@Security		ApiKeyAuth
 func (app *app) stationsListHandler(w http.ResponseWriter, r *http.Request) {
 	var stops []data.Stop
 	ctx := r.Context()
 
-	//log.Printf("sem tu notri")
 	stops, err := app.store.Stations.ReadList(ctx)
 
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	if negotiateGeoJSON(w, r) {
+		if err := writeGeoJSON(w, http.StatusOK, stopFeatures(stops)); err != nil {
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
 
 	if err := utils.WriteJSONResponse(w, http.StatusOK, stops); err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.internalServerError(w, r, err)
 		return
 	}
 
@@ -51,27 +55,25 @@ func (app *app) stationsListHandler(w http.ResponseWriter, r *http.Request) {
 //	@Param			stationId	path		int			true	"Unique identifier of the bus station"
 //	@Success		200			{object}	data.Stop	"Complete station details including location and status"
 //	@Router			/stations/{stationId} [get]
+//	@Security		ApiKeyAuth
 func (app *app) getStationHandler(w http.ResponseWriter, r *http.Request) {
-	idParam := chi.URLParam(r, "stationId")
-	stationId, err := strconv.ParseInt(idParam, 10, 64)
-
+	stationId, err := readIDParam(r, "stationId")
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.errorResponse(w, r, err)
 		return
 	}
 
 	ctx := r.Context()
 
-	//log.Printf("sem tu notri")
 	stop, err := app.store.Stations.ReadStation(ctx, stationId)
 
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.errorResponse(w, r, err)
 		return
 	}
 
 	if err := utils.WriteJSONResponse(w, http.StatusOK, stop); err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.internalServerError(w, r, err)
 		return
 	}
 
@@ -84,18 +86,18 @@ func (app *app) getStationHandler(w http.ResponseWriter, r *http.Request) {
 //	@Description	accessibility features (wheelchair access, tactile paving), nearby points of interest,
 //	@Description	and any special notes about the station's operation or temporary changes.
 //	@Description	This data is particularly useful for journey planning and accessibility requirements.
+//	@Description	Service alerts in effect at the stop, such as closures, are listed under alerts.
 //	@Tags			stations
 //	@Accept			json
 //	@Produce		json
 //	@Param			stationId	path		int					true	"Unique identifier of the station to fetch metadata for"
 //	@Success		200			{object}	data.StopMetadata	"Comprehensive metadata including historical data and features"
 //	@Router			/stations/{stationId}/metadata [get]
+//	@Security		ApiKeyAuth
 func (app *app) getStationMetadataHandler(w http.ResponseWriter, r *http.Request) {
-	idParam := chi.URLParam(r, "stationId")
-	stationId, err := strconv.ParseInt(idParam, 10, 64)
-
+	stationId, err := readIDParam(r, "stationId")
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.errorResponse(w, r, err)
 		return
 	}
 
@@ -104,12 +106,18 @@ func (app *app) getStationMetadataHandler(w http.ResponseWriter, r *http.Request
 	stopMetadata, err := app.store.Stations.ReadStationMetadata(ctx, stationId)
 
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	stopMetadata.Alerts, err = app.activeServiceAlerts(ctx, data.ServiceAlertFilter{StopID: int(stationId)})
+	if err != nil {
+		app.errorResponse(w, r, err)
 		return
 	}
 
 	if err := utils.WriteJSONResponse(w, http.StatusOK, stopMetadata); err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.internalServerError(w, r, err)
 		return
 	}
 
@@ -122,25 +130,19 @@ func (app *app) getStationMetadataHandler(w http.ResponseWriter, r *http.Request
 //	@Description	Each station in the response includes distance from the search point, walking time estimates,
 //	@Description	and complete station details including real-time availability and accessibility information.
 //	@Description	This endpoint is crucial for mobile apps and location-based services.
+//	@Description	With Accept: application/geo+json (or ?format=geojson) it returns a GeoJSON FeatureCollection of points
+//	@Description	whose properties include distance_meters.
 //	@Tags			stations
 //	@Accept			json
-//	@Produce		json
+//	@Produce		json,application/geo+json
 //	@Param			location	body	data.Location	true	"JSON object containing latitude, longitude, and search radius in meters"
 //	@Success		200			{array}	data.Stop		"Array of nearby stations sorted by distance, with complete details"
 //	@Router			/stations/nearby [post]
+//	@Security		ApiKeyAuth
 func (app *app) getStationsCloseBy(w http.ResponseWriter, r *http.Request) {
-	if r.Body == nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, "No user data in request body")
-		return
-	}
-
 	var payload data.Location
-	err := json.NewDecoder(r.Body).Decode(&payload)
-
-	//fmt.Printf("Latitude: %f\nLongitude: %f\nRadius: %d\n", payload.Latitude, payload.Longitude, payload.Radius)
-
-	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+	if err := readJSON(w, r, &payload); err != nil {
+		app.errorResponse(w, r, err)
 		return
 	}
 
@@ -149,12 +151,19 @@ func (app *app) getStationsCloseBy(w http.ResponseWriter, r *http.Request) {
 	stops, err := app.store.Stations.ReadStationsCloseBy(ctx, &payload)
 
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	if negotiateGeoJSON(w, r) {
+		if err := writeGeoJSON(w, http.StatusOK, nearbyStopFeatures(stops, &payload)); err != nil {
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
 
 	if err := utils.WriteJSONResponse(w, http.StatusOK, stops); err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.internalServerError(w, r, err)
 		return
 	}
 
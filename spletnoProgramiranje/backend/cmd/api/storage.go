@@ -0,0 +1,36 @@
+package main
+
+import (
+	"backend/internal/data"
+	"backend/internal/data/memory"
+	"os"
+
+	"go.uber.org/zap"
+)
+
+// setupMemoryStorage builds the STORAGE=memory backend. Fixtures are read
+// from the fixturesDir directory when set, otherwise the embedded sample data
+// set is used.
+func setupMemoryStorage(fixturesDir string, logger *zap.SugaredLogger) (data.Storage, error) {
+	var (
+		fixtures *memory.Fixtures
+		err      error
+	)
+	if fixturesDir != "" {
+		fixtures, err = memory.LoadFixtures(os.DirFS(fixturesDir))
+	} else {
+		fixtures, err = memory.DefaultFixtures()
+	}
+	if err != nil {
+		return data.Storage{}, err
+	}
+
+	logger.Infow("using in-memory storage, changes are not persisted",
+		"fixtures", fixturesDir,
+		"stops", len(fixtures.Stops),
+		"routes", len(fixtures.Routes),
+		"users", len(fixtures.Users),
+	)
+
+	return memory.NewStorage(fixtures)
+}
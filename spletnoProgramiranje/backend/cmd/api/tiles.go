@@ -0,0 +1,281 @@
+package main
+
+import (
+	"backend/internal/data"
+	"backend/internal/mvt"
+	"container/list"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// tileStopsMinZoom is the zoom level from which tiles carry stops and
+	// delay heat; further out they would only clutter the map.
+	tileStopsMinZoom = 12
+	// tileBuffer is how far past its edges, in tile coordinates, a tile
+	// carries geometry so lines and symbols are not cut at the seams.
+	tileBuffer = 64
+	// tileDelayDays is how many calendar days of delay reports, today
+	// included, the delay heat covers.
+	tileDelayDays = 30
+
+	tileCacheSize = 2048
+	tileCacheTTL  = 5 * time.Minute
+)
+
+// tileLayers are the layers a tile can carry, and tileDefaultLayers the ones
+// it carries unless ?layers= asks for others.
+var (
+	tileLayers        = []string{"stops", "routes", "delays"}
+	tileDefaultLayers = []string{"stops", "routes"}
+)
+
+// tileCache keeps recently rendered tiles, evicting the least recently used
+// one when full. Tiles expire after ttl so timetable edits and new delay
+// reports show up without a restart.
+type tileCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type cachedTile struct {
+	key     string
+	tile    []byte
+	expires time.Time
+}
+
+func newTileCache(size int, ttl time.Duration) *tileCache {
+	return &tileCache{size: size, ttl: ttl, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (c *tileCache) get(key string, now time.Time) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*cachedTile)
+	if !now.Before(entry.expires) {
+		c.order.Remove(e)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+
+	return entry.tile, true
+}
+
+func (c *tileCache) put(key string, tile []byte, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		e.Value = &cachedTile{key: key, tile: tile, expires: now.Add(c.ttl)}
+		c.order.MoveToFront(e)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cachedTile{key: key, tile: tile, expires: now.Add(c.ttl)})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedTile).key)
+	}
+}
+
+// readTile reads the z, x and y path parameters of a tile URL.
+func readTile(r *http.Request) (mvt.Tile, error) {
+	var coords [3]int
+	for i, name := range []string{"z", "x", "y"} {
+		n, err := strconv.Atoi(chi.URLParam(r, name))
+		if err != nil {
+			return mvt.Tile{}, data.NewValidationError(name, "invalid", "must be an integer")
+		}
+		coords[i] = n
+	}
+
+	t := mvt.Tile{Z: coords[0], X: coords[1], Y: coords[2]}
+	if t.Z < 0 || t.Z > mvt.MaxZoom {
+		return mvt.Tile{}, data.NewValidationError("z", "out_of_range", fmt.Sprintf("must be between 0 and %d", mvt.MaxZoom))
+	}
+	if !t.Valid() {
+		name := "x"
+		if t.X >= 0 && t.X < 1<<t.Z {
+			name = "y"
+		}
+		return mvt.Tile{}, data.NewValidationError(name, "out_of_range", fmt.Sprintf("must be between 0 and %d at zoom %d", 1<<t.Z-1, t.Z))
+	}
+
+	return t, nil
+}
+
+// readTileLayers reads ?layers=, a comma-separated list of layer names, in
+// a fixed order so that equal requests share a cache entry.
+func readTileLayers(r *http.Request) ([]string, error) {
+	v := r.URL.Query().Get("layers")
+	if v == "" {
+		return tileDefaultLayers, nil
+	}
+
+	asked := strings.Split(v, ",")
+	for _, name := range asked {
+		if !slices.Contains(tileLayers, name) {
+			return nil, data.NewValidationError("layers", "invalid", "must be a list of "+strings.Join(tileLayers, ", "))
+		}
+	}
+
+	var layers []string
+	for _, name := range tileLayers {
+		if slices.Contains(asked, name) {
+			layers = append(layers, name)
+		}
+	}
+
+	return layers, nil
+}
+
+func tilePoint(x, y float64) mvt.Point {
+	return mvt.Point{X: int(math.Round(x)), Y: int(math.Round(y))}
+}
+
+// renderTile builds the tile's layers from the store.
+func (app *app) renderTile(r *http.Request, t mvt.Tile, layers []string) ([]byte, error) {
+	ctx := r.Context()
+	var encoded []*mvt.Layer
+
+	for _, name := range layers {
+		layer := mvt.NewLayer(name)
+
+		switch name {
+		case "stops":
+			if t.Z < tileStopsMinZoom {
+				continue
+			}
+			stops, err := app.store.Stations.ReadList(ctx)
+			if err != nil {
+				return nil, err
+			}
+			for _, s := range stops {
+				x, y := t.Project(s.Latitude, s.Longitude)
+				if !mvt.Contains(x, y, tileBuffer) {
+					continue
+				}
+				layer.AddPoint(uint64(s.ID), tilePoint(x, y), map[string]any{
+					"id":     s.ID,
+					"number": s.Number,
+					"name":   s.Name,
+				})
+			}
+
+		case "routes":
+			routes, err := app.store.Routes.ReadMapRoutes(ctx)
+			if err != nil {
+				return nil, err
+			}
+			for _, route := range routes {
+				line := make([][2]float64, 0, len(route.Path))
+				for _, p := range route.Path {
+					x, y := t.Project(p[0], p[1])
+					line = append(line, [2]float64{x, y})
+				}
+				layer.AddLineString(uint64(route.ID), mvt.ClipLine(line, tileBuffer), map[string]any{
+					"id":        route.ID,
+					"line_id":   route.LineID,
+					"line_code": route.LineCode,
+					"colour":    route.Colour,
+				})
+			}
+
+		case "delays":
+			if t.Z < tileStopsMinZoom {
+				continue
+			}
+			since := time.Now().AddDate(0, 0, -(tileDelayDays - 1))
+			heat, err := app.store.Delays.GetDelayHeat(ctx, since)
+			if err != nil {
+				return nil, err
+			}
+			for _, h := range heat {
+				x, y := t.Project(h.Latitude, h.Longitude)
+				if !mvt.Contains(x, y, tileBuffer) {
+					continue
+				}
+				layer.AddPoint(uint64(h.StopID), tilePoint(x, y), map[string]any{
+					"stop_id":        h.StopID,
+					"reports":        h.Reports,
+					"avg_delay_mins": h.AvgDelayMins,
+				})
+			}
+		}
+
+		encoded = append(encoded, layer)
+	}
+
+	return mvt.Encode(encoded...), nil
+}
+
+// @Summary		Get a vector tile of the network
+// @Description	Serves a Mapbox Vector Tile (version 2.1) of the Web Mercator tile z/x/y for map libraries such as
+// @Description	MapLibre. The routes layer has a line per route with its id, line_id, line_code and colour. From
+// @Description	zoom 12 the stops layer has a point per stop with its id, number and name, and the delays layer,
+// @Description	when asked for, a point per stop with delay reports in the last 30 days with stop_id, reports and
+// @Description	avg_delay_mins. Tiles are cached for a few minutes. An empty tile is returned as 204.
+// @Tags			map
+// @Produce		application/vnd.mapbox-vector-tile
+// @Param			z		path	int		true	"Zoom level, 0 to 22"
+// @Param			x		path	int		true	"Tile column"
+// @Param			y		path	int		true	"Tile row, from the north"
+// @Param			layers	query	string	false	"Comma-separated layers out of stops, routes and delays; stops and routes by default"
+// @Success		200		{file}	binary	"The tile"
+// @Success		204		"The tile has no features"
+// @Router			/tiles/{z}/{x}/{y}.mvt [get]
+// @Security		ApiKeyAuth
+func (app *app) getTileHandler(w http.ResponseWriter, r *http.Request) {
+	t, err := readTile(r)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	layers, err := readTileLayers(r)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	key := fmt.Sprintf("%d/%d/%d?%s", t.Z, t.X, t.Y, strings.Join(layers, ","))
+	now := time.Now()
+
+	tile, ok := app.tiles.get(key, now)
+	if !ok {
+		tile, err = app.renderTile(r, t, layers)
+		if err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+		app.tiles.put(key, tile, now)
+	}
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(tileCacheTTL.Seconds())))
+	if len(tile) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", mvt.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(tile)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(tile)
+}
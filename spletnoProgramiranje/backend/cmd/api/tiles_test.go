@@ -0,0 +1,111 @@
+package main
+
+import (
+	"backend/internal/data"
+	"backend/internal/mvt"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockTileStore serves one stop and one route in central Maribor, which lie
+// in tile 14/8904/5792, and counts the reads.
+func mockTileStore(app *app) (reads *int) {
+	reads = new(int)
+	app.store.Stations.(*MockStationsStorage).ReadListFunc = func(ctx context.Context) ([]data.Stop, error) {
+		*reads++
+		return []data.Stop{{ID: 1, Number: "003", Name: "Glavni trg", Latitude: 46.5577, Longitude: 15.6455}}, nil
+	}
+	app.store.Routes.(*MockRoutesStorage).ReadMapRoutesFunc = func(ctx context.Context) ([]data.MapRoute, error) {
+		*reads++
+		return []data.MapRoute{{ID: 1, LineID: 6, LineCode: "6", Colour: "#00a0e0",
+			Path: [][]float64{{46.5577, 15.6455}, {46.5620, 15.6567}}}}, nil
+	}
+	app.store.Delays.(*MockDelaysStorage).GetDelayHeatFunc = func(ctx context.Context, since time.Time) ([]data.StopDelayHeat, error) {
+		*reads++
+		return []data.StopDelayHeat{{StopID: 1, Latitude: 46.5577, Longitude: 15.6455, Reports: 3, AvgDelayMins: 4.5}}, nil
+	}
+	return reads
+}
+
+func TestGetTile(t *testing.T) {
+	app := setupTestApp()
+	reads := mockTileStore(app)
+	mux := app.mount()
+
+	req, w := createTestRequest("GET", "/v1/tiles/14/8904/5792.mvt", nil)
+	mux.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, mvt.ContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, "public, max-age=300", w.Header().Get("Cache-Control"))
+	assert.Contains(t, w.Body.String(), "stops")
+	assert.Contains(t, w.Body.String(), "Glavni trg")
+	assert.Contains(t, w.Body.String(), "#00a0e0")
+	assert.NotContains(t, w.Body.String(), "avg_delay_mins", "delays are only sent when asked for")
+	assert.Equal(t, 2, *reads)
+
+	tile := w.Body.Bytes()
+	req, w = createTestRequest("GET", "/v1/tiles/14/8904/5792.mvt", nil)
+	mux.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, tile, w.Body.Bytes())
+	assert.Equal(t, 2, *reads, "the second request is served from the cache")
+
+	req, w = createTestRequest("GET", "/v1/tiles/14/8904/5792.mvt?layers=delays,routes", nil)
+	mux.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "avg_delay_mins")
+	assert.NotContains(t, w.Body.String(), "Glavni trg")
+}
+
+func TestGetTileLeavesStopsOutWhenZoomedOut(t *testing.T) {
+	app := setupTestApp()
+	reads := mockTileStore(app)
+
+	req, w := createTestRequest("GET", "/v1/tiles/8/139/90.mvt", nil)
+	app.mount().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "routes")
+	assert.NotContains(t, w.Body.String(), "Glavni trg")
+	assert.Equal(t, 1, *reads, "stops are not read")
+}
+
+func TestGetTileWithoutFeatures(t *testing.T) {
+	app := setupTestApp()
+	mockTileStore(app)
+
+	req, w := createTestRequest("GET", "/v1/tiles/14/0/0.mvt", nil)
+	app.mount().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Body.Bytes())
+}
+
+func TestGetTileValidation(t *testing.T) {
+	tests := map[string]string{
+		"/v1/tiles/23/0/0.mvt":             "z",
+		"/v1/tiles/2/4/0.mvt":              "x",
+		"/v1/tiles/2/0/4.mvt":              "y",
+		"/v1/tiles/2/0/0.mvt?layers=buses": "layers",
+	}
+
+	for target, field := range tests {
+		t.Run(target, func(t *testing.T) {
+			app := setupTestApp()
+
+			req, w := createTestRequest("GET", target, nil)
+			app.mount().ServeHTTP(w, req)
+
+			require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+			assert.Contains(t, w.Body.String(), `"field":"`+field+`"`)
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"backend/internal/config"
+	"backend/internal/tracing"
+	"context"
+	"fmt"
+	"os"
+
+	"go.uber.org/zap"
+)
+
+// setupTracing installs the span exporter selected by cfg.Exporter: "otlp"
+// sends spans to the collector at cfg.Endpoint,
+// "stdout" prints them for local development and "none" (the default) only
+// generates trace IDs for logs and error responses. The returned function
+// flushes pending spans.
+func setupTracing(cfg config.Tracing, environment string, logger *zap.SugaredLogger) (func(context.Context) error, error) {
+	res := tracing.Resource{
+		ServiceName:    cfg.ServiceName,
+		ServiceVersion: version,
+		Environment:    environment,
+	}
+
+	var exporter tracing.Exporter
+
+	switch cfg.Exporter {
+	case "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		exporter = tracing.NewOTLPExporter(cfg.Endpoint, res)
+		logger.Infow("exporting traces over OTLP", "endpoint", cfg.Endpoint)
+	case "stdout":
+		exporter = tracing.NewStdoutExporter(os.Stdout)
+		logger.Infow("exporting traces to stdout")
+	default:
+		return nil, fmt.Errorf("unknown OTEL_TRACES_EXPORTER %q (expected otlp, stdout or none)", cfg.Exporter)
+	}
+
+	provider := tracing.NewProvider(exporter, tracing.Options{
+		OnError: func(err error) { logger.Warnw("trace export failed", "error", err) },
+	})
+	tracing.SetProvider(provider)
+
+	return provider.Shutdown, nil
+}
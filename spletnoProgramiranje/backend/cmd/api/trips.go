@@ -0,0 +1,351 @@
+package main
+
+import (
+	"backend/cmd/utils"
+	"backend/internal/data"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+)
+
+const (
+	// maxSavedTrips caps the trips of a user, which bounds the work done by
+	// /me/trips/today.
+	maxSavedTrips = 20
+	// disruptionDelay is the reported delay in minutes from which the usual
+	// connection counts as disrupted.
+	disruptionDelay = 5
+	// tripDelayReports bounds the delay reports read per origin stop.
+	tripDelayReports = 100
+)
+
+// Reasons a usual connection is disrupted.
+const (
+	disruptionNoConnection = "no_connection"
+	disruptionDelayed      = "delayed"
+	disruptionLate         = "arrives_late"
+)
+
+// readTripPayload reads and validates a trip and returns it owned by the
+// logged-in user.
+func readTripPayload(w http.ResponseWriter, r *http.Request) (*data.SavedTrip, error) {
+	var payload data.SavedTripPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		return nil, err
+	}
+
+	if payload.OriginStopID == payload.DestinationStopID {
+		return nil, data.NewValidationError("destination_stop_id", "same_stop", "must differ from origin_stop_id")
+	}
+
+	// Keep weekdays unique and in calendar order.
+	weekdays := make([]string, 0, len(payload.Weekdays))
+	for _, day := range data.Weekdays {
+		if slices.Contains(payload.Weekdays, day) {
+			weekdays = append(weekdays, day)
+		}
+	}
+
+	return &data.SavedTrip{
+		UserID:            GetUserIDFromContext(r.Context()),
+		Name:              payload.Name,
+		OriginStopID:      payload.OriginStopID,
+		DestinationStopID: payload.DestinationStopID,
+		Mode:              payload.Mode,
+		Time:              payload.Time,
+		Weekdays:          weekdays,
+	}, nil
+}
+
+// @Summary		List saved trips
+// @Description	Returns the saved trips of the logged-in user ordered by time of day.
+// @Tags			trips
+// @Produce		json
+// @Success		200	{array}	data.SavedTrip	"Saved trips"
+// @Router			/me/trips [get]
+// @Security		ApiKeyAuth
+func (app *app) listTripsHandler(w http.ResponseWriter, r *http.Request) {
+	trips, err := app.store.Trips.List(r.Context(), GetUserIDFromContext(r.Context()))
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, trips)
+}
+
+// @Summary		Save a trip
+// @Description	Saves a named trip between two stops. mode depart_at means the user leaves the origin at or
+// @Description	after time, arrive_by that they must reach the destination by time. weekdays lists the days
+// @Description	(mon ... sun) the trip is made. Names are unique per user; a user can save at most 20 trips.
+// @Tags			trips
+// @Accept			json
+// @Produce		json
+// @Param			trip	body		data.SavedTripPayload	true	"The trip to save"
+// @Success		201		{object}	data.SavedTrip			"The saved trip"
+// @Router			/me/trips [post]
+// @Security		ApiKeyAuth
+func (app *app) createTripHandler(w http.ResponseWriter, r *http.Request) {
+	trip, err := readTripPayload(w, r)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	err = app.store.WithTx(ctx, func(tx data.Storage) error {
+		// Concurrent requests would otherwise all pass the limit check.
+		if err := tx.User.Lock(ctx, trip.UserID); err != nil {
+			return err
+		}
+		existing, err := tx.Trips.List(ctx, trip.UserID)
+		if err != nil {
+			return err
+		}
+		if len(existing) >= maxSavedTrips {
+			return data.NewValidationError("body", "too_many", fmt.Sprintf("at most %d trips can be saved", maxSavedTrips))
+		}
+
+		return tx.Trips.Create(ctx, trip)
+	})
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusCreated, trip)
+}
+
+// @Summary		Update a saved trip
+// @Tags			trips
+// @Accept			json
+// @Produce		json
+// @Param			tripId	path		int						true	"Trip ID"
+// @Param			trip	body		data.SavedTripPayload	true	"The new trip"
+// @Success		200		{object}	data.SavedTrip			"The updated trip"
+// @Router			/me/trips/{tripId} [put]
+// @Security		ApiKeyAuth
+func (app *app) updateTripHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r, "tripId")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	trip, err := readTripPayload(w, r)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	trip.ID = id
+
+	if err := app.store.Trips.Update(r.Context(), trip); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, trip)
+}
+
+// @Summary		Delete a saved trip
+// @Tags			trips
+// @Param			tripId	path	int	true	"Trip ID"
+// @Success		204
+// @Router			/me/trips/{tripId} [delete]
+// @Security		ApiKeyAuth
+func (app *app) deleteTripHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r, "tripId")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Trips.Delete(r.Context(), GetUserIDFromContext(r.Context()), id); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// plannedConnection is a connection with the delay currently reported for
+// its line at the origin and the resulting expected times.
+type plannedConnection struct {
+	data.Connection
+	DelayMin          int    `json:"delay_min"`
+	ExpectedDeparture string `json:"expected_departure"`
+	ExpectedArrival   string `json:"expected_arrival"`
+}
+
+// tripPlan is today's outlook for a saved trip. Usual is the connection the
+// timetable offers for the trip's time; Recommended is the one to take given
+// the current delays, and LeaveBy its scheduled departure from the origin.
+type tripPlan struct {
+	Trip        data.SavedTrip     `json:"trip"`
+	LeaveBy     string             `json:"leave_by,omitempty"`
+	Usual       *plannedConnection `json:"usual"`
+	Recommended *plannedConnection `json:"recommended"`
+	Disrupted   bool               `json:"disrupted"`
+	Reason      string             `json:"reason,omitempty"`
+}
+
+type todaysTrips struct {
+	Date  string     `json:"date"`
+	Trips []tripPlan `json:"trips"`
+}
+
+// @Summary		Evaluate today's trips
+// @Description	Evaluates every saved trip made on today's weekday against today's timetable and the delays
+// @Description	reported today at its origin. For each trip it returns the usual direct connection, the
+// @Description	recommended one, the time to leave the origin by and whether the usual connection is
+// @Description	disrupted (no_connection, delayed by at least 5 minutes, or arrives_late for arrive_by trips).
+// @Tags			trips
+// @Produce		json
+// @Success		200	{object}	todaysTrips	"Today's trips"
+// @Router			/me/trips/today [get]
+// @Security		ApiKeyAuth
+func (app *app) getTodaysTripsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	now := time.Now()
+
+	trips, err := app.store.Trips.List(ctx, GetUserIDFromContext(ctx))
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	res := todaysTrips{Date: now.Format("2006-01-02"), Trips: []tripPlan{}}
+
+	// Delays are reported per stop, so trips sharing an origin share them.
+	delaysAt := make(map[int]map[int]int)
+
+	for _, trip := range trips {
+		if !trip.RunsOn(now) {
+			continue
+		}
+
+		connections, err := app.store.Stations.ReadConnections(ctx, data.ConnectionQuery{
+			FromStopID: int64(trip.OriginStopID),
+			ToStopID:   int64(trip.DestinationStopID),
+			Date:       now,
+		})
+		if err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+
+		delays, ok := delaysAt[trip.OriginStopID]
+		if !ok {
+			reports, err := app.store.Delays.GetRecentDelays(ctx, data.DelayFilter{
+				StopID: int64(trip.OriginStopID),
+				Since:  now,
+				Limit:  tripDelayReports,
+			})
+			if err != nil {
+				app.errorResponse(w, r, err)
+				return
+			}
+			delays = currentDelays(reports)
+			delaysAt[trip.OriginStopID] = delays
+		}
+
+		res.Trips = append(res.Trips, planTrip(trip, connections, delays))
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, res)
+}
+
+// currentDelays maps each line to its newest reported delay in minutes.
+// reports must be newest first.
+func currentDelays(reports []data.DelayReport) map[int]int {
+	delays := make(map[int]int)
+	for _, d := range reports {
+		if _, ok := delays[d.LineID]; !ok {
+			delays[d.LineID] = d.DelayMin
+		}
+	}
+	return delays
+}
+
+// planTrip picks the usual and the recommended connection of a trip.
+// connections must be ordered by departure. For depart_at trips the usual
+// connection is the first one leaving at or after the trip's time and the
+// recommended one is the earliest expected arrival among those. For
+// arrive_by trips the usual connection is the last one scheduled to arrive
+// by the trip's time and the recommended one is the latest departure still
+// expected to arrive by then.
+func planTrip(trip data.SavedTrip, connections []data.Connection, delays map[int]int) tripPlan {
+	plan := tripPlan{Trip: trip}
+	target := clockMinutes(trip.Time)
+
+	planned := make([]plannedConnection, 0, len(connections))
+	for _, c := range connections {
+		delay := delays[c.LineID]
+		planned = append(planned, plannedConnection{
+			Connection:        c,
+			DelayMin:          delay,
+			ExpectedDeparture: formatClock(clockMinutes(c.Departure) + delay),
+			ExpectedArrival:   formatClock(clockMinutes(c.Arrival) + delay),
+		})
+	}
+
+	for i := range planned {
+		c := &planned[i]
+		departs := clockMinutes(c.Departure)
+		arrives := clockMinutes(c.Arrival)
+
+		switch trip.Mode {
+		case data.TripDepartAt:
+			if departs < target {
+				continue
+			}
+			if plan.Usual == nil {
+				plan.Usual = c
+			}
+			if plan.Recommended == nil || arrives+c.DelayMin < clockMinutes(plan.Recommended.Arrival)+plan.Recommended.DelayMin {
+				plan.Recommended = c
+			}
+		case data.TripArriveBy:
+			if arrives <= target && (plan.Usual == nil || arrives >= clockMinutes(plan.Usual.Arrival)) {
+				plan.Usual = c
+			}
+			if arrives+c.DelayMin <= target {
+				plan.Recommended = c
+			}
+		}
+	}
+
+	switch {
+	case plan.Usual == nil:
+		plan.Disrupted, plan.Reason = true, disruptionNoConnection
+	case trip.Mode == data.TripArriveBy && clockMinutes(plan.Usual.Arrival)+plan.Usual.DelayMin > target:
+		plan.Disrupted, plan.Reason = true, disruptionLate
+	case plan.Usual.DelayMin >= disruptionDelay:
+		plan.Disrupted, plan.Reason = true, disruptionDelayed
+	}
+
+	if plan.Recommended != nil {
+		plan.LeaveBy = plan.Recommended.Departure
+	}
+
+	return plan
+}
+
+// clockMinutes returns the minutes since midnight of a "15:04" time. The
+// times handled here come from validated payloads and the database, so a
+// malformed one counts as midnight.
+func clockMinutes(s string) int {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0
+	}
+	return t.Hour()*60 + t.Minute()
+}
+
+// formatClock formats minutes since midnight as "15:04", wrapping past
+// midnight.
+func formatClock(minutes int) string {
+	minutes = (minutes%(24*60) + 24*60) % (24 * 60)
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
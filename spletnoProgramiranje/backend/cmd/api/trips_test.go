@@ -0,0 +1,226 @@
+package main
+
+import (
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanTrip(t *testing.T) {
+	connections := []data.Connection{
+		{LineID: 1, Departure: "07:10", Arrival: "07:35"},
+		{LineID: 2, Departure: "07:20", Arrival: "07:40"},
+		{LineID: 1, Departure: "07:40", Arrival: "08:05"},
+	}
+
+	tests := []struct {
+		name        string
+		mode        string
+		time        string
+		delays      map[int]int
+		usual       string
+		recommended string
+		reason      string
+	}{
+		{"depart on time", data.TripDepartAt, "07:05", nil, "07:10", "07:10", ""},
+		{"depart with a faster line", data.TripDepartAt, "07:05", map[int]int{1: 10}, "07:10", "07:20", disruptionDelayed},
+		{"depart after the last bus", data.TripDepartAt, "07:45", nil, "", "", disruptionNoConnection},
+		{"arrive on time", data.TripArriveBy, "07:45", nil, "07:20", "07:20", ""},
+		{"arrive late", data.TripArriveBy, "07:45", map[int]int{2: 6}, "07:20", "07:10", disruptionLate},
+		{"arrive with a small delay", data.TripArriveBy, "07:45", map[int]int{2: 3}, "07:20", "07:20", ""},
+		{"arrive before the first bus", data.TripArriveBy, "07:30", nil, "", "", disruptionNoConnection},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := planTrip(data.SavedTrip{Mode: tt.mode, Time: tt.time}, connections, tt.delays)
+
+			departure := func(c *plannedConnection) string {
+				if c == nil {
+					return ""
+				}
+				return c.Departure
+			}
+			assert.Equal(t, tt.usual, departure(plan.Usual), "usual")
+			assert.Equal(t, tt.recommended, departure(plan.Recommended), "recommended")
+			assert.Equal(t, tt.recommended, plan.LeaveBy)
+			assert.Equal(t, tt.reason, plan.Reason)
+			assert.Equal(t, tt.reason != "", plan.Disrupted)
+		})
+	}
+}
+
+func TestPlanTripExpectedTimes(t *testing.T) {
+	plan := planTrip(
+		data.SavedTrip{Mode: data.TripDepartAt, Time: "23:00"},
+		[]data.Connection{{LineID: 1, Departure: "23:50", Arrival: "23:58"}},
+		map[int]int{1: 7},
+	)
+
+	require.NotNil(t, plan.Usual)
+	assert.Equal(t, 7, plan.Usual.DelayMin)
+	assert.Equal(t, "23:57", plan.Usual.ExpectedDeparture)
+	assert.Equal(t, "00:05", plan.Usual.ExpectedArrival, "wraps past midnight")
+}
+
+func TestCreateTrip(t *testing.T) {
+	app := setupTestApp()
+	locked := false
+	app.store.User.(*MockUsersStorage).LockFunc = func(ctx context.Context, id int) error {
+		assert.Equal(t, 1, id)
+		locked = true
+		return nil
+	}
+	mock := app.store.Trips.(*MockTripsStorage)
+	mock.ListFunc = func(ctx context.Context, userID int) ([]data.SavedTrip, error) {
+		assert.True(t, locked, "the user is locked before the limit is checked")
+		return []data.SavedTrip{}, nil
+	}
+
+	var created data.SavedTrip
+	mock.CreateFunc = func(ctx context.Context, trip *data.SavedTrip) error {
+		created = *trip
+		trip.ID = 4
+		return nil
+	}
+
+	req, w := adminRequest(t, app, data.RoleUser, "POST", "/v1/me/trips", map[string]any{
+		"name":                "Work",
+		"origin_stop_id":      1,
+		"destination_stop_id": 2,
+		"mode":                data.TripArriveBy,
+		"time":                "08:00",
+		"weekdays":            []string{"fri", "mon", "fri"},
+	})
+	app.mount().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Equal(t, 1, created.UserID)
+	assert.Equal(t, []string{"mon", "fri"}, created.Weekdays)
+	assert.Contains(t, w.Body.String(), `"id":4`)
+}
+
+func TestCreateTripValidation(t *testing.T) {
+	valid := func() map[string]any {
+		return map[string]any{
+			"name":                "Work",
+			"origin_stop_id":      1,
+			"destination_stop_id": 2,
+			"mode":                data.TripDepartAt,
+			"time":                "08:00",
+			"weekdays":            []string{"mon"},
+		}
+	}
+
+	tests := []struct {
+		name  string
+		field string
+		value any
+		code  string
+	}{
+		{"same stops", "destination_stop_id", 1, "same_stop"},
+		{"unknown mode", "mode", "leave_at", "not_allowed"},
+		{"malformed time", "time", "8am", "invalid_time"},
+		{"unknown weekday", "weekdays", []string{"mon", "someday"}, "not_allowed"},
+		{"no weekdays", "weekdays", []string{}, "required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := setupTestApp()
+			app.store.Trips.(*MockTripsStorage).CreateFunc = func(ctx context.Context, trip *data.SavedTrip) error {
+				t.Fatal("trip must not be created")
+				return nil
+			}
+
+			body := valid()
+			body[tt.field] = tt.value
+
+			req, w := adminRequest(t, app, data.RoleUser, "POST", "/v1/me/trips", body)
+			app.mount().ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), `"code":"`+tt.code+`"`)
+		})
+	}
+}
+
+func TestUpdateTripOfAnotherUser(t *testing.T) {
+	app := setupTestApp()
+	app.store.Trips.(*MockTripsStorage).UpdateFunc = func(ctx context.Context, trip *data.SavedTrip) error {
+		assert.Equal(t, int64(9), trip.ID)
+		return data.ErrNotFound
+	}
+
+	req, w := adminRequest(t, app, data.RoleUser, "PUT", "/v1/me/trips/9", map[string]any{
+		"name":                "Work",
+		"origin_stop_id":      1,
+		"destination_stop_id": 2,
+		"mode":                data.TripDepartAt,
+		"time":                "08:00",
+		"weekdays":            []string{"mon"},
+	})
+	app.mount().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestGetTodaysTrips(t *testing.T) {
+	now := time.Now()
+	today, tomorrow := data.Weekday(now), data.Weekday(now.AddDate(0, 0, 1))
+
+	app := setupTestApp()
+	app.store.Trips.(*MockTripsStorage).ListFunc = func(ctx context.Context, userID int) ([]data.SavedTrip, error) {
+		return []data.SavedTrip{
+			{ID: 1, Name: "Work", OriginStopID: 1, DestinationStopID: 2, Mode: data.TripDepartAt, Time: "00:00", Weekdays: []string{today}},
+			{ID: 2, Name: "Gym", OriginStopID: 1, DestinationStopID: 3, Mode: data.TripDepartAt, Time: "00:00", Weekdays: []string{tomorrow}},
+			{ID: 3, Name: "Home", OriginStopID: 1, DestinationStopID: 4, Mode: data.TripDepartAt, Time: "00:00", Weekdays: []string{today}},
+		}, nil
+	}
+	app.store.Stations.(*MockStationsStorage).ReadConnectionsFunc = func(ctx context.Context, q data.ConnectionQuery) ([]data.Connection, error) {
+		if q.ToStopID == 4 {
+			return []data.Connection{}, nil
+		}
+		return []data.Connection{{LineID: 1, Departure: "07:10", Arrival: "07:35"}}, nil
+	}
+
+	delayQueries := 0
+	app.store.Delays.(*MockDelaysStorage).GetRecentDelaysFunc = func(ctx context.Context, f data.DelayFilter) ([]data.DelayReport, error) {
+		delayQueries++
+		assert.Equal(t, int64(1), f.StopID)
+		return []data.DelayReport{{LineID: 1, DelayMin: 8}, {LineID: 1, DelayMin: 2}}, nil
+	}
+
+	req, w := adminRequest(t, app, data.RoleUser, "GET", "/v1/me/trips/today", nil)
+	app.mount().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var res struct {
+		Data struct {
+			Date  string           `json:"date"`
+			Trips []map[string]any `json:"trips"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, now.Format("2006-01-02"), res.Data.Date)
+	require.Len(t, res.Data.Trips, 2, "trips of other weekdays are skipped")
+	assert.Equal(t, 1, delayQueries, "delays are read once per origin")
+
+	work := res.Data.Trips[0]
+	assert.Equal(t, "07:10", work["leave_by"])
+	assert.Equal(t, true, work["disrupted"])
+	assert.Equal(t, disruptionDelayed, work["reason"])
+	assert.Equal(t, float64(8), work["usual"].(map[string]any)["delay_min"], "the newest report wins")
+
+	home := res.Data.Trips[1]
+	assert.Equal(t, disruptionNoConnection, home["reason"])
+	assert.Nil(t, home["usual"])
+	assert.NotContains(t, home, "leave_by")
+}
@@ -3,12 +3,8 @@ package main
 import (
 	"backend/cmd/utils"
 	"backend/internal/data"
-	"backend/internal/env"
-	"encoding/json"
+	"errors"
 	"net/http"
-	"strconv"
-
-	"github.com/go-chi/chi/v5"
 )
 
 // @Summary		Register a new user account
@@ -32,33 +28,15 @@ func (app *app) usersResgisterUser(w http.ResponseWriter, r *http.Request) {
 		}
 	*/
 
-	if r.Body == nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, "No user data in request body")
-		return
-	}
-
 	var payload data.RegisterUserPayload
-	err := json.NewDecoder(r.Body).Decode(&payload)
-
-	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
-		return
-	}
-
-	ctx := r.Context()
-
-	_, err3 := app.store.User.GetByEmail(ctx, payload.Email)
-
-	if err3 == nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, "User with this email already exists")
+	if err := readJSON(w, r, &payload); err != nil {
+		app.errorResponse(w, r, err)
 		return
 	}
 
-	//log.Printf("sem tu notri")
 	hashedPassword, err := HashPassword(payload.Password)
-
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.internalServerError(w, r, err)
 		return
 	}
 
@@ -68,16 +46,26 @@ func (app *app) usersResgisterUser(w http.ResponseWriter, r *http.Request) {
 		Password: hashedPassword,
 	}
 
-	//fmt.Printf("Username: %s\nEmail: %s\nPassword: %s\n", temp.Username, temp.Email, temp.Password)
-	err2 := app.store.User.Create(ctx, &temp)
+	ctx := r.Context()
 
-	if err2 != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err2.Error())
+	// The lookup gives a clear conflict for the common case; the unique
+	// constraints still catch a concurrent registration inside Create.
+	err = app.store.WithTx(ctx, func(tx data.Storage) error {
+		if _, err := tx.User.GetByEmail(ctx, payload.Email); err == nil {
+			return data.ErrConflict
+		} else if !errors.Is(err, data.ErrNotFound) {
+			return err
+		}
+		return tx.User.Create(ctx, &temp)
+	})
+	if err != nil {
+		app.errorResponse(w, r, err)
 		return
 	}
+	registrationsTotal.Inc()
 
 	if err := utils.WriteJSONResponse(w, http.StatusCreated, nil); err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.internalServerError(w, r, err)
 		return
 	}
 
@@ -104,40 +92,39 @@ func (app *app) usersLoginUser(w http.ResponseWriter, r *http.Request) {
 		}
 	*/
 
-	if r.Body == nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, "No user data in request body")
-		return
-	}
-
 	var payload data.LoginUserPayload
-	err := json.NewDecoder(r.Body).Decode(&payload)
-
-	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+	if err := readJSON(w, r, &payload); err != nil {
+		app.errorResponse(w, r, err)
 		return
 	}
 
 	ctx := r.Context()
 
-	temp, err3 := app.store.User.GetByEmail(ctx, payload.Email)
-
-	if err3 != nil {
-		utils.WriteJSONError(w, http.StatusBadRequest, "User does not exist")
+	temp, err := app.store.User.GetByEmail(ctx, payload.Email)
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			loginsTotal.With("failure").Inc()
+			app.invalidCredentialsResponse(w, r)
+			return
+		}
+		app.errorResponse(w, r, err)
 		return
 	}
 
 	if !ComparePasswords(temp.Password, []byte(payload.Password)) {
-		utils.WriteJSONError(w, http.StatusBadRequest, "Invalid password and email combination")
+		loginsTotal.With("failure").Inc()
+		app.invalidCredentialsResponse(w, r)
 		return
 	}
 
-	secret := []byte(env.GetString("JWT_SECRET", "notSoSecret-anymore"))
-	token, err := CreateJWT(secret, temp.ID)
+	secret := []byte(app.config.Auth.JWTSecret.Value())
+	token, err := CreateJWT(secret, temp.ID, app.config.Auth.JWTExpiry)
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		app.internalServerError(w, r, err)
 		return
 	}
 
+	loginsTotal.With("success").Inc()
 	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{"token": token})
 
 }
@@ -152,26 +139,15 @@ func (app *app) usersLoginUser(w http.ResponseWriter, r *http.Request) {
 // @Failure		400		{object}	map[string]string			"Invalid input"
 // @Router			/users/profile [put]
 func (app *app) usersUpdateProfile(w http.ResponseWriter, r *http.Request) {
-	if r.Body == nil {
-		utils.WriteJSONError(w, http.StatusBadRequest, "No user data in request body")
-		return
-	}
-
 	var payload data.UpdateUserPayload
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		utils.WriteJSONError(w, http.StatusBadRequest, "Invalid input")
-		return
-	}
-
-	userIDRaw := r.Context().Value("userID")
-	if userIDRaw == nil {
-		utils.WriteJSONError(w, http.StatusUnauthorized, "Unauthorized")
+	if err := readJSON(w, r, &payload); err != nil {
+		app.errorResponse(w, r, err)
 		return
 	}
 
-	userID, ok := userIDRaw.(int)
-	if !ok {
-		utils.WriteJSONError(w, http.StatusInternalServerError, "Invalid user ID in context")
+	userID := GetUserIDFromContext(r.Context())
+	if userID == -1 {
+		app.permissionDeniedResponse(w, r)
 		return
 	}
 
@@ -179,13 +155,15 @@ func (app *app) usersUpdateProfile(w http.ResponseWriter, r *http.Request) {
 
 	existingUser, err := app.store.User.GetByEmail(ctx, payload.Email)
 	if err == nil && existingUser.ID != userID {
-		utils.WriteJSONError(w, http.StatusBadRequest, "Email already in use by another account")
+		app.errorResponse(w, r, data.ErrConflict)
+		return
+	} else if err != nil && !errors.Is(err, data.ErrNotFound) {
+		app.errorResponse(w, r, err)
 		return
 	}
 
-	err = app.store.User.UpdateById(ctx, userID, &payload)
-	if err != nil {
-		utils.WriteJSONError(w, http.StatusInternalServerError, "Failed to update user")
+	if err := app.store.User.UpdateById(ctx, userID, &payload); err != nil {
+		app.errorResponse(w, r, err)
 		return
 	}
 
@@ -193,17 +171,16 @@ func (app *app) usersUpdateProfile(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *app) getUserByID(w http.ResponseWriter, r *http.Request) {
-	idStr := chi.URLParam(r, "id")
-	id, err := strconv.Atoi(idStr)
+	id, err := readIDParam(r, "id")
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusBadRequest, "Invalid user ID")
+		app.errorResponse(w, r, err)
 		return
 	}
 
 	ctx := r.Context()
-	user, err := app.store.User.GetByIDForClient(ctx, id)
+	user, err := app.store.User.GetByIDForClient(ctx, int(id))
 	if err != nil {
-		utils.WriteJSONError(w, http.StatusNotFound, "User not found: "+err.Error())
+		app.errorResponse(w, r, err)
 		return
 	}
 
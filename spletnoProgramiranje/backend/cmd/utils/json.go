@@ -2,28 +2,9 @@ package utils
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
-	"os"
-	"sync"
 )
 
-var (
-	errorLog *log.Logger
-	once     sync.Once
-)
-
-func initLogger() {
-	once.Do(func() {
-		file, err := os.OpenFile("error.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-		if err != nil {
-			log.Fatalf("Failed to open error log file: %v", err)
-		}
-
-		errorLog = log.New(file, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
-	})
-}
-
 func WriteJSON(w http.ResponseWriter, status int, data any) error {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -41,16 +22,12 @@ func ReadJSON(w http.ResponseWriter, r *http.Request, data any) error {
 	return decoder.Decode(data)
 }
 
-func WriteJSONError(w http.ResponseWriter, status int, message string) error {
-	initLogger()
-
-	errorLog.Printf("Status: %d, Message: %s", status, message)
-
-	type envelope struct {
-		Error string `json:"error"`
-	}
-
-	return WriteJSON(w, status, &envelope{Error: message})
+// WriteProblem writes an RFC 7807 problem document with the
+// application/problem+json content type.
+func WriteProblem(w http.ResponseWriter, status int, problem any) error {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(problem)
 }
 
 func WriteJSONResponse(w http.ResponseWriter, status int, data any) error {
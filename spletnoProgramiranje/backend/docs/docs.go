@@ -94,6 +94,11 @@ const docTemplate = `{
         },
         "/delays/average": {
             "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
                 "description": "Provides comprehensive statistics about average delays across the entire bus network.\nThe response includes system-wide mean delay time, variation by time of day,\nseasonal patterns, and comparative analysis across different service areas.\nThis data is essential for overall system performance assessment and planning.",
                 "consumes": [
                     "application/json"
@@ -117,6 +122,11 @@ const docTemplate = `{
         },
         "/delays/average/{lineId}": {
             "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
                 "description": "Calculates and returns the average delay duration for a particular bus line.\nThe response includes mean delay time, standard deviation, peak delay periods,\nand historical trends. This information helps understand service reliability\nand identify patterns in service disruptions for specific routes.",
                 "consumes": [
                     "application/json"
@@ -149,6 +159,11 @@ const docTemplate = `{
         },
         "/delays/lines/number": {
             "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
                 "description": "Returns statistical data about delay frequencies for each bus line.\nThe response includes the total number of delays per line, frequency patterns,\ncommon delay causes, and trend analysis where available.\nThis data is valuable for identifying problematic routes and planning improvements.",
                 "consumes": [
                     "application/json"
@@ -175,6 +190,11 @@ const docTemplate = `{
         },
         "/delays/recent": {
             "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
                 "description": "Provides a list of the most recent delay incidents across all bus lines and stations.\nThe response includes comprehensive details about each delay, including location,\nduration, affected services, passenger impact, and current status.\nThis endpoint is crucial for real-time system monitoring and service updates.",
                 "consumes": [
                     "application/json"
@@ -201,6 +221,11 @@ const docTemplate = `{
         },
         "/delays/recent/line/{lineId}": {
             "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
                 "description": "Returns the most recent delay incidents for a particular bus line.\nThe data includes detailed timing information, delay durations, locations,\npassenger impact, and any available resolution information.\nThis endpoint is useful for monitoring current service status and recent performance.",
                 "consumes": [
                     "application/json"
@@ -236,6 +261,11 @@ const docTemplate = `{
         },
         "/delays/station/{stationId}": {
             "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
                 "description": "Retrieves a comprehensive list of all recorded delays at a particular bus station.\nThe response includes detailed information about each delay incident, including\ntimestamp, duration, cause (if available), affected bus lines, and impact level.\nThis data helps analyze station-specific performance and identify problematic locations.",
                 "consumes": [
                     "application/json"
@@ -271,6 +301,11 @@ const docTemplate = `{
         },
         "/delays/user/{userId}": {
             "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
                 "description": "Retrieves all delay reports submitted by a particular user.\nThe response includes full details of each reported delay, including\ntimestamp, location, affected services, and any additional notes provided.\nThis endpoint helps track user contributions and verify reporting patterns.",
                 "consumes": [
                     "application/json"
@@ -306,6 +341,11 @@ const docTemplate = `{
         },
         "/estimate/simulate/{lineId}": {
             "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
                 "description": "Provides simulated real-time updates of bus positions for a specific line via WebSocket.\nThe simulation includes realistic bus movements along the route, considering schedules,\ntypical speeds, and stop times. Updates are sent every 2 seconds with precise coordinates\nand movement patterns. This endpoint is useful for testing and demonstration purposes.",
                 "consumes": [
                     "application/json"
@@ -369,6 +409,11 @@ const docTemplate = `{
         },
         "/occupancy/average/{date}": {
             "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
                 "description": "Provides detailed daily occupancy analytics across the entire bus network for a specific date.\nThe response includes comprehensive metrics such as daily passenger totals, peak hours identification,\nline-by-line comparisons, unusual patterns detection, and historical trend analysis.\nThis data is crucial for daily operations management, service optimization,\nand understanding system-wide usage patterns on specific dates (e.g., events, holidays).\nThe information helps in both operational planning and user travel planning.",
                 "consumes": [
                     "application/json"
@@ -401,6 +446,11 @@ const docTemplate = `{
         },
         "/occupancy/average/{hour}": {
             "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
                 "description": "Calculates and returns comprehensive average occupancy statistics across all bus lines for a specific hour.\nThis aggregated data includes system-wide occupancy patterns, comparative analysis between different lines,\nidentification of busiest routes, and historical trends for the specified hour.\nThe endpoint is valuable for system-wide capacity planning, identifying peak travel patterns,\nand helping users understand general system busyness during specific hours.\nResults can be used for optimizing service frequency and capacity allocation.",
                 "consumes": [
                     "application/json"
@@ -433,6 +483,11 @@ const docTemplate = `{
         },
         "/occupancy/line/{lineId}/date/{date}": {
             "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
                 "description": "Retrieves comprehensive occupancy data for a specific bus line throughout an entire day.\nThe data includes hourly breakdowns of passenger counts, occupancy percentages,\npeak and off-peak patterns, and historical comparisons where available.\nThis endpoint is particularly useful for analyzing daily ridership patterns,\nplanning capacity adjustments, and helping users choose less crowded travel times.\nThe response includes timestamps, occupancy levels, and trend indicators.",
                 "consumes": [
                     "application/json"
@@ -475,6 +530,11 @@ const docTemplate = `{
         },
         "/occupancy/line/{lineId}/date/{date}/hour/{hour}": {
             "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
                 "description": "Provides granular occupancy data for a specific bus line during a particular hour of a day.\nThe response includes detailed metrics such as current passenger count, capacity percentage,\nhistorical comparison for the same hour, typical occupancy patterns, and real-time updates if available.\nThis endpoint is essential for real-time crowd management and helping users plan their immediate travel.\nThe data can be used to make informed decisions about immediate travel plans and avoid overcrowded buses.",
                 "consumes": [
                     "application/json"
@@ -524,6 +584,11 @@ const docTemplate = `{
         },
         "/routes/active": {
             "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
                 "description": "Returns the number of bus routes that are currently in service or active.\nThis includes routes with buses currently running, scheduled for the current time period,\nor marked as active in the system. The count helps understand current service coverage\nand system activity levels.",
                 "consumes": [
                     "application/json"
@@ -547,6 +612,11 @@ const docTemplate = `{
         },
         "/routes/list": {
             "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
                 "description": "Provides a comprehensive list of all bus routes in the system, including active and inactive routes.\nEach route entry contains basic information such as route number, name, terminal stations,\nservice frequency, operating hours, and current status.\nThis endpoint is useful for displaying the complete network coverage and available services.",
                 "consumes": [
                     "application/json"
@@ -573,6 +643,11 @@ const docTemplate = `{
         },
         "/routes/realtime": {
             "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
                 "description": "Establishes a WebSocket connection to receive real-time updates about bus locations.\nThe connection sends periodic updates (every 5 seconds) with current bus positions,\nincluding coordinates, heading, speed, and next stop information.\nThis endpoint is crucial for real-time tracking features in client applications.",
                 "consumes": [
                     "application/json"
@@ -596,6 +671,11 @@ const docTemplate = `{
         },
         "/routes/stations/{lineId}": {
             "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
                 "description": "Returns a detailed list of all stations that are part of a specific bus line's route.\nThe response includes station ordering, distances between stations, estimated travel times,\nplatform information, and any special notes about each stop on the route.\nThis data is crucial for journey planning and providing users with complete route information.",
                 "consumes": [
                     "application/json"
@@ -631,6 +711,11 @@ const docTemplate = `{
         },
         "/routes/{lineId}": {
             "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
                 "description": "Retrieves comprehensive route data for a specific bus line, including the complete path,\nall waypoints, direction information, and geographical coordinates for the entire route.\nThe response includes detailed path segments, turn-by-turn information, and route variants if available.\nThis endpoint is essential for mapping applications and route visualization features.",
                 "consumes": [
                     "application/json"
@@ -663,6 +748,11 @@ const docTemplate = `{
         },
         "/stations": {
             "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
                 "description": "Returns a detailed list of all available bus stations in the system. Each station entry includes\nits unique identifier, geographical coordinates (latitude and longitude), full name, description,\ncurrent status, and any associated metadata such as nearby landmarks or accessibility features.\nThis endpoint is useful for applications needing to display all available stations or create a station map.",
                 "consumes": [
                     "application/json"
@@ -689,6 +779,11 @@ const docTemplate = `{
         },
         "/stations/nearby": {
             "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
                 "description": "Searches for and returns a list of bus stations within a specified radius of given coordinates.\nThe search uses precise geolocation calculations to find stations, considering the actual\nwalking distance where possible. Results are sorted by proximity to the provided location.\nEach station in the response includes distance from the search point, walking time estimates,\nand complete station details including real-time availability and accessibility information.\nThis endpoint is crucial for mobile apps and location-based services.",
                 "consumes": [
                     "application/json"
@@ -726,6 +821,11 @@ const docTemplate = `{
         },
         "/stations/{stationId}": {
             "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
                 "description": "Fetches comprehensive information about a single bus station identified by its unique ID.\nThe response includes detailed station attributes such as exact location coordinates,\nfull station name, operational status, platform information, accessibility features,\navailable facilities, and real-time status updates if available.\nThis endpoint is essential for displaying detailed station information to users.",
                 "consumes": [
                     "application/json"
@@ -758,6 +858,11 @@ const docTemplate = `{
         },
         "/stations/{stationId}/metadata": {
             "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
                 "description": "Retrieves advanced metadata and supplementary information for a specific station.\nThis includes detailed information such as historical occupancy patterns,\npeak hours, typical waiting times, available amenities (shelters, benches, lighting),\naccessibility features (wheelchair access, tactile paving), nearby points of interest,\nand any special notes about the station's operation or temporary changes.\nThis data is particularly useful for journey planning and accessibility requirements.",
                 "consumes": [
                     "application/json"
@@ -1068,6 +1173,13 @@ const docTemplate = `{
                 }
             }
         }
+    },
+    "securityDefinitions": {
+        "ApiKeyAuth": {
+            "type": "apiKey",
+            "name": "X-API-Key",
+            "in": "header"
+        }
     }
 }`
 
@@ -0,0 +1,219 @@
+// Package alerts notifies users about delay reports matching their alert
+// subscriptions. An evaluator matches reports against the subscriptions and
+// enqueues one delivery per match; a dispatcher sends due deliveries over
+// their channel and retries failed ones with exponential backoff. Both run
+// in the API process and coordinate through the storage, so several API
+// instances can run them side by side.
+package alerts
+
+import (
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// incidentBatch bounds the delay reports matched per evaluation.
+	incidentBatch = 500
+	// deliveryBatch bounds the deliveries sent per dispatch.
+	deliveryBatch = 50
+	// deliveryLease is how long a claimed delivery is hidden from other
+	// dispatchers. It must outlast a notifier's timeout.
+	deliveryLease = 5 * time.Minute
+	// maxErrorLen bounds the error kept in the delivery log.
+	maxErrorLen = 500
+)
+
+// Notifier sends a delivery over one channel.
+type Notifier interface {
+	Notify(ctx context.Context, d data.AlertDelivery) error
+}
+
+// Notification is the payload of every delivery: the subscription that
+// matched and the delay report it matched.
+type Notification struct {
+	SubscriptionID   int64  `json:"subscription_id"`
+	SubscriptionName string `json:"subscription_name"`
+	data.AlertIncident
+}
+
+// Subject summarises the notification in one line, such as
+// "Line 6 delayed 7 min at Center".
+func (n *Notification) Subject() string {
+	return fmt.Sprintf("Line %s delayed %d min at %s", n.LineCode, n.DelayMin, n.StopName)
+}
+
+type Options struct {
+	PollInterval time.Duration
+	MaxAttempts  int
+	RetryBackoff time.Duration
+}
+
+type Service struct {
+	store     data.Storage
+	notifiers map[string]Notifier
+	opts      Options
+	logger    *zap.SugaredLogger
+
+	now func() time.Time
+}
+
+// NewService builds a service that delivers over the given notifiers, keyed
+// by channel. Deliveries over a channel without a notifier fail.
+func NewService(store data.Storage, notifiers map[string]Notifier, opts Options, logger *zap.SugaredLogger) *Service {
+	return &Service{
+		store:     store,
+		notifiers: notifiers,
+		opts:      opts,
+		logger:    logger,
+		now:       time.Now,
+	}
+}
+
+// Run evaluates and dispatches every poll interval until ctx is cancelled.
+// Errors are logged and retried on the next tick.
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Evaluate(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Errorw("evaluating alert subscriptions", "error", err)
+		}
+		if err := s.Dispatch(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Errorw("dispatching alerts", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Evaluate matches the delay reports filed since the last evaluation against
+// every subscription and enqueues a delivery per match. Reports and cursor
+// move together, so a report is matched once even if Evaluate fails halfway.
+func (s *Service) Evaluate(ctx context.Context) error {
+	return s.store.WithTx(ctx, func(tx data.Storage) error {
+		cursor, err := tx.Alerts.Cursor(ctx)
+		if err != nil {
+			return err
+		}
+
+		incidents, err := tx.Alerts.ReadIncidents(ctx, cursor, incidentBatch)
+		if err != nil || len(incidents) == 0 {
+			return err
+		}
+
+		subs, err := tx.Alerts.AllSubscriptions(ctx)
+		if err != nil {
+			return err
+		}
+
+		now := s.now()
+		for _, inc := range incidents {
+			for _, sub := range subs {
+				if !sub.Matches(inc) {
+					continue
+				}
+
+				payload, err := json.Marshal(Notification{
+					SubscriptionID:   sub.ID,
+					SubscriptionName: sub.Name,
+					AlertIncident:    inc,
+				})
+				if err != nil {
+					return err
+				}
+
+				err = tx.Alerts.EnqueueDelivery(ctx, &data.AlertDelivery{
+					SubscriptionID: sub.ID,
+					DelayID:        inc.DelayID,
+					Payload:        payload,
+					NextAttemptAt:  now,
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return tx.Alerts.SetCursor(ctx, incidents[len(incidents)-1].DelayID)
+	})
+}
+
+// Dispatch sends the deliveries that are due and records each outcome.
+func (s *Service) Dispatch(ctx context.Context) error {
+	now := s.now()
+
+	deliveries, err := s.store.Alerts.ClaimDeliveries(ctx, now, deliveryLease, deliveryBatch)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range deliveries {
+		err := s.notify(ctx, d)
+		if ctx.Err() != nil {
+			// Shutting down; the lease expires and the delivery is retried
+			// without counting this attempt.
+			return ctx.Err()
+		}
+
+		s.record(&d, err, s.now())
+		if err := s.store.Alerts.UpdateDelivery(ctx, &d); err != nil {
+			return err
+		}
+
+		switch d.Status {
+		case data.DeliveryDelivered:
+			s.logger.Infow("alert delivered", "delivery_id", d.ID, "channel", d.Channel, "attempts", d.Attempts)
+		case data.DeliveryFailed:
+			s.logger.Warnw("alert delivery failed", "delivery_id", d.ID, "channel", d.Channel, "attempts", d.Attempts, "error", d.LastError)
+		default:
+			s.logger.Infow("alert delivery will be retried", "delivery_id", d.ID, "channel", d.Channel,
+				"attempts", d.Attempts, "next_attempt_at", d.NextAttemptAt, "error", d.LastError)
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) notify(ctx context.Context, d data.AlertDelivery) error {
+	n, ok := s.notifiers[d.Channel]
+	if !ok {
+		return fmt.Errorf("no notifier for channel %q", d.Channel)
+	}
+	return n.Notify(ctx, d)
+}
+
+// record applies the outcome of an attempt made at now to d. The n-th failed
+// attempt is retried after RetryBackoff * 2^(n-1) until MaxAttempts is
+// reached.
+func (s *Service) record(d *data.AlertDelivery, err error, now time.Time) {
+	d.Attempts++
+
+	if err == nil {
+		d.Status = data.DeliveryDelivered
+		d.LastError = ""
+		d.DeliveredAt = &now
+		return
+	}
+
+	d.LastError = err.Error()
+	if len(d.LastError) > maxErrorLen {
+		d.LastError = d.LastError[:maxErrorLen]
+	}
+
+	if d.Attempts >= s.opts.MaxAttempts {
+		d.Status = data.DeliveryFailed
+		return
+	}
+
+	d.NextAttemptAt = now.Add(s.opts.RetryBackoff << (d.Attempts - 1))
+}
@@ -0,0 +1,352 @@
+package alerts
+
+import (
+	"backend/internal/data"
+	"backend/internal/data/memory"
+	"backend/internal/data/storagetest"
+	"backend/internal/safehttp"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestService(t *testing.T, notifiers map[string]Notifier) (*Service, data.Storage) {
+	store, err := memory.NewStorage(storagetest.Dataset())
+	require.NoError(t, err)
+
+	svc := NewService(store, notifiers, Options{
+		PollInterval: time.Second,
+		MaxAttempts:  3,
+		RetryBackoff: time.Minute,
+	}, zap.NewNop().Sugar())
+
+	return svc, store
+}
+
+func subscribe(t *testing.T, store data.Storage, sub data.AlertSubscription) data.AlertSubscription {
+	sub.UserID = 1
+	if sub.Channel == "" {
+		sub.Channel = data.AlertWebhook
+		sub.Target = "http://example.com/hook"
+	}
+	require.NoError(t, store.Alerts.CreateSubscription(context.Background(), &sub))
+	return sub
+}
+
+func report(t *testing.T, store data.Storage, stopID, lineID int64, delayMin int) {
+	_, err := store.Delays.InsertDelay(context.Background(), data.DelayReportInputUnMarshaled{
+		Date: time.Now(), DelayMin: delayMin, StopID: stopID, LineID: lineID, UserId: 2,
+	})
+	require.NoError(t, err)
+}
+
+type notifierFunc func(ctx context.Context, d data.AlertDelivery) error
+
+func (f notifierFunc) Notify(ctx context.Context, d data.AlertDelivery) error { return f(ctx, d) }
+
+func TestMatches(t *testing.T) {
+	line, stop, north := 1, 1, 1
+	monday8 := time.Date(2024, 5, 6, 7, 30, 0, 0, time.Local)
+	incident := data.AlertIncident{ReportedAt: monday8, DelayMin: 7, StopID: 1, LineID: 1, DirectionIDs: []int64{1, 2}}
+
+	tests := []struct {
+		name string
+		sub  data.AlertSubscription
+		want bool
+	}{
+		{"line", data.AlertSubscription{LineID: &line}, true},
+		{"other line", data.AlertSubscription{LineID: intRef(2)}, false},
+		{"stop", data.AlertSubscription{StopID: &stop}, true},
+		{"other stop", data.AlertSubscription{StopID: intRef(2)}, false},
+		{"direction serving the stop", data.AlertSubscription{LineID: &line, DirectionID: &north}, true},
+		{"direction not serving the stop", data.AlertSubscription{LineID: &line, DirectionID: intRef(3)}, false},
+		{"delay at the threshold", data.AlertSubscription{LineID: &line, MinDelayMin: 7}, true},
+		{"delay below the threshold", data.AlertSubscription{LineID: &line, MinDelayMin: 8}, false},
+		{"weekday", data.AlertSubscription{LineID: &line, Weekdays: []string{"mon", "tue"}}, true},
+		{"other weekday", data.AlertSubscription{LineID: &line, Weekdays: []string{"sat", "sun"}}, false},
+		{"inside the window", data.AlertSubscription{LineID: &line, WindowStart: "07:00", WindowEnd: "08:00"}, true},
+		{"window end is exclusive", data.AlertSubscription{LineID: &line, WindowStart: "06:00", WindowEnd: "07:30"}, false},
+		{"outside the window", data.AlertSubscription{LineID: &line, WindowStart: "16:00", WindowEnd: "18:00"}, false},
+		{"window past midnight", data.AlertSubscription{LineID: &line, WindowStart: "22:00", WindowEnd: "08:00"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.sub.Matches(incident))
+		})
+	}
+}
+
+func intRef(v int) *int { return &v }
+
+func TestEvaluate(t *testing.T) {
+	ctx := context.Background()
+	svc, store := newTestService(t, nil)
+
+	line6, line1, east := 2, 1, 3
+	commute := subscribe(t, store, data.AlertSubscription{Name: "Commute", LineID: &line6, DirectionID: &east, MinDelayMin: 5})
+	subscribe(t, store, data.AlertSubscription{Name: "Line 1", LineID: &line1, MinDelayMin: 5})
+
+	// Reports filed before the first evaluation never alert.
+	require.NoError(t, svc.Evaluate(ctx))
+
+	report(t, store, 2, 2, 7) // line 6 at Station, heading East
+	report(t, store, 2, 2, 3) // below the threshold
+	require.NoError(t, svc.Evaluate(ctx))
+	require.NoError(t, svc.Evaluate(ctx), "evaluating again is a no-op")
+
+	deliveries, err := store.Alerts.ListDeliveries(ctx, 1, commute.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, data.DeliveryPending, deliveries[0].Status)
+
+	var n Notification
+	require.NoError(t, json.Unmarshal(deliveries[0].Payload, &n))
+	assert.Equal(t, "Commute", n.SubscriptionName)
+	assert.Equal(t, "Line 6 delayed 7 min at Station", n.Subject())
+	assert.Equal(t, 5, n.DelayID)
+
+	cursor, err := store.Alerts.Cursor(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 6, cursor)
+}
+
+func TestDispatchRetriesWithBackoff(t *testing.T) {
+	ctx := context.Background()
+
+	calls := 0
+	svc, store := newTestService(t, map[string]Notifier{
+		data.AlertWebhook: notifierFunc(func(ctx context.Context, d data.AlertDelivery) error {
+			calls++
+			if calls < 3 {
+				return errors.New("receiver unavailable")
+			}
+			return nil
+		}),
+	})
+
+	start := time.Date(2024, 5, 6, 7, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return start }
+
+	line := 2
+	sub := subscribe(t, store, data.AlertSubscription{Name: "Line 6", LineID: &line})
+	require.NoError(t, svc.Evaluate(ctx))
+	report(t, store, 2, 2, 7)
+	require.NoError(t, svc.Evaluate(ctx))
+
+	latest := func() data.AlertDelivery {
+		deliveries, err := store.Alerts.ListDeliveries(ctx, 1, sub.ID, 1)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		return deliveries[0]
+	}
+
+	require.NoError(t, svc.Dispatch(ctx))
+	d := latest()
+	assert.Equal(t, data.DeliveryPending, d.Status)
+	assert.Equal(t, 1, d.Attempts)
+	assert.Equal(t, "receiver unavailable", d.LastError)
+	assert.Equal(t, start.Add(time.Minute), d.NextAttemptAt)
+
+	require.NoError(t, svc.Dispatch(ctx))
+	assert.Equal(t, 1, calls, "nothing is due before the backoff")
+
+	svc.now = func() time.Time { return start.Add(time.Minute) }
+	require.NoError(t, svc.Dispatch(ctx))
+	d = latest()
+	assert.Equal(t, 2, d.Attempts)
+	assert.Equal(t, start.Add(3*time.Minute), d.NextAttemptAt, "the backoff doubles")
+
+	svc.now = func() time.Time { return start.Add(3 * time.Minute) }
+	require.NoError(t, svc.Dispatch(ctx))
+	d = latest()
+	assert.Equal(t, data.DeliveryDelivered, d.Status)
+	assert.Equal(t, 3, d.Attempts)
+	assert.Empty(t, d.LastError)
+	require.NotNil(t, d.DeliveredAt)
+}
+
+func TestDispatchGivesUp(t *testing.T) {
+	ctx := context.Background()
+	svc, store := newTestService(t, map[string]Notifier{})
+
+	start := time.Now()
+	svc.now = func() time.Time { return start }
+	line := 2
+	sub := subscribe(t, store, data.AlertSubscription{Name: "Line 6", LineID: &line})
+	require.NoError(t, svc.Evaluate(ctx))
+	report(t, store, 2, 2, 7)
+	require.NoError(t, svc.Evaluate(ctx))
+
+	for i := range 3 {
+		svc.now = func() time.Time { return start.Add(time.Duration(i) * time.Hour) }
+		require.NoError(t, svc.Dispatch(ctx))
+	}
+
+	deliveries, err := store.Alerts.ListDeliveries(ctx, 1, sub.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, data.DeliveryFailed, deliveries[0].Status)
+	assert.Equal(t, 3, deliveries[0].Attempts)
+	assert.Contains(t, deliveries[0].LastError, `no notifier for channel "webhook"`)
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var (
+		body    []byte
+		headers http.Header
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		headers = r.Header.Clone()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	d := data.AlertDelivery{ID: 7, Target: srv.URL, Secret: "whsec_test", Payload: []byte(`{"delay_id":4}`)}
+	n := &WebhookNotifier{Client: srv.Client()}
+	require.NoError(t, n.Notify(context.Background(), d))
+
+	assert.JSONEq(t, `{"delay_id":4}`, string(body))
+	assert.Equal(t, "application/json", headers.Get("Content-Type"))
+	assert.Equal(t, "7", headers.Get(DeliveryHeader))
+
+	ts, err := strconv.ParseInt(headers.Get(TimestampHeader), 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, Sign("whsec_test", ts, body), headers.Get(SignatureHeader))
+	assert.NotEqual(t, Sign("other", ts, body), headers.Get(SignatureHeader))
+}
+
+func TestWebhookNotifierRejectsErrorResponses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	n := &WebhookNotifier{Client: srv.Client()}
+	err := n.Notify(context.Background(), data.AlertDelivery{Target: srv.URL, Payload: []byte(`{}`)})
+	assert.ErrorContains(t, err, "502")
+}
+
+func TestWebhookNotifierRefusesPrivateAddresses(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	err := NewWebhookNotifier(time.Second, false).Notify(context.Background(), data.AlertDelivery{Target: srv.URL, Payload: []byte(`{}`)})
+	assert.ErrorIs(t, err, safehttp.ErrForbiddenAddress)
+	assert.False(t, called)
+}
+
+func TestWebhookNotifierAllowsPrivateAddressesInDevelopment(t *testing.T) {
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	err := NewWebhookNotifier(time.Second, true).Notify(context.Background(), data.AlertDelivery{Target: srv.URL, Payload: []byte(`{"delay_id":4}`)})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"delay_id":4}`, string(body))
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '1700000000.{}' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t, "sha256=b8569b78799ff9e3cbff0fc2d63a33a2b57f3282abd07c37ae5e8e7d79a5f163",
+		Sign("secret", 1700000000, []byte(`{}`)))
+}
+
+// smtpSink accepts one message over a minimal SMTP dialogue and sends what it
+// received on the returned channel.
+func smtpSink(t *testing.T) (string, <-chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(s string) { _, _ = io.WriteString(conn, s+"\r\n") }
+
+		var transcript strings.Builder
+		reply("220 sink ready")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			transcript.WriteString(line)
+
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 sink")
+			case strings.HasPrefix(cmd, "DATA"):
+				reply("354 go ahead")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					transcript.WriteString(line)
+				}
+				reply("250 queued")
+			case strings.HasPrefix(cmd, "QUIT"):
+				reply("221 bye")
+				received <- transcript.String()
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+
+	return ln.Addr().String(), received
+}
+
+func TestEmailNotifier(t *testing.T) {
+	addr, received := smtpSink(t)
+
+	payload, err := json.Marshal(Notification{
+		SubscriptionName: "Commute",
+		AlertIncident:    data.AlertIncident{DelayMin: 7, StopName: "Glavni trg", LineCode: "6", ReportedAt: time.Now()},
+	})
+	require.NoError(t, err)
+
+	n := NewEmailNotifier(addr, "alerts@example.com", "", "", time.Second)
+	require.NoError(t, n.Notify(context.Background(), data.AlertDelivery{Target: "alice@example.com", Payload: payload}))
+
+	select {
+	case msg := <-received:
+		assert.Contains(t, msg, "MAIL FROM:<alerts@example.com>")
+		assert.Contains(t, msg, "RCPT TO:<alice@example.com>")
+		assert.Contains(t, msg, "Subject: Line 6 delayed 7 min at Glavni trg")
+		assert.Contains(t, msg, `your alert "Commute"`)
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+	}
+}
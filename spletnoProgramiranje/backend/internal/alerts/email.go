@@ -0,0 +1,114 @@
+package alerts
+
+import (
+	"backend/internal/data"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"time"
+)
+
+// EmailNotifier sends the notification as a plain-text e-mail through an
+// SMTP relay. STARTTLS is used whenever the relay offers it; Auth, when set,
+// is only attempted after that.
+type EmailNotifier struct {
+	Addr    string
+	From    string
+	Auth    smtp.Auth
+	Timeout time.Duration
+}
+
+// NewEmailNotifier returns a notifier for the relay at addr ("host:port").
+// An empty username sends without authentication.
+func NewEmailNotifier(addr, from, username, password string, timeout time.Duration) *EmailNotifier {
+	n := &EmailNotifier{Addr: addr, From: from, Timeout: timeout}
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		n.Auth = smtp.PlainAuth("", username, password, host)
+	}
+	return n
+}
+
+func (n *EmailNotifier) Notify(ctx context.Context, d data.AlertDelivery) error {
+	var notification Notification
+	if err := json.Unmarshal(d.Payload, &notification); err != nil {
+		return fmt.Errorf("decoding alert payload: %w", err)
+	}
+
+	if n.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.Timeout)
+		defer cancel()
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", n.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	host, _, _ := net.SplitHostPort(n.Addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if n.Auth != nil {
+		if err := c.Auth(n.Auth); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(n.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(d.Target); err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(n.message(d, &notification)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+func (n *EmailNotifier) message(d data.AlertDelivery, notification *Notification) []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "From: %s\r\n", n.From)
+	fmt.Fprintf(&b, "To: %s\r\n", d.Target)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", notification.Subject()))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&b, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&b, "\r\n")
+
+	fmt.Fprintf(&b, "%s.\r\n\r\n", notification.Subject())
+	fmt.Fprintf(&b, "Reported at %s.\r\n", notification.ReportedAt.Local().Format("15:04 on 2 Jan 2006"))
+	fmt.Fprintf(&b, "You receive this because of your alert %q.\r\n", notification.SubscriptionName)
+
+	return b.Bytes()
+}
@@ -0,0 +1,76 @@
+package alerts
+
+import (
+	"backend/internal/data"
+	"backend/internal/safehttp"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Webhook request headers. Receivers verify a delivery by recomputing
+// SignatureHeader with Sign over TimestampHeader and the raw body, and should
+// reject old timestamps to prevent replays.
+const (
+	SignatureHeader = "X-Alert-Signature"
+	TimestampHeader = "X-Alert-Timestamp"
+	DeliveryHeader  = "X-Alert-Delivery"
+)
+
+// Sign returns the signature of a webhook body sent at timestamp (Unix
+// seconds): "sha256=" and the hex HMAC-SHA256 of "<timestamp>.<body>" keyed
+// with the subscription secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookNotifier POSTs the notification as JSON to the subscription's URL.
+// Any response other than 2xx is a failed attempt.
+type WebhookNotifier struct {
+	Client *http.Client
+}
+
+// NewWebhookNotifier returns a notifier that only reaches public addresses,
+// since users choose the URLs, unless allowPrivate is set for development.
+func NewWebhookNotifier(timeout time.Duration, allowPrivate bool) *WebhookNotifier {
+	if allowPrivate {
+		return &WebhookNotifier{Client: &http.Client{Timeout: timeout}}
+	}
+	return &WebhookNotifier{Client: safehttp.NewClient(timeout)}
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, d data.AlertDelivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.Target, bytes.NewReader(d.Payload))
+	if err != nil {
+		return err
+	}
+
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(d.ID, 10))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(ts, 10))
+	req.Header.Set(SignatureHeader, Sign(d.Secret, ts, d.Payload))
+
+	res, err := n.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook responded %s", res.Status)
+	}
+
+	return nil
+}
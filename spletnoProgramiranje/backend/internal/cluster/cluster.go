@@ -0,0 +1,153 @@
+// Package cluster groups stops into the stations riders know. Most named
+// stops are several poles, one per direction or platform, each with its own
+// number; poles sharing a name within MaxMeters of each other, directly or
+// through other poles of the name, make a station. Admins override where
+// that goes wrong with data.StationOverride.
+package cluster
+
+import (
+	"backend/internal/data"
+	"backend/internal/geo"
+	"backend/internal/search"
+	"math"
+	"sort"
+	"strings"
+)
+
+// MaxMeters is how far apart two poles of a name can be and still be one
+// station. It spans a crossroads but not the next stop down the road.
+const MaxMeters = 300
+
+// unionFind joins stop IDs into sets.
+type unionFind map[int]int
+
+func (u unionFind) find(id int) int {
+	for u[id] != id {
+		u[id] = u[u[id]]
+		id = u[id]
+	}
+	return id
+}
+
+// union joins the sets of a and b, keeping the lower root so a station's
+// root is its lowest stop ID.
+func (u unionFind) union(a, b int) {
+	ra, rb := u.find(a), u.find(b)
+	switch {
+	case ra < rb:
+		u[rb] = ra
+	case rb < ra:
+		u[ra] = rb
+	}
+}
+
+// Stations clusters the stops into stations, ordered by name and then ID.
+// An overridden stop takes no part in clustering by name and distance and
+// joins the station of its override's StationStopID instead; overrides
+// naming stops that are not among stops are ignored.
+func Stations(stops []data.Stop, overrides []data.StationOverride) []data.ParentStation {
+	u := make(unionFind, len(stops))
+	for _, s := range stops {
+		u[s.ID] = s.ID
+	}
+
+	pinned := make(map[int]bool, len(overrides))
+	for _, o := range overrides {
+		if _, ok := u[o.StopID]; ok {
+			pinned[o.StopID] = true
+		}
+	}
+
+	byName := map[string][]data.Stop{}
+	for _, s := range stops {
+		if !pinned[s.ID] {
+			key := strings.Join(search.Words(s.Name), " ")
+			byName[key] = append(byName[key], s)
+		}
+	}
+	for _, poles := range byName {
+		for i, a := range poles {
+			for _, b := range poles[i+1:] {
+				if geo.DistanceMeters(a.Latitude, a.Longitude, b.Latitude, b.Longitude) <= MaxMeters {
+					u.union(a.ID, b.ID)
+				}
+			}
+		}
+	}
+
+	for _, o := range overrides {
+		_, okStop := u[o.StopID]
+		_, okStation := u[o.StationStopID]
+		if okStop && okStation {
+			u.union(o.StopID, o.StationStopID)
+		}
+	}
+
+	members := map[int][]data.Stop{}
+	for _, s := range stops {
+		root := u.find(s.ID)
+		members[root] = append(members[root], s)
+	}
+
+	stations := make([]data.ParentStation, 0, len(members))
+	for id, poles := range members {
+		stations = append(stations, station(id, poles))
+	}
+	sort.Slice(stations, func(i, j int) bool {
+		if stations[i].Name != stations[j].Name {
+			return stations[i].Name < stations[j].Name
+		}
+		return stations[i].ID < stations[j].ID
+	})
+
+	return stations
+}
+
+// station builds the station of the poles, named after the spelling most of
+// them share.
+func station(id int, poles []data.Stop) data.ParentStation {
+	sort.Slice(poles, func(i, j int) bool {
+		if poles[i].Number != poles[j].Number {
+			return poles[i].Number < poles[j].Number
+		}
+		return poles[i].ID < poles[j].ID
+	})
+
+	spellings := map[string]int{}
+	var lat, lon float64
+	for _, p := range poles {
+		spellings[p.Name]++
+		lat += p.Latitude
+		lon += p.Longitude
+	}
+	n := float64(len(poles))
+
+	return data.ParentStation{
+		ID:        id,
+		Name:      search.CommonSpelling(spellings),
+		Latitude:  math.Round(lat/n*1e6) / 1e6,
+		Longitude: math.Round(lon/n*1e6) / 1e6,
+		Stops:     poles,
+	}
+}
+
+// StationOf maps each stop ID to the ID of its station.
+func StationOf(stations []data.ParentStation) map[int]int {
+	of := map[int]int{}
+	for _, st := range stations {
+		for _, s := range st.Stops {
+			of[s.ID] = st.ID
+		}
+	}
+	return of
+}
+
+// Find returns the station with the ID, if there is one.
+func Find(stations []data.ParentStation, id int) (data.ParentStation, bool) {
+	for _, st := range stations {
+		if st.ID == id {
+			return st, true
+		}
+	}
+	return data.ParentStation{}, false
+}
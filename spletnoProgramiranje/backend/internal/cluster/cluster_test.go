@@ -0,0 +1,93 @@
+package cluster
+
+import (
+	"backend/internal/data"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testStops = []data.Stop{
+	// Glavni trg has a pole on each side of the square, 60 m apart.
+	{ID: 3, Number: "012", Name: "Glavni trg", Latitude: 46.5577, Longitude: 15.6455},
+	{ID: 1, Number: "011", Name: "Glavni trg", Latitude: 46.5580, Longitude: 15.6462},
+	// The bus station's platforms are a chain, each under 300 m from the
+	// next; the third is spelt without diacritics.
+	{ID: 5, Number: "021", Name: "Avtobusna postaja", Latitude: 46.5620, Longitude: 15.6567},
+	{ID: 6, Number: "022", Name: "Avtobusna postaja", Latitude: 46.5640, Longitude: 15.6567},
+	{ID: 7, Number: "023", Name: "avtobusna  postaja", Latitude: 46.5660, Longitude: 15.6567},
+	// Center in Ptuj is another stop with the name of one in Maribor.
+	{ID: 8, Number: "031", Name: "Center", Latitude: 46.5577, Longitude: 15.6500},
+	{ID: 9, Number: "032", Name: "Center", Latitude: 46.4200, Longitude: 15.8700},
+	{ID: 10, Number: "041", Name: "Tezno", Latitude: 46.5330, Longitude: 15.6700},
+}
+
+func stationIDs(stations []data.ParentStation) map[int][]int {
+	out := map[int][]int{}
+	for _, st := range stations {
+		for _, s := range st.Stops {
+			out[st.ID] = append(out[st.ID], s.ID)
+		}
+	}
+	return out
+}
+
+func TestStations(t *testing.T) {
+	stations := Stations(testStops, nil)
+
+	assert.Equal(t, map[int][]int{
+		1:  {1, 3},
+		5:  {5, 6, 7},
+		8:  {8},
+		9:  {9},
+		10: {10},
+	}, stationIDs(stations))
+
+	names := []string{}
+	for _, st := range stations {
+		names = append(names, st.Name)
+	}
+	assert.Equal(t, []string{"Avtobusna postaja", "Center", "Center", "Glavni trg", "Tezno"}, names)
+
+	glavni, ok := Find(stations, 1)
+	require.True(t, ok)
+	assert.Equal(t, "011", glavni.Stops[0].Number, "poles are by number")
+	assert.InDelta(t, 46.55785, glavni.Latitude, 1e-6)
+	assert.InDelta(t, 15.64585, glavni.Longitude, 1e-6)
+
+	_, ok = Find(stations, 3)
+	assert.False(t, ok, "stations take their lowest stop ID")
+}
+
+func TestStationsOverrides(t *testing.T) {
+	stations := Stations(testStops, []data.StationOverride{
+		// Platform 022 is split off, which breaks the chain to 023.
+		{StopID: 6, StationStopID: 6},
+		// Center by the square is moved into Glavni trg.
+		{StopID: 8, StationStopID: 3},
+		// Overrides of stops that are gone are ignored.
+		{StopID: 10, StationStopID: 99},
+		{StopID: 99, StationStopID: 10},
+	})
+
+	assert.Equal(t, map[int][]int{
+		1:  {1, 3, 8},
+		5:  {5},
+		6:  {6},
+		7:  {7},
+		9:  {9},
+		10: {10},
+	}, stationIDs(stations))
+
+	glavni, _ := Find(stations, 1)
+	assert.Equal(t, "Glavni trg", glavni.Name, "most poles are Glavni trg")
+}
+
+func TestStationOf(t *testing.T) {
+	of := StationOf(Stations(testStops, nil))
+
+	assert.Equal(t, 1, of[3])
+	assert.Equal(t, 5, of[7])
+	assert.Equal(t, 10, of[10])
+}
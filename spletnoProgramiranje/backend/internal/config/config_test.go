@@ -0,0 +1,247 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+const prodSecret = "a-production-secret-of-32-bytes!!"
+
+func envMap(m map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := m[key]
+		return v, ok
+	}
+}
+
+func TestLoadDevelopmentDefaults(t *testing.T) {
+	cfg, args, err := Load(nil, envMap(nil))
+	require.NoError(t, err)
+
+	assert.Empty(t, args)
+	assert.True(t, cfg.Development())
+	assert.Equal(t, ":8080", cfg.Addr)
+	assert.Equal(t, StoragePostgres, cfg.Storage.Backend)
+	assert.Equal(t, devDBAddr, cfg.DB.Addr.Value())
+	assert.Equal(t, devJWTSecret, cfg.Auth.JWTSecret.Value())
+	assert.Equal(t, 7*24*time.Hour, cfg.Auth.JWTExpiry)
+	assert.Equal(t, []string{"http://localhost:5173"}, cfg.CORS.AllowedOrigins)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+addr: ":7000"
+log:
+  level: debug
+db:
+  max_open_conns: 5
+  max_idle_time: 1m
+cors:
+  allowed_origins: ["https://file.example"]
+`), 0o600))
+
+	cfg, args, err := Load(
+		[]string{"-config", path, "-log-level", "warn", "migrate", "up"},
+		envMap(map[string]string{
+			"ADDR":                 ":9000",
+			"LOG_LEVEL":            "error",
+			"DB_MAX_IDLE_TIME":     "30s",
+			"JWT_EXP":              "3600",
+			"CORS_ALLOWED_ORIGINS": "https://a.example, https://b.example",
+		}),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"migrate", "up"}, args)
+	assert.Equal(t, ":9000", cfg.Addr, "env overrides the file")
+	assert.Equal(t, "warn", cfg.Log.Level, "flags override env")
+	assert.Equal(t, 5, cfg.DB.MaxOpenConns, "file overrides defaults")
+	assert.Equal(t, 30*time.Second, cfg.DB.MaxIdleTime)
+	assert.Equal(t, time.Hour, cfg.Auth.JWTExpiry, "JWT_EXP is a number of seconds")
+	assert.Equal(t, []string{"https://a.example", "https://b.example"}, cfg.CORS.AllowedOrigins)
+}
+
+func TestLoadConfigFileFromEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("addr: \":7000\"\n"), 0o600))
+
+	cfg, _, err := Load(nil, envMap(map[string]string{"CONFIG_FILE": path}))
+	require.NoError(t, err)
+	assert.Equal(t, ":7000", cfg.Addr)
+}
+
+func TestLoadRejectsUnknownFileKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("adress: \":7000\"\n"), 0o600))
+
+	_, _, err := Load([]string{"-config", path}, envMap(nil))
+	assert.Error(t, err)
+}
+
+func TestLoadRejectsMalformedEnv(t *testing.T) {
+	_, _, err := Load(nil, envMap(map[string]string{
+		"DB_MAX_OPEN_CONNS": "many",
+		"DB_AUTO_MIGRATE":   "sometimes",
+	}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "DB_MAX_OPEN_CONNS")
+	assert.Contains(t, err.Error(), "DB_AUTO_MIGRATE")
+}
+
+func TestLoadReadsDBAddr(t *testing.T) {
+	cfg, _, err := Load(nil, envMap(map[string]string{
+		"DB_ADDR": "postgresql://app:pw@db:5432/m-busi",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "postgresql://app:pw@db:5432/m-busi", cfg.DB.Addr.Value())
+}
+
+func TestProductionRequiresSecrets(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{
+			name:    "missing jwt secret",
+			env:     map[string]string{"ENV": "production", "DB_ADDR": "postgresql://db/m-busi"},
+			wantErr: "JWT_SECRET",
+		},
+		{
+			name:    "development jwt secret",
+			env:     map[string]string{"ENV": "production", "DB_ADDR": "postgresql://db/m-busi", "JWT_SECRET": devJWTSecret},
+			wantErr: "development secret",
+		},
+		{
+			name:    "short jwt secret",
+			env:     map[string]string{"ENV": "production", "DB_ADDR": "postgresql://db/m-busi", "JWT_SECRET": "short"},
+			wantErr: "at least 32 bytes",
+		},
+		{
+			name:    "missing db addr",
+			env:     map[string]string{"ENV": "production", "JWT_SECRET": prodSecret},
+			wantErr: "DB_ADDR",
+		},
+		{
+			name:    "missing redis url",
+			env:     map[string]string{"ENV": "production", "DB_ADDR": "postgresql://db/m-busi", "JWT_SECRET": prodSecret, "RATE_LIMIT_STORE": "redis"},
+			wantErr: "REDIS_URL",
+		},
+		{
+			name:    "missing vapid keys",
+			env:     map[string]string{"ENV": "production", "DB_ADDR": "postgresql://db/m-busi", "JWT_SECRET": prodSecret, "PUSH_ENABLED": "true", "PUSH_SUBJECT": "mailto:ops@example.com"},
+			wantErr: "VAPID_PRIVATE_KEY",
+		},
+		{
+			name:    "private alert targets",
+			env:     map[string]string{"ENV": "production", "DB_ADDR": "postgresql://db/m-busi", "JWT_SECRET": prodSecret, "ALERTS_ALLOW_PRIVATE_TARGETS": "true"},
+			wantErr: "ALERTS_ALLOW_PRIVATE_TARGETS",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Load(nil, envMap(tt.env))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+
+	cfg, _, err := Load(nil, envMap(map[string]string{
+		"ENV":        "production",
+		"DB_ADDR":    "postgresql://db/m-busi",
+		"JWT_SECRET": prodSecret,
+	}))
+	require.NoError(t, err)
+	assert.False(t, cfg.Development())
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*Config)
+	}{
+		{"unknown storage", func(c *Config) { c.Storage.Backend = "sqlite" }},
+		{"unknown log level", func(c *Config) { c.Log.Level = "loud" }},
+		{"unknown log format", func(c *Config) { c.Log.Format = "xml" }},
+		{"no open connections", func(c *Config) { c.DB.MaxOpenConns = 0 }},
+		{"zero idle time", func(c *Config) { c.DB.MaxIdleTime = 0 }},
+		{"zero connect timeout", func(c *Config) { c.DB.ConnectTimeout = 0 }},
+		{"zero shutdown timeout", func(c *Config) { c.ShutdownTimeout = 0 }},
+		{"malformed trusted proxy", func(c *Config) { c.TrustedProxies = []string{"10.0.0.0/33"} }},
+		{"zero jwt expiry", func(c *Config) { c.Auth.JWTExpiry = 0 }},
+		{"no cors origins", func(c *Config) { c.CORS.AllowedOrigins = nil }},
+		{"cors origin with path", func(c *Config) { c.CORS.AllowedOrigins = []string{"https://example.com/app"} }},
+		{"cors origin without scheme", func(c *Config) { c.CORS.AllowedOrigins = []string{"example.com"} }},
+		{"unknown rate limit store", func(c *Config) { c.RateLimit.Store = "memcached" }},
+		{"unknown tracing exporter", func(c *Config) { c.Tracing.Exporter = "jaeger" }},
+		{"zero alert poll interval", func(c *Config) { c.Alerts.PollInterval = 0 }},
+		{"no alert attempts", func(c *Config) { c.Alerts.MaxAttempts = 0 }},
+		{"smtp without sender", func(c *Config) { c.Alerts.SMTP.Addr = "localhost:25" }},
+		{"push without subject", func(c *Config) { c.Push.Enabled = true }},
+		{"push with half a key pair", func(c *Config) {
+			c.Push.Enabled, c.Push.Subject, c.Push.VAPIDPublicKey = true, "mailto:ops@example.com", "BPub"
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Defaults()
+			cfg.applyDevelopmentDefaults()
+			require.NoError(t, cfg.Validate())
+
+			tt.mutate(&cfg)
+			assert.Error(t, cfg.Validate())
+		})
+	}
+}
+
+func TestSecretsAreRedacted(t *testing.T) {
+	cfg, _, err := Load(nil, envMap(map[string]string{
+		"ENV":               "production",
+		"DB_ADDR":           "postgresql://app:db-password@db:5432/m-busi",
+		"JWT_SECRET":        prodSecret,
+		"RATE_LIMIT_STORE":  "redis",
+		"REDIS_URL":         "redis://:redis-password@cache:6379/0",
+		"SMTP_ADDR":         "mail:587",
+		"SMTP_FROM":         "alerts@example.com",
+		"SMTP_PASSWORD":     "smtp-password",
+		"PUSH_ENABLED":      "true",
+		"PUSH_SUBJECT":      "mailto:ops@example.com",
+		"VAPID_PUBLIC_KEY":  "BPub",
+		"VAPID_PRIVATE_KEY": "vapid-private",
+	}))
+	require.NoError(t, err)
+
+	raw, err := json.Marshal(cfg)
+	require.NoError(t, err)
+	out := string(raw)
+	assert.NotContains(t, out, prodSecret)
+	assert.NotContains(t, out, "db-password")
+	assert.NotContains(t, out, "redis-password")
+	assert.NotContains(t, out, "smtp-password")
+	assert.NotContains(t, out, "vapid-private")
+	assert.Contains(t, out, "db:5432", "the rest of the URL stays readable")
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	zap.New(core).Sugar().Infow("configuration loaded", "config", cfg)
+	require.Equal(t, 1, logs.Len())
+	logged, err := json.Marshal(logs.All()[0].ContextMap())
+	require.NoError(t, err)
+	assert.NotContains(t, string(logged), prodSecret)
+	assert.NotContains(t, string(logged), "db-password")
+
+	assert.Equal(t, redacted, Secret("x").String())
+	assert.Equal(t, "", Secret("").String())
+	assert.Equal(t, redacted, SecretURL("host=db password=pw").String())
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"encoding/json"
+	"net/url"
+)
+
+const redacted = "[REDACTED]"
+
+// Secret is a configuration value that must never be logged. Printing or
+// marshalling it yields a placeholder; Value returns the real content.
+type Secret string
+
+func (s Secret) Value() string { return string(s) }
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) { return json.Marshal(s.String()) }
+
+func (s Secret) MarshalYAML() (any, error) { return s.String(), nil }
+
+// SecretURL is a connection URL whose password must never be logged. Unlike
+// Secret it keeps the rest of the URL readable, which helps when debugging
+// which server the API talks to.
+type SecretURL string
+
+func (s SecretURL) Value() string { return string(s) }
+
+func (s SecretURL) String() string {
+	if s == "" {
+		return ""
+	}
+	u, err := url.Parse(string(s))
+	if err != nil || u.Scheme == "" {
+		// Not a URL (for example a key=value DSN), so the password may be
+		// anywhere in it.
+		return redacted
+	}
+	return u.Redacted()
+}
+
+func (s SecretURL) MarshalJSON() ([]byte, error) { return json.Marshal(s.String()) }
+
+func (s SecretURL) MarshalYAML() (any, error) { return s.String(), nil }
@@ -0,0 +1,511 @@
+package data
+
+import (
+	"backend/internal/tracing"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// Alert delivery channels.
+const (
+	AlertWebhook = "webhook"
+	AlertEmail   = "email"
+)
+
+// Alert delivery states. A pending delivery is retried until it is
+// delivered or runs out of attempts and fails.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// AlertSubscription describes which delay reports a user wants to hear
+// about and where to send them. Unset filters match everything; windows are
+// "15:04" times of day in the server's time zone and may wrap past midnight.
+type AlertSubscription struct {
+	ID          int64     `json:"id"`
+	UserID      int       `json:"-"`
+	Name        string    `json:"name"`
+	LineID      *int      `json:"line_id,omitempty"`
+	LineCode    string    `json:"line_code,omitempty"`
+	DirectionID *int      `json:"direction_id,omitempty"`
+	Direction   string    `json:"direction,omitempty"`
+	StopID      *int      `json:"stop_id,omitempty"`
+	StopName    string    `json:"stop_name,omitempty"`
+	MinDelayMin int       `json:"min_delay_min"`
+	WindowStart string    `json:"window_start,omitempty"`
+	WindowEnd   string    `json:"window_end,omitempty"`
+	Weekdays    []string  `json:"weekdays"`
+	Channel     string    `json:"channel"`
+	Target      string    `json:"target"`
+	Secret      string    `json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type CreateAlertSubscriptionPayload struct {
+	Name        string   `json:"name" validate:"required,max=100"`
+	LineID      *int     `json:"line_id" validate:"omitempty,min=1"`
+	DirectionID *int     `json:"direction_id" validate:"omitempty,min=1"`
+	StopID      *int     `json:"stop_id" validate:"omitempty,min=1"`
+	MinDelayMin int      `json:"min_delay_min" validate:"omitempty,min=1,max=600"`
+	WindowStart string   `json:"window_start" validate:"omitempty,clock"`
+	WindowEnd   string   `json:"window_end" validate:"omitempty,clock"`
+	Weekdays    []string `json:"weekdays" validate:"omitempty,oneof=mon tue wed thu fri sat sun"`
+	Channel     string   `json:"channel" validate:"required,oneof=webhook email"`
+	Target      string   `json:"target" validate:"required,max=500"`
+}
+
+// AlertIncident is a delay report as seen by the alert evaluator.
+type AlertIncident struct {
+	DelayID    int       `json:"delay_id"`
+	ReportedAt time.Time `json:"reported_at"`
+	DelayMin   int       `json:"delay_min"`
+	StopID     int       `json:"stop_id"`
+	StopName   string    `json:"stop_name"`
+	LineID     int       `json:"line_id"`
+	LineCode   string    `json:"line_code"`
+	// DirectionIDs are the directions of the line that serve the stop. A
+	// report does not say which way the bus was going, so it matches all of
+	// them.
+	DirectionIDs []int64 `json:"-"`
+}
+
+// Matches reports whether the incident is one the subscriber asked for.
+func (s *AlertSubscription) Matches(inc AlertIncident) bool {
+	if s.LineID != nil && *s.LineID != inc.LineID {
+		return false
+	}
+	if s.StopID != nil && *s.StopID != inc.StopID {
+		return false
+	}
+	if s.DirectionID != nil && !slices.Contains(inc.DirectionIDs, int64(*s.DirectionID)) {
+		return false
+	}
+	if inc.DelayMin < s.MinDelayMin {
+		return false
+	}
+
+	reported := inc.ReportedAt.Local()
+	if len(s.Weekdays) > 0 && !slices.Contains(s.Weekdays, Weekday(reported)) {
+		return false
+	}
+	if s.WindowStart != "" {
+		at := reported.Format("15:04")
+		if s.WindowStart <= s.WindowEnd {
+			return at >= s.WindowStart && at < s.WindowEnd
+		}
+		return at >= s.WindowStart || at < s.WindowEnd
+	}
+
+	return true
+}
+
+// AlertDelivery is one notification of one subscriber about one incident,
+// and its entry in the delivery log. Channel, Target and Secret come from
+// the subscription.
+type AlertDelivery struct {
+	ID             int64           `json:"id"`
+	SubscriptionID int64           `json:"subscription_id"`
+	DelayID        int             `json:"delay_id"`
+	Channel        string          `json:"channel"`
+	Target         string          `json:"target"`
+	Secret         string          `json:"-"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	LastError      string          `json:"last_error,omitempty"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+type AlertsStorage struct {
+	db     querier
+	logger *zap.SugaredLogger
+}
+
+func scanAlertSubscription(row interface{ Scan(...any) error }) (*AlertSubscription, error) {
+	var (
+		s                             AlertSubscription
+		lineID, directionID, stopID   sql.NullInt64
+		lineCode, direction, stopName sql.NullString
+		windowStart, windowEnd        sql.NullString
+	)
+	err := row.Scan(&s.ID, &s.UserID, &s.Name, &lineID, &lineCode, &directionID, &direction, &stopID, &stopName,
+		&s.MinDelayMin, &windowStart, &windowEnd, pq.Array(&s.Weekdays), &s.Channel, &s.Target, &s.Secret, &s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	ref := func(v sql.NullInt64) *int {
+		if !v.Valid {
+			return nil
+		}
+		id := int(v.Int64)
+		return &id
+	}
+	s.LineID, s.LineCode = ref(lineID), lineCode.String
+	s.DirectionID, s.Direction = ref(directionID), direction.String
+	s.StopID, s.StopName = ref(stopID), stopName.String
+	s.WindowStart, s.WindowEnd = windowStart.String, windowEnd.String
+	if s.Weekdays == nil {
+		s.Weekdays = []string{}
+	}
+
+	return &s, nil
+}
+
+const alertSubscriptionColumns = `
+	a.id, a.user_id, a.name, a.line_id, l.line_code, a.direction_id, dir.name, a.stop_id, s.name,
+	a.min_delay_min, to_char(a.window_start, 'HH24:MI'), to_char(a.window_end, 'HH24:MI'), a.weekdays,
+	a.channel, a.target, a.secret, a.created_at
+`
+
+const alertSubscriptionJoins = `
+	LEFT JOIN lines      AS l   ON l.id = a.line_id
+	LEFT JOIN directions AS dir ON dir.id = a.direction_id
+	LEFT JOIN stops      AS s   ON s.id = a.stop_id
+`
+
+func (s *AlertsStorage) querySubscriptions(ctx context.Context, name, query string, args ...any) ([]AlertSubscription, error) {
+	ctx, span := startQuerySpan(ctx, name, query)
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, span.Fail(err)
+	}
+	defer rows.Close()
+
+	subs := []AlertSubscription{}
+	for rows.Next() {
+		sub, err := scanAlertSubscription(rows)
+		if err != nil {
+			return nil, span.Fail(err)
+		}
+		subs = append(subs, *sub)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, span.Fail(err)
+	}
+
+	span.SetAttributes(tracing.Int("db.rows", len(subs)))
+
+	return subs, nil
+}
+
+// ListSubscriptions returns the subscriptions of a user, oldest first.
+func (s *AlertsStorage) ListSubscriptions(ctx context.Context, userID int) ([]AlertSubscription, error) {
+	query := `SELECT` + alertSubscriptionColumns + `FROM alert_subscriptions AS a` + alertSubscriptionJoins +
+		`WHERE a.user_id = $1 ORDER BY a.id`
+	return s.querySubscriptions(ctx, "AlertsStorage.ListSubscriptions", query, userID)
+}
+
+// AllSubscriptions returns every subscription for the evaluator.
+func (s *AlertsStorage) AllSubscriptions(ctx context.Context) ([]AlertSubscription, error) {
+	query := `SELECT` + alertSubscriptionColumns + `FROM alert_subscriptions AS a` + alertSubscriptionJoins +
+		`ORDER BY a.id`
+	return s.querySubscriptions(ctx, "AlertsStorage.AllSubscriptions", query)
+}
+
+// CreateSubscription stores a subscription and fills in its ID, names and
+// creation time. It returns ErrNotFound when a line, direction or stop does
+// not exist.
+func (s *AlertsStorage) CreateSubscription(ctx context.Context, sub *AlertSubscription) error {
+	query := `
+		WITH a AS (
+			INSERT INTO alert_subscriptions (user_id, name, line_id, direction_id, stop_id, min_delay_min,
+				window_start, window_end, weekdays, channel, target, secret)
+			VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, '')::time, NULLIF($8, '')::time, $9, $10, $11, $12)
+			RETURNING *
+		)
+		SELECT` + alertSubscriptionColumns + `FROM a` + alertSubscriptionJoins
+
+	ctx, span := startQuerySpan(ctx, "AlertsStorage.CreateSubscription", query)
+	defer span.End()
+
+	created, err := scanAlertSubscription(s.db.QueryRowContext(ctx, query,
+		sub.UserID, sub.Name, sub.LineID, sub.DirectionID, sub.StopID, sub.MinDelayMin,
+		sub.WindowStart, sub.WindowEnd, pq.Array(sub.Weekdays), sub.Channel, sub.Target, sub.Secret))
+	if err != nil {
+		if err := mapMissingReference(err); errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("creating alert subscription: %w", err)
+		}
+		return span.Fail(fmt.Errorf("creating alert subscription: %w", err))
+	}
+
+	*sub = *created
+
+	return nil
+}
+
+// DeleteSubscription removes a subscription of the user together with its
+// delivery log. Subscriptions of other users are reported as ErrNotFound.
+func (s *AlertsStorage) DeleteSubscription(ctx context.Context, userID int, id int64) error {
+	query := `DELETE FROM alert_subscriptions WHERE id = $1 AND user_id = $2`
+
+	ctx, span := startQuerySpan(ctx, "AlertsStorage.DeleteSubscription", query)
+	defer span.End()
+
+	res, err := s.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return span.Fail(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return span.Fail(err)
+	}
+	if n == 0 {
+		return fmt.Errorf("alert subscription %d: %w", id, ErrNotFound)
+	}
+
+	return nil
+}
+
+// ReadIncidents returns up to limit delay reports with an ID above
+// afterDelayID in ID order.
+func (s *AlertsStorage) ReadIncidents(ctx context.Context, afterDelayID, limit int) ([]AlertIncident, error) {
+	query := `
+		SELECT d.id, d.reported_at, d.delay_min, d.stop_id, s.name, d.line_id, l.line_code,
+			ARRAY(
+				SELECT DISTINCT dep.direction_id
+				FROM departures AS dep
+				JOIN directions AS dir ON dir.id = dep.direction_id
+				WHERE dep.stop_id = d.stop_id AND dir.line_id = d.line_id
+				ORDER BY 1
+			)
+		FROM delays AS d
+		JOIN stops  AS s ON s.id = d.stop_id
+		JOIN lines  AS l ON l.id = d.line_id
+		WHERE d.id > $1
+		ORDER BY d.id
+		LIMIT $2
+	`
+
+	ctx, span := startQuerySpan(ctx, "AlertsStorage.ReadIncidents", query)
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query, afterDelayID, limit)
+	if err != nil {
+		return nil, span.Fail(err)
+	}
+	defer rows.Close()
+
+	incidents := []AlertIncident{}
+	for rows.Next() {
+		var inc AlertIncident
+		if err := rows.Scan(&inc.DelayID, &inc.ReportedAt, &inc.DelayMin, &inc.StopID, &inc.StopName,
+			&inc.LineID, &inc.LineCode, pq.Array(&inc.DirectionIDs)); err != nil {
+			return nil, span.Fail(err)
+		}
+		incidents = append(incidents, inc)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, span.Fail(err)
+	}
+
+	span.SetAttributes(tracing.Int("db.rows", len(incidents)))
+
+	return incidents, nil
+}
+
+// Cursor returns the ID of the last delay report the evaluator has matched.
+// The first call starts at the newest report, so existing reports do not
+// trigger alerts.
+func (s *AlertsStorage) Cursor(ctx context.Context) (int, error) {
+	query := `
+		WITH init AS (
+			INSERT INTO alert_cursor (id, last_delay_id)
+			SELECT 1, COALESCE(MAX(id), 0) FROM delays
+			ON CONFLICT (id) DO NOTHING
+			RETURNING last_delay_id
+		)
+		SELECT last_delay_id FROM init
+		UNION ALL
+		SELECT last_delay_id FROM alert_cursor WHERE id = 1
+		LIMIT 1
+	`
+
+	ctx, span := startQuerySpan(ctx, "AlertsStorage.Cursor", query)
+	defer span.End()
+
+	var cursor int
+	if err := s.db.QueryRowContext(ctx, query).Scan(&cursor); err != nil {
+		return 0, span.Fail(err)
+	}
+
+	return cursor, nil
+}
+
+// SetCursor records the last delay report the evaluator has matched.
+func (s *AlertsStorage) SetCursor(ctx context.Context, delayID int) error {
+	query := `
+		INSERT INTO alert_cursor (id, last_delay_id) VALUES (1, $1)
+		ON CONFLICT (id) DO UPDATE SET last_delay_id = EXCLUDED.last_delay_id
+	`
+
+	ctx, span := startQuerySpan(ctx, "AlertsStorage.SetCursor", query)
+	defer span.End()
+
+	if _, err := s.db.ExecContext(ctx, query, delayID); err != nil {
+		return span.Fail(err)
+	}
+
+	return nil
+}
+
+// EnqueueDelivery schedules a pending delivery due immediately. A
+// subscription is notified about an incident at most once, so enqueuing the
+// same pair again is a no-op.
+func (s *AlertsStorage) EnqueueDelivery(ctx context.Context, d *AlertDelivery) error {
+	query := `
+		INSERT INTO alert_deliveries (subscription_id, delay_id, payload, next_attempt_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (subscription_id, delay_id) DO NOTHING
+	`
+
+	ctx, span := startQuerySpan(ctx, "AlertsStorage.EnqueueDelivery", query)
+	defer span.End()
+
+	if _, err := s.db.ExecContext(ctx, query, d.SubscriptionID, d.DelayID, []byte(d.Payload), d.NextAttemptAt); err != nil {
+		return span.Fail(fmt.Errorf("enqueuing alert delivery: %w", err))
+	}
+
+	return nil
+}
+
+func scanAlertDelivery(row interface{ Scan(...any) error }) (*AlertDelivery, error) {
+	var (
+		d       AlertDelivery
+		payload []byte
+	)
+	err := row.Scan(&d.ID, &d.SubscriptionID, &d.DelayID, &d.Channel, &d.Target, &d.Secret, &payload,
+		&d.Status, &d.Attempts, &d.LastError, &d.NextAttemptAt, &d.DeliveredAt, &d.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	d.Payload = payload
+	return &d, nil
+}
+
+const alertDeliveryColumns = `
+	d.id, d.subscription_id, d.delay_id, a.channel, a.target, a.secret, d.payload,
+	d.status, d.attempts, d.last_error, d.next_attempt_at, d.delivered_at, d.created_at
+`
+
+func (s *AlertsStorage) queryDeliveries(ctx context.Context, name, query string, args ...any) ([]AlertDelivery, error) {
+	ctx, span := startQuerySpan(ctx, name, query)
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, span.Fail(err)
+	}
+	defer rows.Close()
+
+	deliveries := []AlertDelivery{}
+	for rows.Next() {
+		d, err := scanAlertDelivery(rows)
+		if err != nil {
+			return nil, span.Fail(err)
+		}
+		deliveries = append(deliveries, *d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, span.Fail(err)
+	}
+
+	span.SetAttributes(tracing.Int("db.rows", len(deliveries)))
+
+	return deliveries, nil
+}
+
+// ClaimDeliveries returns up to limit pending deliveries due at now, oldest
+// due first, and pushes their next attempt lease into the future so that
+// other API instances skip them while they are being sent.
+func (s *AlertsStorage) ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]AlertDelivery, error) {
+	query := `
+		WITH due AS (
+			SELECT id FROM alert_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= $1
+			ORDER BY next_attempt_at, id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		), d AS (
+			UPDATE alert_deliveries AS d
+			SET next_attempt_at = $2
+			FROM due
+			WHERE d.id = due.id
+			RETURNING d.*
+		)
+		SELECT` + alertDeliveryColumns + `
+		FROM d
+		JOIN alert_subscriptions AS a ON a.id = d.subscription_id
+		ORDER BY d.id
+	`
+	return s.queryDeliveries(ctx, "AlertsStorage.ClaimDeliveries", query, now, now.Add(lease), limit)
+}
+
+// UpdateDelivery records the outcome of a delivery attempt.
+func (s *AlertsStorage) UpdateDelivery(ctx context.Context, d *AlertDelivery) error {
+	query := `
+		UPDATE alert_deliveries
+		SET status = $2, attempts = $3, last_error = $4, next_attempt_at = $5, delivered_at = $6
+		WHERE id = $1
+	`
+
+	ctx, span := startQuerySpan(ctx, "AlertsStorage.UpdateDelivery", query)
+	defer span.End()
+
+	res, err := s.db.ExecContext(ctx, query, d.ID, d.Status, d.Attempts, d.LastError, d.NextAttemptAt, d.DeliveredAt)
+	if err != nil {
+		return span.Fail(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return span.Fail(err)
+	}
+	if n == 0 {
+		return fmt.Errorf("alert delivery %d: %w", d.ID, ErrNotFound)
+	}
+
+	return nil
+}
+
+// ListDeliveries returns the newest limit entries of the delivery log of a
+// subscription of the user, newest first. Subscriptions of other users are
+// reported as ErrNotFound.
+func (s *AlertsStorage) ListDeliveries(ctx context.Context, userID int, subscriptionID int64, limit int) ([]AlertDelivery, error) {
+	var owner int
+	err := s.db.QueryRowContext(ctx, `SELECT user_id FROM alert_subscriptions WHERE id = $1`, subscriptionID).Scan(&owner)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && owner != userID) {
+		return nil, fmt.Errorf("alert subscription %d: %w", subscriptionID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT` + alertDeliveryColumns + `
+		FROM alert_deliveries AS d
+		JOIN alert_subscriptions AS a ON a.id = d.subscription_id
+		WHERE d.subscription_id = $1
+		ORDER BY d.id DESC
+		LIMIT $2
+	`
+	return s.queryDeliveries(ctx, "AlertsStorage.ListDeliveries", query, subscriptionID, limit)
+}
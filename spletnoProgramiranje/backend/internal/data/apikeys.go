@@ -0,0 +1,242 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// API key scopes. A key may only call endpoints requiring one of its scopes.
+const (
+	ScopeReadRealtime  = "read:realtime"
+	ScopeReadTimetable = "read:timetable"
+	ScopeWriteDelays   = "write:delays"
+)
+
+// Scopes lists every scope an API key can be granted.
+var Scopes = []string{ScopeReadRealtime, ScopeReadTimetable, ScopeWriteDelays}
+
+// APIKey is an issued key. The secret itself is never stored; only its
+// SHA-256 hash and a short prefix that lets admins recognise the key.
+type APIKey struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	DailyQuota int        `json:"daily_quota"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	CreatedBy  *int       `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// HasScope reports whether the key was granted scope.
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Active reports whether the key may be used at now.
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+type CreateAPIKeyPayload struct {
+	Name       string     `json:"name" validate:"required,max=100"`
+	Scopes     []string   `json:"scopes" validate:"required,min=1"`
+	DailyQuota int        `json:"daily_quota" validate:"min=0"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+}
+
+// APIKeyUsage is the number of requests made with a key on one UTC day.
+type APIKeyUsage struct {
+	Day      string `json:"day"`
+	Requests int64  `json:"requests"`
+}
+
+type APIKeysStorage struct {
+	db     querier
+	logger *zap.SugaredLogger
+}
+
+func (s *APIKeysStorage) Create(ctx context.Context, key *APIKey, hash string) error {
+	query := `
+		INSERT INTO api_keys (name, prefix, key_hash, scopes, daily_quota, expires_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`
+
+	ctx, span := startQuerySpan(ctx, "APIKeysStorage.Create", query)
+	defer span.End()
+
+	err := s.db.QueryRowContext(ctx, query,
+		key.Name, key.Prefix, hash, pq.Array(key.Scopes), key.DailyQuota, key.ExpiresAt, key.CreatedBy,
+	).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		if err := mapConflict(err); errors.Is(err, ErrConflict) {
+			return fmt.Errorf("creating api key: %w", err)
+		}
+		return span.Fail(fmt.Errorf("creating api key: %w", err))
+	}
+
+	return nil
+}
+
+const apiKeyColumns = `id, name, prefix, scopes, daily_quota, expires_at, created_by, created_at, last_used_at, revoked_at`
+
+func scanAPIKey(row interface{ Scan(...any) error }) (*APIKey, error) {
+	var key APIKey
+	err := row.Scan(&key.ID, &key.Name, &key.Prefix, pq.Array(&key.Scopes), &key.DailyQuota,
+		&key.ExpiresAt, &key.CreatedBy, &key.CreatedAt, &key.LastUsedAt, &key.RevokedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (s *APIKeysStorage) GetByHash(ctx context.Context, hash string) (*APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = $1`
+
+	ctx, span := startQuerySpan(ctx, "APIKeysStorage.GetByHash", query)
+	defer span.End()
+
+	key, err := scanAPIKey(s.db.QueryRowContext(ctx, query, hash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("api key: %w", ErrNotFound)
+		}
+		return nil, span.Fail(err)
+	}
+
+	return key, nil
+}
+
+func (s *APIKeysStorage) List(ctx context.Context) ([]APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY id`
+
+	ctx, span := startQuerySpan(ctx, "APIKeysStorage.List", query)
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, span.Fail(err)
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, span.Fail(err)
+		}
+		keys = append(keys, *key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, span.Fail(err)
+	}
+
+	return keys, nil
+}
+
+func (s *APIKeysStorage) Revoke(ctx context.Context, id int64) error {
+	query := `UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`
+
+	ctx, span := startQuerySpan(ctx, "APIKeysStorage.Revoke", query)
+	defer span.End()
+
+	res, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return span.Fail(err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("api key %d: %w", id, ErrNotFound)
+	}
+
+	return nil
+}
+
+// RecordUsage counts one request for the key on the UTC day of now and
+// returns the day's total so far.
+func (s *APIKeysStorage) RecordUsage(ctx context.Context, id int64, now time.Time) (int64, error) {
+	query := `
+		WITH touched AS (
+			UPDATE api_keys SET last_used_at = $2 WHERE id = $1
+		)
+		INSERT INTO api_key_usage (api_key_id, day, requests)
+		VALUES ($1, ($2::timestamptz AT TIME ZONE 'UTC')::date, 1)
+		ON CONFLICT (api_key_id, day) DO UPDATE SET requests = api_key_usage.requests + 1
+		RETURNING requests
+	`
+
+	ctx, span := startQuerySpan(ctx, "APIKeysStorage.RecordUsage", query)
+	defer span.End()
+
+	var requests int64
+	if err := s.db.QueryRowContext(ctx, query, id, now).Scan(&requests); err != nil {
+		return 0, span.Fail(fmt.Errorf("recording api key usage: %w", err))
+	}
+
+	return requests, nil
+}
+
+// GetUsage returns the per-day request counts of the key for the last days
+// days, most recent first. It returns ErrNotFound when the key does not
+// exist.
+func (s *APIKeysStorage) GetUsage(ctx context.Context, id int64, days int) ([]APIKeyUsage, error) {
+	// The key is joined in so that a key without recent usage is told apart
+	// from one that does not exist.
+	query := `
+		SELECT to_char(u.day, 'YYYY-MM-DD'), u.requests
+		FROM api_keys k
+		LEFT JOIN api_key_usage u
+			ON u.api_key_id = k.id AND u.day > (NOW() AT TIME ZONE 'UTC')::date - $2::int
+		WHERE k.id = $1
+		ORDER BY u.day DESC
+	`
+
+	ctx, span := startQuerySpan(ctx, "APIKeysStorage.GetUsage", query)
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query, id, days)
+	if err != nil {
+		return nil, span.Fail(err)
+	}
+	defer rows.Close()
+
+	found := false
+	usage := []APIKeyUsage{}
+	for rows.Next() {
+		var (
+			day      sql.NullString
+			requests sql.NullInt64
+		)
+		if err := rows.Scan(&day, &requests); err != nil {
+			return nil, span.Fail(err)
+		}
+		found = true
+		if day.Valid {
+			usage = append(usage, APIKeyUsage{Day: day.String, Requests: requests.Int64})
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, span.Fail(err)
+	}
+	if !found {
+		return nil, fmt.Errorf("api key %d: %w", id, ErrNotFound)
+	}
+
+	return usage, nil
+}
@@ -1,10 +1,13 @@
 package data
 
 import (
+	"backend/internal/tracing"
 	"context"
 	"database/sql"
 	"fmt"
 	"time"
+
+	"go.uber.org/zap"
 )
 
 type Delay struct {
@@ -62,11 +65,11 @@ type LineAverageDelay struct {
 }
 
 type DelayReportInput struct {
-	Date      time.Time `json:"date"`
-	DelayMin  int       `json:"delay_min"`
-	StopID    int64     `json:"stop_id"`
-	LineID    int64     `json:"line_id"`
-	UserEmail string    `json:"user_email"`
+	Date      time.Time `json:"date" validate:"required"`
+	DelayMin  int       `json:"delay_min" validate:"required,min=1,max=600"`
+	StopID    int64     `json:"stop_id" validate:"required,min=1"`
+	LineID    int64     `json:"line_id" validate:"required,min=1"`
+	UserEmail string    `json:"user_email" validate:"required,email"`
 }
 
 type DelayReportInputUnMarshaled struct {
@@ -77,8 +80,23 @@ type DelayReportInputUnMarshaled struct {
 	UserId   int       `json:"user_id"`
 }
 
+// DelayAuditSubmitted is the action recorded when a delay report is filed.
+const DelayAuditSubmitted = "submitted"
+
+// DelayAudit records who changed a delay report. UserID is the user the
+// report is filed under and APIKeyID the key the request was made with.
+type DelayAudit struct {
+	ID        int64     `json:"id"`
+	DelayID   int       `json:"delay_id"`
+	Action    string    `json:"action"`
+	UserID    *int      `json:"user_id,omitempty"`
+	APIKeyID  *int64    `json:"api_key_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 type DelaysStorage struct {
-	db *sql.DB
+	db     querier
+	logger *zap.SugaredLogger
 }
 
 func (s *DelaysStorage) GetDelaysByStop(ctx context.Context, stopID int64) ([]Delay, error) {
@@ -99,9 +117,12 @@ func (s *DelaysStorage) GetDelaysByStop(ctx context.Context, stopID int64) ([]De
 	ORDER BY d.date DESC, d.id DESC;
 	`
 
+	ctx, span := startQuerySpan(ctx, "DelaysStorage.GetDelaysByStop", query)
+	defer span.End()
+
 	rows, err := s.db.QueryContext(ctx, query, stopID)
 	if err != nil {
-		return nil, fmt.Errorf("query failed: %w", err)
+		return nil, span.Fail(fmt.Errorf("query failed: %w", err))
 	}
 	defer rows.Close()
 
@@ -118,15 +139,17 @@ func (s *DelaysStorage) GetDelaysByStop(ctx context.Context, stopID int64) ([]De
 			&d.Username,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("row scan failed: %w", err)
+			return nil, span.Fail(fmt.Errorf("row scan failed: %w", err))
 		}
 		delays = append(delays, d)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("row iteration failed: %w", err)
+		return nil, span.Fail(fmt.Errorf("row iteration failed: %w", err))
 	}
 
+	span.SetAttributes(tracing.Int("db.rows", len(delays)))
+
 	return delays, nil
 }
 
@@ -148,9 +171,12 @@ func (s *DelaysStorage) GetRecentDelaysByLine(ctx context.Context, lineID int64)
 	LIMIT 8;
 	`
 
+	ctx, span := startQuerySpan(ctx, "DelaysStorage.GetRecentDelaysByLine", query)
+	defer span.End()
+
 	rows, err := s.db.QueryContext(ctx, query, lineID)
 	if err != nil {
-		return nil, fmt.Errorf("query failed: %w", err)
+		return nil, span.Fail(fmt.Errorf("query failed: %w", err))
 	}
 	defer rows.Close()
 
@@ -167,15 +193,17 @@ func (s *DelaysStorage) GetRecentDelaysByLine(ctx context.Context, lineID int64)
 			&d.Username,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("row scan failed: %w", err)
+			return nil, span.Fail(fmt.Errorf("row scan failed: %w", err))
 		}
 		delays = append(delays, d)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("row iteration failed: %w", err)
+		return nil, span.Fail(fmt.Errorf("row iteration failed: %w", err))
 	}
 
+	span.SetAttributes(tracing.Int("db.rows", len(delays)))
+
 	return delays, nil
 }
 
@@ -196,9 +224,12 @@ func (s *DelaysStorage) GetDelaysByUser(ctx context.Context, userID int64) ([]Us
 	ORDER BY d.date DESC, d.id DESC;
 	`
 
+	ctx, span := startQuerySpan(ctx, "DelaysStorage.GetDelaysByUser", query)
+	defer span.End()
+
 	rows, err := s.db.QueryContext(ctx, query, userID)
 	if err != nil {
-		return nil, fmt.Errorf("query failed: %w", err)
+		return nil, span.Fail(fmt.Errorf("query failed: %w", err))
 	}
 	defer rows.Close()
 
@@ -215,15 +246,17 @@ func (s *DelaysStorage) GetDelaysByUser(ctx context.Context, userID int64) ([]Us
 			&d.LineCode,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("row scan failed: %w", err)
+			return nil, span.Fail(fmt.Errorf("row scan failed: %w", err))
 		}
 		delays = append(delays, d)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("row iteration failed: %w", err)
+		return nil, span.Fail(fmt.Errorf("row iteration failed: %w", err))
 	}
 
+	span.SetAttributes(tracing.Int("db.rows", len(delays)))
+
 	return delays, nil
 }
 
@@ -247,9 +280,12 @@ func (s *DelaysStorage) GetMostRecentDelays(ctx context.Context) ([]MostRecentDe
 	LIMIT 15;
 	`
 
+	ctx, span := startQuerySpan(ctx, "DelaysStorage.GetMostRecentDelays", query)
+	defer span.End()
+
 	rows, err := s.db.QueryContext(ctx, query)
 	if err != nil {
-		return nil, fmt.Errorf("query failed: %w", err)
+		return nil, span.Fail(fmt.Errorf("query failed: %w", err))
 	}
 	defer rows.Close()
 
@@ -268,15 +304,17 @@ func (s *DelaysStorage) GetMostRecentDelays(ctx context.Context) ([]MostRecentDe
 			&d.Username,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("row scan failed: %w", err)
+			return nil, span.Fail(fmt.Errorf("row scan failed: %w", err))
 		}
 		delays = append(delays, d)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("row iteration failed: %w", err)
+		return nil, span.Fail(fmt.Errorf("row iteration failed: %w", err))
 	}
 
+	span.SetAttributes(tracing.Int("db.rows", len(delays)))
+
 	return delays, nil
 }
 
@@ -289,12 +327,15 @@ func (s *DelaysStorage) GetDelayCountsByLine(ctx context.Context) ([]LineDelayCo
 	FROM lines AS l
 	LEFT JOIN delays AS d ON l.id = d.line_id
 	GROUP BY l.id, l.line_code
-	ORDER BY delay_count DESC;
+	ORDER BY delay_count DESC, l.id;
 	`
 
+	ctx, span := startQuerySpan(ctx, "DelaysStorage.GetDelayCountsByLine", query)
+	defer span.End()
+
 	rows, err := s.db.QueryContext(ctx, query)
 	if err != nil {
-		return nil, fmt.Errorf("query failed: %w", err)
+		return nil, span.Fail(fmt.Errorf("query failed: %w", err))
 	}
 	defer rows.Close()
 
@@ -303,15 +344,17 @@ func (s *DelaysStorage) GetDelayCountsByLine(ctx context.Context) ([]LineDelayCo
 		var r LineDelayCount
 		err := rows.Scan(&r.LineID, &r.LineCode, &r.DelayCount)
 		if err != nil {
-			return nil, fmt.Errorf("row scan failed: %w", err)
+			return nil, span.Fail(fmt.Errorf("row scan failed: %w", err))
 		}
 		results = append(results, r)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("row iteration failed: %w", err)
+		return nil, span.Fail(fmt.Errorf("row iteration failed: %w", err))
 	}
 
+	span.SetAttributes(tracing.Int("db.rows", len(results)))
+
 	return results, nil
 }
 
@@ -327,6 +370,9 @@ func (s *DelaysStorage) GetAverageDelayForLine(ctx context.Context, lineID int64
 	GROUP BY d.line_id, l.line_code;
 	`
 
+	ctx, span := startQuerySpan(ctx, "DelaysStorage.GetAverageDelayForLine", query)
+	defer span.End()
+
 	row := s.db.QueryRowContext(ctx, query, lineID)
 
 	var result LineAverageDelay
@@ -335,7 +381,7 @@ func (s *DelaysStorage) GetAverageDelayForLine(ctx context.Context, lineID int64
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
-		return nil, fmt.Errorf("row scan failed: %w", err)
+		return nil, span.Fail(fmt.Errorf("row scan failed: %w", err))
 	}
 
 	return &result, nil
@@ -348,10 +394,13 @@ func (s *DelaysStorage) GetOverallAverageDelay(ctx context.Context) (float64, er
 	FROM delays;
 	`
 
+	ctx, span := startQuerySpan(ctx, "DelaysStorage.GetOverallAverageDelay", query)
+	defer span.End()
+
 	var avgDelay sql.NullFloat64
 	err := s.db.QueryRowContext(ctx, query).Scan(&avgDelay)
 	if err != nil {
-		return 0, fmt.Errorf("query failed: %w", err)
+		return 0, span.Fail(fmt.Errorf("query failed: %w", err))
 	}
 
 	if !avgDelay.Valid {
@@ -361,13 +410,19 @@ func (s *DelaysStorage) GetOverallAverageDelay(ctx context.Context) (float64, er
 	return avgDelay.Float64, nil
 }
 
-func (s *DelaysStorage) InsertDelay(ctx context.Context, input DelayReportInputUnMarshaled) error {
+// InsertDelay stores a delay report and returns its ID.
+func (s *DelaysStorage) InsertDelay(ctx context.Context, input DelayReportInputUnMarshaled) (int, error) {
 	query := `
 		INSERT INTO delays (date, delay_min, stop_id, line_id, user_id)
-		VALUES ($1, $2, $3, $4, $5);
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id;
 	`
 
-	_, err := s.db.ExecContext(
+	ctx, span := startQuerySpan(ctx, "DelaysStorage.InsertDelay", query)
+	defer span.End()
+
+	var id int
+	err := s.db.QueryRowContext(
 		ctx,
 		query,
 		input.Date,
@@ -375,11 +430,177 @@ func (s *DelaysStorage) InsertDelay(ctx context.Context, input DelayReportInputU
 		input.StopID,
 		input.LineID,
 		input.UserId,
-	)
+	).Scan(&id)
 
 	if err != nil {
-		return fmt.Errorf("failed to insert delay: %w", err)
+		return 0, span.Fail(fmt.Errorf("failed to insert delay: %w", err))
+	}
+
+	return id, nil
+}
+
+// InsertAudit records a change to a delay report and sets a's ID and
+// CreatedAt.
+func (s *DelaysStorage) InsertAudit(ctx context.Context, a *DelayAudit) error {
+	query := `
+		INSERT INTO delay_audit (delay_id, action, user_id, api_key_id)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at;
+	`
+
+	ctx, span := startQuerySpan(ctx, "DelaysStorage.InsertAudit", query)
+	defer span.End()
+
+	err := s.db.QueryRowContext(ctx, query, a.DelayID, a.Action, a.UserID, a.APIKeyID).Scan(&a.ID, &a.CreatedAt)
+	if err != nil {
+		return span.Fail(fmt.Errorf("failed to insert delay audit: %w", err))
 	}
 
 	return nil
 }
+
+// ListAudit returns the audit trail of a delay report, oldest first.
+func (s *DelaysStorage) ListAudit(ctx context.Context, delayID int) ([]DelayAudit, error) {
+	query := `
+		SELECT id, delay_id, action, user_id, api_key_id, created_at
+		FROM delay_audit
+		WHERE delay_id = $1
+		ORDER BY id;
+	`
+
+	ctx, span := startQuerySpan(ctx, "DelaysStorage.ListAudit", query)
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query, delayID)
+	if err != nil {
+		return nil, span.Fail(fmt.Errorf("query failed: %w", err))
+	}
+	defer rows.Close()
+
+	audit := []DelayAudit{}
+	for rows.Next() {
+		var a DelayAudit
+		if err := rows.Scan(&a.ID, &a.DelayID, &a.Action, &a.UserID, &a.APIKeyID, &a.CreatedAt); err != nil {
+			return nil, span.Fail(fmt.Errorf("row scan failed: %w", err))
+		}
+		audit = append(audit, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, span.Fail(fmt.Errorf("row iteration failed: %w", err))
+	}
+
+	span.SetAttributes(tracing.Int("db.rows", len(audit)))
+
+	return audit, nil
+}
+
+// DelayFilter selects recent delay reports. Zero IDs match every stop or
+// line.
+type DelayFilter struct {
+	StopID int64
+	LineID int64
+	// Since is the first calendar day included.
+	Since time.Time
+	Limit int
+}
+
+// DelayReport is a delay report with its stop and line resolved.
+type DelayReport struct {
+	ID       int       `json:"id"`
+	Date     time.Time `json:"date"`
+	DelayMin int       `json:"delay_min"`
+	StopID   int       `json:"stop_id"`
+	StopName string    `json:"stop_name"`
+	LineID   int       `json:"line_id"`
+	LineCode string    `json:"line_code"`
+}
+
+// GetRecentDelays returns the reports matching f, newest first.
+func (s *DelaysStorage) GetRecentDelays(ctx context.Context, f DelayFilter) ([]DelayReport, error) {
+	query := `
+		SELECT d.id, d.date, d.delay_min, d.stop_id, s.name, d.line_id, l.line_code
+		FROM delays AS d
+		JOIN stops  AS s ON s.id = d.stop_id
+		JOIN lines  AS l ON l.id = d.line_id
+		WHERE d.date >= $1::date
+		  AND ($2::int = 0 OR d.stop_id = $2)
+		  AND ($3::int = 0 OR d.line_id = $3)
+		ORDER BY d.date DESC, d.id DESC
+		LIMIT $4
+	`
+
+	ctx, span := startQuerySpan(ctx, "DelaysStorage.GetRecentDelays", query)
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query, f.Since.Format("2006-01-02"), f.StopID, f.LineID, f.Limit)
+	if err != nil {
+		return nil, span.Fail(fmt.Errorf("query failed: %w", err))
+	}
+	defer rows.Close()
+
+	reports := []DelayReport{}
+	for rows.Next() {
+		var d DelayReport
+		if err := rows.Scan(&d.ID, &d.Date, &d.DelayMin, &d.StopID, &d.StopName, &d.LineID, &d.LineCode); err != nil {
+			return nil, span.Fail(fmt.Errorf("row scan failed: %w", err))
+		}
+		reports = append(reports, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, span.Fail(fmt.Errorf("row iteration failed: %w", err))
+	}
+
+	span.SetAttributes(tracing.Int("db.rows", len(reports)))
+
+	return reports, nil
+}
+
+// StopDelayHeat is how late buses have been at a stop: the number of delay
+// reports there and their average in minutes.
+type StopDelayHeat struct {
+	StopID       int     `json:"stop_id"`
+	Latitude     float64 `json:"latitude"`
+	Longitude    float64 `json:"longitude"`
+	Reports      int     `json:"reports"`
+	AvgDelayMins float64 `json:"avg_delay_mins"`
+}
+
+// GetDelayHeat returns the delay heat of every stop with reports since the
+// given calendar day, by stop.
+func (s *DelaysStorage) GetDelayHeat(ctx context.Context, since time.Time) ([]StopDelayHeat, error) {
+	query := `
+		SELECT s.id, s.latitude, s.longitude, COUNT(d.id), AVG(d.delay_min)::NUMERIC(10,2)
+		FROM delays AS d
+		JOIN stops  AS s ON s.id = d.stop_id
+		WHERE d.date >= $1::date
+		GROUP BY s.id
+		ORDER BY s.id
+	`
+
+	ctx, span := startQuerySpan(ctx, "DelaysStorage.GetDelayHeat", query)
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query, since.Format("2006-01-02"))
+	if err != nil {
+		return nil, span.Fail(fmt.Errorf("query failed: %w", err))
+	}
+	defer rows.Close()
+
+	heat := []StopDelayHeat{}
+	for rows.Next() {
+		var h StopDelayHeat
+		if err := rows.Scan(&h.StopID, &h.Latitude, &h.Longitude, &h.Reports, &h.AvgDelayMins); err != nil {
+			return nil, span.Fail(fmt.Errorf("row scan failed: %w", err))
+		}
+		heat = append(heat, h)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, span.Fail(fmt.Errorf("row iteration failed: %w", err))
+	}
+
+	span.SetAttributes(tracing.Int("db.rows", len(heat)))
+
+	return heat, nil
+}
@@ -0,0 +1,51 @@
+package data
+
+import (
+	"errors"
+	"strings"
+)
+
+// Domain errors returned by the storage layer. Handlers map these to HTTP
+// status codes, so implementations should wrap them with fmt.Errorf("...: %w")
+// instead of returning raw driver errors for expected conditions.
+var (
+	ErrNotFound   = errors.New("resource not found")
+	ErrConflict   = errors.New("resource already exists")
+	ErrValidation = errors.New("validation failed")
+)
+
+// FieldError describes a single invalid field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError groups every field error found while checking a request.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func NewValidationError(field, code, message string) *ValidationError {
+	return &ValidationError{Fields: []FieldError{{Field: field, Code: code, Message: message}}}
+}
+
+func (e *ValidationError) Add(field, code, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Code: code, Message: message})
+}
+
+func (e *ValidationError) HasErrors() bool {
+	return len(e.Fields) > 0
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		msgs = append(msgs, f.Field+": "+f.Message)
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
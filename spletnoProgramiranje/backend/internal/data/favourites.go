@@ -0,0 +1,210 @@
+package data
+
+import (
+	"backend/internal/tracing"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Favourite kinds, derived from which of StopID and LineID are set.
+const (
+	FavouriteStop     = "stop"
+	FavouriteLine     = "line"
+	FavouriteStopLine = "stop_line"
+)
+
+// Favourite is a stop, a line or a line at a specific stop that a user
+// pinned to their board. Favourites are shown in ascending Position.
+type Favourite struct {
+	ID        int64     `json:"id"`
+	UserID    int       `json:"-"`
+	Kind      string    `json:"kind"`
+	StopID    *int      `json:"stop_id,omitempty"`
+	StopName  string    `json:"stop_name,omitempty"`
+	LineID    *int      `json:"line_id,omitempty"`
+	LineCode  string    `json:"line_code,omitempty"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FavouriteKind returns the kind of a favourite referencing the given stop
+// and line, either of which may be nil.
+func FavouriteKind(stopID, lineID *int) string {
+	switch {
+	case stopID != nil && lineID != nil:
+		return FavouriteStopLine
+	case stopID != nil:
+		return FavouriteStop
+	default:
+		return FavouriteLine
+	}
+}
+
+type CreateFavouritePayload struct {
+	StopID *int `json:"stop_id" validate:"omitempty,min=1"`
+	LineID *int `json:"line_id" validate:"omitempty,min=1"`
+}
+
+// ReorderFavouritesPayload lists every favourite of the user in the new
+// order.
+type ReorderFavouritesPayload struct {
+	IDs []int64 `json:"ids" validate:"required"`
+}
+
+type FavouritesStorage struct {
+	db     querier
+	logger *zap.SugaredLogger
+}
+
+func scanFavourite(row interface{ Scan(...any) error }) (*Favourite, error) {
+	var (
+		f        Favourite
+		stopID   sql.NullInt64
+		stopName sql.NullString
+		lineID   sql.NullInt64
+		lineCode sql.NullString
+	)
+	if err := row.Scan(&f.ID, &f.UserID, &stopID, &stopName, &lineID, &lineCode, &f.Position, &f.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	if stopID.Valid {
+		id := int(stopID.Int64)
+		f.StopID = &id
+		f.StopName = stopName.String
+	}
+	if lineID.Valid {
+		id := int(lineID.Int64)
+		f.LineID = &id
+		f.LineCode = lineCode.String
+	}
+	f.Kind = FavouriteKind(f.StopID, f.LineID)
+
+	return &f, nil
+}
+
+const favouriteSelect = `
+	SELECT f.id, f.user_id, f.stop_id, s.name, f.line_id, l.line_code, f.position, f.created_at
+	FROM favourites AS f
+	LEFT JOIN stops AS s ON s.id = f.stop_id
+	LEFT JOIN lines AS l ON l.id = f.line_id
+`
+
+// List returns the favourites of a user in board order.
+func (s *FavouritesStorage) List(ctx context.Context, userID int) ([]Favourite, error) {
+	query := favouriteSelect + `WHERE f.user_id = $1 ORDER BY f.position, f.id`
+
+	ctx, span := startQuerySpan(ctx, "FavouritesStorage.List", query)
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, span.Fail(err)
+	}
+	defer rows.Close()
+
+	favourites := []Favourite{}
+	for rows.Next() {
+		f, err := scanFavourite(rows)
+		if err != nil {
+			return nil, span.Fail(err)
+		}
+		favourites = append(favourites, *f)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, span.Fail(err)
+	}
+
+	span.SetAttributes(tracing.Int("db.rows", len(favourites)))
+
+	return favourites, nil
+}
+
+// Create appends a favourite to the end of the user's board. It returns
+// ErrConflict when the user already has the same favourite and ErrNotFound
+// when the stop or line does not exist.
+func (s *FavouritesStorage) Create(ctx context.Context, f *Favourite) error {
+	query := `
+		WITH f AS (
+			INSERT INTO favourites (user_id, stop_id, line_id, position)
+			VALUES ($1, $2, $3, (SELECT COALESCE(MAX(position) + 1, 0) FROM favourites WHERE user_id = $1))
+			RETURNING id, user_id, stop_id, line_id, position, created_at
+		)
+		SELECT f.id, f.user_id, f.stop_id, s.name, f.line_id, l.line_code, f.position, f.created_at
+		FROM f
+		LEFT JOIN stops AS s ON s.id = f.stop_id
+		LEFT JOIN lines AS l ON l.id = f.line_id
+	`
+
+	ctx, span := startQuerySpan(ctx, "FavouritesStorage.Create", query)
+	defer span.End()
+
+	created, err := scanFavourite(s.db.QueryRowContext(ctx, query, f.UserID, f.StopID, f.LineID))
+	if err != nil {
+		if err := mapMissingReference(mapConflict(err)); errors.Is(err, ErrConflict) || errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("creating favourite: %w", err)
+		}
+		return span.Fail(fmt.Errorf("creating favourite: %w", err))
+	}
+
+	*f = *created
+
+	return nil
+}
+
+// Delete removes a favourite of the user. Favourites of other users are
+// reported as ErrNotFound.
+func (s *FavouritesStorage) Delete(ctx context.Context, userID int, id int64) error {
+	query := `DELETE FROM favourites WHERE id = $1 AND user_id = $2`
+
+	ctx, span := startQuerySpan(ctx, "FavouritesStorage.Delete", query)
+	defer span.End()
+
+	res, err := s.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return span.Fail(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return span.Fail(err)
+	}
+	if n == 0 {
+		return fmt.Errorf("favourite %d: %w", id, ErrNotFound)
+	}
+
+	return nil
+}
+
+// Reorder gives the listed favourites of the user the positions 0, 1, ...
+// in slice order. An ID that is not a favourite of the user is reported as
+// ErrNotFound; run it in a transaction to keep the board consistent.
+func (s *FavouritesStorage) Reorder(ctx context.Context, userID int, ids []int64) error {
+	query := `UPDATE favourites SET position = $1 WHERE id = $2 AND user_id = $3`
+
+	ctx, span := startQuerySpan(ctx, "FavouritesStorage.Reorder", query)
+	defer span.End()
+
+	for position, id := range ids {
+		res, err := s.db.ExecContext(ctx, query, position, id, userID)
+		if err != nil {
+			return span.Fail(err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return span.Fail(err)
+		}
+		if n == 0 {
+			return fmt.Errorf("favourite %d: %w", id, ErrNotFound)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,300 @@
+package memory
+
+import (
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+type AlertsStorage struct {
+	s *store
+}
+
+// resolveSubscription fills in the names the Postgres storage joins in.
+func (s *store) resolveSubscription(sub data.AlertSubscription) data.AlertSubscription {
+	sub.LineCode, sub.Direction, sub.StopName = "", "", ""
+	if sub.LineID != nil {
+		if l, ok := s.line(*sub.LineID); ok {
+			sub.LineCode = l.LineCode
+		}
+	}
+	if sub.DirectionID != nil {
+		if d, ok := s.direction(*sub.DirectionID); ok {
+			sub.Direction = d.Name
+		}
+	}
+	if sub.StopID != nil {
+		if st, ok := s.stop(*sub.StopID); ok {
+			sub.StopName = st.Name
+		}
+	}
+	sub.Weekdays = slices.Clone(sub.Weekdays)
+	if sub.Weekdays == nil {
+		sub.Weekdays = []string{}
+	}
+	return sub
+}
+
+func (s *store) subscription(id int64) (data.AlertSubscription, bool) {
+	for _, sub := range s.alertSubs {
+		if sub.ID == id {
+			return sub, true
+		}
+	}
+	return data.AlertSubscription{}, false
+}
+
+// resolveDelivery fills in the subscription columns the Postgres storage
+// joins in.
+func (s *store) resolveDelivery(d data.AlertDelivery) data.AlertDelivery {
+	if sub, ok := s.subscription(d.SubscriptionID); ok {
+		d.Channel, d.Target, d.Secret = sub.Channel, sub.Target, sub.Secret
+	}
+	d.Payload = slices.Clone(d.Payload)
+	return d
+}
+
+func (s *AlertsStorage) ListSubscriptions(ctx context.Context, userID int) ([]data.AlertSubscription, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	subs := []data.AlertSubscription{}
+	for _, sub := range s.s.alertSubs {
+		if sub.UserID == userID {
+			subs = append(subs, s.s.resolveSubscription(sub))
+		}
+	}
+
+	return subs, nil
+}
+
+func (s *AlertsStorage) AllSubscriptions(ctx context.Context) ([]data.AlertSubscription, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	subs := []data.AlertSubscription{}
+	for _, sub := range s.s.alertSubs {
+		subs = append(subs, s.s.resolveSubscription(sub))
+	}
+
+	return subs, nil
+}
+
+func (s *AlertsStorage) CreateSubscription(ctx context.Context, sub *data.AlertSubscription) error {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	if _, ok := s.s.user(sub.UserID); !ok {
+		return fmt.Errorf("creating alert subscription: user %d: %w", sub.UserID, data.ErrNotFound)
+	}
+	if sub.LineID != nil {
+		if _, ok := s.s.line(*sub.LineID); !ok {
+			return fmt.Errorf("creating alert subscription: line %d: %w", *sub.LineID, data.ErrNotFound)
+		}
+	}
+	if sub.DirectionID != nil {
+		if _, ok := s.s.direction(*sub.DirectionID); !ok {
+			return fmt.Errorf("creating alert subscription: direction %d: %w", *sub.DirectionID, data.ErrNotFound)
+		}
+	}
+	if sub.StopID != nil {
+		if _, ok := s.s.stop(*sub.StopID); !ok {
+			return fmt.Errorf("creating alert subscription: stop %d: %w", *sub.StopID, data.ErrNotFound)
+		}
+	}
+
+	s.s.nextAlertSubID++
+	row := *sub
+	row.ID = s.s.nextAlertSubID
+	row.Weekdays = slices.Clone(sub.Weekdays)
+	row.CreatedAt = s.s.now().UTC()
+	s.s.alertSubs = append(s.s.alertSubs, row)
+
+	*sub = s.s.resolveSubscription(row)
+
+	return nil
+}
+
+func (s *AlertsStorage) DeleteSubscription(ctx context.Context, userID int, id int64) error {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	for i, sub := range s.s.alertSubs {
+		if sub.ID == id && sub.UserID == userID {
+			s.s.alertSubs = append(s.s.alertSubs[:i:i], s.s.alertSubs[i+1:]...)
+			s.s.deliveries = slices.DeleteFunc(slices.Clone(s.s.deliveries), func(d data.AlertDelivery) bool {
+				return d.SubscriptionID == id
+			})
+			return nil
+		}
+	}
+
+	return fmt.Errorf("alert subscription %d: %w", id, data.ErrNotFound)
+}
+
+func (s *AlertsStorage) ReadIncidents(ctx context.Context, afterDelayID, limit int) ([]data.AlertIncident, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	delays := slices.Clone(s.s.delays)
+	sort.Slice(delays, func(i, j int) bool { return delays[i].ID < delays[j].ID })
+
+	incidents := []data.AlertIncident{}
+	for _, d := range delays {
+		if d.ID <= afterDelayID {
+			continue
+		}
+		if len(incidents) == limit {
+			break
+		}
+		stop, stopOK := s.s.stop(d.StopID)
+		line, lineOK := s.s.line(d.LineID)
+		if !stopOK || !lineOK {
+			continue
+		}
+
+		directions := []int64{}
+		for _, dep := range s.s.departures {
+			dir, ok := s.s.direction(dep.DirectionID)
+			if dep.StopID == d.StopID && ok && dir.LineID == d.LineID && !slices.Contains(directions, int64(dir.ID)) {
+				directions = append(directions, int64(dir.ID))
+			}
+		}
+		slices.Sort(directions)
+
+		incidents = append(incidents, data.AlertIncident{
+			DelayID:      d.ID,
+			ReportedAt:   d.reportedAt,
+			DelayMin:     d.DelayMin,
+			StopID:       d.StopID,
+			StopName:     stop.Name,
+			LineID:       d.LineID,
+			LineCode:     line.LineCode,
+			DirectionIDs: directions,
+		})
+	}
+
+	return incidents, nil
+}
+
+func (s *AlertsStorage) Cursor(ctx context.Context) (int, error) {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	if s.s.alertCursor == nil {
+		cursor := 0
+		for _, d := range s.s.delays {
+			cursor = max(cursor, d.ID)
+		}
+		s.s.alertCursor = &cursor
+	}
+
+	return *s.s.alertCursor, nil
+}
+
+func (s *AlertsStorage) SetCursor(ctx context.Context, delayID int) error {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	s.s.alertCursor = &delayID
+
+	return nil
+}
+
+func (s *AlertsStorage) EnqueueDelivery(ctx context.Context, d *data.AlertDelivery) error {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	if _, ok := s.s.subscription(d.SubscriptionID); !ok {
+		return fmt.Errorf("enqueuing alert delivery: subscription %d: %w", d.SubscriptionID, data.ErrNotFound)
+	}
+	for _, existing := range s.s.deliveries {
+		if existing.SubscriptionID == d.SubscriptionID && existing.DelayID == d.DelayID {
+			return nil
+		}
+	}
+
+	s.s.nextDeliveryID++
+	s.s.deliveries = append(s.s.deliveries, data.AlertDelivery{
+		ID:             s.s.nextDeliveryID,
+		SubscriptionID: d.SubscriptionID,
+		DelayID:        d.DelayID,
+		Payload:        slices.Clone(d.Payload),
+		Status:         data.DeliveryPending,
+		NextAttemptAt:  d.NextAttemptAt,
+		CreatedAt:      s.s.now().UTC(),
+	})
+
+	return nil
+}
+
+func (s *AlertsStorage) ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]data.AlertDelivery, error) {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	var due []int
+	for i, d := range s.s.deliveries {
+		if d.Status == data.DeliveryPending && !d.NextAttemptAt.After(now) {
+			due = append(due, i)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		return s.s.deliveries[due[i]].NextAttemptAt.Before(s.s.deliveries[due[j]].NextAttemptAt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	slices.Sort(due)
+
+	claimed := []data.AlertDelivery{}
+	for _, i := range due {
+		row := s.s.deliveries[i]
+		row.NextAttemptAt = now.Add(lease)
+		s.s.deliveries[i] = row
+		claimed = append(claimed, s.s.resolveDelivery(row))
+	}
+
+	return claimed, nil
+}
+
+func (s *AlertsStorage) UpdateDelivery(ctx context.Context, d *data.AlertDelivery) error {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	for i, existing := range s.s.deliveries {
+		if existing.ID != d.ID {
+			continue
+		}
+		row := existing
+		row.Status = d.Status
+		row.Attempts = d.Attempts
+		row.LastError = d.LastError
+		row.NextAttemptAt = d.NextAttemptAt
+		row.DeliveredAt = d.DeliveredAt
+		s.s.deliveries[i] = row
+		return nil
+	}
+
+	return fmt.Errorf("alert delivery %d: %w", d.ID, data.ErrNotFound)
+}
+
+func (s *AlertsStorage) ListDeliveries(ctx context.Context, userID int, subscriptionID int64, limit int) ([]data.AlertDelivery, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	if sub, ok := s.s.subscription(subscriptionID); !ok || sub.UserID != userID {
+		return nil, fmt.Errorf("alert subscription %d: %w", subscriptionID, data.ErrNotFound)
+	}
+
+	deliveries := []data.AlertDelivery{}
+	for i := len(s.s.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if d := s.s.deliveries[i]; d.SubscriptionID == subscriptionID {
+			deliveries = append(deliveries, s.s.resolveDelivery(d))
+		}
+	}
+
+	return deliveries, nil
+}
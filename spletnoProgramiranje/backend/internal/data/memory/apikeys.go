@@ -0,0 +1,141 @@
+package memory
+
+import (
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+type APIKeysStorage struct {
+	s *store
+}
+
+// copyKey returns k with its own Scopes slice so callers cannot mutate the
+// stored key.
+func copyKey(k data.APIKey) data.APIKey {
+	k.Scopes = append([]string(nil), k.Scopes...)
+	return k
+}
+
+func (s *APIKeysStorage) Create(ctx context.Context, key *data.APIKey, hash string) error {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	for _, k := range s.s.apiKeys {
+		if k.hash == hash {
+			return fmt.Errorf("creating api key: %w", data.ErrConflict)
+		}
+	}
+
+	s.s.nextAPIKeyID++
+	key.ID = s.s.nextAPIKeyID
+	key.CreatedAt = s.s.now().UTC()
+
+	s.s.apiKeys = append(s.s.apiKeys, apiKey{APIKey: copyKey(*key), hash: hash})
+
+	return nil
+}
+
+func (s *APIKeysStorage) GetByHash(ctx context.Context, hash string) (*data.APIKey, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	for _, k := range s.s.apiKeys {
+		if k.hash == hash {
+			key := copyKey(k.APIKey)
+			return &key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("api key: %w", data.ErrNotFound)
+}
+
+func (s *APIKeysStorage) List(ctx context.Context) ([]data.APIKey, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	keys := []data.APIKey{}
+	for _, k := range s.s.apiKeys {
+		keys = append(keys, copyKey(k.APIKey))
+	}
+
+	return keys, nil
+}
+
+func (s *APIKeysStorage) Revoke(ctx context.Context, id int64) error {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	for i := range s.s.apiKeys {
+		k := &s.s.apiKeys[i]
+		if k.ID == id && k.RevokedAt == nil {
+			now := s.s.now().UTC()
+			k.RevokedAt = &now
+			return nil
+		}
+	}
+
+	return fmt.Errorf("api key %d: %w", id, data.ErrNotFound)
+}
+
+// RecordUsage counts one request for the key on the UTC day of now and
+// returns the day's total so far.
+func (s *APIKeysStorage) RecordUsage(ctx context.Context, id int64, now time.Time) (int64, error) {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	var key *apiKey
+	for i := range s.s.apiKeys {
+		if s.s.apiKeys[i].ID == id {
+			key = &s.s.apiKeys[i]
+		}
+	}
+	if key == nil {
+		return 0, fmt.Errorf("recording api key usage: api key %d: %w", id, data.ErrNotFound)
+	}
+	key.LastUsedAt = &now
+
+	days, ok := s.s.usage[id]
+	if !ok {
+		days = make(map[string]int64)
+		s.s.usage[id] = days
+	}
+	day := now.UTC().Format("2006-01-02")
+	days[day]++
+
+	return days[day], nil
+}
+
+// GetUsage returns the per-day request counts of the key for the last days
+// days, most recent first. It returns ErrNotFound when the key does not
+// exist.
+func (s *APIKeysStorage) GetUsage(ctx context.Context, id int64, days int) ([]data.APIKeyUsage, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	exists := false
+	for _, k := range s.s.apiKeys {
+		exists = exists || k.ID == id
+	}
+	if !exists {
+		return nil, fmt.Errorf("api key %d: %w", id, data.ErrNotFound)
+	}
+
+	today := s.s.now().UTC().Truncate(24 * time.Hour)
+	oldest := today.AddDate(0, 0, -days)
+
+	usage := []data.APIKeyUsage{}
+	for day, requests := range s.s.usage[id] {
+		d, err := time.Parse("2006-01-02", day)
+		if err != nil || !d.After(oldest) {
+			continue
+		}
+		usage = append(usage, data.APIKeyUsage{Day: day, Requests: requests})
+	}
+
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Day > usage[j].Day })
+
+	return usage, nil
+}
@@ -0,0 +1,18 @@
+package memory_test
+
+import (
+	"backend/internal/data"
+	"backend/internal/data/memory"
+	"backend/internal/data/storagetest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageContract(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, fixtures *memory.Fixtures) data.Storage {
+		store, err := memory.NewStorage(fixtures)
+		require.NoError(t, err)
+		return store
+	})
+}
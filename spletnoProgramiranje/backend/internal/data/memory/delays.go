@@ -0,0 +1,346 @@
+package memory
+
+import (
+	"backend/internal/data"
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+type DelaysStorage struct {
+	s *store
+}
+
+// sortedDelays returns the delays matching keep, newest first like the
+// Postgres ORDER BY d.date DESC, d.id DESC.
+func (s *store) sortedDelays(keep func(delay) bool) []delay {
+	var out []delay
+	for _, d := range s.delays {
+		if keep(d) {
+			out = append(out, d)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].date.Equal(out[j].date) {
+			return out[i].date.After(out[j].date)
+		}
+		return out[i].ID > out[j].ID
+	})
+	return out
+}
+
+// reporter resolves the LEFT JOIN on users.
+func (s *store) reporter(d delay) (sql.NullInt64, sql.NullString) {
+	if d.UserID == nil {
+		return sql.NullInt64{}, sql.NullString{}
+	}
+	id := sql.NullInt64{Int64: int64(*d.UserID), Valid: true}
+	if u, ok := s.user(*d.UserID); ok {
+		return id, sql.NullString{String: u.Username, Valid: true}
+	}
+	return id, sql.NullString{}
+}
+
+func (s *DelaysStorage) GetDelaysByStop(ctx context.Context, stopID int64) ([]data.Delay, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	var delays []data.Delay
+	for _, d := range s.s.sortedDelays(func(d delay) bool { return d.StopID == int(stopID) }) {
+		_, stopOK := s.s.stop(d.StopID)
+		line, lineOK := s.s.line(d.LineID)
+		if !stopOK || !lineOK {
+			continue
+		}
+		userID, username := s.s.reporter(d)
+		delays = append(delays, data.Delay{
+			ID:       d.ID,
+			Date:     d.date,
+			DelayMin: d.DelayMin,
+			LineID:   d.LineID,
+			LineCode: line.LineCode,
+			UserID:   userID,
+			Username: username,
+		})
+	}
+
+	return delays, nil
+}
+
+func (s *DelaysStorage) GetRecentDelaysByLine(ctx context.Context, lineID int64) ([]data.DelayEntry, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	var delays []data.DelayEntry
+	for _, d := range s.s.sortedDelays(func(d delay) bool { return d.LineID == int(lineID) }) {
+		stop, ok := s.s.stop(d.StopID)
+		if !ok {
+			continue
+		}
+		userID, username := s.s.reporter(d)
+		delays = append(delays, data.DelayEntry{
+			ID:       d.ID,
+			Date:     d.date,
+			DelayMin: d.DelayMin,
+			StopID:   d.StopID,
+			StopName: stop.Name,
+			UserID:   userID,
+			Username: username,
+		})
+		if len(delays) == 8 {
+			break
+		}
+	}
+
+	return delays, nil
+}
+
+func (s *DelaysStorage) GetDelaysByUser(ctx context.Context, userID int64) ([]data.UserDelay, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	var delays []data.UserDelay
+	for _, d := range s.s.sortedDelays(func(d delay) bool { return d.UserID != nil && *d.UserID == int(userID) }) {
+		stop, stopOK := s.s.stop(d.StopID)
+		line, lineOK := s.s.line(d.LineID)
+		if !stopOK || !lineOK {
+			continue
+		}
+		delays = append(delays, data.UserDelay{
+			ID:       d.ID,
+			Date:     d.date,
+			DelayMin: d.DelayMin,
+			StopID:   d.StopID,
+			StopName: stop.Name,
+			LineID:   d.LineID,
+			LineCode: line.LineCode,
+		})
+	}
+
+	return delays, nil
+}
+
+func (s *DelaysStorage) GetMostRecentDelays(ctx context.Context) ([]data.MostRecentDelay, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	var delays []data.MostRecentDelay
+	for _, d := range s.s.sortedDelays(func(delay) bool { return true }) {
+		stop, stopOK := s.s.stop(d.StopID)
+		line, lineOK := s.s.line(d.LineID)
+		if !stopOK || !lineOK {
+			continue
+		}
+		userID, username := s.s.reporter(d)
+		delays = append(delays, data.MostRecentDelay{
+			ID:       d.ID,
+			Date:     d.date,
+			DelayMin: d.DelayMin,
+			StopID:   d.StopID,
+			StopName: stop.Name,
+			LineID:   d.LineID,
+			LineCode: line.LineCode,
+			UserID:   userID,
+			Username: username,
+		})
+		if len(delays) == 15 {
+			break
+		}
+	}
+
+	return delays, nil
+}
+
+func (s *DelaysStorage) GetDelayCountsByLine(ctx context.Context) ([]data.LineDelayCount, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	var results []data.LineDelayCount
+	for _, l := range s.s.lines {
+		r := data.LineDelayCount{LineID: l.ID, LineCode: l.LineCode}
+		for _, d := range s.s.delays {
+			if d.LineID == l.ID {
+				r.DelayCount++
+			}
+		}
+		results = append(results, r)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].DelayCount > results[j].DelayCount })
+
+	return results, nil
+}
+
+func (s *DelaysStorage) GetAverageDelayForLine(ctx context.Context, lineID int64) (*data.LineAverageDelay, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	line, ok := s.s.line(int(lineID))
+	if !ok {
+		return nil, nil
+	}
+
+	var sum, n int
+	for _, d := range s.s.delays {
+		if d.LineID == line.ID {
+			sum += d.DelayMin
+			n++
+		}
+	}
+	if n == 0 {
+		return nil, nil
+	}
+
+	return &data.LineAverageDelay{
+		LineID:       line.ID,
+		LineCode:     line.LineCode,
+		AvgDelayMins: round2(float64(sum) / float64(n)),
+	}, nil
+}
+
+func (s *DelaysStorage) GetOverallAverageDelay(ctx context.Context) (float64, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	if len(s.s.delays) == 0 {
+		return 0, nil
+	}
+
+	var sum int
+	for _, d := range s.s.delays {
+		sum += d.DelayMin
+	}
+
+	return round2(float64(sum) / float64(len(s.s.delays))), nil
+}
+
+func (s *DelaysStorage) InsertDelay(ctx context.Context, input data.DelayReportInputUnMarshaled) (int, error) {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	if _, ok := s.s.stop(int(input.StopID)); !ok {
+		return 0, fmt.Errorf("failed to insert delay: stop %d: %w", input.StopID, data.ErrNotFound)
+	}
+	if _, ok := s.s.line(int(input.LineID)); !ok {
+		return 0, fmt.Errorf("failed to insert delay: line %d: %w", input.LineID, data.ErrNotFound)
+	}
+
+	userID := input.UserId
+	date := time.Date(input.Date.Year(), input.Date.Month(), input.Date.Day(), 0, 0, 0, 0, time.UTC)
+
+	s.s.nextDelayID++
+	s.s.delays = append(s.s.delays, delay{
+		DelayRow: DelayRow{
+			ID:       s.s.nextDelayID,
+			Date:     date.Format("2006-01-02"),
+			DelayMin: input.DelayMin,
+			StopID:   int(input.StopID),
+			LineID:   int(input.LineID),
+			UserID:   &userID,
+		},
+		date:       date,
+		reportedAt: s.s.now(),
+	})
+
+	return s.s.nextDelayID, nil
+}
+
+func (s *DelaysStorage) InsertAudit(ctx context.Context, a *data.DelayAudit) error {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	if !slices.ContainsFunc(s.s.delays, func(d delay) bool { return d.ID == a.DelayID }) {
+		return fmt.Errorf("failed to insert delay audit: delay %d: %w", a.DelayID, data.ErrNotFound)
+	}
+
+	s.s.nextDelayAuditID++
+	a.ID = s.s.nextDelayAuditID
+	a.CreatedAt = s.s.now()
+	s.s.delayAudit = append(s.s.delayAudit, *a)
+	return nil
+}
+
+func (s *DelaysStorage) ListAudit(ctx context.Context, delayID int) ([]data.DelayAudit, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	audit := []data.DelayAudit{}
+	for _, a := range s.s.delayAudit {
+		if a.DelayID == delayID {
+			audit = append(audit, a)
+		}
+	}
+	return audit, nil
+}
+
+func (s *DelaysStorage) GetRecentDelays(ctx context.Context, f data.DelayFilter) ([]data.DelayReport, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	since := f.Since.Format("2006-01-02")
+
+	reports := []data.DelayReport{}
+	for _, d := range s.s.sortedDelays(func(d delay) bool {
+		return d.Date >= since &&
+			(f.StopID == 0 || d.StopID == int(f.StopID)) &&
+			(f.LineID == 0 || d.LineID == int(f.LineID))
+	}) {
+		if len(reports) == f.Limit {
+			break
+		}
+		stop, stopOK := s.s.stop(d.StopID)
+		line, lineOK := s.s.line(d.LineID)
+		if !stopOK || !lineOK {
+			continue
+		}
+		reports = append(reports, data.DelayReport{
+			ID:       d.ID,
+			Date:     d.date,
+			DelayMin: d.DelayMin,
+			StopID:   d.StopID,
+			StopName: stop.Name,
+			LineID:   d.LineID,
+			LineCode: line.LineCode,
+		})
+	}
+
+	return reports, nil
+}
+
+func (s *DelaysStorage) GetDelayHeat(ctx context.Context, since time.Time) ([]data.StopDelayHeat, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	day := since.Format("2006-01-02")
+
+	byStop := map[int]*data.StopDelayHeat{}
+	sums := map[int]int{}
+	for _, d := range s.s.delays {
+		if d.Date < day {
+			continue
+		}
+		stop, ok := s.s.stop(d.StopID)
+		if !ok {
+			continue
+		}
+		h, ok := byStop[stop.ID]
+		if !ok {
+			h = &data.StopDelayHeat{StopID: stop.ID, Latitude: stop.Latitude, Longitude: stop.Longitude}
+			byStop[stop.ID] = h
+		}
+		h.Reports++
+		sums[stop.ID] += d.DelayMin
+	}
+
+	heat := []data.StopDelayHeat{}
+	for id, h := range byStop {
+		h.AvgDelayMins = round2(float64(sums[id]) / float64(h.Reports))
+		heat = append(heat, *h)
+	}
+	sort.Slice(heat, func(i, j int) bool { return heat[i].StopID < heat[j].StopID })
+
+	return heat, nil
+}
@@ -0,0 +1,144 @@
+package memory
+
+import (
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"sort"
+)
+
+type FavouritesStorage struct {
+	s *store
+}
+
+// resolveFavourite fills in the names the Postgres storage joins in. The
+// stored row keeps only the references.
+func (s *store) resolveFavourite(f data.Favourite) data.Favourite {
+	f.Kind = data.FavouriteKind(f.StopID, f.LineID)
+	if f.StopID != nil {
+		if stop, ok := s.stop(*f.StopID); ok {
+			f.StopName = stop.Name
+		}
+	}
+	if f.LineID != nil {
+		if line, ok := s.line(*f.LineID); ok {
+			f.LineCode = line.LineCode
+		}
+	}
+	return f
+}
+
+func sameRef(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+func copyRef(p *int) *int {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+func (s *FavouritesStorage) List(ctx context.Context, userID int) ([]data.Favourite, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	favourites := []data.Favourite{}
+	for _, f := range s.s.favourites {
+		if f.UserID == userID {
+			favourites = append(favourites, s.s.resolveFavourite(f))
+		}
+	}
+
+	sort.Slice(favourites, func(i, j int) bool {
+		if favourites[i].Position != favourites[j].Position {
+			return favourites[i].Position < favourites[j].Position
+		}
+		return favourites[i].ID < favourites[j].ID
+	})
+
+	return favourites, nil
+}
+
+func (s *FavouritesStorage) Create(ctx context.Context, f *data.Favourite) error {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	if f.StopID != nil {
+		if _, ok := s.s.stop(*f.StopID); !ok {
+			return fmt.Errorf("creating favourite: stop %d: %w", *f.StopID, data.ErrNotFound)
+		}
+	}
+	if f.LineID != nil {
+		if _, ok := s.s.line(*f.LineID); !ok {
+			return fmt.Errorf("creating favourite: line %d: %w", *f.LineID, data.ErrNotFound)
+		}
+	}
+
+	position := 0
+	for _, existing := range s.s.favourites {
+		if existing.UserID != f.UserID {
+			continue
+		}
+		if sameRef(existing.StopID, f.StopID) && sameRef(existing.LineID, f.LineID) {
+			return fmt.Errorf("creating favourite: %w", data.ErrConflict)
+		}
+		position = max(position, existing.Position+1)
+	}
+
+	s.s.nextFavouriteID++
+	row := data.Favourite{
+		ID:        s.s.nextFavouriteID,
+		UserID:    f.UserID,
+		StopID:    copyRef(f.StopID),
+		LineID:    copyRef(f.LineID),
+		Position:  position,
+		CreatedAt: s.s.now().UTC(),
+	}
+	s.s.favourites = append(s.s.favourites, row)
+
+	*f = s.s.resolveFavourite(row)
+
+	return nil
+}
+
+func (s *FavouritesStorage) Delete(ctx context.Context, userID int, id int64) error {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	for i, f := range s.s.favourites {
+		if f.ID == id && f.UserID == userID {
+			s.s.favourites = append(s.s.favourites[:i:i], s.s.favourites[i+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("favourite %d: %w", id, data.ErrNotFound)
+}
+
+// Reorder updates positions one by one like the Postgres storage, so an
+// unknown ID leaves the earlier updates applied unless run in a transaction.
+func (s *FavouritesStorage) Reorder(ctx context.Context, userID int, ids []int64) error {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	for position, id := range ids {
+		found := false
+		for i := range s.s.favourites {
+			if f := &s.s.favourites[i]; f.ID == id && f.UserID == userID {
+				f.Position = position
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("favourite %d: %w", id, data.ErrNotFound)
+		}
+	}
+
+	return nil
+}
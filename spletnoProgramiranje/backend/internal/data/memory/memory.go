@@ -0,0 +1,408 @@
+// Package memory implements every data.Storage interface in memory. It is
+// seeded from JSON fixtures and lets the API (and the frontend behind it) run
+// without Postgres. State is lost when the process exits.
+package memory
+
+import (
+	"backend/internal/data"
+	"backend/internal/geo"
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+//go:embed fixtures/*.json
+var embedded embed.FS
+
+// LineRow is a row of the lines table.
+type LineRow struct {
+	ID       int    `json:"id"`
+	LineCode string `json:"line_code"`
+	Colour   string `json:"colour,omitempty"`
+}
+
+// DirectionRow is a row of the directions table.
+type DirectionRow struct {
+	ID     int    `json:"id"`
+	LineID int    `json:"line_id"`
+	Name   string `json:"name"`
+}
+
+// DepartureRow is a departures row joined with its arrivals. Times are
+// "15:04:05" strings in the order the bus reaches the stop. An empty Date
+// means the departure runs every day, which keeps the fixtures usable without
+// regenerating them.
+type DepartureRow struct {
+	ID          int      `json:"id"`
+	StopID      int      `json:"stop_id"`
+	DirectionID int      `json:"direction_id"`
+	LineID      int      `json:"line_id"`
+	Date        string   `json:"date,omitempty"`
+	Times       []string `json:"times"`
+}
+
+// DelayRow is a row of the delays table. Date is "2006-01-02".
+type DelayRow struct {
+	ID       int    `json:"id"`
+	Date     string `json:"date"`
+	DelayMin int    `json:"delay_min"`
+	StopID   int    `json:"stop_id"`
+	LineID   int    `json:"line_id"`
+	UserID   *int   `json:"user_id,omitempty"`
+}
+
+// OccupancyRow is a row of the occupancy table. Date is "2006-01-02" and
+// Time is "15:04:05".
+type OccupancyRow struct {
+	ID             int    `json:"id"`
+	LineID         int    `json:"line_id"`
+	Date           string `json:"date"`
+	Time           string `json:"time"`
+	OccupancyLevel int    `json:"occupancy_level"`
+}
+
+// Fixtures is the initial content of the store, one field per table.
+type Fixtures struct {
+	Stops      []data.Stop
+	Lines      []LineRow
+	Directions []DirectionRow
+	Departures []DepartureRow
+	Routes     []data.Route
+	Users      []data.User
+	Delays     []DelayRow
+	Occupancy  []OccupancyRow
+}
+
+// DefaultFixtures returns the small Maribor data set embedded in the binary.
+func DefaultFixtures() (*Fixtures, error) {
+	sub, err := fs.Sub(embedded, "fixtures")
+	if err != nil {
+		return nil, err
+	}
+	return LoadFixtures(sub)
+}
+
+// LoadFixtures reads <table>.json files from fsys. Missing files leave the
+// table empty.
+func LoadFixtures(fsys fs.FS) (*Fixtures, error) {
+	var f Fixtures
+
+	files := []struct {
+		name string
+		dst  any
+	}{
+		{"stops.json", &f.Stops},
+		{"lines.json", &f.Lines},
+		{"directions.json", &f.Directions},
+		{"departures.json", &f.Departures},
+		{"routes.json", &f.Routes},
+		{"users.json", &f.Users},
+		{"delays.json", &f.Delays},
+		{"occupancy.json", &f.Occupancy},
+	}
+
+	for _, file := range files {
+		raw, err := fs.ReadFile(fsys, file.name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("reading fixture %s: %w", file.name, err)
+		}
+		if err := json.Unmarshal(raw, file.dst); err != nil {
+			return nil, fmt.Errorf("parsing fixture %s: %w", file.name, err)
+		}
+	}
+
+	return &f, nil
+}
+
+type departure struct {
+	DepartureRow
+	// secs holds Times as seconds since midnight.
+	secs []int
+}
+
+type delay struct {
+	DelayRow
+	date time.Time
+	// reportedAt mirrors delays.reported_at. Fixture rows count as reported
+	// when the store is built, like rows that predate the column.
+	reportedAt time.Time
+}
+
+type apiKey struct {
+	data.APIKey
+	hash string
+}
+
+// tables is the mutable content of a store.
+type tables struct {
+	stops      []data.Stop
+	lines      []LineRow
+	directions []DirectionRow
+	departures []departure
+	routes     []data.Route
+	users      []data.User
+	delays     []delay
+	occupancy  []OccupancyRow
+	apiKeys    []apiKey
+	favourites []data.Favourite
+	trips      []data.SavedTrip
+	alertSubs  []data.AlertSubscription
+	deliveries []data.AlertDelivery
+	// alertCursor is nil until the evaluator first asks for it.
+	alertCursor *int
+	pushSubs    []data.PushSubscription
+	// pushCursor is nil until the push sender first claims it.
+	pushCursor *int
+	// serviceAlertCursor is nil until the push sender first asks for it.
+	serviceAlertCursor *int64
+	serviceAlerts      []data.ServiceAlert
+	routeShapes        []data.RouteShape
+	delayAudit         []data.DelayAudit
+	// stationOverrides are kept by stop ID.
+	stationOverrides []data.StationOverride
+	// usage counts requests per API key and UTC day ("2006-01-02").
+	usage map[int64]map[string]int64
+
+	nextUserID         int
+	nextDelayID        int
+	nextDelayAuditID   int64
+	nextAPIKeyID       int64
+	nextFavouriteID    int64
+	nextTripID         int64
+	nextAlertSubID     int64
+	nextDeliveryID     int64
+	nextPushSubID      int64
+	nextServiceAlertID int64
+	nextRouteShapeID   int64
+}
+
+// clone copies every table. Rows are replaced rather than modified through
+// shared pointers, so copying the slices is enough.
+func (t *tables) clone() tables {
+	c := *t
+	c.stops = slices.Clone(t.stops)
+	c.lines = slices.Clone(t.lines)
+	c.directions = slices.Clone(t.directions)
+	c.departures = slices.Clone(t.departures)
+	c.routes = slices.Clone(t.routes)
+	c.users = slices.Clone(t.users)
+	c.delays = slices.Clone(t.delays)
+	c.delayAudit = slices.Clone(t.delayAudit)
+	c.occupancy = slices.Clone(t.occupancy)
+	c.apiKeys = slices.Clone(t.apiKeys)
+	c.favourites = slices.Clone(t.favourites)
+	c.trips = slices.Clone(t.trips)
+	c.alertSubs = slices.Clone(t.alertSubs)
+	c.deliveries = slices.Clone(t.deliveries)
+	if t.alertCursor != nil {
+		cursor := *t.alertCursor
+		c.alertCursor = &cursor
+	}
+	c.pushSubs = slices.Clone(t.pushSubs)
+	if t.pushCursor != nil {
+		cursor := *t.pushCursor
+		c.pushCursor = &cursor
+	}
+	if t.serviceAlertCursor != nil {
+		cursor := *t.serviceAlertCursor
+		c.serviceAlertCursor = &cursor
+	}
+	c.serviceAlerts = slices.Clone(t.serviceAlerts)
+	c.routeShapes = slices.Clone(t.routeShapes)
+	c.stationOverrides = slices.Clone(t.stationOverrides)
+	c.usage = make(map[int64]map[string]int64, len(t.usage))
+	for id, days := range t.usage {
+		c.usage[id] = maps.Clone(days)
+	}
+	return c
+}
+
+// store holds every table. All storages share one store and its lock.
+type store struct {
+	mu sync.RWMutex
+	tables
+
+	now func() time.Time
+}
+
+// NewStorage builds a Storage backed by a fresh in-memory copy of f.
+func NewStorage(f *Fixtures) (data.Storage, error) {
+	s, err := newStore(f)
+	if err != nil {
+		return data.Storage{}, err
+	}
+	return s.storage(), nil
+}
+
+func newStore(f *Fixtures) (*store, error) {
+	s := &store{
+		tables: tables{
+			stops:      append([]data.Stop(nil), f.Stops...),
+			lines:      append([]LineRow(nil), f.Lines...),
+			directions: append([]DirectionRow(nil), f.Directions...),
+			routes:     append([]data.Route(nil), f.Routes...),
+			users:      append([]data.User(nil), f.Users...),
+			occupancy:  append([]OccupancyRow(nil), f.Occupancy...),
+			usage:      make(map[int64]map[string]int64),
+		},
+		now: time.Now,
+	}
+
+	sort.Slice(s.stops, func(i, j int) bool { return s.stops[i].ID < s.stops[j].ID })
+	sort.Slice(s.lines, func(i, j int) bool { return s.lines[i].ID < s.lines[j].ID })
+	sort.Slice(s.routes, func(i, j int) bool { return s.routes[i].ID < s.routes[j].ID })
+
+	for _, row := range f.Departures {
+		d := departure{DepartureRow: row}
+		for _, ts := range row.Times {
+			t, err := time.Parse("15:04:05", ts)
+			if err != nil {
+				return nil, fmt.Errorf("departure %d: invalid time %q: %w", row.ID, ts, err)
+			}
+			d.secs = append(d.secs, secondsOfDay(t))
+		}
+		s.departures = append(s.departures, d)
+	}
+
+	for _, row := range f.Delays {
+		date, err := time.Parse("2006-01-02", row.Date)
+		if err != nil {
+			return nil, fmt.Errorf("delay %d: invalid date %q: %w", row.ID, row.Date, err)
+		}
+		s.delays = append(s.delays, delay{DelayRow: row, date: date, reportedAt: s.now()})
+		s.nextDelayID = max(s.nextDelayID, row.ID)
+	}
+
+	for i, u := range s.users {
+		if u.Role == "" {
+			s.users[i].Role = data.RoleUser
+		}
+		s.nextUserID = max(s.nextUserID, u.ID)
+	}
+
+	return s, nil
+}
+
+func (s *store) storage() data.Storage {
+	return data.Storage{
+		Stations:         &StopStorage{s},
+		Routes:           &RoutesStorage{s},
+		RouteShapes:      &RouteShapesStorage{s},
+		User:             &UsersStorage{s},
+		APIKeys:          &APIKeysStorage{s},
+		Delays:           &DelaysStorage{s},
+		Occupancy:        &OccupancyStorage{s},
+		Favourites:       &FavouritesStorage{s},
+		Trips:            &TripsStorage{s},
+		Alerts:           &AlertsStorage{s},
+		Push:             &PushStorage{s},
+		ServiceAlerts:    &ServiceAlertsStorage{s},
+		StationOverrides: &StationOverridesStorage{s},
+	}.WithTxFunc(s.withTx)
+}
+
+// withTx runs fn against a copy of the tables and keeps the copy only when fn
+// succeeds. The write lock is held throughout, so transactions are serialised
+// and readers never observe partial work; fn must therefore only use the
+// Storage it is given.
+func (s *store) withTx(ctx context.Context, fn func(tx data.Storage) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &store{tables: s.tables.clone(), now: s.now}
+	if err := fn(tx.storage()); err != nil {
+		return err
+	}
+
+	s.tables = tx.tables
+	return nil
+}
+
+func (s *store) stop(id int) (data.Stop, bool) {
+	for _, st := range s.stops {
+		if st.ID == id {
+			return st, true
+		}
+	}
+	return data.Stop{}, false
+}
+
+func (s *store) line(id int) (LineRow, bool) {
+	for _, l := range s.lines {
+		if l.ID == id {
+			return l, true
+		}
+	}
+	return LineRow{}, false
+}
+
+func (s *store) direction(id int) (DirectionRow, bool) {
+	for _, d := range s.directions {
+		if d.ID == id {
+			return d, true
+		}
+	}
+	return DirectionRow{}, false
+}
+
+func (s *store) user(id int) (*data.User, bool) {
+	for i := range s.users {
+		if s.users[i].ID == id {
+			return &s.users[i], true
+		}
+	}
+	return nil, false
+}
+
+// runsOn reports whether the departure is scheduled on day ("2006-01-02").
+func (d *departure) runsOn(day string) bool {
+	return d.Date == "" || d.Date == day
+}
+
+func secondsOfDay(t time.Time) int {
+	return t.Hour()*3600 + t.Minute()*60 + t.Second()
+}
+
+// clock formats seconds since midnight as "15:04".
+func clock(sec int) string {
+	return time.Time{}.Add(time.Duration(sec) * time.Second).Format("15:04")
+}
+
+// round2 mirrors the NUMERIC(10,2) casts of the Postgres queries.
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// distanceMeters stands in for the PostGIS geography distance used by the
+// Postgres storage.
+func distanceMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	return geo.DistanceMeters(lat1, lon1, lat2, lon2)
+}
+
+// nearestStops returns up to n stops ordered by distance from the point,
+// leaving out the stops to avoid.
+func (s *store) nearestStops(lat, lon float64, n int, avoid []int) []data.Stop {
+	stops := slices.DeleteFunc(slices.Clone(s.stops), func(st data.Stop) bool {
+		return slices.Contains(avoid, st.ID)
+	})
+	sort.SliceStable(stops, func(i, j int) bool {
+		return distanceMeters(lat, lon, stops[i].Latitude, stops[i].Longitude) <
+			distanceMeters(lat, lon, stops[j].Latitude, stops[j].Longitude)
+	})
+	if len(stops) > n {
+		stops = stops[:n]
+	}
+	return stops
+}
@@ -0,0 +1,210 @@
+package memory
+
+import (
+	"backend/internal/data"
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStore(t *testing.T) *store {
+	t.Helper()
+
+	fixtures, err := DefaultFixtures()
+	require.NoError(t, err)
+
+	s, err := newStore(fixtures)
+	require.NoError(t, err)
+
+	s.now = func() time.Time { return time.Date(2024, 5, 20, 12, 10, 0, 0, time.Local) }
+	return s
+}
+
+func TestDefaultFixturesLoad(t *testing.T) {
+	fixtures, err := DefaultFixtures()
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, fixtures.Stops)
+	assert.NotEmpty(t, fixtures.Lines)
+	assert.NotEmpty(t, fixtures.Departures)
+	assert.NotEmpty(t, fixtures.Routes)
+	assert.NotEmpty(t, fixtures.Users)
+}
+
+func TestLoadFixturesRejectsInvalidTimes(t *testing.T) {
+	fixtures, err := LoadFixtures(fstest.MapFS{
+		"departures.json": {Data: []byte(`[{"id":1,"stop_id":1,"direction_id":1,"times":["25:00"]}]`)},
+	})
+	require.NoError(t, err)
+
+	_, err = NewStorage(fixtures)
+	assert.Error(t, err)
+}
+
+func TestStationsGeoQueries(t *testing.T) {
+	ctx := context.Background()
+	stations := newTestStore(t).storage().Stations
+
+	// Glavni trg
+	closeBy, err := stations.ReadStationsCloseBy(ctx, &data.Location{Latitude: 46.5577, Longitude: 15.6455, Radius: 200})
+	require.NoError(t, err)
+	require.Len(t, closeBy, 1)
+	assert.Equal(t, "Glavni trg", closeBy[0].Name)
+
+	none, err := stations.ReadStationsCloseBy(ctx, &data.Location{Latitude: 46.0, Longitude: 14.5, Radius: 500})
+	require.NoError(t, err)
+	assert.NotNil(t, none)
+	assert.Empty(t, none)
+
+	// Next to the railway station.
+	nearest, err := stations.ReadThreeStationsAtDestination(ctx, &data.PathLocation{
+		DestinationLatitude:  46.5621,
+		DestinationLongitude: 15.6568,
+	})
+	require.NoError(t, err)
+	require.Len(t, nearest, 3)
+	assert.Equal(t, "Železniška postaja", nearest[0].Name)
+	assert.Equal(t, "Avtobusna postaja", nearest[1].Name)
+}
+
+func TestReadStationMetadata(t *testing.T) {
+	ctx := context.Background()
+	stations := newTestStore(t).storage().Stations
+
+	meta, err := stations.ReadStationMetadata(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "Glavni trg", meta.Name)
+	require.NotEmpty(t, meta.Departures)
+	assert.Equal(t, "1", meta.Departures[0].Line)
+	assert.Equal(t, "Studenci", meta.Departures[0].Direction)
+	assert.Equal(t, "05:09", meta.Departures[0].Times[0])
+
+	_, err = stations.ReadStationMetadata(ctx, 999)
+	assert.ErrorIs(t, err, data.ErrNotFound)
+
+	lines, err := stations.ReadStationLines(ctx, []data.Stop{{ID: 3}})
+	require.NoError(t, err)
+	assert.Equal(t, []data.Line{
+		{ID: 2, LineCode: "6", Name: "Ljudski vrt"},
+		{ID: 2, LineCode: "6", Name: "Železniška postaja"},
+	}, lines)
+}
+
+func TestRoutes(t *testing.T) {
+	ctx := context.Background()
+	routes := newTestStore(t).storage().Routes
+
+	route, err := routes.ReadRoute(ctx, 2, data.RouteQuery{})
+	require.NoError(t, err)
+	assert.Len(t, route.Path, 4)
+
+	_, err = routes.ReadRoute(ctx, 99, data.RouteQuery{})
+	assert.ErrorIs(t, err, data.ErrNotFound)
+
+	stops, err := routes.ReadRouteStations(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, stops, 4)
+	assert.Equal(t, "001", stops[0].Number)
+
+	runs, err := routes.FetchActiveRuns(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+	assert.Equal(t, 1, runs[0].DirectionID)
+	assert.Equal(t, 2, runs[1].DirectionID)
+	assert.NotEmpty(t, runs[0].Path)
+	assert.Less(t, runs[1].StartSec, runs[0].StartSec, "the second run gets an artificial head start")
+}
+
+func TestUsers(t *testing.T) {
+	ctx := context.Background()
+	users := newTestStore(t).storage().User
+
+	require.NoError(t, users.Create(ctx, &data.User{Username: "ana", Email: "ana@example.com", Password: "x"}))
+	assert.ErrorIs(t, users.Create(ctx, &data.User{Username: "ana", Email: "other@example.com"}), data.ErrConflict)
+
+	u, err := users.GetByEmail(ctx, "ana@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, data.RoleUser, u.Role)
+
+	require.NoError(t, users.UpdateById(ctx, u.ID, &data.UpdateUserPayload{Username: "ana2", Email: "ana@example.com"}))
+	client, err := users.GetByIDForClient(ctx, u.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "ana2", client.Username)
+
+	_, err = users.GetById(ctx, 999)
+	assert.ErrorIs(t, err, data.ErrNotFound)
+}
+
+func TestDelays(t *testing.T) {
+	ctx := context.Background()
+	delays := newTestStore(t).storage().Delays
+
+	_, err := delays.InsertDelay(ctx, data.DelayReportInputUnMarshaled{
+		Date: time.Date(2024, 6, 1, 15, 30, 0, 0, time.UTC), DelayMin: 9, StopID: 1, LineID: 2, UserId: 2,
+	})
+	require.NoError(t, err)
+
+	recent, err := delays.GetMostRecentDelays(ctx)
+	require.NoError(t, err)
+	require.NotEmpty(t, recent)
+	assert.Equal(t, 9, recent[0].DelayMin)
+	assert.Equal(t, "demo", recent[0].Username.String)
+
+	_, err = delays.InsertDelay(ctx, data.DelayReportInputUnMarshaled{Date: time.Now(), DelayMin: 1, StopID: 999, LineID: 1})
+	assert.ErrorIs(t, err, data.ErrNotFound)
+
+	avg, err := delays.GetAverageDelayForLine(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 7.67, avg.AvgDelayMins)
+
+	counts, err := delays.GetDelayCountsByLine(ctx)
+	require.NoError(t, err)
+	require.Len(t, counts, 2)
+	assert.Equal(t, 3, counts[0].DelayCount)
+}
+
+func TestAPIKeyUsage(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	keys := s.storage().APIKeys
+
+	key := &data.APIKey{Name: "frontend", Scopes: []string{data.ScopeReadTimetable}}
+	require.NoError(t, keys.Create(ctx, key, "hash"))
+	assert.ErrorIs(t, keys.Create(ctx, &data.APIKey{}, "hash"), data.ErrConflict)
+
+	now := s.now()
+	for i := 0; i < 3; i++ {
+		_, err := keys.RecordUsage(ctx, key.ID, now)
+		require.NoError(t, err)
+	}
+
+	usage, err := keys.GetUsage(ctx, key.ID, 30)
+	require.NoError(t, err)
+	require.Len(t, usage, 1)
+	assert.Equal(t, int64(3), usage[0].Requests)
+
+	require.NoError(t, keys.Revoke(ctx, key.ID))
+	assert.ErrorIs(t, keys.Revoke(ctx, key.ID), data.ErrNotFound)
+
+	got, err := keys.GetByHash(ctx, "hash")
+	require.NoError(t, err)
+	assert.False(t, got.Active(now))
+}
+
+func TestOccupancy(t *testing.T) {
+	ctx := context.Background()
+	occupancy := newTestStore(t).storage().Occupancy
+
+	records, err := occupancy.GetOccupancyForLineByDateAndHour(ctx, 1, "2024-05-20", 8)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "08:00:00", records[0].Time)
+
+	avg, err := occupancy.GetAvgOccupancyAllLinesByHour(ctx, 3)
+	require.NoError(t, err)
+	assert.Nil(t, avg)
+}
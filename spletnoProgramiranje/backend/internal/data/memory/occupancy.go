@@ -0,0 +1,107 @@
+package memory
+
+import (
+	"backend/internal/data"
+	"context"
+	"sort"
+	"strconv"
+)
+
+type OccupancyStorage struct {
+	s *store
+}
+
+func hourOf(clock string) int {
+	if len(clock) < 2 {
+		return -1
+	}
+	h, err := strconv.Atoi(clock[:2])
+	if err != nil {
+		return -1
+	}
+	return h
+}
+
+// lineOccupancy returns the rows of the line on the date, ordered by time.
+func (s *store) lineOccupancy(lineID int, targetDate string, keep func(OccupancyRow) bool) []OccupancyRow {
+	var rows []OccupancyRow
+	for _, o := range s.occupancy {
+		if o.LineID == lineID && o.Date == targetDate && keep(o) {
+			rows = append(rows, o)
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Time < rows[j].Time })
+	return rows
+}
+
+func (s *OccupancyStorage) GetOccupancyForLineByDate(ctx context.Context, lineID int, targetDate string) ([]data.OccupancyRecord, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	var results []data.OccupancyRecord
+	for _, o := range s.s.lineOccupancy(lineID, targetDate, func(OccupancyRow) bool { return true }) {
+		results = append(results, data.OccupancyRecord{Time: o.Time, OccupancyLevel: o.OccupancyLevel})
+	}
+
+	return results, nil
+}
+
+func (s *OccupancyStorage) GetOccupancyForLineByDateAndHour(ctx context.Context, lineID int, targetDate string, targetHour int) ([]data.OccupancyRecord, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	inHour := func(o OccupancyRow) bool { return hourOf(o.Time) == targetHour }
+
+	var results []data.OccupancyRecord
+	for _, o := range s.s.lineOccupancy(lineID, targetDate, inHour) {
+		results = append(results, data.OccupancyRecord{
+			Time:           o.Time,
+			Date:           o.Date,
+			OccupancyLevel: o.OccupancyLevel,
+		})
+	}
+
+	return results, nil
+}
+
+func (s *OccupancyStorage) GetAvgOccupancyAllLinesByHour(ctx context.Context, targetHour int) (*data.AvgOccupancyByHour, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	var sum, n int
+	for _, o := range s.s.occupancy {
+		if hourOf(o.Time) == targetHour {
+			sum += o.OccupancyLevel
+			n++
+		}
+	}
+	if n == 0 {
+		return nil, nil
+	}
+
+	return &data.AvgOccupancyByHour{
+		HourOfDay:    targetHour,
+		AvgOccupancy: round2(float64(sum) / float64(n)),
+	}, nil
+}
+
+func (s *OccupancyStorage) GetAvgDailyOccupancyAllLines(ctx context.Context, targetDate string) (*data.AvgDailyOccupancy, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	var sum, n int
+	for _, o := range s.s.occupancy {
+		if o.Date == targetDate {
+			sum += o.OccupancyLevel
+			n++
+		}
+	}
+	if n == 0 {
+		return nil, nil
+	}
+
+	return &data.AvgDailyOccupancy{
+		Date:              targetDate,
+		AvgDailyOccupancy: round2(float64(sum) / float64(n)),
+	}, nil
+}
@@ -0,0 +1,186 @@
+package memory
+
+import (
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+type PushStorage struct {
+	s *store
+}
+
+func (s *PushStorage) List(ctx context.Context, userID int) ([]data.PushSubscription, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	subs := []data.PushSubscription{}
+	for _, p := range s.s.pushSubs {
+		if p.UserID == userID {
+			subs = append(subs, p)
+		}
+	}
+
+	return subs, nil
+}
+
+func (s *PushStorage) Save(ctx context.Context, p *data.PushSubscription) error {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	if _, ok := s.s.user(p.UserID); !ok {
+		return fmt.Errorf("saving push subscription: user %d: %w", p.UserID, data.ErrNotFound)
+	}
+
+	row := *p
+	for i, existing := range s.s.pushSubs {
+		if existing.Endpoint == p.Endpoint {
+			row.ID, row.CreatedAt = existing.ID, existing.CreatedAt
+			s.s.pushSubs[i] = row
+			*p = row
+			return nil
+		}
+	}
+
+	s.s.nextPushSubID++
+	row.ID = s.s.nextPushSubID
+	row.CreatedAt = s.s.now().UTC()
+	s.s.pushSubs = append(s.s.pushSubs, row)
+	*p = row
+
+	return nil
+}
+
+func (s *PushStorage) Delete(ctx context.Context, userID int, id int64) error {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	for i, p := range s.s.pushSubs {
+		if p.ID == id && p.UserID == userID {
+			s.s.pushSubs = append(s.s.pushSubs[:i:i], s.s.pushSubs[i+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("push subscription %d: %w", id, data.ErrNotFound)
+}
+
+func (s *PushStorage) DeleteEndpoint(ctx context.Context, endpoint string) error {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	s.s.pushSubs = slices.DeleteFunc(slices.Clone(s.s.pushSubs), func(p data.PushSubscription) bool {
+		return p.Endpoint == endpoint
+	})
+
+	return nil
+}
+
+func (s *PushStorage) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	before := len(s.s.pushSubs)
+	s.s.pushSubs = slices.DeleteFunc(slices.Clone(s.s.pushSubs), func(p data.PushSubscription) bool {
+		return p.ExpiresAt != nil && p.ExpiresAt.Before(now)
+	})
+
+	return before - len(s.s.pushSubs), nil
+}
+
+func (s *PushStorage) Targets(ctx context.Context, lineID, stopID int) ([]data.PushSubscription, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	subs := []data.PushSubscription{}
+	for _, p := range s.s.pushSubs {
+		if slices.ContainsFunc(s.s.favourites, func(f data.Favourite) bool {
+			return f.UserID == p.UserID && f.LineID != nil && *f.LineID == lineID &&
+				(f.StopID == nil || *f.StopID == stopID)
+		}) {
+			subs = append(subs, p)
+		}
+	}
+
+	return subs, nil
+}
+
+func (s *PushStorage) AlertTargets(ctx context.Context, alertID int64) ([]data.PushSubscription, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	subs := []data.PushSubscription{}
+	i := slices.IndexFunc(s.s.serviceAlerts, func(a data.ServiceAlert) bool { return a.ID == alertID })
+	if i < 0 {
+		return subs, nil
+	}
+	entities := s.s.serviceAlerts[i].Entities
+
+	affected := func(f data.Favourite) bool {
+		return slices.ContainsFunc(entities, func(e data.ServiceAlertEntity) bool {
+			return (f.LineID == nil || s.s.entityOfLine(e, *f.LineID)) &&
+				(f.StopID == nil || s.s.entityOfStop(e, *f.StopID))
+		})
+	}
+	for _, p := range s.s.pushSubs {
+		if slices.ContainsFunc(s.s.favourites, func(f data.Favourite) bool {
+			return f.UserID == p.UserID && affected(f)
+		}) {
+			subs = append(subs, p)
+		}
+	}
+
+	return subs, nil
+}
+
+// Claim stands in for the row lock of the Postgres storage: transactions
+// hold the store's write lock throughout, so claims are serialised anyway.
+func (s *PushStorage) Claim(ctx context.Context) (int, error) {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	if s.s.pushCursor == nil {
+		cursor := 0
+		for _, d := range s.s.delays {
+			cursor = max(cursor, d.ID)
+		}
+		s.s.pushCursor = &cursor
+	}
+
+	return *s.s.pushCursor, nil
+}
+
+func (s *PushStorage) SetCursor(ctx context.Context, delayID int) error {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	s.s.pushCursor = &delayID
+
+	return nil
+}
+
+func (s *PushStorage) ServiceAlertCursor(ctx context.Context) (int64, error) {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	if s.s.serviceAlertCursor == nil {
+		var cursor int64
+		for _, a := range s.s.serviceAlerts {
+			cursor = max(cursor, a.ID)
+		}
+		s.s.serviceAlertCursor = &cursor
+	}
+
+	return *s.s.serviceAlertCursor, nil
+}
+
+func (s *PushStorage) SetServiceAlertCursor(ctx context.Context, alertID int64) error {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	s.s.serviceAlertCursor = &alertID
+
+	return nil
+}
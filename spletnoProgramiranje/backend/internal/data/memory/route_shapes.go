@@ -0,0 +1,115 @@
+package memory
+
+import (
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+type RouteShapesStorage struct {
+	s *store
+}
+
+// copyRouteShape copies the path of a shape, so rows in the store never
+// share it with callers.
+func copyRouteShape(sh data.RouteShape) data.RouteShape {
+	sh.Path = slices.Clone(sh.Path)
+	for i, point := range sh.Path {
+		sh.Path[i] = slices.Clone(point)
+	}
+	return sh
+}
+
+// shapeAt returns the shape of the direction valid at t, preferring the one
+// starting latest, like the Postgres storage.
+func (s *store) shapeAt(directionID int, t time.Time) (data.RouteShape, bool) {
+	var (
+		best  data.RouteShape
+		found bool
+	)
+	for _, sh := range s.routeShapes {
+		if sh.DirectionID != directionID || !sh.ValidAt(t) {
+			continue
+		}
+		if !found || startsLater(sh, best) {
+			best, found = sh, true
+		}
+	}
+	return best, found
+}
+
+// startsLater orders shapes by valid_from descending, open starts last, then
+// by ID descending.
+func startsLater(a, b data.RouteShape) bool {
+	switch {
+	case a.ValidFrom == nil && b.ValidFrom == nil:
+		return a.ID > b.ID
+	case a.ValidFrom == nil:
+		return false
+	case b.ValidFrom == nil:
+		return true
+	case !a.ValidFrom.Equal(*b.ValidFrom):
+		return a.ValidFrom.After(*b.ValidFrom)
+	}
+	return a.ID > b.ID
+}
+
+func (s *RouteShapesStorage) List(ctx context.Context, lineID int) ([]data.RouteShape, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	shapes := []data.RouteShape{}
+	for _, sh := range s.s.routeShapes {
+		if sh.LineID == lineID {
+			shapes = append(shapes, copyRouteShape(sh))
+		}
+	}
+
+	sort.SliceStable(shapes, func(i, j int) bool {
+		if shapes[i].DirectionID != shapes[j].DirectionID {
+			return shapes[i].DirectionID < shapes[j].DirectionID
+		}
+		return startsLater(shapes[i], shapes[j])
+	})
+
+	return shapes, nil
+}
+
+func (s *RouteShapesStorage) Create(ctx context.Context, sh *data.RouteShape) error {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	dir, ok := s.s.direction(sh.DirectionID)
+	if !ok {
+		return fmt.Errorf("saving route shape: direction %d: %w", sh.DirectionID, data.ErrNotFound)
+	}
+
+	s.s.nextRouteShapeID++
+	row := copyRouteShape(*sh)
+	row.ID = s.s.nextRouteShapeID
+	row.LineID = dir.LineID
+	row.Direction = dir.Name
+	row.CreatedAt = s.s.now().UTC()
+	s.s.routeShapes = append(s.s.routeShapes, row)
+
+	*sh = copyRouteShape(row)
+
+	return nil
+}
+
+func (s *RouteShapesStorage) Delete(ctx context.Context, id int64) error {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	for i, sh := range s.s.routeShapes {
+		if sh.ID == id {
+			s.s.routeShapes = append(s.s.routeShapes[:i:i], s.s.routeShapes[i+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("route shape %d: %w", id, data.ErrNotFound)
+}
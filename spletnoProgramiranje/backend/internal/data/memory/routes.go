@@ -0,0 +1,256 @@
+package memory
+
+import (
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+type RoutesStorage struct {
+	s *store
+}
+
+func (s *RoutesStorage) ReadRoute(ctx context.Context, id int64, q data.RouteQuery) (*data.Route, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	route, ok := s.s.routeForLine(int(id))
+	if !ok {
+		return nil, fmt.Errorf("route for line %d: %w", id, data.ErrNotFound)
+	}
+
+	// The requested direction of the line or, without one, its first.
+	for _, d := range s.s.directions {
+		if d.LineID == int(id) && (q.DirectionID == 0 || d.ID == q.DirectionID) &&
+			(route.DirectionID == 0 || d.ID < route.DirectionID) {
+			route.DirectionID = d.ID
+		}
+	}
+	if q.DirectionID != 0 && route.DirectionID == 0 {
+		return nil, fmt.Errorf("route for line %d direction %d: %w", id, q.DirectionID, data.ErrNotFound)
+	}
+
+	at := q.At
+	if at.IsZero() {
+		at = s.s.now()
+	}
+	if shape, ok := s.s.shapeAt(route.DirectionID, at); ok {
+		route.Path = copyRouteShape(shape).Path
+		route.ShapeID = shape.ID
+		route.ValidUntil = shape.ValidUntil
+	}
+
+	return &route, nil
+}
+
+func (s *RoutesStorage) ReadRouteStations(ctx context.Context, id int64) ([]data.Stop, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	seen := make(map[int]bool)
+	var stops []data.Stop
+
+	for _, d := range s.s.departures {
+		dir, ok := s.s.direction(d.DirectionID)
+		if !ok || dir.LineID != int(id) || seen[d.StopID] {
+			continue
+		}
+		stop, ok := s.s.stop(d.StopID)
+		if !ok {
+			continue
+		}
+		seen[d.StopID] = true
+		stops = append(stops, stop)
+	}
+
+	sort.SliceStable(stops, func(i, j int) bool { return stops[i].Number < stops[j].Number })
+
+	return stops, nil
+}
+
+func (s *RoutesStorage) ReadRoutesList(ctx context.Context) ([]data.Route, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	return append([]data.Route(nil), s.s.routes...), nil
+}
+
+func (s *RoutesStorage) ReadMapRoutes(ctx context.Context) ([]data.MapRoute, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	routes := []data.MapRoute{}
+	for _, r := range s.s.routes {
+		line, ok := s.s.line(r.LineID)
+		if !ok {
+			continue
+		}
+		routes = append(routes, data.MapRoute{
+			ID:       r.ID,
+			LineID:   line.ID,
+			LineCode: line.LineCode,
+			Colour:   data.LineColour(line.ID, line.Colour),
+			Path:     r.Path,
+		})
+	}
+
+	return routes, nil
+}
+
+func (s *RoutesStorage) ReadDirections(ctx context.Context, lineID int64) ([]data.Direction, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	line, ok := s.s.line(int(lineID))
+	if !ok {
+		return nil, fmt.Errorf("line %d: %w", lineID, data.ErrNotFound)
+	}
+
+	directions := []data.Direction{}
+	for _, d := range s.s.directions {
+		if d.LineID == line.ID {
+			directions = append(directions, data.Direction{ID: d.ID, LineID: line.ID, LineCode: line.LineCode, Name: d.Name})
+		}
+	}
+
+	sort.Slice(directions, func(i, j int) bool { return directions[i].ID < directions[j].ID })
+
+	return directions, nil
+}
+
+func (s *RoutesStorage) ReadDirectionStops(ctx context.Context, q data.DirectionStopsQuery) ([]data.DirectionStop, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	if dir, ok := s.s.direction(int(q.DirectionID)); !ok || dir.LineID != int(q.LineID) {
+		return nil, fmt.Errorf("direction %d of line %d: %w", q.DirectionID, q.LineID, data.ErrNotFound)
+	}
+
+	day := q.Date.Format("2006-01-02")
+	seconds := map[int][]int{}
+	for _, d := range s.s.departures {
+		if d.DirectionID == int(q.DirectionID) && d.runsOn(day) {
+			seconds[d.StopID] = append(seconds[d.StopID], d.secs...)
+		}
+	}
+
+	var times []data.StopTimes
+	stops := map[int]data.Stop{}
+	for stopID, secs := range seconds {
+		slices.Sort(secs)
+		times = append(times, data.StopTimes{StopID: stopID, DirectionID: int(q.DirectionID), Seconds: secs})
+		if stop, ok := s.s.stop(stopID); ok {
+			stops[stopID] = stop
+		}
+	}
+
+	return data.DirectionStops(times, stops), nil
+}
+
+func (s *RoutesStorage) ReadActiveLines(ctx context.Context) (int, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	now := s.s.now()
+	today := now.Format("2006-01-02")
+	nowSec := secondsOfDay(now)
+
+	var active int
+	for _, d := range s.s.departures {
+		if !d.runsOn(today) {
+			continue
+		}
+		for i := 1; i < len(d.secs); i++ {
+			if nowSec >= d.secs[i-1] && nowSec <= d.secs[i] {
+				active++
+				break
+			}
+		}
+	}
+
+	return active / 19, nil
+}
+
+func (s *RoutesStorage) FetchActiveRuns(ctx context.Context, lineID int) ([]data.ActiveRun, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	now := s.s.now()
+	today := now.Format("2006-01-02")
+	nowSec := secondsOfDay(now)
+
+	route, hasRoute := s.s.routeForLine(lineID)
+
+	// The latest-starting active departure of each direction.
+	latest := make(map[int]departure)
+	for _, d := range s.s.departures {
+		if !d.runsOn(today) || len(d.secs) == 0 {
+			continue
+		}
+		dir, ok := s.s.direction(d.DirectionID)
+		if !ok || dir.LineID != lineID {
+			continue
+		}
+		if d.secs[0] > nowSec || d.secs[len(d.secs)-1] < nowSec {
+			continue
+		}
+		if cur, ok := latest[d.DirectionID]; !ok || d.secs[0] > cur.secs[0] {
+			latest[d.DirectionID] = d
+		}
+	}
+
+	directionIDs := make([]int, 0, len(latest))
+	for id := range latest {
+		directionIDs = append(directionIDs, id)
+	}
+	sort.Ints(directionIDs)
+
+	var runs []data.ActiveRun
+	for _, dirID := range directionIDs {
+		d := latest[dirID]
+
+		path := route.Path
+		if shape, ok := s.s.shapeAt(dirID, now); ok {
+			path = shape.Path
+		} else if !hasRoute {
+			continue
+		}
+
+		var arrTimes []time.Time
+		for _, sec := range d.secs {
+			arrTimes = append(arrTimes, time.Date(now.Year(), now.Month(), now.Day(),
+				0, 0, sec, 0, time.Local))
+		}
+
+		sSec, eSec := d.secs[0], d.secs[len(d.secs)-1]
+
+		artificialStart := nowSec
+		if len(runs) == 1 {
+			routeDuration := eSec - sSec
+			artificialStart = nowSec - (routeDuration / 3)
+		}
+
+		runs = append(runs, data.ActiveRun{
+			DepartureID: d.ID,
+			DirectionID: d.DirectionID,
+			ArrTimes:    arrTimes,
+			Path:        path,
+			StartSec:    artificialStart,
+			EndSec:      artificialStart + (eSec - sSec),
+		})
+	}
+
+	return runs, nil
+}
+
+func (s *store) routeForLine(lineID int) (data.Route, bool) {
+	for _, r := range s.routes {
+		if r.LineID == lineID {
+			return r, true
+		}
+	}
+	return data.Route{}, false
+}
@@ -0,0 +1,239 @@
+package memory
+
+import (
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+)
+
+type ServiceAlertsStorage struct {
+	s *store
+}
+
+// copyServiceAlert copies the maps and slices of an alert, so rows in the
+// store never share them with callers.
+func copyServiceAlert(a data.ServiceAlert) data.ServiceAlert {
+	a.Header = maps.Clone(a.Header)
+	a.Description = maps.Clone(a.Description)
+	if a.Description == nil {
+		a.Description = data.Translations{}
+	}
+	a.Entities = slices.Clone(a.Entities)
+	if a.Entities == nil {
+		a.Entities = []data.ServiceAlertEntity{}
+	}
+	a.Detour = slices.Clone(a.Detour)
+	for i, point := range a.Detour {
+		a.Detour[i] = slices.Clone(point)
+	}
+	if a.ActiveUntil != nil {
+		until := *a.ActiveUntil
+		a.ActiveUntil = &until
+	}
+	return a
+}
+
+// resolveServiceAlert fills in the entity names the Postgres storage joins
+// in.
+func (s *store) resolveServiceAlert(a data.ServiceAlert) data.ServiceAlert {
+	a = copyServiceAlert(a)
+	for i, e := range a.Entities {
+		e.LineCode, e.Direction, e.StopName = "", "", ""
+		if e.LineID != nil {
+			if l, ok := s.line(*e.LineID); ok {
+				e.LineCode = l.LineCode
+			}
+		}
+		if e.DirectionID != nil {
+			if d, ok := s.direction(*e.DirectionID); ok {
+				e.Direction = d.Name
+			}
+		}
+		if e.StopID != nil {
+			if st, ok := s.stop(*e.StopID); ok {
+				e.StopName = st.Name
+			}
+		}
+		a.Entities[i] = e
+	}
+	return a
+}
+
+// serves reports whether a departure of the line, or of the direction when
+// directionID is set, calls at the stop.
+func (s *store) serves(lineID, directionID, stopID int) bool {
+	for _, d := range s.departures {
+		if d.StopID != stopID {
+			continue
+		}
+		if directionID != 0 && d.DirectionID == directionID {
+			return true
+		}
+		if dir, ok := s.direction(d.DirectionID); directionID == 0 && ok && dir.LineID == lineID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *store) entityOfLine(e data.ServiceAlertEntity, lineID int) bool {
+	switch {
+	case e.LineID != nil && *e.LineID == lineID:
+		return true
+	case e.DirectionID != nil:
+		dir, ok := s.direction(*e.DirectionID)
+		return ok && dir.LineID == lineID
+	case e.LineID == nil && e.StopID != nil:
+		return s.serves(lineID, 0, *e.StopID)
+	}
+	return false
+}
+
+func (s *store) entityOfStop(e data.ServiceAlertEntity, stopID int) bool {
+	switch {
+	case e.StopID != nil:
+		return *e.StopID == stopID
+	case e.DirectionID != nil:
+		return s.serves(0, *e.DirectionID, stopID)
+	case e.LineID != nil:
+		return s.serves(*e.LineID, 0, stopID)
+	}
+	return false
+}
+
+func (s *store) matchesServiceAlert(a data.ServiceAlert, f data.ServiceAlertFilter) bool {
+	if !f.ActiveAt.IsZero() && !a.ActiveAt(f.ActiveAt) {
+		return false
+	}
+	if a.ID <= f.AfterID {
+		return false
+	}
+	if f.LineID != 0 && !slices.ContainsFunc(a.Entities, func(e data.ServiceAlertEntity) bool {
+		return s.entityOfLine(e, f.LineID)
+	}) {
+		return false
+	}
+	if f.StopID != 0 && !slices.ContainsFunc(a.Entities, func(e data.ServiceAlertEntity) bool {
+		return s.entityOfStop(e, f.StopID)
+	}) {
+		return false
+	}
+	return true
+}
+
+func (s *ServiceAlertsStorage) List(ctx context.Context, f data.ServiceAlertFilter) ([]data.ServiceAlert, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	alerts := []data.ServiceAlert{}
+	for _, a := range s.s.serviceAlerts {
+		if s.s.matchesServiceAlert(a, f) {
+			alerts = append(alerts, s.s.resolveServiceAlert(a))
+		}
+	}
+
+	sort.SliceStable(alerts, func(i, j int) bool {
+		if !alerts[i].ActiveFrom.Equal(alerts[j].ActiveFrom) {
+			return alerts[i].ActiveFrom.After(alerts[j].ActiveFrom)
+		}
+		return alerts[i].ID > alerts[j].ID
+	})
+
+	return alerts, nil
+}
+
+func (s *ServiceAlertsStorage) Get(ctx context.Context, id int64) (*data.ServiceAlert, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	for _, a := range s.s.serviceAlerts {
+		if a.ID == id {
+			resolved := s.s.resolveServiceAlert(a)
+			return &resolved, nil
+		}
+	}
+
+	return nil, fmt.Errorf("service alert %d: %w", id, data.ErrNotFound)
+}
+
+// checkServiceAlert stands in for the foreign keys of the entities.
+func (s *store) checkServiceAlert(a *data.ServiceAlert) error {
+	for _, e := range a.Entities {
+		if e.LineID != nil {
+			if _, ok := s.line(*e.LineID); !ok {
+				return fmt.Errorf("saving service alert: line %d: %w", *e.LineID, data.ErrNotFound)
+			}
+		}
+		if e.DirectionID != nil {
+			if _, ok := s.direction(*e.DirectionID); !ok {
+				return fmt.Errorf("saving service alert: direction %d: %w", *e.DirectionID, data.ErrNotFound)
+			}
+		}
+		if e.StopID != nil {
+			if _, ok := s.stop(*e.StopID); !ok {
+				return fmt.Errorf("saving service alert: stop %d: %w", *e.StopID, data.ErrNotFound)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *ServiceAlertsStorage) Create(ctx context.Context, a *data.ServiceAlert) error {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	if err := s.s.checkServiceAlert(a); err != nil {
+		return err
+	}
+
+	s.s.nextServiceAlertID++
+	row := copyServiceAlert(*a)
+	row.ID = s.s.nextServiceAlertID
+	row.CreatedAt = s.s.now().UTC()
+	row.UpdatedAt = row.CreatedAt
+	s.s.serviceAlerts = append(s.s.serviceAlerts, row)
+
+	*a = s.s.resolveServiceAlert(row)
+
+	return nil
+}
+
+func (s *ServiceAlertsStorage) Update(ctx context.Context, a *data.ServiceAlert) error {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	i := slices.IndexFunc(s.s.serviceAlerts, func(existing data.ServiceAlert) bool { return existing.ID == a.ID })
+	if i < 0 {
+		return fmt.Errorf("service alert %d: %w", a.ID, data.ErrNotFound)
+	}
+	if err := s.s.checkServiceAlert(a); err != nil {
+		return err
+	}
+
+	row := copyServiceAlert(*a)
+	row.CreatedAt = s.s.serviceAlerts[i].CreatedAt
+	row.UpdatedAt = s.s.now().UTC()
+	s.s.serviceAlerts = slices.Clone(s.s.serviceAlerts)
+	s.s.serviceAlerts[i] = row
+
+	*a = s.s.resolveServiceAlert(row)
+
+	return nil
+}
+
+func (s *ServiceAlertsStorage) Delete(ctx context.Context, id int64) error {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	for i, a := range s.s.serviceAlerts {
+		if a.ID == id {
+			s.s.serviceAlerts = append(s.s.serviceAlerts[:i:i], s.s.serviceAlerts[i+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("service alert %d: %w", id, data.ErrNotFound)
+}
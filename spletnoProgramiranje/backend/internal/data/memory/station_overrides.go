@@ -0,0 +1,58 @@
+package memory
+
+import (
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"slices"
+)
+
+type StationOverridesStorage struct {
+	s *store
+}
+
+func (s *StationOverridesStorage) List(ctx context.Context) ([]data.StationOverride, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	return append([]data.StationOverride{}, s.s.stationOverrides...), nil
+}
+
+func (s *StationOverridesStorage) Set(ctx context.Context, o *data.StationOverride) error {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	for _, id := range []int{o.StopID, o.StationStopID} {
+		if _, ok := s.s.stop(id); !ok {
+			return fmt.Errorf("saving station override: stop %d: %w", id, data.ErrNotFound)
+		}
+	}
+
+	row := data.StationOverride{StopID: o.StopID, StationStopID: o.StationStopID, UpdatedAt: s.s.now().UTC()}
+	i, found := slices.BinarySearchFunc(s.s.stationOverrides, o.StopID, func(e data.StationOverride, id int) int {
+		return e.StopID - id
+	})
+	if found {
+		s.s.stationOverrides[i] = row
+	} else {
+		s.s.stationOverrides = slices.Insert(s.s.stationOverrides, i, row)
+	}
+
+	*o = row
+
+	return nil
+}
+
+func (s *StationOverridesStorage) Delete(ctx context.Context, stopID int64) error {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	for i, o := range s.s.stationOverrides {
+		if int64(o.StopID) == stopID {
+			s.s.stationOverrides = append(s.s.stationOverrides[:i:i], s.s.stationOverrides[i+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("station override of stop %d: %w", stopID, data.ErrNotFound)
+}
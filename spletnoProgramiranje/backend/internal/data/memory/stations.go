@@ -0,0 +1,358 @@
+package memory
+
+import (
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+type StopStorage struct {
+	s *store
+}
+
+func (s *StopStorage) ReadStation(ctx context.Context, id int64) (*data.Stop, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	stop, ok := s.s.stop(int(id))
+	if !ok {
+		return nil, fmt.Errorf("stop %d: %w", id, data.ErrNotFound)
+	}
+
+	return &stop, nil
+}
+
+func (s *StopStorage) ReadList(ctx context.Context) ([]data.Stop, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	return append([]data.Stop{}, s.s.stops...), nil
+}
+
+func (s *StopStorage) ReadStationMetadata(ctx context.Context, id int64) (*data.StopMetadata, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	stop, ok := s.s.stop(int(id))
+	if !ok {
+		return nil, fmt.Errorf("stop %d: %w", id, data.ErrNotFound)
+	}
+
+	metadata := data.StopMetadata{
+		ID:        int64(stop.ID),
+		Number:    stop.Number,
+		Name:      stop.Name,
+		Latitude:  stop.Latitude,
+		Longitude: stop.Longitude,
+	}
+
+	type departureKey struct {
+		line      string
+		direction string
+	}
+	secs := make(map[departureKey][]int)
+
+	for _, d := range s.s.departures {
+		if d.StopID != stop.ID {
+			continue
+		}
+		dir, ok := s.s.direction(d.DirectionID)
+		if !ok {
+			continue
+		}
+		line, ok := s.s.line(dir.LineID)
+		if !ok {
+			continue
+		}
+		key := departureKey{line: line.LineCode, direction: dir.Name}
+		secs[key] = append(secs[key], d.secs...)
+	}
+
+	for key, times := range secs {
+		sort.Ints(times)
+		group := data.DepartureGroup{Line: key.line, Direction: key.direction}
+		for _, sec := range times {
+			group.Times = append(group.Times, clock(sec))
+		}
+		metadata.Departures = append(metadata.Departures, group)
+	}
+
+	sort.Slice(metadata.Departures, func(i, j int) bool {
+		a, b := metadata.Departures[i], metadata.Departures[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Direction < b.Direction
+	})
+
+	return &metadata, nil
+}
+
+func (s *StopStorage) ReadStationsCloseBy(ctx context.Context, payload *data.Location) ([]data.Stop, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	stops := []data.Stop{}
+	for _, stop := range s.s.stops {
+		if distanceMeters(payload.Latitude, payload.Longitude, stop.Latitude, stop.Longitude) <= float64(payload.Radius) {
+			stops = append(stops, stop)
+		}
+	}
+
+	return stops, nil
+}
+
+func (s *StopStorage) ReadThreeStationsAtDestination(ctx context.Context, payload *data.PathLocation) ([]data.Stop, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	return s.s.nearestStops(payload.DestinationLatitude, payload.DestinationLongitude, 3, payload.AvoidStopIDs), nil
+}
+
+func (s *StopStorage) ReadStationLines(ctx context.Context, stops []data.Stop) ([]data.Line, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	lines := []data.Line{}
+
+	for _, stop := range stops {
+		seen := make(map[data.Line]bool)
+		var stopLines []data.Line
+
+		for _, d := range s.s.departures {
+			if d.StopID != stop.ID {
+				continue
+			}
+			dir, ok := s.s.direction(d.DirectionID)
+			if !ok {
+				continue
+			}
+			line, ok := s.s.line(dir.LineID)
+			if !ok {
+				continue
+			}
+			l := data.Line{ID: line.ID, LineCode: line.LineCode, Name: dir.Name}
+			if !seen[l] {
+				seen[l] = true
+				stopLines = append(stopLines, l)
+			}
+		}
+
+		sort.Slice(stopLines, func(i, j int) bool {
+			if stopLines[i].ID != stopLines[j].ID {
+				return stopLines[i].ID < stopLines[j].ID
+			}
+			return stopLines[i].Name < stopLines[j].Name
+		})
+		lines = append(lines, stopLines...)
+	}
+
+	return lines, nil
+}
+
+// ReadThreeStationsAtLocation matches the Postgres implementation, which
+// ranks stops by distance from the destination and ignores lines.
+func (s *StopStorage) ReadThreeStationsAtLocation(ctx context.Context, payload *data.PathLocation, lines []data.Line) ([]data.Stop, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	return s.s.nearestStops(payload.DestinationLatitude, payload.DestinationLongitude, 3, payload.AvoidStopIDs), nil
+}
+
+func (s *StopStorage) ReadUpcomingDepartures(ctx context.Context, q data.DepartureQuery) ([]data.UpcomingDeparture, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	today := q.From.Format("2006-01-02")
+	from := secondsOfDay(q.From)
+
+	type upcoming struct {
+		data.UpcomingDeparture
+		sec int
+	}
+	var found []upcoming
+
+	for _, d := range s.s.departures {
+		if d.StopID != int(q.StopID) || !d.runsOn(today) {
+			continue
+		}
+		dir, ok := s.s.direction(d.DirectionID)
+		if !ok {
+			continue
+		}
+		line, ok := s.s.line(dir.LineID)
+		if !ok || (q.LineID != 0 && line.ID != int(q.LineID)) {
+			continue
+		}
+		for _, sec := range d.secs {
+			if sec < from {
+				continue
+			}
+			found = append(found, upcoming{
+				UpcomingDeparture: data.UpcomingDeparture{
+					StopID:      d.StopID,
+					LineID:      line.ID,
+					LineCode:    line.LineCode,
+					DirectionID: dir.ID,
+					Direction:   dir.Name,
+					Time:        clock(sec),
+				},
+				sec: sec,
+			})
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		a, b := found[i], found[j]
+		if a.sec != b.sec {
+			return a.sec < b.sec
+		}
+		if a.LineID != b.LineID {
+			return a.LineID < b.LineID
+		}
+		return a.Direction < b.Direction
+	})
+
+	departures := []data.UpcomingDeparture{}
+	for _, u := range found {
+		if len(departures) == q.Limit {
+			break
+		}
+		departures = append(departures, u.UpcomingDeparture)
+	}
+
+	return departures, nil
+}
+
+func (s *StopStorage) ReadConnections(ctx context.Context, q data.ConnectionQuery) ([]data.Connection, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	day := q.Date.Format("2006-01-02")
+
+	// Times at both stops per direction.
+	origin := make(map[int][]int)
+	destination := make(map[int][]int)
+	for _, d := range s.s.departures {
+		if !d.runsOn(day) {
+			continue
+		}
+		switch d.StopID {
+		case int(q.FromStopID):
+			origin[d.DirectionID] = append(origin[d.DirectionID], d.secs...)
+		case int(q.ToStopID):
+			destination[d.DirectionID] = append(destination[d.DirectionID], d.secs...)
+		}
+	}
+
+	type ride struct {
+		data.Connection
+		departs, arrives int
+	}
+	var rides []ride
+
+	for dirID, departs := range origin {
+		dir, ok := s.s.direction(dirID)
+		if !ok {
+			continue
+		}
+		line, ok := s.s.line(dir.LineID)
+		if !ok {
+			continue
+		}
+
+		// The latest departure before each arrival.
+		latest := make(map[int]int)
+		for _, dep := range departs {
+			arrives, found := 0, false
+			for _, arr := range destination[dirID] {
+				if arr > dep && (!found || arr < arrives) {
+					arrives, found = arr, true
+				}
+			}
+			if found {
+				if cur, ok := latest[arrives]; !ok || dep > cur {
+					latest[arrives] = dep
+				}
+			}
+		}
+
+		for arrives, departs := range latest {
+			rides = append(rides, ride{
+				Connection: data.Connection{
+					LineID:      line.ID,
+					LineCode:    line.LineCode,
+					DirectionID: dir.ID,
+					Direction:   dir.Name,
+					Departure:   clock(departs),
+					Arrival:     clock(arrives),
+				},
+				departs: departs,
+				arrives: arrives,
+			})
+		}
+	}
+
+	sort.Slice(rides, func(i, j int) bool {
+		a, b := rides[i], rides[j]
+		if a.departs != b.departs {
+			return a.departs < b.departs
+		}
+		if a.arrives != b.arrives {
+			return a.arrives < b.arrives
+		}
+		if a.LineID != b.LineID {
+			return a.LineID < b.LineID
+		}
+		return a.Direction < b.Direction
+	})
+
+	connections := []data.Connection{}
+	for _, r := range rides {
+		connections = append(connections, r.Connection)
+	}
+
+	return connections, nil
+}
+
+func (s *StopStorage) ReadStopTimes(ctx context.Context, date time.Time) ([]data.StopTimes, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	day := date.Format("2006-01-02")
+
+	type key struct{ direction, stop int }
+	byKey := map[key]*data.StopTimes{}
+	for _, d := range s.s.departures {
+		if !d.runsOn(day) {
+			continue
+		}
+		dir, ok := s.s.direction(d.DirectionID)
+		if !ok {
+			continue
+		}
+		k := key{d.DirectionID, d.StopID}
+		st, ok := byKey[k]
+		if !ok {
+			st = &data.StopTimes{StopID: d.StopID, LineID: dir.LineID, DirectionID: d.DirectionID}
+			byKey[k] = st
+		}
+		st.Seconds = append(st.Seconds, d.secs...)
+	}
+
+	times := []data.StopTimes{}
+	for _, st := range byKey {
+		sort.Ints(st.Seconds)
+		times = append(times, *st)
+	}
+	sort.Slice(times, func(i, j int) bool {
+		if times[i].DirectionID != times[j].DirectionID {
+			return times[i].DirectionID < times[j].DirectionID
+		}
+		return times[i].StopID < times[j].StopID
+	})
+
+	return times, nil
+}
@@ -0,0 +1,134 @@
+package memory
+
+import (
+	"backend/internal/data"
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+type TripsStorage struct {
+	s *store
+}
+
+// resolveTrip fills in the stop names the Postgres storage joins in.
+func (s *store) resolveTrip(t data.SavedTrip) data.SavedTrip {
+	if stop, ok := s.stop(t.OriginStopID); ok {
+		t.OriginName = stop.Name
+	}
+	if stop, ok := s.stop(t.DestinationStopID); ok {
+		t.DestinationName = stop.Name
+	}
+	t.Weekdays = slices.Clone(t.Weekdays)
+	return t
+}
+
+// checkTrip mirrors the foreign keys and the unique name of saved_trips.
+func (s *store) checkTrip(t *data.SavedTrip) error {
+	for _, id := range []int{t.OriginStopID, t.DestinationStopID} {
+		if _, ok := s.stop(id); !ok {
+			return fmt.Errorf("stop %d: %w", id, data.ErrNotFound)
+		}
+	}
+	for _, existing := range s.trips {
+		if existing.UserID == t.UserID && existing.Name == t.Name && existing.ID != t.ID {
+			return data.ErrConflict
+		}
+	}
+	return nil
+}
+
+func (s *TripsStorage) List(ctx context.Context, userID int) ([]data.SavedTrip, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	trips := []data.SavedTrip{}
+	for _, t := range s.s.trips {
+		if t.UserID == userID {
+			trips = append(trips, s.s.resolveTrip(t))
+		}
+	}
+
+	sort.Slice(trips, func(i, j int) bool {
+		if trips[i].Time != trips[j].Time {
+			return trips[i].Time < trips[j].Time
+		}
+		return trips[i].ID < trips[j].ID
+	})
+
+	return trips, nil
+}
+
+func (s *TripsStorage) Get(ctx context.Context, userID int, id int64) (*data.SavedTrip, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	for _, t := range s.s.trips {
+		if t.ID == id && t.UserID == userID {
+			resolved := s.s.resolveTrip(t)
+			return &resolved, nil
+		}
+	}
+
+	return nil, fmt.Errorf("saved trip %d: %w", id, data.ErrNotFound)
+}
+
+func (s *TripsStorage) Create(ctx context.Context, t *data.SavedTrip) error {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	t.ID = 0
+	if err := s.s.checkTrip(t); err != nil {
+		return fmt.Errorf("creating saved trip: %w", err)
+	}
+
+	s.s.nextTripID++
+	row := *t
+	row.ID = s.s.nextTripID
+	row.Weekdays = slices.Clone(t.Weekdays)
+	row.CreatedAt = s.s.now().UTC()
+	s.s.trips = append(s.s.trips, row)
+
+	*t = s.s.resolveTrip(row)
+
+	return nil
+}
+
+func (s *TripsStorage) Update(ctx context.Context, t *data.SavedTrip) error {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	for i, existing := range s.s.trips {
+		if existing.ID != t.ID || existing.UserID != t.UserID {
+			continue
+		}
+		if err := s.s.checkTrip(t); err != nil {
+			return fmt.Errorf("updating saved trip: %w", err)
+		}
+
+		row := *t
+		row.Weekdays = slices.Clone(t.Weekdays)
+		row.CreatedAt = existing.CreatedAt
+		s.s.trips[i] = row
+
+		*t = s.s.resolveTrip(row)
+		return nil
+	}
+
+	return fmt.Errorf("saved trip %d: %w", t.ID, data.ErrNotFound)
+}
+
+func (s *TripsStorage) Delete(ctx context.Context, userID int, id int64) error {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	for i, t := range s.s.trips {
+		if t.ID == id && t.UserID == userID {
+			s.s.trips = append(s.s.trips[:i:i], s.s.trips[i+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("saved trip %d: %w", id, data.ErrNotFound)
+}
@@ -0,0 +1,108 @@
+package memory
+
+import (
+	"backend/internal/data"
+	"context"
+	"fmt"
+)
+
+type UsersStorage struct {
+	s *store
+}
+
+func (s *UsersStorage) Create(ctx context.Context, user *data.User) error {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	for _, u := range s.s.users {
+		if u.Username == user.Username || u.Email == user.Email {
+			return fmt.Errorf("user %q: %w", user.Email, data.ErrConflict)
+		}
+	}
+
+	s.s.nextUserID++
+	s.s.users = append(s.s.users, data.User{
+		ID:        s.s.nextUserID,
+		Username:  user.Username,
+		Email:     user.Email,
+		Password:  user.Password,
+		Role:      data.RoleUser,
+		CreatedAt: s.s.now().UTC(),
+	})
+
+	return nil
+}
+
+func (s *UsersStorage) GetByEmail(ctx context.Context, email string) (*data.User, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	for _, u := range s.s.users {
+		if u.Email == email {
+			return &u, nil
+		}
+	}
+
+	return nil, fmt.Errorf("user with email %q: %w", email, data.ErrNotFound)
+}
+
+func (s *UsersStorage) GetById(ctx context.Context, id int) (*data.User, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	u, ok := s.s.user(id)
+	if !ok {
+		return nil, fmt.Errorf("user %d: %w", id, data.ErrNotFound)
+	}
+
+	user := *u
+	return &user, nil
+}
+
+// Lock only checks that the user exists: transactions hold the store's
+// write lock throughout and are serialised already.
+func (s *UsersStorage) Lock(ctx context.Context, id int) error {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	if _, ok := s.s.user(id); !ok {
+		return fmt.Errorf("user %d: %w", id, data.ErrNotFound)
+	}
+	return nil
+}
+
+func (s *UsersStorage) UpdateById(ctx context.Context, id int, update *data.UpdateUserPayload) error {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	for _, u := range s.s.users {
+		if u.ID != id && (u.Username == update.Username || u.Email == update.Email) {
+			return fmt.Errorf("user %q: %w", update.Email, data.ErrConflict)
+		}
+	}
+
+	if u, ok := s.s.user(id); ok {
+		u.Username = update.Username
+		u.Email = update.Email
+	}
+
+	return nil
+}
+
+func (s *UsersStorage) GetByIDForClient(ctx context.Context, id int) (*data.UserForClient, error) {
+	s.s.mu.RLock()
+	defer s.s.mu.RUnlock()
+
+	u, ok := s.s.user(id)
+	if !ok {
+		return nil, fmt.Errorf("user %d: %w", id, data.ErrNotFound)
+	}
+
+	return &data.UserForClient{
+		ID:        u.ID,
+		Username:  u.Username,
+		Email:     u.Email,
+		CreatedAt: u.CreatedAt,
+		LastLogin: u.LastLogin,
+	}, nil
+}
@@ -1,15 +1,21 @@
 package data
 
 import (
+	"backend/internal/tracing"
 	"context"
 	"database/sql"
 	"fmt"
+
+	"go.uber.org/zap"
 )
 
 type OccupancyStorage struct {
-	db *sql.DB
+	db     querier
+	logger *zap.SugaredLogger
 }
 
+// OccupancyRecord is one occupancy sample. Time is "15:04:05" and Date, when
+// selected, is "2006-01-02".
 type OccupancyRecord struct {
 	Time           string
 	Date           string
@@ -29,7 +35,7 @@ type AvgDailyOccupancy struct {
 func (s *OccupancyStorage) GetOccupancyForLineByDate(ctx context.Context, lineID int, targetDate string) ([]OccupancyRecord, error) {
 	query := `
 	SELECT
-	  o.time,
+	  to_char(o.time, 'HH24:MI:SS'),
 	  o.occupancy_level
 	FROM occupancy AS o
 	WHERE o.line_id = $1
@@ -37,9 +43,12 @@ func (s *OccupancyStorage) GetOccupancyForLineByDate(ctx context.Context, lineID
 	ORDER BY o.time;
 	`
 
+	ctx, span := startQuerySpan(ctx, "OccupancyStorage.GetOccupancyForLineByDate", query)
+	defer span.End()
+
 	rows, err := s.db.QueryContext(ctx, query, lineID, targetDate)
 	if err != nil {
-		return nil, fmt.Errorf("query failed: %w", err)
+		return nil, span.Fail(fmt.Errorf("query failed: %w", err))
 	}
 	defer rows.Close()
 
@@ -48,19 +57,21 @@ func (s *OccupancyStorage) GetOccupancyForLineByDate(ctx context.Context, lineID
 		var r OccupancyRecord
 		err := rows.Scan(&r.Time, &r.OccupancyLevel)
 		if err != nil {
-			return nil, fmt.Errorf("scan failed: %w", err)
+			return nil, span.Fail(fmt.Errorf("scan failed: %w", err))
 		}
 		results = append(results, r)
 	}
 
-	return results, rows.Err()
+	span.SetAttributes(tracing.Int("db.rows", len(results)))
+
+	return results, span.Fail(rows.Err())
 }
 
 func (s *OccupancyStorage) GetOccupancyForLineByDateAndHour(ctx context.Context, lineID int, targetDate string, targetHour int) ([]OccupancyRecord, error) {
 	query := `
 	SELECT
-	  o.time,
-	  o.date,
+	  to_char(o.time, 'HH24:MI:SS'),
+	  to_char(o.date, 'YYYY-MM-DD'),
 	  o.occupancy_level
 	FROM occupancy AS o
 	WHERE o.line_id = $1
@@ -69,9 +80,12 @@ func (s *OccupancyStorage) GetOccupancyForLineByDateAndHour(ctx context.Context,
 	ORDER BY o.time;
 	`
 
+	ctx, span := startQuerySpan(ctx, "OccupancyStorage.GetOccupancyForLineByDateAndHour", query)
+	defer span.End()
+
 	rows, err := s.db.QueryContext(ctx, query, lineID, targetDate, targetHour)
 	if err != nil {
-		return nil, fmt.Errorf("query failed: %w", err)
+		return nil, span.Fail(fmt.Errorf("query failed: %w", err))
 	}
 	defer rows.Close()
 
@@ -80,12 +94,14 @@ func (s *OccupancyStorage) GetOccupancyForLineByDateAndHour(ctx context.Context,
 		var r OccupancyRecord
 		err := rows.Scan(&r.Time, &r.Date, &r.OccupancyLevel)
 		if err != nil {
-			return nil, fmt.Errorf("scan failed: %w", err)
+			return nil, span.Fail(fmt.Errorf("scan failed: %w", err))
 		}
 		results = append(results, r)
 	}
 
-	return results, rows.Err()
+	span.SetAttributes(tracing.Int("db.rows", len(results)))
+
+	return results, span.Fail(rows.Err())
 }
 
 func (s *OccupancyStorage) GetAvgOccupancyAllLinesByHour(ctx context.Context, targetHour int) (*AvgOccupancyByHour, error) {
@@ -99,6 +115,9 @@ func (s *OccupancyStorage) GetAvgOccupancyAllLinesByHour(ctx context.Context, ta
 	ORDER BY hour_of_day;
 	`
 
+	ctx, span := startQuerySpan(ctx, "OccupancyStorage.GetAvgOccupancyAllLinesByHour", query)
+	defer span.End()
+
 	row := s.db.QueryRowContext(ctx, query, targetHour)
 
 	var result AvgOccupancyByHour
@@ -107,7 +126,7 @@ func (s *OccupancyStorage) GetAvgOccupancyAllLinesByHour(ctx context.Context, ta
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
-		return nil, fmt.Errorf("scan failed: %w", err)
+		return nil, span.Fail(fmt.Errorf("scan failed: %w", err))
 	}
 
 	return &result, nil
@@ -116,13 +135,16 @@ func (s *OccupancyStorage) GetAvgOccupancyAllLinesByHour(ctx context.Context, ta
 func (s *OccupancyStorage) GetAvgDailyOccupancyAllLines(ctx context.Context, targetDate string) (*AvgDailyOccupancy, error) {
 	query := `
 	SELECT
-	  o.date,
+	  to_char(o.date, 'YYYY-MM-DD'),
 	  AVG(o.occupancy_level)::NUMERIC(10,2) AS avg_daily_occupancy_all_lines
 	FROM occupancy AS o
 	WHERE o.date = $1
 	GROUP BY o.date;
 	`
 
+	ctx, span := startQuerySpan(ctx, "OccupancyStorage.GetAvgDailyOccupancyAllLines", query)
+	defer span.End()
+
 	row := s.db.QueryRowContext(ctx, query, targetDate)
 
 	var result AvgDailyOccupancy
@@ -131,7 +153,7 @@ func (s *OccupancyStorage) GetAvgDailyOccupancyAllLines(ctx context.Context, tar
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
-		return nil, fmt.Errorf("scan failed: %w", err)
+		return nil, span.Fail(fmt.Errorf("scan failed: %w", err))
 	}
 
 	return &result, nil
@@ -0,0 +1,111 @@
+//go:build integration
+
+package data_test
+
+import (
+	"backend/internal/data"
+	"backend/internal/data/memory"
+	"backend/internal/data/storagetest"
+	"backend/internal/db/migrations"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+)
+
+// TestPostgresStorageContract runs the storage contract against the database
+// at TEST_DATABASE_URL. Every table the suite touches is truncated, so never
+// point it at a database holding real data. `make test-integration` starts a
+// throwaway PostGIS container for it.
+func TestPostgresStorageContract(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	migrator, err := migrations.New(db, zap.NewNop().Sugar())
+	require.NoError(t, err)
+	_, err = migrator.Up(ctx)
+	require.NoError(t, err)
+
+	storagetest.Run(t, func(t *testing.T, fixtures *memory.Fixtures) data.Storage {
+		seedPostgres(t, db, fixtures)
+		return data.NewStorage(db, zaptest.NewLogger(t).Sugar())
+	})
+}
+
+func seedPostgres(t *testing.T, db *sql.DB, f *memory.Fixtures) {
+	t.Helper()
+	ctx := context.Background()
+
+	exec := func(query string, args ...any) {
+		t.Helper()
+		_, err := db.ExecContext(ctx, query, args...)
+		require.NoError(t, err, query)
+	}
+
+	exec(`TRUNCATE station_overrides, route_shapes, service_alert_entities, service_alerts, push_cursor, push_subscriptions, alert_cursor, alert_deliveries, alert_subscriptions, saved_trips, favourites, api_key_usage, api_keys, occupancy, delays, arrivals, departures,
+		routes, directions, lines, stops, users RESTART IDENTITY CASCADE`)
+
+	for _, s := range f.Stops {
+		exec(`INSERT INTO stops (id, number, name, latitude, longitude) VALUES ($1, $2, $3, $4, $5)`,
+			s.ID, s.Number, s.Name, s.Latitude, s.Longitude)
+	}
+	for _, l := range f.Lines {
+		exec(`INSERT INTO lines (id, line_code, colour) VALUES ($1, $2, NULLIF($3, ''))`, l.ID, l.LineCode, l.Colour)
+	}
+	for _, d := range f.Directions {
+		exec(`INSERT INTO directions (id, line_id, name) VALUES ($1, $2, $3)`, d.ID, d.LineID, d.Name)
+	}
+
+	today := time.Now().Format("2006-01-02")
+	for _, d := range f.Departures {
+		date := d.Date
+		if date == "" {
+			date = today
+		}
+		exec(`INSERT INTO departures (id, stop_id, direction_id, date, line_id) VALUES ($1, $2, $3, $4, $5)`,
+			d.ID, d.StopID, d.DirectionID, date, d.LineID)
+		exec(`INSERT INTO arrivals (departure_time, departures_id) VALUES ($1::time[], $2)`,
+			pq.Array(d.Times), d.ID)
+	}
+
+	for _, r := range f.Routes {
+		path, err := json.Marshal(r.Path)
+		require.NoError(t, err)
+		exec(`INSERT INTO routes (id, name, path, line_id) VALUES ($1, $2, $3, $4)`, r.ID, r.Name, string(path), r.LineID)
+	}
+	for _, u := range f.Users {
+		exec(`INSERT INTO users (id, username, email, password, role, created_at, last_login)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			u.ID, u.Username, u.Email, u.Password, u.Role, u.CreatedAt, u.LastLogin)
+	}
+	for _, d := range f.Delays {
+		exec(`INSERT INTO delays (id, date, delay_min, stop_id, line_id, user_id) VALUES ($1, $2, $3, $4, $5, $6)`,
+			d.ID, d.Date, d.DelayMin, d.StopID, d.LineID, d.UserID)
+	}
+	for _, o := range f.Occupancy {
+		exec(`INSERT INTO occupancy (id, line_id, date, "time", occupancy_level) VALUES ($1, $2, $3, $4, $5)`,
+			o.ID, o.LineID, o.Date, o.Time, o.OccupancyLevel)
+	}
+
+	// Rows were inserted with explicit ids; move the sequences past them so
+	// inserts made by the suite do not collide.
+	for _, table := range []string{"users", "lines", "directions", "departures", "arrivals", "routes", "delays", "occupancy"} {
+		exec(`SELECT setval(pg_get_serial_sequence('public.` + table + `', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM ` + table)
+	}
+}
@@ -0,0 +1,314 @@
+package data
+
+import (
+	"backend/internal/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// PushSubscription is a browser a user enabled Web Push notifications on.
+// P256dh and Auth are the browser's message encryption keys, base64url
+// encoded as the Push API returns them.
+type PushSubscription struct {
+	ID        int64      `json:"id"`
+	UserID    int        `json:"-"`
+	Endpoint  string     `json:"endpoint"`
+	P256dh    string     `json:"-"`
+	Auth      string     `json:"-"`
+	UserAgent string     `json:"user_agent"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// PushSubscriptionPayload is the JSON of a browser PushSubscription, as
+// returned by its toJSON method. ExpirationTime is in Unix milliseconds.
+type PushSubscriptionPayload struct {
+	Endpoint       string `json:"endpoint" validate:"required,max=2000"`
+	ExpirationTime *int64 `json:"expirationTime"`
+	Keys           struct {
+		P256dh string `json:"p256dh" validate:"required,max=200"`
+		Auth   string `json:"auth" validate:"required,max=100"`
+	} `json:"keys"`
+}
+
+type PushStorage struct {
+	db     querier
+	logger *zap.SugaredLogger
+}
+
+func scanPushSubscription(row interface{ Scan(...any) error }) (*PushSubscription, error) {
+	var p PushSubscription
+	err := row.Scan(&p.ID, &p.UserID, &p.Endpoint, &p.P256dh, &p.Auth, &p.UserAgent, &p.ExpiresAt, &p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+const pushSubscriptionColumns = `
+	p.id, p.user_id, p.endpoint, p.p256dh, p.auth, p.user_agent, p.expires_at, p.created_at
+`
+
+func (s *PushStorage) querySubscriptions(ctx context.Context, name, query string, args ...any) ([]PushSubscription, error) {
+	ctx, span := startQuerySpan(ctx, name, query)
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, span.Fail(err)
+	}
+	defer rows.Close()
+
+	subs := []PushSubscription{}
+	for rows.Next() {
+		p, err := scanPushSubscription(rows)
+		if err != nil {
+			return nil, span.Fail(err)
+		}
+		subs = append(subs, *p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, span.Fail(err)
+	}
+
+	span.SetAttributes(tracing.Int("db.rows", len(subs)))
+
+	return subs, nil
+}
+
+// List returns the push subscriptions of a user, oldest first.
+func (s *PushStorage) List(ctx context.Context, userID int) ([]PushSubscription, error) {
+	query := `SELECT` + pushSubscriptionColumns + `FROM push_subscriptions AS p WHERE p.user_id = $1 ORDER BY p.id`
+	return s.querySubscriptions(ctx, "PushStorage.List", query, userID)
+}
+
+// Save stores a push subscription and fills in its ID and creation time. A
+// browser has one subscription per endpoint, so saving a known endpoint
+// replaces its keys and owner, such as after a different user logged in on
+// the same browser.
+func (s *PushStorage) Save(ctx context.Context, p *PushSubscription) error {
+	query := `
+		WITH p AS (
+			INSERT INTO push_subscriptions (user_id, endpoint, p256dh, auth, user_agent, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (endpoint) DO UPDATE
+			SET user_id = EXCLUDED.user_id, p256dh = EXCLUDED.p256dh, auth = EXCLUDED.auth,
+				user_agent = EXCLUDED.user_agent, expires_at = EXCLUDED.expires_at
+			RETURNING *
+		)
+		SELECT` + pushSubscriptionColumns + `FROM p`
+
+	ctx, span := startQuerySpan(ctx, "PushStorage.Save", query)
+	defer span.End()
+
+	saved, err := scanPushSubscription(s.db.QueryRowContext(ctx, query,
+		p.UserID, p.Endpoint, p.P256dh, p.Auth, p.UserAgent, p.ExpiresAt))
+	if err != nil {
+		if err := mapMissingReference(err); errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("saving push subscription: %w", err)
+		}
+		return span.Fail(fmt.Errorf("saving push subscription: %w", err))
+	}
+
+	*p = *saved
+
+	return nil
+}
+
+// Delete removes a push subscription of the user. Subscriptions of other
+// users are reported as ErrNotFound.
+func (s *PushStorage) Delete(ctx context.Context, userID int, id int64) error {
+	query := `DELETE FROM push_subscriptions WHERE id = $1 AND user_id = $2`
+
+	ctx, span := startQuerySpan(ctx, "PushStorage.Delete", query)
+	defer span.End()
+
+	res, err := s.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return span.Fail(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return span.Fail(err)
+	}
+	if n == 0 {
+		return fmt.Errorf("push subscription %d: %w", id, ErrNotFound)
+	}
+
+	return nil
+}
+
+// DeleteEndpoint removes the subscription of an endpoint the push service
+// no longer accepts. Unknown endpoints are ignored.
+func (s *PushStorage) DeleteEndpoint(ctx context.Context, endpoint string) error {
+	query := `DELETE FROM push_subscriptions WHERE endpoint = $1`
+
+	ctx, span := startQuerySpan(ctx, "PushStorage.DeleteEndpoint", query)
+	defer span.End()
+
+	if _, err := s.db.ExecContext(ctx, query, endpoint); err != nil {
+		return span.Fail(err)
+	}
+
+	return nil
+}
+
+// DeleteExpired removes the subscriptions that expired before now and
+// returns how many there were.
+func (s *PushStorage) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	query := `DELETE FROM push_subscriptions WHERE expires_at < $1`
+
+	ctx, span := startQuerySpan(ctx, "PushStorage.DeleteExpired", query)
+	defer span.End()
+
+	res, err := s.db.ExecContext(ctx, query, now)
+	if err != nil {
+		return 0, span.Fail(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, span.Fail(err)
+	}
+
+	return int(n), nil
+}
+
+// Targets returns the subscriptions of every user with a favourite on the
+// line, either the whole line or the line at the stop.
+func (s *PushStorage) Targets(ctx context.Context, lineID, stopID int) ([]PushSubscription, error) {
+	query := `
+		SELECT` + pushSubscriptionColumns + `
+		FROM push_subscriptions AS p
+		WHERE EXISTS (
+			SELECT 1 FROM favourites AS f
+			WHERE f.user_id = p.user_id AND f.line_id = $1 AND (f.stop_id IS NULL OR f.stop_id = $2)
+		)
+		ORDER BY p.id
+	`
+	return s.querySubscriptions(ctx, "PushStorage.Targets", query, lineID, stopID)
+}
+
+// AlertTargets returns the subscriptions of users with a favourite the
+// service alert affects: a favourite line the alert is about, or a favourite
+// stop it is about, or both when the favourite names a line at a stop.
+func (s *PushStorage) AlertTargets(ctx context.Context, alertID int64) ([]PushSubscription, error) {
+	query := `
+		SELECT` + pushSubscriptionColumns + `
+		FROM push_subscriptions AS p
+		WHERE EXISTS (
+			SELECT 1 FROM favourites AS f
+			JOIN service_alert_entities AS e ON e.alert_id = $1
+			WHERE f.user_id = p.user_id
+			AND (f.line_id IS NULL OR
+				e.line_id = f.line_id
+				OR e.direction_id IN (SELECT id FROM directions WHERE line_id = f.line_id)
+				OR (e.line_id IS NULL AND e.direction_id IS NULL AND e.stop_id IN (
+					SELECT dep.stop_id FROM departures AS dep
+					JOIN directions AS dir ON dir.id = dep.direction_id
+					WHERE dir.line_id = f.line_id
+				))
+			)
+			AND (f.stop_id IS NULL OR
+				e.stop_id = f.stop_id
+				OR (e.stop_id IS NULL AND (
+					e.direction_id IN (SELECT direction_id FROM departures WHERE stop_id = f.stop_id)
+					OR (e.direction_id IS NULL AND e.line_id IN (
+						SELECT dir.line_id FROM departures AS dep
+						JOIN directions AS dir ON dir.id = dep.direction_id
+						WHERE dep.stop_id = f.stop_id
+					))
+				))
+			)
+		)
+		ORDER BY p.id
+	`
+	return s.querySubscriptions(ctx, "PushStorage.AlertTargets", query, alertID)
+}
+
+// Claim returns the ID of the last delay report push notifications were
+// sent for and locks it until the surrounding transaction ends, so that
+// only one API instance sends each report. The first call starts at the
+// newest report.
+func (s *PushStorage) Claim(ctx context.Context) (int, error) {
+	insert := `
+		INSERT INTO push_cursor (id, last_delay_id)
+		SELECT 1, COALESCE(MAX(id), 0) FROM delays
+		ON CONFLICT (id) DO NOTHING
+	`
+	query := `SELECT last_delay_id FROM push_cursor WHERE id = 1 FOR UPDATE`
+
+	ctx, span := startQuerySpan(ctx, "PushStorage.Claim", query)
+	defer span.End()
+
+	if _, err := s.db.ExecContext(ctx, insert); err != nil {
+		return 0, span.Fail(err)
+	}
+
+	var cursor int
+	if err := s.db.QueryRowContext(ctx, query).Scan(&cursor); err != nil {
+		return 0, span.Fail(err)
+	}
+
+	return cursor, nil
+}
+
+// SetCursor records the last delay report push notifications were sent for.
+func (s *PushStorage) SetCursor(ctx context.Context, delayID int) error {
+	query := `UPDATE push_cursor SET last_delay_id = $1 WHERE id = 1`
+
+	ctx, span := startQuerySpan(ctx, "PushStorage.SetCursor", query)
+	defer span.End()
+
+	if _, err := s.db.ExecContext(ctx, query, delayID); err != nil {
+		return span.Fail(err)
+	}
+
+	return nil
+}
+
+// ServiceAlertCursor returns the ID of the last service alert push
+// notifications were sent for. Call it after Claim, which holds the lock;
+// the first call starts at the newest alert.
+func (s *PushStorage) ServiceAlertCursor(ctx context.Context) (int64, error) {
+	init := `
+		UPDATE push_cursor SET last_service_alert_id = (SELECT COALESCE(MAX(id), 0) FROM service_alerts)
+		WHERE id = 1 AND last_service_alert_id IS NULL
+	`
+	query := `SELECT last_service_alert_id FROM push_cursor WHERE id = 1`
+
+	ctx, span := startQuerySpan(ctx, "PushStorage.ServiceAlertCursor", query)
+	defer span.End()
+
+	if _, err := s.db.ExecContext(ctx, init); err != nil {
+		return 0, span.Fail(err)
+	}
+
+	var cursor int64
+	if err := s.db.QueryRowContext(ctx, query).Scan(&cursor); err != nil {
+		return 0, span.Fail(err)
+	}
+
+	return cursor, nil
+}
+
+// SetServiceAlertCursor records the last service alert push notifications
+// were sent for.
+func (s *PushStorage) SetServiceAlertCursor(ctx context.Context, alertID int64) error {
+	query := `UPDATE push_cursor SET last_service_alert_id = $1 WHERE id = 1`
+
+	ctx, span := startQuerySpan(ctx, "PushStorage.SetServiceAlertCursor", query)
+	defer span.End()
+
+	if _, err := s.db.ExecContext(ctx, query, alertID); err != nil {
+		return span.Fail(err)
+	}
+
+	return nil
+}
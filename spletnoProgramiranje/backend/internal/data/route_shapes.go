@@ -0,0 +1,188 @@
+package data
+
+import (
+	"backend/internal/tracing"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RouteShape is a version of a direction's path, valid between ValidFrom and
+// ValidUntil. Nil bounds are open-ended. A shape valid for a few weeks
+// models a roadworks detour; where no shape is valid, the line's Route.Path
+// is used. When shapes overlap, the one starting latest wins.
+type RouteShape struct {
+	ID          int64       `json:"id"`
+	LineID      int         `json:"line_id"`
+	DirectionID int         `json:"direction_id"`
+	Direction   string      `json:"direction"`
+	Path        [][]float64 `json:"path"`
+	ValidFrom   *time.Time  `json:"valid_from,omitempty"`
+	ValidUntil  *time.Time  `json:"valid_until,omitempty"`
+	Note        string      `json:"note,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+type RouteShapePayload struct {
+	DirectionID int         `json:"direction_id" validate:"required,min=1"`
+	Path        [][]float64 `json:"path" validate:"required,max=5000"`
+	ValidFrom   *time.Time  `json:"valid_from"`
+	ValidUntil  *time.Time  `json:"valid_until"`
+	Note        string      `json:"note" validate:"omitempty,max=200"`
+}
+
+// ValidAt reports whether the shape is in use at t.
+func (sh *RouteShape) ValidAt(t time.Time) bool {
+	return (sh.ValidFrom == nil || !t.Before(*sh.ValidFrom)) && (sh.ValidUntil == nil || t.Before(*sh.ValidUntil))
+}
+
+// RouteQuery selects the path ReadRoute returns.
+type RouteQuery struct {
+	// DirectionID is a direction of the line; 0 means its first one.
+	DirectionID int
+	// At picks the shape valid at that moment; zero means now.
+	At time.Time
+}
+
+// validShapeQuery selects the id, path and valid_until of the shape of the
+// direction valid at the moment, for use in a LATERAL join.
+func validShapeQuery(direction, at string) string {
+	return `
+		SELECT rs.id, rs.path, rs.valid_until
+		FROM route_shapes AS rs
+		WHERE rs.direction_id = ` + direction + `
+		AND (rs.valid_from IS NULL OR rs.valid_from <= ` + at + `)
+		AND (rs.valid_until IS NULL OR rs.valid_until > ` + at + `)
+		ORDER BY rs.valid_from DESC NULLS LAST, rs.id DESC
+		LIMIT 1
+	`
+}
+
+type RouteShapesStorage struct {
+	db     querier
+	logger *zap.SugaredLogger
+}
+
+const routeShapeColumns = `
+	rs.id, dir.line_id, rs.direction_id, dir.name, rs.path, rs.valid_from, rs.valid_until, rs.note, rs.created_at
+`
+
+func scanRouteShape(row interface{ Scan(...any) error }) (*RouteShape, error) {
+	var (
+		sh     RouteShape
+		lineID sql.NullInt64
+		path   []byte
+	)
+	err := row.Scan(&sh.ID, &lineID, &sh.DirectionID, &sh.Direction, &path, &sh.ValidFrom, &sh.ValidUntil,
+		&sh.Note, &sh.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	sh.LineID = int(lineID.Int64)
+
+	if err := json.Unmarshal(path, &sh.Path); err != nil {
+		return nil, fmt.Errorf("route shape %d path: %w", sh.ID, err)
+	}
+
+	return &sh, nil
+}
+
+// List returns the shapes of the line's directions, by direction and then
+// latest start first.
+func (s *RouteShapesStorage) List(ctx context.Context, lineID int) ([]RouteShape, error) {
+	query := `
+		SELECT` + routeShapeColumns + `
+		FROM route_shapes AS rs
+		JOIN directions AS dir ON dir.id = rs.direction_id
+		WHERE dir.line_id = $1
+		ORDER BY rs.direction_id, rs.valid_from DESC NULLS LAST, rs.id DESC
+	`
+
+	ctx, span := startQuerySpan(ctx, "RouteShapesStorage.List", query)
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query, lineID)
+	if err != nil {
+		return nil, span.Fail(err)
+	}
+	defer rows.Close()
+
+	shapes := []RouteShape{}
+	for rows.Next() {
+		sh, err := scanRouteShape(rows)
+		if err != nil {
+			return nil, span.Fail(err)
+		}
+		shapes = append(shapes, *sh)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, span.Fail(err)
+	}
+
+	span.SetAttributes(tracing.Int("db.rows", len(shapes)))
+
+	return shapes, nil
+}
+
+// Create stores a shape and fills in its ID, line, direction name and
+// creation time. It returns ErrNotFound when the direction does not exist.
+func (s *RouteShapesStorage) Create(ctx context.Context, sh *RouteShape) error {
+	query := `
+		WITH rs AS (
+			INSERT INTO route_shapes (direction_id, path, valid_from, valid_until, note)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING *
+		)
+		SELECT` + routeShapeColumns + `
+		FROM rs
+		JOIN directions AS dir ON dir.id = rs.direction_id
+	`
+
+	path, err := json.Marshal(sh.Path)
+	if err != nil {
+		return err
+	}
+
+	ctx, span := startQuerySpan(ctx, "RouteShapesStorage.Create", query)
+	defer span.End()
+
+	created, err := scanRouteShape(s.db.QueryRowContext(ctx, query, sh.DirectionID, path, sh.ValidFrom, sh.ValidUntil, sh.Note))
+	if err != nil {
+		if err := mapMissingReference(err); errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("saving route shape: %w", err)
+		}
+		return span.Fail(fmt.Errorf("saving route shape: %w", err))
+	}
+	*sh = *created
+
+	return nil
+}
+
+// Delete removes a route shape.
+func (s *RouteShapesStorage) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM route_shapes WHERE id = $1`
+
+	ctx, span := startQuerySpan(ctx, "RouteShapesStorage.Delete", query)
+	defer span.End()
+
+	res, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return span.Fail(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return span.Fail(err)
+	}
+	if n == 0 {
+		return fmt.Errorf("route shape %d: %w", id, ErrNotFound)
+	}
+
+	return nil
+}
@@ -1,13 +1,19 @@
 package data
 
 import (
+	"backend/internal/geo"
+	"backend/internal/logging"
+	"backend/internal/tracing"
 	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"math"
+	"sort"
 	"time"
 
 	"github.com/lib/pq"
+	"go.uber.org/zap"
 )
 
 type Route struct {
@@ -15,10 +21,75 @@ type Route struct {
 	Name   string      `json:"name"`
 	Path   [][]float64 `json:"path"`
 	LineID int         `json:"line_id"`
+	// DirectionID is the direction the path is for, if the line has any.
+	// ShapeID and ValidUntil are set when Path is a RouteShape rather than
+	// the line's usual path.
+	DirectionID int        `json:"direction_id,omitempty"`
+	ShapeID     int64      `json:"shape_id,omitempty"`
+	ValidUntil  *time.Time `json:"valid_until,omitempty"`
+	// Alerts are the service alerts in effect on the line, where a
+	// response asks for them.
+	Alerts []ServiceAlert `json:"alerts,omitempty"`
+}
+
+// Direction is one of the two ways a line runs, named after where it heads.
+type Direction struct {
+	ID       int    `json:"id"`
+	LineID   int    `json:"line_id"`
+	LineCode string `json:"line_code"`
+	Name     string `json:"name"`
+}
+
+// DirectionStop is a stop in the order a direction's buses call at it.
+// OffsetSeconds is the scheduled time from the first stop. DistanceMeters
+// is the distance from the first stop along the direction's path and
+// Projection the [lat, lon] point of the path closest to the stop; both are
+// left out when the line has no path.
+type DirectionStop struct {
+	Sequence       int       `json:"sequence"`
+	Stop           Stop      `json:"stop"`
+	OffsetSeconds  int       `json:"offset_seconds"`
+	DistanceMeters *float64  `json:"distance_meters,omitempty"`
+	Projection     []float64 `json:"projection,omitempty"`
+}
+
+// DirectionStopsQuery selects the stop sequence of a direction of a line
+// as Date's timetable has it.
+type DirectionStopsQuery struct {
+	LineID      int64
+	DirectionID int64
+	Date        time.Time
+}
+
+// ProjectStops fills in where the stops lie along the path. A path drawn
+// from the last stop to the first is measured from its end, so distances
+// grow along the sequence either way.
+func ProjectStops(path [][]float64, stops []DirectionStop) {
+	if len(path) < 2 || len(stops) == 0 {
+		return
+	}
+
+	along := make([]float64, len(stops))
+	for i := range stops {
+		p, _ := geo.Project(path, stops[i].Stop.Latitude, stops[i].Stop.Longitude)
+		along[i] = p.AlongMeters
+		stops[i].Projection = []float64{p.Lat, p.Lon}
+	}
+
+	reversed := along[len(along)-1] < along[0]
+	for i := range stops {
+		distance := along[i] - along[0]
+		if reversed {
+			distance = -distance
+		}
+		distance = math.Round(distance*10) / 10
+		stops[i].DistanceMeters = &distance
+	}
 }
 
 type RoutesStorage struct {
-	db *sql.DB
+	db     querier
+	logger *zap.SugaredLogger
 }
 
 type Coord struct {
@@ -42,28 +113,56 @@ type BusPosition struct {
 	Lon         float64 `json:"lon"`
 }
 
-func (s *RoutesStorage) ReadRoute(ctx context.Context, id int64) (*Route, error) {
+// ReadRoute returns the path of a direction of the line: the shape valid at
+// q.At or, failing that, the line's usual path. It returns ErrNotFound when
+// the line has no route or q.DirectionID is not one of its directions.
+func (s *RoutesStorage) ReadRoute(ctx context.Context, id int64, q RouteQuery) (*Route, error) {
 	query := `
-        SELECT id, name, path
-        FROM routes
-        WHERE line_id = $1
+        SELECT r.id, r.name, COALESCE(sh.path, r.path), r.line_id, dir.id, sh.id, sh.valid_until
+        FROM routes AS r
+        LEFT JOIN LATERAL (
+            SELECT id FROM directions
+            WHERE line_id = r.line_id AND ($2 = 0 OR id = $2)
+            ORDER BY id
+            LIMIT 1
+        ) AS dir ON true
+        LEFT JOIN LATERAL (` + validShapeQuery("dir.id", "$3::timestamptz") + `) AS sh ON true
+        WHERE r.line_id = $1 AND ($2 = 0 OR dir.id IS NOT NULL)
+        ORDER BY r.id
         LIMIT 1
     `
 
-	var route Route
-	var pathData []byte
+	at := q.At
+	if at.IsZero() {
+		at = time.Now()
+	}
 
-	row := s.db.QueryRowContext(ctx, query, id)
-	err := row.Scan(&route.ID, &route.Name, &pathData)
+	ctx, span := startQuerySpan(ctx, "RoutesStorage.ReadRoute", query)
+	defer span.End()
+
+	var (
+		route       Route
+		pathData    []byte
+		directionID sql.NullInt64
+		shapeID     sql.NullInt64
+	)
+
+	row := s.db.QueryRowContext(ctx, query, id, q.DirectionID, at)
+	err := row.Scan(&route.ID, &route.Name, &pathData, &route.LineID, &directionID, &shapeID, &route.ValidUntil)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("no route found for line_id %d", id)
+			if q.DirectionID != 0 {
+				return nil, fmt.Errorf("route for line %d direction %d: %w", id, q.DirectionID, ErrNotFound)
+			}
+			return nil, fmt.Errorf("route for line %d: %w", id, ErrNotFound)
 		}
-		return nil, fmt.Errorf("failed to scan route: %w", err)
+		return nil, span.Fail(fmt.Errorf("failed to scan route: %w", err))
 	}
+	route.DirectionID = int(directionID.Int64)
+	route.ShapeID = shapeID.Int64
 
 	if err := json.Unmarshal(pathData, &route.Path); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal path data: %w", err)
+		return nil, span.Fail(fmt.Errorf("failed to unmarshal path data: %w", err))
 	}
 
 	return &route, nil
@@ -80,11 +179,14 @@ func (s *RoutesStorage) ReadRouteStations(ctx context.Context, id int64) ([]Stop
         ORDER BY s.number
     `
 
+	ctx, span := startQuerySpan(ctx, "RoutesStorage.ReadRouteStations", query)
+	defer span.End()
+
 	var stops []Stop
 
 	rows, err := s.db.QueryContext(ctx, query, id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query stops: %w", err)
+		return nil, span.Fail(fmt.Errorf("failed to query stops: %w", err))
 	}
 
 	defer rows.Close()
@@ -93,29 +195,194 @@ func (s *RoutesStorage) ReadRouteStations(ctx context.Context, id int64) ([]Stop
 		var stop Stop
 		err := rows.Scan(&stop.ID, &stop.Number, &stop.Name, &stop.Latitude, &stop.Longitude)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan stop: %w", err)
+			return nil, span.Fail(fmt.Errorf("failed to scan stop: %w", err))
 		}
 		stops = append(stops, stop)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error during rows iteration: %w", err)
+		return nil, span.Fail(fmt.Errorf("error during rows iteration: %w", err))
 	}
 
+	span.SetAttributes(tracing.Int("db.rows", len(stops)))
+
 	return stops, nil
 }
 
+// ReadDirections returns the directions of the line. It returns ErrNotFound
+// for an unknown line.
+func (s *RoutesStorage) ReadDirections(ctx context.Context, lineID int64) ([]Direction, error) {
+	query := `
+		SELECT l.id, l.line_code, dir.id, dir.name
+		FROM lines AS l
+		LEFT JOIN directions AS dir ON dir.line_id = l.id
+		WHERE l.id = $1
+		ORDER BY dir.id
+	`
+
+	ctx, span := startQuerySpan(ctx, "RoutesStorage.ReadDirections", query)
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query, lineID)
+	if err != nil {
+		return nil, span.Fail(err)
+	}
+	defer rows.Close()
+
+	var (
+		directions = []Direction{}
+		found      bool
+	)
+	for rows.Next() {
+		var (
+			d    Direction
+			id   sql.NullInt64
+			name sql.NullString
+		)
+		if err := rows.Scan(&d.LineID, &d.LineCode, &id, &name); err != nil {
+			return nil, span.Fail(err)
+		}
+		found = true
+		if id.Valid {
+			d.ID, d.Name = int(id.Int64), name.String
+			directions = append(directions, d)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, span.Fail(err)
+	}
+	if !found {
+		return nil, fmt.Errorf("line %d: %w", lineID, ErrNotFound)
+	}
+
+	span.SetAttributes(tracing.Int("db.rows", len(directions)))
+
+	return directions, nil
+}
+
+// OrderDirectionStops puts the stop times of one direction in the order its
+// buses call at the stops. The timetable does not link the times of one bus
+// across stops, so stops are ordered by their first time of the day, and by
+// ID when two share it. Stops without times are left out; times is not
+// modified.
+func OrderDirectionStops(times []StopTimes) []StopTimes {
+	ordered := make([]StopTimes, 0, len(times))
+	for _, st := range times {
+		if len(st.Seconds) > 0 {
+			ordered = append(ordered, st)
+		}
+	}
+
+	sort.Slice(ordered, func(i, j int) bool {
+		if ordered[i].Seconds[0] != ordered[j].Seconds[0] {
+			return ordered[i].Seconds[0] < ordered[j].Seconds[0]
+		}
+		return ordered[i].StopID < ordered[j].StopID
+	})
+
+	return ordered
+}
+
+// DirectionStops numbers the stops of a direction in the order
+// OrderDirectionStops gives, with offsets from the first stop's first time.
+// stops holds the stop of every StopID in times; others are left out.
+func DirectionStops(times []StopTimes, stops map[int]Stop) []DirectionStop {
+	sequence := []DirectionStop{}
+	var start int
+	for _, st := range OrderDirectionStops(times) {
+		stop, ok := stops[st.StopID]
+		if !ok {
+			continue
+		}
+		if len(sequence) == 0 {
+			start = st.Seconds[0]
+		}
+		sequence = append(sequence, DirectionStop{Sequence: len(sequence) + 1, Stop: stop, OffsetSeconds: st.Seconds[0] - start})
+	}
+	return sequence
+}
+
+// ReadDirectionStops returns the stops of the direction in the order its
+// buses call at them, as OrderDirectionStops has it. OffsetSeconds is
+// measured from the first stop's first time of the day. It returns
+// ErrNotFound when the direction is not one of the line's.
+func (s *RoutesStorage) ReadDirectionStops(ctx context.Context, q DirectionStopsQuery) ([]DirectionStop, error) {
+	query := `
+		SELECT s.id, s.number, s.name, s.latitude, s.longitude,
+			array_agg(EXTRACT(EPOCH FROM t.at)::int ORDER BY t.at)
+		FROM departures AS d
+		JOIN arrivals   AS a ON a.departures_id = d.id
+		JOIN stops      AS s ON s.id = d.stop_id
+		CROSS JOIN LATERAL unnest(a.departure_time) AS t(at)
+		WHERE d.direction_id = $1
+		  AND d.date = $2::date
+		GROUP BY s.id
+	`
+
+	ctx, span := startQuerySpan(ctx, "RoutesStorage.ReadDirectionStops", query)
+	defer span.End()
+
+	var exists bool
+	err := s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM directions WHERE id = $1 AND line_id = $2)`,
+		q.DirectionID, q.LineID).Scan(&exists)
+	if err != nil {
+		return nil, span.Fail(err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("direction %d of line %d: %w", q.DirectionID, q.LineID, ErrNotFound)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, q.DirectionID, q.Date.Format("2006-01-02"))
+	if err != nil {
+		return nil, span.Fail(err)
+	}
+	defer rows.Close()
+
+	var (
+		times []StopTimes
+		stops = map[int]Stop{}
+	)
+	for rows.Next() {
+		var (
+			stop    Stop
+			seconds pq.Int64Array
+		)
+		if err := rows.Scan(&stop.ID, &stop.Number, &stop.Name, &stop.Latitude, &stop.Longitude, &seconds); err != nil {
+			return nil, span.Fail(err)
+		}
+		st := StopTimes{StopID: stop.ID, DirectionID: int(q.DirectionID), Seconds: make([]int, len(seconds))}
+		for i, sec := range seconds {
+			st.Seconds[i] = int(sec)
+		}
+		times = append(times, st)
+		stops[stop.ID] = stop
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, span.Fail(err)
+	}
+
+	span.SetAttributes(tracing.Int("db.rows", len(times)))
+
+	return DirectionStops(times, stops), nil
+}
+
 func (s *RoutesStorage) ReadRoutesList(ctx context.Context) ([]Route, error) {
 	query := `
         SELECT id, name, path, line_id
         FROM routes
+        ORDER BY id
     `
 
+	ctx, span := startQuerySpan(ctx, "RoutesStorage.ReadRoutesList", query)
+	defer span.End()
+
 	var routes []Route
 
 	rows, err := s.db.QueryContext(ctx, query)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query stops: %w", err)
+		return nil, span.Fail(fmt.Errorf("failed to query stops: %w", err))
 	}
 
 	defer rows.Close()
@@ -125,24 +392,96 @@ func (s *RoutesStorage) ReadRoutesList(ctx context.Context) ([]Route, error) {
 		var pathData []byte
 		err := rows.Scan(&route.ID, &route.Name, &pathData, &route.LineID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan stop: %w", err)
+			return nil, span.Fail(fmt.Errorf("failed to scan stop: %w", err))
 		}
 
 		if err := json.Unmarshal(pathData, &route.Path); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal path data: %w", err)
+			return nil, span.Fail(fmt.Errorf("failed to unmarshal path data: %w", err))
 		}
 
 		routes = append(routes, route)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error during rows iteration: %w", err)
+		return nil, span.Fail(fmt.Errorf("error during rows iteration: %w", err))
 	}
 
+	span.SetAttributes(tracing.Int("db.rows", len(routes)))
+
 	return routes, nil
 
 }
 
+// MapRoute is a line's usual path with what a map needs to draw it.
+type MapRoute struct {
+	ID       int         `json:"id"`
+	LineID   int         `json:"line_id"`
+	LineCode string      `json:"line_code"`
+	Colour   string      `json:"colour"`
+	Path     [][]float64 `json:"path"`
+}
+
+// linePalette colours the lines that have no colour of their own.
+var linePalette = []string{
+	"#e6194b", "#3cb44b", "#4363d8", "#f58231", "#911eb4", "#42d4f4",
+	"#f032e6", "#9a6324", "#800000", "#469990", "#000075", "#808000",
+}
+
+// LineColour is the line's colour, or one picked from a fixed palette by its
+// ID when it has none, so a line keeps its colour from one map to the next.
+func LineColour(lineID int, colour string) string {
+	if colour != "" {
+		return colour
+	}
+	if lineID < 0 {
+		lineID = -lineID
+	}
+	return linePalette[lineID%len(linePalette)]
+}
+
+// ReadMapRoutes returns every route with its line's code and colour.
+func (s *RoutesStorage) ReadMapRoutes(ctx context.Context) ([]MapRoute, error) {
+	query := `
+		SELECT r.id, l.id, l.line_code, COALESCE(l.colour, ''), r.path
+		FROM routes AS r
+		JOIN lines AS l ON l.id = r.line_id
+		ORDER BY r.id
+	`
+
+	ctx, span := startQuerySpan(ctx, "RoutesStorage.ReadMapRoutes", query)
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, span.Fail(fmt.Errorf("failed to query routes: %w", err))
+	}
+	defer rows.Close()
+
+	routes := []MapRoute{}
+	for rows.Next() {
+		var (
+			r    MapRoute
+			path []byte
+		)
+		if err := rows.Scan(&r.ID, &r.LineID, &r.LineCode, &r.Colour, &path); err != nil {
+			return nil, span.Fail(fmt.Errorf("failed to scan route: %w", err))
+		}
+		if err := json.Unmarshal(path, &r.Path); err != nil {
+			return nil, span.Fail(fmt.Errorf("route %d path: %w", r.ID, err))
+		}
+		r.Colour = LineColour(r.LineID, r.Colour)
+		routes = append(routes, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, span.Fail(fmt.Errorf("error during rows iteration: %w", err))
+	}
+
+	span.SetAttributes(tracing.Int("db.rows", len(routes)))
+
+	return routes, nil
+}
+
 func (s *RoutesStorage) ReadActiveLines(ctx context.Context) (int, error) {
 	query := `
 	WITH UnnestedTripTimes AS (
@@ -179,32 +518,37 @@ func (s *RoutesStorage) ReadActiveLines(ctx context.Context) (int, error) {
 		AND (NOW()::time) <= segment_end_time;
 	`
 
+	ctx, span := startQuerySpan(ctx, "RoutesStorage.ReadActiveLines", query)
+	defer span.End()
+
 	var activeTrips int
-	fmt.Println("Executing SQL Query:\n", query)
-	err := s.db.QueryRow(query).Scan(&activeTrips)
+	err := s.db.QueryRowContext(ctx, query).Scan(&activeTrips)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return 0, nil
 		}
-		return 0, fmt.Errorf("Error querying active lines: %w", err)
+		return 0, span.Fail(fmt.Errorf("Error querying active lines: %w", err))
 	}
 
 	return activeTrips / 19, nil
 }
 
+// FetchActiveRuns returns today's latest active run of each direction of the
+// line. A run's Path is the shape of its direction valid now, or the line's
+// usual path.
 func (s *RoutesStorage) FetchActiveRuns(ctx context.Context, lineID int) ([]ActiveRun, error) {
 	now := time.Now()
 	today := now.Format("2006-01-02")
 	currentTime := now.Format("15:04:05")
 
-	const sqlQuery = `
+	sqlQuery := `
 		WITH candidates AS (
 		SELECT
 			d.id             AS departure_id,
 			d.direction_id   AS direction_id,
 			a.departure_time AS arr_times,
-			r.path           AS route_path,
+			COALESCE(sh.path, r.path) AS route_path,
 			-- first and last departure times as text
 			a.departure_time[1]::text AS start_time_str,
 			a.departure_time[array_length(a.departure_time,1)]::text AS end_time_str
@@ -212,9 +556,14 @@ func (s *RoutesStorage) FetchActiveRuns(ctx context.Context, lineID int) ([]Acti
 		JOIN public.arrivals   a ON a.departures_id = d.id
 		JOIN public.directions dir ON dir.id = d.direction_id
 		JOIN public.lines      l   ON l.id = dir.line_id
-		JOIN public.routes     r   ON r.line_id = l.id
+		LEFT JOIN LATERAL (
+			SELECT path FROM public.routes WHERE line_id = l.id ORDER BY id LIMIT 1
+		) AS r ON true
+		-- the direction's shape valid now, such as a detour
+		LEFT JOIN LATERAL (` + validShapeQuery("d.direction_id", "$4::timestamptz") + `) AS sh ON true
 		WHERE
 			l.id    = $1
+			AND COALESCE(sh.path, r.path) IS NOT NULL
 			AND d.date = $2
 			AND a.departure_time[1] <= $3::time
 			AND a.departure_time[array_length(a.departure_time,1)] >= $3::time
@@ -229,9 +578,12 @@ func (s *RoutesStorage) FetchActiveRuns(ctx context.Context, lineID int) ([]Acti
 		start_time_str DESC;   
 		`
 
-	rows, err := s.db.Query(sqlQuery, lineID, today, currentTime)
+	ctx, span := startQuerySpan(ctx, "RoutesStorage.FetchActiveRuns", sqlQuery)
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, sqlQuery, lineID, today, currentTime, now)
 	if err != nil {
-		return nil, err
+		return nil, span.Fail(err)
 	}
 	defer rows.Close()
 
@@ -249,14 +601,14 @@ func (s *RoutesStorage) FetchActiveRuns(ctx context.Context, lineID int) ([]Acti
 		)
 
 		if err := rows.Scan(&runID, &dirID, pq.Array(&arrTimesRaw), &pathRaw, &startStr, &endStr); err != nil {
-			return nil, err
+			return nil, span.Fail(err)
 		}
 
 		var arrTimes []time.Time
 		for _, ts := range arrTimesRaw {
 			t, err := time.ParseInLocation("15:04:05", ts, time.Local)
 			if err != nil {
-				return nil, fmt.Errorf("cannot parse arrival time %q: %w", ts, err)
+				return nil, span.Fail(fmt.Errorf("cannot parse arrival time %q: %w", ts, err))
 			}
 			full := time.Date(now.Year(), now.Month(), now.Day(),
 				t.Hour(), t.Minute(), t.Second(), 0, time.Local)
@@ -265,11 +617,19 @@ func (s *RoutesStorage) FetchActiveRuns(ctx context.Context, lineID int) ([]Acti
 
 		var path [][]float64
 		if err := json.Unmarshal(pathRaw, &path); err != nil {
-			return nil, fmt.Errorf("cannot unmarshal path for run %d: %w", runID, err)
+			return nil, span.Fail(fmt.Errorf("cannot unmarshal path for run %d: %w", runID, err))
 		}
 
-		startT, _ := time.ParseInLocation("15:04:05", startStr, time.Local)
-		endT, _ := time.ParseInLocation("15:04:05", endStr, time.Local)
+		startT, err := time.ParseInLocation("15:04:05", startStr, time.Local)
+		if err != nil {
+			logging.FromContext(ctx, s.logger).Warnw("skipping run with unparsable start time", "run_id", runID, "start", startStr)
+			continue
+		}
+		endT, err := time.ParseInLocation("15:04:05", endStr, time.Local)
+		if err != nil {
+			logging.FromContext(ctx, s.logger).Warnw("skipping run with unparsable end time", "run_id", runID, "end", endStr)
+			continue
+		}
 
 		sSec := startT.Hour()*3600 + startT.Minute()*60 + startT.Second()
 		eSec := endT.Hour()*3600 + endT.Minute()*60 + endT.Second()
@@ -290,7 +650,10 @@ func (s *RoutesStorage) FetchActiveRuns(ctx context.Context, lineID int) ([]Acti
 		})
 	}
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, span.Fail(err)
 	}
+
+	span.SetAttributes(tracing.Int("db.rows", len(runs)))
+
 	return runs, nil
 }
@@ -0,0 +1,33 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDirectionStopsOrder(t *testing.T) {
+	times := []StopTimes{
+		{StopID: 3, Seconds: []int{600, 1200}},
+		{StopID: 2, Seconds: []int{300}},
+		{StopID: 4, Seconds: []int{}},
+		{StopID: 1, Seconds: []int{300, 900}},
+	}
+	stops := map[int]Stop{
+		1: {ID: 1, Number: "002"},
+		2: {ID: 2, Number: "001"},
+		3: {ID: 3, Number: "003"},
+		4: {ID: 4, Number: "004"},
+	}
+
+	got := DirectionStops(times, stops)
+
+	ids := make([]int, len(got))
+	for i, ds := range got {
+		ids[i] = ds.Stop.ID
+		assert.Equal(t, i+1, ds.Sequence)
+	}
+	assert.Equal(t, []int{1, 2, 3}, ids, "stops sharing a first time go by ID, not number; stops without times are left out")
+	assert.Equal(t, []int{0, 0, 300}, []int{got[0].OffsetSeconds, got[1].OffsetSeconds, got[2].OffsetSeconds})
+	assert.Equal(t, 2, times[1].StopID, "the input is not reordered")
+}
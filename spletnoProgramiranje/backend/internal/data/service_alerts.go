@@ -0,0 +1,484 @@
+package data
+
+import (
+	"backend/internal/tracing"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// Service alert causes, as in GTFS Realtime.
+const (
+	CauseUnknown          = "unknown_cause"
+	CauseOther            = "other_cause"
+	CauseTechnicalProblem = "technical_problem"
+	CauseStrike           = "strike"
+	CauseDemonstration    = "demonstration"
+	CauseAccident         = "accident"
+	CauseHoliday          = "holiday"
+	CauseWeather          = "weather"
+	CauseMaintenance      = "maintenance"
+	CauseConstruction     = "construction"
+	CausePoliceActivity   = "police_activity"
+	CauseMedicalEmergency = "medical_emergency"
+)
+
+// Service alert effects, as in GTFS Realtime.
+const (
+	EffectNoService         = "no_service"
+	EffectReducedService    = "reduced_service"
+	EffectSignificantDelays = "significant_delays"
+	EffectDetour            = "detour"
+	EffectAdditionalService = "additional_service"
+	EffectModifiedService   = "modified_service"
+	EffectOther             = "other_effect"
+	EffectUnknown           = "unknown_effect"
+	EffectStopMoved         = "stop_moved"
+)
+
+// DefaultLanguage is the language every service alert must have a header in.
+const DefaultLanguage = "sl"
+
+// Translations maps language codes, such as "sl" or "en", to text.
+type Translations map[string]string
+
+// ServiceAlert announces a change to service, such as a closed stop or a
+// diverted line, for the time between ActiveFrom and ActiveUntil. A nil
+// ActiveUntil means until further notice. Detour is the diverted path as
+// [lat, lon] pairs, like Route.Path.
+type ServiceAlert struct {
+	ID          int64                `json:"id"`
+	Cause       string               `json:"cause"`
+	Effect      string               `json:"effect"`
+	Header      Translations         `json:"header"`
+	Description Translations         `json:"description"`
+	URL         string               `json:"url,omitempty"`
+	ActiveFrom  time.Time            `json:"active_from"`
+	ActiveUntil *time.Time           `json:"active_until,omitempty"`
+	Entities    []ServiceAlertEntity `json:"entities"`
+	Detour      [][]float64          `json:"detour,omitempty"`
+	CreatedAt   time.Time            `json:"created_at"`
+	UpdatedAt   time.Time            `json:"updated_at"`
+}
+
+// ServiceAlertEntity is a line, direction or stop an alert is about. With
+// only StopID set it affects every line at the stop; with LineID and StopID
+// set it affects that line at the stop.
+type ServiceAlertEntity struct {
+	LineID      *int   `json:"line_id,omitempty"`
+	LineCode    string `json:"line_code,omitempty"`
+	DirectionID *int   `json:"direction_id,omitempty"`
+	Direction   string `json:"direction,omitempty"`
+	StopID      *int   `json:"stop_id,omitempty"`
+	StopName    string `json:"stop_name,omitempty"`
+}
+
+type ServiceAlertEntityPayload struct {
+	LineID      *int `json:"line_id" validate:"omitempty,min=1"`
+	DirectionID *int `json:"direction_id" validate:"omitempty,min=1"`
+	StopID      *int `json:"stop_id" validate:"omitempty,min=1"`
+}
+
+type ServiceAlertPayload struct {
+	Cause       string                      `json:"cause" validate:"required,oneof=unknown_cause other_cause technical_problem strike demonstration accident holiday weather maintenance construction police_activity medical_emergency"`
+	Effect      string                      `json:"effect" validate:"required,oneof=no_service reduced_service significant_delays detour additional_service modified_service other_effect unknown_effect stop_moved"`
+	Header      Translations                `json:"header" validate:"required"`
+	Description Translations                `json:"description"`
+	URL         string                      `json:"url" validate:"omitempty,max=500"`
+	ActiveFrom  time.Time                   `json:"active_from" validate:"required"`
+	ActiveUntil *time.Time                  `json:"active_until"`
+	Entities    []ServiceAlertEntityPayload `json:"entities" validate:"required,max=50"`
+	Detour      [][]float64                 `json:"detour" validate:"omitempty,max=1000"`
+}
+
+// ActiveAt reports whether the alert is in effect at t.
+func (a *ServiceAlert) ActiveAt(t time.Time) bool {
+	return !t.Before(a.ActiveFrom) && (a.ActiveUntil == nil || t.Before(*a.ActiveUntil))
+}
+
+// ClosedStops returns the stops the alerts close: those named without a line
+// or direction by an alert with no service.
+func ClosedStops(alerts []ServiceAlert) []int {
+	var closed []int
+	for _, a := range alerts {
+		if a.Effect != EffectNoService {
+			continue
+		}
+		for _, e := range a.Entities {
+			if e.StopID != nil && e.LineID == nil && e.DirectionID == nil {
+				closed = append(closed, *e.StopID)
+			}
+		}
+	}
+	return closed
+}
+
+// ServiceAlertFilter selects service alerts. Zero fields match everything.
+type ServiceAlertFilter struct {
+	// ActiveAt keeps the alerts in effect at that moment.
+	ActiveAt time.Time
+	// LineID keeps the alerts about the line, one of its directions or,
+	// for alerts naming only stops, one of the stops it serves.
+	LineID int
+	// StopID keeps the alerts about the stop or, for alerts not naming a
+	// stop, one of the lines or directions serving it.
+	StopID int
+	// AfterID keeps the alerts created after the one with that ID.
+	AfterID int64
+}
+
+type ServiceAlertsStorage struct {
+	db     querier
+	logger *zap.SugaredLogger
+}
+
+const serviceAlertColumns = `
+	a.id, a.cause, a.effect, a.header, a.description, a.url, a.active_from, a.active_until, a.detour,
+	a.created_at, a.updated_at
+`
+
+func scanServiceAlert(row interface{ Scan(...any) error }) (*ServiceAlert, error) {
+	var (
+		a                           ServiceAlert
+		header, description, detour []byte
+	)
+	err := row.Scan(&a.ID, &a.Cause, &a.Effect, &header, &description, &a.URL, &a.ActiveFrom, &a.ActiveUntil,
+		&detour, &a.CreatedAt, &a.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(header, &a.Header); err != nil {
+		return nil, fmt.Errorf("service alert %d header: %w", a.ID, err)
+	}
+	if err := json.Unmarshal(description, &a.Description); err != nil {
+		return nil, fmt.Errorf("service alert %d description: %w", a.ID, err)
+	}
+	if detour != nil {
+		if err := json.Unmarshal(detour, &a.Detour); err != nil {
+			return nil, fmt.Errorf("service alert %d detour: %w", a.ID, err)
+		}
+	}
+	a.Entities = []ServiceAlertEntity{}
+
+	return &a, nil
+}
+
+// List returns the alerts matching the filter, latest start first.
+func (s *ServiceAlertsStorage) List(ctx context.Context, f ServiceAlertFilter) ([]ServiceAlert, error) {
+	query := `
+		SELECT` + serviceAlertColumns + `
+		FROM service_alerts AS a
+		WHERE ($1::timestamptz IS NULL OR (a.active_from <= $1 AND (a.active_until IS NULL OR a.active_until > $1)))
+		AND ($2 = 0 OR EXISTS (
+			SELECT 1 FROM service_alert_entities AS e
+			WHERE e.alert_id = a.id AND (
+				e.line_id = $2
+				OR e.direction_id IN (SELECT id FROM directions WHERE line_id = $2)
+				OR (e.line_id IS NULL AND e.direction_id IS NULL AND e.stop_id IN (
+					SELECT dep.stop_id FROM departures AS dep
+					JOIN directions AS dir ON dir.id = dep.direction_id
+					WHERE dir.line_id = $2
+				))
+			)
+		))
+		AND ($3 = 0 OR EXISTS (
+			SELECT 1 FROM service_alert_entities AS e
+			WHERE e.alert_id = a.id AND (
+				e.stop_id = $3
+				OR (e.stop_id IS NULL AND (
+					e.direction_id IN (SELECT direction_id FROM departures WHERE stop_id = $3)
+					OR (e.direction_id IS NULL AND e.line_id IN (
+						SELECT dir.line_id FROM departures AS dep
+						JOIN directions AS dir ON dir.id = dep.direction_id
+						WHERE dep.stop_id = $3
+					))
+				))
+			)
+		))
+		AND a.id > $4
+		ORDER BY a.active_from DESC, a.id DESC
+	`
+
+	var activeAt sql.NullTime
+	if !f.ActiveAt.IsZero() {
+		activeAt = sql.NullTime{Time: f.ActiveAt, Valid: true}
+	}
+
+	ctx, span := startQuerySpan(ctx, "ServiceAlertsStorage.List", query)
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query, activeAt, f.LineID, f.StopID, f.AfterID)
+	if err != nil {
+		return nil, span.Fail(err)
+	}
+	defer rows.Close()
+
+	alerts := []ServiceAlert{}
+	for rows.Next() {
+		a, err := scanServiceAlert(rows)
+		if err != nil {
+			return nil, span.Fail(err)
+		}
+		alerts = append(alerts, *a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, span.Fail(err)
+	}
+
+	span.SetAttributes(tracing.Int("db.rows", len(alerts)))
+
+	if err := s.readEntities(ctx, alerts); err != nil {
+		return nil, err
+	}
+
+	return alerts, nil
+}
+
+// readEntities fills in the entities of the alerts.
+func (s *ServiceAlertsStorage) readEntities(ctx context.Context, alerts []ServiceAlert) error {
+	if len(alerts) == 0 {
+		return nil
+	}
+
+	query := `
+		SELECT e.alert_id, e.line_id, l.line_code, e.direction_id, dir.name, e.stop_id, s.name
+		FROM service_alert_entities AS e
+		LEFT JOIN lines      AS l   ON l.id = e.line_id
+		LEFT JOIN directions AS dir ON dir.id = e.direction_id
+		LEFT JOIN stops      AS s   ON s.id = e.stop_id
+		WHERE e.alert_id = ANY($1)
+		ORDER BY e.id
+	`
+
+	ctx, span := startQuerySpan(ctx, "ServiceAlertsStorage.readEntities", query)
+	defer span.End()
+
+	ids := make([]int64, len(alerts))
+	index := make(map[int64]int, len(alerts))
+	for i, a := range alerts {
+		ids[i] = a.ID
+		index[a.ID] = i
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return span.Fail(err)
+	}
+	defer rows.Close()
+
+	ref := func(v sql.NullInt64) *int {
+		if !v.Valid {
+			return nil
+		}
+		id := int(v.Int64)
+		return &id
+	}
+
+	var count int
+	for rows.Next() {
+		var (
+			alertID                       int64
+			lineID, directionID, stopID   sql.NullInt64
+			lineCode, direction, stopName sql.NullString
+		)
+		if err := rows.Scan(&alertID, &lineID, &lineCode, &directionID, &direction, &stopID, &stopName); err != nil {
+			return span.Fail(err)
+		}
+
+		a := &alerts[index[alertID]]
+		a.Entities = append(a.Entities, ServiceAlertEntity{
+			LineID: ref(lineID), LineCode: lineCode.String,
+			DirectionID: ref(directionID), Direction: direction.String,
+			StopID: ref(stopID), StopName: stopName.String,
+		})
+		count++
+	}
+
+	if err := rows.Err(); err != nil {
+		return span.Fail(err)
+	}
+
+	span.SetAttributes(tracing.Int("db.rows", count))
+
+	return nil
+}
+
+// Get returns a service alert by ID.
+func (s *ServiceAlertsStorage) Get(ctx context.Context, id int64) (*ServiceAlert, error) {
+	query := `SELECT` + serviceAlertColumns + `FROM service_alerts AS a WHERE a.id = $1`
+
+	ctx, span := startQuerySpan(ctx, "ServiceAlertsStorage.Get", query)
+	defer span.End()
+
+	a, err := scanServiceAlert(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("service alert %d: %w", id, ErrNotFound)
+		}
+		return nil, span.Fail(err)
+	}
+
+	alerts := []ServiceAlert{*a}
+	if err := s.readEntities(ctx, alerts); err != nil {
+		return nil, err
+	}
+
+	return &alerts[0], nil
+}
+
+// Create stores an alert with its entities and fills in its ID, the entity
+// names and the timestamps. It returns ErrNotFound when a line, direction or
+// stop does not exist. The statements must share a transaction; see
+// Storage.WithTx.
+func (s *ServiceAlertsStorage) Create(ctx context.Context, a *ServiceAlert) error {
+	query := `
+		INSERT INTO service_alerts (cause, effect, header, description, url, active_from, active_until, detour)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`
+
+	args, err := serviceAlertArgs(a)
+	if err != nil {
+		return err
+	}
+
+	ctx, span := startQuerySpan(ctx, "ServiceAlertsStorage.Create", query)
+	defer span.End()
+
+	var id int64
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&id); err != nil {
+		return span.Fail(fmt.Errorf("creating service alert: %w", err))
+	}
+
+	if err := s.insertEntities(ctx, id, a.Entities); err != nil {
+		return err
+	}
+
+	created, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	*a = *created
+
+	return nil
+}
+
+// Update replaces an alert and its entities. It returns ErrNotFound for an
+// unknown alert or a missing line, direction or stop. The statements must
+// share a transaction; see Storage.WithTx.
+func (s *ServiceAlertsStorage) Update(ctx context.Context, a *ServiceAlert) error {
+	query := `
+		UPDATE service_alerts
+		SET cause = $1, effect = $2, header = $3, description = $4, url = $5, active_from = $6,
+			active_until = $7, detour = $8, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $9
+	`
+
+	args, err := serviceAlertArgs(a)
+	if err != nil {
+		return err
+	}
+
+	ctx, span := startQuerySpan(ctx, "ServiceAlertsStorage.Update", query)
+	defer span.End()
+
+	res, err := s.db.ExecContext(ctx, query, append(args, a.ID)...)
+	if err != nil {
+		return span.Fail(fmt.Errorf("updating service alert: %w", err))
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return span.Fail(err)
+	}
+	if n == 0 {
+		return fmt.Errorf("service alert %d: %w", a.ID, ErrNotFound)
+	}
+
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM service_alert_entities WHERE alert_id = $1`, a.ID); err != nil {
+		return span.Fail(err)
+	}
+	if err := s.insertEntities(ctx, a.ID, a.Entities); err != nil {
+		return err
+	}
+
+	updated, err := s.Get(ctx, a.ID)
+	if err != nil {
+		return err
+	}
+	*a = *updated
+
+	return nil
+}
+
+func serviceAlertArgs(a *ServiceAlert) ([]any, error) {
+	header, err := json.Marshal(a.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	description := []byte("{}")
+	if len(a.Description) > 0 {
+		if description, err = json.Marshal(a.Description); err != nil {
+			return nil, err
+		}
+	}
+
+	var detour []byte
+	if len(a.Detour) > 0 {
+		if detour, err = json.Marshal(a.Detour); err != nil {
+			return nil, err
+		}
+	}
+
+	return []any{a.Cause, a.Effect, header, description, a.URL, a.ActiveFrom, a.ActiveUntil, detour}, nil
+}
+
+func (s *ServiceAlertsStorage) insertEntities(ctx context.Context, alertID int64, entities []ServiceAlertEntity) error {
+	query := `INSERT INTO service_alert_entities (alert_id, line_id, direction_id, stop_id) VALUES ($1, $2, $3, $4)`
+
+	ctx, span := startQuerySpan(ctx, "ServiceAlertsStorage.insertEntities", query)
+	defer span.End()
+
+	for _, e := range entities {
+		if _, err := s.db.ExecContext(ctx, query, alertID, e.LineID, e.DirectionID, e.StopID); err != nil {
+			if err := mapMissingReference(err); errors.Is(err, ErrNotFound) {
+				return fmt.Errorf("saving service alert: %w", err)
+			}
+			return span.Fail(fmt.Errorf("saving service alert: %w", err))
+		}
+	}
+
+	return nil
+}
+
+// Delete removes a service alert.
+func (s *ServiceAlertsStorage) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM service_alerts WHERE id = $1`
+
+	ctx, span := startQuerySpan(ctx, "ServiceAlertsStorage.Delete", query)
+	defer span.End()
+
+	res, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return span.Fail(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return span.Fail(err)
+	}
+	if n == 0 {
+		return fmt.Errorf("service alert %d: %w", id, ErrNotFound)
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package data
+
+import (
+	"backend/internal/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ParentStation is a station as riders know it: the stops of one name, a
+// pole per direction or platform, close to each other. Its ID is the lowest
+// ID of its stops and its position the centre of them.
+type ParentStation struct {
+	ID        int     `json:"id"`
+	Name      string  `json:"name"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	// Stops are the station's poles, by number.
+	Stops []Stop `json:"stops"`
+}
+
+// StationOverride puts a stop in the station of StationStopID by hand,
+// whatever the names and distances of the stops. A stop overridden to
+// itself is a station of its own.
+type StationOverride struct {
+	StopID        int       `json:"stop_id"`
+	StationStopID int       `json:"station_stop_id"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type StationOverridePayload struct {
+	StationStopID int `json:"station_stop_id" validate:"required,min=1"`
+}
+
+type StationOverridesStorage struct {
+	db     querier
+	logger *zap.SugaredLogger
+}
+
+// List returns every override by stop.
+func (s *StationOverridesStorage) List(ctx context.Context) ([]StationOverride, error) {
+	query := `
+		SELECT stop_id, station_stop_id, updated_at
+		FROM station_overrides
+		ORDER BY stop_id
+	`
+
+	ctx, span := startQuerySpan(ctx, "StationOverridesStorage.List", query)
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, span.Fail(err)
+	}
+	defer rows.Close()
+
+	overrides := []StationOverride{}
+	for rows.Next() {
+		var o StationOverride
+		if err := rows.Scan(&o.StopID, &o.StationStopID, &o.UpdatedAt); err != nil {
+			return nil, span.Fail(err)
+		}
+		overrides = append(overrides, o)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, span.Fail(err)
+	}
+
+	span.SetAttributes(tracing.Int("db.rows", len(overrides)))
+
+	return overrides, nil
+}
+
+// Set stores the override of a stop, replacing any earlier one, and fills
+// in its update time. It returns ErrNotFound when either stop does not
+// exist.
+func (s *StationOverridesStorage) Set(ctx context.Context, o *StationOverride) error {
+	query := `
+		INSERT INTO station_overrides (stop_id, station_stop_id)
+		VALUES ($1, $2)
+		ON CONFLICT (stop_id) DO UPDATE
+		SET station_stop_id = EXCLUDED.station_stop_id, updated_at = CURRENT_TIMESTAMP
+		RETURNING updated_at
+	`
+
+	ctx, span := startQuerySpan(ctx, "StationOverridesStorage.Set", query)
+	defer span.End()
+
+	if err := s.db.QueryRowContext(ctx, query, o.StopID, o.StationStopID).Scan(&o.UpdatedAt); err != nil {
+		if err := mapMissingReference(err); errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("saving station override: %w", err)
+		}
+		return span.Fail(fmt.Errorf("saving station override: %w", err))
+	}
+
+	return nil
+}
+
+// Delete removes the override of a stop, which goes back to the station
+// clustering puts it in.
+func (s *StationOverridesStorage) Delete(ctx context.Context, stopID int64) error {
+	query := `DELETE FROM station_overrides WHERE stop_id = $1`
+
+	ctx, span := startQuerySpan(ctx, "StationOverridesStorage.Delete", query)
+	defer span.End()
+
+	res, err := s.db.ExecContext(ctx, query, stopID)
+	if err != nil {
+		return span.Fail(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return span.Fail(err)
+	}
+	if n == 0 {
+		return fmt.Errorf("station override of stop %d: %w", stopID, ErrNotFound)
+	}
+
+	return nil
+}
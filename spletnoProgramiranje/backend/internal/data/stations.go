@@ -1,9 +1,16 @@
 package data
 
 import (
+	"backend/internal/logging"
+	"backend/internal/tracing"
 	"context"
 	"database/sql"
 	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
 )
 
 type Stop struct {
@@ -12,6 +19,9 @@ type Stop struct {
 	Name      string  `json:"name"`
 	Latitude  float64 `json:"latitude"`
 	Longitude float64 `json:"longitude"`
+	// Alerts are the service alerts in effect at the stop, where a
+	// response asks for them.
+	Alerts []ServiceAlert `json:"alerts,omitempty"`
 }
 
 type StopMetadata struct {
@@ -21,6 +31,7 @@ type StopMetadata struct {
 	Latitude   float64          `json:"latitude,omitempty"`
 	Longitude  float64          `json:"longitude,omitempty"`
 	Departures []DepartureGroup `json:"departures"`
+	Alerts     []ServiceAlert   `json:"alerts"`
 }
 
 type DepartureGroup struct {
@@ -30,20 +41,36 @@ type DepartureGroup struct {
 }
 
 type Location struct {
-	Latitude  float64 `json:"latitude"`
-	Longitude float64 `json:"longitude"`
-	Radius    int     `json:"radius"`
+	Latitude  float64 `json:"latitude" validate:"latitude"`
+	Longitude float64 `json:"longitude" validate:"longitude"`
+	Radius    int     `json:"radius" validate:"required,min=1,max=5000"`
 }
 
 type PathLocation struct {
-	DestinationLatitude  float64 `json:"destination_latitude"`
-	DestinationLongitude float64 `json:"destination_longitude"`
-	LocationLatitude     float64 `json:"location_latitude"`
-	LocationLongitude    float64 `json:"location_longitude"`
+	DestinationLatitude  float64 `json:"destination_latitude" validate:"latitude"`
+	DestinationLongitude float64 `json:"destination_longitude" validate:"longitude"`
+	LocationLatitude     float64 `json:"location_latitude" validate:"latitude"`
+	LocationLongitude    float64 `json:"location_longitude" validate:"longitude"`
+	// AvoidStopIDs are left out of the results, such as stops closed by a
+	// service alert. Clients cannot set them.
+	AvoidStopIDs []int `json:"-"`
+}
+
+// IsochronePayload asks where a rider can get from a point. Bands are
+// journey times in minutes, 10, 20 and 30 when left out; Departure defaults
+// to now and WalkMeters, the longest walk at either end or between stops,
+// to 800.
+type IsochronePayload struct {
+	Latitude   float64    `json:"latitude" validate:"latitude"`
+	Longitude  float64    `json:"longitude" validate:"longitude"`
+	Departure  *time.Time `json:"departure"`
+	Bands      []int      `json:"bands" validate:"omitempty,max=6"`
+	WalkMeters int        `json:"walk_meters" validate:"omitempty,min=100,max=2000"`
 }
 
 type StopStorage struct {
-	db *sql.DB
+	db     querier
+	logger *zap.SugaredLogger
 }
 
 type Line struct {
@@ -59,15 +86,18 @@ func (s *StopStorage) ReadStation(ctx context.Context, id int64) (*Stop, error)
         WHERE id = $1
     `
 
+	ctx, span := startQuerySpan(ctx, "StopStorage.ReadStation", query)
+	defer span.End()
+
 	row := s.db.QueryRowContext(ctx, query, id)
 
 	var stop Stop
 	err := row.Scan(&stop.ID, &stop.Number, &stop.Name, &stop.Latitude, &stop.Longitude)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("No stop with id %d found", id)
+			return nil, fmt.Errorf("stop %d: %w", id, ErrNotFound)
 		}
-		return nil, err
+		return nil, span.Fail(err)
 	}
 
 	return &stop, nil
@@ -77,11 +107,15 @@ func (s *StopStorage) ReadList(ctx context.Context) ([]Stop, error) {
 	query := `
         SELECT id, number, name, latitude, longitude
         FROM stops
+        ORDER BY id
     `
 
+	ctx, span := startQuerySpan(ctx, "StopStorage.ReadList", query)
+	defer span.End()
+
 	rows, err := s.db.QueryContext(ctx, query)
 	if err != nil {
-		return nil, err
+		return nil, span.Fail(err)
 	}
 
 	defer rows.Close()
@@ -91,15 +125,17 @@ func (s *StopStorage) ReadList(ctx context.Context) ([]Stop, error) {
 		var stop Stop
 		err := rows.Scan(&stop.ID, &stop.Number, &stop.Name, &stop.Latitude, &stop.Longitude)
 		if err != nil {
-			return nil, err
+			return nil, span.Fail(err)
 		}
 		stops = append(stops, stop)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, span.Fail(err)
 	}
 
+	span.SetAttributes(tracing.Int("db.rows", len(stops)))
+
 	if len(stops) == 0 {
 		return []Stop{}, nil
 	}
@@ -138,14 +174,17 @@ func (s *StopStorage) ReadStationMetadata(ctx context.Context, id int64) (*StopM
 			t.departure_time; 
 				`
 
+	ctx, span := startQuerySpan(ctx, "StopStorage.ReadStationMetadata", query)
+	defer span.End()
+
 	rows, err := s.db.QueryContext(ctx, query, id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query stop metadata: %w", err)
+		return nil, span.Fail(fmt.Errorf("failed to query stop metadata: %w", err))
 	}
 	defer rows.Close()
 
 	var stopMetadata StopMetadata
-	var hasData bool
+	var rowCount int
 
 	type departureKey struct {
 		line      string
@@ -154,7 +193,7 @@ func (s *StopStorage) ReadStationMetadata(ctx context.Context, id int64) (*StopM
 	departuresMap := make(map[departureKey][]string)
 
 	for rows.Next() {
-		hasData = true
+		rowCount++
 
 		var departure sql.NullTime
 		var directionName sql.NullString
@@ -171,7 +210,7 @@ func (s *StopStorage) ReadStationMetadata(ctx context.Context, id int64) (*StopM
 			&lineCode,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan row: %w", err)
+			return nil, span.Fail(fmt.Errorf("failed to scan row: %w", err))
 		}
 
 		if departure.Valid && lineCode.Valid && directionName.Valid {
@@ -185,11 +224,13 @@ func (s *StopStorage) ReadStationMetadata(ctx context.Context, id int64) (*StopM
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error after row iteration: %w", err)
+		return nil, span.Fail(fmt.Errorf("error after row iteration: %w", err))
 	}
 
-	if !hasData {
-		return nil, fmt.Errorf("no stop with id %d found", id)
+	span.SetAttributes(tracing.Int("db.rows", rowCount))
+
+	if rowCount == 0 {
+		return nil, fmt.Errorf("stop %d: %w", id, ErrNotFound)
 	}
 
 	for key, times := range departuresMap {
@@ -200,6 +241,14 @@ func (s *StopStorage) ReadStationMetadata(ctx context.Context, id int64) (*StopM
 		})
 	}
 
+	sort.Slice(stopMetadata.Departures, func(i, j int) bool {
+		a, b := stopMetadata.Departures[i], stopMetadata.Departures[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Direction < b.Direction
+	})
+
 	return &stopMetadata, nil
 }
 
@@ -211,12 +260,16 @@ func (s *StopStorage) ReadStationsCloseBy(ctx context.Context, payload *Location
 			geom,
 			ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography,
 			$3
-		);
+		)
+		ORDER BY id;
     `
 
+	ctx, span := startQuerySpan(ctx, "StopStorage.ReadStationsCloseBy", query)
+	defer span.End()
+
 	rows, err := s.db.QueryContext(ctx, query, payload.Longitude, payload.Latitude, payload.Radius)
 	if err != nil {
-		return nil, err
+		return nil, span.Fail(err)
 	}
 
 	defer rows.Close()
@@ -226,15 +279,17 @@ func (s *StopStorage) ReadStationsCloseBy(ctx context.Context, payload *Location
 		var stop Stop
 		err := rows.Scan(&stop.ID, &stop.Number, &stop.Name, &stop.Latitude, &stop.Longitude)
 		if err != nil {
-			return nil, err
+			return nil, span.Fail(err)
 		}
 		stops = append(stops, stop)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, span.Fail(err)
 	}
 
+	span.SetAttributes(tracing.Int("db.rows", len(stops)))
+
 	if len(stops) == 0 {
 		return []Stop{}, nil
 	}
@@ -242,18 +297,32 @@ func (s *StopStorage) ReadStationsCloseBy(ctx context.Context, payload *Location
 	return stops, nil
 }
 
+// stopIDArray binds ids as a Postgres array. Unlike pq.Array, it sends an
+// empty array rather than NULL for nil, which would filter out every row.
+func stopIDArray(ids []int) pq.Int64Array {
+	a := make(pq.Int64Array, len(ids))
+	for i, id := range ids {
+		a[i] = int64(id)
+	}
+	return a
+}
+
 func (s *StopStorage) ReadThreeStationsAtDestination(ctx context.Context, payload *PathLocation) ([]Stop, error) {
 	query := `
         SELECT id, number, name, latitude, longitude
 		FROM stops
+		WHERE NOT (id = ANY($3))
 		ORDER BY
 			geom <-> ST_SetSRID(ST_MakePoint($1, $2), 4326)
 		LIMIT 3;
     `
 
-	rows, err := s.db.QueryContext(ctx, query, payload.DestinationLongitude, payload.DestinationLatitude)
+	ctx, span := startQuerySpan(ctx, "StopStorage.ReadThreeStationsAtDestination", query)
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query, payload.DestinationLongitude, payload.DestinationLatitude, stopIDArray(payload.AvoidStopIDs))
 	if err != nil {
-		return nil, err
+		return nil, span.Fail(err)
 	}
 
 	defer rows.Close()
@@ -263,15 +332,17 @@ func (s *StopStorage) ReadThreeStationsAtDestination(ctx context.Context, payloa
 		var stop Stop
 		err := rows.Scan(&stop.ID, &stop.Number, &stop.Name, &stop.Latitude, &stop.Longitude)
 		if err != nil {
-			return nil, err
+			return nil, span.Fail(err)
 		}
 		stops = append(stops, stop)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, span.Fail(err)
 	}
 
+	span.SetAttributes(tracing.Int("db.rows", len(stops)))
+
 	if len(stops) == 0 {
 		return []Stop{}, nil
 	}
@@ -280,9 +351,12 @@ func (s *StopStorage) ReadThreeStationsAtDestination(ctx context.Context, payloa
 }
 
 func (s *StopStorage) ReadStationLines(ctx context.Context, stops []Stop) ([]Line, error) {
+	ctx, span := tracing.Start(ctx, "StopStorage.ReadStationLines", tracing.WithKind(tracing.KindClient))
+	defer span.End()
+
 	var lines []Line
 
-	fmt.Print("sem tu notri")
+	logging.FromContext(ctx, s.logger).Debugw("reading lines for stops", "stops", len(stops))
 
 	for _, stop := range stops {
 
@@ -292,11 +366,12 @@ func (s *StopStorage) ReadStationLines(ctx context.Context, stops []Stop) ([]Lin
 			LEFT JOIN directions d ON l.id = d.line_id
 			LEFT JOIN departures dep ON dep.direction_id = d.id
 			WHERE dep.stop_id = $1
+			ORDER BY l.id, d.name
 		`
 
 		rows, err := s.db.QueryContext(ctx, query, stop.ID)
 		if err != nil {
-			return nil, err
+			return nil, span.Fail(err)
 		}
 
 		defer rows.Close()
@@ -305,16 +380,18 @@ func (s *StopStorage) ReadStationLines(ctx context.Context, stops []Stop) ([]Lin
 			var line Line
 			err := rows.Scan(&line.ID, &line.LineCode, &line.Name)
 			if err != nil {
-				return nil, err
+				return nil, span.Fail(err)
 			}
 			lines = append(lines, line)
 		}
 
 		if err = rows.Err(); err != nil {
-			return nil, err
+			return nil, span.Fail(err)
 		}
 	}
 
+	span.SetAttributes(tracing.Int("db.rows", len(lines)))
+
 	if len(lines) == 0 {
 		return []Line{}, nil
 	}
@@ -331,14 +408,18 @@ func (s *StopStorage) ReadThreeStationsAtLocation(ctx context.Context, payload *
 	query := `
         SELECT id, number, name, latitude, longitude
 		FROM stops
+		WHERE NOT (id = ANY($3))
 		ORDER BY
 			geom <-> ST_SetSRID(ST_MakePoint($1, $2), 4326)
 		LIMIT 3;
     `
 
-	rows, err := s.db.QueryContext(ctx, query, payload.DestinationLongitude, payload.DestinationLatitude)
+	ctx, span := startQuerySpan(ctx, "StopStorage.ReadThreeStationsAtLocation", query)
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query, payload.DestinationLongitude, payload.DestinationLatitude, stopIDArray(payload.AvoidStopIDs))
 	if err != nil {
-		return nil, err
+		return nil, span.Fail(err)
 	}
 
 	defer rows.Close()
@@ -348,18 +429,218 @@ func (s *StopStorage) ReadThreeStationsAtLocation(ctx context.Context, payload *
 		var stop Stop
 		err := rows.Scan(&stop.ID, &stop.Number, &stop.Name, &stop.Latitude, &stop.Longitude)
 		if err != nil {
-			return nil, err
+			return nil, span.Fail(err)
 		}
 		stops = append(stops, stop)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, span.Fail(err)
 	}
 
+	span.SetAttributes(tracing.Int("db.rows", len(stops)))
+
 	if len(stops) == 0 {
 		return []Stop{}, nil
 	}
 
 	return stops, nil
 }
+
+// DepartureQuery selects the departures leaving a stop on From's day at or
+// after From's time of day.
+type DepartureQuery struct {
+	StopID int64
+	// LineID restricts the result to one line; 0 selects every line.
+	LineID int64
+	From   time.Time
+	Limit  int
+}
+
+// UpcomingDeparture is one scheduled departure from a stop. Time is "15:04".
+type UpcomingDeparture struct {
+	StopID      int    `json:"stop_id"`
+	LineID      int    `json:"line_id"`
+	LineCode    string `json:"line_code"`
+	DirectionID int    `json:"direction_id"`
+	Direction   string `json:"direction"`
+	Time        string `json:"time"`
+}
+
+func (s *StopStorage) ReadUpcomingDepartures(ctx context.Context, q DepartureQuery) ([]UpcomingDeparture, error) {
+	query := `
+		SELECT l.id, l.line_code, dir.id, dir.name, to_char(t.departure_time, 'HH24:MI')
+		FROM departures AS d
+		JOIN arrivals   AS a   ON a.departures_id = d.id
+		JOIN directions AS dir ON dir.id = d.direction_id
+		JOIN lines      AS l   ON l.id = dir.line_id
+		CROSS JOIN LATERAL unnest(a.departure_time) AS t(departure_time)
+		WHERE d.stop_id = $1
+		  AND d.date = $2::date
+		  AND t.departure_time >= $3::time
+		  AND ($4::int = 0 OR l.id = $4)
+		ORDER BY t.departure_time, l.id, dir.name
+		LIMIT $5
+	`
+
+	ctx, span := startQuerySpan(ctx, "StopStorage.ReadUpcomingDepartures", query)
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query,
+		q.StopID, q.From.Format("2006-01-02"), q.From.Format("15:04:05"), q.LineID, q.Limit)
+	if err != nil {
+		return nil, span.Fail(err)
+	}
+	defer rows.Close()
+
+	departures := []UpcomingDeparture{}
+	for rows.Next() {
+		d := UpcomingDeparture{StopID: int(q.StopID)}
+		if err := rows.Scan(&d.LineID, &d.LineCode, &d.DirectionID, &d.Direction, &d.Time); err != nil {
+			return nil, span.Fail(err)
+		}
+		departures = append(departures, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, span.Fail(err)
+	}
+
+	span.SetAttributes(tracing.Int("db.rows", len(departures)))
+
+	return departures, nil
+}
+
+// ConnectionQuery selects the direct rides from one stop to another on
+// Date's day.
+type ConnectionQuery struct {
+	FromStopID int64
+	ToStopID   int64
+	Date       time.Time
+}
+
+// Connection is a direct ride between two stops. The timetable does not link
+// the times of one bus across stops, so each arrival is paired with the
+// latest departure of the same direction before it. Times are "15:04".
+type Connection struct {
+	LineID      int    `json:"line_id"`
+	LineCode    string `json:"line_code"`
+	DirectionID int    `json:"direction_id"`
+	Direction   string `json:"direction"`
+	Departure   string `json:"departure"`
+	Arrival     string `json:"arrival"`
+}
+
+// ReadConnections returns the direct rides of the day ordered by departure
+// and then arrival.
+func (s *StopStorage) ReadConnections(ctx context.Context, q ConnectionQuery) ([]Connection, error) {
+	query := `
+		WITH times AS (
+			SELECT d.stop_id, d.direction_id, t.at
+			FROM departures AS d
+			JOIN arrivals   AS a ON a.departures_id = d.id
+			CROSS JOIN LATERAL unnest(a.departure_time) AS t(at)
+			WHERE d.stop_id IN ($1, $2)
+			  AND d.date = $3::date
+		), paired AS (
+			SELECT DISTINCT ON (o.direction_id, arrives)
+				o.direction_id,
+				o.at AS departs,
+				(SELECT MIN(x.at) FROM times AS x
+				 WHERE x.stop_id = $2 AND x.direction_id = o.direction_id AND x.at > o.at) AS arrives
+			FROM times AS o
+			WHERE o.stop_id = $1
+			ORDER BY o.direction_id, arrives, o.at DESC
+		)
+		SELECT l.id, l.line_code, dir.id, dir.name, to_char(p.departs, 'HH24:MI'), to_char(p.arrives, 'HH24:MI')
+		FROM paired AS p
+		JOIN directions AS dir ON dir.id = p.direction_id
+		JOIN lines      AS l   ON l.id = dir.line_id
+		WHERE p.arrives IS NOT NULL
+		ORDER BY p.departs, p.arrives, l.id, dir.name
+	`
+
+	ctx, span := startQuerySpan(ctx, "StopStorage.ReadConnections", query)
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query, q.FromStopID, q.ToStopID, q.Date.Format("2006-01-02"))
+	if err != nil {
+		return nil, span.Fail(err)
+	}
+	defer rows.Close()
+
+	connections := []Connection{}
+	for rows.Next() {
+		var c Connection
+		if err := rows.Scan(&c.LineID, &c.LineCode, &c.DirectionID, &c.Direction, &c.Departure, &c.Arrival); err != nil {
+			return nil, span.Fail(err)
+		}
+		connections = append(connections, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, span.Fail(err)
+	}
+
+	span.SetAttributes(tracing.Int("db.rows", len(connections)))
+
+	return connections, nil
+}
+
+// StopTimes are the times the buses of a direction call at a stop on a day,
+// in seconds since midnight and in order.
+type StopTimes struct {
+	StopID      int
+	LineID      int
+	DirectionID int
+	Seconds     []int
+}
+
+// ReadStopTimes returns the whole timetable of the day, by direction and
+// then stop.
+func (s *StopStorage) ReadStopTimes(ctx context.Context, date time.Time) ([]StopTimes, error) {
+	query := `
+		SELECT d.stop_id, dir.line_id, d.direction_id,
+			array_agg(EXTRACT(EPOCH FROM t.at)::int ORDER BY t.at)
+		FROM departures AS d
+		JOIN arrivals   AS a   ON a.departures_id = d.id
+		JOIN directions AS dir ON dir.id = d.direction_id
+		CROSS JOIN LATERAL unnest(a.departure_time) AS t(at)
+		WHERE d.date = $1::date
+		GROUP BY d.stop_id, dir.line_id, d.direction_id
+		ORDER BY d.direction_id, d.stop_id
+	`
+
+	ctx, span := startQuerySpan(ctx, "StopStorage.ReadStopTimes", query)
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query, date.Format("2006-01-02"))
+	if err != nil {
+		return nil, span.Fail(err)
+	}
+	defer rows.Close()
+
+	times := []StopTimes{}
+	for rows.Next() {
+		var (
+			st      StopTimes
+			seconds pq.Int64Array
+		)
+		if err := rows.Scan(&st.StopID, &st.LineID, &st.DirectionID, &seconds); err != nil {
+			return nil, span.Fail(err)
+		}
+		st.Seconds = make([]int, len(seconds))
+		for i, sec := range seconds {
+			st.Seconds[i] = int(sec)
+		}
+		times = append(times, st)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, span.Fail(err)
+	}
+
+	span.SetAttributes(tracing.Int("db.rows", len(times)))
+
+	return times, nil
+}
@@ -3,6 +3,9 @@ package data
 import (
 	"context"
 	"database/sql"
+	"time"
+
+	"go.uber.org/zap"
 )
 
 type Storage struct {
@@ -11,8 +14,17 @@ type Storage struct {
 		GetByEmail(context.Context, string) (*User, error)
 		GetById(context.Context, int) (*User, error)
 		UpdateById(context.Context, int, *UpdateUserPayload) error
+		Lock(context.Context, int) error
 		GetByIDForClient(context.Context, int) (*UserForClient, error)
 	}
+	APIKeys interface {
+		Create(context.Context, *APIKey, string) error
+		GetByHash(context.Context, string) (*APIKey, error)
+		List(context.Context) ([]APIKey, error)
+		Revoke(context.Context, int64) error
+		RecordUsage(context.Context, int64, time.Time) (int64, error)
+		GetUsage(context.Context, int64, int) ([]APIKeyUsage, error)
+	}
 	Stations interface {
 		ReadStation(context.Context, int64) (*Stop, error)
 		ReadList(context.Context) ([]Stop, error)
@@ -21,15 +33,27 @@ type Storage struct {
 		ReadThreeStationsAtDestination(context.Context, *PathLocation) ([]Stop, error)
 		ReadStationLines(context.Context, []Stop) ([]Line, error)
 		ReadThreeStationsAtLocation(context.Context, *PathLocation, []Line) ([]Stop, error)
+		ReadUpcomingDepartures(context.Context, DepartureQuery) ([]UpcomingDeparture, error)
+		ReadConnections(context.Context, ConnectionQuery) ([]Connection, error)
+		ReadStopTimes(context.Context, time.Time) ([]StopTimes, error)
 	}
 	Routes interface {
-		ReadRoute(context.Context, int64) (*Route, error)
+		ReadRoute(context.Context, int64, RouteQuery) (*Route, error)
 		ReadRouteStations(context.Context, int64) ([]Stop, error)
 		ReadRoutesList(context.Context) ([]Route, error)
+		ReadMapRoutes(context.Context) ([]MapRoute, error)
+		ReadDirections(context.Context, int64) ([]Direction, error)
+		ReadDirectionStops(context.Context, DirectionStopsQuery) ([]DirectionStop, error)
 		ReadActiveLines(context.Context) (int, error)
 		FetchActiveRuns(context.Context, int) ([]ActiveRun, error)
 	}
 
+	RouteShapes interface {
+		List(context.Context, int) ([]RouteShape, error)
+		Create(context.Context, *RouteShape) error
+		Delete(context.Context, int64) error
+	}
+
 	Delays interface {
 		GetDelaysByStop(context.Context, int64) ([]Delay, error)
 		GetRecentDelaysByLine(context.Context, int64) ([]DelayEntry, error)
@@ -38,7 +62,11 @@ type Storage struct {
 		GetDelayCountsByLine(context.Context) ([]LineDelayCount, error)
 		GetAverageDelayForLine(context.Context, int64) (*LineAverageDelay, error)
 		GetOverallAverageDelay(context.Context) (float64, error)
-		InsertDelay(context.Context, DelayReportInputUnMarshaled) error
+		InsertDelay(context.Context, DelayReportInputUnMarshaled) (int, error)
+		InsertAudit(context.Context, *DelayAudit) error
+		ListAudit(context.Context, int) ([]DelayAudit, error)
+		GetRecentDelays(context.Context, DelayFilter) ([]DelayReport, error)
+		GetDelayHeat(context.Context, time.Time) ([]StopDelayHeat, error)
 	}
 
 	Occupancy interface {
@@ -47,14 +75,70 @@ type Storage struct {
 		GetAvgOccupancyAllLinesByHour(context.Context, int) (*AvgOccupancyByHour, error)
 		GetAvgDailyOccupancyAllLines(context.Context, string) (*AvgDailyOccupancy, error)
 	}
-}
 
-func NewStorage(db *sql.DB) Storage {
-	return Storage{
-		Stations:  &StopStorage{db},
-		Routes:    &RoutesStorage{db},
-		User:      &UsersStorage{db},
-		Delays:    &DelaysStorage{db},
-		Occupancy: &OccupancyStorage{db},
+	Favourites interface {
+		List(context.Context, int) ([]Favourite, error)
+		Create(context.Context, *Favourite) error
+		Delete(context.Context, int, int64) error
+		Reorder(context.Context, int, []int64) error
+	}
+
+	Trips interface {
+		List(context.Context, int) ([]SavedTrip, error)
+		Get(context.Context, int, int64) (*SavedTrip, error)
+		Create(context.Context, *SavedTrip) error
+		Update(context.Context, *SavedTrip) error
+		Delete(context.Context, int, int64) error
+	}
+
+	Alerts interface {
+		ListSubscriptions(context.Context, int) ([]AlertSubscription, error)
+		CreateSubscription(context.Context, *AlertSubscription) error
+		DeleteSubscription(context.Context, int, int64) error
+		AllSubscriptions(context.Context) ([]AlertSubscription, error)
+		ReadIncidents(context.Context, int, int) ([]AlertIncident, error)
+		Cursor(context.Context) (int, error)
+		SetCursor(context.Context, int) error
+		EnqueueDelivery(context.Context, *AlertDelivery) error
+		ClaimDeliveries(context.Context, time.Time, time.Duration, int) ([]AlertDelivery, error)
+		UpdateDelivery(context.Context, *AlertDelivery) error
+		ListDeliveries(context.Context, int, int64, int) ([]AlertDelivery, error)
 	}
+
+	Push interface {
+		List(context.Context, int) ([]PushSubscription, error)
+		Save(context.Context, *PushSubscription) error
+		Delete(context.Context, int, int64) error
+		DeleteEndpoint(context.Context, string) error
+		DeleteExpired(context.Context, time.Time) (int, error)
+		Targets(context.Context, int, int) ([]PushSubscription, error)
+		AlertTargets(context.Context, int64) ([]PushSubscription, error)
+		Claim(context.Context) (int, error)
+		SetCursor(context.Context, int) error
+		ServiceAlertCursor(context.Context) (int64, error)
+		SetServiceAlertCursor(context.Context, int64) error
+	}
+
+	ServiceAlerts interface {
+		List(context.Context, ServiceAlertFilter) ([]ServiceAlert, error)
+		Get(context.Context, int64) (*ServiceAlert, error)
+		Create(context.Context, *ServiceAlert) error
+		Update(context.Context, *ServiceAlert) error
+		Delete(context.Context, int64) error
+	}
+
+	StationOverrides interface {
+		List(context.Context) ([]StationOverride, error)
+		Set(context.Context, *StationOverride) error
+		Delete(context.Context, int64) error
+	}
+
+	tx TxFunc
+}
+
+// NewStorage wires the Postgres implementations. logger is used when a
+// storage method runs outside of a request; inside one, the request logger
+// from the context takes precedence.
+func NewStorage(db *sql.DB, logger *zap.SugaredLogger) Storage {
+	return newPostgresStorage(db, logger).WithTxFunc(postgresTx(db, logger))
 }
@@ -0,0 +1,67 @@
+package storagetest
+
+import (
+	"backend/internal/data"
+	"backend/internal/data/memory"
+	"time"
+)
+
+// Dataset returns the rows every backend is seeded with before a contract
+// test. Departures without a Date run on the current day; seeders for
+// backends that store a concrete date must use today's date for them.
+//
+// The assertions in this package depend on the exact content, so extend the
+// dataset rather than editing existing rows.
+func Dataset() *memory.Fixtures {
+	alice, bob := 1, 2
+
+	return &memory.Fixtures{
+		Stops: []data.Stop{
+			{ID: 1, Number: "003", Name: "Center", Latitude: 46.557700, Longitude: 15.645500},
+			{ID: 2, Number: "002", Name: "Station", Latitude: 46.562000, Longitude: 15.656700},
+			{ID: 3, Number: "001", Name: "Park", Latitude: 46.562500, Longitude: 15.640000},
+			{ID: 4, Number: "004", Name: "Tezno", Latitude: 46.533000, Longitude: 15.670000},
+			{ID: 5, Number: "005", Name: "Unserved", Latitude: 46.550000, Longitude: 15.600000},
+		},
+		Lines: []memory.LineRow{
+			{ID: 1, LineCode: "1"},
+			{ID: 2, LineCode: "6", Colour: "#00a0e0"},
+			{ID: 3, LineCode: "9"},
+		},
+		Directions: []memory.DirectionRow{
+			{ID: 1, LineID: 1, Name: "North"},
+			{ID: 2, LineID: 1, Name: "South"},
+			{ID: 3, LineID: 2, Name: "East"},
+		},
+		Departures: []memory.DepartureRow{
+			{ID: 1, StopID: 1, DirectionID: 1, LineID: 1, Times: []string{"00:00:00", "12:00:00", "23:59:59"}},
+			{ID: 2, StopID: 2, DirectionID: 1, LineID: 1, Times: []string{"00:00:01", "23:59:58"}},
+			{ID: 3, StopID: 3, DirectionID: 2, LineID: 1, Times: []string{"00:00:00", "08:30:00", "23:59:59"}},
+			{ID: 4, StopID: 2, DirectionID: 3, LineID: 2, Times: []string{"07:30:00", "07:00:00"}},
+			{ID: 5, StopID: 3, DirectionID: 3, LineID: 2, Date: "2000-01-01", Times: []string{"00:00:00", "23:59:59"}},
+		},
+		Routes: []data.Route{
+			{ID: 1, Name: "R1", LineID: 1, Path: [][]float64{{46.5577, 15.6455}, {46.5620, 15.6567}}},
+			{ID: 2, Name: "R6", LineID: 2, Path: [][]float64{{46.5620, 15.6567}, {46.5625, 15.6400}}},
+		},
+		Users: []data.User{
+			{ID: alice, Username: "alice", Email: "alice@example.com", Password: "hash-a", Role: data.RoleUser,
+				CreatedAt: time.Date(2024, 4, 1, 10, 0, 0, 0, time.UTC)},
+			{ID: bob, Username: "bob", Email: "bob@example.com", Password: "hash-b", Role: data.RoleAdmin,
+				CreatedAt: time.Date(2024, 4, 2, 10, 0, 0, 0, time.UTC)},
+		},
+		Delays: []memory.DelayRow{
+			{ID: 1, Date: "2024-05-01", DelayMin: 5, StopID: 1, LineID: 1, UserID: &alice},
+			{ID: 2, Date: "2024-05-03", DelayMin: 10, StopID: 1, LineID: 1, UserID: &bob},
+			{ID: 3, Date: "2024-05-03", DelayMin: 3, StopID: 2, LineID: 1},
+			{ID: 4, Date: "2024-05-02", DelayMin: 7, StopID: 2, LineID: 2, UserID: &alice},
+		},
+		Occupancy: []memory.OccupancyRow{
+			{ID: 1, LineID: 1, Date: "2024-05-01", Time: "08:30:00", OccupancyLevel: 2},
+			{ID: 2, LineID: 1, Date: "2024-05-01", Time: "08:00:00", OccupancyLevel: 4},
+			{ID: 3, LineID: 1, Date: "2024-05-01", Time: "09:15:00", OccupancyLevel: 3},
+			{ID: 4, LineID: 2, Date: "2024-05-01", Time: "08:45:00", OccupancyLevel: 5},
+			{ID: 5, LineID: 1, Date: "2024-05-02", Time: "08:10:00", OccupancyLevel: 1},
+		},
+	}
+}
@@ -0,0 +1,1546 @@
+// Package storagetest is the behavioural contract of data.Storage. Every
+// backend runs the same suite against the same seeded Dataset:
+//
+//	func TestContract(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T, f *memory.Fixtures) data.Storage {
+//			...seed f and return the storage...
+//		})
+//	}
+package storagetest
+
+import (
+	"backend/internal/data"
+	"backend/internal/data/memory"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Factory returns a storage holding exactly the given fixtures. It is called
+// once per interface, so each group of tests starts from a fresh seed.
+type Factory func(t *testing.T, fixtures *memory.Fixtures) data.Storage
+
+// Run executes the whole contract suite.
+func Run(t *testing.T, newStorage Factory) {
+	groups := []struct {
+		name string
+		run  func(*testing.T, data.Storage)
+	}{
+		{"Stations", testStations},
+		{"Routes", testRoutes},
+		{"RouteShapes", testRouteShapes},
+		{"Users", testUsers},
+		{"APIKeys", testAPIKeys},
+		{"Delays", testDelays},
+		{"Occupancy", testOccupancy},
+		{"Favourites", testFavourites},
+		{"Trips", testTrips},
+		{"Alerts", testAlerts},
+		{"Push", testPush},
+		{"ServiceAlerts", testServiceAlerts},
+		{"StationOverrides", testStationOverrides},
+		{"Transactions", testTransactions},
+	}
+
+	for _, g := range groups {
+		t.Run(g.name, func(t *testing.T) {
+			g.run(t, newStorage(t, Dataset()))
+		})
+	}
+}
+
+func stopIDs(stops []data.Stop) []int {
+	ids := make([]int, 0, len(stops))
+	for _, s := range stops {
+		ids = append(ids, s.ID)
+	}
+	return ids
+}
+
+func day(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+func testStations(t *testing.T, store data.Storage) {
+	ctx := context.Background()
+	stations := store.Stations
+
+	t.Run("ReadStation", func(t *testing.T) {
+		stop, err := stations.ReadStation(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, data.Stop{ID: 1, Number: "003", Name: "Center", Latitude: 46.5577, Longitude: 15.6455}, *stop)
+
+		_, err = stations.ReadStation(ctx, 99)
+		assert.ErrorIs(t, err, data.ErrNotFound)
+	})
+
+	t.Run("ReadList is ordered by id", func(t *testing.T) {
+		stops, err := stations.ReadList(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []int{1, 2, 3, 4, 5}, stopIDs(stops))
+	})
+
+	t.Run("ReadStationMetadata groups and sorts departures", func(t *testing.T) {
+		meta, err := stations.ReadStationMetadata(ctx, 2)
+		require.NoError(t, err)
+		assert.Equal(t, "Station", meta.Name)
+		assert.Equal(t, []data.DepartureGroup{
+			{Line: "1", Direction: "North", Times: []string{"00:00", "23:59"}},
+			{Line: "6", Direction: "East", Times: []string{"07:00", "07:30"}},
+		}, meta.Departures)
+
+		unserved, err := stations.ReadStationMetadata(ctx, 5)
+		require.NoError(t, err)
+		assert.Empty(t, unserved.Departures)
+
+		_, err = stations.ReadStationMetadata(ctx, 99)
+		assert.ErrorIs(t, err, data.ErrNotFound)
+	})
+
+	t.Run("ReadUpcomingDepartures lists today's departures from a time", func(t *testing.T) {
+		now := time.Now()
+		at := func(hour, min int) time.Time {
+			return time.Date(now.Year(), now.Month(), now.Day(), hour, min, 0, 0, time.Local)
+		}
+
+		got, err := stations.ReadUpcomingDepartures(ctx, data.DepartureQuery{StopID: 2, From: at(7, 0), Limit: 10})
+		require.NoError(t, err)
+		assert.Equal(t, []data.UpcomingDeparture{
+			{StopID: 2, LineID: 2, LineCode: "6", DirectionID: 3, Direction: "East", Time: "07:00"},
+			{StopID: 2, LineID: 2, LineCode: "6", DirectionID: 3, Direction: "East", Time: "07:30"},
+			{StopID: 2, LineID: 1, LineCode: "1", DirectionID: 1, Direction: "North", Time: "23:59"},
+		}, got)
+
+		got, err = stations.ReadUpcomingDepartures(ctx, data.DepartureQuery{StopID: 2, From: at(7, 0), Limit: 1})
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		assert.Equal(t, "07:00", got[0].Time)
+
+		got, err = stations.ReadUpcomingDepartures(ctx, data.DepartureQuery{StopID: 2, LineID: 1, From: at(7, 0), Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		assert.Equal(t, "23:59", got[0].Time)
+
+		// Departure 5 of stop 3 runs on another day.
+		got, err = stations.ReadUpcomingDepartures(ctx, data.DepartureQuery{StopID: 3, From: at(0, 0), Limit: 10})
+		require.NoError(t, err)
+		assert.Len(t, got, 3)
+		for _, d := range got {
+			assert.Equal(t, "South", d.Direction)
+		}
+
+		got, err = stations.ReadUpcomingDepartures(ctx, data.DepartureQuery{StopID: 5, From: at(0, 0), Limit: 10})
+		require.NoError(t, err)
+		assert.Empty(t, got)
+	})
+
+	t.Run("ReadStopTimes", func(t *testing.T) {
+		got, err := stations.ReadStopTimes(ctx, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, []data.StopTimes{
+			{StopID: 1, LineID: 1, DirectionID: 1, Seconds: []int{0, 43200, 86399}},
+			{StopID: 2, LineID: 1, DirectionID: 1, Seconds: []int{1, 86398}},
+			{StopID: 3, LineID: 1, DirectionID: 2, Seconds: []int{0, 30600, 86399}},
+			{StopID: 2, LineID: 2, DirectionID: 3, Seconds: []int{25200, 27000}},
+		}, got)
+
+		got, err = stations.ReadStopTimes(ctx, time.Date(2000, 1, 1, 0, 0, 0, 0, time.Local))
+		require.NoError(t, err)
+		require.NotEmpty(t, got)
+		assert.Contains(t, got, data.StopTimes{StopID: 3, LineID: 2, DirectionID: 3, Seconds: []int{0, 86399}})
+	})
+
+	t.Run("ReadConnections pairs each arrival with the latest departure", func(t *testing.T) {
+		today := time.Now()
+
+		got, err := stations.ReadConnections(ctx, data.ConnectionQuery{FromStopID: 1, ToStopID: 2, Date: today})
+		require.NoError(t, err)
+		assert.Equal(t, []data.Connection{
+			{LineID: 1, LineCode: "1", DirectionID: 1, Direction: "North", Departure: "00:00", Arrival: "00:00"},
+			{LineID: 1, LineCode: "1", DirectionID: 1, Direction: "North", Departure: "12:00", Arrival: "23:59"},
+		}, got)
+
+		// Stop 3 is only served towards South and by departure 5 on another day.
+		got, err = stations.ReadConnections(ctx, data.ConnectionQuery{FromStopID: 2, ToStopID: 3, Date: today})
+		require.NoError(t, err)
+		assert.Empty(t, got)
+
+		got, err = stations.ReadConnections(ctx, data.ConnectionQuery{FromStopID: 1, ToStopID: 5, Date: today})
+		require.NoError(t, err)
+		assert.Empty(t, got)
+	})
+
+	t.Run("ReadStationsCloseBy filters by radius in meters", func(t *testing.T) {
+		center := func(radius int) *data.Location {
+			return &data.Location{Latitude: 46.5577, Longitude: 15.6455, Radius: radius}
+		}
+
+		stops, err := stations.ReadStationsCloseBy(ctx, center(100))
+		require.NoError(t, err)
+		assert.Equal(t, []int{1}, stopIDs(stops))
+
+		stops, err = stations.ReadStationsCloseBy(ctx, center(750))
+		require.NoError(t, err)
+		assert.Equal(t, []int{1, 3}, stopIDs(stops))
+
+		stops, err = stations.ReadStationsCloseBy(ctx, center(1500))
+		require.NoError(t, err)
+		assert.Equal(t, []int{1, 2, 3}, stopIDs(stops))
+
+		stops, err = stations.ReadStationsCloseBy(ctx, &data.Location{Latitude: 46.0, Longitude: 14.5, Radius: 500})
+		require.NoError(t, err)
+		assert.Empty(t, stops)
+	})
+
+	t.Run("nearest stops are ordered by distance", func(t *testing.T) {
+		payload := &data.PathLocation{
+			DestinationLatitude:  46.5621,
+			DestinationLongitude: 15.6566,
+			LocationLatitude:     46.5330,
+			LocationLongitude:    15.6700,
+		}
+
+		stops, err := stations.ReadThreeStationsAtDestination(ctx, payload)
+		require.NoError(t, err)
+		assert.Equal(t, []int{2, 1, 3}, stopIDs(stops))
+
+		stops, err = stations.ReadThreeStationsAtLocation(ctx, payload, nil)
+		require.NoError(t, err)
+		assert.Len(t, stops, 3)
+
+		payload.AvoidStopIDs = []int{2}
+		stops, err = stations.ReadThreeStationsAtDestination(ctx, payload)
+		require.NoError(t, err)
+		assert.Equal(t, []int{1, 3, 4}, stopIDs(stops), "avoided stops are skipped")
+	})
+
+	t.Run("ReadStationLines", func(t *testing.T) {
+		lines, err := stations.ReadStationLines(ctx, []data.Stop{{ID: 2}, {ID: 5}, {ID: 3}})
+		require.NoError(t, err)
+		assert.Equal(t, []data.Line{
+			{ID: 1, LineCode: "1", Name: "North"},
+			{ID: 2, LineCode: "6", Name: "East"},
+			{ID: 1, LineCode: "1", Name: "South"},
+			{ID: 2, LineCode: "6", Name: "East"},
+		}, lines)
+
+		lines, err = stations.ReadStationLines(ctx, nil)
+		require.NoError(t, err)
+		assert.Empty(t, lines)
+	})
+}
+
+func testRoutes(t *testing.T, store data.Storage) {
+	ctx := context.Background()
+	routes := store.Routes
+
+	t.Run("ReadRoute", func(t *testing.T) {
+		route, err := routes.ReadRoute(ctx, 1, data.RouteQuery{})
+		require.NoError(t, err)
+		assert.Equal(t, 1, route.ID)
+		assert.Equal(t, "R1", route.Name)
+		assert.Equal(t, [][]float64{{46.5577, 15.6455}, {46.5620, 15.6567}}, route.Path)
+		assert.Equal(t, 1, route.DirectionID, "the line's first direction")
+		assert.Zero(t, route.ShapeID)
+
+		_, err = routes.ReadRoute(ctx, 3, data.RouteQuery{})
+		assert.ErrorIs(t, err, data.ErrNotFound)
+	})
+
+	t.Run("ReadRouteStations is ordered by stop number", func(t *testing.T) {
+		stops, err := routes.ReadRouteStations(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []int{3, 2, 1}, stopIDs(stops))
+
+		stops, err = routes.ReadRouteStations(ctx, 3)
+		require.NoError(t, err)
+		assert.Empty(t, stops)
+	})
+
+	t.Run("ReadRoutesList", func(t *testing.T) {
+		list, err := routes.ReadRoutesList(ctx)
+		require.NoError(t, err)
+		require.Len(t, list, 2)
+		assert.Equal(t, 1, list[0].LineID)
+		assert.Equal(t, 2, list[1].LineID)
+	})
+
+	t.Run("ReadMapRoutes colours every line", func(t *testing.T) {
+		list, err := routes.ReadMapRoutes(ctx)
+		require.NoError(t, err)
+		require.Len(t, list, 2)
+		assert.Equal(t, data.MapRoute{ID: 1, LineID: 1, LineCode: "1", Colour: data.LineColour(1, ""), Path: list[0].Path}, list[0])
+		assert.Equal(t, "#00a0e0", list[1].Colour)
+		assert.Len(t, list[1].Path, 2)
+	})
+
+	t.Run("ReadDirections", func(t *testing.T) {
+		directions, err := routes.ReadDirections(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []data.Direction{
+			{ID: 1, LineID: 1, LineCode: "1", Name: "North"},
+			{ID: 2, LineID: 1, LineCode: "1", Name: "South"},
+		}, directions)
+
+		directions, err = routes.ReadDirections(ctx, 3)
+		require.NoError(t, err)
+		assert.Empty(t, directions)
+
+		_, err = routes.ReadDirections(ctx, 99)
+		assert.ErrorIs(t, err, data.ErrNotFound)
+	})
+
+	t.Run("ReadDirectionStops is in calling order", func(t *testing.T) {
+		stops, err := routes.ReadDirectionStops(ctx, data.DirectionStopsQuery{LineID: 1, DirectionID: 1, Date: time.Now()})
+		require.NoError(t, err)
+		require.Len(t, stops, 2)
+		assert.Equal(t, 1, stops[0].Sequence)
+		assert.Equal(t, "Center", stops[0].Stop.Name)
+		assert.Equal(t, 0, stops[0].OffsetSeconds)
+		assert.Equal(t, 2, stops[1].Sequence)
+		assert.Equal(t, 2, stops[1].Stop.ID)
+		assert.Equal(t, 1, stops[1].OffsetSeconds)
+
+		// Park is only served on another day.
+		stops, err = routes.ReadDirectionStops(ctx, data.DirectionStopsQuery{LineID: 2, DirectionID: 3, Date: time.Now()})
+		require.NoError(t, err)
+		require.Len(t, stops, 1)
+		assert.Equal(t, 2, stops[0].Stop.ID)
+		assert.Equal(t, 0, stops[0].OffsetSeconds)
+
+		_, err = routes.ReadDirectionStops(ctx, data.DirectionStopsQuery{LineID: 1, DirectionID: 3, Date: time.Now()})
+		assert.ErrorIs(t, err, data.ErrNotFound, "East is a direction of line 6")
+	})
+
+	t.Run("ReadActiveLines", func(t *testing.T) {
+		// Three departures are active all day, fewer than the 19 stops
+		// the estimate divides by.
+		n, err := routes.ReadActiveLines(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+	})
+
+	t.Run("FetchActiveRuns picks today's latest run per direction", func(t *testing.T) {
+		runs, err := routes.FetchActiveRuns(ctx, 1)
+		require.NoError(t, err)
+		require.Len(t, runs, 2)
+
+		assert.Equal(t, 2, runs[0].DepartureID)
+		assert.Equal(t, 1, runs[0].DirectionID)
+		assert.Equal(t, 3, runs[1].DepartureID)
+		assert.Equal(t, 2, runs[1].DirectionID)
+
+		now := time.Now()
+		require.Len(t, runs[1].ArrTimes, 3)
+		assert.Equal(t, day(now), day(runs[1].ArrTimes[1]))
+		assert.Equal(t, "08:30:00", runs[1].ArrTimes[1].Format("15:04:05"))
+		assert.Equal(t, [][]float64{{46.5577, 15.6455}, {46.5620, 15.6567}}, runs[0].Path)
+		assert.Equal(t, 86398-1, runs[0].EndSec-runs[0].StartSec)
+
+		// Line 6 only has a run on another day and one that never spans now.
+		runs, err = routes.FetchActiveRuns(ctx, 2)
+		require.NoError(t, err)
+		assert.Empty(t, runs)
+	})
+}
+
+func testRouteShapes(t *testing.T, store data.Storage) {
+	ctx := context.Background()
+	shapes := store.RouteShapes
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	inAnHour, tomorrow := now.Add(time.Hour), now.Add(24*time.Hour)
+	anHourAgo := now.Add(-time.Hour)
+	usual := [][]float64{{46.5620, 15.6567}, {46.5577, 15.6455}}
+	original := [][]float64{{46.5577, 15.6455}, {46.5620, 15.6567}}
+
+	base := data.RouteShape{DirectionID: 2, Path: usual}
+	detour := data.RouteShape{DirectionID: 2, Path: [][]float64{{46.5620, 15.6567}, {46.5600, 15.6500}, {46.5577, 15.6455}},
+		ValidFrom: &anHourAgo, ValidUntil: &inAnHour, Note: "Roadworks on Glavni trg"}
+	planned := data.RouteShape{DirectionID: 2, Path: [][]float64{{46.5620, 15.6567}, {46.5625, 15.6400}},
+		ValidFrom: &tomorrow}
+
+	t.Run("Create", func(t *testing.T) {
+		for _, sh := range []*data.RouteShape{&base, &detour, &planned} {
+			require.NoError(t, shapes.Create(ctx, sh))
+			assert.NotZero(t, sh.ID)
+			assert.Equal(t, 1, sh.LineID)
+			assert.Equal(t, "South", sh.Direction)
+			assert.False(t, sh.CreatedAt.IsZero())
+		}
+
+		unknown := data.RouteShape{DirectionID: 99, Path: usual}
+		assert.ErrorIs(t, shapes.Create(ctx, &unknown), data.ErrNotFound)
+	})
+
+	t.Run("List is latest start first", func(t *testing.T) {
+		got, err := shapes.List(ctx, 1)
+		require.NoError(t, err)
+		require.Len(t, got, 3)
+		assert.Equal(t, []int64{planned.ID, detour.ID, base.ID}, []int64{got[0].ID, got[1].ID, got[2].ID})
+		assert.Equal(t, "Roadworks on Glavni trg", got[1].Note)
+		require.NotNil(t, got[1].ValidUntil)
+		assert.True(t, inAnHour.Equal(*got[1].ValidUntil))
+		assert.Nil(t, got[2].ValidFrom)
+
+		got, err = shapes.List(ctx, 2)
+		require.NoError(t, err)
+		assert.Empty(t, got)
+	})
+
+	t.Run("ReadRoute picks the shape valid at the time", func(t *testing.T) {
+		route, err := store.Routes.ReadRoute(ctx, 1, data.RouteQuery{DirectionID: 2})
+		require.NoError(t, err)
+		assert.Equal(t, 2, route.DirectionID)
+		assert.Equal(t, detour.ID, route.ShapeID)
+		assert.Equal(t, detour.Path, route.Path)
+		require.NotNil(t, route.ValidUntil)
+		assert.True(t, inAnHour.Equal(*route.ValidUntil))
+
+		route, err = store.Routes.ReadRoute(ctx, 1, data.RouteQuery{DirectionID: 2, At: now.Add(2 * time.Hour)})
+		require.NoError(t, err)
+		assert.Equal(t, base.ID, route.ShapeID)
+		assert.Equal(t, usual, route.Path)
+
+		route, err = store.Routes.ReadRoute(ctx, 1, data.RouteQuery{DirectionID: 2, At: now.Add(48 * time.Hour)})
+		require.NoError(t, err)
+		assert.Equal(t, planned.ID, route.ShapeID)
+
+		route, err = store.Routes.ReadRoute(ctx, 1, data.RouteQuery{DirectionID: 1})
+		require.NoError(t, err)
+		assert.Zero(t, route.ShapeID, "North has no shapes")
+		assert.Equal(t, original, route.Path)
+
+		_, err = store.Routes.ReadRoute(ctx, 1, data.RouteQuery{DirectionID: 3})
+		assert.ErrorIs(t, err, data.ErrNotFound, "East is a direction of line 6")
+	})
+
+	t.Run("FetchActiveRuns uses the shape of each direction", func(t *testing.T) {
+		runs, err := store.Routes.FetchActiveRuns(ctx, 1)
+		require.NoError(t, err)
+		require.Len(t, runs, 2)
+		assert.Equal(t, original, runs[0].Path)
+		assert.Equal(t, detour.Path, runs[1].Path)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		require.NoError(t, shapes.Delete(ctx, detour.ID))
+		assert.ErrorIs(t, shapes.Delete(ctx, detour.ID), data.ErrNotFound)
+
+		route, err := store.Routes.ReadRoute(ctx, 1, data.RouteQuery{DirectionID: 2})
+		require.NoError(t, err)
+		assert.Equal(t, base.ID, route.ShapeID, "the usual shape applies again")
+	})
+}
+
+func testUsers(t *testing.T, store data.Storage) {
+	ctx := context.Background()
+	users := store.User
+
+	t.Run("lookups", func(t *testing.T) {
+		alice, err := users.GetByEmail(ctx, "alice@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, 1, alice.ID)
+		assert.Equal(t, "hash-a", alice.Password)
+		assert.Equal(t, data.RoleUser, alice.Role)
+		assert.True(t, alice.CreatedAt.Equal(time.Date(2024, 4, 1, 10, 0, 0, 0, time.UTC)))
+		assert.Nil(t, alice.LastLogin)
+
+		bob, err := users.GetById(ctx, 2)
+		require.NoError(t, err)
+		assert.Equal(t, data.RoleAdmin, bob.Role)
+
+		client, err := users.GetByIDForClient(ctx, 2)
+		require.NoError(t, err)
+		assert.Equal(t, "bob@example.com", client.Email)
+
+		_, err = users.GetByEmail(ctx, "nobody@example.com")
+		assert.ErrorIs(t, err, data.ErrNotFound)
+		_, err = users.GetById(ctx, 99)
+		assert.ErrorIs(t, err, data.ErrNotFound)
+		_, err = users.GetByIDForClient(ctx, 99)
+		assert.ErrorIs(t, err, data.ErrNotFound)
+	})
+
+	t.Run("Create", func(t *testing.T) {
+		before := time.Now().Add(-time.Minute)
+		require.NoError(t, users.Create(ctx, &data.User{Username: "carol", Email: "carol@example.com", Password: "hash-c"}))
+
+		carol, err := users.GetByEmail(ctx, "carol@example.com")
+		require.NoError(t, err)
+		assert.Greater(t, carol.ID, 2)
+		assert.Equal(t, data.RoleUser, carol.Role)
+		assert.True(t, carol.CreatedAt.After(before))
+
+		err = users.Create(ctx, &data.User{Username: "carol2", Email: "carol@example.com", Password: "x"})
+		assert.ErrorIs(t, err, data.ErrConflict)
+		err = users.Create(ctx, &data.User{Username: "carol", Email: "carol2@example.com", Password: "x"})
+		assert.ErrorIs(t, err, data.ErrConflict)
+	})
+
+	t.Run("UpdateById", func(t *testing.T) {
+		require.NoError(t, users.UpdateById(ctx, 1, &data.UpdateUserPayload{Username: "alicia", Email: "alicia@example.com"}))
+
+		alice, err := users.GetById(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, "alicia", alice.Username)
+		assert.Equal(t, "alicia@example.com", alice.Email)
+		assert.Equal(t, "hash-a", alice.Password)
+
+		err = users.UpdateById(ctx, 1, &data.UpdateUserPayload{Username: "alicia", Email: "bob@example.com"})
+		assert.ErrorIs(t, err, data.ErrConflict)
+	})
+
+	t.Run("Lock", func(t *testing.T) {
+		assert.NoError(t, users.Lock(ctx, 2))
+		assert.ErrorIs(t, users.Lock(ctx, 99), data.ErrNotFound)
+	})
+}
+
+func testAPIKeys(t *testing.T, store data.Storage) {
+	ctx := context.Background()
+	keys := store.APIKeys
+
+	// Hashes are hex SHA-256 digests in production; keep the length.
+	hash1, hash2 := strings.Repeat("1", 64), strings.Repeat("2", 64)
+
+	createdBy := 2
+	expires := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	key := &data.APIKey{
+		Name:       "dashboard",
+		Prefix:     "mbk_abcd",
+		Scopes:     []string{data.ScopeReadRealtime, data.ScopeReadTimetable},
+		DailyQuota: 100,
+		ExpiresAt:  &expires,
+		CreatedBy:  &createdBy,
+	}
+	require.NoError(t, keys.Create(ctx, key, hash1))
+	assert.NotZero(t, key.ID)
+	assert.False(t, key.CreatedAt.IsZero())
+
+	second := &data.APIKey{Name: "cli", Prefix: "mbk_efgh", Scopes: []string{data.ScopeWriteDelays}}
+	require.NoError(t, keys.Create(ctx, second, hash2))
+	assert.ErrorIs(t, keys.Create(ctx, &data.APIKey{Name: "dup", Prefix: "mbk_dup", Scopes: []string{}}, hash2), data.ErrConflict)
+
+	t.Run("GetByHash", func(t *testing.T) {
+		got, err := keys.GetByHash(ctx, hash1)
+		require.NoError(t, err)
+		assert.Equal(t, key.ID, got.ID)
+		assert.Equal(t, key.Scopes, got.Scopes)
+		assert.Equal(t, 100, got.DailyQuota)
+		require.NotNil(t, got.ExpiresAt)
+		assert.True(t, got.ExpiresAt.Equal(expires))
+		assert.Equal(t, &createdBy, got.CreatedBy)
+		assert.Nil(t, got.RevokedAt)
+
+		_, err = keys.GetByHash(ctx, strings.Repeat("0", 64))
+		assert.ErrorIs(t, err, data.ErrNotFound)
+	})
+
+	t.Run("List is ordered by id", func(t *testing.T) {
+		list, err := keys.List(ctx)
+		require.NoError(t, err)
+		require.Len(t, list, 2)
+		assert.Equal(t, key.ID, list[0].ID)
+		assert.Equal(t, second.ID, list[1].ID)
+	})
+
+	t.Run("usage is counted per UTC day", func(t *testing.T) {
+		now := time.Now()
+
+		n, err := keys.RecordUsage(ctx, key.ID, now.Add(-24*time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+
+		for want := int64(1); want <= 2; want++ {
+			n, err := keys.RecordUsage(ctx, key.ID, now)
+			require.NoError(t, err)
+			assert.Equal(t, want, n)
+		}
+
+		usage, err := keys.GetUsage(ctx, key.ID, 30)
+		require.NoError(t, err)
+		assert.Equal(t, []data.APIKeyUsage{
+			{Day: day(now.UTC()), Requests: 2},
+			{Day: day(now.Add(-24 * time.Hour).UTC()), Requests: 1},
+		}, usage)
+
+		usage, err = keys.GetUsage(ctx, key.ID, 1)
+		require.NoError(t, err)
+		assert.Len(t, usage, 1)
+
+		usage, err = keys.GetUsage(ctx, second.ID, 30)
+		require.NoError(t, err)
+		assert.Empty(t, usage)
+
+		_, err = keys.GetUsage(ctx, 999, 30)
+		assert.ErrorIs(t, err, data.ErrNotFound)
+
+		got, err := keys.GetByHash(ctx, hash1)
+		require.NoError(t, err)
+		require.NotNil(t, got.LastUsedAt)
+		assert.WithinDuration(t, now, *got.LastUsedAt, time.Second)
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		require.NoError(t, keys.Revoke(ctx, second.ID))
+		assert.ErrorIs(t, keys.Revoke(ctx, second.ID), data.ErrNotFound)
+		assert.ErrorIs(t, keys.Revoke(ctx, 9999), data.ErrNotFound)
+
+		got, err := keys.GetByHash(ctx, hash2)
+		require.NoError(t, err)
+		assert.NotNil(t, got.RevokedAt)
+		assert.False(t, got.Active(time.Now()))
+	})
+}
+
+func testDelays(t *testing.T, store data.Storage) {
+	ctx := context.Background()
+	delays := store.Delays
+
+	t.Run("GetDelaysByStop is newest first", func(t *testing.T) {
+		got, err := delays.GetDelaysByStop(ctx, 1)
+		require.NoError(t, err)
+		require.Len(t, got, 2)
+		assert.Equal(t, 2, got[0].ID)
+		assert.Equal(t, "2024-05-03", day(got[0].Date))
+		assert.Equal(t, "bob", got[0].Username.String)
+		assert.Equal(t, "1", got[0].LineCode)
+		assert.Equal(t, 1, got[1].ID)
+
+		got, err = delays.GetDelaysByStop(ctx, 5)
+		require.NoError(t, err)
+		assert.Empty(t, got)
+	})
+
+	t.Run("GetRecentDelaysByLine breaks date ties by id", func(t *testing.T) {
+		got, err := delays.GetRecentDelaysByLine(ctx, 1)
+		require.NoError(t, err)
+		require.Len(t, got, 3)
+		assert.Equal(t, []int{3, 2, 1}, []int{got[0].ID, got[1].ID, got[2].ID})
+		assert.Equal(t, "Station", got[0].StopName)
+		assert.False(t, got[0].UserID.Valid)
+		assert.False(t, got[0].Username.Valid)
+	})
+
+	t.Run("GetDelaysByUser", func(t *testing.T) {
+		got, err := delays.GetDelaysByUser(ctx, 1)
+		require.NoError(t, err)
+		require.Len(t, got, 2)
+		assert.Equal(t, 4, got[0].ID)
+		assert.Equal(t, "6", got[0].LineCode)
+		assert.Equal(t, 1, got[1].ID)
+
+		got, err = delays.GetDelaysByUser(ctx, 99)
+		require.NoError(t, err)
+		assert.Empty(t, got)
+	})
+
+	t.Run("aggregates", func(t *testing.T) {
+		counts, err := delays.GetDelayCountsByLine(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []data.LineDelayCount{
+			{LineID: 1, LineCode: "1", DelayCount: 3},
+			{LineID: 2, LineCode: "6", DelayCount: 1},
+			{LineID: 3, LineCode: "9", DelayCount: 0},
+		}, counts)
+
+		avg, err := delays.GetAverageDelayForLine(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, &data.LineAverageDelay{LineID: 1, LineCode: "1", AvgDelayMins: 6}, avg)
+
+		avg, err = delays.GetAverageDelayForLine(ctx, 3)
+		require.NoError(t, err)
+		assert.Nil(t, avg)
+
+		overall, err := delays.GetOverallAverageDelay(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 6.25, overall)
+	})
+
+	t.Run("GetDelayHeat", func(t *testing.T) {
+		heat, err := delays.GetDelayHeat(ctx, time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC))
+		require.NoError(t, err)
+		assert.Equal(t, []data.StopDelayHeat{
+			{StopID: 1, Latitude: 46.5577, Longitude: 15.6455, Reports: 1, AvgDelayMins: 10},
+			{StopID: 2, Latitude: 46.562, Longitude: 15.6567, Reports: 2, AvgDelayMins: 5},
+		}, heat)
+
+		heat, err = delays.GetDelayHeat(ctx, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+		require.NoError(t, err)
+		assert.Empty(t, heat)
+	})
+
+	t.Run("GetRecentDelays filters by day, stop and line", func(t *testing.T) {
+		since := time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)
+
+		got, err := delays.GetRecentDelays(ctx, data.DelayFilter{Since: since, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, got, 3)
+		assert.Equal(t, []int{3, 2, 4}, []int{got[0].ID, got[1].ID, got[2].ID})
+		assert.Equal(t, data.DelayReport{
+			ID: 3, Date: got[0].Date, DelayMin: 3, StopID: 2, StopName: "Station", LineID: 1, LineCode: "1",
+		}, got[0])
+		assert.Equal(t, "2024-05-03", day(got[0].Date))
+
+		got, err = delays.GetRecentDelays(ctx, data.DelayFilter{StopID: 1, Since: since, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		assert.Equal(t, 2, got[0].ID)
+
+		got, err = delays.GetRecentDelays(ctx, data.DelayFilter{LineID: 2, Since: since, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		assert.Equal(t, 4, got[0].ID)
+
+		got, err = delays.GetRecentDelays(ctx, data.DelayFilter{Since: since, Limit: 1})
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		assert.Equal(t, 3, got[0].ID)
+
+		got, err = delays.GetRecentDelays(ctx, data.DelayFilter{Since: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), Limit: 10})
+		require.NoError(t, err)
+		assert.Empty(t, got)
+	})
+
+	t.Run("InsertDelay stores the calendar day", func(t *testing.T) {
+		id, err := delays.InsertDelay(ctx, data.DelayReportInputUnMarshaled{
+			Date:     time.Date(2024, 5, 4, 12, 45, 0, 0, time.UTC),
+			DelayMin: 8,
+			StopID:   3,
+			LineID:   2,
+			UserId:   1,
+		})
+		require.NoError(t, err)
+
+		recent, err := delays.GetMostRecentDelays(ctx)
+		require.NoError(t, err)
+		require.Len(t, recent, 5)
+		assert.Equal(t, id, recent[0].ID)
+		assert.Equal(t, "2024-05-04", day(recent[0].Date))
+		assert.Equal(t, 8, recent[0].DelayMin)
+		assert.Equal(t, "Park", recent[0].StopName)
+		assert.Equal(t, "alice", recent[0].Username.String)
+		assert.Equal(t, []int{3, 2, 4, 1}, []int{recent[1].ID, recent[2].ID, recent[3].ID, recent[4].ID})
+
+		_, err = delays.InsertDelay(ctx, data.DelayReportInputUnMarshaled{
+			Date: time.Now(), DelayMin: 1, StopID: 99, LineID: 1, UserId: 1,
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("InsertAudit and ListAudit", func(t *testing.T) {
+		key := &data.APIKey{Name: "reporter", Prefix: "mbk_rprt", Scopes: []string{data.ScopeWriteDelays}}
+		require.NoError(t, store.APIKeys.Create(ctx, key, strings.Repeat("3", 64)))
+
+		userID := 1
+		submitted := data.DelayAudit{DelayID: 2, Action: data.DelayAuditSubmitted, UserID: &userID, APIKeyID: &key.ID}
+		require.NoError(t, delays.InsertAudit(ctx, &submitted))
+		assert.NotZero(t, submitted.ID)
+		assert.False(t, submitted.CreatedAt.IsZero())
+
+		anonymous := data.DelayAudit{DelayID: 2, Action: data.DelayAuditSubmitted}
+		require.NoError(t, delays.InsertAudit(ctx, &anonymous))
+
+		audit, err := delays.ListAudit(ctx, 2)
+		require.NoError(t, err)
+		require.Len(t, audit, 2)
+		assert.Equal(t, submitted.ID, audit[0].ID)
+		assert.Equal(t, &userID, audit[0].UserID)
+		assert.Equal(t, &key.ID, audit[0].APIKeyID)
+		assert.Nil(t, audit[1].UserID)
+		assert.Nil(t, audit[1].APIKeyID)
+
+		audit, err = delays.ListAudit(ctx, 3)
+		require.NoError(t, err)
+		assert.Empty(t, audit)
+
+		assert.Error(t, delays.InsertAudit(ctx, &data.DelayAudit{DelayID: 999, Action: data.DelayAuditSubmitted}))
+	})
+}
+
+func testFavourites(t *testing.T, store data.Storage) {
+	ctx := context.Background()
+	favourites := store.Favourites
+	ref := func(id int) *int { return &id }
+	ids := func(fs []data.Favourite) []int64 {
+		out := make([]int64, 0, len(fs))
+		for _, f := range fs {
+			out = append(out, f.ID)
+		}
+		return out
+	}
+
+	stop := data.Favourite{UserID: 1, StopID: ref(1)}
+	line := data.Favourite{UserID: 1, LineID: ref(2)}
+	pair := data.Favourite{UserID: 1, StopID: ref(2), LineID: ref(1)}
+
+	t.Run("Create appends to the board", func(t *testing.T) {
+		require.NoError(t, favourites.Create(ctx, &stop))
+		assert.NotZero(t, stop.ID)
+		assert.Equal(t, data.FavouriteStop, stop.Kind)
+		assert.Equal(t, "Center", stop.StopName)
+		assert.Equal(t, 0, stop.Position)
+		assert.False(t, stop.CreatedAt.IsZero())
+
+		require.NoError(t, favourites.Create(ctx, &line))
+		assert.Equal(t, data.FavouriteLine, line.Kind)
+		assert.Equal(t, "6", line.LineCode)
+		assert.Equal(t, 1, line.Position)
+
+		require.NoError(t, favourites.Create(ctx, &pair))
+		assert.Equal(t, data.FavouriteStopLine, pair.Kind)
+		assert.Equal(t, "Station", pair.StopName)
+		assert.Equal(t, "1", pair.LineCode)
+		assert.Equal(t, 2, pair.Position)
+
+		other := data.Favourite{UserID: 2, StopID: ref(1)}
+		require.NoError(t, favourites.Create(ctx, &other))
+		assert.Equal(t, 0, other.Position, "positions are per user")
+	})
+
+	t.Run("Create rejects duplicates and unknown targets", func(t *testing.T) {
+		assert.ErrorIs(t, favourites.Create(ctx, &data.Favourite{UserID: 1, StopID: ref(1)}), data.ErrConflict)
+		assert.ErrorIs(t, favourites.Create(ctx, &data.Favourite{UserID: 1, LineID: ref(2)}), data.ErrConflict)
+		assert.ErrorIs(t, favourites.Create(ctx, &data.Favourite{UserID: 1, StopID: ref(99)}), data.ErrNotFound)
+		assert.ErrorIs(t, favourites.Create(ctx, &data.Favourite{UserID: 1, StopID: ref(1), LineID: ref(99)}), data.ErrNotFound)
+	})
+
+	t.Run("List is in board order", func(t *testing.T) {
+		got, err := favourites.List(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []int64{stop.ID, line.ID, pair.ID}, ids(got))
+		assert.Equal(t, "6", got[1].LineCode)
+
+		got, err = favourites.List(ctx, 99)
+		require.NoError(t, err)
+		assert.Empty(t, got)
+	})
+
+	t.Run("Reorder", func(t *testing.T) {
+		require.NoError(t, favourites.Reorder(ctx, 1, []int64{pair.ID, stop.ID, line.ID}))
+
+		got, err := favourites.List(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []int64{pair.ID, stop.ID, line.ID}, ids(got))
+		assert.Equal(t, []int{0, 1, 2}, []int{got[0].Position, got[1].Position, got[2].Position})
+
+		bobs, err := favourites.List(ctx, 2)
+		require.NoError(t, err)
+		assert.ErrorIs(t, favourites.Reorder(ctx, 1, []int64{bobs[0].ID}), data.ErrNotFound)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		assert.ErrorIs(t, favourites.Delete(ctx, 2, stop.ID), data.ErrNotFound, "only the owner may delete")
+		require.NoError(t, favourites.Delete(ctx, 1, stop.ID))
+		assert.ErrorIs(t, favourites.Delete(ctx, 1, stop.ID), data.ErrNotFound)
+
+		got, err := favourites.List(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []int64{pair.ID, line.ID}, ids(got))
+	})
+}
+
+func testTrips(t *testing.T, store data.Storage) {
+	ctx := context.Background()
+	trips := store.Trips
+
+	commute := data.SavedTrip{UserID: 1, Name: "Work", OriginStopID: 1, DestinationStopID: 2,
+		Mode: data.TripArriveBy, Time: "08:00", Weekdays: []string{"mon", "fri"}}
+	home := data.SavedTrip{UserID: 1, Name: "Home", OriginStopID: 2, DestinationStopID: 1,
+		Mode: data.TripDepartAt, Time: "16:30", Weekdays: []string{"mon"}}
+
+	t.Run("Create", func(t *testing.T) {
+		require.NoError(t, trips.Create(ctx, &home))
+		require.NoError(t, trips.Create(ctx, &commute))
+		assert.NotZero(t, commute.ID)
+		assert.Equal(t, "Center", commute.OriginName)
+		assert.Equal(t, "Station", commute.DestinationName)
+		assert.Equal(t, []string{"mon", "fri"}, commute.Weekdays)
+		assert.False(t, commute.CreatedAt.IsZero())
+
+		other := commute
+		other.UserID = 2
+		require.NoError(t, trips.Create(ctx, &other), "names are per user")
+	})
+
+	t.Run("Create rejects duplicate names and unknown stops", func(t *testing.T) {
+		dup := commute
+		assert.ErrorIs(t, trips.Create(ctx, &dup), data.ErrConflict)
+
+		unknown := commute
+		unknown.Name = "Elsewhere"
+		unknown.DestinationStopID = 99
+		assert.ErrorIs(t, trips.Create(ctx, &unknown), data.ErrNotFound)
+	})
+
+	t.Run("List is ordered by time", func(t *testing.T) {
+		got, err := trips.List(ctx, 1)
+		require.NoError(t, err)
+		require.Len(t, got, 2)
+		assert.Equal(t, "Work", got[0].Name)
+		assert.Equal(t, "Home", got[1].Name)
+		assert.Equal(t, "08:00", got[0].Time)
+	})
+
+	t.Run("Get is scoped to the owner", func(t *testing.T) {
+		got, err := trips.Get(ctx, 1, home.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Station", got.OriginName)
+		assert.Equal(t, data.TripDepartAt, got.Mode)
+
+		_, err = trips.Get(ctx, 2, home.ID)
+		assert.ErrorIs(t, err, data.ErrNotFound)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		changed := home
+		changed.Time = "17:15"
+		changed.Weekdays = []string{"tue", "wed"}
+		changed.DestinationStopID = 3
+		require.NoError(t, trips.Update(ctx, &changed))
+		assert.Equal(t, "Park", changed.DestinationName)
+		assert.Equal(t, home.CreatedAt.Unix(), changed.CreatedAt.Unix())
+
+		got, err := trips.Get(ctx, 1, home.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "17:15", got.Time)
+		assert.Equal(t, []string{"tue", "wed"}, got.Weekdays)
+
+		renamed := changed
+		renamed.Name = "Work"
+		assert.ErrorIs(t, trips.Update(ctx, &renamed), data.ErrConflict)
+
+		foreign := changed
+		foreign.UserID = 2
+		assert.ErrorIs(t, trips.Update(ctx, &foreign), data.ErrNotFound)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		assert.ErrorIs(t, trips.Delete(ctx, 2, home.ID), data.ErrNotFound, "only the owner may delete")
+		require.NoError(t, trips.Delete(ctx, 1, home.ID))
+		assert.ErrorIs(t, trips.Delete(ctx, 1, home.ID), data.ErrNotFound)
+	})
+}
+
+func testAlerts(t *testing.T, store data.Storage) {
+	ctx := context.Background()
+	alerts := store.Alerts
+
+	line6, east := 2, 3
+	sub := data.AlertSubscription{UserID: 1, Name: "Commute", LineID: &line6, DirectionID: &east, MinDelayMin: 5,
+		WindowStart: "07:00", WindowEnd: "08:00", Weekdays: []string{"mon"}, Channel: data.AlertWebhook,
+		Target: "https://example.com/hook", Secret: "whsec_test"}
+
+	t.Run("CreateSubscription", func(t *testing.T) {
+		require.NoError(t, alerts.CreateSubscription(ctx, &sub))
+		assert.NotZero(t, sub.ID)
+		assert.Equal(t, "6", sub.LineCode)
+		assert.Equal(t, "East", sub.Direction)
+		assert.Nil(t, sub.StopID)
+		assert.Equal(t, "07:00", sub.WindowStart)
+		assert.False(t, sub.CreatedAt.IsZero())
+
+		stop := 99
+		unknown := sub
+		unknown.StopID = &stop
+		assert.ErrorIs(t, alerts.CreateSubscription(ctx, &unknown), data.ErrNotFound)
+	})
+
+	t.Run("ListSubscriptions is scoped to the owner", func(t *testing.T) {
+		got, err := alerts.ListSubscriptions(ctx, 1)
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		assert.Equal(t, "whsec_test", got[0].Secret)
+		assert.Equal(t, []string{"mon"}, got[0].Weekdays)
+
+		got, err = alerts.ListSubscriptions(ctx, 2)
+		require.NoError(t, err)
+		assert.Empty(t, got)
+
+		all, err := alerts.AllSubscriptions(ctx)
+		require.NoError(t, err)
+		assert.Len(t, all, 1)
+	})
+
+	t.Run("Cursor starts at the newest report", func(t *testing.T) {
+		cursor, err := alerts.Cursor(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 4, cursor)
+
+		require.NoError(t, alerts.SetCursor(ctx, 2))
+		cursor, err = alerts.Cursor(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, cursor)
+	})
+
+	t.Run("ReadIncidents", func(t *testing.T) {
+		got, err := alerts.ReadIncidents(ctx, 2, 10)
+		require.NoError(t, err)
+		require.Len(t, got, 2)
+		assert.Equal(t, 3, got[0].DelayID)
+		assert.Equal(t, []int64{1}, got[0].DirectionIDs)
+		assert.Equal(t, "Station", got[1].StopName)
+		assert.Equal(t, "6", got[1].LineCode)
+		assert.Equal(t, 7, got[1].DelayMin)
+		assert.Equal(t, []int64{3}, got[1].DirectionIDs)
+
+		got, err = alerts.ReadIncidents(ctx, 0, 1)
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		assert.Equal(t, 1, got[0].DelayID)
+
+		before := time.Now().Add(-time.Minute)
+		_, err = store.Delays.InsertDelay(ctx, data.DelayReportInputUnMarshaled{
+			Date: time.Now(), DelayMin: 9, StopID: 2, LineID: 2, UserId: 1,
+		})
+		require.NoError(t, err)
+		got, err = alerts.ReadIncidents(ctx, 4, 10)
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		assert.True(t, got[0].ReportedAt.After(before), "new reports carry the time they were filed")
+	})
+
+	var delivery data.AlertDelivery
+
+	t.Run("EnqueueDelivery and ClaimDeliveries", func(t *testing.T) {
+		now := time.Now()
+		for range 2 {
+			require.NoError(t, alerts.EnqueueDelivery(ctx, &data.AlertDelivery{
+				SubscriptionID: sub.ID, DelayID: 4, Payload: []byte(`{"delay_id":4}`), NextAttemptAt: now,
+			}))
+		}
+
+		claimed, err := alerts.ClaimDeliveries(ctx, now, time.Minute, 10)
+		require.NoError(t, err)
+		require.Len(t, claimed, 1, "a subscription hears about a report once")
+		delivery = claimed[0]
+		assert.Equal(t, data.DeliveryPending, delivery.Status)
+		assert.Equal(t, data.AlertWebhook, delivery.Channel)
+		assert.Equal(t, "https://example.com/hook", delivery.Target)
+		assert.Equal(t, "whsec_test", delivery.Secret)
+		assert.JSONEq(t, `{"delay_id":4}`, string(delivery.Payload))
+
+		claimed, err = alerts.ClaimDeliveries(ctx, now, time.Minute, 10)
+		require.NoError(t, err)
+		assert.Empty(t, claimed, "claimed deliveries are leased")
+
+		claimed, err = alerts.ClaimDeliveries(ctx, now.Add(2*time.Minute), time.Minute, 10)
+		require.NoError(t, err)
+		assert.Len(t, claimed, 1, "an expired lease is claimed again")
+	})
+
+	t.Run("UpdateDelivery and ListDeliveries", func(t *testing.T) {
+		delivered := time.Now()
+		delivery.Status = data.DeliveryDelivered
+		delivery.Attempts = 2
+		delivery.LastError = ""
+		delivery.DeliveredAt = &delivered
+		require.NoError(t, alerts.UpdateDelivery(ctx, &delivery))
+
+		got, err := alerts.ListDeliveries(ctx, 1, sub.ID, 10)
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		assert.Equal(t, data.DeliveryDelivered, got[0].Status)
+		assert.Equal(t, 2, got[0].Attempts)
+		require.NotNil(t, got[0].DeliveredAt)
+
+		claimed, err := alerts.ClaimDeliveries(ctx, time.Now().Add(time.Hour), time.Minute, 10)
+		require.NoError(t, err)
+		assert.Empty(t, claimed, "delivered alerts are not claimed")
+
+		_, err = alerts.ListDeliveries(ctx, 2, sub.ID, 10)
+		assert.ErrorIs(t, err, data.ErrNotFound)
+
+		missing := data.AlertDelivery{ID: 999, Status: data.DeliveryFailed}
+		assert.ErrorIs(t, alerts.UpdateDelivery(ctx, &missing), data.ErrNotFound)
+	})
+
+	t.Run("DeleteSubscription", func(t *testing.T) {
+		assert.ErrorIs(t, alerts.DeleteSubscription(ctx, 2, sub.ID), data.ErrNotFound, "only the owner may delete")
+		require.NoError(t, alerts.DeleteSubscription(ctx, 1, sub.ID))
+
+		_, err := alerts.ListDeliveries(ctx, 1, sub.ID, 10)
+		assert.ErrorIs(t, err, data.ErrNotFound)
+	})
+}
+
+func testPush(t *testing.T, store data.Storage) {
+	ctx := context.Background()
+	push := store.Push
+
+	expired := time.Now().Add(-time.Hour).UTC().Truncate(time.Millisecond)
+	alice := data.PushSubscription{UserID: 1, Endpoint: "https://push.example.com/alice", P256dh: "key", Auth: "auth",
+		UserAgent: "Firefox"}
+	old := data.PushSubscription{UserID: 1, Endpoint: "https://push.example.com/old", P256dh: "key", Auth: "auth",
+		ExpiresAt: &expired}
+
+	t.Run("Save", func(t *testing.T) {
+		require.NoError(t, push.Save(ctx, &alice))
+		assert.NotZero(t, alice.ID)
+		assert.False(t, alice.CreatedAt.IsZero())
+		require.NoError(t, push.Save(ctx, &old))
+
+		unknown := data.PushSubscription{UserID: 99, Endpoint: "https://push.example.com/nobody", P256dh: "key", Auth: "auth"}
+		assert.ErrorIs(t, push.Save(ctx, &unknown), data.ErrNotFound)
+	})
+
+	t.Run("Save replaces a known endpoint", func(t *testing.T) {
+		again := data.PushSubscription{UserID: 2, Endpoint: alice.Endpoint, P256dh: "new-key", Auth: "new-auth"}
+		require.NoError(t, push.Save(ctx, &again))
+		assert.Equal(t, alice.ID, again.ID)
+
+		got, err := push.List(ctx, 2)
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		assert.Equal(t, "new-key", got[0].P256dh)
+
+		require.NoError(t, push.Save(ctx, &alice))
+	})
+
+	t.Run("List is scoped to the owner", func(t *testing.T) {
+		got, err := push.List(ctx, 1)
+		require.NoError(t, err)
+		require.Len(t, got, 2)
+		assert.Equal(t, alice.Endpoint, got[0].Endpoint)
+		assert.Equal(t, "Firefox", got[0].UserAgent)
+		require.NotNil(t, got[1].ExpiresAt)
+		assert.True(t, expired.Equal(*got[1].ExpiresAt))
+
+		got, err = push.List(ctx, 2)
+		require.NoError(t, err)
+		assert.Empty(t, got)
+	})
+
+	t.Run("Targets follow favourite lines", func(t *testing.T) {
+		line6, center, station := 2, 1, 2
+		require.NoError(t, store.Favourites.Create(ctx, &data.Favourite{UserID: 1, LineID: &line6, StopID: &center}))
+
+		got, err := push.Targets(ctx, line6, center)
+		require.NoError(t, err)
+		assert.Len(t, got, 2)
+
+		got, err = push.Targets(ctx, line6, station)
+		require.NoError(t, err)
+		assert.Empty(t, got, "the favourite is the line at another stop")
+	})
+
+	t.Run("Cursor starts at the newest report", func(t *testing.T) {
+		cursor, err := push.Claim(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 4, cursor)
+
+		require.NoError(t, push.SetCursor(ctx, 2))
+		cursor, err = push.Claim(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, cursor)
+	})
+
+	t.Run("DeleteExpired", func(t *testing.T) {
+		n, err := push.DeleteExpired(ctx, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		got, err := push.List(ctx, 1)
+		require.NoError(t, err)
+		assert.Len(t, got, 1)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		assert.ErrorIs(t, push.Delete(ctx, 2, alice.ID), data.ErrNotFound, "only the owner may delete")
+		require.NoError(t, push.Delete(ctx, 1, alice.ID))
+		assert.ErrorIs(t, push.Delete(ctx, 1, alice.ID), data.ErrNotFound)
+
+		require.NoError(t, push.DeleteEndpoint(ctx, "https://push.example.com/unknown"))
+	})
+}
+
+func testServiceAlerts(t *testing.T, store data.Storage) {
+	ctx := context.Background()
+	alerts := store.ServiceAlerts
+
+	line9, north, center, station, park := 3, 1, 1, 2, 3
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	ended := now.Add(-time.Hour)
+
+	closure := data.ServiceAlert{
+		Cause: data.CauseConstruction, Effect: data.EffectNoService,
+		Header:     data.Translations{"sl": "Postajališče zaprto", "en": "Stop closed"},
+		ActiveFrom: now.Add(-24 * time.Hour),
+		Entities:   []data.ServiceAlertEntity{{StopID: &park}},
+	}
+	detour := data.ServiceAlert{
+		Cause: data.CauseConstruction, Effect: data.EffectDetour,
+		Header:     data.Translations{"sl": "Obvoz"},
+		ActiveFrom: now.Add(-time.Hour),
+		Entities:   []data.ServiceAlertEntity{{DirectionID: &north}},
+		Detour:     [][]float64{{46.5577, 15.6455}, {46.5620, 15.6567}},
+	}
+	expired := data.ServiceAlert{
+		Cause: data.CauseStrike, Effect: data.EffectReducedService,
+		Header:      data.Translations{"sl": "Stavka"},
+		ActiveFrom:  now.Add(-48 * time.Hour),
+		ActiveUntil: &ended,
+		Entities:    []data.ServiceAlertEntity{{LineID: &line9}},
+	}
+
+	ids := func(list []data.ServiceAlert) []int64 {
+		out := make([]int64, 0, len(list))
+		for _, a := range list {
+			out = append(out, a.ID)
+		}
+		return out
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		for _, a := range []*data.ServiceAlert{&closure, &detour, &expired} {
+			require.NoError(t, alerts.Create(ctx, a))
+			assert.NotZero(t, a.ID)
+			assert.False(t, a.CreatedAt.IsZero())
+		}
+		assert.Equal(t, "Park", closure.Entities[0].StopName)
+		assert.Equal(t, "North", detour.Entities[0].Direction)
+		assert.Equal(t, "9", expired.Entities[0].LineCode)
+
+		unknown := 99
+		bad := closure
+		bad.Entities = []data.ServiceAlertEntity{{StopID: &unknown}}
+		assert.ErrorIs(t, alerts.Create(ctx, &bad), data.ErrNotFound)
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		got, err := alerts.Get(ctx, detour.ID)
+		require.NoError(t, err)
+		assert.Equal(t, data.EffectDetour, got.Effect)
+		assert.Equal(t, "Obvoz", got.Header["sl"])
+		assert.Equal(t, detour.Detour, got.Detour)
+		assert.True(t, detour.ActiveFrom.Equal(got.ActiveFrom))
+		assert.Nil(t, got.ActiveUntil)
+
+		_, err = alerts.Get(ctx, 999)
+		assert.ErrorIs(t, err, data.ErrNotFound)
+	})
+
+	t.Run("List is latest first", func(t *testing.T) {
+		got, err := alerts.List(ctx, data.ServiceAlertFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, []int64{detour.ID, closure.ID, expired.ID}, ids(got))
+
+		got, err = alerts.List(ctx, data.ServiceAlertFilter{ActiveAt: now})
+		require.NoError(t, err)
+		assert.Equal(t, []int64{detour.ID, closure.ID}, ids(got))
+	})
+
+	t.Run("List by line", func(t *testing.T) {
+		got, err := alerts.List(ctx, data.ServiceAlertFilter{LineID: 1})
+		require.NoError(t, err)
+		assert.Equal(t, []int64{detour.ID, closure.ID}, ids(got), "the direction is of line 1, which serves Park")
+
+		got, err = alerts.List(ctx, data.ServiceAlertFilter{LineID: 2})
+		require.NoError(t, err)
+		assert.Equal(t, []int64{closure.ID}, ids(got))
+	})
+
+	t.Run("List by stop", func(t *testing.T) {
+		got, err := alerts.List(ctx, data.ServiceAlertFilter{StopID: center})
+		require.NoError(t, err)
+		assert.Equal(t, []int64{detour.ID}, ids(got))
+
+		got, err = alerts.List(ctx, data.ServiceAlertFilter{StopID: park})
+		require.NoError(t, err)
+		assert.Equal(t, []int64{closure.ID}, ids(got))
+
+		got, err = alerts.List(ctx, data.ServiceAlertFilter{StopID: 5})
+		require.NoError(t, err)
+		assert.Empty(t, got)
+	})
+
+	t.Run("List after an ID", func(t *testing.T) {
+		got, err := alerts.List(ctx, data.ServiceAlertFilter{AfterID: closure.ID})
+		require.NoError(t, err)
+		assert.Equal(t, []int64{detour.ID, expired.ID}, ids(got))
+	})
+
+	t.Run("Push targets follow affected favourites", func(t *testing.T) {
+		line6 := 2
+		require.NoError(t, store.Favourites.Create(ctx, &data.Favourite{UserID: 1, LineID: &line6}))
+		require.NoError(t, store.Favourites.Create(ctx, &data.Favourite{UserID: 2, StopID: &center}))
+		alice := data.PushSubscription{UserID: 1, Endpoint: "https://push.example.com/alice"}
+		bob := data.PushSubscription{UserID: 2, Endpoint: "https://push.example.com/bob"}
+		require.NoError(t, store.Push.Save(ctx, &alice))
+		require.NoError(t, store.Push.Save(ctx, &bob))
+
+		endpoints := func(subs []data.PushSubscription) []string {
+			out := make([]string, 0, len(subs))
+			for _, p := range subs {
+				out = append(out, p.Endpoint)
+			}
+			return out
+		}
+
+		got, err := store.Push.AlertTargets(ctx, closure.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{alice.Endpoint}, endpoints(got), "line 6 serves Park")
+
+		got, err = store.Push.AlertTargets(ctx, detour.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{bob.Endpoint}, endpoints(got), "the direction calls at Center")
+
+		got, err = store.Push.AlertTargets(ctx, expired.ID)
+		require.NoError(t, err)
+		assert.Empty(t, got)
+	})
+
+	t.Run("Push cursor starts at the newest alert", func(t *testing.T) {
+		_, err := store.Push.Claim(ctx)
+		require.NoError(t, err)
+
+		cursor, err := store.Push.ServiceAlertCursor(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, expired.ID, cursor)
+
+		require.NoError(t, store.Push.SetServiceAlertCursor(ctx, closure.ID))
+		cursor, err = store.Push.ServiceAlertCursor(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, closure.ID, cursor)
+	})
+
+	t.Run("ClosedStops", func(t *testing.T) {
+		got, err := alerts.List(ctx, data.ServiceAlertFilter{ActiveAt: now})
+		require.NoError(t, err)
+		assert.Equal(t, []int{park}, data.ClosedStops(got))
+	})
+
+	t.Run("Update replaces the entities", func(t *testing.T) {
+		updated := closure
+		updated.Header = data.Translations{"sl": "Postajališče zaprto do nadaljnjega"}
+		updated.Entities = []data.ServiceAlertEntity{{StopID: &station}}
+		require.NoError(t, alerts.Update(ctx, &updated))
+		assert.Equal(t, "Station", updated.Entities[0].StopName)
+
+		got, err := alerts.List(ctx, data.ServiceAlertFilter{StopID: park})
+		require.NoError(t, err)
+		assert.Empty(t, got)
+
+		got, err = alerts.List(ctx, data.ServiceAlertFilter{StopID: station})
+		require.NoError(t, err)
+		require.Equal(t, []int64{detour.ID, closure.ID}, ids(got))
+		assert.Equal(t, "Postajališče zaprto do nadaljnjega", got[1].Header["sl"])
+		assert.Len(t, got[1].Entities, 1)
+
+		missing := updated
+		missing.ID = 999
+		assert.ErrorIs(t, alerts.Update(ctx, &missing), data.ErrNotFound)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		require.NoError(t, alerts.Delete(ctx, expired.ID))
+		assert.ErrorIs(t, alerts.Delete(ctx, expired.ID), data.ErrNotFound)
+
+		got, err := alerts.List(ctx, data.ServiceAlertFilter{})
+		require.NoError(t, err)
+		assert.Len(t, got, 2)
+	})
+}
+
+func testOccupancy(t *testing.T, store data.Storage) {
+	ctx := context.Background()
+	occupancy := store.Occupancy
+
+	t.Run("GetOccupancyForLineByDate is ordered by time", func(t *testing.T) {
+		records, err := occupancy.GetOccupancyForLineByDate(ctx, 1, "2024-05-01")
+		require.NoError(t, err)
+		assert.Equal(t, []data.OccupancyRecord{
+			{Time: "08:00:00", OccupancyLevel: 4},
+			{Time: "08:30:00", OccupancyLevel: 2},
+			{Time: "09:15:00", OccupancyLevel: 3},
+		}, records)
+
+		records, err = occupancy.GetOccupancyForLineByDate(ctx, 1, "2024-06-01")
+		require.NoError(t, err)
+		assert.Empty(t, records)
+	})
+
+	t.Run("GetOccupancyForLineByDateAndHour", func(t *testing.T) {
+		records, err := occupancy.GetOccupancyForLineByDateAndHour(ctx, 1, "2024-05-01", 8)
+		require.NoError(t, err)
+		assert.Equal(t, []data.OccupancyRecord{
+			{Time: "08:00:00", Date: "2024-05-01", OccupancyLevel: 4},
+			{Time: "08:30:00", Date: "2024-05-01", OccupancyLevel: 2},
+		}, records)
+	})
+
+	t.Run("averages", func(t *testing.T) {
+		byHour, err := occupancy.GetAvgOccupancyAllLinesByHour(ctx, 8)
+		require.NoError(t, err)
+		assert.Equal(t, &data.AvgOccupancyByHour{HourOfDay: 8, AvgOccupancy: 3}, byHour)
+
+		byHour, err = occupancy.GetAvgOccupancyAllLinesByHour(ctx, 3)
+		require.NoError(t, err)
+		assert.Nil(t, byHour)
+
+		daily, err := occupancy.GetAvgDailyOccupancyAllLines(ctx, "2024-05-01")
+		require.NoError(t, err)
+		assert.Equal(t, &data.AvgDailyOccupancy{Date: "2024-05-01", AvgDailyOccupancy: 3.5}, daily)
+
+		daily, err = occupancy.GetAvgDailyOccupancyAllLines(ctx, "2024-06-01")
+		require.NoError(t, err)
+		assert.Nil(t, daily)
+	})
+}
+
+func testStationOverrides(t *testing.T, store data.Storage) {
+	ctx := context.Background()
+	overrides := store.StationOverrides
+
+	t.Run("Set", func(t *testing.T) {
+		for _, o := range []*data.StationOverride{{StopID: 4, StationStopID: 1}, {StopID: 2, StationStopID: 2}} {
+			require.NoError(t, overrides.Set(ctx, o))
+			assert.False(t, o.UpdatedAt.IsZero())
+		}
+
+		assert.ErrorIs(t, overrides.Set(ctx, &data.StationOverride{StopID: 99, StationStopID: 1}), data.ErrNotFound)
+		assert.ErrorIs(t, overrides.Set(ctx, &data.StationOverride{StopID: 3, StationStopID: 99}), data.ErrNotFound)
+	})
+
+	t.Run("Set replaces the override of the stop", func(t *testing.T) {
+		require.NoError(t, overrides.Set(ctx, &data.StationOverride{StopID: 4, StationStopID: 3}))
+
+		got, err := overrides.List(ctx)
+		require.NoError(t, err)
+		require.Len(t, got, 2)
+		assert.Equal(t, []int{2, 4}, []int{got[0].StopID, got[1].StopID}, "by stop")
+		assert.Equal(t, 2, got[0].StationStopID)
+		assert.Equal(t, 3, got[1].StationStopID)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		require.NoError(t, overrides.Delete(ctx, 2))
+		assert.ErrorIs(t, overrides.Delete(ctx, 2), data.ErrNotFound)
+
+		got, err := overrides.List(ctx)
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		assert.Equal(t, 4, got[0].StopID)
+	})
+}
+
+func testTransactions(t *testing.T, store data.Storage) {
+	ctx := context.Background()
+	errAbort := errors.New("abort")
+
+	t.Run("commit", func(t *testing.T) {
+		err := store.WithTx(ctx, func(tx data.Storage) error {
+			if err := tx.User.Create(ctx, &data.User{Username: "dave", Email: "dave@example.com", Password: "x"}); err != nil {
+				return err
+			}
+			dave, err := tx.User.GetByEmail(ctx, "dave@example.com")
+			if err != nil {
+				return err
+			}
+			_, err = tx.Delays.InsertDelay(ctx, data.DelayReportInputUnMarshaled{
+				Date: time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC), DelayMin: 4, StopID: 1, LineID: 1, UserId: dave.ID,
+			})
+			return err
+		})
+		require.NoError(t, err)
+
+		dave, err := store.User.GetByEmail(ctx, "dave@example.com")
+		require.NoError(t, err)
+		reports, err := store.Delays.GetDelaysByUser(ctx, int64(dave.ID))
+		require.NoError(t, err)
+		assert.Len(t, reports, 1)
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		err := store.WithTx(ctx, func(tx data.Storage) error {
+			if err := tx.User.Create(ctx, &data.User{Username: "erin", Email: "erin@example.com", Password: "x"}); err != nil {
+				return err
+			}
+			if _, err := tx.User.GetByEmail(ctx, "erin@example.com"); err != nil {
+				return err
+			}
+			return errAbort
+		})
+		assert.ErrorIs(t, err, errAbort)
+
+		_, err = store.User.GetByEmail(ctx, "erin@example.com")
+		assert.ErrorIs(t, err, data.ErrNotFound)
+	})
+
+	t.Run("nested calls join the transaction", func(t *testing.T) {
+		err := store.WithTx(ctx, func(tx data.Storage) error {
+			err := tx.WithTx(ctx, func(inner data.Storage) error {
+				return inner.User.Create(ctx, &data.User{Username: "frank", Email: "frank@example.com", Password: "x"})
+			})
+			if err != nil {
+				return err
+			}
+			return errAbort
+		})
+		assert.ErrorIs(t, err, errAbort)
+
+		_, err = store.User.GetByEmail(ctx, "frank@example.com")
+		assert.ErrorIs(t, err, data.ErrNotFound)
+	})
+
+	t.Run("locking the user serialises checks of their rows", func(t *testing.T) {
+		errFull := errors.New("full")
+		var wg sync.WaitGroup
+		errs := make([]error, 4)
+		for i := range errs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				stopID := i + 1
+				errs[i] = store.WithTx(ctx, func(tx data.Storage) error {
+					if err := tx.User.Lock(ctx, 1); err != nil {
+						return err
+					}
+					existing, err := tx.Favourites.List(ctx, 1)
+					if err != nil {
+						return err
+					}
+					if len(existing) >= 1 {
+						return errFull
+					}
+					return tx.Favourites.Create(ctx, &data.Favourite{UserID: 1, StopID: &stopID})
+				})
+			}()
+		}
+		wg.Wait()
+
+		created := 0
+		for _, err := range errs {
+			if err == nil {
+				created++
+			} else {
+				assert.ErrorIs(t, err, errFull)
+			}
+		}
+		assert.Equal(t, 1, created)
+
+		favourites, err := store.Favourites.List(ctx, 1)
+		require.NoError(t, err)
+		assert.Len(t, favourites, 1)
+	})
+
+	t.Run("conflicts roll back earlier statements", func(t *testing.T) {
+		err := store.WithTx(ctx, func(tx data.Storage) error {
+			if err := tx.User.Create(ctx, &data.User{Username: "gina", Email: "gina@example.com", Password: "x"}); err != nil {
+				return err
+			}
+			return tx.User.Create(ctx, &data.User{Username: "alice", Email: "gina2@example.com", Password: "x"})
+		})
+		assert.ErrorIs(t, err, data.ErrConflict)
+
+		_, err = store.User.GetByEmail(ctx, "gina@example.com")
+		assert.ErrorIs(t, err, data.ErrNotFound)
+	})
+}
@@ -0,0 +1,15 @@
+package data
+
+import (
+	"backend/internal/tracing"
+	"context"
+)
+
+// startQuerySpan opens a client span for a storage method, recording the
+// SQL text it is about to run.
+func startQuerySpan(ctx context.Context, name, query string) (context.Context, *tracing.Span) {
+	return tracing.Start(ctx, name, tracing.WithKind(tracing.KindClient), tracing.WithAttributes(
+		tracing.String("db.system", "postgresql"),
+		tracing.String("db.statement", query),
+	))
+}
@@ -0,0 +1,235 @@
+package data
+
+import (
+	"backend/internal/tracing"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// Trip modes say what the time of a saved trip means.
+const (
+	// TripDepartAt trips leave the origin at or after the time.
+	TripDepartAt = "depart_at"
+	// TripArriveBy trips reach the destination at or before the time.
+	TripArriveBy = "arrive_by"
+)
+
+// Weekdays lists the weekday names used by saved trips, Monday first.
+var Weekdays = []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"}
+
+// Weekday returns the name of t's weekday as used by saved trips.
+func Weekday(t time.Time) string {
+	return Weekdays[(int(t.Weekday())+6)%7]
+}
+
+// SavedTrip is a journey a user makes regularly, such as the daily commute.
+// Time is "15:04".
+type SavedTrip struct {
+	ID                int64     `json:"id"`
+	UserID            int       `json:"-"`
+	Name              string    `json:"name"`
+	OriginStopID      int       `json:"origin_stop_id"`
+	OriginName        string    `json:"origin_name"`
+	DestinationStopID int       `json:"destination_stop_id"`
+	DestinationName   string    `json:"destination_name"`
+	Mode              string    `json:"mode"`
+	Time              string    `json:"time"`
+	Weekdays          []string  `json:"weekdays"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// RunsOn reports whether the trip is made on day's weekday.
+func (t *SavedTrip) RunsOn(day time.Time) bool {
+	name := Weekday(day)
+	for _, d := range t.Weekdays {
+		if d == name {
+			return true
+		}
+	}
+	return false
+}
+
+type SavedTripPayload struct {
+	Name              string   `json:"name" validate:"required,max=100"`
+	OriginStopID      int      `json:"origin_stop_id" validate:"required,min=1"`
+	DestinationStopID int      `json:"destination_stop_id" validate:"required,min=1"`
+	Mode              string   `json:"mode" validate:"required,oneof=depart_at arrive_by"`
+	Time              string   `json:"time" validate:"required,clock"`
+	Weekdays          []string `json:"weekdays" validate:"required,oneof=mon tue wed thu fri sat sun"`
+}
+
+type TripsStorage struct {
+	db     querier
+	logger *zap.SugaredLogger
+}
+
+func scanSavedTrip(row interface{ Scan(...any) error }) (*SavedTrip, error) {
+	var t SavedTrip
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.OriginStopID, &t.OriginName,
+		&t.DestinationStopID, &t.DestinationName, &t.Mode, &t.Time, pq.Array(&t.Weekdays), &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+const savedTripColumns = `
+	t.id, t.user_id, t.name, t.origin_stop_id, o.name, t.destination_stop_id, d.name,
+	t.mode, to_char(t.time, 'HH24:MI'), t.weekdays, t.created_at
+`
+
+const savedTripSelect = `SELECT` + savedTripColumns + `
+	FROM saved_trips AS t
+	JOIN stops AS o ON o.id = t.origin_stop_id
+	JOIN stops AS d ON d.id = t.destination_stop_id
+`
+
+// List returns the saved trips of a user ordered by time of day.
+func (s *TripsStorage) List(ctx context.Context, userID int) ([]SavedTrip, error) {
+	query := savedTripSelect + `WHERE t.user_id = $1 ORDER BY t.time, t.id`
+
+	ctx, span := startQuerySpan(ctx, "TripsStorage.List", query)
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, span.Fail(err)
+	}
+	defer rows.Close()
+
+	trips := []SavedTrip{}
+	for rows.Next() {
+		t, err := scanSavedTrip(rows)
+		if err != nil {
+			return nil, span.Fail(err)
+		}
+		trips = append(trips, *t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, span.Fail(err)
+	}
+
+	span.SetAttributes(tracing.Int("db.rows", len(trips)))
+
+	return trips, nil
+}
+
+// Get returns a saved trip of the user. Trips of other users are reported as
+// ErrNotFound.
+func (s *TripsStorage) Get(ctx context.Context, userID int, id int64) (*SavedTrip, error) {
+	query := savedTripSelect + `WHERE t.id = $1 AND t.user_id = $2`
+
+	ctx, span := startQuerySpan(ctx, "TripsStorage.Get", query)
+	defer span.End()
+
+	t, err := scanSavedTrip(s.db.QueryRowContext(ctx, query, id, userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("saved trip %d: %w", id, ErrNotFound)
+		}
+		return nil, span.Fail(err)
+	}
+
+	return t, nil
+}
+
+// Create stores a trip and fills in its ID, stop names and creation time. It
+// returns ErrConflict when the user already has a trip with the same name and
+// ErrNotFound when a stop does not exist.
+func (s *TripsStorage) Create(ctx context.Context, t *SavedTrip) error {
+	query := `
+		WITH t AS (
+			INSERT INTO saved_trips (user_id, name, origin_stop_id, destination_stop_id, mode, time, weekdays)
+			VALUES ($1, $2, $3, $4, $5, $6::time, $7)
+			RETURNING *
+		)
+		SELECT` + savedTripColumns + `
+		FROM t
+		JOIN stops AS o ON o.id = t.origin_stop_id
+		JOIN stops AS d ON d.id = t.destination_stop_id
+	`
+
+	ctx, span := startQuerySpan(ctx, "TripsStorage.Create", query)
+	defer span.End()
+
+	created, err := scanSavedTrip(s.db.QueryRowContext(ctx, query,
+		t.UserID, t.Name, t.OriginStopID, t.DestinationStopID, t.Mode, t.Time, pq.Array(t.Weekdays)))
+	if err != nil {
+		if err := mapMissingReference(mapConflict(err)); errors.Is(err, ErrConflict) || errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("creating saved trip: %w", err)
+		}
+		return span.Fail(fmt.Errorf("creating saved trip: %w", err))
+	}
+
+	*t = *created
+
+	return nil
+}
+
+// Update replaces the name, stops, mode, time and weekdays of a trip of the
+// user. It reports the same errors as Create, and ErrNotFound for trips of
+// other users.
+func (s *TripsStorage) Update(ctx context.Context, t *SavedTrip) error {
+	query := `
+		WITH t AS (
+			UPDATE saved_trips
+			SET name = $3, origin_stop_id = $4, destination_stop_id = $5, mode = $6, time = $7::time, weekdays = $8
+			WHERE id = $1 AND user_id = $2
+			RETURNING *
+		)
+		SELECT` + savedTripColumns + `
+		FROM t
+		JOIN stops AS o ON o.id = t.origin_stop_id
+		JOIN stops AS d ON d.id = t.destination_stop_id
+	`
+
+	ctx, span := startQuerySpan(ctx, "TripsStorage.Update", query)
+	defer span.End()
+
+	updated, err := scanSavedTrip(s.db.QueryRowContext(ctx, query,
+		t.ID, t.UserID, t.Name, t.OriginStopID, t.DestinationStopID, t.Mode, t.Time, pq.Array(t.Weekdays)))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("saved trip %d: %w", t.ID, ErrNotFound)
+		}
+		if err := mapMissingReference(mapConflict(err)); errors.Is(err, ErrConflict) || errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("updating saved trip: %w", err)
+		}
+		return span.Fail(fmt.Errorf("updating saved trip: %w", err))
+	}
+
+	*t = *updated
+
+	return nil
+}
+
+// Delete removes a saved trip of the user. Trips of other users are reported
+// as ErrNotFound.
+func (s *TripsStorage) Delete(ctx context.Context, userID int, id int64) error {
+	query := `DELETE FROM saved_trips WHERE id = $1 AND user_id = $2`
+
+	ctx, span := startQuerySpan(ctx, "TripsStorage.Delete", query)
+	defer span.End()
+
+	res, err := s.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return span.Fail(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return span.Fail(err)
+	}
+	if n == 0 {
+		return fmt.Errorf("saved trip %d: %w", id, ErrNotFound)
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package data
+
+import (
+	"backend/internal/tracing"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// querier is the part of *sql.DB and *sql.Tx the Postgres storages use, so
+// the same code runs inside and outside of a transaction.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// TxFunc runs fn against a Storage whose repositories share one transaction.
+// It is how a backend implements Storage.WithTx.
+type TxFunc func(ctx context.Context, fn func(tx Storage) error) error
+
+// WithTx runs fn as a unit of work: every repository of the Storage passed to
+// fn shares one transaction, which is committed when fn returns nil and rolled
+// back otherwise. Calling WithTx on the transactional Storage joins the
+// running transaction. Storages built without a TxFunc, such as handler test
+// doubles, run fn directly.
+func (s Storage) WithTx(ctx context.Context, fn func(tx Storage) error) error {
+	if s.tx == nil {
+		return fn(s)
+	}
+	return s.tx(ctx, fn)
+}
+
+// WithTxFunc returns a copy of s whose WithTx uses tx.
+func (s Storage) WithTxFunc(tx TxFunc) Storage {
+	s.tx = tx
+	return s
+}
+
+func newPostgresStorage(db querier, logger *zap.SugaredLogger) Storage {
+	return Storage{
+		Stations:         &StopStorage{db, logger},
+		Routes:           &RoutesStorage{db, logger},
+		RouteShapes:      &RouteShapesStorage{db, logger},
+		User:             &UsersStorage{db, logger},
+		APIKeys:          &APIKeysStorage{db, logger},
+		Delays:           &DelaysStorage{db, logger},
+		Occupancy:        &OccupancyStorage{db, logger},
+		Favourites:       &FavouritesStorage{db, logger},
+		Trips:            &TripsStorage{db, logger},
+		Alerts:           &AlertsStorage{db, logger},
+		Push:             &PushStorage{db, logger},
+		ServiceAlerts:    &ServiceAlertsStorage{db, logger},
+		StationOverrides: &StationOverridesStorage{db, logger},
+	}
+}
+
+func postgresTx(db *sql.DB, logger *zap.SugaredLogger) TxFunc {
+	return func(ctx context.Context, fn func(tx Storage) error) (err error) {
+		ctx, span := tracing.Start(ctx, "Storage.WithTx", tracing.WithKind(tracing.KindClient))
+		defer span.End()
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return span.Fail(fmt.Errorf("beginning transaction: %w", err))
+		}
+
+		defer func() {
+			if p := recover(); p != nil {
+				_ = tx.Rollback()
+				panic(p)
+			}
+		}()
+
+		txStorage := newPostgresStorage(tx, logger)
+		txStorage.tx = func(ctx context.Context, fn func(Storage) error) error {
+			return fn(txStorage)
+		}
+
+		if err := fn(txStorage); err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.Warnw("transaction rollback failed", "error", rbErr)
+			}
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return span.Fail(fmt.Errorf("committing transaction: %w", err))
+		}
+
+		return nil
+	}
+}
+
+// Postgres SQLSTATEs of violated constraints.
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
+
+// mapConflict turns a unique-constraint violation into ErrConflict, naming
+// the constraint, and returns every other error unchanged.
+func mapConflict(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return fmt.Errorf("%s: %w", pqErr.Constraint, ErrConflict)
+	}
+	return err
+}
+
+// mapMissingReference turns a foreign-key violation, such as a favourite
+// naming a stop that does not exist, into ErrNotFound and returns every other
+// error unchanged.
+func mapMissingReference(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation {
+		return fmt.Errorf("%s: %w", pqErr.Constraint, ErrNotFound)
+	}
+	return err
+}
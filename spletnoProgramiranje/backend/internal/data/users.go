@@ -6,18 +6,20 @@ import (
 	"errors"
 	"fmt"
 	"time"
+
+	"go.uber.org/zap"
 )
 
 type RegisterUserPayload struct {
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Username string `json:"username" validate:"required,min=3,max=50"`
+	Email    string `json:"email" validate:"required,email,max=100"`
+	Password string `json:"password" validate:"required,password"`
 }
 
 type UpdateUserPayload struct {
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Username string `json:"username" validate:"required,min=3,max=50"`
+	Email    string `json:"email" validate:"required,email,max=100"`
+	Password string `json:"password" validate:"omitempty,password"`
 }
 
 type User struct {
@@ -25,6 +27,7 @@ type User struct {
 	Username  string     `json:"username"`
 	Email     string     `json:"email"`
 	Password  string     `json:"password"`
+	Role      string     `json:"role"`
 	CreatedAt time.Time  `json:"created_at"`
 	LastLogin *time.Time `json:"last_login"`
 }
@@ -38,101 +41,149 @@ type UserForClient struct {
 }
 
 type LoginUserPayload struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
 }
 
+// User roles. Admins may manage API keys.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type UsersStorage struct {
-	db *sql.DB
+	db     querier
+	logger *zap.SugaredLogger
 }
 
 func (s *UsersStorage) Create(ctx context.Context, user *User) error {
-	//fmt.Printf("Username: %s\nEmail: %s\nPassword: %s\n", user.Username, user.Email, user.Password)
-	_, err := s.db.Exec("INSERT INTO users (username, email, password) VALUES ($1, $2, $3)", user.Username, user.Email, user.Password)
+	query := `INSERT INTO users (username, email, password) VALUES ($1, $2, $3)`
+
+	ctx, span := startQuerySpan(ctx, "UsersStorage.Create", query)
+	defer span.End()
+
+	_, err := s.db.ExecContext(ctx, query, user.Username, user.Email, user.Password)
 
 	if err != nil {
-		return err
+		if err := mapConflict(err); errors.Is(err, ErrConflict) {
+			return fmt.Errorf("user %q: %w", user.Email, err)
+		}
+		return span.Fail(err)
 	}
 
 	return nil
 }
 
 func (s *UsersStorage) GetByEmail(ctx context.Context, email string) (*User, error) {
-	rows, err := s.db.Query("SELECT * FROM users WHERE email = $1", email)
+	query := `
+		SELECT id, username, email, password, role, created_at, last_login
+		FROM users
+		WHERE email = $1
+	`
 
-	if err != nil {
-		fmt.Print(err.Error())
-		return nil, err
-	}
+	ctx, span := startQuerySpan(ctx, "UsersStorage.GetByEmail", query)
+	defer span.End()
 
-	var user User
+	row := s.db.QueryRowContext(ctx, query, email)
 
-	for rows.Next() {
-		err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt, &user.LastLogin)
-		if err != nil {
-			fmt.Print(err.Error())
-			return nil, err
+	var user User
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Role, &user.CreatedAt, &user.LastLogin)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("user with email %q: %w", email, ErrNotFound)
 		}
-	}
-
-	if user.ID == 0 {
-		return nil, fmt.Errorf("User not found")
+		return nil, span.Fail(err)
 	}
 
 	return &user, nil
 }
 
 func (s *UsersStorage) GetById(ctx context.Context, id int) (*User, error) {
-	rows, err := s.db.Query("SELECT * FROM users WHERE id = $1", id)
+	query := `
+		SELECT id, username, email, password, role, created_at, last_login
+		FROM users
+		WHERE id = $1
+	`
 
-	if err != nil {
-		return nil, err
-	}
+	ctx, span := startQuerySpan(ctx, "UsersStorage.GetById", query)
+	defer span.End()
 
-	var user User
+	row := s.db.QueryRowContext(ctx, query, id)
 
-	for rows.Next() {
-		err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt, &user.LastLogin)
-		if err != nil {
-			return nil, err
+	var user User
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Role, &user.CreatedAt, &user.LastLogin)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("user %d: %w", id, ErrNotFound)
 		}
+		return nil, span.Fail(err)
 	}
 
-	if user.ID == 0 {
-		return nil, fmt.Errorf("User not found")
+	return &user, nil
+}
+
+// Lock locks the user's row until the surrounding transaction ends, so that
+// a check on the rows the user owns, such as how many favourites they have,
+// still holds when the transaction writes. Concurrent requests of the same
+// user wait for each other. Outside a transaction it only checks that the
+// user exists.
+func (s *UsersStorage) Lock(ctx context.Context, id int) error {
+	query := `SELECT id FROM users WHERE id = $1 FOR UPDATE`
+
+	ctx, span := startQuerySpan(ctx, "UsersStorage.Lock", query)
+	defer span.End()
+
+	if err := s.db.QueryRowContext(ctx, query, id).Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("user %d: %w", id, ErrNotFound)
+		}
+		return span.Fail(err)
 	}
 
-	return &user, nil
+	return nil
 }
 
 func (s *UsersStorage) UpdateById(ctx context.Context, id int, update *UpdateUserPayload) error {
-	_, err := s.db.Exec(`
-		UPDATE users 
+	query := `
+		UPDATE users
 		SET username = $1, email = $2
 		WHERE id = $3
-	`, update.Username, update.Email, id)
+	`
+
+	ctx, span := startQuerySpan(ctx, "UsersStorage.UpdateById", query)
+	defer span.End()
+
+	_, err := s.db.ExecContext(ctx, query, update.Username, update.Email, id)
 
 	if err != nil {
-		return err
+		if err := mapConflict(err); errors.Is(err, ErrConflict) {
+			return fmt.Errorf("user %d: %w", id, err)
+		}
+		return span.Fail(err)
 	}
 
 	return nil
 }
 
 func (s *UsersStorage) GetByIDForClient(ctx context.Context, id int) (*UserForClient, error) {
-	row := s.db.QueryRowContext(ctx, `
+	query := `
 		SELECT id, username, email, created_at, last_login
 		FROM users
 		WHERE id = $1
-	`, id)
+	`
+
+	ctx, span := startQuerySpan(ctx, "UsersStorage.GetByIDForClient", query)
+	defer span.End()
+
+	row := s.db.QueryRowContext(ctx, query, id)
 
 	var user UserForClient
 	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.LastLogin)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("user not found")
+			return nil, fmt.Errorf("user %d: %w", id, ErrNotFound)
 		}
-		return nil, err
+		return nil, span.Fail(err)
 	}
 
 	return &user, nil
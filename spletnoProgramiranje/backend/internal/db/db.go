@@ -1,49 +1,70 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"log"
 	"time"
 
 	_ "github.com/lib/pq"
+	"go.uber.org/zap"
 )
 
-func New(addr string, maxOpenConnections int, maxIdleConnections int, maxIdleTime string) (*sql.DB, error) {
+// Backoff between connection attempts. The delay doubles after every failed
+// ping up to maxRetryDelay.
+const (
+	initialRetryDelay = 250 * time.Millisecond
+	maxRetryDelay     = 5 * time.Second
+)
+
+// New opens a connection pool and pings the database until it answers or ctx
+// is done. A database that is still unreachable when ctx expires is an error,
+// so the caller should bound ctx by how long startup may wait, e.g. for a
+// database container that is still booting.
+func New(ctx context.Context, addr string, maxOpenConnections int, maxIdleConnections int, maxIdleTime time.Duration, logger *zap.SugaredLogger) (*sql.DB, error) {
 	db, err := sql.Open("postgres", addr)
 	if err != nil {
 		return nil, fmt.Errorf("error opening database connection: %w", err)
 	}
 
-	fmt.Print("connecting:")
-
 	// Set connection pool parameters.
 	db.SetMaxOpenConns(maxOpenConnections)
 	db.SetMaxIdleConns(maxIdleConnections)
+	db.SetConnMaxIdleTime(maxIdleTime)
 
-	duration, err := time.ParseDuration(maxIdleTime)
-	if err != nil {
-		db.Close()
-		return nil, fmt.Errorf("error parsing max idle time duration: %w", err)
-	}
-	db.SetConnMaxIdleTime(time.Duration(duration))
-
-	log.Println("Attempting to connect to the database...")
-	const maxRetries = 20
-	const retryDelay = 5 * time.Second
+	logger.Infow("connecting to the database")
 
-	for i := 0; i < maxRetries; i++ {
-		err = db.Ping()
+	delay := initialRetryDelay
+	for attempt := 1; ; attempt++ {
+		err = db.PingContext(ctx)
 		if err == nil {
-			log.Println("Successfully connected to the database!")
+			logger.Infow("connected to the database", "attempts", attempt)
 			return db, nil
 		}
 
-		log.Printf("Failed to ping database (attempt %d/%d): %v. Retrying in %s...", i+1, maxRetries, err, retryDelay)
-		time.Sleep(retryDelay)
-	}
+		logger.Warnw("failed to ping database, retrying",
+			"attempt", attempt,
+			"retry_in", delay,
+			"error", err,
+		)
+
+		select {
+		case <-ctx.Done():
+			db.Close()
+			return nil, fmt.Errorf("database unreachable after %d attempts: %w", attempt, err)
+		case <-time.After(delay):
+		}
 
-	fmt.Printf("%v\n", db.Ping())
+		delay = min(2*delay, maxRetryDelay)
+	}
+}
 
-	return db, nil
+// CheckPostGIS checks that the PostGIS extension the spatial queries rely on
+// is installed and usable.
+func CheckPostGIS(ctx context.Context, db *sql.DB) error {
+	var version string
+	if err := db.QueryRowContext(ctx, "SELECT postgis_lib_version()").Scan(&version); err != nil {
+		return fmt.Errorf("postgis unavailable: %w", err)
+	}
+	return nil
 }
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS public.occupancy;
+DROP TABLE IF EXISTS public.delays;
+DROP TABLE IF EXISTS public.arrivals;
+DROP TABLE IF EXISTS public.routes;
+DROP TABLE IF EXISTS public.departures;
+DROP TABLE IF EXISTS public.directions;
+DROP TABLE IF EXISTS public.lines;
+DROP TABLE IF EXISTS public.stops;
+DROP TABLE IF EXISTS public.users;
@@ -0,0 +1,155 @@
+-- Baseline schema, matching databaseSchema3.sql. Every statement tolerates
+-- existing objects so that databases created from the SQL dump before
+-- migrations existed can adopt this history without manual steps.
+
+CREATE TABLE IF NOT EXISTS public.users (
+	id serial NOT NULL,
+	username character varying(50) NOT NULL,
+	email character varying(100) NOT NULL,
+	password character varying(100) NOT NULL,
+	created_at timestamp(0) with time zone DEFAULT CURRENT_TIMESTAMP,
+	last_login timestamp with time zone,
+	CONSTRAINT users_pk PRIMARY KEY (id),
+	CONSTRAINT username_uq UNIQUE (username),
+	CONSTRAINT email_uq UNIQUE (email)
+);
+
+CREATE TABLE IF NOT EXISTS public.stops (
+	id integer NOT NULL,
+	number character varying(10) NOT NULL,
+	name character varying(100) NOT NULL,
+	latitude numeric(9,6) NOT NULL,
+	longitude numeric(9,6) NOT NULL,
+	CONSTRAINT stops_pk PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS public.lines (
+	id serial NOT NULL,
+	line_code character varying(10) NOT NULL,
+	CONSTRAINT lines_pk PRIMARY KEY (id),
+	CONSTRAINT code_uq UNIQUE (line_code)
+);
+
+CREATE TABLE IF NOT EXISTS public.directions (
+	id serial NOT NULL,
+	line_id integer,
+	name text NOT NULL,
+	CONSTRAINT directions_pk PRIMARY KEY (id),
+	CONSTRAINT unique_pair UNIQUE (line_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS public.departures (
+	id serial NOT NULL,
+	stop_id integer NOT NULL,
+	direction_id integer NOT NULL,
+	date date NOT NULL,
+	line_id integer,
+	CONSTRAINT departures_pk PRIMARY KEY (id),
+	CONSTRAINT departures_unique_run UNIQUE (stop_id, direction_id, date)
+);
+
+ALTER TABLE public.departures ADD COLUMN IF NOT EXISTS line_id integer;
+
+CREATE TABLE IF NOT EXISTS public.routes (
+	id serial NOT NULL,
+	name character varying(10) NOT NULL,
+	path jsonb NOT NULL,
+	line_id integer,
+	CONSTRAINT routes_pk PRIMARY KEY (id),
+	CONSTRAINT uq_routes_name_line UNIQUE (name, line_id)
+);
+
+CREATE TABLE IF NOT EXISTS public.arrivals (
+	id serial NOT NULL,
+	departure_time time[] NOT NULL,
+	departures_id integer NOT NULL,
+	CONSTRAINT arrivals_pk PRIMARY KEY (id),
+	CONSTRAINT arrivals_departures_id_unique UNIQUE (departures_id),
+	CONSTRAINT fk_arrivals_departures FOREIGN KEY (departures_id)
+		REFERENCES public.departures (id) MATCH SIMPLE
+		ON DELETE CASCADE ON UPDATE NO ACTION
+);
+
+CREATE TABLE IF NOT EXISTS public.delays (
+	id serial NOT NULL,
+	date date NOT NULL,
+	delay_min integer NOT NULL,
+	stop_id integer NOT NULL,
+	line_id integer NOT NULL,
+	user_id integer,
+	CONSTRAINT delays_pk PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS public.occupancy (
+	id serial NOT NULL,
+	line_id integer NOT NULL,
+	date date NOT NULL,
+	"time" time NOT NULL,
+	occupancy_level integer NOT NULL,
+	CONSTRAINT occupancy_pk PRIMARY KEY (id)
+);
+
+-- Foreign keys. ADD CONSTRAINT has no IF NOT EXISTS, so duplicates are
+-- swallowed explicitly.
+DO $$
+BEGIN
+	ALTER TABLE public.directions ADD CONSTRAINT line_id FOREIGN KEY (line_id)
+		REFERENCES public.lines (id) MATCH SIMPLE ON DELETE SET NULL ON UPDATE NO ACTION;
+EXCEPTION WHEN duplicate_object THEN NULL;
+END $$;
+
+DO $$
+BEGIN
+	ALTER TABLE public.departures ADD CONSTRAINT stop_id FOREIGN KEY (stop_id)
+		REFERENCES public.stops (id) MATCH SIMPLE ON DELETE SET NULL ON UPDATE NO ACTION;
+EXCEPTION WHEN duplicate_object THEN NULL;
+END $$;
+
+DO $$
+BEGIN
+	ALTER TABLE public.departures ADD CONSTRAINT direction_id FOREIGN KEY (direction_id)
+		REFERENCES public.directions (id) MATCH SIMPLE ON DELETE SET NULL ON UPDATE NO ACTION;
+EXCEPTION WHEN duplicate_object THEN NULL;
+END $$;
+
+DO $$
+BEGIN
+	ALTER TABLE public.departures ADD CONSTRAINT fk_departures_line FOREIGN KEY (line_id)
+		REFERENCES public.lines (id) ON DELETE SET NULL;
+EXCEPTION WHEN duplicate_object THEN NULL;
+END $$;
+
+DO $$
+BEGIN
+	ALTER TABLE public.routes ADD CONSTRAINT line_id FOREIGN KEY (line_id)
+		REFERENCES public.lines (id) MATCH SIMPLE ON DELETE SET NULL ON UPDATE NO ACTION;
+EXCEPTION WHEN duplicate_object THEN NULL;
+END $$;
+
+DO $$
+BEGIN
+	ALTER TABLE public.delays ADD CONSTRAINT user_id FOREIGN KEY (user_id)
+		REFERENCES public.users (id) MATCH SIMPLE ON DELETE CASCADE ON UPDATE NO ACTION;
+EXCEPTION WHEN duplicate_object THEN NULL;
+END $$;
+
+DO $$
+BEGIN
+	ALTER TABLE public.delays ADD CONSTRAINT stop_id FOREIGN KEY (stop_id)
+		REFERENCES public.stops (id) MATCH SIMPLE ON DELETE CASCADE ON UPDATE NO ACTION;
+EXCEPTION WHEN duplicate_object THEN NULL;
+END $$;
+
+DO $$
+BEGIN
+	ALTER TABLE public.delays ADD CONSTRAINT line_id FOREIGN KEY (line_id)
+		REFERENCES public.lines (id) MATCH SIMPLE ON DELETE CASCADE ON UPDATE NO ACTION;
+EXCEPTION WHEN duplicate_object THEN NULL;
+END $$;
+
+DO $$
+BEGIN
+	ALTER TABLE public.occupancy ADD CONSTRAINT line_id FOREIGN KEY (line_id)
+		REFERENCES public.lines (id) MATCH SIMPLE ON DELETE RESTRICT ON UPDATE NO ACTION;
+EXCEPTION WHEN duplicate_object THEN NULL;
+END $$;
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS stops_set_geom ON public.stops;
+DROP FUNCTION IF EXISTS public.stops_set_geom();
+DROP INDEX IF EXISTS public.stops_geom_idx;
+ALTER TABLE public.stops DROP COLUMN IF EXISTS geom;
@@ -0,0 +1,25 @@
+-- The nearby and closest-stop queries run ST_DWithin and <-> on stops.geom,
+-- which the dump never created; databaseFiller.py added it ad hoc. A
+-- trigger keeps it in step with latitude/longitude from now on.
+
+CREATE EXTENSION IF NOT EXISTS postgis;
+
+ALTER TABLE public.stops ADD COLUMN IF NOT EXISTS geom geography(Point, 4326);
+
+UPDATE public.stops
+SET geom = ST_SetSRID(ST_MakePoint(longitude::double precision, latitude::double precision), 4326)::geography
+WHERE geom IS NULL;
+
+CREATE INDEX IF NOT EXISTS stops_geom_idx ON public.stops USING GIST (geom);
+
+CREATE OR REPLACE FUNCTION public.stops_set_geom() RETURNS trigger AS $$
+BEGIN
+	NEW.geom := ST_SetSRID(ST_MakePoint(NEW.longitude::double precision, NEW.latitude::double precision), 4326)::geography;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS stops_set_geom ON public.stops;
+CREATE TRIGGER stops_set_geom
+	BEFORE INSERT OR UPDATE OF latitude, longitude ON public.stops
+	FOR EACH ROW EXECUTE FUNCTION public.stops_set_geom();
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS public.api_key_usage;
+DROP TABLE IF EXISTS public.api_keys;
+ALTER TABLE public.users DROP COLUMN IF EXISTS role;
@@ -0,0 +1,24 @@
+ALTER TABLE public.users ADD COLUMN IF NOT EXISTS role character varying(20) NOT NULL DEFAULT 'user';
+
+CREATE TABLE IF NOT EXISTS public.api_keys (
+	id bigserial NOT NULL,
+	name character varying(100) NOT NULL,
+	prefix character varying(16) NOT NULL,
+	key_hash character(64) NOT NULL,
+	scopes text[] NOT NULL DEFAULT '{}',
+	daily_quota integer NOT NULL DEFAULT 0,
+	expires_at timestamp with time zone,
+	created_by integer REFERENCES public.users (id) ON DELETE SET NULL,
+	created_at timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	last_used_at timestamp with time zone,
+	revoked_at timestamp with time zone,
+	CONSTRAINT api_keys_pk PRIMARY KEY (id),
+	CONSTRAINT api_keys_hash_uq UNIQUE (key_hash)
+);
+
+CREATE TABLE IF NOT EXISTS public.api_key_usage (
+	api_key_id bigint NOT NULL REFERENCES public.api_keys (id) ON DELETE CASCADE,
+	day date NOT NULL,
+	requests bigint NOT NULL DEFAULT 0,
+	CONSTRAINT api_key_usage_pk PRIMARY KEY (api_key_id, day)
+);
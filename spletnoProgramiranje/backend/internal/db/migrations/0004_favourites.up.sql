@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS public.favourites (
+	id bigserial NOT NULL,
+	user_id integer NOT NULL REFERENCES public.users (id) ON DELETE CASCADE,
+	stop_id integer REFERENCES public.stops (id) ON DELETE CASCADE,
+	line_id integer REFERENCES public.lines (id) ON DELETE CASCADE,
+	position integer NOT NULL DEFAULT 0,
+	created_at timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	CONSTRAINT favourites_pk PRIMARY KEY (id),
+	CONSTRAINT favourites_target_ck CHECK (stop_id IS NOT NULL OR line_id IS NOT NULL),
+	CONSTRAINT favourites_uq UNIQUE NULLS NOT DISTINCT (user_id, stop_id, line_id)
+);
+
+CREATE INDEX IF NOT EXISTS favourites_user_idx ON public.favourites (user_id, position);
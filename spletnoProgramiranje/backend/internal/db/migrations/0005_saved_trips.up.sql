@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS public.saved_trips (
+	id bigserial NOT NULL,
+	user_id integer NOT NULL REFERENCES public.users (id) ON DELETE CASCADE,
+	name character varying(100) NOT NULL,
+	origin_stop_id integer NOT NULL REFERENCES public.stops (id) ON DELETE CASCADE,
+	destination_stop_id integer NOT NULL REFERENCES public.stops (id) ON DELETE CASCADE,
+	mode text NOT NULL,
+	"time" time NOT NULL,
+	weekdays text[] NOT NULL,
+	created_at timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	CONSTRAINT saved_trips_pk PRIMARY KEY (id),
+	CONSTRAINT saved_trips_mode_ck CHECK (mode IN ('depart_at', 'arrive_by')),
+	CONSTRAINT saved_trips_stops_ck CHECK (origin_stop_id <> destination_stop_id),
+	CONSTRAINT saved_trips_name_uq UNIQUE (user_id, name)
+);
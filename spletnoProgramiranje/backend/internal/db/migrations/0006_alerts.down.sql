@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS public.alert_cursor;
+DROP TABLE IF EXISTS public.alert_deliveries;
+DROP TABLE IF EXISTS public.alert_subscriptions;
+ALTER TABLE public.delays DROP COLUMN IF EXISTS reported_at;
@@ -0,0 +1,50 @@
+-- Delay reports only carried a calendar day; alert time windows need the
+-- moment a report came in.
+ALTER TABLE public.delays ADD COLUMN IF NOT EXISTS reported_at timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS public.alert_subscriptions (
+	id bigserial NOT NULL,
+	user_id integer NOT NULL REFERENCES public.users (id) ON DELETE CASCADE,
+	name character varying(100) NOT NULL,
+	line_id integer REFERENCES public.lines (id) ON DELETE CASCADE,
+	direction_id integer REFERENCES public.directions (id) ON DELETE CASCADE,
+	stop_id integer REFERENCES public.stops (id) ON DELETE CASCADE,
+	min_delay_min integer NOT NULL,
+	window_start time,
+	window_end time,
+	weekdays text[] NOT NULL DEFAULT '{}',
+	channel text NOT NULL,
+	target character varying(500) NOT NULL,
+	secret text NOT NULL,
+	created_at timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	CONSTRAINT alert_subscriptions_pk PRIMARY KEY (id),
+	CONSTRAINT alert_subscriptions_channel_ck CHECK (channel IN ('webhook', 'email')),
+	CONSTRAINT alert_subscriptions_window_ck CHECK ((window_start IS NULL) = (window_end IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS alert_subscriptions_user_idx ON public.alert_subscriptions (user_id);
+
+CREATE TABLE IF NOT EXISTS public.alert_deliveries (
+	id bigserial NOT NULL,
+	subscription_id bigint NOT NULL REFERENCES public.alert_subscriptions (id) ON DELETE CASCADE,
+	delay_id integer NOT NULL,
+	payload jsonb NOT NULL,
+	status text NOT NULL DEFAULT 'pending',
+	attempts integer NOT NULL DEFAULT 0,
+	last_error text NOT NULL DEFAULT '',
+	next_attempt_at timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	delivered_at timestamp with time zone,
+	created_at timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	CONSTRAINT alert_deliveries_pk PRIMARY KEY (id),
+	CONSTRAINT alert_deliveries_uq UNIQUE (subscription_id, delay_id)
+);
+
+CREATE INDEX IF NOT EXISTS alert_deliveries_due_idx ON public.alert_deliveries (next_attempt_at) WHERE status = 'pending';
+
+-- The single row records the last delay report the evaluator has matched.
+CREATE TABLE IF NOT EXISTS public.alert_cursor (
+	id integer NOT NULL DEFAULT 1,
+	last_delay_id integer NOT NULL,
+	CONSTRAINT alert_cursor_pk PRIMARY KEY (id),
+	CONSTRAINT alert_cursor_single_ck CHECK (id = 1)
+);
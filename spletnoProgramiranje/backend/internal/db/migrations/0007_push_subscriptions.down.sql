@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS public.push_cursor;
+DROP TABLE IF EXISTS public.push_subscriptions;
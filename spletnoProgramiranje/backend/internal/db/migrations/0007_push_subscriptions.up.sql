@@ -0,0 +1,25 @@
+-- A row per browser (or device) a user enabled push notifications on.
+-- p256dh and auth are the browser's encryption keys, base64url encoded.
+CREATE TABLE IF NOT EXISTS public.push_subscriptions (
+	id bigserial NOT NULL,
+	user_id integer NOT NULL REFERENCES public.users (id) ON DELETE CASCADE,
+	endpoint character varying(2000) NOT NULL,
+	p256dh text NOT NULL,
+	auth text NOT NULL,
+	user_agent character varying(300) NOT NULL DEFAULT '',
+	expires_at timestamp with time zone,
+	created_at timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	CONSTRAINT push_subscriptions_pk PRIMARY KEY (id),
+	CONSTRAINT push_subscriptions_endpoint_uq UNIQUE (endpoint)
+);
+
+CREATE INDEX IF NOT EXISTS push_subscriptions_user_idx ON public.push_subscriptions (user_id);
+
+-- The single row records the last delay report push notifications were sent
+-- for.
+CREATE TABLE IF NOT EXISTS public.push_cursor (
+	id integer NOT NULL DEFAULT 1,
+	last_delay_id integer NOT NULL,
+	CONSTRAINT push_cursor_pk PRIMARY KEY (id),
+	CONSTRAINT push_cursor_single_ck CHECK (id = 1)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS public.service_alert_entities;
+DROP TABLE IF EXISTS public.service_alerts;
@@ -0,0 +1,43 @@
+-- Service alerts announce planned and unplanned changes to service, such as
+-- a closed stop or a diverted line. Cause and effect follow the GTFS
+-- Realtime enums; header and description map language codes to text.
+CREATE TABLE IF NOT EXISTS public.service_alerts (
+	id bigserial NOT NULL,
+	cause text NOT NULL,
+	effect text NOT NULL,
+	header jsonb NOT NULL,
+	description jsonb NOT NULL DEFAULT '{}',
+	url character varying(500) NOT NULL DEFAULT '',
+	active_from timestamp with time zone NOT NULL,
+	active_until timestamp with time zone,
+	-- detour is the diverted path as [[lat, lon], ...], like routes.path.
+	detour jsonb,
+	created_at timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	CONSTRAINT service_alerts_pk PRIMARY KEY (id),
+	CONSTRAINT service_alerts_cause_ck CHECK (cause IN ('unknown_cause', 'other_cause', 'technical_problem',
+		'strike', 'demonstration', 'accident', 'holiday', 'weather', 'maintenance', 'construction',
+		'police_activity', 'medical_emergency')),
+	CONSTRAINT service_alerts_effect_ck CHECK (effect IN ('no_service', 'reduced_service', 'significant_delays',
+		'detour', 'additional_service', 'modified_service', 'other_effect', 'unknown_effect', 'stop_moved')),
+	CONSTRAINT service_alerts_window_ck CHECK (active_until IS NULL OR active_until > active_from)
+);
+
+CREATE INDEX IF NOT EXISTS service_alerts_window_idx ON public.service_alerts (active_from, active_until);
+
+-- The lines, directions and stops an alert is about. An entity with only a
+-- stop affects every line at the stop; one with a line and a stop affects
+-- just that line there.
+CREATE TABLE IF NOT EXISTS public.service_alert_entities (
+	id bigserial NOT NULL,
+	alert_id bigint NOT NULL REFERENCES public.service_alerts (id) ON DELETE CASCADE,
+	line_id integer REFERENCES public.lines (id) ON DELETE CASCADE,
+	direction_id integer REFERENCES public.directions (id) ON DELETE CASCADE,
+	stop_id integer REFERENCES public.stops (id) ON DELETE CASCADE,
+	CONSTRAINT service_alert_entities_pk PRIMARY KEY (id),
+	CONSTRAINT service_alert_entities_target_ck CHECK (line_id IS NOT NULL OR direction_id IS NOT NULL OR stop_id IS NOT NULL)
+);
+
+CREATE INDEX IF NOT EXISTS service_alert_entities_alert_idx ON public.service_alert_entities (alert_id);
+CREATE INDEX IF NOT EXISTS service_alert_entities_line_idx ON public.service_alert_entities (line_id);
+CREATE INDEX IF NOT EXISTS service_alert_entities_stop_idx ON public.service_alert_entities (stop_id);
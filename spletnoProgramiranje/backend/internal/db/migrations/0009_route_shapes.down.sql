@@ -0,0 +1 @@
+DROP TABLE IF EXISTS public.route_shapes;
@@ -0,0 +1,18 @@
+-- Route shapes are versions of a direction's path, valid between valid_from
+-- and valid_until (open-ended when NULL), so a roadworks detour can replace
+-- the usual path for a while. Where no shape is valid, the line's path in
+-- routes is used. When shapes overlap, the one starting latest wins.
+CREATE TABLE IF NOT EXISTS public.route_shapes (
+	id bigserial NOT NULL,
+	direction_id integer NOT NULL REFERENCES public.directions (id) ON DELETE CASCADE,
+	-- path is [[lat, lon], ...], like routes.path.
+	path jsonb NOT NULL,
+	valid_from timestamp with time zone,
+	valid_until timestamp with time zone,
+	note character varying(200) NOT NULL DEFAULT '',
+	created_at timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	CONSTRAINT route_shapes_pk PRIMARY KEY (id),
+	CONSTRAINT route_shapes_window_ck CHECK (valid_from IS NULL OR valid_until IS NULL OR valid_until > valid_from)
+);
+
+CREATE INDEX IF NOT EXISTS route_shapes_direction_idx ON public.route_shapes (direction_id, valid_from);
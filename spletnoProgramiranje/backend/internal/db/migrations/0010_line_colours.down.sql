@@ -0,0 +1 @@
+ALTER TABLE public.lines DROP COLUMN IF EXISTS colour;
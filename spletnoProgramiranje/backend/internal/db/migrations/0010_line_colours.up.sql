@@ -0,0 +1,4 @@
+-- colour is the line's brand colour as "#rrggbb", used to draw it on maps.
+-- Lines without one get a colour from a fixed palette by ID.
+ALTER TABLE public.lines ADD COLUMN IF NOT EXISTS colour character(7)
+	CONSTRAINT lines_colour_ck CHECK (colour ~ '^#[0-9a-f]{6}$');
@@ -0,0 +1,9 @@
+-- Stops are clustered into stations by name and distance. A station override
+-- puts a stop in the station of station_stop_id by hand instead; a stop
+-- overridden to itself is a station of its own.
+CREATE TABLE IF NOT EXISTS public.station_overrides (
+	stop_id integer NOT NULL REFERENCES public.stops (id) ON DELETE CASCADE,
+	station_stop_id integer NOT NULL REFERENCES public.stops (id) ON DELETE CASCADE,
+	updated_at timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	CONSTRAINT station_overrides_pk PRIMARY KEY (stop_id)
+);
@@ -0,0 +1 @@
+ALTER TABLE public.push_cursor DROP COLUMN IF EXISTS last_service_alert_id;
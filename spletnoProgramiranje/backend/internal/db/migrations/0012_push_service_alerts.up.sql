@@ -0,0 +1,3 @@
+-- The last service alert push notifications were sent for. It stays NULL
+-- until the push sender first claims it, which starts at the newest alert.
+ALTER TABLE public.push_cursor ADD COLUMN IF NOT EXISTS last_service_alert_id bigint;
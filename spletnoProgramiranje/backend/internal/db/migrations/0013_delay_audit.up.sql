@@ -0,0 +1,13 @@
+-- One row per change to a delay report, recording who made it: the user the
+-- report is filed under and the API key the request came with, if any.
+CREATE TABLE IF NOT EXISTS public.delay_audit (
+	id bigserial NOT NULL,
+	delay_id integer NOT NULL REFERENCES public.delays (id) ON DELETE CASCADE,
+	action character varying(20) NOT NULL,
+	user_id integer REFERENCES public.users (id) ON DELETE SET NULL,
+	api_key_id bigint REFERENCES public.api_keys (id) ON DELETE SET NULL,
+	created_at timestamp with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	CONSTRAINT delay_audit_pk PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS delay_audit_delay_idx ON public.delay_audit (delay_id);
@@ -0,0 +1,306 @@
+// Package migrations embeds the versioned SQL schema of the application and
+// applies it to Postgres.
+//
+// Every migration is a pair of files, NNNN_name.up.sql and
+// NNNN_name.down.sql, where NNNN is the version. Applied versions are
+// recorded in schema_migrations. Each migration runs in its own transaction
+// and all runs hold a session advisory lock, so several API instances
+// starting at once apply every migration exactly once.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+//go:embed *.sql
+var embedded embed.FS
+
+// lockID is the advisory lock key guarding schema changes.
+const lockID int64 = 7283451002
+
+// ErrPending is returned by RequireCurrent when migrations are outstanding.
+var ErrPending = errors.New("database schema is not up to date")
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a known migration and when it was applied, if it was.
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Load reads migrations from fsys and checks that versions are unique and
+// that every migration has both directions.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".sql" {
+			continue
+		}
+
+		m := fileName.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("migrations: unexpected file name %q", e.Name())
+		}
+
+		version, _ := strconv.ParseInt(m[1], 10, 64)
+		body, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migrations: version %d used by both %q and %q", version, mig.Name, m[2])
+		}
+
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migrations: %04d_%s needs both an up and a down file", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+	logger     *zap.SugaredLogger
+}
+
+// New returns a migrator for the migrations embedded in the binary.
+func New(db *sql.DB, logger *zap.SugaredLogger) (*Migrator, error) {
+	return NewFromFS(db, embedded, logger)
+}
+
+// NewFromFS returns a migrator for the migrations in fsys.
+func NewFromFS(db *sql.DB, fsys fs.FS, logger *zap.SugaredLogger) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations, logger: logger}, nil
+}
+
+// Migrations returns every known migration in order.
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+// Up applies every pending migration and returns how many ran.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	return m.withLock(ctx, func(conn *sql.Conn) (int, error) {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return 0, err
+		}
+
+		n := 0
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+
+			start := time.Now()
+			if err := m.run(ctx, conn, mig.Up, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, mig.Version, mig.Name); err != nil {
+				return n, fmt.Errorf("migrations: applying %04d_%s: %w", mig.Version, mig.Name, err)
+			}
+			m.logger.Infow("applied migration", "version", mig.Version, "name", mig.Name, "duration", time.Since(start))
+			n++
+		}
+
+		return n, nil
+	})
+}
+
+// Down reverts the most recent steps applied migrations and returns how
+// many were reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	return m.withLock(ctx, func(conn *sql.Conn) (int, error) {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return 0, err
+		}
+
+		n := 0
+		for i := len(m.migrations) - 1; i >= 0 && n < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+
+			if err := m.run(ctx, conn, mig.Down, `DELETE FROM schema_migrations WHERE version = $1`, mig.Version); err != nil {
+				return n, fmt.Errorf("migrations: reverting %04d_%s: %w", mig.Version, mig.Name, err)
+			}
+			m.logger.Infow("reverted migration", "version", mig.Version, "name", mig.Name)
+			n++
+		}
+
+		return n, nil
+	})
+}
+
+// Status reports every known migration and whether it has been applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := ensureTable(ctx, conn); err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]Status, len(m.migrations))
+	for i, mig := range m.migrations {
+		status[i].Migration = mig
+		if at, ok := applied[mig.Version]; ok {
+			status[i].AppliedAt = &at
+		}
+	}
+
+	return status, nil
+}
+
+// RequireCurrent returns ErrPending when a known migration has not been
+// applied. Servers started without auto-migration use it to refuse running
+// against a schema the storage code does not match.
+func (m *Migrator) RequireCurrent(ctx context.Context) error {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range status {
+		if s.AppliedAt == nil {
+			return fmt.Errorf("%w: %04d_%s is pending", ErrPending, s.Version, s.Name)
+		}
+	}
+
+	return nil
+}
+
+// withLock runs fn on a dedicated connection holding the migration lock.
+// Session advisory locks belong to a connection, so the lock, the work and
+// the unlock must all use the same one.
+func (m *Migrator) withLock(ctx context.Context, fn func(*sql.Conn) (int, error)) (int, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("migrations: acquiring connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		return 0, fmt.Errorf("migrations: acquiring lock: %w", err)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID); err != nil {
+			m.logger.Warnw("failed to release migration lock", "error", err)
+		}
+	}()
+
+	if err := ensureTable(ctx, conn); err != nil {
+		return 0, err
+	}
+
+	return fn(conn)
+}
+
+// run executes a migration body and its bookkeeping statement in one
+// transaction.
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, body, bookkeeping string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, body); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, bookkeeping, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func ensureTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version bigint PRIMARY KEY,
+			name text NOT NULL,
+			applied_at timestamp with time zone NOT NULL DEFAULT now()
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("migrations: creating schema_migrations: %w", err)
+	}
+	return nil
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("migrations: reading schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+
+	return applied, rows.Err()
+}
@@ -0,0 +1,73 @@
+package migrations
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddedMigrationsLoad(t *testing.T) {
+	migrations, err := Load(embedded)
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, m := range migrations {
+		assert.Equal(t, int64(i+1), m.Version, "versions should be contiguous")
+	}
+}
+
+func TestEmbeddedMigrationsCreateGeomColumn(t *testing.T) {
+	migrations, err := Load(embedded)
+	require.NoError(t, err)
+
+	found := false
+	for _, m := range migrations {
+		if m.Name == "stops_geom" {
+			found = true
+			assert.Contains(t, m.Up, "geom geography(Point, 4326)")
+		}
+	}
+	assert.True(t, found)
+}
+
+func TestLoadSortsByVersion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0010_b.up.sql":   {Data: []byte("SELECT 10")},
+		"0010_b.down.sql": {Data: []byte("SELECT -10")},
+		"0002_a.up.sql":   {Data: []byte("SELECT 2")},
+		"0002_a.down.sql": {Data: []byte("SELECT -2")},
+		"README.md":       {Data: []byte("ignored")},
+	}
+
+	migrations, err := Load(fsys)
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	assert.Equal(t, int64(2), migrations[0].Version)
+	assert.Equal(t, "SELECT -10", migrations[1].Down)
+}
+
+func TestLoadRejectsInvalidSets(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"missing down": {
+			"0001_a.up.sql": {Data: []byte("SELECT 1")},
+		},
+		"duplicate version": {
+			"0001_a.up.sql":   {Data: []byte("SELECT 1")},
+			"0001_a.down.sql": {Data: []byte("SELECT 1")},
+			"0001_b.up.sql":   {Data: []byte("SELECT 1")},
+			"0001_b.down.sql": {Data: []byte("SELECT 1")},
+		},
+		"bad name": {
+			"init.sql": {Data: []byte("SELECT 1")},
+		},
+	}
+
+	for name, fsys := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Load(fsys)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,79 @@
+// Package geo is the little WGS84 geometry the API does itself: distances
+// between points and projecting points onto paths. Paths are [lat, lon]
+// pairs, like Route.Path.
+//
+// Distances are haversine distances on a sphere, which is well within a
+// metre of the ellipsoid at city scale.
+package geo
+
+import "math"
+
+// EarthRadiusMeters is the mean Earth radius.
+const EarthRadiusMeters = 6371008.8
+
+func toRad(deg float64) float64 { return deg * math.Pi / 180 }
+
+// DistanceMeters is the haversine distance between two points.
+func DistanceMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * EarthRadiusMeters * math.Asin(math.Sqrt(a))
+}
+
+// LengthMeters is the length of a path.
+func LengthMeters(path [][]float64) float64 {
+	var length float64
+	for i := 1; i < len(path); i++ {
+		length += DistanceMeters(path[i-1][0], path[i-1][1], path[i][0], path[i][1])
+	}
+	return length
+}
+
+// Projection is the point of a path closest to another point.
+type Projection struct {
+	Lat, Lon float64
+	// AlongMeters is the distance along the path from its start.
+	AlongMeters float64
+	// OffsetMeters is the distance from the point to the path.
+	OffsetMeters float64
+}
+
+// Project returns the point of the path closest to (lat, lon). Each segment
+// is flattened around the point, which is exact enough for segments of a
+// few kilometres. It reports false for a path without points.
+func Project(path [][]float64, lat, lon float64) (Projection, bool) {
+	if len(path) == 0 {
+		return Projection{}, false
+	}
+
+	// Metres per degree around the point.
+	ky := EarthRadiusMeters * math.Pi / 180
+	kx := ky * math.Cos(toRad(lat))
+
+	best := Projection{Lat: path[0][0], Lon: path[0][1], OffsetMeters: DistanceMeters(lat, lon, path[0][0], path[0][1])}
+	var along float64
+
+	for i := 1; i < len(path); i++ {
+		a, b := path[i-1], path[i]
+		ax, ay := (a[1]-lon)*kx, (a[0]-lat)*ky
+		bx, by := (b[1]-lon)*kx, (b[0]-lat)*ky
+		dx, dy := bx-ax, by-ay
+
+		var t float64
+		if l2 := dx*dx + dy*dy; l2 > 0 {
+			t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/l2))
+		}
+
+		pLat, pLon := a[0]+t*(b[0]-a[0]), a[1]+t*(b[1]-a[1])
+		segment := DistanceMeters(a[0], a[1], b[0], b[1])
+		if offset := DistanceMeters(lat, lon, pLat, pLon); offset < best.OffsetMeters {
+			best = Projection{Lat: pLat, Lon: pLon, AlongMeters: along + t*segment, OffsetMeters: offset}
+		}
+		along += segment
+	}
+
+	return best, true
+}
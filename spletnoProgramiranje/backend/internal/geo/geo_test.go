@@ -0,0 +1,92 @@
+package geo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDistanceMeters(t *testing.T) {
+	// Glavni trg to the railway station in Maribor.
+	assert.InDelta(t, 990, DistanceMeters(46.5577, 15.6455, 46.5620, 15.6567), 10)
+	assert.Zero(t, DistanceMeters(46.5577, 15.6455, 46.5577, 15.6455))
+}
+
+func TestLengthMeters(t *testing.T) {
+	path := [][]float64{{46.5577, 15.6455}, {46.5620, 15.6567}, {46.5577, 15.6455}}
+	assert.InDelta(t, 2*DistanceMeters(46.5577, 15.6455, 46.5620, 15.6567), LengthMeters(path), 1e-6)
+	assert.Zero(t, LengthMeters(path[:1]))
+}
+
+func TestProject(t *testing.T) {
+	// Two segments along a parallel and then a meridian.
+	path := [][]float64{{46.55, 15.60}, {46.55, 15.62}, {46.57, 15.62}}
+	first := DistanceMeters(46.55, 15.60, 46.55, 15.62)
+
+	t.Run("onto a segment", func(t *testing.T) {
+		p, ok := Project(path, 46.551, 15.61)
+		require.True(t, ok)
+		assert.InDelta(t, 46.55, p.Lat, 1e-6)
+		assert.InDelta(t, 15.61, p.Lon, 1e-6)
+		assert.InDelta(t, first/2, p.AlongMeters, 1)
+		assert.InDelta(t, 111, p.OffsetMeters, 1)
+	})
+
+	t.Run("onto the second segment", func(t *testing.T) {
+		p, ok := Project(path, 46.56, 15.621)
+		require.True(t, ok)
+		assert.InDelta(t, 15.62, p.Lon, 1e-6)
+		assert.InDelta(t, first+DistanceMeters(46.55, 15.62, 46.56, 15.62), p.AlongMeters, 1)
+	})
+
+	t.Run("beyond the ends", func(t *testing.T) {
+		p, ok := Project(path, 46.55, 15.59)
+		require.True(t, ok)
+		assert.Equal(t, Projection{Lat: 46.55, Lon: 15.60, OffsetMeters: p.OffsetMeters}, p)
+
+		p, ok = Project(path, 46.58, 15.62)
+		require.True(t, ok)
+		assert.InDelta(t, LengthMeters(path), p.AlongMeters, 1e-6)
+	})
+
+	t.Run("single point and empty paths", func(t *testing.T) {
+		p, ok := Project(path[:1], 46.56, 15.60)
+		require.True(t, ok)
+		assert.Zero(t, p.AlongMeters)
+
+		_, ok = Project(nil, 46.56, 15.60)
+		assert.False(t, ok)
+	})
+}
+
+func TestFeatureCollection(t *testing.T) {
+	stop := NewFeature(1, Point(46.5577, 15.6455), map[string]any{"name": "Center"})
+	assert.Equal(t, []float64{15.6455, 46.5577}, stop.Geometry.Coordinates, "positions are lon, lat")
+	assert.Equal(t, []float64{15.6455, 46.5577, 15.6455, 46.5577}, stop.BBox)
+
+	route := NewFeature(2, LineString([][]float64{{46.5620, 15.6567}, {46.5625, 15.6400}}), nil)
+	assert.Equal(t, [][]float64{{15.6567, 46.5620}, {15.6400, 46.5625}}, route.Geometry.Coordinates)
+	assert.Equal(t, []float64{15.6400, 46.5620, 15.6567, 46.5625}, route.BBox)
+	assert.NotNil(t, route.Properties)
+
+	fc := NewFeatureCollection([]Feature{stop, route})
+	assert.Equal(t, "FeatureCollection", fc.Type)
+	assert.Equal(t, []float64{15.6400, 46.5577, 15.6567, 46.5625}, fc.BBox)
+
+	empty := NewFeatureCollection(nil)
+	assert.NotNil(t, empty.Features)
+	assert.Nil(t, empty.BBox)
+}
+
+func TestMultiPolygonBBox(t *testing.T) {
+	square := [][]float64{{15.64, 46.55}, {15.66, 46.55}, {15.66, 46.57}, {15.64, 46.57}, {15.64, 46.55}}
+	hole := [][]float64{{15.645, 46.555}, {15.645, 46.56}, {15.65, 46.56}, {15.645, 46.555}}
+	far := [][]float64{{15.70, 46.50}, {15.71, 46.50}, {15.71, 46.51}, {15.70, 46.50}}
+
+	f := NewFeature(nil, MultiPolygon([][][][]float64{{square, hole}, {far}}), nil)
+	assert.Equal(t, "MultiPolygon", f.Geometry.Type)
+	assert.Equal(t, []float64{15.64, 46.50, 15.71, 46.57}, f.BBox)
+
+	assert.NotNil(t, MultiPolygon(nil).Coordinates, "an empty area is an empty list")
+}
@@ -0,0 +1,116 @@
+package geo
+
+import "math"
+
+// GeoJSONContentType is the media type of GeoJSON documents (RFC 7946).
+const GeoJSONContentType = "application/geo+json"
+
+// Geometry is a GeoJSON geometry. Coordinates are [lon, lat], the other way
+// round from paths.
+type Geometry struct {
+	Type        string `json:"type"`
+	Coordinates any    `json:"coordinates"`
+}
+
+// Point returns a Point geometry.
+func Point(lat, lon float64) *Geometry {
+	return &Geometry{Type: "Point", Coordinates: []float64{lon, lat}}
+}
+
+// LineString returns a LineString geometry along the path.
+func LineString(path [][]float64) *Geometry {
+	coordinates := make([][]float64, 0, len(path))
+	for _, p := range path {
+		coordinates = append(coordinates, []float64{p[1], p[0]})
+	}
+	return &Geometry{Type: "LineString", Coordinates: coordinates}
+}
+
+// MultiPolygon returns a MultiPolygon geometry. Each polygon is a list of
+// closed rings of [lon, lat] positions: the exterior ring, counterclockwise,
+// and then any holes, clockwise.
+func MultiPolygon(polygons [][][][]float64) *Geometry {
+	if polygons == nil {
+		polygons = [][][][]float64{}
+	}
+	return &Geometry{Type: "MultiPolygon", Coordinates: polygons}
+}
+
+// positions returns the [lon, lat] positions of the geometry.
+func (g *Geometry) positions() [][]float64 {
+	switch c := g.Coordinates.(type) {
+	case []float64:
+		return [][]float64{c}
+	case [][]float64:
+		return c
+	case [][][][]float64:
+		var exteriors [][]float64
+		for _, polygon := range c {
+			if len(polygon) > 0 {
+				exteriors = append(exteriors, polygon[0]...)
+			}
+		}
+		return exteriors
+	}
+	return nil
+}
+
+// Feature is a GeoJSON Feature. A nil Geometry is written as null, as the
+// format requires.
+type Feature struct {
+	Type       string         `json:"type"`
+	ID         any            `json:"id,omitempty"`
+	BBox       []float64      `json:"bbox,omitempty"`
+	Geometry   *Geometry      `json:"geometry"`
+	Properties map[string]any `json:"properties"`
+}
+
+// NewFeature returns a feature with its bounding box filled in.
+func NewFeature(id any, g *Geometry, properties map[string]any) Feature {
+	if properties == nil {
+		properties = map[string]any{}
+	}
+	f := Feature{Type: "Feature", ID: id, Geometry: g, Properties: properties}
+	if g != nil {
+		f.BBox = bbox(g.positions())
+	}
+	return f
+}
+
+// FeatureCollection is a GeoJSON FeatureCollection.
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	BBox     []float64 `json:"bbox,omitempty"`
+	Features []Feature `json:"features"`
+}
+
+// NewFeatureCollection returns a collection of the features with the
+// bounding box of all of them.
+func NewFeatureCollection(features []Feature) *FeatureCollection {
+	if features == nil {
+		features = []Feature{}
+	}
+
+	var corners [][]float64
+	for _, f := range features {
+		if len(f.BBox) == 4 {
+			corners = append(corners, f.BBox[:2], f.BBox[2:])
+		}
+	}
+
+	return &FeatureCollection{Type: "FeatureCollection", BBox: bbox(corners), Features: features}
+}
+
+// bbox returns [west, south, east, north] of the positions, or nil when
+// there are none.
+func bbox(positions [][]float64) []float64 {
+	if len(positions) == 0 {
+		return nil
+	}
+	box := []float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, p := range positions {
+		box[0], box[1] = math.Min(box[0], p[0]), math.Min(box[1], p[1])
+		box[2], box[3] = math.Max(box[2], p[0]), math.Max(box[3], p[1])
+	}
+	return box
+}
@@ -0,0 +1,275 @@
+package isochrone
+
+import (
+	"backend/internal/geo"
+	"math"
+)
+
+const (
+	// cellMeters is the side of the grid cells areas are drawn on.
+	cellMeters = 50.0
+	// maxGridSide bounds the cells along a side of the grid; larger areas
+	// are drawn on coarser cells.
+	maxGridSide = 400
+)
+
+// circle is a disc in metres east and north of the query point.
+type circle struct {
+	x, y, radius float64
+}
+
+// vertex is a corner of the grid.
+type vertex struct {
+	c, r int
+}
+
+// Area outlines where the rider can be within budget seconds of setting
+// off: on foot from the query point, or on foot from a reached stop in the
+// time left there, each walk at most q.MaxWalk. The area is drawn on a grid
+// of cellMeters cells and returned as polygons of [lon, lat] rings for
+// geo.MultiPolygon.
+func Area(q Query, reached []Reach, budget int) [][][][]float64 {
+	metersPerLat := geo.EarthRadiusMeters * math.Pi / 180
+	metersPerLon := metersPerLat * math.Cos(q.Lat*math.Pi/180)
+
+	walkable := func(seconds int) float64 {
+		return math.Min(q.MaxWalk, float64(seconds)*q.WalkSpeed)
+	}
+
+	circles := []circle{{0, 0, walkable(budget)}}
+	for _, r := range reached {
+		left := q.Start + budget - r.Arrival
+		if left < 0 {
+			continue
+		}
+		circles = append(circles, circle{
+			x:      (r.Stop.Longitude - q.Lon) * metersPerLon,
+			y:      (r.Stop.Latitude - q.Lat) * metersPerLat,
+			radius: walkable(left),
+		})
+	}
+
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, c := range circles {
+		minX, minY = math.Min(minX, c.x-c.radius), math.Min(minY, c.y-c.radius)
+		maxX, maxY = math.Max(maxX, c.x+c.radius), math.Max(maxY, c.y+c.radius)
+	}
+	cell := math.Max(cellMeters, math.Max(maxX-minX, maxY-minY)/maxGridSide)
+
+	// A border of empty cells keeps the tracing clear of the grid's edges.
+	originX, originY := minX-cell, minY-cell
+	g := grid{
+		cols: int(math.Ceil((maxX-minX)/cell)) + 2,
+		rows: int(math.Ceil((maxY-minY)/cell)) + 2,
+	}
+	g.filled = make([]bool, g.cols*g.rows)
+
+	for _, c := range circles {
+		c0 := int((c.x - c.radius - originX) / cell)
+		c1 := int((c.x + c.radius - originX) / cell)
+		r0 := int((c.y - c.radius - originY) / cell)
+		r1 := int((c.y + c.radius - originY) / cell)
+		for r := max(r0, 1); r <= min(r1, g.rows-2); r++ {
+			for col := max(c0, 1); col <= min(c1, g.cols-2); col++ {
+				dx := originX + (float64(col)+0.5)*cell - c.x
+				dy := originY + (float64(r)+0.5)*cell - c.y
+				if dx*dx+dy*dy <= c.radius*c.radius {
+					g.filled[r*g.cols+col] = true
+				}
+			}
+		}
+	}
+
+	toLonLat := func(v vertex) []float64 {
+		x, y := originX+float64(v.c)*cell, originY+float64(v.r)*cell
+		return []float64{
+			math.Round((q.Lon+x/metersPerLon)*1e6) / 1e6,
+			math.Round((q.Lat+y/metersPerLat)*1e6) / 1e6,
+		}
+	}
+
+	polygons := [][][][]float64{}
+	for _, p := range g.polygons() {
+		polygon := make([][][]float64, 0, len(p))
+		for _, ring := range p {
+			positions := make([][]float64, 0, len(ring)+1)
+			for _, v := range ring {
+				positions = append(positions, toLonLat(v))
+			}
+			polygon = append(polygon, append(positions, positions[0]))
+		}
+		polygons = append(polygons, polygon)
+	}
+
+	return polygons
+}
+
+// grid is a raster of filled cells, row 0 southernmost.
+type grid struct {
+	cols, rows int
+	filled     []bool
+}
+
+func (g *grid) at(c, r int) bool {
+	return c >= 0 && c < g.cols && r >= 0 && r < g.rows && g.filled[r*g.cols+c]
+}
+
+// polygons traces the outlines of the filled cells. Each polygon is its
+// exterior ring, counterclockwise, followed by its holes, clockwise; rings
+// are open, without the first vertex repeated at the end.
+func (g *grid) polygons() [][][]vertex {
+	// Every side between a filled and an empty cell is an edge, directed so
+	// the filled cell is on its left.
+	out := map[vertex][]vertex{}
+	var starts []vertex
+	edge := func(a, b vertex) {
+		if len(out[a]) == 0 {
+			starts = append(starts, a)
+		}
+		out[a] = append(out[a], b)
+	}
+	for r := 0; r < g.rows; r++ {
+		for c := 0; c < g.cols; c++ {
+			if !g.at(c, r) {
+				continue
+			}
+			if !g.at(c, r-1) {
+				edge(vertex{c, r}, vertex{c + 1, r})
+			}
+			if !g.at(c+1, r) {
+				edge(vertex{c + 1, r}, vertex{c + 1, r + 1})
+			}
+			if !g.at(c, r+1) {
+				edge(vertex{c + 1, r + 1}, vertex{c, r + 1})
+			}
+			if !g.at(c-1, r) {
+				edge(vertex{c, r + 1}, vertex{c, r})
+			}
+		}
+	}
+
+	type ring struct {
+		vertices []vertex
+		area     float64
+		// insideX and insideY are a point just right of the first edge,
+		// which for a hole is inside it.
+		insideX, insideY float64
+	}
+	var exteriors, holes []ring
+
+	for _, start := range starts {
+		for len(out[start]) > 0 {
+			next := out[start][0]
+			out[start] = out[start][1:]
+
+			vertices := []vertex{start}
+			from, at := start, next
+			for {
+				// Back at the start, the ring closes unless the start is
+				// where two rings touch and this one carries on the other
+				// way.
+				if at == start && leftmost(from, at, append([]vertex{next}, out[at]...)) == 0 {
+					break
+				}
+				vertices = append(vertices, at)
+				candidates := out[at]
+				i := leftmost(from, at, candidates)
+				from, at = at, candidates[i]
+				out[from] = append(candidates[:i:i], candidates[i+1:]...)
+			}
+
+			dc, dr := float64(next.c-start.c), float64(next.r-start.r)
+			rg := ring{
+				vertices: simplify(vertices),
+				area:     signedArea(vertices),
+				insideX:  float64(start.c) + dc/2 + dr/2,
+				insideY:  float64(start.r) + dr/2 - dc/2,
+			}
+			if rg.area > 0 {
+				exteriors = append(exteriors, rg)
+			} else {
+				holes = append(holes, rg)
+			}
+		}
+	}
+
+	polygons := make([][][]vertex, len(exteriors))
+	for i, e := range exteriors {
+		polygons[i] = [][]vertex{e.vertices}
+	}
+	for _, h := range holes {
+		best := -1
+		for i, e := range exteriors {
+			if contains(e.vertices, h.insideX, h.insideY) && (best < 0 || e.area < exteriors[best].area) {
+				best = i
+			}
+		}
+		if best >= 0 {
+			polygons[best] = append(polygons[best], h.vertices)
+		}
+	}
+
+	return polygons
+}
+
+// leftmost picks the edge out of at that turns most to the left coming from
+// from. Where two filled cells touch only at a corner, that keeps them in
+// separate rings.
+func leftmost(from, at vertex, candidates []vertex) int {
+	dc, dr := at.c-from.c, at.r-from.r
+	best, bestRank := 0, 4
+	for i, to := range candidates {
+		ec, er := to.c-at.c, to.r-at.r
+		cross, dot := dc*er-dr*ec, dc*ec+dr*er
+		rank := 3
+		switch {
+		case cross > 0:
+			rank = 0
+		case cross == 0 && dot > 0:
+			rank = 1
+		case cross < 0:
+			rank = 2
+		}
+		if rank < bestRank {
+			best, bestRank = i, rank
+		}
+	}
+	return best
+}
+
+// simplify drops the vertices along straight runs of a ring.
+func simplify(ring []vertex) []vertex {
+	n := len(ring)
+	kept := make([]vertex, 0, n)
+	for i, v := range ring {
+		prev, next := ring[(i+n-1)%n], ring[(i+1)%n]
+		if (v.c-prev.c)*(next.r-v.r)-(v.r-prev.r)*(next.c-v.c) != 0 {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+// signedArea is positive for counterclockwise rings.
+func signedArea(ring []vertex) float64 {
+	var sum int
+	for i, v := range ring {
+		next := ring[(i+1)%len(ring)]
+		sum += v.c*next.r - next.c*v.r
+	}
+	return float64(sum) / 2
+}
+
+// contains reports whether the point is inside the ring, by ray casting.
+func contains(ring []vertex, x, y float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi := float64(ring[i].c), float64(ring[i].r)
+		xj, yj := float64(ring[j].c), float64(ring[j].r)
+		if (yi > y) != (yj > y) && x < (xj-xi)*(y-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
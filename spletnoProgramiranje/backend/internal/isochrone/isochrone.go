@@ -0,0 +1,201 @@
+// Package isochrone works out where a rider can get from a point within a
+// time budget, walking to a stop, riding buses of the day's timetable and
+// walking between stops, and outlines that area for maps.
+//
+// The timetable does not link the times of one bus across stops, so a bus
+// leaving a stop is taken to reach the direction's next stop at the first
+// time after it there, as Connection does. Riding on means taking the next
+// hop at the same time, so no transfer is assumed.
+package isochrone
+
+import (
+	"backend/internal/data"
+	"backend/internal/geo"
+	"maps"
+	"math"
+	"sort"
+)
+
+// maxHopSeconds bounds a hop between consecutive stops. Longer gaps mean the
+// bus that left the first stop does not call at the second one.
+const maxHopSeconds = 30 * 60
+
+// Query is a search from a point.
+type Query struct {
+	Lat, Lon float64
+	// Start is when the rider sets off, in seconds since midnight.
+	Start int
+	// Budget is the longest journey, in seconds.
+	Budget int
+	// WalkSpeed is in metres per second.
+	WalkSpeed float64
+	// MaxWalk caps each walk: to the first stop, between stops and away
+	// from the last one, in metres.
+	MaxWalk float64
+	// Stations maps stop IDs to their station's. Changing between stops of
+	// a station is free, however far apart they are.
+	Stations map[int]int
+}
+
+// sameStation reports whether two stops are poles of one station.
+func (q Query) sameStation(a, b int) bool {
+	station, ok := q.Stations[a]
+	return ok && station == q.Stations[b]
+}
+
+// Reach is a stop reached within the budget.
+type Reach struct {
+	Stop data.Stop
+	// Arrival is the earliest arrival, in seconds since midnight.
+	Arrival int
+	// Walked is whether the rider gets there on foot from the origin.
+	Walked bool
+}
+
+// hop is a bus ride between consecutive stops of a direction.
+type hop struct {
+	from, to        int
+	departs, arrive int
+}
+
+// hops turns the day's timetable into rides between consecutive stops of
+// each direction, in the order data.OrderDirectionStops gives.
+func hops(times []data.StopTimes) []hop {
+	byDirection := map[int][]data.StopTimes{}
+	for _, st := range times {
+		byDirection[st.DirectionID] = append(byDirection[st.DirectionID], st)
+	}
+
+	var hs []hop
+	for _, direction := range byDirection {
+		stops := data.OrderDirectionStops(direction)
+		for i := 1; i < len(stops); i++ {
+			from, to := stops[i-1], stops[i]
+			for _, departs := range from.Seconds {
+				j := sort.SearchInts(to.Seconds, departs+1)
+				if j == len(to.Seconds) || to.Seconds[j]-departs > maxHopSeconds {
+					continue
+				}
+				hs = append(hs, hop{from: from.StopID, to: to.StopID, departs: departs, arrive: to.Seconds[j]})
+			}
+		}
+	}
+
+	sort.Slice(hs, func(i, j int) bool {
+		if hs[i].departs != hs[j].departs {
+			return hs[i].departs < hs[j].departs
+		}
+		return hs[i].arrive < hs[j].arrive
+	})
+
+	return hs
+}
+
+// walkSeconds is how long walking the distance takes, rounded up.
+func walkSeconds(meters, speed float64) int {
+	return int(math.Ceil(meters / speed))
+}
+
+// Search returns the stops reachable within the budget, by earliest arrival
+// and then ID. It scans the day's hops in departure order, the Connection
+// Scan Algorithm, walking on to nearby stops and the station's other poles
+// whenever a stop is reached sooner.
+func Search(stops []data.Stop, times []data.StopTimes, q Query) []Reach {
+	end := q.Start + q.Budget
+
+	byID := make(map[int]data.Stop, len(stops))
+	for _, s := range stops {
+		byID[s.ID] = s
+	}
+
+	arrival := map[int]int{}
+	walked := map[int]bool{}
+	reach := func(id, at int) bool {
+		if at > end {
+			return false
+		}
+		if best, ok := arrival[id]; ok && best <= at {
+			return false
+		}
+		arrival[id] = at
+		return true
+	}
+
+	for _, s := range stops {
+		d := geo.DistanceMeters(q.Lat, q.Lon, s.Latitude, s.Longitude)
+		if d <= q.MaxWalk && reach(s.ID, q.Start+walkSeconds(d, q.WalkSpeed)) {
+			walked[s.ID] = true
+		}
+	}
+	// The other poles of a station walked to are as near.
+	for id, at := range maps.Clone(arrival) {
+		for _, s := range stops {
+			if q.sameStation(id, s.ID) && reach(s.ID, at) {
+				walked[s.ID] = true
+			}
+		}
+	}
+
+	// Walks between stops are worked out once per stop, when first needed.
+	type walk struct{ to, seconds int }
+	neighbours := map[int][]walk{}
+	walkFrom := func(id int) {
+		from := byID[id]
+		walks, ok := neighbours[id]
+		if !ok {
+			walks = []walk{}
+			for _, s := range stops {
+				if s.ID == id {
+					continue
+				}
+				if q.sameStation(id, s.ID) {
+					walks = append(walks, walk{s.ID, 0})
+					continue
+				}
+				d := geo.DistanceMeters(from.Latitude, from.Longitude, s.Latitude, s.Longitude)
+				if d <= q.MaxWalk {
+					walks = append(walks, walk{s.ID, walkSeconds(d, q.WalkSpeed)})
+				}
+			}
+			neighbours[id] = walks
+		}
+		for _, w := range walks {
+			if reach(w.to, arrival[id]+w.seconds) {
+				walked[w.to] = false
+			}
+		}
+	}
+
+	for _, h := range hops(times) {
+		if h.departs < q.Start {
+			continue
+		}
+		if h.departs > end {
+			break
+		}
+		if _, ok := byID[h.to]; !ok {
+			continue
+		}
+		at, ok := arrival[h.from]
+		if !ok || at > h.departs {
+			continue
+		}
+		if reach(h.to, h.arrive) {
+			walked[h.to] = false
+			walkFrom(h.to)
+		}
+	}
+
+	reached := make([]Reach, 0, len(arrival))
+	for id, at := range arrival {
+		reached = append(reached, Reach{Stop: byID[id], Arrival: at, Walked: walked[id]})
+	}
+	sort.Slice(reached, func(i, j int) bool {
+		if reached[i].Arrival != reached[j].Arrival {
+			return reached[i].Arrival < reached[j].Arrival
+		}
+		return reached[i].Stop.ID < reached[j].Stop.ID
+	})
+
+	return reached
+}
@@ -0,0 +1,179 @@
+package isochrone
+
+import (
+	"backend/internal/data"
+	"backend/internal/geo"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func clock(h, m int) int { return h*3600 + m*60 }
+
+var (
+	stopA = data.Stop{ID: 1, Name: "A", Latitude: 46.5577, Longitude: 15.6455}
+	stopB = data.Stop{ID: 2, Name: "B", Latitude: 46.5600, Longitude: 15.6500}
+	stopC = data.Stop{ID: 3, Name: "C", Latitude: 46.5620, Longitude: 15.6567}
+	// stopD is a short walk from C and served by no bus.
+	stopD = data.Stop{ID: 4, Name: "D", Latitude: 46.5640, Longitude: 15.6567}
+	stopE = data.Stop{ID: 5, Name: "E", Latitude: 46.6000, Longitude: 15.7000}
+
+	testStops = []data.Stop{stopA, stopB, stopC, stopD, stopE}
+	testTimes = []data.StopTimes{
+		{StopID: 3, LineID: 1, DirectionID: 1, Seconds: []int{clock(7, 50), clock(8, 10), clock(8, 40)}},
+		{StopID: 1, LineID: 1, DirectionID: 1, Seconds: []int{clock(7, 40), clock(8, 0), clock(8, 30)}},
+		{StopID: 2, LineID: 1, DirectionID: 1, Seconds: []int{clock(7, 45), clock(8, 5), clock(8, 35)}},
+		// Direction 2 reaches E from C only after a gap too long to be
+		// the same bus.
+		{StopID: 3, LineID: 2, DirectionID: 2, Seconds: []int{clock(8, 11)}},
+		{StopID: 5, LineID: 2, DirectionID: 2, Seconds: []int{clock(9, 0)}},
+	}
+)
+
+// testQuery sets off 100 m north of A at 7:58.
+func testQuery(budgetMinutes int) Query {
+	return Query{
+		Lat: 46.5586, Lon: 15.6455,
+		Start:     clock(7, 58),
+		Budget:    budgetMinutes * 60,
+		WalkSpeed: 1.25,
+		MaxWalk:   300,
+	}
+}
+
+func TestSearch(t *testing.T) {
+	q := testQuery(15)
+	reached := Search(testStops, testTimes, q)
+
+	walkToA := walkSeconds(geo.DistanceMeters(q.Lat, q.Lon, stopA.Latitude, stopA.Longitude), q.WalkSpeed)
+	walkCToD := walkSeconds(geo.DistanceMeters(stopC.Latitude, stopC.Longitude, stopD.Latitude, stopD.Longitude), q.WalkSpeed)
+	require.Less(t, clock(8, 10)+walkCToD, clock(8, 13))
+
+	assert.Equal(t, []Reach{
+		{Stop: stopA, Arrival: q.Start + walkToA, Walked: true},
+		{Stop: stopB, Arrival: clock(8, 5)},
+		{Stop: stopC, Arrival: clock(8, 10)},
+		{Stop: stopD, Arrival: clock(8, 10) + walkCToD},
+	}, reached)
+}
+
+func TestSearchStationTransfersAreFree(t *testing.T) {
+	q := testQuery(15)
+	// C and D are poles of one station, and so, however far apart, are A
+	// and E.
+	q.Stations = map[int]int{1: 1, 5: 1, 3: 3, 4: 3}
+	reached := Search(testStops, testTimes, q)
+
+	walkToA := walkSeconds(geo.DistanceMeters(q.Lat, q.Lon, stopA.Latitude, stopA.Longitude), q.WalkSpeed)
+	assert.Equal(t, []Reach{
+		{Stop: stopA, Arrival: q.Start + walkToA, Walked: true},
+		{Stop: stopE, Arrival: q.Start + walkToA, Walked: true},
+		{Stop: stopB, Arrival: clock(8, 5)},
+		{Stop: stopC, Arrival: clock(8, 10)},
+		{Stop: stopD, Arrival: clock(8, 10)},
+	}, reached)
+}
+
+func TestSearchWithinBudget(t *testing.T) {
+	reached := Search(testStops, testTimes, testQuery(12))
+
+	ids := make([]int, len(reached))
+	for i, r := range reached {
+		ids[i] = r.Stop.ID
+	}
+	assert.Equal(t, []int{1, 2, 3}, ids, "D is a walk past the budget")
+
+	reached = Search(testStops, testTimes, testQuery(1))
+	assert.Empty(t, reached, "A is further than a minute's walk")
+}
+
+func TestHopsSkipLongGaps(t *testing.T) {
+	for _, h := range hops(testTimes) {
+		assert.NotEqual(t, 5, h.to)
+	}
+	assert.Len(t, hops(testTimes), 6)
+}
+
+func TestArea(t *testing.T) {
+	q := testQuery(10)
+	polygons := Area(q, nil, q.Budget)
+
+	require.Len(t, polygons, 1)
+	require.Len(t, polygons[0], 1, "a disc has no holes")
+	ring := polygons[0][0]
+	assert.Equal(t, ring[0], ring[len(ring)-1], "rings are closed")
+
+	box := geo.NewFeature(nil, geo.MultiPolygon(polygons), nil).BBox
+	width := geo.DistanceMeters(q.Lat, box[0], q.Lat, box[2])
+	assert.InDelta(t, 2*q.MaxWalk, width, 2*cellMeters, "ten minutes' walk is past MaxWalk")
+
+	var area float64
+	for i := 1; i < len(ring); i++ {
+		area += ring[i-1][0]*ring[i][1] - ring[i][0]*ring[i-1][1]
+	}
+	assert.Positive(t, area, "exterior rings are counterclockwise")
+}
+
+func TestAreaAroundReachedStops(t *testing.T) {
+	q := testQuery(15)
+	reached := Search(testStops, testTimes, q)
+
+	polygons := Area(q, reached, q.Budget)
+	require.NotEmpty(t, polygons)
+
+	box := geo.NewFeature(nil, geo.MultiPolygon(polygons), nil).BBox
+	assert.Greater(t, box[3], stopC.Latitude, "the area reaches past C")
+	assert.Less(t, box[3], stopE.Latitude)
+
+	five := Area(q, reached, 5*60)
+	fiveBox := geo.NewFeature(nil, geo.MultiPolygon(five), nil).BBox
+	assert.Less(t, fiveBox[3], stopD.Latitude, "five minutes in, nobody is on the bus yet")
+}
+
+func TestGridPolygons(t *testing.T) {
+	parse := func(rows ...string) *grid {
+		g := &grid{cols: len(rows[0]), rows: len(rows)}
+		g.filled = make([]bool, g.cols*g.rows)
+		for i, row := range rows {
+			r := len(rows) - 1 - i // rows are drawn north up
+			for c, ch := range row {
+				g.filled[r*g.cols+c] = ch == '#'
+			}
+		}
+		return g
+	}
+
+	t.Run("hole", func(t *testing.T) {
+		polygons := parse(
+			".....",
+			".###.",
+			".#.#.",
+			".###.",
+			".....",
+		).polygons()
+
+		require.Len(t, polygons, 1)
+		require.Len(t, polygons[0], 2)
+		assert.Equal(t, []vertex{{1, 1}, {4, 1}, {4, 4}, {1, 4}}, polygons[0][0])
+		assert.Len(t, polygons[0][1], 4)
+		assert.Negative(t, signedArea(polygons[0][1]), "holes are clockwise")
+	})
+
+	t.Run("cells touching at a corner", func(t *testing.T) {
+		polygons := parse(
+			"....",
+			"..#.",
+			".#..",
+			"....",
+		).polygons()
+
+		require.Len(t, polygons, 2)
+		for _, p := range polygons {
+			require.Len(t, p, 1)
+			assert.Len(t, p[0], 4)
+			assert.InDelta(t, 1, math.Abs(signedArea(p[0])), 0)
+		}
+	})
+}
@@ -0,0 +1,91 @@
+// Package logging builds the application's zap logger and carries
+// request-scoped loggers through context.Context, so that every log line
+// written while serving a request, including those from the storage layer,
+// is tagged with the request ID, trace ID, route and user.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Config selects the level and encoding of the root logger.
+type Config struct {
+	// Level is one of debug, info, warn, error. Empty means info.
+	Level string
+	// Format is json or console. Empty picks console in development and
+	// json everywhere else.
+	Format string
+	// Development enables stack traces on warnings and caller-friendly
+	// output.
+	Development bool
+}
+
+// New builds the root logger described by cfg.
+func New(cfg Config) (*zap.SugaredLogger, error) {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	zcfg := zap.NewProductionConfig()
+	if cfg.Development {
+		zcfg = zap.NewDevelopmentConfig()
+	}
+	zcfg.Level = zap.NewAtomicLevelAt(level)
+	zcfg.EncoderConfig.TimeKey = "ts"
+	zcfg.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+
+	switch strings.ToLower(cfg.Format) {
+	case "":
+	case "json", "console":
+		zcfg.Encoding = strings.ToLower(cfg.Format)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+
+	logger, err := zcfg.Build()
+	if err != nil {
+		return nil, fmt.Errorf("building logger: %w", err)
+	}
+
+	return logger.Sugar(), nil
+}
+
+// ParseLevel converts a textual level to a zap level. Empty means info.
+func ParseLevel(s string) (zapcore.Level, error) {
+	if s == "" {
+		return zapcore.InfoLevel, nil
+	}
+
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(strings.ToLower(s))); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", s)
+	}
+	return level, nil
+}
+
+type loggerKey struct{}
+
+// WithLogger returns a copy of ctx carrying logger.
+func WithLogger(ctx context.Context, logger *zap.SugaredLogger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger stored in ctx, or fallback when there is
+// none.
+func FromContext(ctx context.Context, fallback *zap.SugaredLogger) *zap.SugaredLogger {
+	if logger, ok := ctx.Value(loggerKey{}).(*zap.SugaredLogger); ok {
+		return logger
+	}
+	return fallback
+}
+
+// With adds key/value pairs to the logger in ctx and returns the new context.
+func With(ctx context.Context, fallback *zap.SugaredLogger, args ...any) context.Context {
+	return WithLogger(ctx, FromContext(ctx, fallback).With(args...))
+}
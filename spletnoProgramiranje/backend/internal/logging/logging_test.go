@@ -0,0 +1,46 @@
+package logging
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("")
+	require.NoError(t, err)
+	assert.Equal(t, zapcore.InfoLevel, level)
+
+	level, err = ParseLevel("DEBUG")
+	require.NoError(t, err)
+	assert.Equal(t, zapcore.DebugLevel, level)
+
+	_, err = ParseLevel("loud")
+	assert.Error(t, err)
+}
+
+func TestNewRejectsUnknownFormat(t *testing.T) {
+	_, err := New(Config{Format: "xml"})
+	assert.Error(t, err)
+}
+
+func TestContextLogger(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	root := zap.New(core).Sugar()
+
+	assert.Same(t, root, FromContext(context.Background(), root))
+
+	ctx := With(context.Background(), root, "request_id", "abc")
+	ctx = With(ctx, root, "user_id", 7)
+	FromContext(ctx, root).Infow("hello")
+
+	require.Equal(t, 1, logs.Len())
+	fields := logs.All()[0].ContextMap()
+	assert.Equal(t, "abc", fields["request_id"])
+	assert.EqualValues(t, 7, fields["user_id"])
+}
@@ -0,0 +1,27 @@
+package metrics
+
+import "database/sql"
+
+// RegisterDBStats exposes the connection pool statistics of db on the
+// default registry. The values are read from db.Stats() on every scrape.
+func RegisterDBStats(db *sql.DB) {
+	gauges := []GaugeFunc{
+		{"mbusi_db_max_open_connections", "Maximum number of open connections to the database (DB_MAX_OPEN_CONNS).", func() float64 { return float64(db.Stats().MaxOpenConnections) }},
+		{"mbusi_db_open_connections", "Number of established connections, both in use and idle.", func() float64 { return float64(db.Stats().OpenConnections) }},
+		{"mbusi_db_in_use_connections", "Number of connections currently in use.", func() float64 { return float64(db.Stats().InUse) }},
+		{"mbusi_db_idle_connections", "Number of idle connections.", func() float64 { return float64(db.Stats().Idle) }},
+	}
+	for _, g := range gauges {
+		MustRegister(g)
+	}
+
+	counters := []CounterFunc{
+		{"mbusi_db_wait_count_total", "Total number of connections waited for because the pool was exhausted.", func() float64 { return float64(db.Stats().WaitCount) }},
+		{"mbusi_db_wait_duration_seconds_total", "Total time blocked waiting for a new connection.", func() float64 { return db.Stats().WaitDuration.Seconds() }},
+		{"mbusi_db_max_idle_closed_total", "Total number of connections closed due to DB_MAX_IDLE_CONNS.", func() float64 { return float64(db.Stats().MaxIdleClosed) }},
+		{"mbusi_db_max_idle_time_closed_total", "Total number of connections closed due to DB_MAX_IDLE_TIME.", func() float64 { return float64(db.Stats().MaxIdleTimeClosed) }},
+	}
+	for _, c := range counters {
+		MustRegister(c)
+	}
+}
@@ -0,0 +1,442 @@
+// Package metrics is a small Prometheus-compatible instrumentation library.
+// It supports counters, gauges and histograms with labels, plus collectors
+// that are evaluated at scrape time, and renders them in the Prometheus text
+// exposition format (version 0.0.4).
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are latency buckets in seconds suited to HTTP handlers.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Sample is a single value reported by a Collector.
+type Sample struct {
+	Labels map[string]string
+	Value  float64
+}
+
+// Collector produces samples on demand, for values owned by someone else
+// such as sql.DB.Stats().
+type Collector interface {
+	Describe() (name, help, kind string)
+	Collect() []Sample
+}
+
+type metric interface {
+	write(w io.Writer)
+	metricName() string
+}
+
+// Registry holds the metrics exposed by a Handler.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+	names   map[string]struct{}
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]struct{})}
+}
+
+// Default is the registry used by the package level constructors.
+var Default = NewRegistry()
+
+func (reg *Registry) register(m metric) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if _, ok := reg.names[m.metricName()]; ok {
+		panic("metrics: duplicate metric " + m.metricName())
+	}
+	reg.names[m.metricName()] = struct{}{}
+	reg.metrics = append(reg.metrics, m)
+}
+
+// MustRegister adds a scrape-time collector to the registry.
+func (reg *Registry) MustRegister(c Collector) {
+	reg.register(&collectorMetric{c})
+}
+
+// Write renders every registered metric in the text exposition format.
+func (reg *Registry) Write(w io.Writer) {
+	reg.mu.Lock()
+	metrics := append([]metric(nil), reg.metrics...)
+	reg.mu.Unlock()
+
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].metricName() < metrics[j].metricName() })
+
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// Handler serves the registry for Prometheus scrapes.
+func (reg *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		reg.Write(w)
+	})
+}
+
+// Handler serves the default registry.
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+// MustRegister adds a collector to the default registry.
+func MustRegister(c Collector) {
+	Default.MustRegister(c)
+}
+
+// vec holds one value per distinct combination of label values.
+type vec[T any] struct {
+	name   string
+	help   string
+	labels []string
+
+	mu       sync.Mutex
+	children map[string]*child[T]
+	newChild func() *T
+}
+
+type child[T any] struct {
+	values []string
+	v      *T
+}
+
+func newVec[T any](name, help string, labels []string, newChild func() *T) *vec[T] {
+	return &vec[T]{
+		name:     name,
+		help:     help,
+		labels:   labels,
+		children: make(map[string]*child[T]),
+		newChild: newChild,
+	}
+}
+
+func (v *vec[T]) with(values ...string) *T {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.child(values)
+}
+
+// child returns the value for the label values, creating it if needed. The
+// caller holds v.mu.
+func (v *vec[T]) child(values []string) *T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+
+	c, ok := v.children[key]
+	if !ok {
+		c = &child[T]{values: append([]string(nil), values...), v: v.newChild()}
+		v.children[key] = c
+	}
+	return c.v
+}
+
+func (v *vec[T]) delete(values ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.children, strings.Join(values, "\xff"))
+}
+
+func (v *vec[T]) sorted() []*child[T] {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	out := make([]*child[T], 0, len(v.children))
+	for _, c := range v.children {
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return strings.Join(out[i].values, "\xff") < strings.Join(out[j].values, "\xff")
+	})
+	return out
+}
+
+func (v *vec[T]) metricName() string { return v.name }
+
+func (v *vec[T]) header(w io.Writer, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, escapeHelp(v.help), v.name, kind)
+}
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	mu sync.Mutex
+	v  float64
+}
+
+func (c *Counter) Inc() { c.Add(1) }
+
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.mu.Lock()
+	c.v += delta
+	c.mu.Unlock()
+}
+
+func (c *Counter) value() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.v
+}
+
+type CounterVec struct{ *vec[Counter] }
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	cv := &CounterVec{newVec(name, help, labels, func() *Counter { return &Counter{} })}
+	Default.register(cv)
+	return cv
+}
+
+func (cv *CounterVec) With(values ...string) *Counter { return cv.with(values...) }
+
+func (cv *CounterVec) write(w io.Writer) {
+	cv.header(w, "counter")
+	for _, c := range cv.sorted() {
+		writeSample(w, cv.name, cv.labels, c.values, c.v.value())
+	}
+}
+
+// NewCounter registers a counter without labels.
+func NewCounter(name, help string) *Counter {
+	return NewCounterVec(name, help).With()
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	mu sync.Mutex
+	v  float64
+}
+
+func (g *Gauge) Set(v float64) {
+	g.mu.Lock()
+	g.v = v
+	g.mu.Unlock()
+}
+
+func (g *Gauge) Add(delta float64) {
+	g.mu.Lock()
+	g.v += delta
+	g.mu.Unlock()
+}
+
+func (g *Gauge) Inc() { g.Add(1) }
+func (g *Gauge) Dec() { g.Add(-1) }
+
+func (g *Gauge) value() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.v
+}
+
+type GaugeVec struct{ *vec[Gauge] }
+
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	gv := &GaugeVec{newVec(name, help, labels, func() *Gauge { return &Gauge{} })}
+	Default.register(gv)
+	return gv
+}
+
+func (gv *GaugeVec) With(values ...string) *Gauge { return gv.with(values...) }
+
+// Delete drops the series for the given label values, so that gauges for
+// short-lived label values (such as a line with no viewers) do not linger.
+func (gv *GaugeVec) Delete(values ...string) { gv.delete(values...) }
+
+// Acquire increments the series for the given label values. Pair it with
+// Release for gauges counting open things, such as connections.
+func (gv *GaugeVec) Acquire(values ...string) {
+	gv.mu.Lock()
+	defer gv.mu.Unlock()
+	gv.child(values).Inc()
+}
+
+// Release decrements the series for the given label values and deletes it
+// once it reaches zero. Both happen under the vector's lock, so a
+// concurrent Acquire never increments a series that is being deleted.
+func (gv *GaugeVec) Release(values ...string) {
+	gv.mu.Lock()
+	defer gv.mu.Unlock()
+
+	g := gv.child(values)
+	g.Dec()
+	if g.value() <= 0 {
+		delete(gv.children, strings.Join(values, "\xff"))
+	}
+}
+
+func (gv *GaugeVec) write(w io.Writer) {
+	gv.header(w, "gauge")
+	for _, c := range gv.sorted() {
+		writeSample(w, gv.name, gv.labels, c.values, c.v.value())
+	}
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+type HistogramVec struct {
+	*vec[Histogram]
+	buckets []float64
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	hv := &HistogramVec{
+		vec: newVec(name, help, labels, func() *Histogram {
+			return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+		}),
+		buckets: buckets,
+	}
+	Default.register(hv)
+	return hv
+}
+
+func (hv *HistogramVec) With(values ...string) *Histogram { return hv.with(values...) }
+
+// NewHistogram registers a histogram without labels.
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	return NewHistogramVec(name, help, buckets).With()
+}
+
+func (hv *HistogramVec) write(w io.Writer) {
+	hv.header(w, "histogram")
+
+	labels := append(append([]string(nil), hv.labels...), "le")
+	for _, c := range hv.sorted() {
+		h := c.v
+		h.mu.Lock()
+		for i, b := range h.buckets {
+			writeSample(w, hv.name+"_bucket", labels, append(append([]string(nil), c.values...), formatFloat(b)), float64(h.counts[i]))
+		}
+		writeSample(w, hv.name+"_bucket", labels, append(append([]string(nil), c.values...), "+Inf"), float64(h.count))
+		writeSample(w, hv.name+"_sum", hv.labels, c.values, h.sum)
+		writeSample(w, hv.name+"_count", hv.labels, c.values, float64(h.count))
+		h.mu.Unlock()
+	}
+}
+
+type collectorMetric struct{ c Collector }
+
+func (cm *collectorMetric) metricName() string {
+	name, _, _ := cm.c.Describe()
+	return name
+}
+
+func (cm *collectorMetric) write(w io.Writer) {
+	name, help, kind := cm.c.Describe()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, kind)
+
+	for _, s := range cm.c.Collect() {
+		keys := make([]string, 0, len(s.Labels))
+		for k := range s.Labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		values := make([]string, len(keys))
+		for i, k := range keys {
+			values[i] = s.Labels[k]
+		}
+		writeSample(w, name, keys, values, s.Value)
+	}
+}
+
+// GaugeFunc is a Collector reporting a single unlabeled gauge value.
+type GaugeFunc struct {
+	Name, Help string
+	Fn         func() float64
+}
+
+func (g GaugeFunc) Describe() (string, string, string) { return g.Name, g.Help, "gauge" }
+func (g GaugeFunc) Collect() []Sample                  { return []Sample{{Value: g.Fn()}} }
+
+// CounterFunc is a Collector reporting a single unlabeled counter value.
+type CounterFunc struct {
+	Name, Help string
+	Fn         func() float64
+}
+
+func (c CounterFunc) Describe() (string, string, string) { return c.Name, c.Help, "counter" }
+func (c CounterFunc) Collect() []Sample                  { return []Sample{{Value: c.Fn()}} }
+
+func writeSample(w io.Writer, name string, labels, values []string, v float64) {
+	var b strings.Builder
+	b.WriteString(name)
+
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(l)
+			b.WriteString(`="`)
+			b.WriteString(escapeLabel(values[i]))
+			b.WriteByte('"')
+		}
+		b.WriteByte('}')
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(formatFloat(v))
+	b.WriteByte('\n')
+
+	io.WriteString(w, b.String())
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
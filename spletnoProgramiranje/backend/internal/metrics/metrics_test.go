@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func scrape(t *testing.T) string {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", w.Header().Get("Content-Type"))
+	return w.Body.String()
+}
+
+func TestCounterVecExposition(t *testing.T) {
+	c := NewCounterVec("test_requests_total", "Test requests.", "route", "status")
+	c.With("/v1/x", "200").Inc()
+	c.With("/v1/x", "200").Add(2)
+	c.With(`a"b`, "500").Inc()
+
+	out := scrape(t)
+
+	assert.Contains(t, out, "# HELP test_requests_total Test requests.\n# TYPE test_requests_total counter\n")
+	assert.Contains(t, out, `test_requests_total{route="/v1/x",status="200"} 3`+"\n")
+	assert.Contains(t, out, `test_requests_total{route="a\"b",status="500"} 1`+"\n")
+}
+
+func TestGaugeVecDelete(t *testing.T) {
+	g := NewGaugeVec("test_connections", "Test connections.", "line")
+	g.With("6").Inc()
+	g.With("6").Inc()
+	g.With("7").Inc()
+	g.With("7").Dec()
+	g.Delete("7")
+
+	out := scrape(t)
+
+	assert.Contains(t, out, `test_connections{line="6"} 2`)
+	assert.NotContains(t, out, `test_connections{line="7"}`)
+}
+
+func TestGaugeVecRelease(t *testing.T) {
+	g := NewGaugeVec("test_streams", "Test streams.", "line")
+	g.Acquire("6")
+	g.Acquire("6")
+	g.Acquire("7")
+	g.Release("6")
+	g.Release("7")
+
+	out := scrape(t)
+
+	assert.Contains(t, out, `test_streams{line="6"} 1`)
+	assert.NotContains(t, out, `test_streams{line="7"}`, "a series at zero is dropped")
+}
+
+func TestHistogramExposition(t *testing.T) {
+	h := NewHistogram("test_latency_seconds", "Test latency.", []float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(3)
+
+	out := scrape(t)
+
+	assert.Contains(t, out, `test_latency_seconds_bucket{le="0.1"} 1`)
+	assert.Contains(t, out, `test_latency_seconds_bucket{le="1"} 2`)
+	assert.Contains(t, out, `test_latency_seconds_bucket{le="+Inf"} 3`)
+	assert.Contains(t, out, "test_latency_seconds_sum 3.55\n")
+	assert.Contains(t, out, "test_latency_seconds_count 3\n")
+}
+
+func TestGaugeFuncCollector(t *testing.T) {
+	MustRegister(GaugeFunc{Name: "test_pool_size", Help: "Test pool.", Fn: func() float64 { return 42 }})
+
+	out := scrape(t)
+
+	assert.True(t, strings.Contains(out, "# TYPE test_pool_size gauge\ntest_pool_size 42\n"))
+}
+
+func TestDuplicateRegistrationPanics(t *testing.T) {
+	NewCounter("test_duplicate_total", "First.")
+	assert.Panics(t, func() { NewCounter("test_duplicate_total", "Second.") })
+}
@@ -0,0 +1,89 @@
+package mvt
+
+import "math"
+
+// Contains reports whether a point in tile coordinates lies on the tile or
+// within buffer of its edges.
+func Contains(x, y, buffer float64) bool {
+	return x >= -buffer && x <= Extent+buffer && y >= -buffer && y <= Extent+buffer
+}
+
+// ClipLine clips a line in tile coordinates to the tile grown by buffer on
+// every side. A line that leaves the tile and comes back is split into one
+// part per visit. Points are rounded to whole coordinates, and repeats that
+// rounding creates at low zoom levels are dropped.
+func ClipLine(line [][2]float64, buffer float64) [][]Point {
+	var (
+		parts   [][]Point
+		current []Point
+	)
+	flush := func() {
+		if len(current) >= 2 {
+			parts = append(parts, current)
+		}
+		current = nil
+	}
+	add := func(x, y float64) {
+		p := Point{int(math.Round(x)), int(math.Round(y))}
+		if n := len(current); n > 0 && current[n-1] == p {
+			return
+		}
+		current = append(current, p)
+	}
+
+	lo, hi := -buffer, Extent+buffer
+	for i := 1; i < len(line); i++ {
+		a, b := line[i-1], line[i]
+		t0, t1, ok := clipSegment(a, b, lo, hi)
+		if !ok {
+			flush()
+			continue
+		}
+		dx, dy := b[0]-a[0], b[1]-a[1]
+		if t0 > 0 {
+			flush()
+		}
+		add(a[0]+t0*dx, a[1]+t0*dy)
+		add(a[0]+t1*dx, a[1]+t1*dy)
+		if t1 < 1 {
+			flush()
+		}
+	}
+	flush()
+
+	return parts
+}
+
+// clipSegment finds the part of the segment from a to b inside the square
+// [lo, hi]², as the interval [t0, t1] of its parameter, using the
+// Liang-Barsky algorithm.
+func clipSegment(a, b [2]float64, lo, hi float64) (t0, t1 float64, ok bool) {
+	t0, t1 = 0, 1
+	dx, dy := b[0]-a[0], b[1]-a[1]
+
+	for _, edge := range [4][2]float64{
+		{-dx, a[0] - lo},
+		{dx, hi - a[0]},
+		{-dy, a[1] - lo},
+		{dy, hi - a[1]},
+	} {
+		p, q := edge[0], edge[1]
+		if p == 0 {
+			if q < 0 {
+				return 0, 0, false
+			}
+			continue
+		}
+		t := q / p
+		if p < 0 {
+			t0 = math.Max(t0, t)
+		} else {
+			t1 = math.Min(t1, t)
+		}
+		if t0 > t1 {
+			return 0, 0, false
+		}
+	}
+
+	return t0, t1, true
+}
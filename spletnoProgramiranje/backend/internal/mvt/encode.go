@@ -0,0 +1,92 @@
+package mvt
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Protocol buffer wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+// Encode returns the tile holding the layers. Layers without features are
+// left out.
+func Encode(layers ...*Layer) []byte {
+	var tile []byte
+	for _, l := range layers {
+		if l.Len() == 0 {
+			continue
+		}
+		tile = appendBytes(tile, 3, l.encode())
+	}
+	return tile
+}
+
+func (l *Layer) encode() []byte {
+	b := appendVarintField(nil, 15, 2)
+	b = appendBytes(b, 1, []byte(l.name))
+	for _, f := range l.features {
+		b = appendBytes(b, 2, f.encode())
+	}
+	for _, k := range l.keys {
+		b = appendBytes(b, 3, []byte(k))
+	}
+	for _, v := range l.values {
+		b = appendBytes(b, 4, encodeValue(v))
+	}
+	return appendVarintField(b, 5, Extent)
+}
+
+func (f feature) encode() []byte {
+	b := appendVarintField(nil, 1, f.id)
+	if len(f.tags) > 0 {
+		b = appendPacked(b, 2, f.tags)
+	}
+	b = appendVarintField(b, 3, f.geomType)
+	return appendPacked(b, 4, f.geometry)
+}
+
+func encodeValue(v any) []byte {
+	switch v := v.(type) {
+	case string:
+		return appendBytes(nil, 1, []byte(v))
+	case float64:
+		b := appendKey(nil, 3, wireFixed64)
+		return binary.LittleEndian.AppendUint64(b, math.Float64bits(v))
+	case int64:
+		return appendVarintField(nil, 6, uint64((v<<1)^(v>>63)))
+	case bool:
+		var n uint64
+		if v {
+			n = 1
+		}
+		return appendVarintField(nil, 7, n)
+	}
+	return nil
+}
+
+func appendKey(b []byte, field int, wire int) []byte {
+	return binary.AppendUvarint(b, uint64(field<<3|wire))
+}
+
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	b = appendKey(b, field, wireVarint)
+	return binary.AppendUvarint(b, v)
+}
+
+func appendBytes(b []byte, field int, v []byte) []byte {
+	b = appendKey(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendPacked(b []byte, field int, vs []uint32) []byte {
+	var packed []byte
+	for _, v := range vs {
+		packed = binary.AppendUvarint(packed, uint64(v))
+	}
+	return appendBytes(b, field, packed)
+}
@@ -0,0 +1,189 @@
+// Package mvt encodes Mapbox Vector Tiles, version 2.1 of the
+// specification: https://github.com/mapbox/vector-tile-spec/tree/master/2.1.
+//
+// A tile is a protocol buffer message; the handful of fields it needs are
+// written by hand rather than through a generated protobuf package.
+package mvt
+
+import (
+	"math"
+	"sort"
+)
+
+// ContentType is the media type of an encoded tile.
+const ContentType = "application/vnd.mapbox-vector-tile"
+
+// Extent is the size of a tile's coordinate space.
+const Extent = 4096
+
+// MaxZoom is the deepest zoom level tiles are served for.
+const MaxZoom = 22
+
+const (
+	geomPoint      = 1
+	geomLineString = 2
+
+	cmdMoveTo = 1
+	cmdLineTo = 2
+)
+
+// Tile addresses a tile of the Web Mercator (EPSG:3857) pyramid, with Y
+// counted from the north as in XYZ URLs.
+type Tile struct {
+	Z, X, Y int
+}
+
+// Valid reports whether the tile exists at its zoom level.
+func (t Tile) Valid() bool {
+	if t.Z < 0 || t.Z > MaxZoom {
+		return false
+	}
+	n := 1 << t.Z
+	return t.X >= 0 && t.X < n && t.Y >= 0 && t.Y < n
+}
+
+// Project converts a point to the tile's coordinates, where the tile spans
+// [0, Extent) on both axes and y grows southwards. Points off the tile get
+// coordinates outside that range.
+func (t Tile) Project(lat, lon float64) (x, y float64) {
+	n := float64(int(1) << t.Z)
+	lat = math.Max(-85.05112878, math.Min(85.05112878, lat))
+	sin := math.Sin(lat * math.Pi / 180)
+
+	worldX := (lon + 180) / 360
+	worldY := 0.5 - math.Log((1+sin)/(1-sin))/(4*math.Pi)
+
+	return (worldX*n - float64(t.X)) * Extent, (worldY*n - float64(t.Y)) * Extent
+}
+
+// Point is a position in tile coordinates.
+type Point struct {
+	X, Y int
+}
+
+// Layer is a named set of features. The zero value is not usable; create
+// layers with NewLayer.
+type Layer struct {
+	name     string
+	features []feature
+	keys     []string
+	keyIndex map[string]uint32
+	values   []any
+	valIndex map[any]uint32
+}
+
+type feature struct {
+	id       uint64
+	tags     []uint32
+	geomType uint64
+	geometry []uint32
+}
+
+// NewLayer returns an empty layer.
+func NewLayer(name string) *Layer {
+	return &Layer{name: name, keyIndex: map[string]uint32{}, valIndex: map[any]uint32{}}
+}
+
+// Len is the number of features in the layer.
+func (l *Layer) Len() int {
+	return len(l.features)
+}
+
+// AddPoint adds a point feature. Property values may be strings, bools,
+// integers or floats; others are left out.
+func (l *Layer) AddPoint(id uint64, p Point, properties map[string]any) {
+	l.features = append(l.features, feature{
+		id:       id,
+		tags:     l.tags(properties),
+		geomType: geomPoint,
+		geometry: []uint32{command(cmdMoveTo, 1), zigzag(p.X), zigzag(p.Y)},
+	})
+}
+
+// AddLineString adds a line feature made of one or more parts, such as the
+// pieces of a path left after clipping. Parts of fewer than two points are
+// skipped, and nothing is added when no part is left.
+func (l *Layer) AddLineString(id uint64, parts [][]Point, properties map[string]any) {
+	var (
+		geometry []uint32
+		cursor   Point
+	)
+	for _, part := range parts {
+		if len(part) < 2 {
+			continue
+		}
+		geometry = append(geometry, command(cmdMoveTo, 1), zigzag(part[0].X-cursor.X), zigzag(part[0].Y-cursor.Y))
+		geometry = append(geometry, command(cmdLineTo, len(part)-1))
+		for i := 1; i < len(part); i++ {
+			geometry = append(geometry, zigzag(part[i].X-part[i-1].X), zigzag(part[i].Y-part[i-1].Y))
+		}
+		cursor = part[len(part)-1]
+	}
+	if geometry == nil {
+		return
+	}
+
+	l.features = append(l.features, feature{
+		id:       id,
+		tags:     l.tags(properties),
+		geomType: geomLineString,
+		geometry: geometry,
+	})
+}
+
+// tags interns the properties into the layer's key and value tables, in key
+// order so that a tile always encodes the same way.
+func (l *Layer) tags(properties map[string]any) []uint32 {
+	keys := make([]string, 0, len(properties))
+	for k := range properties {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	tags := make([]uint32, 0, 2*len(keys))
+	for _, k := range keys {
+		v, ok := normalize(properties[k])
+		if !ok {
+			continue
+		}
+
+		ki, ok := l.keyIndex[k]
+		if !ok {
+			ki = uint32(len(l.keys))
+			l.keyIndex[k] = ki
+			l.keys = append(l.keys, k)
+		}
+		vi, ok := l.valIndex[v]
+		if !ok {
+			vi = uint32(len(l.values))
+			l.valIndex[v] = vi
+			l.values = append(l.values, v)
+		}
+		tags = append(tags, ki, vi)
+	}
+	return tags
+}
+
+// normalize maps a property value to string, bool, int64 or float64, the
+// types the value table holds.
+func normalize(v any) (any, bool) {
+	switch v := v.(type) {
+	case string, bool, int64, float64:
+		return v, true
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case float32:
+		return float64(v), true
+	}
+	return nil, false
+}
+
+func command(id, count int) uint32 {
+	return uint32(id&0x7) | uint32(count)<<3
+}
+
+func zigzag(n int) uint32 {
+	return uint32((int32(n) << 1) ^ (int32(n) >> 31))
+}
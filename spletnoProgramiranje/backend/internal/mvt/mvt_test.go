@@ -0,0 +1,197 @@
+package mvt
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTileValid(t *testing.T) {
+	assert.True(t, Tile{0, 0, 0}.Valid())
+	assert.True(t, Tile{14, 8946, 5745}.Valid())
+	assert.False(t, Tile{1, 2, 0}.Valid())
+	assert.False(t, Tile{2, 0, -1}.Valid())
+	assert.False(t, Tile{MaxZoom + 1, 0, 0}.Valid())
+}
+
+func TestTileProject(t *testing.T) {
+	x, y := Tile{0, 0, 0}.Project(0, 0)
+	assert.InDelta(t, Extent/2, x, 1e-9)
+	assert.InDelta(t, Extent/2, y, 1e-9)
+
+	// Maribor's main square lies in tile 14/8904/5792.
+	x, y = Tile{14, 8904, 5792}.Project(46.5577, 15.6455)
+	assert.True(t, Contains(x, y, 0), "(%v, %v)", x, y)
+
+	// A point east of the tile is beyond the extent; one north of it has a
+	// negative y.
+	x, _ = Tile{14, 8903, 5792}.Project(46.5577, 15.6455)
+	assert.Greater(t, x, float64(Extent))
+	_, y = Tile{14, 8904, 5793}.Project(46.5577, 15.6455)
+	assert.Less(t, y, 0.0)
+}
+
+func TestClipLine(t *testing.T) {
+	inside := [][2]float64{{10, 10}, {100.4, 100.4}, {100, 100}, {200, 10}}
+	assert.Equal(t, [][]Point{{{10, 10}, {100, 100}, {200, 10}}}, ClipLine(inside, 0))
+
+	// The line leaves through the right edge and comes back.
+	outAndBack := [][2]float64{{4000, 100}, {4200, 100}, {4200, 300}, {4000, 300}}
+	assert.Equal(t, [][]Point{
+		{{4000, 100}, {4096, 100}},
+		{{4096, 300}, {4000, 300}},
+	}, ClipLine(outAndBack, 0))
+	assert.Equal(t, [][]Point{
+		{{4000, 100}, {4200, 100}, {4200, 300}, {4000, 300}},
+	}, ClipLine(outAndBack, 128), "the buffer keeps it whole")
+
+	assert.Empty(t, ClipLine([][2]float64{{-100, -100}, {-50, 5000}}, 0))
+}
+
+func TestEncode(t *testing.T) {
+	stops := NewLayer("stops")
+	stops.AddPoint(7, Point{25, 17}, map[string]any{"name": "Center", "number": "003", "skipped": []int{1}})
+	stops.AddPoint(8, Point{30, 10}, map[string]any{"name": "Center", "number": "004"})
+
+	routes := NewLayer("routes")
+	routes.AddLineString(1, [][]Point{{{2, 2}, {2, 10}, {10, 10}}, {{1, 1}, {3, 5}}}, map[string]any{
+		"line_id": 1, "colour": "#00a0e0", "length": 1.5, "night": false,
+	})
+	routes.AddLineString(2, [][]Point{{{2, 2}}}, nil)
+	assert.Equal(t, 1, routes.Len(), "a single point is not a line")
+
+	layers := decodeTile(t, Encode(stops, NewLayer("empty"), routes))
+	require.Len(t, layers, 2)
+
+	assert.Equal(t, "stops", layers[0].name)
+	assert.Equal(t, uint64(2), layers[0].version)
+	assert.Equal(t, uint64(Extent), layers[0].extent)
+	assert.Equal(t, []string{"name", "number"}, layers[0].keys)
+	assert.Equal(t, []any{"Center", "003", "004"}, layers[0].values)
+	require.Len(t, layers[0].features, 2)
+	assert.Equal(t, uint64(7), layers[0].features[0].id)
+	assert.Equal(t, []uint64{0, 0, 1, 1}, layers[0].features[0].tags)
+	assert.Equal(t, []uint64{0, 0, 1, 2}, layers[0].features[1].tags)
+	assert.Equal(t, uint64(geomPoint), layers[0].features[0].geomType)
+	assert.Equal(t, []uint64{9, 50, 34}, layers[0].features[0].geometry)
+
+	assert.Equal(t, "routes", layers[1].name)
+	assert.Equal(t, []string{"colour", "length", "line_id", "night"}, layers[1].keys)
+	assert.Equal(t, []any{"#00a0e0", 1.5, int64(1), false}, layers[1].values)
+	require.Len(t, layers[1].features, 1)
+	assert.Equal(t, uint64(geomLineString), layers[1].features[0].geomType)
+	// The example from section 4.3.5 of the specification.
+	assert.Equal(t, []uint64{9, 4, 4, 18, 0, 16, 16, 0, 9, 17, 17, 10, 4, 8}, layers[1].features[0].geometry)
+}
+
+type decodedLayer struct {
+	name            string
+	version, extent uint64
+	keys            []string
+	values          []any
+	features        []decodedFeature
+}
+
+type decodedFeature struct {
+	id, geomType   uint64
+	tags, geometry []uint64
+}
+
+func decodeTile(t *testing.T, b []byte) []decodedLayer {
+	var layers []decodedLayer
+	eachField(t, b, func(field int, v uint64, bytes []byte) {
+		require.Equal(t, 3, field)
+
+		var l decodedLayer
+		eachField(t, bytes, func(field int, v uint64, bytes []byte) {
+			switch field {
+			case 1:
+				l.name = string(bytes)
+			case 2:
+				l.features = append(l.features, decodeFeature(t, bytes))
+			case 3:
+				l.keys = append(l.keys, string(bytes))
+			case 4:
+				eachField(t, bytes, func(field int, v uint64, bytes []byte) {
+					switch field {
+					case 1:
+						l.values = append(l.values, string(bytes))
+					case 3:
+						l.values = append(l.values, math.Float64frombits(v))
+					case 6:
+						l.values = append(l.values, int64(v>>1)^-int64(v&1))
+					case 7:
+						l.values = append(l.values, v == 1)
+					}
+				})
+			case 5:
+				l.extent = v
+			case 15:
+				l.version = v
+			}
+		})
+		layers = append(layers, l)
+	})
+	return layers
+}
+
+func decodeFeature(t *testing.T, b []byte) decodedFeature {
+	var f decodedFeature
+	eachField(t, b, func(field int, v uint64, bytes []byte) {
+		switch field {
+		case 1:
+			f.id = v
+		case 2:
+			f.tags = unpack(t, bytes)
+		case 3:
+			f.geomType = v
+		case 4:
+			f.geometry = unpack(t, bytes)
+		}
+	})
+	return f
+}
+
+// eachField calls fn with each field of a message: the value of varint and
+// fixed64 fields, or the contents of length-delimited ones.
+func eachField(t *testing.T, b []byte, fn func(field int, v uint64, bytes []byte)) {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		require.Positive(t, n)
+		b = b[n:]
+
+		switch key & 7 {
+		case wireVarint:
+			v, n := binary.Uvarint(b)
+			require.Positive(t, n)
+			b = b[n:]
+			fn(int(key>>3), v, nil)
+		case wireFixed64:
+			require.GreaterOrEqual(t, len(b), 8)
+			fn(int(key>>3), binary.LittleEndian.Uint64(b), nil)
+			b = b[8:]
+		case wireBytes:
+			size, n := binary.Uvarint(b)
+			require.Positive(t, n)
+			require.GreaterOrEqual(t, uint64(len(b)-n), size)
+			fn(int(key>>3), 0, b[n:n+int(size)])
+			b = b[n+int(size):]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+}
+
+func unpack(t *testing.T, b []byte) []uint64 {
+	var vs []uint64
+	for len(b) > 0 {
+		v, n := binary.Uvarint(b)
+		require.Positive(t, n)
+		vs = append(vs, v)
+		b = b[n:]
+	}
+	return vs
+}
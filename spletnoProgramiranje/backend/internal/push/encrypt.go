@@ -0,0 +1,150 @@
+package push
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	// recordSize is the aes128gcm record size. Messages are sent as a single
+	// record, which bounds the payload.
+	recordSize = 4096
+	// headerSize is salt (16), record size (4), key ID length (1) and the
+	// uncompressed P-256 key ID (65).
+	headerSize = 16 + 4 + 1 + 65
+	// maxBody is the largest message push services must accept (RFC 8030
+	// section 7.2), header included.
+	maxBody = 4096
+	// MaxPayload is the largest payload Encrypt accepts, 3993 bytes as RFC
+	// 8291 section 4 says: a body minus the header, the padding delimiter
+	// and the AES-GCM tag.
+	MaxPayload = maxBody - headerSize - 1 - 16
+)
+
+// ErrPayloadTooLarge is returned for payloads above MaxPayload.
+var ErrPayloadTooLarge = errors.New("push payload too large")
+
+// DecodeKey decodes a key as browsers encode them: base64url, with or
+// without padding.
+func DecodeKey(s string) ([]byte, error) {
+	if b, err := base64.RawURLEncoding.DecodeString(s); err == nil {
+		return b, nil
+	}
+	return base64.URLEncoding.DecodeString(s)
+}
+
+// CheckKeys reports whether p256dh and auth are usable browser keys: an
+// uncompressed P-256 public key and a 16 byte authentication secret.
+func CheckKeys(p256dh, auth string) error {
+	pub, err := DecodeKey(p256dh)
+	if err != nil {
+		return fmt.Errorf("p256dh: %w", err)
+	}
+	if _, err := ecdh.P256().NewPublicKey(pub); err != nil {
+		return fmt.Errorf("p256dh: %w", err)
+	}
+
+	secret, err := DecodeKey(auth)
+	if err != nil {
+		return fmt.Errorf("auth: %w", err)
+	}
+	if len(secret) != 16 {
+		return fmt.Errorf("auth: want 16 bytes, got %d", len(secret))
+	}
+
+	return nil
+}
+
+// Encrypt encrypts payload for the browser holding the keys, using the
+// aes128gcm content encoding of RFC 8291 with a fresh sender key and salt.
+func Encrypt(payload []byte, p256dh, auth string) ([]byte, error) {
+	if err := CheckKeys(p256dh, auth); err != nil {
+		return nil, err
+	}
+	uaPublic, _ := DecodeKey(p256dh)
+	authSecret, _ := DecodeKey(auth)
+
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	return encrypt(payload, uaPublic, authSecret, asPrivate, salt)
+}
+
+func encrypt(payload, uaPublicBytes, authSecret []byte, asPrivate *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+	if len(payload) > MaxPayload {
+		return nil, ErrPayloadTooLarge
+	}
+
+	uaPublic, err := ecdh.P256().NewPublicKey(uaPublicBytes)
+	if err != nil {
+		return nil, err
+	}
+	ecdhSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+
+	// RFC 8291 section 3.3: combine the shared secret with the browser's
+	// authentication secret.
+	keyInfo := bytes.Join([][]byte{[]byte("WebPush: info\x00"), uaPublicBytes, asPublic}, nil)
+	prkKey := hmacSHA256(authSecret, ecdhSecret)
+	ikm := hmacSHA256(prkKey, append(keyInfo, 0x01))
+
+	// RFC 8188 section 2.2: derive the content encryption key and nonce.
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, headerSize)
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, recordSize)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+
+	// A single, last record: the payload followed by the 0x02 delimiter.
+	plaintext := append(bytes.Clone(payload), 0x02)
+
+	return gcm.Seal(header, nonce, plaintext, nil), nil
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
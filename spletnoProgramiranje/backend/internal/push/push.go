@@ -0,0 +1,249 @@
+// Package push sends Web Push notifications (RFC 8030) to the browsers of
+// users whose favourite lines are delayed or affected by a service alert.
+// Messages are encrypted for each browser (RFC 8291) and signed with the
+// server's VAPID key (RFC 8292).
+//
+// Sending is best effort: push services store messages for offline browsers
+// themselves, so a message the push service rejects is logged and dropped
+// rather than retried. Subscriptions the push service reports as gone and
+// subscriptions past their expiry are deleted.
+package push
+
+import (
+	"backend/internal/data"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+// incidentBatch bounds the delay reports sent per poll.
+const incidentBatch = 100
+
+// maxAlertBody bounds the service alert description in a message, which
+// would not fit a push message at its full length.
+const maxAlertBody = 1000
+
+// Message is the JSON payload a service worker receives in its push event.
+type Message struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	// Tag lets the browser replace an older notification about the same
+	// line and stop instead of stacking them.
+	Tag     string `json:"tag"`
+	URL     string `json:"url"`
+	LineID  int    `json:"line_id,omitempty"`
+	StopID  int    `json:"stop_id,omitempty"`
+	DelayID int    `json:"delay_id,omitempty"`
+	AlertID int64  `json:"alert_id,omitempty"`
+}
+
+// DelayMessage describes a delay report.
+func DelayMessage(inc data.AlertIncident) Message {
+	return Message{
+		Title:   fmt.Sprintf("Line %s delayed %d min", inc.LineCode, inc.DelayMin),
+		Body:    fmt.Sprintf("Reported at %s, %s.", inc.StopName, inc.ReportedAt.Local().Format("15:04")),
+		Tag:     "delay-" + strconv.Itoa(inc.LineID) + "-" + strconv.Itoa(inc.StopID),
+		URL:     "/lines/" + strconv.Itoa(inc.LineID),
+		LineID:  inc.LineID,
+		StopID:  inc.StopID,
+		DelayID: inc.DelayID,
+	}
+}
+
+// ServiceAlertMessage describes a service alert in the default language.
+func ServiceAlertMessage(a data.ServiceAlert) Message {
+	return Message{
+		Title:   a.Header[data.DefaultLanguage],
+		Body:    Truncate(a.Description[data.DefaultLanguage], maxAlertBody),
+		Tag:     "alert-" + strconv.FormatInt(a.ID, 10),
+		URL:     "/service-alerts/" + strconv.FormatInt(a.ID, 10),
+		AlertID: a.ID,
+	}
+}
+
+// alertUrgency is high for alerts that change how users get where they are
+// going and normal for the rest.
+func alertUrgency(a data.ServiceAlert) string {
+	switch a.Effect {
+	case data.EffectNoService, data.EffectDetour, data.EffectSignificantDelays, data.EffectStopMoved:
+		return UrgencyHigh
+	}
+	return UrgencyNormal
+}
+
+// Truncate cuts s to at most n bytes without splitting a UTF-8 sequence.
+func Truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// Notifier sends one message to one browser.
+type Notifier interface {
+	Send(ctx context.Context, endpoint, p256dh, auth string, payload []byte, urgency string) error
+}
+
+type Service struct {
+	store        data.Storage
+	sender       Notifier
+	pollInterval time.Duration
+	logger       *zap.SugaredLogger
+
+	now func() time.Time
+}
+
+func NewService(store data.Storage, sender Notifier, pollInterval time.Duration, logger *zap.SugaredLogger) *Service {
+	return &Service{
+		store:        store,
+		sender:       sender,
+		pollInterval: pollInterval,
+		logger:       logger,
+		now:          time.Now,
+	}
+}
+
+// Run sends notifications and cleans up expired subscriptions every poll
+// interval until ctx is cancelled.
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Cleanup(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Errorw("deleting expired push subscriptions", "error", err)
+		}
+		if err := s.SendNew(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Errorw("sending push notifications", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Cleanup deletes the subscriptions past their expiry.
+func (s *Service) Cleanup(ctx context.Context) error {
+	n, err := s.store.Push.DeleteExpired(ctx, s.now())
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		s.logger.Infow("deleted expired push subscriptions", "count", n)
+	}
+	return nil
+}
+
+// SendNew notifies the subscribers of every delay report filed and every
+// service alert published since the last call. Both are claimed before
+// sending, so each is sent at most once even when several API instances run
+// side by side. Alerts that have already ended are skipped.
+func (s *Service) SendNew(ctx context.Context) error {
+	var (
+		incidents []data.AlertIncident
+		alerts    []data.ServiceAlert
+	)
+
+	err := s.store.WithTx(ctx, func(tx data.Storage) error {
+		cursor, err := tx.Push.Claim(ctx)
+		if err != nil {
+			return err
+		}
+
+		incidents, err = tx.Alerts.ReadIncidents(ctx, cursor, incidentBatch)
+		if err != nil {
+			return err
+		}
+		if len(incidents) > 0 {
+			if err := tx.Push.SetCursor(ctx, incidents[len(incidents)-1].DelayID); err != nil {
+				return err
+			}
+		}
+
+		alertCursor, err := tx.Push.ServiceAlertCursor(ctx)
+		if err != nil {
+			return err
+		}
+
+		alerts, err = tx.ServiceAlerts.List(ctx, data.ServiceAlertFilter{AfterID: alertCursor})
+		if err != nil || len(alerts) == 0 {
+			return err
+		}
+
+		last := alertCursor
+		for _, a := range alerts {
+			last = max(last, a.ID)
+		}
+		return tx.Push.SetServiceAlertCursor(ctx, last)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, inc := range incidents {
+		targets, err := s.store.Push.Targets(ctx, inc.LineID, inc.StopID)
+		if err != nil {
+			return err
+		}
+		if err := s.send(ctx, targets, DelayMessage(inc), UrgencyHigh); err != nil {
+			return err
+		}
+	}
+
+	now := s.now()
+	for _, a := range alerts {
+		if a.ActiveUntil != nil && !now.Before(*a.ActiveUntil) {
+			continue
+		}
+		targets, err := s.store.Push.AlertTargets(ctx, a.ID)
+		if err != nil {
+			return err
+		}
+		if err := s.send(ctx, targets, ServiceAlertMessage(a), alertUrgency(a)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) send(ctx context.Context, targets []data.PushSubscription, m Message, urgency string) error {
+	if len(targets) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range targets {
+		err := s.sender.Send(ctx, sub.Endpoint, sub.P256dh, sub.Auth, payload, urgency)
+		switch {
+		case err == nil:
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case errors.Is(err, ErrGone):
+			s.logger.Infow("push subscription gone", "push_subscription_id", sub.ID)
+			if err := s.store.Push.DeleteEndpoint(ctx, sub.Endpoint); err != nil {
+				return err
+			}
+		default:
+			s.logger.Warnw("push notification failed", "push_subscription_id", sub.ID, "tag", m.Tag, "error", err)
+		}
+	}
+
+	return nil
+}
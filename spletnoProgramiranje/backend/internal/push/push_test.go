@@ -0,0 +1,344 @@
+package push
+
+import (
+	"backend/internal/data"
+	"backend/internal/data/memory"
+	"backend/internal/data/storagetest"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func b64(t *testing.T, s string) []byte {
+	b, err := DecodeKey(s)
+	require.NoError(t, err)
+	return b
+}
+
+// browser is the receiving side of RFC 8291, standing in for a browser.
+type browser struct {
+	private *ecdh.PrivateKey
+	auth    []byte
+}
+
+func newBrowser(t *testing.T) *browser {
+	private, err := ecdh.P256().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	auth := make([]byte, 16)
+	_, err = rand.Read(auth)
+	require.NoError(t, err)
+	return &browser{private: private, auth: auth}
+}
+
+func (b *browser) keys() (p256dh, auth string) {
+	return base64.RawURLEncoding.EncodeToString(b.private.PublicKey().Bytes()),
+		base64.RawURLEncoding.EncodeToString(b.auth)
+}
+
+func (b *browser) decrypt(t *testing.T, body []byte) []byte {
+	require.Greater(t, len(body), headerSize)
+	salt := body[:16]
+	assert.Equal(t, uint32(recordSize), binary.BigEndian.Uint32(body[16:20]))
+	require.Equal(t, byte(65), body[20])
+	asPublicBytes := body[21:headerSize]
+
+	asPublic, err := ecdh.P256().NewPublicKey(asPublicBytes)
+	require.NoError(t, err)
+	ecdhSecret, err := b.private.ECDH(asPublic)
+	require.NoError(t, err)
+
+	keyInfo := bytes.Join([][]byte{[]byte("WebPush: info\x00"), b.private.PublicKey().Bytes(), asPublicBytes}, nil)
+	ikm := hmacSHA256(hmacSHA256(b.auth, ecdhSecret), append(keyInfo, 0x01))
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	require.NoError(t, err)
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	require.NoError(t, err)
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	require.NoError(t, err)
+
+	block, err := aes.NewCipher(cek)
+	require.NoError(t, err)
+	gcm, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+	plaintext, err := gcm.Open(nil, nonce, body[headerSize:], nil)
+	require.NoError(t, err)
+
+	require.Equal(t, byte(0x02), plaintext[len(plaintext)-1], "a single, last record")
+	return plaintext[:len(plaintext)-1]
+}
+
+func TestEncryptMatchesRFC8291(t *testing.T) {
+	// RFC 8291 appendix A.
+	asPrivate, err := ecdh.P256().NewPrivateKey(b64(t, "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"))
+	require.NoError(t, err)
+
+	body, err := encrypt(
+		[]byte("When I grow up, I want to be a watermelon"),
+		b64(t, "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"),
+		b64(t, "BTBZMqHH6r4Tts7J_aSIgg"),
+		asPrivate,
+		b64(t, "DGv6ra1nlYgDCS1FRnbzlw"),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN",
+		base64.RawURLEncoding.EncodeToString(body))
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	b := newBrowser(t)
+	p256dh, auth := b.keys()
+
+	body, err := Encrypt([]byte(`{"title":"hi"}`), p256dh, auth)
+	require.NoError(t, err)
+	assert.Equal(t, `{"title":"hi"}`, string(b.decrypt(t, body)))
+
+	other, err := Encrypt([]byte(`{"title":"hi"}`), p256dh, auth)
+	require.NoError(t, err)
+	assert.NotEqual(t, body, other, "every message uses a fresh key and salt")
+
+	_, err = Encrypt(make([]byte, MaxPayload+1), p256dh, auth)
+	assert.ErrorIs(t, err, ErrPayloadTooLarge)
+}
+
+func TestEncryptMaxPayloadFitsPushServices(t *testing.T) {
+	b := newBrowser(t)
+	p256dh, auth := b.keys()
+
+	assert.Equal(t, 3993, MaxPayload)
+
+	body, err := Encrypt(make([]byte, MaxPayload), p256dh, auth)
+	require.NoError(t, err)
+	assert.Len(t, body, 4096, "the largest payload makes the largest body push services must take")
+	assert.Len(t, b.decrypt(t, body), MaxPayload)
+
+	_, err = Encrypt(make([]byte, 3994), p256dh, auth)
+	assert.ErrorIs(t, err, ErrPayloadTooLarge)
+}
+
+func TestCheckKeys(t *testing.T) {
+	p256dh, auth := newBrowser(t).keys()
+	assert.NoError(t, CheckKeys(p256dh, auth))
+	assert.Error(t, CheckKeys(p256dh[:20], auth), "truncated public key")
+	assert.Error(t, CheckKeys(p256dh, auth+"AAAA"), "auth secret of the wrong size")
+	assert.Error(t, CheckKeys("not base64!", auth))
+}
+
+func TestParseKeys(t *testing.T) {
+	keys, err := GenerateKeys()
+	require.NoError(t, err)
+
+	parsed, err := ParseKeys(keys.PublicKey(), keys.PrivateKey())
+	require.NoError(t, err)
+	assert.Equal(t, keys.PublicKey(), parsed.PublicKey())
+
+	other, err := GenerateKeys()
+	require.NoError(t, err)
+	_, err = ParseKeys(other.PublicKey(), keys.PrivateKey())
+	assert.ErrorContains(t, err, "does not match")
+}
+
+func TestSender(t *testing.T) {
+	keys, err := GenerateKeys()
+	require.NoError(t, err)
+
+	var (
+		body    []byte
+		headers http.Header
+		status  = http.StatusCreated
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		headers = r.Header.Clone()
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	sender := &Sender{Client: srv.Client(), Keys: keys, Subject: "mailto:ops@example.com", TTL: time.Hour, Endpoint: srv.URL}
+	b := newBrowser(t)
+	p256dh, auth := b.keys()
+
+	err = sender.Send(context.Background(), "https://push.example.com/send/abc", p256dh, auth, []byte(`{"title":"hi"}`), UrgencyHigh)
+	require.NoError(t, err)
+
+	assert.Equal(t, `{"title":"hi"}`, string(b.decrypt(t, body)))
+	assert.Equal(t, "aes128gcm", headers.Get("Content-Encoding"))
+	assert.Equal(t, "3600", headers.Get("TTL"))
+	assert.Equal(t, UrgencyHigh, headers.Get("Urgency"))
+
+	// The VAPID token is signed for the push service's origin.
+	token, key, ok := strings.Cut(strings.TrimPrefix(headers.Get("Authorization"), "vapid t="), ", k=")
+	require.True(t, ok)
+	assert.Equal(t, keys.PublicKey(), key)
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) { return &keys.private.PublicKey, nil },
+		jwt.WithValidMethods([]string{"ES256"}))
+	require.NoError(t, err)
+	assert.Equal(t, "https://push.example.com", claims["aud"])
+	assert.Equal(t, "mailto:ops@example.com", claims["sub"])
+
+	status = http.StatusGone
+	err = sender.Send(context.Background(), "https://push.example.com/send/abc", p256dh, auth, []byte(`{}`), UrgencyHigh)
+	assert.ErrorIs(t, err, ErrGone)
+
+	status = http.StatusTooManyRequests
+	err = sender.Send(context.Background(), "https://push.example.com/send/abc", p256dh, auth, []byte(`{}`), UrgencyHigh)
+	assert.ErrorContains(t, err, "429")
+}
+
+type sent struct {
+	endpoint string
+	message  Message
+}
+
+type recordingSender struct {
+	sent []sent
+	gone map[string]bool
+}
+
+func (r *recordingSender) Send(ctx context.Context, endpoint, p256dh, auth string, payload []byte, urgency string) error {
+	if r.gone[endpoint] {
+		return ErrGone
+	}
+	var m Message
+	if err := json.Unmarshal(payload, &m); err != nil {
+		return err
+	}
+	r.sent = append(r.sent, sent{endpoint, m})
+	return nil
+}
+
+func TestService(t *testing.T) {
+	ctx := context.Background()
+	store, err := memory.NewStorage(storagetest.Dataset())
+	require.NoError(t, err)
+
+	sender := &recordingSender{gone: map[string]bool{"https://push.example.com/gone": true}}
+	svc := NewService(store, sender, time.Second, zap.NewNop().Sugar())
+
+	line6, center, station := 2, 1, 2
+	require.NoError(t, store.Favourites.Create(ctx, &data.Favourite{UserID: 1, LineID: &line6}))
+	require.NoError(t, store.Favourites.Create(ctx, &data.Favourite{UserID: 2, LineID: &line6, StopID: &center}))
+
+	for _, p := range []data.PushSubscription{
+		{UserID: 1, Endpoint: "https://push.example.com/alice"},
+		{UserID: 1, Endpoint: "https://push.example.com/gone"},
+		{UserID: 2, Endpoint: "https://push.example.com/bob"},
+	} {
+		require.NoError(t, store.Push.Save(ctx, &p))
+	}
+
+	// Reports filed before the sender first runs are not sent.
+	require.NoError(t, svc.SendNew(ctx))
+	assert.Empty(t, sender.sent)
+
+	_, err = store.Delays.InsertDelay(ctx, data.DelayReportInputUnMarshaled{
+		Date: time.Now(), DelayMin: 7, StopID: int64(station), LineID: int64(line6), UserId: 2,
+	})
+	require.NoError(t, err)
+	require.NoError(t, svc.SendNew(ctx))
+	require.NoError(t, svc.SendNew(ctx), "each report is sent once")
+
+	require.Len(t, sender.sent, 1, "bob only follows line 6 at Center")
+	assert.Equal(t, "https://push.example.com/alice", sender.sent[0].endpoint)
+	assert.Equal(t, "Line 6 delayed 7 min", sender.sent[0].message.Title)
+	assert.Equal(t, "delay-2-2", sender.sent[0].message.Tag)
+
+	left, err := store.Push.List(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, left, 1, "gone subscriptions are deleted")
+	assert.Equal(t, "https://push.example.com/alice", left[0].Endpoint)
+}
+
+func TestServiceAlerts(t *testing.T) {
+	ctx := context.Background()
+	store, err := memory.NewStorage(storagetest.Dataset())
+	require.NoError(t, err)
+
+	sender := &recordingSender{}
+	svc := NewService(store, sender, time.Second, zap.NewNop().Sugar())
+
+	line6, park := 2, 3
+	require.NoError(t, store.Favourites.Create(ctx, &data.Favourite{UserID: 1, LineID: &line6}))
+	require.NoError(t, store.Push.Save(ctx, &data.PushSubscription{UserID: 1, Endpoint: "https://push.example.com/alice"}))
+
+	// Alerts published before the sender first runs are not sent.
+	now := time.Now()
+	require.NoError(t, store.ServiceAlerts.Create(ctx, &data.ServiceAlert{
+		Cause: data.CauseStrike, Effect: data.EffectReducedService,
+		Header: data.Translations{"sl": "Stavka"}, ActiveFrom: now,
+		Entities: []data.ServiceAlertEntity{{LineID: &line6}},
+	}))
+	require.NoError(t, svc.SendNew(ctx))
+	assert.Empty(t, sender.sent)
+
+	ended := now.Add(-time.Minute)
+	closure := data.ServiceAlert{
+		Cause: data.CauseConstruction, Effect: data.EffectNoService,
+		Header:      data.Translations{"sl": "Postajališče zaprto", "en": "Stop closed"},
+		Description: data.Translations{"sl": strings.Repeat("ž", 1000)},
+		ActiveFrom:  now,
+		Entities:    []data.ServiceAlertEntity{{StopID: &park}},
+	}
+	require.NoError(t, store.ServiceAlerts.Create(ctx, &closure))
+	require.NoError(t, store.ServiceAlerts.Create(ctx, &data.ServiceAlert{
+		Cause: data.CauseStrike, Effect: data.EffectNoService,
+		Header: data.Translations{"sl": "Končano"}, ActiveFrom: now.Add(-time.Hour), ActiveUntil: &ended,
+		Entities: []data.ServiceAlertEntity{{LineID: &line6}},
+	}))
+	require.NoError(t, svc.SendNew(ctx))
+	require.NoError(t, svc.SendNew(ctx), "each alert is sent once")
+
+	require.Len(t, sender.sent, 1, "alerts that have ended are not sent")
+	m := sender.sent[0].message
+	assert.Equal(t, "https://push.example.com/alice", sender.sent[0].endpoint, "line 6 serves Park")
+	assert.Equal(t, "Postajališče zaprto", m.Title)
+	assert.Equal(t, "alert-"+strconv.FormatInt(closure.ID, 10), m.Tag)
+	assert.Equal(t, closure.ID, m.AlertID)
+	assert.Len(t, m.Body, maxAlertBody)
+}
+
+func TestServiceCleanup(t *testing.T) {
+	ctx := context.Background()
+	store, err := memory.NewStorage(storagetest.Dataset())
+	require.NoError(t, err)
+
+	now := time.Now()
+	svc := NewService(store, &recordingSender{}, time.Second, zap.NewNop().Sugar())
+	svc.now = func() time.Time { return now }
+
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	for _, p := range []data.PushSubscription{
+		{UserID: 1, Endpoint: "https://push.example.com/expired", ExpiresAt: &past},
+		{UserID: 1, Endpoint: "https://push.example.com/valid", ExpiresAt: &future},
+		{UserID: 1, Endpoint: "https://push.example.com/forever"},
+	} {
+		require.NoError(t, store.Push.Save(ctx, &p))
+	}
+
+	require.NoError(t, svc.Cleanup(ctx))
+
+	left, err := store.Push.List(ctx, 1)
+	require.NoError(t, err)
+	assert.Len(t, left, 2)
+}
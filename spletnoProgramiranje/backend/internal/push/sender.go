@@ -0,0 +1,81 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Message urgencies (RFC 8030 section 5.3).
+const (
+	UrgencyNormal = "normal"
+	UrgencyHigh   = "high"
+)
+
+// ErrGone is returned when the push service no longer knows the endpoint,
+// typically because the user revoked the permission. The subscription
+// should be deleted.
+var ErrGone = errors.New("push subscription is gone")
+
+// Sender delivers encrypted messages to push services.
+type Sender struct {
+	Client  *http.Client
+	Keys    *Keys
+	Subject string
+	// TTL is how long the push service keeps a message for an offline
+	// browser.
+	TTL time.Duration
+	// Endpoint, when set, replaces every subscription's endpoint. It points
+	// the sender at a local push service stand-in in test setups; the VAPID
+	// audience still names the original push service.
+	Endpoint string
+}
+
+// Send encrypts payload for the browser and posts it to the push service.
+func (s *Sender) Send(ctx context.Context, endpoint, p256dh, auth string, payload []byte, urgency string) error {
+	body, err := Encrypt(payload, p256dh, auth)
+	if err != nil {
+		return err
+	}
+
+	authorization, err := s.Keys.authorization(endpoint, s.Subject, time.Now())
+	if err != nil {
+		return err
+	}
+
+	target := endpoint
+	if s.Endpoint != "" {
+		target = s.Endpoint
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(s.TTL.Seconds())))
+	req.Header.Set("Urgency", urgency)
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	switch {
+	case res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone:
+		return ErrGone
+	case res.StatusCode < 200 || res.StatusCode > 299:
+		return fmt.Errorf("push service responded %s", res.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package push
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// vapidExpiry is the lifetime of a VAPID token. RFC 8292 caps it at 24
+// hours.
+const vapidExpiry = 12 * time.Hour
+
+// Keys is the application server's VAPID key pair (RFC 8292). Browsers
+// subscribe with the public key, and push services only accept messages
+// signed with the matching private key.
+type Keys struct {
+	private *ecdsa.PrivateKey
+}
+
+// GenerateKeys returns a new key pair.
+func GenerateKeys() (*Keys, error) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Keys{private: private}, nil
+}
+
+// ParseKeys decodes a key pair in the base64url form printed by
+// GenerateKeys: the uncompressed public point and the raw private scalar.
+func ParseKeys(public, private string) (*Keys, error) {
+	raw, err := DecodeKey(private)
+	if err != nil {
+		return nil, fmt.Errorf("vapid private key: %w", err)
+	}
+	// crypto/ecdh validates the scalar and derives the public point.
+	key, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("vapid private key: %w", err)
+	}
+	point := key.PublicKey().Bytes()
+
+	k := &Keys{private: &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(point[1:33]),
+			Y:     new(big.Int).SetBytes(point[33:]),
+		},
+		D: new(big.Int).SetBytes(raw),
+	}}
+
+	pub, err := DecodeKey(public)
+	if err != nil {
+		return nil, fmt.Errorf("vapid public key: %w", err)
+	}
+	if !bytes.Equal(pub, k.publicBytes()) {
+		return nil, errors.New("vapid public key does not match the private key")
+	}
+
+	return k, nil
+}
+
+func (k *Keys) ecdh() *ecdh.PrivateKey {
+	// Keys only holds valid P-256 keys, which always convert.
+	key, _ := k.private.ECDH()
+	return key
+}
+
+func (k *Keys) publicBytes() []byte {
+	return k.ecdh().PublicKey().Bytes()
+}
+
+// PublicKey is the applicationServerKey browsers subscribe with.
+func (k *Keys) PublicKey() string {
+	return base64.RawURLEncoding.EncodeToString(k.publicBytes())
+}
+
+// PrivateKey is the private key in the form ParseKeys accepts.
+func (k *Keys) PrivateKey() string {
+	return base64.RawURLEncoding.EncodeToString(k.ecdh().Bytes())
+}
+
+// authorization returns the Authorization header for a message to endpoint.
+// subject is a mailto: or https: contact for the push service operator.
+func (k *Keys) authorization(endpoint, subject string, now time.Time) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": now.Add(vapidExpiry).Unix(),
+		"sub": subject,
+	}).SignedString(k.private)
+	if err != nil {
+		return "", err
+	}
+
+	return "vapid t=" + token + ", k=" + k.PublicKey(), nil
+}
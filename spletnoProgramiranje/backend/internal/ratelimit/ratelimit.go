@@ -0,0 +1,108 @@
+// Package ratelimit implements token bucket rate limiting with pluggable
+// bucket storage. A bucket holds up to Burst tokens and refills at Rate
+// tokens per second; every request takes one token and is rejected when the
+// bucket is empty.
+//
+// Buckets live in a Store. MemoryStore keeps them in process, which is
+// enough for a single instance; RedisStore keeps them in any server that
+// speaks the Redis protocol and supports EVAL, so that several API instances
+// share one set of limits.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Limit describes a token bucket.
+type Limit struct {
+	// Rate is the refill rate in tokens per second.
+	Rate float64
+	// Burst is the bucket capacity, the number of requests allowed at once.
+	Burst int
+}
+
+// PerMinute returns a limit refilling n tokens per minute with the given
+// burst.
+func PerMinute(n, burst int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: burst}
+}
+
+// PerHour returns a limit refilling n tokens per hour with the given burst.
+func PerHour(n, burst int) Limit {
+	return Limit{Rate: float64(n) / 3600, Burst: burst}
+}
+
+// Window is the time an empty bucket needs to refill completely. It is
+// advertised as the policy window in RateLimit-Policy headers.
+func (l Limit) Window() time.Duration {
+	if l.Rate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(l.Burst) / l.Rate * float64(time.Second))
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d;w=%d", l.Burst, int(math.Ceil(l.Window().Seconds())))
+}
+
+// Result is the outcome of taking a token.
+type Result struct {
+	Allowed bool
+	// Limit is the bucket capacity.
+	Limit int
+	// Remaining is the number of whole tokens left after this request.
+	Remaining int
+	// RetryAfter is how long a rejected client has to wait for a token.
+	// It is zero for allowed requests.
+	RetryAfter time.Duration
+	// ResetAfter is how long until the bucket is full again.
+	ResetAfter time.Duration
+}
+
+// Store keeps token buckets. Take atomically refills the bucket stored
+// under key and takes one token from it if possible.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+}
+
+// bucket is the state shared by every store: the token count as of updated.
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// take refills b up to now and tries to take one token.
+func (b *bucket) take(limit Limit, now time.Time) Result {
+	capacity := float64(limit.Burst)
+
+	if b.updated.IsZero() {
+		b.tokens = capacity
+	} else if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(capacity, b.tokens+elapsed*limit.Rate)
+	}
+	b.updated = now
+
+	res := Result{Limit: limit.Burst}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / limit.Rate)
+	}
+
+	res.Remaining = int(math.Floor(b.tokens))
+	res.ResetAfter = seconds((capacity - b.tokens) / limit.Rate)
+
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	if math.IsInf(s, 0) || math.IsNaN(s) {
+		return 0
+	}
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,187 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStoreTokenBucket(t *testing.T) {
+	store := NewMemoryStore()
+	limit := PerMinute(60, 3)
+	now := time.Unix(1_700_000_000, 0)
+
+	for i := 2; i >= 0; i-- {
+		res, err := store.Take(context.Background(), "ip:1", limit, now)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, i, res.Remaining)
+	}
+
+	res, _ := store.Take(context.Background(), "ip:1", limit, now)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Second, res.RetryAfter)
+	assert.Equal(t, 3*time.Second, res.ResetAfter)
+
+	// other keys have their own bucket
+	res, _ = store.Take(context.Background(), "ip:2", limit, now)
+	assert.True(t, res.Allowed)
+
+	res, _ = store.Take(context.Background(), "ip:1", limit, now.Add(time.Second))
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+}
+
+func TestMemoryStoreSweepDropsFullBuckets(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Unix(1_700_000_000, 0)
+
+	store.Take(context.Background(), "a", PerMinute(60, 5), now)
+	store.Take(context.Background(), "b", PerHour(1, 5), now)
+
+	store.Sweep(now.Add(2 * time.Second))
+	assert.Equal(t, 1, store.Len())
+}
+
+func TestLimitString(t *testing.T) {
+	assert.Equal(t, "5;w=60", PerMinute(5, 5).String())
+	assert.Equal(t, "10;w=300", PerMinute(2, 10).String())
+}
+
+// standIn is a tiny Redis protocol server that understands EVALSHA and
+// EVAL of the take script, running the bucket logic in Go.
+type standIn struct {
+	ln      net.Listener
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	loaded  bool
+	calls   []string
+}
+
+func newStandIn(t *testing.T) *standIn {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &standIn{ln: ln, buckets: make(map[string]*bucket)}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+
+	return s
+}
+
+func (s *standIn) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *standIn) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return
+		}
+		args := make([]string, 0)
+		for _, a := range reply.([]any) {
+			args = append(args, a.(string))
+		}
+
+		s.mu.Lock()
+		s.calls = append(s.calls, args[0])
+
+		switch {
+		case args[0] == "EVALSHA" && !s.loaded:
+			fmt.Fprint(conn, "-NOSCRIPT No matching script.\r\n")
+		case args[0] == "EVAL" || args[0] == "EVALSHA":
+			s.loaded = true
+			key := args[3]
+			rate, _ := strconv.ParseFloat(args[4], 64)
+			burst, _ := strconv.Atoi(args[5])
+			ms, _ := strconv.ParseInt(args[6], 10, 64)
+
+			b, ok := s.buckets[key]
+			if !ok {
+				b = &bucket{}
+				s.buckets[key] = b
+			}
+			res := b.take(Limit{rate, burst}, time.UnixMilli(ms))
+
+			allowed := 0
+			if res.Allowed {
+				allowed = 1
+			}
+			fmt.Fprintf(conn, "*4\r\n:%d\r\n:%d\r\n:%d\r\n:%d\r\n", allowed, res.Remaining, res.RetryAfter.Milliseconds(), res.ResetAfter.Milliseconds())
+		default:
+			fmt.Fprint(conn, "-ERR unknown command\r\n")
+		}
+		s.mu.Unlock()
+	}
+}
+
+func TestRedisStoreAgainstStandIn(t *testing.T) {
+	server := newStandIn(t)
+
+	client, err := NewRedisClient("redis://" + server.ln.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+
+	store := NewRedisStore(client, "rl:")
+	limit := PerMinute(60, 2)
+	now := time.Unix(1_700_000_000, 0)
+
+	res, err := store.Take(context.Background(), "user:1", limit, now)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 1, res.Remaining)
+
+	store.Take(context.Background(), "user:1", limit, now)
+	res, err = store.Take(context.Background(), "user:1", limit, now)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Second, res.RetryAfter)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	assert.Equal(t, []string{"EVALSHA", "EVAL", "EVALSHA", "EVALSHA"}, server.calls)
+	assert.Contains(t, server.buckets, "rl:user:1")
+}
+
+func TestRedisClientReturnsServerErrors(t *testing.T) {
+	server := newStandIn(t)
+
+	client, err := NewRedisClient("redis://" + server.ln.Addr().String())
+	require.NoError(t, err)
+
+	_, err = client.Do(context.Background(), "FLUSHALL")
+	assert.Equal(t, RedisError("ERR unknown command"), err)
+
+	// the connection is still usable after an error reply
+	_, err = client.Do(context.Background(), "FLUSHALL")
+	assert.Error(t, err)
+}
+
+func TestNewRedisClientParsesURL(t *testing.T) {
+	c, err := NewRedisClient("redis://:secret@cache/2")
+	require.NoError(t, err)
+	assert.Equal(t, "cache:6379", c.addr)
+	assert.Equal(t, "secret", c.password)
+	assert.Equal(t, 2, c.db)
+
+	_, err = NewRedisClient("http://cache")
+	assert.Error(t, err)
+}
@@ -0,0 +1,229 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedisError is an error reply sent by the server.
+type RedisError string
+
+func (e RedisError) Error() string { return string(e) }
+
+// RedisClient is a minimal client for the Redis serialization protocol
+// (RESP2). It supports exactly what the rate limiter needs, so the store
+// works against Redis, Valkey, KeyDB or any local stand-in speaking the
+// protocol without pulling in a full driver.
+type RedisClient struct {
+	addr     string
+	password string
+	db       int
+	timeout  time.Duration
+	pool     chan *redisConn
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// NewRedisClient parses a redis://[:password@]host:port[/db] URL. No
+// connection is opened until the first command.
+func NewRedisClient(rawURL string) (*RedisClient, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("ratelimit: invalid redis url: %w", err)
+	}
+	if u.Scheme != "redis" {
+		return nil, fmt.Errorf("ratelimit: unsupported redis url scheme %q", u.Scheme)
+	}
+
+	c := &RedisClient{
+		addr:    u.Host,
+		timeout: 2 * time.Second,
+		pool:    make(chan *redisConn, 16),
+	}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if pw, ok := u.User.Password(); ok {
+		c.password = pw
+	}
+	if path := strings.Trim(u.Path, "/"); path != "" {
+		if c.db, err = strconv.Atoi(path); err != nil {
+			return nil, fmt.Errorf("ratelimit: invalid redis database %q", path)
+		}
+	}
+
+	return c, nil
+}
+
+// Do sends one command and returns its reply: string, int64, nil, []any or
+// a RedisError.
+func (c *RedisClient) Do(ctx context.Context, args ...string) (any, error) {
+	conn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := conn.do(ctx, c.timeout, args...)
+	if err != nil {
+		var redisErr RedisError
+		if !errors.As(err, &redisErr) {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	c.put(conn)
+	return reply, err
+}
+
+// Eval runs script with EVALSHA, loading it with EVAL the first time the
+// server does not know it.
+func (c *RedisClient) Eval(ctx context.Context, script string, keys []string, args ...string) (any, error) {
+	sum := sha1.Sum([]byte(script))
+
+	cmd := append([]string{"EVALSHA", hex.EncodeToString(sum[:]), strconv.Itoa(len(keys))}, keys...)
+	reply, err := c.Do(ctx, append(cmd, args...)...)
+
+	var redisErr RedisError
+	if errors.As(err, &redisErr) && strings.HasPrefix(string(redisErr), "NOSCRIPT") {
+		cmd = append([]string{"EVAL", script, strconv.Itoa(len(keys))}, keys...)
+		return c.Do(ctx, append(cmd, args...)...)
+	}
+
+	return reply, err
+}
+
+// Close closes idle connections.
+func (c *RedisClient) Close() error {
+	for {
+		select {
+		case conn := <-c.pool:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (c *RedisClient) get(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-c.pool:
+		return conn, nil
+	default:
+	}
+
+	dialer := net.Dialer{Timeout: c.timeout}
+	nc, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, fmt.Errorf("ratelimit: connecting to redis: %w", err)
+	}
+
+	conn := &redisConn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+
+	if c.password != "" {
+		if _, err := conn.do(ctx, c.timeout, "AUTH", c.password); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ratelimit: redis auth: %w", err)
+		}
+	}
+	if c.db != 0 {
+		if _, err := conn.do(ctx, c.timeout, "SELECT", strconv.Itoa(c.db)); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ratelimit: redis select: %w", err)
+		}
+	}
+
+	return conn, nil
+}
+
+func (c *RedisClient) put(conn *redisConn) {
+	select {
+	case c.pool <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+func (conn *redisConn) do(ctx context.Context, timeout time.Duration, args ...string) (any, error) {
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	fmt.Fprintf(conn.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(conn.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := conn.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	return readReply(conn.r)
+}
+
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("ratelimit: malformed redis reply %q", line)
+	}
+
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, RedisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		values := make([]any, n)
+		for i := range values {
+			// Error replies nested in an array are values, not failures.
+			v, err := readReply(r)
+			var redisErr RedisError
+			if err != nil && !errors.As(err, &redisErr) {
+				return nil, err
+			}
+			if err != nil {
+				v = redisErr
+			}
+			values[i] = v
+		}
+		return values, nil
+	}
+
+	return nil, fmt.Errorf("ratelimit: unknown redis reply type %q", kind)
+}
@@ -0,0 +1,127 @@
+// Package safehttp makes requests to URLs that users choose, such as alert
+// webhooks and push endpoints, without letting them point the server at its
+// own network: loopback, private ranges, link-local addresses like the
+// cloud metadata service at 169.254.169.254, and the like.
+//
+// Addresses are checked when the connection is dialled, after DNS has been
+// resolved, so a public name resolving to a private address is refused as
+// well, and so is every redirect, which dials anew.
+package safehttp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// maxRedirects is how many redirects a request follows.
+const maxRedirects = 5
+
+// ErrForbiddenAddress is returned for destinations that are not on the
+// public internet.
+var ErrForbiddenAddress = errors.New("destination is not a public address")
+
+// blocked lists the special-purpose ranges netip has no predicate for.
+var blocked = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"),  // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),  // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),    // reserved, and broadcast
+	netip.MustParsePrefix("64:ff9b:1::/48"), // local-use NAT64
+	netip.MustParsePrefix("fec0::/10"),      // deprecated site-local
+	netip.MustParsePrefix("100::/64"),       // discard-only
+}
+
+// Public reports whether ip is an address on the public internet.
+func Public(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsValid() ||
+		ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified() {
+		return false
+	}
+	for _, p := range blocked {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckURL rejects URLs that plainly point at a non-public host: an IP
+// literal outside the public internet or a localhost name. It lets users
+// know when they subscribe; names resolving to private addresses are only
+// caught when dialling.
+func CheckURL(u *url.URL) error {
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrForbiddenAddress
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && !Public(ip) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// NewClient returns a client that only connects to public addresses and
+// follows at most a few redirects, all over http or https. It ignores the
+// proxy environment, since a proxy would dial on the client's behalf.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+		Control:   control,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:       timeout,
+		Transport:     transport,
+		CheckRedirect: checkRedirect,
+	}
+}
+
+// control runs for every connection after name resolution, with the
+// address actually being dialled.
+func control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !Public(ip) {
+		return fmt.Errorf("dialling %s: %w", ip, ErrForbiddenAddress)
+	}
+	return nil
+}
+
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return fmt.Errorf("redirect to %s URL", req.URL.Scheme)
+	}
+	if err := CheckURL(req.URL); err != nil {
+		return fmt.Errorf("redirect to %s: %w", req.URL.Host, err)
+	}
+	return nil
+}
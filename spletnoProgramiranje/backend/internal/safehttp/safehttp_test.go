@@ -0,0 +1,77 @@
+package safehttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublic(t *testing.T) {
+	for _, ip := range []string{"93.184.216.34", "2606:2800:220:1:248:1893:25c8:1946", "8.8.8.8"} {
+		assert.True(t, Public(netip.MustParseAddr(ip)), ip)
+	}
+	for _, ip := range []string{
+		"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254",
+		"100.64.0.1", "0.0.0.0", "255.255.255.255", "224.0.0.1",
+		"::1", "::", "fe80::1", "fc00::1", "::ffff:127.0.0.1", "::ffff:169.254.169.254",
+	} {
+		assert.False(t, Public(netip.MustParseAddr(ip)), ip)
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	for raw, ok := range map[string]bool{
+		"https://hooks.example.com/x":        true,
+		"https://93.184.216.34/x":            true,
+		"http://localhost:8080/x":            false,
+		"http://api.localhost./x":            false,
+		"http://127.0.0.1/x":                 false,
+		"http://169.254.169.254/latest/meta": false,
+		"http://[::1]:9000/x":                false,
+		"http://10.0.0.7/x":                  false,
+	} {
+		u, err := url.Parse(raw)
+		require.NoError(t, err)
+		if ok {
+			assert.NoError(t, CheckURL(u), raw)
+		} else {
+			assert.ErrorIs(t, CheckURL(u), ErrForbiddenAddress, raw)
+		}
+	}
+}
+
+func TestClientRefusesLoopback(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	// A name that resolves to the server is refused as well as the literal.
+	for _, target := range []string{srv.URL, "http://localhost:" + srv.URL[len("http://127.0.0.1:"):]} {
+		_, err := NewClient(time.Second).Get(target)
+		assert.ErrorIs(t, err, ErrForbiddenAddress, target)
+	}
+	assert.False(t, called)
+}
+
+func TestRedirectsToPrivateAddressesAreRefused(t *testing.T) {
+	via := []*http.Request{httptest.NewRequest("GET", "https://hooks.example.com/", nil)}
+
+	req := httptest.NewRequest("GET", "http://169.254.169.254/latest/meta-data/", nil)
+	assert.ErrorIs(t, checkRedirect(req, via), ErrForbiddenAddress)
+
+	req = httptest.NewRequest("GET", "https://other.example.com/", nil)
+	assert.NoError(t, checkRedirect(req, via))
+
+	for len(via) < maxRedirects {
+		via = append(via, via[0])
+	}
+	assert.Error(t, checkRedirect(req, via), "too many redirects")
+}
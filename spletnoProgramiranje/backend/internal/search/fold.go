@@ -0,0 +1,45 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// folds spells letters with diacritics the way riders type them on a
+// keyboard without them: Slovenian č, š and ž, the ć and đ of names from
+// elsewhere in the region, and the accented letters of foreign names.
+var folds = map[rune]string{
+	'č': "c", 'ć': "c", 'š': "s", 'ž': "z", 'đ': "d",
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ě': "e",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ů': "u",
+	'ñ': "n", 'ń': "n", 'ň': "n", 'ý': "y", 'ÿ': "y",
+	'ł': "l", 'ľ': "l", 'ř': "r", 'ŕ': "r", 'ť': "t", 'ď': "d",
+	'ß': "ss",
+}
+
+// Fold lowercases s and spells it without diacritics, so "Črna" and "crna"
+// compare equal.
+func Fold(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		r = unicode.ToLower(r)
+		if f, ok := folds[r]; ok {
+			b.WriteString(f)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Words splits s into its folded words, dropping punctuation, so
+// "Tržaška c. - Ptujska" is trzaska, c and ptujska.
+func Words(s string) []string {
+	return strings.FieldsFunc(Fold(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
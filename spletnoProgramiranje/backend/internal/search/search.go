@@ -0,0 +1,273 @@
+// Package search finds stops by name as riders type it: without diacritics,
+// with a typo or two, and before they have finished the word.
+//
+// Stops are grouped by name, since most named stops are several poles with
+// their own numbers, one per direction or platform. Groups are ranked by how
+// well their name matches, how many departures they have and, when the
+// rider's position is known, how close they are.
+package search
+
+import (
+	"backend/internal/data"
+	"backend/internal/geo"
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	// textWeight makes the match count for more than popularity and
+	// distance, each of which scores at most 1.
+	textWeight = 3
+	// nearMeters is the distance at which proximity scores a half.
+	nearMeters = 1000
+)
+
+// Query is a search for stops.
+type Query struct {
+	Text string
+	// Lat and Lon rank nearer stops higher when Located is set.
+	Lat, Lon float64
+	Located  bool
+	// Limit caps the results; zero means no cap.
+	Limit int
+}
+
+// Result is the stops of one name that match a query.
+type Result struct {
+	Name string
+	// Stops are the poles of the name, by number.
+	Stops []data.Stop
+	// Departures is how many departures a day the stops have together.
+	Departures int
+	// DistanceMeters is from the query's position to the nearest of the
+	// stops, when it is located.
+	DistanceMeters float64
+	Score          float64
+}
+
+// group is the stops sharing a folded name.
+type group struct {
+	name       string
+	words      []string
+	stops      []data.Stop
+	departures int
+}
+
+// Index holds the stops to search. It is read-only once built and safe for
+// concurrent searches.
+type Index struct {
+	groups        []group
+	maxDepartures int
+}
+
+// NewIndex indexes the stops, with the departures a day of each by stop ID
+// as their popularity.
+func NewIndex(stops []data.Stop, departures map[int]int) *Index {
+	byKey := map[string]*group{}
+	spellings := map[string]map[string]int{}
+	var keys []string
+
+	for _, s := range stops {
+		words := Words(s.Name)
+		if len(words) == 0 {
+			continue
+		}
+		key := strings.Join(words, " ")
+		g, ok := byKey[key]
+		if !ok {
+			g = &group{words: words}
+			byKey[key] = g
+			spellings[key] = map[string]int{}
+			keys = append(keys, key)
+		}
+		g.stops = append(g.stops, s)
+		g.departures += departures[s.ID]
+		spellings[key][s.Name]++
+	}
+
+	ix := &Index{groups: make([]group, 0, len(keys))}
+	for _, key := range keys {
+		g := byKey[key]
+		g.name = CommonSpelling(spellings[key])
+		sort.Slice(g.stops, func(i, j int) bool {
+			if g.stops[i].Number != g.stops[j].Number {
+				return g.stops[i].Number < g.stops[j].Number
+			}
+			return g.stops[i].ID < g.stops[j].ID
+		})
+		ix.groups = append(ix.groups, *g)
+		ix.maxDepartures = max(ix.maxDepartures, g.departures)
+	}
+
+	return ix
+}
+
+// CommonSpelling picks the name most of a group of stops are spelled with,
+// given how many stops use each spelling. Ties go to the spelling with
+// diacritics, which is usually the correct one, and then the first
+// alphabetically.
+func CommonSpelling(counts map[string]int) string {
+	best := ""
+	for name, n := range counts {
+		switch {
+		case best == "",
+			n > counts[best],
+			n == counts[best] && len(name) > len(best),
+			n == counts[best] && len(name) == len(best) && name < best:
+			best = name
+		}
+	}
+	return best
+}
+
+// Search returns the groups matching every word of the query, best first.
+func (ix *Index) Search(q Query) []Result {
+	words := Words(q.Text)
+	if len(words) == 0 {
+		return nil
+	}
+
+	var results []Result
+	for _, g := range ix.groups {
+		text, ok := matchWords(words, g)
+		if !ok {
+			continue
+		}
+
+		r := Result{Name: g.name, Stops: g.stops, Departures: g.departures}
+		r.Score = textWeight * text
+		if ix.maxDepartures > 0 {
+			r.Score += math.Log1p(float64(g.departures)) / math.Log1p(float64(ix.maxDepartures))
+		}
+		if q.Located {
+			r.DistanceMeters = math.Inf(1)
+			for _, s := range g.stops {
+				r.DistanceMeters = math.Min(r.DistanceMeters, geo.DistanceMeters(q.Lat, q.Lon, s.Latitude, s.Longitude))
+			}
+			r.Score += 1 / (1 + r.DistanceMeters/nearMeters)
+		}
+		results = append(results, r)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Name < results[j].Name
+	})
+	if q.Limit > 0 && len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+
+	return results
+}
+
+// matchWords scores how well the query words match a group, from 0 to a
+// little over 1, and reports whether each of them matches one of its
+// words. A word that is all digits also matches the start of a stop number.
+func matchWords(words []string, g group) (float64, bool) {
+	var total float64
+	for i, w := range words {
+		best := 0.0
+		for j, name := range g.words {
+			score := matchWord(w, name)
+			if i == 0 && j == 0 && score > 0 {
+				// Names starting with what the rider typed first come
+				// before those merely containing it.
+				score += 0.05
+			}
+			best = math.Max(best, score)
+		}
+		if best == 0 && isNumber(w) {
+			for _, s := range g.stops {
+				if strings.HasPrefix(s.Number, w) {
+					best = 1
+					break
+				}
+			}
+		}
+		if best == 0 {
+			return 0, false
+		}
+		total += best
+	}
+	return total / float64(len(words)), true
+}
+
+// matchWord scores a query word against a word of a name: 1 for the whole
+// word, 0.9 for its start and less for a start with typos, down to 0 for no
+// match. Typos are not looked for in the first letter, which riders rarely
+// get wrong and which keeps short words from matching half the names.
+func matchWord(q, name string) float64 {
+	if q == name {
+		return 1
+	}
+	if strings.HasPrefix(name, q) {
+		return 0.9
+	}
+	qr, nr := []rune(q), []rune(name)
+	if qr[0] != nr[0] {
+		return 0
+	}
+	typos := prefixDistance(qr, nr)
+	if typos > allowedTypos(len(qr)) {
+		return 0
+	}
+	return 0.7 - 0.15*float64(typos-1)
+}
+
+// allowedTypos grows with the word: none for one or two letters, where any
+// typo would match half the city, one up to five letters and two beyond.
+func allowedTypos(n int) int {
+	switch {
+	case n <= 2:
+		return 0
+	case n <= 5:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// prefixDistance is the fewest edits, counting a swap of neighbouring
+// letters as one, that turn q into some start of word.
+func prefixDistance(q, word []rune) int {
+	// d[i][j] is the distance between q[:i] and word[:j].
+	d := make([][]int, len(q)+1)
+	for i := range d {
+		d[i] = make([]int, len(word)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(q); i++ {
+		for j := 1; j <= len(word); j++ {
+			cost := 1
+			if q[i-1] == word[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && q[i-1] == word[j-2] && q[i-2] == word[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+
+	best := len(q)
+	for _, v := range d[len(q)] {
+		best = min(best, v)
+	}
+	return best
+}
+
+func isNumber(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,106 @@
+package search
+
+import (
+	"backend/internal/data"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testStops = []data.Stop{
+	{ID: 1, Number: "101", Name: "Črna pri Kamniku", Latitude: 46.30, Longitude: 14.60},
+	{ID: 2, Number: "102", Name: "Črna pri Kamniku", Latitude: 46.30, Longitude: 14.61},
+	{ID: 3, Number: "201", Name: "Tržaška c. - Ptujska", Latitude: 46.54, Longitude: 15.66},
+	{ID: 4, Number: "301", Name: "Tabor", Latitude: 46.55, Longitude: 15.64},
+	{ID: 5, Number: "302", Name: "Tabor", Latitude: 46.55, Longitude: 15.65},
+	{ID: 6, Number: "401", Name: "Gosposvetska - Tabor", Latitude: 46.56, Longitude: 15.63},
+	{ID: 7, Number: "501", Name: "Tezno", Latitude: 46.53, Longitude: 15.67},
+	{ID: 8, Number: "502", Name: "Tezenska dobrava", Latitude: 46.50, Longitude: 15.70},
+	// Spelt without diacritics, as in some older timetables.
+	{ID: 9, Number: "103", Name: "Crna pri Kamniku", Latitude: 46.30, Longitude: 14.62},
+}
+
+func names(results []Result) []string {
+	out := make([]string, len(results))
+	for i, r := range results {
+		out[i] = r.Name
+	}
+	return out
+}
+
+func TestFold(t *testing.T) {
+	assert.Equal(t, "crna", Fold("Črna"))
+	assert.Equal(t, "trzaska", Fold("TRŽAŠKA"))
+	assert.Equal(t, "dakovica", Fold("Đakovica"))
+	assert.Equal(t, []string{"trzaska", "c", "ptujska"}, Words("Tržaška c. - Ptujska"))
+}
+
+func TestSearchIgnoresDiacritics(t *testing.T) {
+	ix := NewIndex(testStops, nil)
+
+	for _, q := range []string{"Crna", "črna", "CRNA pri"} {
+		results := ix.Search(Query{Text: q})
+		require.Len(t, results, 1, q)
+		assert.Equal(t, "Črna pri Kamniku", results[0].Name, "the spelling with diacritics wins")
+
+		numbers := []string{}
+		for _, s := range results[0].Stops {
+			numbers = append(numbers, s.Number)
+		}
+		assert.Equal(t, []string{"101", "102", "103"}, numbers, "stops are grouped across numbers")
+	}
+
+	assert.Equal(t, []string{"Tržaška c. - Ptujska"}, names(ix.Search(Query{Text: "trzaska"})))
+}
+
+func TestSearchToleratesTypos(t *testing.T) {
+	ix := NewIndex(testStops, nil)
+
+	assert.Equal(t, []string{"Tržaška c. - Ptujska"}, names(ix.Search(Query{Text: "trzasak"})), "a swap is one typo")
+	assert.Equal(t, []string{"Gosposvetska - Tabor"}, names(ix.Search(Query{Text: "gospsvet"})))
+	assert.Empty(t, ix.Search(Query{Text: "tx"}), "no typos in two letters")
+	assert.Empty(t, ix.Search(Query{Text: "zabor"}), "no typos in the first letter")
+	assert.Empty(t, ix.Search(Query{Text: "tbx"}), "two typos are too many in three letters")
+}
+
+func TestSearchRanking(t *testing.T) {
+	ix := NewIndex(testStops, map[int]int{4: 100, 5: 100, 6: 10, 7: 400, 8: 50})
+
+	assert.Equal(t, []string{"Tabor", "Gosposvetska - Tabor"}, names(ix.Search(Query{Text: "tabor"})),
+		"a name starting with the query comes first")
+	assert.Equal(t, []string{"Tezno", "Tezenska dobrava", "Tržaška c. - Ptujska"}, names(ix.Search(Query{Text: "tez"})),
+		"the busier stop comes first and typos last")
+
+	near := ix.Search(Query{Text: "tez", Lat: 46.50, Lon: 15.70, Located: true})
+	assert.Equal(t, []string{"Tezenska dobrava", "Tezno"}, names(near)[:2], "unless the other is nearer")
+	assert.InDelta(t, 0, near[0].DistanceMeters, 1)
+
+	results := ix.Search(Query{Text: "tabor", Limit: 1})
+	require.Len(t, results, 1)
+	assert.Equal(t, 200, results[0].Departures)
+}
+
+func TestSearchByNumber(t *testing.T) {
+	ix := NewIndex(testStops, nil)
+
+	assert.Equal(t, []string{"Tabor"}, names(ix.Search(Query{Text: "30"})))
+	assert.Empty(t, ix.Search(Query{Text: " - "}))
+}
+
+func TestPrefixDistance(t *testing.T) {
+	tests := []struct {
+		q, word string
+		want    int
+	}{
+		{"tab", "tabor", 0},
+		{"tbaor", "tabor", 1},
+		{"tavor", "tabor", 1},
+		{"tabr", "tabor", 1},
+		{"tabbor", "tabor", 1},
+		{"tezno", "tez", 2},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, prefixDistance([]rune(tt.q), []rune(tt.word)), tt.q)
+	}
+}
@@ -0,0 +1,46 @@
+package tracing
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Middleware starts a server span for every request, continuing any trace
+// passed in a traceparent header. The span is renamed to the chi route
+// pattern once routing is done, so span names stay low-cardinality. The
+// trace ID is echoed in the traceparent response header.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := Extract(r.Context(), r.Header)
+		ctx, span := Start(ctx, r.Method, WithKind(KindServer), WithAttributes(
+			String("http.request.method", r.Method),
+			String("url.path", r.URL.Path),
+			String("client.address", r.RemoteAddr),
+			String("user_agent.original", r.UserAgent()),
+			String("http.request_id", middleware.GetReqID(r.Context())),
+		))
+		defer span.End()
+
+		Inject(ctx, w.Header())
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+			span.SetAttributes(String("http.route", rctx.RoutePattern()))
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(Int("http.response.status_code", status))
+		if status >= 500 {
+			span.SetStatus(StatusError, strconv.Itoa(status))
+		}
+	})
+}
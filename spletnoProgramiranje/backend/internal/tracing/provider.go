@@ -0,0 +1,145 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Exporter ships finished spans to a backend.
+type Exporter interface {
+	Export(ctx context.Context, spans []*Span) error
+	Shutdown(ctx context.Context) error
+}
+
+// Provider batches finished spans and exports them in the background.
+type Provider struct {
+	exporter  Exporter
+	onError   func(error)
+	queue     chan *Span
+	batchSize int
+	interval  time.Duration
+
+	wg       sync.WaitGroup
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// Options configures NewProvider. Zero values select sensible defaults.
+type Options struct {
+	QueueSize     int
+	BatchSize     int
+	FlushInterval time.Duration
+	OnError       func(error)
+}
+
+func NewProvider(exporter Exporter, opts Options) *Provider {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 2048
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 256
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 5 * time.Second
+	}
+	if opts.OnError == nil {
+		opts.OnError = func(error) {}
+	}
+
+	p := &Provider{
+		exporter:  exporter,
+		onError:   opts.OnError,
+		queue:     make(chan *Span, opts.QueueSize),
+		batchSize: opts.BatchSize,
+		interval:  opts.FlushInterval,
+		stop:      make(chan struct{}),
+	}
+
+	p.wg.Add(1)
+	go p.loop()
+
+	return p
+}
+
+// enqueue drops spans when the queue is full rather than blocking requests.
+func (p *Provider) enqueue(s *Span) {
+	select {
+	case p.queue <- s:
+	default:
+	}
+}
+
+func (p *Provider) loop() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, p.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := p.exporter.Export(ctx, batch); err != nil {
+			p.onError(err)
+		}
+		cancel()
+		batch = make([]*Span, 0, p.batchSize)
+	}
+
+	for {
+		select {
+		case s := <-p.queue:
+			batch = append(batch, s)
+			if len(batch) >= p.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-p.stop:
+			for {
+				select {
+				case s := <-p.queue:
+					batch = append(batch, s)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// Shutdown flushes queued spans and closes the exporter.
+func (p *Provider) Shutdown(ctx context.Context) error {
+	p.stopOnce.Do(func() { close(p.stop) })
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return p.exporter.Shutdown(ctx)
+}
+
+var globalProvider atomic.Pointer[Provider]
+
+// SetProvider installs p as the destination of every span started through
+// Start. A nil provider disables export while keeping ID generation.
+func SetProvider(p *Provider) {
+	globalProvider.Store(p)
+}
+
+func global() *Provider {
+	return globalProvider.Load()
+}
@@ -0,0 +1,222 @@
+// Package tracing is a lightweight OpenTelemetry-compatible tracer. Spans
+// carry W3C trace context, propagate through context.Context and HTTP
+// headers, and are exported either as OTLP/HTTP JSON to a collector or as
+// JSON lines to stdout for local development.
+//
+// Trace and span IDs are always generated, even when no exporter is
+// configured, so that trace IDs can be attached to logs and error responses
+// regardless of the export setup.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type TraceID [16]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (t TraceID) IsValid() bool  { return t != TraceID{} }
+
+type SpanID [8]byte
+
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+func (s SpanID) IsValid() bool  { return s != SpanID{} }
+
+// SpanKind values match the OTLP enumeration.
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+// StatusCode values match the OTLP enumeration.
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// Attr is a single span attribute. Value is a string, bool, int64 or float64.
+type Attr struct {
+	Key   string
+	Value any
+}
+
+func String(key, value string) Attr    { return Attr{key, value} }
+func Int(key string, value int) Attr   { return Attr{key, int64(value)} }
+func Int64(key string, v int64) Attr   { return Attr{key, v} }
+func Bool(key string, value bool) Attr { return Attr{key, value} }
+
+type Event struct {
+	Name  string
+	Time  time.Time
+	Attrs []Attr
+}
+
+// Span is a single timed operation. A nil *Span is valid and ignores every
+// call, which keeps instrumentation free of nil checks.
+type Span struct {
+	mu sync.Mutex
+
+	Name      string
+	Kind      SpanKind
+	TraceID   TraceID
+	SpanID    SpanID
+	ParentID  SpanID
+	StartTime time.Time
+	EndTime   time.Time
+	Attrs     []Attr
+	Events    []Event
+	Status    StatusCode
+	StatusMsg string
+
+	ended    bool
+	provider *Provider
+}
+
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.Name = name
+	s.mu.Unlock()
+}
+
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.Attrs = append(s.Attrs, attrs...)
+	s.mu.Unlock()
+}
+
+func (s *Span) SetStatus(code StatusCode, msg string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.Status = code
+	s.StatusMsg = msg
+	s.mu.Unlock()
+}
+
+// RecordError attaches err as an exception event and marks the span failed.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.Events = append(s.Events, Event{
+		Name:  "exception",
+		Time:  time.Now(),
+		Attrs: []Attr{String("exception.message", err.Error()), String("exception.type", fmt.Sprintf("%T", err))},
+	})
+	s.Status = StatusError
+	s.StatusMsg = err.Error()
+	s.mu.Unlock()
+}
+
+// Fail records err on the span and returns it, so error returns can stay
+// one-liners: return nil, span.Fail(err).
+func (s *Span) Fail(err error) error {
+	s.RecordError(err)
+	return err
+}
+
+// End finishes the span and hands it to the exporter. Calling End more than
+// once has no effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.mu.Unlock()
+
+	if s.provider != nil {
+		s.provider.enqueue(s)
+	}
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying span as the active span.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the active span, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// TraceIDFromContext returns the hex trace ID of the active span, or "".
+func TraceIDFromContext(ctx context.Context) string {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.TraceID.String()
+	}
+	return ""
+}
+
+type remoteKey struct{}
+
+type remoteParent struct {
+	traceID TraceID
+	spanID  SpanID
+}
+
+// StartOption customises a new span.
+type StartOption func(*Span)
+
+func WithKind(kind SpanKind) StartOption {
+	return func(s *Span) { s.Kind = kind }
+}
+
+func WithAttributes(attrs ...Attr) StartOption {
+	return func(s *Span) { s.Attrs = append(s.Attrs, attrs...) }
+}
+
+// Start begins a span as a child of the active span in ctx, of a remote
+// parent extracted from request headers, or as a new root.
+func Start(ctx context.Context, name string, opts ...StartOption) (context.Context, *Span) {
+	span := &Span{
+		Name:      name,
+		Kind:      KindInternal,
+		StartTime: time.Now(),
+		provider:  global(),
+	}
+
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.TraceID = parent.TraceID
+		span.ParentID = parent.SpanID
+	} else if remote, ok := ctx.Value(remoteKey{}).(remoteParent); ok {
+		span.TraceID = remote.traceID
+		span.ParentID = remote.spanID
+	} else {
+		rand.Read(span.TraceID[:])
+	}
+	rand.Read(span.SpanID[:])
+
+	for _, opt := range opts {
+		opt(span)
+	}
+
+	return ContextWithSpan(ctx, span), span
+}
@@ -0,0 +1,109 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (e *memoryExporter) Export(_ context.Context, spans []*Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *memoryExporter) Shutdown(context.Context) error { return nil }
+
+func TestChildSpanInheritsTrace(t *testing.T) {
+	ctx, parent := Start(context.Background(), "parent")
+	_, child := Start(ctx, "child")
+
+	assert.True(t, parent.TraceID.IsValid())
+	assert.Equal(t, parent.TraceID, child.TraceID)
+	assert.Equal(t, parent.SpanID, child.ParentID)
+	assert.NotEqual(t, parent.SpanID, child.SpanID)
+}
+
+func TestExtractAndInject(t *testing.T) {
+	h := http.Header{}
+	h.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	ctx := Extract(context.Background(), h)
+	ctx, span := Start(ctx, "server")
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", span.ParentID.String())
+
+	out := http.Header{}
+	Inject(ctx, out)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+span.SpanID.String()+"-01", out.Get("traceparent"))
+}
+
+func TestExtractIgnoresMalformedHeader(t *testing.T) {
+	h := http.Header{}
+	h.Set("traceparent", "00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+
+	_, span := Start(Extract(context.Background(), h), "server")
+
+	assert.False(t, span.ParentID.IsValid())
+}
+
+func TestProviderExportsOnShutdown(t *testing.T) {
+	exp := &memoryExporter{}
+	p := NewProvider(exp, Options{FlushInterval: time.Hour})
+	SetProvider(p)
+	defer SetProvider(nil)
+
+	_, span := Start(context.Background(), "work")
+	span.RecordError(errors.New("boom"))
+	span.End()
+	span.End()
+
+	require.NoError(t, p.Shutdown(context.Background()))
+	require.Len(t, exp.spans, 1)
+	assert.Equal(t, StatusError, exp.spans[0].Status)
+}
+
+func TestOTLPExporterPostsJSON(t *testing.T) {
+	var body map[string]any
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+	}))
+	defer collector.Close()
+
+	_, span := Start(context.Background(), "query", WithKind(KindClient), WithAttributes(String("db.statement", "SELECT 1"), Int("db.rows", 1)))
+	span.End()
+
+	exp := NewOTLPExporter(collector.URL, Resource{ServiceName: "test"})
+	require.NoError(t, exp.Export(context.Background(), []*Span{span}))
+
+	spans := body["resourceSpans"].([]any)[0].(map[string]any)["scopeSpans"].([]any)[0].(map[string]any)["spans"].([]any)
+	require.Len(t, spans, 1)
+	assert.Equal(t, span.TraceID.String(), spans[0].(map[string]any)["traceId"])
+	assert.Equal(t, float64(KindClient), spans[0].(map[string]any)["kind"])
+}
+
+func TestStdoutExporter(t *testing.T) {
+	var buf bytes.Buffer
+	_, span := Start(context.Background(), "dev")
+	span.End()
+
+	require.NoError(t, NewStdoutExporter(&buf).Export(context.Background(), []*Span{span}))
+	assert.Contains(t, buf.String(), `"name":"dev"`)
+}
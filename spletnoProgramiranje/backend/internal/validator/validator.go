@@ -0,0 +1,271 @@
+// Package validator checks request payloads against rules declared in
+// `validate` struct tags, for example:
+//
+//	type RegisterUserPayload struct {
+//		Email    string `json:"email" validate:"required,email,max=100"`
+//		Password string `json:"password" validate:"required,password"`
+//	}
+//
+// Every rule of every field is evaluated, so a single call reports all
+// problems of a payload at once. Field names in the result follow the json
+// tag so they match what the client sent.
+package validator
+
+import (
+	"backend/internal/data"
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const tagName = "validate"
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Struct validates v, which must be a struct or a pointer to one. It returns
+// nil when every rule holds and a *data.ValidationError otherwise.
+func Struct(v any) error {
+	val := reflect.ValueOf(v)
+	for val.Kind() == reflect.Pointer {
+		if val.IsNil() {
+			return data.NewValidationError("body", "required", "must not be empty")
+		}
+		val = val.Elem()
+	}
+
+	if val.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validator: expected a struct, got %s", val.Kind()))
+	}
+
+	verr := &data.ValidationError{}
+	validateStruct(val, "", verr)
+
+	if verr.HasErrors() {
+		return verr
+	}
+
+	return nil
+}
+
+func validateStruct(val reflect.Value, prefix string, verr *data.ValidationError) {
+	typ := val.Type()
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := prefix + fieldName(field)
+		fv := val.Field(i)
+
+		if tag, ok := field.Tag.Lookup(tagName); ok && tag != "-" {
+			validateField(fv, name, tag, verr)
+		}
+
+		inner := fv
+		if inner.Kind() == reflect.Pointer && !inner.IsNil() {
+			inner = inner.Elem()
+		}
+		if inner.Kind() == reflect.Struct && inner.Type() != timeType {
+			validateStruct(inner, name+".", verr)
+		}
+	}
+}
+
+func fieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+func validateField(fv reflect.Value, name, tag string, verr *data.ValidationError) {
+	rules := strings.Split(tag, ",")
+
+	if isZero(fv) {
+		for _, rule := range rules {
+			switch rule {
+			case "required":
+				verr.Add(name, "required", "is required")
+				return
+			case "omitempty":
+				return
+			}
+		}
+	}
+
+	if fv.Kind() == reflect.Pointer {
+		if fv.IsNil() {
+			return
+		}
+		fv = fv.Elem()
+	}
+
+	for _, rule := range rules {
+		key, param, _ := strings.Cut(rule, "=")
+
+		switch key {
+		case "required", "omitempty", "":
+		case "min":
+			checkMin(fv, name, param, verr)
+		case "max":
+			checkMax(fv, name, param, verr)
+		case "email":
+			if _, err := mail.ParseAddress(fv.String()); err != nil || strings.ContainsAny(fv.String(), "<> ") {
+				verr.Add(name, "invalid_email", "must be a valid email address")
+			}
+		case "password":
+			checkPassword(fv.String(), name, verr)
+		case "latitude":
+			if f := fv.Float(); f < -90 || f > 90 {
+				verr.Add(name, "out_of_range", "must be between -90 and 90")
+			}
+		case "longitude":
+			if f := fv.Float(); f < -180 || f > 180 {
+				verr.Add(name, "out_of_range", "must be between -180 and 180")
+			}
+		case "oneof":
+			checkOneOf(fv, name, strings.Fields(param), verr)
+		case "clock":
+			if _, err := time.Parse("15:04", fv.String()); err != nil || len(fv.String()) != len("15:04") {
+				verr.Add(name, "invalid_time", "must be a time of day formatted as HH:MM")
+			}
+		default:
+			panic(fmt.Sprintf("validator: unknown rule %q on field %s", key, name))
+		}
+	}
+}
+
+func isZero(fv reflect.Value) bool {
+	if fv.Kind() == reflect.Pointer || fv.Kind() == reflect.Slice || fv.Kind() == reflect.Map {
+		return fv.IsNil() || (fv.Kind() != reflect.Pointer && fv.Len() == 0)
+	}
+	if fv.Kind() == reflect.String {
+		return strings.TrimSpace(fv.String()) == ""
+	}
+	return fv.IsZero()
+}
+
+func checkMin(fv reflect.Value, name, param string, verr *data.ValidationError) {
+	switch fv.Kind() {
+	case reflect.String:
+		n := mustInt(param)
+		if utf8.RuneCountInString(fv.String()) < n {
+			verr.Add(name, "too_short", fmt.Sprintf("must be at least %d characters long", n))
+		}
+	case reflect.Slice, reflect.Map:
+		n := mustInt(param)
+		if fv.Len() < n {
+			verr.Add(name, "too_few", fmt.Sprintf("must contain at least %d items", n))
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if fv.Int() < int64(mustInt(param)) {
+			verr.Add(name, "too_small", "must be at least "+param)
+		}
+	case reflect.Float32, reflect.Float64:
+		if fv.Float() < mustFloat(param) {
+			verr.Add(name, "too_small", "must be at least "+param)
+		}
+	}
+}
+
+func checkMax(fv reflect.Value, name, param string, verr *data.ValidationError) {
+	switch fv.Kind() {
+	case reflect.String:
+		n := mustInt(param)
+		if utf8.RuneCountInString(fv.String()) > n {
+			verr.Add(name, "too_long", fmt.Sprintf("must be at most %d characters long", n))
+		}
+	case reflect.Slice, reflect.Map:
+		n := mustInt(param)
+		if fv.Len() > n {
+			verr.Add(name, "too_many", fmt.Sprintf("must contain at most %d items", n))
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if fv.Int() > int64(mustInt(param)) {
+			verr.Add(name, "too_large", "must be at most "+param)
+		}
+	case reflect.Float32, reflect.Float64:
+		if fv.Float() > mustFloat(param) {
+			verr.Add(name, "too_large", "must be at most "+param)
+		}
+	}
+}
+
+// maxPasswordBytes is where bcrypt stops reading a password; anything past
+// it would be silently ignored.
+const maxPasswordBytes = 72
+
+// checkPassword requires at least 8 characters mixing letters and digits,
+// and at most maxPasswordBytes bytes.
+func checkPassword(pw, name string, verr *data.ValidationError) {
+	if len(pw) > maxPasswordBytes {
+		verr.Add(name, "too_long", fmt.Sprintf("must be at most %d bytes long", maxPasswordBytes))
+		return
+	}
+
+	var hasLetter, hasDigit bool
+	for _, r := range pw {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+
+	if utf8.RuneCountInString(pw) < 8 || !hasLetter || !hasDigit {
+		verr.Add(name, "weak_password", "must be at least 8 characters long and contain both letters and digits")
+	}
+}
+
+// checkOneOf applies to every element of a slice and to the value itself
+// otherwise.
+func checkOneOf(fv reflect.Value, name string, allowed []string, verr *data.ValidationError) {
+	values := []reflect.Value{fv}
+	if fv.Kind() == reflect.Slice {
+		values = values[:0]
+		for i := 0; i < fv.Len(); i++ {
+			values = append(values, fv.Index(i))
+		}
+	}
+
+	for _, v := range values {
+		if !oneOf(fmt.Sprint(v.Interface()), allowed) {
+			verr.Add(name, "not_allowed", "must be one of: "+strings.Join(allowed, ", "))
+			return
+		}
+	}
+}
+
+func oneOf(v string, allowed []string) bool {
+	for _, a := range allowed {
+		if v == a {
+			return true
+		}
+	}
+	return false
+}
+
+func mustInt(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		panic(fmt.Sprintf("validator: invalid integer parameter %q", s))
+	}
+	return n
+}
+
+func mustFloat(s string) float64 {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		panic(fmt.Sprintf("validator: invalid number parameter %q", s))
+	}
+	return f
+}
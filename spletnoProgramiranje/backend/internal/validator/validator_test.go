@@ -0,0 +1,123 @@
+package validator
+
+import (
+	"backend/internal/data"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testPayload struct {
+	Name     string    `json:"name" validate:"required,min=3,max=10"`
+	Email    string    `json:"email" validate:"required,email"`
+	Password string    `json:"password" validate:"omitempty,password"`
+	Lat      float64   `json:"lat" validate:"latitude"`
+	Radius   int       `json:"radius" validate:"min=1,max=5000"`
+	Mode     string    `json:"mode" validate:"omitempty,oneof=walk bus"`
+	Days     []string  `json:"days" validate:"omitempty,oneof=mon tue"`
+	At       string    `json:"at" validate:"omitempty,clock"`
+	When     time.Time `json:"when" validate:"required"`
+}
+
+func validPayload() testPayload {
+	return testPayload{
+		Name:   "abc",
+		Email:  "rider@example.com",
+		Lat:    46.55,
+		Radius: 500,
+		Days:   []string{"tue", "mon"},
+		At:     "07:45",
+		When:   time.Now(),
+	}
+}
+
+func TestStructValid(t *testing.T) {
+	p := validPayload()
+	assert.NoError(t, Struct(&p))
+}
+
+func TestStructReportsAllFieldErrors(t *testing.T) {
+	p := testPayload{
+		Name:     "ab",
+		Email:    "nope",
+		Password: "abcdefgh",
+		Lat:      91,
+		Radius:   0,
+		Mode:     "car",
+		Days:     []string{"mon", "sun"},
+		At:       "7:45",
+	}
+
+	err := Struct(&p)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, data.ErrValidation))
+
+	var verr *data.ValidationError
+	require.True(t, errors.As(err, &verr))
+
+	codes := map[string]string{}
+	for _, f := range verr.Fields {
+		codes[f.Field] = f.Code
+	}
+
+	assert.Equal(t, map[string]string{
+		"name":     "too_short",
+		"email":    "invalid_email",
+		"password": "weak_password",
+		"lat":      "out_of_range",
+		"radius":   "too_small",
+		"mode":     "not_allowed",
+		"days":     "not_allowed",
+		"at":       "invalid_time",
+		"when":     "required",
+	}, codes)
+}
+
+func TestStructRequiredStopsFurtherRules(t *testing.T) {
+	p := validPayload()
+	p.Name = "   "
+
+	var verr *data.ValidationError
+	require.True(t, errors.As(Struct(&p), &verr))
+	assert.Len(t, verr.Fields, 1)
+	assert.Equal(t, "required", verr.Fields[0].Code)
+}
+
+func TestStructPasswordBytes(t *testing.T) {
+	p := validPayload()
+	// 30 characters but 57 bytes, well within what bcrypt reads.
+	p.Password = strings.Repeat("ž", 27) + "123"
+	assert.NoError(t, Struct(&p))
+
+	p.Password = strings.Repeat("ž", 35) + "12"
+	assert.NoError(t, Struct(&p), "72 bytes")
+
+	p.Password = strings.Repeat("ž", 35) + "123"
+	var verr *data.ValidationError
+	require.True(t, errors.As(Struct(&p), &verr), "73 bytes")
+	require.Len(t, verr.Fields, 1)
+	assert.Equal(t, "too_long", verr.Fields[0].Code)
+}
+
+func TestStructZeroCoordinates(t *testing.T) {
+	assert.NoError(t, Struct(&data.Location{Latitude: 0, Longitude: 0, Radius: 500}),
+		"the equator and the prime meridian are coordinates")
+	assert.NoError(t, Struct(&data.PathLocation{}))
+}
+
+func TestStructNestedFieldNames(t *testing.T) {
+	type outer struct {
+		Inner testPayload `json:"inner"`
+	}
+
+	o := outer{Inner: validPayload()}
+	o.Inner.Email = "bad"
+
+	var verr *data.ValidationError
+	require.True(t, errors.As(Struct(&o), &verr))
+	assert.Equal(t, "inner.email", verr.Fields[0].Field)
+}